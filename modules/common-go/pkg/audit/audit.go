@@ -0,0 +1,230 @@
+// Package audit records security-relevant actions in the append-only
+// audit_events table. Every event is chained to its predecessor by a SHA-256
+// hash, so editing or deleting a row breaks the chain at that point (see
+// VerifyChain).
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions recorded by the services. Names are <object>.<verb>.
+const (
+	ActionLogin              = "auth.login"
+	ActionLoginFailed        = "auth.login_failed"
+	ActionLogout             = "auth.logout"
+	ActionLogoutAll          = "auth.logout_all"
+	ActionBootstrap          = "tenant.bootstrap"
+	ActionImpersonationStart = "impersonation.start"
+	ActionImpersonationStop  = "impersonation.stop"
+	ActionMemberAdd          = "member.add"
+	ActionMemberRolesUpdate  = "member.roles_update"
+	ActionMemberRoleAssign   = "member.role_assign"
+	ActionMemberRoleRevoke   = "member.role_revoke"
+	ActionMemberRemove       = "member.remove"
+	ActionRoleCreate         = "role.create"
+	ActionRoleUpdate         = "role.update"
+	ActionRoleDelete         = "role.delete"
+	ActionGroupCreate        = "group.create"
+	ActionGroupUpdate        = "group.update"
+	ActionGroupDelete        = "group.delete"
+	ActionGroupMembersUpdate = "group.members_update"
+	ActionGroupMemberAdd     = "group.member_add"
+	ActionGroupMemberRemove  = "group.member_remove"
+	ActionGroupGrantsUpdate  = "group.grants_update"
+	ActionAccessRulesUpdate  = "access_rules.update"
+	ActionPolicyApply        = "rbac_policy.apply"
+	ActionPolicyRollback     = "rbac_policy.rollback"
+	ActionOrganizationCreate = "organization.create"
+	ActionOrgMemberUpdate    = "org_member.update"
+	ActionOrgMemberRemove    = "org_member.remove"
+	ActionOrgTenantAttach    = "org_tenant.attach"
+	ActionOrgTenantDetach    = "org_tenant.detach"
+	ActionUserSuspend        = "user.suspend"
+	ActionUserReactivate     = "user.reactivate"
+	ActionUserForceLogout    = "user.force_logout"
+	ActionUserUnlock         = "user.unlock"
+	ActionWebhookCreate      = "webhook.create"
+	ActionWebhookUpdate      = "webhook.update"
+	ActionWebhookDelete      = "webhook.delete"
+	ActionWebhookRotate      = "webhook.rotate_secret"
+	ActionWebhookRedeliver   = "webhook.redeliver"
+	ActionDeadLetterReplay   = "dead_letter.replay"
+	ActionDeadLetterDelete   = "dead_letter.delete"
+	ActionDeadLetterPurge    = "dead_letter.purge"
+
+	ActionPlatformAdminGrant  = "platform_admin.grant"
+	ActionPlatformAdminRevoke = "platform_admin.revoke"
+)
+
+// Event is an action to record. Empty strings are stored as NULL.
+type Event struct {
+	TenantID string
+	// ActorID is the user who acted; empty for anonymous requests such as
+	// failed logins. ImpersonatorID is the platform admin acting as ActorID.
+	ActorID        string
+	ImpersonatorID string
+	Action         string
+	TargetType     string
+	TargetID       string
+	IP             string
+	UserAgent      string
+	RequestID      string
+	Metadata       map[string]any
+}
+
+// Record is a stored event.
+type Record struct {
+	Seq            int64           `json:"seq"`
+	ID             string          `json:"id"`
+	OccurredAt     time.Time       `json:"occurred_at"`
+	TenantID       string          `json:"tenant_id,omitempty"`
+	ActorID        string          `json:"actor_id,omitempty"`
+	ImpersonatorID string          `json:"impersonator_id,omitempty"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type,omitempty"`
+	TargetID       string          `json:"target_id,omitempty"`
+	IP             string          `json:"ip,omitempty"`
+	UserAgent      string          `json:"user_agent,omitempty"`
+	RequestID      string          `json:"request_id,omitempty"`
+	Metadata       json.RawMessage `json:"metadata"`
+	PrevHash       string          `json:"prev_hash"`
+	Hash           string          `json:"hash"`
+}
+
+// Recorder appends events to the audit log.
+type Recorder interface {
+	Record(ctx context.Context, e Event) error
+}
+
+// NoopRecorder discards events.
+type NoopRecorder struct{}
+
+func (NoopRecorder) Record(context.Context, Event) error { return nil }
+
+// FromRequest starts an event for action with the actor, impersonator, client
+// IP, user agent and request ID of the request. It must run after AuthN for
+// the actor to be known.
+func FromRequest(c *gin.Context, action string) Event {
+	return Event{
+		ActorID:        c.GetString("uid"),
+		ImpersonatorID: c.GetString("act"),
+		Action:         action,
+		IP:             c.ClientIP(),
+		UserAgent:      c.GetHeader("User-Agent"),
+		RequestID:      c.GetString("request_id"),
+	}
+}
+
+// hashInput is the canonical form a record's hash covers. Field order is
+// part of the format; Metadata is Postgres' jsonb text rendering so that the
+// hash can be recomputed from the stored row.
+type hashInput struct {
+	Seq            int64           `json:"seq"`
+	ID             string          `json:"id"`
+	OccurredAt     string          `json:"occurred_at"`
+	TenantID       string          `json:"tenant_id"`
+	ActorID        string          `json:"actor_id"`
+	ImpersonatorID string          `json:"impersonator_id"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type"`
+	TargetID       string          `json:"target_id"`
+	IP             string          `json:"ip"`
+	UserAgent      string          `json:"user_agent"`
+	RequestID      string          `json:"request_id"`
+	Metadata       json.RawMessage `json:"metadata"`
+	PrevHash       string          `json:"prev_hash"`
+}
+
+// ComputeHash returns the chain hash of r from its fields and PrevHash.
+func ComputeHash(r Record) (string, error) {
+	metadata := r.Metadata
+	if len(metadata) == 0 {
+		metadata = json.RawMessage("{}")
+	}
+	b, err := json.Marshal(hashInput{
+		Seq:            r.Seq,
+		ID:             r.ID,
+		OccurredAt:     r.OccurredAt.UTC().Format(time.RFC3339Nano),
+		TenantID:       r.TenantID,
+		ActorID:        r.ActorID,
+		ImpersonatorID: r.ImpersonatorID,
+		Action:         r.Action,
+		TargetType:     r.TargetType,
+		TargetID:       r.TargetID,
+		IP:             r.IP,
+		UserAgent:      r.UserAgent,
+		RequestID:      r.RequestID,
+		Metadata:       metadata,
+		PrevHash:       r.PrevHash,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ChainError reports the first record whose hash or link to its predecessor
+// does not match.
+type ChainError struct {
+	Seq    int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return "audit chain broken at seq " + strconv.FormatInt(e.Seq, 10) + ": " + e.Reason
+}
+
+// VerifyChain checks consecutive records in seq order. prevHash is the hash
+// of the record before records[0], or "" if records[0] starts the log.
+// It returns the hash of the last record.
+func VerifyChain(prevHash string, records []Record) (string, error) {
+	for i, r := range records {
+		if i > 0 && r.Seq != records[i-1].Seq+1 {
+			return prevHash, &ChainError{Seq: r.Seq, Reason: "missing record before this one"}
+		}
+		if r.PrevHash != prevHash {
+			return prevHash, &ChainError{Seq: r.Seq, Reason: "prev_hash does not match the previous record"}
+		}
+		want, err := ComputeHash(r)
+		if err != nil {
+			return prevHash, err
+		}
+		if r.Hash != want {
+			return prevHash, &ChainError{Seq: r.Seq, Reason: "hash does not match the record"}
+		}
+		prevHash = r.Hash
+	}
+	return prevHash, nil
+}
+
+// ErrInvalidCursor is returned for a cursor not produced by EncodeCursor.
+var ErrInvalidCursor = errors.New("invalid_cursor")
+
+// EncodeCursor returns an opaque page cursor that resumes after seq.
+func EncodeCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(seq, 10)))
+}
+
+// DecodeCursor parses a cursor from EncodeCursor.
+func DecodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	seq, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || seq <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
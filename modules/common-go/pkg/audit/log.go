@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// chainLockKey is the transaction-level advisory lock that serializes
+// appends, so each record links to the one committed before it.
+const chainLockKey int64 = 0x61756469745f6576 // "audit_ev"
+
+const verifyBatchSize = 1000
+
+// Log is the Postgres-backed audit log.
+type Log struct {
+	DB *pgxpool.Pool
+}
+
+// Filter selects records for List and After. Zero fields do not filter.
+type Filter struct {
+	TenantID   string
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	// Before is a cursor position: only records with a lower seq are listed.
+	Before int64
+	Limit  int
+}
+
+// Record appends e to the log.
+func (l *Log) Record(ctx context.Context, e Event) error {
+	metadata := e.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	tx, err := l.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err = tx.Exec(ctx, `select pg_advisory_xact_lock($1)`, chainLockKey); err != nil {
+		return err
+	}
+	r := Record{
+		ID:             uuid.NewString(),
+		OccurredAt:     time.Now().UTC().Truncate(time.Microsecond),
+		TenantID:       e.TenantID,
+		ActorID:        e.ActorID,
+		ImpersonatorID: e.ImpersonatorID,
+		Action:         e.Action,
+		TargetType:     e.TargetType,
+		TargetID:       e.TargetID,
+		IP:             e.IP,
+		UserAgent:      e.UserAgent,
+		RequestID:      e.RequestID,
+	}
+	// The hash covers the metadata as Postgres renders the stored jsonb, so
+	// that verification can recompute it from the row.
+	var metadataText string
+	err = tx.QueryRow(ctx, `
+select coalesce((select seq from audit_events order by seq desc limit 1), 0) + 1,
+       coalesce((select hash from audit_events order by seq desc limit 1), ''),
+       $1::text::jsonb::text`, string(metadataJSON)).Scan(&r.Seq, &r.PrevHash, &metadataText)
+	if err != nil {
+		return err
+	}
+	r.Metadata = json.RawMessage(metadataText)
+	if r.Hash, err = ComputeHash(r); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+insert into audit_events(seq, id, occurred_at, tenant_id, actor_user_id, impersonator_user_id, action, target_type, target_id, ip, user_agent, request_id, metadata, prev_hash, hash)
+values ($1, $2, $3, nullif($4, ''), nullif($5, ''), nullif($6, ''), $7, nullif($8, ''), nullif($9, ''), nullif($10, ''), nullif($11, ''), nullif($12, ''), $13::jsonb, $14, $15)`,
+		r.Seq, r.ID, r.OccurredAt, r.TenantID, r.ActorID, r.ImpersonatorID, r.Action, r.TargetType, r.TargetID, r.IP, r.UserAgent, r.RequestID, metadataText, r.PrevHash, r.Hash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// List returns records matching f, newest first, and whether older ones
+// follow.
+func (l *Log) List(ctx context.Context, f Filter) ([]Record, bool, error) {
+	since, until := f.timeRange()
+	rows, err := l.DB.Query(ctx, `
+select `+recordColumns+`
+from audit_events
+where `+filterClause+`
+  and ($8 = 0 or seq < $8)
+order by seq desc
+limit $9`, f.TenantID, f.ActorID, f.Action, f.TargetType, f.TargetID, since, until, f.Before, f.Limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	records, err := collectRecords(rows)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(records) > f.Limit {
+		return records[:f.Limit], true, nil
+	}
+	return records, false, nil
+}
+
+// After returns up to f.Limit records matching f with a seq above after,
+// oldest first. Exporters page through the log with it; f.Before is ignored.
+func (l *Log) After(ctx context.Context, after int64, f Filter) ([]Record, error) {
+	since, until := f.timeRange()
+	rows, err := l.DB.Query(ctx, `
+select `+recordColumns+`
+from audit_events
+where `+filterClause+`
+  and seq > $8
+order by seq asc
+limit $9`, f.TenantID, f.ActorID, f.Action, f.TargetType, f.TargetID, since, until, after, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectRecords(rows)
+}
+
+// Verify recomputes the hash chain over the whole log. It returns the number
+// of records checked and a *ChainError if the chain is broken.
+func (l *Log) Verify(ctx context.Context) (int64, error) {
+	var checked, after int64
+	prevHash := ""
+	for {
+		rows, err := l.DB.Query(ctx, `select `+recordColumns+` from audit_events where seq > $1 order by seq asc limit $2`, after, verifyBatchSize)
+		if err != nil {
+			return checked, err
+		}
+		records, err := collectRecords(rows)
+		if err != nil {
+			return checked, err
+		}
+		if len(records) == 0 {
+			return checked, nil
+		}
+		if records[0].Seq != after+1 {
+			return checked, &ChainError{Seq: records[0].Seq, Reason: "missing record before this one"}
+		}
+		if prevHash, err = VerifyChain(prevHash, records); err != nil {
+			return checked, err
+		}
+		checked += int64(len(records))
+		after = records[len(records)-1].Seq
+	}
+}
+
+// filterClause applies a Filter bound as $1-$7 (see Filter.timeRange).
+const filterClause = `($1 = '' or tenant_id = $1)
+  and ($2 = '' or actor_user_id = $2)
+  and ($3 = '' or action = $3)
+  and ($4 = '' or target_type = $4)
+  and ($5 = '' or target_id = $5)
+  and ($6::timestamptz is null or occurred_at >= $6)
+  and ($7::timestamptz is null or occurred_at < $7)`
+
+func (f Filter) timeRange() (since, until *time.Time) {
+	if !f.Since.IsZero() {
+		since = &f.Since
+	}
+	if !f.Until.IsZero() {
+		until = &f.Until
+	}
+	return since, until
+}
+
+const recordColumns = `seq, id, occurred_at, coalesce(tenant_id, ''), coalesce(actor_user_id, ''), coalesce(impersonator_user_id, ''), action,
+       coalesce(target_type, ''), coalesce(target_id, ''), coalesce(ip, ''), coalesce(user_agent, ''), coalesce(request_id, ''),
+       metadata::text, prev_hash, hash`
+
+func collectRecords(rows pgx.Rows) ([]Record, error) {
+	defer rows.Close()
+	records := make([]Record, 0)
+	for rows.Next() {
+		var r Record
+		var metadata string
+		if err := rows.Scan(&r.Seq, &r.ID, &r.OccurredAt, &r.TenantID, &r.ActorID, &r.ImpersonatorID, &r.Action,
+			&r.TargetType, &r.TargetID, &r.IP, &r.UserAgent, &r.RequestID, &metadata, &r.PrevHash, &r.Hash); err != nil {
+			return nil, err
+		}
+		r.OccurredAt = r.OccurredAt.UTC()
+		r.Metadata = json.RawMessage(metadata)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
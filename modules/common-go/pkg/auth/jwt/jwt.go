@@ -2,31 +2,124 @@ package jwt
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	jwtv5 "github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	// MaxRoleClaims caps the number of entries in the roles claim.
+	MaxRoleClaims = 16
+	// MaxScopeClaims caps the number of entries in the scp claim.
+	MaxScopeClaims = 64
+	// MaxAuthzClaimBytes caps the combined length of all role and scope values
+	// so tokens stay well below common header size limits.
+	MaxAuthzClaimBytes = 2048
+)
+
+var ErrAuthzClaimsTooLarge = errors.New("authz_claims_too_large")
+
 type Claims struct {
 	UID string `json:"uid"`
 	TID string `json:"tid,omitempty"`
 	Typ string `json:"typ"`
+	// Roles, Scp and AuthzVer are only present on tenant-scoped access tokens.
+	// AuthzVer is the membership's authorization version at issue time; a
+	// role change bumps it and makes the token's roles/scp stale.
+	Roles    []string `json:"roles,omitempty"`
+	Scp      []string `json:"scp,omitempty"`
+	AuthzVer int64    `json:"azv,omitempty"`
+	// Act names the party acting on behalf of the subject (RFC 8693 actor
+	// claim). It is only present on impersonation tokens, whose jti is the
+	// impersonation session ID.
+	Act *Actor `json:"act,omitempty"`
 	jwtv5.RegisteredClaims
 }
 
+// Actor is the RFC 8693 "act" claim.
+type Actor struct {
+	Sub string `json:"sub"`
+}
+
+// Authz holds the optional authorization claims of a tenant-scoped access token.
+type Authz struct {
+	Roles   []string
+	Scopes  []string
+	Version int64
+}
+
+// Validate enforces the claim size limits.
+func (a Authz) Validate() error {
+	if len(a.Roles) > MaxRoleClaims {
+		return fmt.Errorf("%w: %d roles (max %d)", ErrAuthzClaimsTooLarge, len(a.Roles), MaxRoleClaims)
+	}
+	if len(a.Scopes) > MaxScopeClaims {
+		return fmt.Errorf("%w: %d scopes (max %d)", ErrAuthzClaimsTooLarge, len(a.Scopes), MaxScopeClaims)
+	}
+	size := 0
+	for _, v := range a.Roles {
+		size += len(v)
+	}
+	for _, v := range a.Scopes {
+		size += len(v)
+	}
+	if size > MaxAuthzClaimBytes {
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrAuthzClaimsTooLarge, size, MaxAuthzClaimBytes)
+	}
+	return nil
+}
+
 func Sign(secret, issuer, audience, uid, tid, typ string, ttl time.Duration) (string, error) {
-	now := time.Now()
+	return sign(secret, issuer, audience, Claims{UID: uid, TID: tid, Typ: typ}, ttl)
+}
+
+// SignAccessTokenWithAuthz issues a tenant-scoped access token carrying roles,
+// scp and azv claims. It fails with ErrAuthzClaimsTooLarge when authz exceeds
+// the claim size limits.
+func SignAccessTokenWithAuthz(secret, issuer, audience, uid, tid string, authz Authz, ttl time.Duration) (string, error) {
+	if err := authz.Validate(); err != nil {
+		return "", err
+	}
+	return sign(secret, issuer, audience, Claims{
+		UID:      uid,
+		TID:      tid,
+		Typ:      "access",
+		Roles:    authz.Roles,
+		Scp:      authz.Scopes,
+		AuthzVer: authz.Version,
+	}, ttl)
+}
+
+// SignImpersonationToken issues an access token for uid on behalf of actor.
+// The token carries an act claim naming actor and sessionID as its jti; tid
+// and authz are optional as for SignAccessTokenWithAuthz.
+func SignImpersonationToken(secret, issuer, audience, uid, tid, actor, sessionID string, authz Authz, ttl time.Duration) (string, error) {
+	if err := authz.Validate(); err != nil {
+		return "", err
+	}
 	claims := Claims{
-		UID: uid,
-		TID: tid,
-		Typ: typ,
-		RegisteredClaims: jwtv5.RegisteredClaims{
-			Issuer:    issuer,
-			Audience:  jwtv5.ClaimStrings{audience},
-			IssuedAt:  jwtv5.NewNumericDate(now),
-			ExpiresAt: jwtv5.NewNumericDate(now.Add(ttl)),
-			Subject:   uid,
-		},
+		UID:      uid,
+		TID:      tid,
+		Typ:      "access",
+		Roles:    authz.Roles,
+		Scp:      authz.Scopes,
+		AuthzVer: authz.Version,
+		Act:      &Actor{Sub: actor},
+	}
+	claims.ID = sessionID
+	return sign(secret, issuer, audience, claims, ttl)
+}
+
+func sign(secret, issuer, audience string, claims Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwtv5.RegisteredClaims{
+		ID:        claims.ID,
+		Issuer:    issuer,
+		Audience:  jwtv5.ClaimStrings{audience},
+		IssuedAt:  jwtv5.NewNumericDate(now),
+		ExpiresAt: jwtv5.NewNumericDate(now.Add(ttl)),
+		Subject:   claims.UID,
 	}
 	token := jwtv5.NewWithClaims(jwtv5.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secret))
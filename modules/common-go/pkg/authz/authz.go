@@ -0,0 +1,128 @@
+// Package authz is the Casbin encoding of tenant authorization that
+// admin-api writes to casbin_rule and other services read back from the
+// shared database: subject and domain names, the built-in role subjects and
+// the query resolving what a tenant member is granted (see
+// ResolveTenantGrants). It also checks the platform role users hold outside
+// any tenant (see IsPlatformAdmin).
+package authz
+
+import (
+	"slices"
+	"strings"
+)
+
+// Subject and domain prefixes in casbin_rule. Permission subjects carry the
+// policies of one catalog permission, role subjects are tenant custom roles
+// and group subjects are tenant groups.
+const (
+	PermissionSubjectPrefix = "perm:"
+	RoleSubjectPrefix       = "role:"
+	GroupSubjectPrefix      = "group:"
+
+	TenantDomainPrefix = "tenant:"
+	OrgDomainPrefix    = "org:"
+	// TenantDomainWildcard and OrgDomainWildcard are the domains of policies
+	// that apply to every tenant or organization.
+	TenantDomainWildcard = TenantDomainPrefix + "*"
+	OrgDomainWildcard    = OrgDomainPrefix + "*"
+)
+
+// Casbin subjects of the built-in tenant and organization roles.
+const (
+	SubjectTenantOwner  = "tenant_owner"
+	SubjectTenantAdmin  = "tenant_admin"
+	SubjectTenantMember = "member"
+	SubjectOrgOwner     = "org_owner"
+	SubjectOrgAdmin     = "org_admin"
+)
+
+// Built-in tenant role names, as stored in tenant_users.roles.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// TenantDomain returns the Casbin domain for tenantID.
+func TenantDomain(tenantID string) string {
+	return TenantDomainPrefix + tenantID
+}
+
+// OrgDomain returns the Casbin domain for orgID.
+func OrgDomain(orgID string) string {
+	return OrgDomainPrefix + orgID
+}
+
+// PermissionSubject returns the Casbin subject of the named permission.
+func PermissionSubject(name string) string {
+	return PermissionSubjectPrefix + name
+}
+
+// CustomRoleSubject returns the Casbin subject of the named custom role.
+func CustomRoleSubject(name string) string {
+	return RoleSubjectPrefix + name
+}
+
+// GroupSubject returns the Casbin subject of a tenant group.
+func GroupSubject(groupID string) string {
+	return GroupSubjectPrefix + groupID
+}
+
+// IsBuiltinTenantRole reports whether role is one of the built-in tenant role
+// names ("owner", "admin", "member").
+func IsBuiltinTenantRole(role string) bool {
+	return role == RoleOwner || role == RoleAdmin || role == RoleMember
+}
+
+// BuiltinTenantRoleSubject maps a built-in tenant role name to its Casbin
+// subject.
+func BuiltinTenantRoleSubject(role string) (string, bool) {
+	switch role {
+	case RoleOwner:
+		return SubjectTenantOwner, true
+	case RoleAdmin:
+		return SubjectTenantAdmin, true
+	case RoleMember:
+		return SubjectTenantMember, true
+	}
+	return "", false
+}
+
+// TenantRoleName maps a built-in or custom role subject back to its tenant
+// role name.
+func TenantRoleName(subject string) (string, bool) {
+	switch subject {
+	case SubjectTenantOwner:
+		return RoleOwner, true
+	case SubjectTenantAdmin:
+		return RoleAdmin, true
+	case SubjectTenantMember:
+		return RoleMember, true
+	}
+	return strings.CutPrefix(subject, RoleSubjectPrefix)
+}
+
+// SortTenantRoles de-duplicates tenant role names and orders them owner,
+// admin, custom roles alphabetically, then member.
+func SortTenantRoles(roles []string) []string {
+	rank := func(role string) int {
+		switch role {
+		case RoleOwner:
+			return 0
+		case RoleAdmin:
+			return 1
+		case RoleMember:
+			return 3
+		default:
+			return 2
+		}
+	}
+	out := slices.Clone(roles)
+	slices.SortFunc(out, func(a, b string) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		return strings.Compare(a, b)
+	})
+	return slices.Compact(out)
+}
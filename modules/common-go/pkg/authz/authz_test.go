@@ -0,0 +1,49 @@
+package authz
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTenantRoleName_RoundTripsRoleSubjects(t *testing.T) {
+	for _, role := range []string{RoleOwner, RoleAdmin, RoleMember} {
+		subject, ok := BuiltinTenantRoleSubject(role)
+		if !ok {
+			t.Fatalf("BuiltinTenantRoleSubject(%q) not found", role)
+		}
+		if got, ok := TenantRoleName(subject); !ok || got != role {
+			t.Fatalf("TenantRoleName(%q)=%q,%v want %q", subject, got, ok, role)
+		}
+	}
+	if got, ok := TenantRoleName(CustomRoleSubject("billing-viewer")); !ok || got != "billing-viewer" {
+		t.Fatalf("TenantRoleName(custom)=%q,%v", got, ok)
+	}
+	for _, subject := range []string{PermissionSubject("roles:read"), GroupSubject("g1"), SubjectOrgOwner} {
+		if got, ok := TenantRoleName(subject); ok {
+			t.Fatalf("TenantRoleName(%q)=%q want no role", subject, got)
+		}
+	}
+	if _, ok := BuiltinTenantRoleSubject("billing-viewer"); ok {
+		t.Fatal("BuiltinTenantRoleSubject accepted a custom role")
+	}
+}
+
+func TestSortTenantRoles(t *testing.T) {
+	got := SortTenantRoles([]string{"member", "support", "admin", "billing", "owner", "admin"})
+	want := []string{"owner", "admin", "billing", "support", "member"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("SortTenantRoles()=%v want %v", got, want)
+	}
+}
+
+func TestDomains(t *testing.T) {
+	if got := TenantDomain("t1"); got != "tenant:t1" {
+		t.Fatalf("TenantDomain=%q", got)
+	}
+	if got := OrgDomain("o1"); got != "org:o1" {
+		t.Fatalf("OrgDomain=%q", got)
+	}
+	if TenantDomainWildcard != "tenant:*" || OrgDomainWildcard != "org:*" {
+		t.Fatalf("wildcards=%q,%q", TenantDomainWildcard, OrgDomainWildcard)
+	}
+}
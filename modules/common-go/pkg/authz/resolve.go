@@ -0,0 +1,94 @@
+package authz
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Querier is the subset of pgxpool.Pool and pgx.Tx the queries need.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// ResolveTenantGrants follows the tenant's grouping rules in casbin_rule from
+// a member's roles and groups to the roles, permissions and parent groups
+// they grant. memberRoles are the member's tenant_users.roles and orgRoles
+// their roles in the tenant's organization. It returns all of these plus the
+// roles granted through groups, in SortTenantRoles order, and the
+// permissions they hold. Owners and admins hold every permission.
+func ResolveTenantGrants(ctx context.Context, q Querier, tenantID, userID string, memberRoles, orgRoles []string) (roles, permissions []string, err error) {
+	subjects := make([]string, 0, len(memberRoles))
+	for _, role := range memberRoles {
+		if !IsBuiltinTenantRole(role) {
+			subjects = append(subjects, CustomRoleSubject(role))
+		}
+	}
+	rows, err := q.Query(ctx, `
+with recursive reached(subject) as (
+  select unnest($3::text[])
+  union
+  select $5::text || group_id from tenant_group_members where tenant_id=$1 and user_id=$2
+  union
+  select r.v1::text from casbin_rule r join reached on r.v0 = reached.subject
+  where r.ptype='g' and r.v2=$4
+)
+select subject from reached`, tenantID, userID, subjects, TenantDomain(tenantID), GroupSubjectPrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	reached, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roles = slices.Concat(memberRoles, orgRoles)
+	for _, subject := range reached {
+		if perm, ok := strings.CutPrefix(subject, PermissionSubjectPrefix); ok {
+			permissions = append(permissions, perm)
+		} else if role, ok := TenantRoleName(subject); ok {
+			roles = append(roles, role)
+		}
+	}
+	roles = SortTenantRoles(roles)
+
+	if slices.Contains(roles, RoleOwner) || slices.Contains(roles, RoleAdmin) {
+		permissions, err = AllPermissions(ctx, q)
+		return roles, permissions, err
+	}
+	slices.Sort(permissions)
+	return roles, slices.Compact(permissions), nil
+}
+
+// AllPermissions returns the names of all permissions that have policies, in
+// order.
+func AllPermissions(ctx context.Context, q Querier) ([]string, error) {
+	rows, err := q.Query(ctx, `
+select distinct substr(v0, length($1) + 1)
+from casbin_rule
+where ptype='p' and starts_with(v0, $1)
+order by 1`, PermissionSubjectPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// PlatformRoleAdmin is the users.platform_role of platform administrators.
+const PlatformRoleAdmin = "admin"
+
+// IsPlatformAdmin reports whether userID holds the platform admin role.
+// Suspended users hold no role.
+func IsPlatformAdmin(ctx context.Context, q Querier, userID string) (bool, error) {
+	rows, err := q.Query(ctx, `
+select exists (
+  select 1 from users
+  where id=$1 and platform_role=$2 and status <> 2
+)`, userID, PlatformRoleAdmin)
+	if err != nil {
+		return false, err
+	}
+	return pgx.CollectExactlyOneRow(rows, pgx.RowTo[bool])
+}
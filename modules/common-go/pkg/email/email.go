@@ -2,8 +2,10 @@ package email
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -12,12 +14,10 @@ import (
 	"mime"
 	"mime/multipart"
 	"mime/quotedprintable"
-	"net"
 	"net/mail"
-	"net/smtp"
 	"net/textproto"
-	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -29,8 +29,6 @@ var (
 	ErrInvalidHeader   = errors.New("invalid_header")
 )
 
-var smtpSendMail = smtp.SendMail
-
 // SMTPConfig stores SMTP delivery settings and default sender identity.
 type SMTPConfig struct {
 	Host      string
@@ -39,23 +37,53 @@ type SMTPConfig struct {
 	Password  string
 	FromEmail string
 	FromName  string
+
+	// TLSPolicy is one of the TLS* policies; empty is TLSOpportunistic.
+	TLSPolicy string
+	// RootCAs verifies the server certificate; nil uses the system roots.
+	RootCAs *x509.CertPool
+	// AuthMechanism is AuthPlain, AuthLogin or AuthCRAMMD5; empty picks one
+	// the server offers. AUTH is only used when Username or Password is set.
+	AuthMechanism string
+	// LocalName is the host name sent with EHLO; empty is "localhost".
+	LocalName string
+
+	// DialTimeout bounds connecting, including the TLS handshake of
+	// TLSImplicit, and CommandTimeout each later command; the context of
+	// Client.Send can end either sooner.
+	DialTimeout    time.Duration
+	CommandTimeout time.Duration
+	// A Client keeps up to MaxIdleConns connections open for IdleTimeout
+	// after a message and closes each after MaxMessagesPerConn messages.
+	MaxIdleConns       int
+	IdleTimeout        time.Duration
+	MaxMessagesPerConn int
 }
 
-// SendEmail sends a single multipart/alternative message to one recipient.
+// SendEmail sends a single multipart/alternative message to one recipient
+// over a connection of its own. A Client reuses connections.
 func (c SMTPConfig) SendEmail(to, subject, htmlBody, textBody string) error {
+	client := NewClient(c)
+	defer client.Close()
+	return client.Send(context.Background(), to, subject, htmlBody, textBody)
+}
+
+// message validates the config and the email and returns the recipient
+// address with the message to send.
+func (c SMTPConfig) message(to, subject, htmlBody, textBody string) (string, []byte, error) {
 	if err := c.validate(); err != nil {
-		return err
+		return "", nil, err
 	}
 	if strings.TrimSpace(htmlBody) == "" && strings.TrimSpace(textBody) == "" {
-		return ErrEmptyBody
+		return "", nil, ErrEmptyBody
 	}
 	if hasHeaderBreak(subject) || hasHeaderBreak(c.FromName) {
-		return ErrInvalidHeader
+		return "", nil, ErrInvalidHeader
 	}
 
 	toAddr, err := mail.ParseAddress(strings.TrimSpace(to))
 	if err != nil || toAddr.Address == "" {
-		return ErrInvalidToEmail
+		return "", nil, ErrInvalidToEmail
 	}
 
 	fromHeader := (&mail.Address{
@@ -65,16 +93,9 @@ func (c SMTPConfig) SendEmail(to, subject, htmlBody, textBody string) error {
 
 	msg, err := buildMessage(fromHeader, toAddr.String(), subject, htmlBody, textBody)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-
-	var auth smtp.Auth
-	if strings.TrimSpace(c.Username) != "" || c.Password != "" {
-		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
-	}
-
-	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
-	return smtpSendMail(addr, auth, c.FromEmail, []string{toAddr.Address}, msg)
+	return toAddr.Address, msg, nil
 }
 
 // GenerateOTP returns a zero-padded 6-digit numeric code in range 000000-999999.
@@ -115,6 +136,16 @@ func (c SMTPConfig) validate() error {
 	if err != nil || fromAddr.Address == "" {
 		return ErrEmptyFromEmail
 	}
+	switch c.tlsPolicy() {
+	case TLSOpportunistic, TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return ErrInvalidTLSPolicy
+	}
+	switch strings.ToUpper(strings.TrimSpace(c.AuthMechanism)) {
+	case "", AuthPlain, AuthLogin, AuthCRAMMD5:
+	default:
+		return ErrInvalidAuthMechanism
+	}
 	return nil
 }
 
@@ -1,14 +1,12 @@
 package email
 
 import (
-	"bytes"
 	"encoding/base64"
 	"errors"
 	"io"
 	"mime"
 	"mime/multipart"
 	"net/mail"
-	"net/smtp"
 	"regexp"
 	"strconv"
 	"strings"
@@ -16,31 +14,10 @@ import (
 )
 
 func TestSMTPConfigSendEmail_BuildsMultipartAlternativeMessage(t *testing.T) {
-	origSendMail := smtpSendMail
-	t.Cleanup(func() { smtpSendMail = origSendMail })
-
-	var gotAddr string
-	var gotAuth smtp.Auth
-	var gotFrom string
-	var gotTo []string
-	var gotMsg []byte
-	smtpSendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
-		gotAddr = addr
-		gotAuth = auth
-		gotFrom = from
-		gotTo = append([]string(nil), to...)
-		gotMsg = append([]byte(nil), msg...)
-		return nil
-	}
-
-	cfg := SMTPConfig{
-		Host:      "smtp.example.com",
-		Port:      587,
-		Username:  "mailer",
-		Password:  "secret",
-		FromEmail: "noreply@example.com",
-		FromName:  "AnvilKit",
-	}
+	srv := newFakeSMTPServer(t, func(s *fakeSMTPServer) { s.authMechs = []string{AuthPlain} })
+	cfg := srv.config()
+	cfg.Username = "mailer"
+	cfg.Password = "secret"
 
 	err := cfg.SendEmail(
 		"user@example.com",
@@ -52,20 +29,25 @@ func TestSMTPConfigSendEmail_BuildsMultipartAlternativeMessage(t *testing.T) {
 		t.Fatalf("send email: %v", err)
 	}
 
-	if gotAddr != "smtp.example.com:587" {
-		t.Fatalf("smtp addr=%q want=%q", gotAddr, "smtp.example.com:587")
+	conns, quits, messages := srv.stats()
+	if conns != 1 || quits != 1 {
+		t.Fatalf("conns=%d quits=%d want one connection closed with QUIT", conns, quits)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("messages=%d want=1", len(messages))
 	}
-	if gotAuth == nil {
-		t.Fatal("expected auth to be configured")
+	got := messages[0]
+	if got.auth != AuthPlain {
+		t.Fatalf("auth=%q want=%s", got.auth, AuthPlain)
 	}
-	if gotFrom != "noreply@example.com" {
-		t.Fatalf("from=%q want=noreply@example.com", gotFrom)
+	if got.from != "noreply@example.com" {
+		t.Fatalf("from=%q want=noreply@example.com", got.from)
 	}
-	if len(gotTo) != 1 || gotTo[0] != "user@example.com" {
-		t.Fatalf("to=%v want=[user@example.com]", gotTo)
+	if len(got.to) != 1 || got.to[0] != "user@example.com" {
+		t.Fatalf("to=%v want=[user@example.com]", got.to)
 	}
 
-	msg, err := mail.ReadMessage(bytes.NewReader(gotMsg))
+	msg, err := mail.ReadMessage(strings.NewReader(got.data + "\r\n"))
 	if err != nil {
 		t.Fatalf("read message: %v", err)
 	}
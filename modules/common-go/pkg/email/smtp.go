@@ -0,0 +1,424 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLS policies for SMTPConfig.TLSPolicy.
+const (
+	// TLSOpportunistic upgrades with STARTTLS when the server offers it.
+	TLSOpportunistic = "opportunistic"
+	// TLSStartTLS requires STARTTLS and fails when the server lacks it.
+	TLSStartTLS = "starttls"
+	// TLSImplicit speaks TLS from the start, usually on port 465.
+	TLSImplicit = "implicit"
+	// TLSNone never uses TLS; only meant for local relays.
+	TLSNone = "none"
+)
+
+// SMTP AUTH mechanisms for SMTPConfig.AuthMechanism.
+const (
+	AuthPlain   = "PLAIN"
+	AuthLogin   = "LOGIN"
+	AuthCRAMMD5 = "CRAM-MD5"
+)
+
+const (
+	defaultDialTimeout        = 10 * time.Second
+	defaultCommandTimeout     = 30 * time.Second
+	defaultMaxIdleConns       = 2
+	defaultIdleTimeout        = 30 * time.Second
+	defaultMaxMessagesPerConn = 100
+	defaultLocalName          = "localhost"
+)
+
+var (
+	ErrInvalidTLSPolicy     = errors.New("invalid_smtp_tls_policy")
+	ErrInvalidAuthMechanism = errors.New("invalid_smtp_auth_mechanism")
+	ErrStartTLSUnsupported  = errors.New("smtp_starttls_unsupported")
+	ErrAuthUnsupported      = errors.New("smtp_auth_unsupported")
+	ErrClientClosed         = errors.New("smtp_client_closed")
+)
+
+// Client sends email over SMTP and keeps connections open between messages.
+// It is safe for concurrent use; each message in flight has a connection of
+// its own.
+type Client struct {
+	cfg  SMTPConfig
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	now  func() time.Time
+
+	mu     sync.Mutex
+	idle   []*smtpConn
+	closed bool
+}
+
+func NewClient(cfg SMTPConfig) *Client {
+	dialer := &net.Dialer{}
+	return &Client{cfg: cfg, dial: dialer.DialContext, now: time.Now}
+}
+
+// Send sends a single multipart/alternative message to one recipient.
+// Errors the server replied with are *textproto.Error carrying the SMTP
+// code. When ctx ends first, its error is returned.
+func (c *Client) Send(ctx context.Context, to, subject, htmlBody, textBody string) error {
+	rcpt, msg, err := c.cfg.message(to, subject, htmlBody, textBody)
+	if err != nil {
+		return err
+	}
+	from := strings.TrimSpace(c.cfg.FromEmail)
+
+	for {
+		sc, reused, err := c.get(ctx)
+		if err != nil {
+			return err
+		}
+		err = sc.send(ctx, c.cfg.commandTimeout(), from, rcpt, msg)
+		if err == nil {
+			c.put(sc)
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			sc.close()
+			return ctxErr
+		}
+		// An idle connection may have been dropped by the server, or be
+		// closing (421); nothing was delivered, so retry on another.
+		var protoErr *textproto.Error
+		isProtoErr := errors.As(err, &protoErr)
+		if reused && !sc.delivering && (!isProtoErr || protoErr.Code == 421) {
+			sc.close()
+			continue
+		}
+		if isProtoErr {
+			// The server refused this message; the connection is still
+			// good once the transaction is reset.
+			if sc.step(ctx, c.cfg.commandTimeout(), sc.client.Reset) == nil {
+				c.put(sc)
+			} else {
+				sc.close()
+			}
+			return err
+		}
+		sc.close()
+		return err
+	}
+}
+
+// Close quits the idle connections. Messages in flight finish, but their
+// connections are closed afterwards and later sends fail.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	for _, sc := range idle {
+		sc.quit(c.cfg.commandTimeout())
+	}
+	return nil
+}
+
+// get returns an idle connection, or dials one when none is left.
+func (c *Client) get(ctx context.Context) (*smtpConn, bool, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, false, ErrClientClosed
+		}
+		if len(c.idle) == 0 {
+			c.mu.Unlock()
+			break
+		}
+		sc := c.idle[len(c.idle)-1]
+		c.idle = c.idle[:len(c.idle)-1]
+		c.mu.Unlock()
+
+		if c.now().Sub(sc.idleSince) < c.cfg.idleTimeout() {
+			return sc, true, nil
+		}
+		sc.quit(c.cfg.commandTimeout())
+	}
+
+	sc, err := c.connect(ctx)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, false, ctxErr
+		}
+		return nil, false, err
+	}
+	return sc, false, nil
+}
+
+// put keeps sc for the next message unless the pool is full or sc has
+// carried enough messages.
+func (c *Client) put(sc *smtpConn) {
+	c.mu.Lock()
+	if c.closed || sc.sent >= c.cfg.maxMessagesPerConn() || len(c.idle) >= c.cfg.maxIdleConns() {
+		c.mu.Unlock()
+		sc.quit(c.cfg.commandTimeout())
+		return
+	}
+	sc.idleSince = c.now()
+	c.idle = append(c.idle, sc)
+	c.mu.Unlock()
+}
+
+// connect dials the server and runs the greeting, EHLO, TLS and AUTH.
+func (c *Client) connect(ctx context.Context) (*smtpConn, error) {
+	host := strings.TrimSpace(c.cfg.Host)
+	addr := net.JoinHostPort(host, strconv.Itoa(c.cfg.Port))
+	policy := c.cfg.tlsPolicy()
+	tlsConfig := &tls.Config{ServerName: host, RootCAs: c.cfg.RootCAs, MinVersion: tls.VersionTLS12}
+
+	dialCtx, cancel := context.WithTimeout(ctx, c.cfg.dialTimeout())
+	defer cancel()
+	conn, err := c.dial(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if policy == TLSImplicit {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(dialCtx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	sc := &smtpConn{conn: conn}
+	timeout := c.cfg.commandTimeout()
+	err = sc.step(ctx, timeout, func() error {
+		client, err := smtp.NewClient(conn, host)
+		sc.client = client
+		return err
+	})
+	if err == nil {
+		err = sc.step(ctx, timeout, func() error { return sc.client.Hello(c.cfg.localName()) })
+	}
+	if err == nil && (policy == TLSOpportunistic || policy == TLSStartTLS) {
+		if ok, _ := sc.client.Extension("STARTTLS"); ok {
+			err = sc.step(ctx, timeout, func() error { return sc.client.StartTLS(tlsConfig) })
+		} else if policy == TLSStartTLS {
+			err = ErrStartTLSUnsupported
+		}
+	}
+	if err == nil {
+		err = c.authenticate(ctx, sc)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return sc, nil
+}
+
+// authenticate runs AUTH with the configured mechanism or, when none is
+// set, the first the server offers. Over a connection without TLS CRAM-MD5
+// is preferred since it does not reveal the password.
+func (c *Client) authenticate(ctx context.Context, sc *smtpConn) error {
+	if strings.TrimSpace(c.cfg.Username) == "" && c.cfg.Password == "" {
+		return nil
+	}
+	ok, params := sc.client.Extension("AUTH")
+	if !ok {
+		return ErrAuthUnsupported
+	}
+	offered := strings.Fields(strings.ToUpper(params))
+	_, isTLS := sc.client.TLSConnectionState()
+
+	preferred := []string{AuthPlain, AuthLogin, AuthCRAMMD5}
+	if !isTLS {
+		preferred = []string{AuthCRAMMD5, AuthPlain, AuthLogin}
+	}
+	if mechanism := strings.ToUpper(strings.TrimSpace(c.cfg.AuthMechanism)); mechanism != "" {
+		preferred = []string{mechanism}
+	}
+	i := slices.IndexFunc(preferred, func(m string) bool { return slices.Contains(offered, m) })
+	if i < 0 {
+		return fmt.Errorf("%w: server offers %q", ErrAuthUnsupported, params)
+	}
+
+	host := strings.TrimSpace(c.cfg.Host)
+	var auth smtp.Auth
+	switch preferred[i] {
+	case AuthPlain:
+		auth = smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, host)
+	case AuthLogin:
+		auth = &loginAuth{username: c.cfg.Username, password: c.cfg.Password, host: host}
+	case AuthCRAMMD5:
+		auth = smtp.CRAMMD5Auth(c.cfg.Username, c.cfg.Password)
+	}
+	return sc.step(ctx, c.cfg.commandTimeout(), func() error { return sc.client.Auth(auth) })
+}
+
+// smtpConn is one connection to the server. Each step runs under a
+// deadline of its own that ctx can bring forward.
+type smtpConn struct {
+	conn      net.Conn
+	client    *smtp.Client
+	sent      int
+	idleSince time.Time
+	// delivering is set once DATA was accepted, after which a failed
+	// message may have been delivered and must not be sent again.
+	delivering bool
+}
+
+func (sc *smtpConn) send(ctx context.Context, timeout time.Duration, from, to string, msg []byte) error {
+	sc.delivering = false
+	if err := sc.step(ctx, timeout, func() error { return sc.client.Mail(from) }); err != nil {
+		return err
+	}
+	if err := sc.step(ctx, timeout, func() error { return sc.client.Rcpt(to) }); err != nil {
+		return err
+	}
+	return sc.step(ctx, timeout, func() error {
+		w, err := sc.client.Data()
+		if err != nil {
+			return err
+		}
+		sc.delivering = true
+		if _, err := w.Write(msg); err != nil {
+			_ = w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		sc.sent++
+		return nil
+	})
+}
+
+// step runs fn with the connection deadline set to timeout from now, or
+// to ctx's deadline when sooner. Cancelling ctx interrupts fn.
+func (sc *smtpConn) step(ctx context.Context, timeout time.Duration, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	ctxDeadline, ok := ctx.Deadline()
+	byCtx := ok && ctxDeadline.Before(deadline)
+	if byCtx {
+		deadline = ctxDeadline
+	}
+	if err := sc.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = sc.conn.SetDeadline(time.Unix(1, 0))
+	})
+	err := fn()
+	if !stop() {
+		// ctx ended during fn and interrupted it.
+		return ctx.Err()
+	}
+	var netErr net.Error
+	if byCtx && errors.As(err, &netErr) && netErr.Timeout() {
+		// The connection reached ctx's deadline just before ctx did.
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// quit says goodbye to the server and closes the connection.
+func (sc *smtpConn) quit(timeout time.Duration) {
+	_ = sc.conn.SetDeadline(time.Now().Add(timeout))
+	if err := sc.client.Quit(); err != nil {
+		_ = sc.conn.Close()
+	}
+}
+
+func (sc *smtpConn) close() {
+	_ = sc.conn.Close()
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp lacks. Like
+// smtp.PlainAuth it only sends credentials over TLS or to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return AuthLogin, nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "pass"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN prompt %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+func (c SMTPConfig) tlsPolicy() string {
+	policy := strings.ToLower(strings.TrimSpace(c.TLSPolicy))
+	if policy == "" {
+		return TLSOpportunistic
+	}
+	return policy
+}
+
+func (c SMTPConfig) localName() string {
+	if name := strings.TrimSpace(c.LocalName); name != "" {
+		return name
+	}
+	return defaultLocalName
+}
+
+func (c SMTPConfig) dialTimeout() time.Duration {
+	return positiveOr(c.DialTimeout, defaultDialTimeout)
+}
+
+func (c SMTPConfig) commandTimeout() time.Duration {
+	return positiveOr(c.CommandTimeout, defaultCommandTimeout)
+}
+
+func (c SMTPConfig) idleTimeout() time.Duration {
+	return positiveOr(c.IdleTimeout, defaultIdleTimeout)
+}
+
+func (c SMTPConfig) maxIdleConns() int {
+	return positiveOr(c.MaxIdleConns, defaultMaxIdleConns)
+}
+
+func (c SMTPConfig) maxMessagesPerConn() int {
+	return positiveOr(c.MaxMessagesPerConn, defaultMaxMessagesPerConn)
+}
+
+func positiveOr[T int | time.Duration](v, def T) T {
+	if v > 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,600 @@
+package email
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSMTPMessage struct {
+	conn int
+	from string
+	to   []string
+	data string
+	tls  bool
+	auth string
+}
+
+// fakeSMTPServer is an in-process SMTP server speaking enough of the
+// protocol for Client: EHLO, STARTTLS, AUTH PLAIN/LOGIN/CRAM-MD5, MAIL,
+// RCPT, DATA, RSET, NOOP and QUIT.
+type fakeSMTPServer struct {
+	ln net.Listener
+
+	// tlsConfig enables STARTTLS, or TLS from the start with implicitTLS.
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	authMechs   []string
+	username    string
+	password    string
+	// rejectRcpt maps recipients to the reply refusing them.
+	rejectRcpt map[string]string
+	// stallOn names a verb the server never replies to.
+	stallOn string
+	// dropAfter closes each connection, without a reply to the next
+	// command, once it carried that many messages.
+	dropAfter int
+
+	mu       sync.Mutex
+	conns    int
+	quits    int
+	messages []fakeSMTPMessage
+}
+
+func newFakeSMTPServer(t *testing.T, configure func(*fakeSMTPServer)) *fakeSMTPServer {
+	t.Helper()
+	s := &fakeSMTPServer{username: "mailer", password: "secret"}
+	if configure != nil {
+		configure(s)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if s.implicitTLS {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+	s.ln = ln
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(conn, done)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		_ = ln.Close()
+		wg.Wait()
+	})
+	return s
+}
+
+// config returns a client config pointing at the server.
+func (s *fakeSMTPServer) config() SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return SMTPConfig{Host: host, Port: portNum, FromEmail: "noreply@example.com", FromName: "AnvilKit"}
+}
+
+func (s *fakeSMTPServer) stats() (conns, quits int, messages []fakeSMTPMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns, s.quits, append([]fakeSMTPMessage(nil), s.messages...)
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn, done <-chan struct{}) {
+	defer conn.Close()
+	go func() {
+		<-done
+		_ = conn.Close()
+	}()
+
+	s.mu.Lock()
+	s.conns++
+	connID := s.conns
+	s.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	_, isTLS := conn.(*tls.Conn)
+	var msg fakeSMTPMessage
+	authMech := ""
+	sent := 0
+	reply := func(format string, args ...any) bool {
+		return tp.PrintfLine(format, args...) == nil
+	}
+	if !reply("220 fake.example.com ESMTP") {
+		return
+	}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		if s.dropAfter > 0 && sent >= s.dropAfter {
+			return
+		}
+		if verb == s.stallOn {
+			<-done
+			return
+		}
+		switch verb {
+		case "EHLO":
+			lines := []string{"fake.example.com"}
+			if s.tlsConfig != nil && !isTLS {
+				lines = append(lines, "STARTTLS")
+			}
+			if len(s.authMechs) > 0 {
+				lines = append(lines, "AUTH "+strings.Join(s.authMechs, " "))
+			}
+			lines = append(lines, "8BITMIME")
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				if !reply("250%s%s", sep, l) {
+					return
+				}
+			}
+		case "STARTTLS":
+			if !reply("220 2.0.0 ready") {
+				return
+			}
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			isTLS = true
+		case "AUTH":
+			mech, initial, _ := strings.Cut(arg, " ")
+			ok, err := s.auth(tp, strings.ToUpper(mech), initial)
+			if err != nil {
+				return
+			}
+			if !ok {
+				reply("535 5.7.8 authentication failed")
+				continue
+			}
+			authMech = strings.ToUpper(mech)
+			reply("235 2.7.0 authenticated")
+		case "MAIL":
+			msg = fakeSMTPMessage{conn: connID, from: pathArg(arg), tls: isTLS, auth: authMech}
+			reply("250 2.1.0 ok")
+		case "RCPT":
+			to := pathArg(arg)
+			if rejection, ok := s.rejectRcpt[to]; ok {
+				reply("%s", rejection)
+				continue
+			}
+			msg.to = append(msg.to, to)
+			reply("250 2.1.5 ok")
+		case "DATA":
+			if !reply("354 go ahead") {
+				return
+			}
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			msg.data = strings.Join(lines, "\r\n")
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			sent++
+			reply("250 2.0.0 queued")
+		case "RSET":
+			msg = fakeSMTPMessage{}
+			reply("250 2.0.0 ok")
+		case "NOOP":
+			reply("250 2.0.0 ok")
+		case "QUIT":
+			s.mu.Lock()
+			s.quits++
+			s.mu.Unlock()
+			reply("221 2.0.0 bye")
+			return
+		default:
+			reply("502 5.5.2 unknown command")
+		}
+	}
+}
+
+// auth runs one AUTH exchange and reports whether the credentials match.
+func (s *fakeSMTPServer) auth(tp *textproto.Conn, mech, initial string) (bool, error) {
+	readLine := func(prompt string) (string, error) {
+		if err := tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt))); err != nil {
+			return "", err
+		}
+		line, err := tp.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		return string(decoded), err
+	}
+
+	switch mech {
+	case AuthPlain:
+		raw, err := base64.StdEncoding.DecodeString(initial)
+		if err != nil {
+			return false, err
+		}
+		parts := strings.Split(string(raw), "\x00")
+		return len(parts) == 3 && parts[1] == s.username && parts[2] == s.password, nil
+	case AuthLogin:
+		user, err := readLine("Username:")
+		if err != nil {
+			return false, err
+		}
+		pass, err := readLine("Password:")
+		if err != nil {
+			return false, err
+		}
+		return user == s.username && pass == s.password, nil
+	case AuthCRAMMD5:
+		challenge := "<1896.697170952@fake.example.com>"
+		resp, err := readLine(challenge)
+		if err != nil {
+			return false, err
+		}
+		mac := hmac.New(md5.New, []byte(s.password))
+		mac.Write([]byte(challenge))
+		return resp == s.username+" "+hex.EncodeToString(mac.Sum(nil)), nil
+	default:
+		return false, nil
+	}
+}
+
+func pathArg(arg string) string {
+	_, path, _ := strings.Cut(arg, ":")
+	path = strings.TrimSpace(path)
+	if i := strings.Index(path, ">"); i >= 0 {
+		path = path[:i+1]
+	}
+	return strings.Trim(path, "<>")
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and a
+// pool trusting it.
+func testCertificate(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake smtp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+func sendTest(t *testing.T, c *Client, to string) error {
+	t.Helper()
+	return c.Send(context.Background(), to, "Verify login", "<p>hi</p>", "hi")
+}
+
+func TestClientSend_ReusesConnections(t *testing.T) {
+	srv := newFakeSMTPServer(t, nil)
+	cfg := srv.config()
+	cfg.MaxMessagesPerConn = 2
+	c := NewClient(cfg)
+
+	for i := range 3 {
+		if err := sendTest(t, c, fmt.Sprintf("user%d@example.com", i)); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	conns, quits, messages := srv.stats()
+	if len(messages) != 3 {
+		t.Fatalf("messages=%d want=3", len(messages))
+	}
+	if conns != 2 || quits != 2 {
+		t.Fatalf("conns=%d quits=%d want 2, 2", conns, quits)
+	}
+	if messages[0].conn != messages[1].conn || messages[2].conn == messages[0].conn {
+		t.Fatalf("message connections = %d %d %d, want the first two shared", messages[0].conn, messages[1].conn, messages[2].conn)
+	}
+	if messages[0].from != "noreply@example.com" || messages[0].to[0] != "user0@example.com" {
+		t.Fatalf("envelope = %q %v", messages[0].from, messages[0].to)
+	}
+	if err := sendTest(t, c, "late@example.com"); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("send after close err=%v want=%v", err, ErrClientClosed)
+	}
+}
+
+func TestClientSend_SendsConcurrentlyOnSeparateConnections(t *testing.T) {
+	srv := newFakeSMTPServer(t, nil)
+	c := NewClient(srv.config())
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- sendTest(t, c, fmt.Sprintf("user%d@example.com", i))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if _, _, messages := srv.stats(); len(messages) != 8 {
+		t.Fatalf("messages=%d want=8", len(messages))
+	}
+}
+
+func TestClientSend_TLSPolicies(t *testing.T) {
+	serverTLS, pool := testCertificate(t)
+
+	cases := []struct {
+		name     string
+		server   func(*fakeSMTPServer)
+		policy   string
+		rootCAs  *x509.CertPool
+		wantTLS  bool
+		wantErr  error
+		anyError bool
+	}{
+		{name: "opportunistic upgrades", server: func(s *fakeSMTPServer) { s.tlsConfig = serverTLS }, rootCAs: pool, wantTLS: true},
+		{name: "opportunistic without offer", server: nil, wantTLS: false},
+		{name: "starttls required", server: func(s *fakeSMTPServer) { s.tlsConfig = serverTLS }, policy: TLSStartTLS, rootCAs: pool, wantTLS: true},
+		{name: "starttls missing", server: nil, policy: TLSStartTLS, wantErr: ErrStartTLSUnsupported},
+		{name: "implicit", server: func(s *fakeSMTPServer) { s.tlsConfig = serverTLS; s.implicitTLS = true }, policy: TLSImplicit, rootCAs: pool, wantTLS: true},
+		{name: "none ignores offer", server: func(s *fakeSMTPServer) { s.tlsConfig = serverTLS }, policy: TLSNone, wantTLS: false},
+		{name: "untrusted certificate", server: func(s *fakeSMTPServer) { s.tlsConfig = serverTLS }, policy: TLSStartTLS, anyError: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeSMTPServer(t, tc.server)
+			cfg := srv.config()
+			cfg.TLSPolicy = tc.policy
+			cfg.RootCAs = tc.rootCAs
+			c := NewClient(cfg)
+			defer c.Close()
+
+			err := sendTest(t, c, "user@example.com")
+			switch {
+			case tc.wantErr != nil:
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("err=%v want=%v", err, tc.wantErr)
+				}
+				return
+			case tc.anyError:
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			case err != nil:
+				t.Fatalf("send: %v", err)
+			}
+			_, _, messages := srv.stats()
+			if len(messages) != 1 || messages[0].tls != tc.wantTLS {
+				t.Fatalf("messages=%+v want tls=%v", messages, tc.wantTLS)
+			}
+		})
+	}
+}
+
+func TestClientSend_AuthMechanisms(t *testing.T) {
+	serverTLS, pool := testCertificate(t)
+	all := []string{AuthLogin, AuthPlain, AuthCRAMMD5}
+
+	cases := []struct {
+		name      string
+		tls       bool
+		offered   []string
+		mechanism string
+		want      string
+	}{
+		{name: "plain", tls: true, offered: all, mechanism: AuthPlain, want: AuthPlain},
+		{name: "login", tls: true, offered: all, mechanism: "login", want: AuthLogin},
+		{name: "cram-md5", tls: true, offered: all, mechanism: AuthCRAMMD5, want: AuthCRAMMD5},
+		{name: "auto over tls prefers plain", tls: true, offered: all, want: AuthPlain},
+		{name: "auto without tls prefers cram-md5", offered: all, want: AuthCRAMMD5},
+		{name: "auto uses what is offered", tls: true, offered: []string{AuthLogin}, want: AuthLogin},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeSMTPServer(t, func(s *fakeSMTPServer) {
+				s.authMechs = tc.offered
+				if tc.tls {
+					s.tlsConfig = serverTLS
+				}
+			})
+			cfg := srv.config()
+			cfg.Username, cfg.Password = "mailer", "secret"
+			cfg.AuthMechanism = tc.mechanism
+			cfg.RootCAs = pool
+			c := NewClient(cfg)
+			defer c.Close()
+
+			if err := sendTest(t, c, "user@example.com"); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			if _, _, messages := srv.stats(); len(messages) != 1 || messages[0].auth != tc.want {
+				t.Fatalf("messages=%+v want auth=%s", messages, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientSend_AuthFailures(t *testing.T) {
+	srv := newFakeSMTPServer(t, func(s *fakeSMTPServer) { s.authMechs = []string{AuthCRAMMD5} })
+	cfg := srv.config()
+	cfg.Username, cfg.Password = "mailer", "wrong"
+	var protoErr *textproto.Error
+	if err := sendTest(t, NewClient(cfg), "user@example.com"); !errors.As(err, &protoErr) || protoErr.Code != 535 {
+		t.Fatalf("err=%v want 535", err)
+	}
+
+	cfg.Password = "secret"
+	cfg.AuthMechanism = AuthLogin
+	if err := sendTest(t, NewClient(cfg), "user@example.com"); !errors.Is(err, ErrAuthUnsupported) {
+		t.Fatalf("err=%v want=%v", err, ErrAuthUnsupported)
+	}
+
+	cfg.AuthMechanism = "XOAUTH2"
+	if err := sendTest(t, NewClient(cfg), "user@example.com"); !errors.Is(err, ErrInvalidAuthMechanism) {
+		t.Fatalf("err=%v want=%v", err, ErrInvalidAuthMechanism)
+	}
+}
+
+func TestClientSend_RecipientRejectedKeepsConnection(t *testing.T) {
+	srv := newFakeSMTPServer(t, func(s *fakeSMTPServer) {
+		s.rejectRcpt = map[string]string{"gone@example.com": "550 5.1.1 mailbox unavailable"}
+	})
+	c := NewClient(srv.config())
+	defer c.Close()
+
+	var protoErr *textproto.Error
+	if err := sendTest(t, c, "gone@example.com"); !errors.As(err, &protoErr) || protoErr.Code != 550 {
+		t.Fatalf("err=%v want 550", err)
+	}
+	if err := sendTest(t, c, "user@example.com"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	conns, _, messages := srv.stats()
+	if conns != 1 || len(messages) != 1 || len(messages[0].to) != 1 {
+		t.Fatalf("conns=%d messages=%+v want one connection and message", conns, messages)
+	}
+}
+
+func TestClientSend_RetriesDroppedIdleConnection(t *testing.T) {
+	srv := newFakeSMTPServer(t, func(s *fakeSMTPServer) { s.dropAfter = 1 })
+	cfg := srv.config()
+	cfg.CommandTimeout = 200 * time.Millisecond
+	c := NewClient(cfg)
+	defer c.Close()
+
+	for i := range 2 {
+		if err := sendTest(t, c, "user@example.com"); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if conns, _, messages := srv.stats(); conns != 2 || len(messages) != 2 {
+		t.Fatalf("conns=%d messages=%d want 2, 2", conns, len(messages))
+	}
+}
+
+func TestClientSend_IdleTimeoutDialsAgain(t *testing.T) {
+	srv := newFakeSMTPServer(t, nil)
+	cfg := srv.config()
+	cfg.IdleTimeout = time.Minute
+	c := NewClient(cfg)
+	defer c.Close()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if err := sendTest(t, c, "user@example.com"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := sendTest(t, c, "user@example.com"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if conns, quits, _ := srv.stats(); conns != 2 || quits != 1 {
+		t.Fatalf("conns=%d quits=%d want 2, 1", conns, quits)
+	}
+}
+
+func TestClientSend_CommandTimeout(t *testing.T) {
+	srv := newFakeSMTPServer(t, func(s *fakeSMTPServer) { s.stallOn = "MAIL" })
+	cfg := srv.config()
+	cfg.CommandTimeout = 100 * time.Millisecond
+	c := NewClient(cfg)
+	defer c.Close()
+
+	err := sendTest(t, c, "user@example.com")
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("err=%v want a timeout", err)
+	}
+}
+
+func TestClientSend_HonorsContext(t *testing.T) {
+	srv := newFakeSMTPServer(t, func(s *fakeSMTPServer) { s.stallOn = "DATA" })
+	c := NewClient(srv.config())
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	started := time.Now()
+	if err := c.Send(ctx, "user@example.com", "subject", "", "hi"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want=%v", err, context.Canceled)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("send took %v after cancel", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Send(ctx, "user@example.com", "subject", "", "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v want=%v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClientSend_ValidatesTLSPolicy(t *testing.T) {
+	cfg := SMTPConfig{Host: "smtp.example.com", Port: 465, FromEmail: "noreply@example.com", TLSPolicy: "sometimes"}
+	if err := NewClient(cfg).Send(context.Background(), "user@example.com", "subject", "", "hi"); !errors.Is(err, ErrInvalidTLSPolicy) {
+		t.Fatalf("err=%v want=%v", err, ErrInvalidTLSPolicy)
+	}
+}
@@ -38,6 +38,13 @@ func AuthN(secret, issuer, audience string) gin.HandlerFunc {
 
 		c.Set("uid", uid)
 		c.Set("tid", claims.TID)
+		c.Set("roles", claims.Roles)
+		c.Set("scopes", claims.Scp)
+		c.Set("authz_ver", claims.AuthzVer)
+		if claims.Act != nil && claims.Act.Sub != "" {
+			c.Set("act", claims.Act.Sub)
+			c.Set("impersonation_id", claims.ID)
+		}
 		c.Next()
 	}
 }
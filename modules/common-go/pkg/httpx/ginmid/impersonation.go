@@ -0,0 +1,86 @@
+package ginmid
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/errcode"
+)
+
+// ImpersonationLookup reports whether the impersonation session id is still
+// active, i.e. neither stopped nor expired.
+type ImpersonationLookup func(ctx context.Context, id string) (bool, error)
+
+// PlatformAdminLookup reports whether uid is a platform administrator.
+type PlatformAdminLookup func(ctx context.Context, uid string) (bool, error)
+
+// Impersonating reports whether the request carries an impersonation token.
+// It must run after AuthN.
+func Impersonating(c *gin.Context) bool {
+	return c.GetString("act") != ""
+}
+
+// DenyImpersonation rejects impersonation tokens. Put it on sensitive routes
+// (credentials, sessions, security settings, platform administration) that a
+// platform admin must not use on a user's behalf. It must run after AuthN.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Impersonating(c) {
+			_ = c.Error(apperr.Forbidden(errors.New("impersonation_forbidden")).WithData(map[string]any{"reason": "impersonation_forbidden", "code": errcode.Forbidden}))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireActiveImpersonation rejects impersonation tokens whose session has
+// been stopped, so stopping an impersonation takes effect before the token
+// expires. Other tokens pass through. It must run after AuthN.
+func RequireActiveImpersonation(lookup ImpersonationLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if lookup == nil || !Impersonating(c) {
+			c.Next()
+			return
+		}
+		active, err := lookup(c, c.GetString("impersonation_id"))
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if !active {
+			_ = c.Error(apperr.Unauthorized(errors.New("impersonation_ended")).WithData(map[string]any{"reason": "impersonation_ended"}))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePlatformAdmin restricts a route to platform administrators, as
+// reported by lookup on every request so that revoking the role takes effect
+// at once. It must run after AuthN.
+func RequirePlatformAdmin(lookup PlatformAdminLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetString("uid")
+		ok := false
+		if uid != "" && lookup != nil {
+			var err error
+			if ok, err = lookup(c, uid); err != nil {
+				_ = c.Error(err)
+				c.Abort()
+				return
+			}
+		}
+		if !ok {
+			_ = c.Error(apperr.Forbidden(errors.New("not_platform_admin")).WithData(map[string]any{"reason": "not_platform_admin", "code": errcode.Forbidden}))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
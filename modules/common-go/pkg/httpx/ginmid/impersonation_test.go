@@ -0,0 +1,133 @@
+package ginmid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	ajwt "anvilkit-auth-template/modules/common-go/pkg/auth/jwt"
+)
+
+func TestImpersonationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	token, err := ajwt.SignImpersonationToken(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "tenant-1", "admin-1", "session-1", ajwt.Authz{}, time.Minute)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	plain, err := ajwt.Sign(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "tenant-1", "access", time.Minute)
+	if err != nil {
+		t.Fatalf("sign plain token: %v", err)
+	}
+	claims, err := ajwt.Parse(testJWTSecret, testJWTIssuer, testJWTAudience, token)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	if claims.Act == nil || claims.Act.Sub != "admin-1" || claims.ID != "session-1" || claims.Subject != "uid-1" {
+		t.Fatalf("claims act=%+v jti=%q sub=%q", claims.Act, claims.ID, claims.Subject)
+	}
+
+	lookup := func(active bool, err error) ImpersonationLookup {
+		return func(_ context.Context, id string) (bool, error) {
+			if id != "session-1" {
+				t.Fatalf("lookup id=%q", id)
+			}
+			return active, err
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		handler gin.HandlerFunc
+		want    int
+		reason  string
+	}{
+		{name: "deny impersonation", token: token, handler: DenyImpersonation(), want: http.StatusForbidden, reason: "impersonation_forbidden"},
+		{name: "deny lets users through", token: plain, handler: DenyImpersonation(), want: http.StatusOK},
+		{name: "active session", token: token, handler: RequireActiveImpersonation(lookup(true, nil)), want: http.StatusOK},
+		{name: "ended session", token: token, handler: RequireActiveImpersonation(lookup(false, nil)), want: http.StatusUnauthorized, reason: "impersonation_ended"},
+		{name: "lookup error", token: token, handler: RequireActiveImpersonation(lookup(false, errors.New("boom"))), want: http.StatusInternalServerError},
+		{name: "token without act", token: plain, handler: RequireActiveImpersonation(lookup(false, nil)), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWithToken(newAuthzTestRouter(tt.handler), tt.token)
+			if w.Code != tt.want {
+				t.Fatalf("status=%d want=%d body=%s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.reason != "" {
+				assertReason(t, w, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRequirePlatformAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	token, err := ajwt.Sign(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "", "access", time.Minute)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	lookup := func(admin bool, err error) PlatformAdminLookup {
+		return func(_ context.Context, uid string) (bool, error) {
+			if uid != "uid-1" {
+				t.Fatalf("lookup uid=%q", uid)
+			}
+			return admin, err
+		}
+	}
+
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		want    int
+		reason  string
+	}{
+		{name: "platform admin", handler: RequirePlatformAdmin(lookup(true, nil)), want: http.StatusOK},
+		{name: "not platform admin", handler: RequirePlatformAdmin(lookup(false, nil)), want: http.StatusForbidden, reason: "not_platform_admin"},
+		{name: "lookup error", handler: RequirePlatformAdmin(lookup(false, errors.New("boom"))), want: http.StatusInternalServerError},
+		{name: "no lookup", handler: RequirePlatformAdmin(nil), want: http.StatusForbidden, reason: "not_platform_admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWithToken(newAuthzTestRouter(tt.handler), token)
+			if w.Code != tt.want {
+				t.Fatalf("status=%d want=%d body=%s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.reason != "" {
+				assertReason(t, w, tt.reason)
+			}
+		})
+	}
+}
+
+func TestLoggerShowsImpersonator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	token, err := ajwt.SignImpersonationToken(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "", "admin-1", "session-1", ajwt.Authz{}, time.Minute)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	r := gin.New()
+	r.Use(Logger())
+	r.GET("/protected", AuthN(testJWTSecret, testJWTIssuer, testJWTAudience), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	serveWithToken(r, token)
+
+	if !strings.Contains(buf.String(), "uid=uid-1 act=admin-1 ") {
+		t.Fatalf("log line %q does not name the impersonator", buf.String())
+	}
+}
@@ -15,7 +15,12 @@ func Logger() gin.HandlerFunc {
 		rid, _ := c.Get("request_id")
 		uid, _ := c.Get("uid")
 		tid, _ := c.Get("tid")
-		log.Printf("request_id=%v uid=%v tid=%v method=%s path=%s status=%d latency_ms=%d",
-			rid, uid, tid, c.Request.Method, c.FullPath(), c.Writer.Status(), lat)
+		// Impersonated requests name the acting platform admin as well.
+		act := ""
+		if actor := c.GetString("act"); actor != "" {
+			act = " act=" + actor
+		}
+		log.Printf("request_id=%v uid=%v%s tid=%v method=%s path=%s status=%d latency_ms=%d",
+			rid, uid, act, tid, c.Request.Method, c.FullPath(), c.Writer.Status(), lat)
 	}
 }
@@ -0,0 +1,80 @@
+package ginmid
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/errcode"
+)
+
+// AuthzVersionLookup returns the current authorization version of uid's
+// membership in tid. The bool result reports whether the membership exists.
+type AuthzVersionLookup func(ctx context.Context, tid, uid string) (int64, bool, error)
+
+// RequireScope allows the request only if the access token's scp claim
+// contains every listed scope. It must run after AuthN.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("scopes")
+		for _, s := range scopes {
+			if !slices.Contains(granted, s) {
+				_ = c.Error(apperr.Forbidden(errors.New("missing_scope")).WithData(map[string]any{"reason": "missing_scope", "scope": s, "code": errcode.Forbidden}))
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireRole allows the request only if the access token's roles claim
+// contains at least one of the listed roles. It must run after AuthN.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("roles")
+		for _, r := range roles {
+			if slices.Contains(granted, r) {
+				c.Next()
+				return
+			}
+		}
+		_ = c.Error(apperr.Forbidden(errors.New("missing_role")).WithData(map[string]any{"reason": "missing_role", "code": errcode.Forbidden}))
+		c.Abort()
+	}
+}
+
+// RequireAuthzVersion rejects tenant-scoped tokens whose azv claim no longer
+// matches the membership's current authorization version, i.e. whose roles
+// or scp claims were issued before a role change. Tokens without an azv claim
+// carry no authorization claims and pass through. It must run after AuthN.
+func RequireAuthzVersion(lookup AuthzVersionLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenVer := c.GetInt64("authz_ver")
+		tid := c.GetString("tid")
+		if lookup == nil || tokenVer == 0 || tid == "" {
+			c.Next()
+			return
+		}
+		current, ok, err := lookup(c, tid, c.GetString("uid"))
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if !ok {
+			_ = c.Error(apperr.Forbidden(errors.New("not_in_tenant")).WithData(map[string]any{"reason": "not_in_tenant", "code": errcode.Forbidden}))
+			c.Abort()
+			return
+		}
+		if current != tokenVer {
+			_ = c.Error(apperr.Unauthorized(errors.New("stale_authz_claims")).WithData(map[string]any{"reason": "stale_authz_claims"}))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
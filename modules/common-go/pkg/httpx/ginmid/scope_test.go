@@ -0,0 +1,160 @@
+package ginmid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	ajwt "anvilkit-auth-template/modules/common-go/pkg/auth/jwt"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+)
+
+func TestRequireScopeAndRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	token, err := ajwt.SignAccessTokenWithAuthz(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "tenant-1", ajwt.Authz{
+		Roles:   []string{"support"},
+		Scopes:  []string{"members:read", "roles:read"},
+		Version: 3,
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	plain, err := ajwt.Sign(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "tenant-1", "access", time.Minute)
+	if err != nil {
+		t.Fatalf("sign plain token: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		handler gin.HandlerFunc
+		want    int
+		reason  string
+	}{
+		{name: "scope granted", token: token, handler: RequireScope("members:read"), want: http.StatusOK},
+		{name: "all scopes granted", token: token, handler: RequireScope("members:read", "roles:read"), want: http.StatusOK},
+		{name: "scope missing", token: token, handler: RequireScope("members:write"), want: http.StatusForbidden, reason: "missing_scope"},
+		{name: "token without scp", token: plain, handler: RequireScope("members:read"), want: http.StatusForbidden, reason: "missing_scope"},
+		{name: "role granted", token: token, handler: RequireRole("owner", "support"), want: http.StatusOK},
+		{name: "role missing", token: token, handler: RequireRole("owner"), want: http.StatusForbidden, reason: "missing_role"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWithToken(newAuthzTestRouter(tt.handler), tt.token)
+			if w.Code != tt.want {
+				t.Fatalf("status=%d want=%d body=%s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.reason != "" {
+				assertReason(t, w, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRequireAuthzVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	token, err := ajwt.SignAccessTokenWithAuthz(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "tenant-1", ajwt.Authz{
+		Roles:   []string{"admin"},
+		Version: 3,
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	plain, err := ajwt.Sign(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "tenant-1", "access", time.Minute)
+	if err != nil {
+		t.Fatalf("sign plain token: %v", err)
+	}
+
+	lookup := func(version int64, ok bool, err error) AuthzVersionLookup {
+		return func(_ context.Context, tid, uid string) (int64, bool, error) {
+			if tid != "tenant-1" || uid != "uid-1" {
+				t.Fatalf("lookup tid=%q uid=%q", tid, uid)
+			}
+			return version, ok, err
+		}
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		lookup AuthzVersionLookup
+		want   int
+		reason string
+	}{
+		{name: "current version", token: token, lookup: lookup(3, true, nil), want: http.StatusOK},
+		{name: "stale version", token: token, lookup: lookup(4, true, nil), want: http.StatusUnauthorized, reason: "stale_authz_claims"},
+		{name: "membership removed", token: token, lookup: lookup(0, false, nil), want: http.StatusForbidden, reason: "not_in_tenant"},
+		{name: "lookup error", token: token, lookup: lookup(0, false, errors.New("boom")), want: http.StatusInternalServerError},
+		{name: "token without azv", token: plain, lookup: lookup(9, true, nil), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWithToken(newAuthzTestRouter(RequireAuthzVersion(tt.lookup)), tt.token)
+			if w.Code != tt.want {
+				t.Fatalf("status=%d want=%d body=%s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.reason != "" {
+				assertReason(t, w, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSignAccessTokenWithAuthzRejectsOversizedClaims(t *testing.T) {
+	scopes := make([]string, ajwt.MaxScopeClaims+1)
+	for i := range scopes {
+		scopes[i] = "scope"
+	}
+	_, err := ajwt.SignAccessTokenWithAuthz(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "tenant-1", ajwt.Authz{Scopes: scopes}, time.Minute)
+	if !errors.Is(err, ajwt.ErrAuthzClaimsTooLarge) {
+		t.Fatalf("err=%v want=%v", err, ajwt.ErrAuthzClaimsTooLarge)
+	}
+
+	_, err = ajwt.SignAccessTokenWithAuthz(testJWTSecret, testJWTIssuer, testJWTAudience, "uid-1", "tenant-1", ajwt.Authz{
+		Roles: []string{strings.Repeat("r", ajwt.MaxAuthzClaimBytes+1)},
+	}, time.Minute)
+	if !errors.Is(err, ajwt.ErrAuthzClaimsTooLarge) {
+		t.Fatalf("err=%v want=%v", err, ajwt.ErrAuthzClaimsTooLarge)
+	}
+}
+
+func newAuthzTestRouter(mw gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(RequestID(), ErrorHandler())
+	r.GET("/protected", AuthN(testJWTSecret, testJWTIssuer, testJWTAudience), mw, func(c *gin.Context) {
+		resp.OK(c, map[string]any{"ok": true})
+	})
+	return r
+}
+
+func serveWithToken(r http.Handler, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func assertReason(t *testing.T, w *httptest.ResponseRecorder, reason string) {
+	t.Helper()
+	var body struct {
+		Data struct {
+			Reason string `json:"reason"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Data.Reason != reason {
+		t.Fatalf("reason=%q want=%q", body.Data.Reason, reason)
+	}
+}
@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Queue backends selectable by configuration.
+const (
+	BackendList    = "list"
+	BackendStreams = "streams"
+)
+
+var ErrUnknownBackend = errors.New("unknown_queue_backend")
+
+// Client is satisfied by *redis.Client and can back either queue backend, the
+// delayed queue and the dead-letter queue.
+type Client interface {
+	RedisClient
+	StreamClient
+	DelayedClient
+	DeadLetterClient
+}
+
+// Open returns the queue for backend: "list" (the default when empty) for
+// RedisQueue or "streams" for StreamQueue. Producers and consumers of the same
+// queue must use the same backend.
+func Open(client Client, backend string, opts StreamOptions) (Queue, error) {
+	if client == nil {
+		return nil, ErrNilRedisClient
+	}
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", BackendList:
+		return New(client)
+	case BackendStreams:
+		return NewStream(client, opts)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, backend)
+	}
+}
@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	deadLetterKeySuffix = ":dead"
+
+	// DefaultDeadLetterMaxLen caps each dead-letter stream; the oldest
+	// entries are trimmed first.
+	DefaultDeadLetterMaxLen = 10000
+
+	deadLetterFieldPayload    = "payload"
+	deadLetterFieldReason     = "reason"
+	deadLetterFieldFailedAt   = "failed_at"
+	deadLetterFieldDeliveries = "deliveries"
+)
+
+var (
+	ErrDeadLetterNotFound  = errors.New("dead_letter_not_found")
+	ErrInvalidDeadLetterID = errors.New("invalid_dead_letter_id")
+	ErrInvalidReplay       = errors.New("dead_letter_payload_not_json")
+
+	streamIDPattern = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+)
+
+// Enqueuer is the producer side of Queue.
+type Enqueuer interface {
+	EnqueueContext(ctx context.Context, queueName string, payload any) error
+}
+
+// DeadLetterClient captures the subset of Redis commands used by
+// DeadLetterQueue.
+type DeadLetterClient interface {
+	XAdd(ctx context.Context, a *goredis.XAddArgs) *goredis.StringCmd
+	XRangeN(ctx context.Context, stream, start, stop string, count int64) *goredis.XMessageSliceCmd
+	XDel(ctx context.Context, stream string, ids ...string) *goredis.IntCmd
+	XLen(ctx context.Context, stream string) *goredis.IntCmd
+	Del(ctx context.Context, keys ...string) *goredis.IntCmd
+}
+
+// DeadLetter is a job that could not be processed, kept with the reason and
+// its original payload, which may not be valid JSON.
+type DeadLetter struct {
+	ID         string    `json:"id"`
+	Queue      string    `json:"queue"`
+	Payload    string    `json:"payload"`
+	Reason     string    `json:"reason"`
+	FailedAt   time.Time `json:"failed_at"`
+	Deliveries int64     `json:"deliveries"`
+}
+
+// DeadLetterQueue stores dead letters of each queue in a Redis stream
+// "<queue>:dead", independent of the queue backend, so entries can be listed
+// in order, inspected by ID, purged and replayed.
+type DeadLetterQueue struct {
+	client DeadLetterClient
+	// MaxLen caps each dead-letter stream (approximately); zero means
+	// DefaultDeadLetterMaxLen.
+	MaxLen int64
+	now    func() time.Time
+}
+
+func NewDeadLetter(client DeadLetterClient) (*DeadLetterQueue, error) {
+	if client == nil {
+		return nil, ErrNilRedisClient
+	}
+	return &DeadLetterQueue{client: client, now: time.Now}, nil
+}
+
+// DeadLetterKey returns the stream holding the dead letters of queueName.
+func DeadLetterKey(queueName string) string {
+	return queueName + deadLetterKeySuffix
+}
+
+// AddContext dead-letters payload taken from queueName.
+func (d *DeadLetterQueue) AddContext(ctx context.Context, queueName string, payload []byte, reason string, deliveries int64) error {
+	if err := validateQueueName(queueName); err != nil {
+		return err
+	}
+	maxLen := d.MaxLen
+	if maxLen <= 0 {
+		maxLen = DefaultDeadLetterMaxLen
+	}
+	return d.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: DeadLetterKey(queueName),
+		MaxLen: maxLen,
+		Approx: true,
+		Values: []any{
+			deadLetterFieldPayload, string(payload),
+			deadLetterFieldReason, reason,
+			deadLetterFieldFailedAt, d.now().UTC().Format(time.RFC3339Nano),
+			deadLetterFieldDeliveries, strconv.FormatInt(deliveries, 10),
+		},
+	}).Err()
+}
+
+// ListContext returns up to limit dead letters of queueName, oldest first,
+// starting after the entry ID after (empty for the beginning).
+func (d *DeadLetterQueue) ListContext(ctx context.Context, queueName, after string, limit int64) ([]DeadLetter, error) {
+	if err := validateQueueName(queueName); err != nil {
+		return nil, err
+	}
+	start := "-"
+	if after != "" {
+		if !streamIDPattern.MatchString(after) {
+			return nil, ErrInvalidDeadLetterID
+		}
+		start = "(" + after
+	}
+	entries, err := d.client.XRangeN(ctx, DeadLetterKey(queueName), start, "+", limit).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DeadLetter, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, toDeadLetter(queueName, e))
+	}
+	return out, nil
+}
+
+// GetContext returns the dead letter id of queueName or ErrDeadLetterNotFound.
+func (d *DeadLetterQueue) GetContext(ctx context.Context, queueName, id string) (*DeadLetter, error) {
+	if err := validateQueueName(queueName); err != nil {
+		return nil, err
+	}
+	if !streamIDPattern.MatchString(id) {
+		return nil, ErrInvalidDeadLetterID
+	}
+	entries, err := d.client.XRangeN(ctx, DeadLetterKey(queueName), id, id, 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrDeadLetterNotFound
+	}
+	dl := toDeadLetter(queueName, entries[0])
+	return &dl, nil
+}
+
+// DeleteContext removes the dead letter id of queueName.
+func (d *DeadLetterQueue) DeleteContext(ctx context.Context, queueName, id string) error {
+	if err := validateQueueName(queueName); err != nil {
+		return err
+	}
+	if !streamIDPattern.MatchString(id) {
+		return ErrInvalidDeadLetterID
+	}
+	n, err := d.client.XDel(ctx, DeadLetterKey(queueName), id).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// PurgeContext removes every dead letter of queueName and returns how many
+// there were.
+func (d *DeadLetterQueue) PurgeContext(ctx context.Context, queueName string) (int64, error) {
+	n, err := d.LengthContext(ctx, queueName)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.client.Del(ctx, DeadLetterKey(queueName)).Err(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ReplayContext enqueues the payload of dead letter id on its queue through q
+// and removes the dead letter. Payloads that are not valid JSON cannot be
+// replayed.
+func (d *DeadLetterQueue) ReplayContext(ctx context.Context, q Enqueuer, queueName, id string) error {
+	dl, err := d.GetContext(ctx, queueName, id)
+	if err != nil {
+		return err
+	}
+	if !json.Valid([]byte(dl.Payload)) {
+		return ErrInvalidReplay
+	}
+	if err := q.EnqueueContext(ctx, queueName, json.RawMessage(dl.Payload)); err != nil {
+		return err
+	}
+	return d.DeleteContext(ctx, queueName, id)
+}
+
+// LengthContext returns how many dead letters queueName has.
+func (d *DeadLetterQueue) LengthContext(ctx context.Context, queueName string) (int64, error) {
+	if err := validateQueueName(queueName); err != nil {
+		return 0, err
+	}
+	return d.client.XLen(ctx, DeadLetterKey(queueName)).Result()
+}
+
+func toDeadLetter(queueName string, e goredis.XMessage) DeadLetter {
+	dl := DeadLetter{ID: e.ID, Queue: queueName}
+	dl.Payload, _ = e.Values[deadLetterFieldPayload].(string)
+	dl.Reason, _ = e.Values[deadLetterFieldReason].(string)
+	if raw, ok := e.Values[deadLetterFieldFailedAt].(string); ok {
+		dl.FailedAt, _ = time.Parse(time.RFC3339Nano, raw)
+	}
+	if raw, ok := e.Values[deadLetterFieldDeliveries].(string); ok {
+		dl.Deliveries, _ = strconv.ParseInt(raw, 10, 64)
+	}
+	return dl
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	redismock "github.com/go-redis/redismock/v9"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newTestDeadLetterQueue(t *testing.T) (*DeadLetterQueue, redismock.ClientMock) {
+	t.Helper()
+	client, mock := redismock.NewClientMock()
+	d, err := NewDeadLetter(client)
+	if err != nil {
+		t.Fatalf("new dead-letter queue: %v", err)
+	}
+	d.now = func() time.Time { return testNow }
+	return d, mock
+}
+
+type recordingEnqueuer struct {
+	queueName string
+	payload   any
+	err       error
+}
+
+func (r *recordingEnqueuer) EnqueueContext(_ context.Context, queueName string, payload any) error {
+	r.queueName, r.payload = queueName, payload
+	return r.err
+}
+
+func TestDeadLetterAdd_AppendsToCappedStream(t *testing.T) {
+	d, mock := newTestDeadLetterQueue(t)
+	mock.ExpectXAdd(&goredis.XAddArgs{
+		Stream: "email:send:dead",
+		MaxLen: DefaultDeadLetterMaxLen,
+		Approx: true,
+		Values: []any{"payload", "not-json", "reason", "invalid_payload", "failed_at", "2026-01-02T03:04:05Z", "deliveries", "2"},
+	}).SetVal("1-0")
+
+	if err := d.AddContext(context.Background(), "email:send", []byte("not-json"), "invalid_payload", 2); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestDeadLetterList_PagesAfterCursor(t *testing.T) {
+	d, mock := newTestDeadLetterQueue(t)
+	mock.ExpectXRangeN("email:send:dead", "(1-0", "+", 2).SetVal([]goredis.XMessage{{
+		ID:     "2-0",
+		Values: map[string]any{"payload": `{"record_id":"r"}`, "reason": "soft_bounce_retry_exhausted", "failed_at": "2026-01-02T03:04:05Z", "deliveries": "1"},
+	}})
+
+	items, err := d.ListContext(context.Background(), "email:send", "1-0", 2)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	want := DeadLetter{ID: "2-0", Queue: "email:send", Payload: `{"record_id":"r"}`, Reason: "soft_bounce_retry_exhausted", FailedAt: testNow, Deliveries: 1}
+	if len(items) != 1 || items[0] != want {
+		t.Fatalf("items=%+v want=%+v", items, want)
+	}
+	if _, err := d.ListContext(context.Background(), "email:send", "bogus", 2); !errors.Is(err, ErrInvalidDeadLetterID) {
+		t.Fatalf("err=%v want=%v", err, ErrInvalidDeadLetterID)
+	}
+}
+
+func TestDeadLetterGetAndDelete_ReportNotFound(t *testing.T) {
+	d, mock := newTestDeadLetterQueue(t)
+	mock.ExpectXRangeN("email:send:dead", "9-0", "9-0", 1).SetVal(nil)
+	mock.ExpectXDel("email:send:dead", "9-0").SetVal(0)
+
+	if _, err := d.GetContext(context.Background(), "email:send", "9-0"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("get err=%v want=%v", err, ErrDeadLetterNotFound)
+	}
+	if err := d.DeleteContext(context.Background(), "email:send", "9-0"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("delete err=%v want=%v", err, ErrDeadLetterNotFound)
+	}
+	if _, err := d.GetContext(context.Background(), "email:send", "9"); !errors.Is(err, ErrInvalidDeadLetterID) {
+		t.Fatalf("get err=%v want=%v", err, ErrInvalidDeadLetterID)
+	}
+}
+
+func TestDeadLetterPurge_ReturnsRemovedCount(t *testing.T) {
+	d, mock := newTestDeadLetterQueue(t)
+	mock.ExpectXLen("email:send:dead").SetVal(3)
+	mock.ExpectDel("email:send:dead").SetVal(1)
+
+	n, err := d.PurgeContext(context.Background(), "email:send")
+	if err != nil || n != 3 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+}
+
+func TestDeadLetterReplay_EnqueuesPayloadAndDeletes(t *testing.T) {
+	d, mock := newTestDeadLetterQueue(t)
+	mock.ExpectXRangeN("email:send:dead", "1-0", "1-0", 1).SetVal([]goredis.XMessage{{ID: "1-0", Values: map[string]any{"payload": `{"record_id":"r"}`}}})
+	mock.ExpectXDel("email:send:dead", "1-0").SetVal(1)
+
+	q := &recordingEnqueuer{}
+	if err := d.ReplayContext(context.Background(), q, "email:send", "1-0"); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	raw, ok := q.payload.(json.RawMessage)
+	if q.queueName != "email:send" || !ok || string(raw) != `{"record_id":"r"}` {
+		t.Fatalf("enqueued %q %v", q.queueName, q.payload)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestDeadLetterReplay_KeepsEntryWhenEnqueueFailsOrPayloadInvalid(t *testing.T) {
+	d, mock := newTestDeadLetterQueue(t)
+	mock.ExpectXRangeN("email:send:dead", "1-0", "1-0", 1).SetVal([]goredis.XMessage{{ID: "1-0", Values: map[string]any{"payload": `{"record_id":"r"}`}}})
+	mock.ExpectXRangeN("email:send:dead", "2-0", "2-0", 1).SetVal([]goredis.XMessage{{ID: "2-0", Values: map[string]any{"payload": "not-json"}}})
+
+	if err := d.ReplayContext(context.Background(), &recordingEnqueuer{err: errors.New("redis down")}, "email:send", "1-0"); err == nil {
+		t.Fatal("expected enqueue error")
+	}
+	if err := d.ReplayContext(context.Background(), &recordingEnqueuer{}, "email:send", "2-0"); !errors.Is(err, ErrInvalidReplay) {
+		t.Fatalf("err=%v want=%v", err, ErrInvalidReplay)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	delayedKeySuffix       = ":delayed"
+	delayedMemberSeparator = "|"
+
+	defaultPromoteInterval  = time.Second
+	defaultPromoteBatchSize = 100
+)
+
+// promoteScript moves up to ARGV[2] members of the delayed set KEYS[1] whose
+// score is at most ARGV[1] to the work queue KEYS[2], as a list entry or a
+// stream entry depending on ARGV[3]. Members are "<nonce>|<payload>" so equal
+// payloads scheduled twice stay distinct.
+var promoteScript = goredis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, member in ipairs(due) do
+  local sep = string.find(member, '|', 1, true)
+  local payload = string.sub(member, sep + 1)
+  if ARGV[3] == 'streams' then
+    redis.call('XADD', KEYS[2], '*', 'payload', payload)
+  else
+    redis.call('RPUSH', KEYS[2], payload)
+  end
+  redis.call('ZREM', KEYS[1], member)
+end
+return #due
+`)
+
+// DelayedClient captures the subset of Redis commands used by DelayedQueue.
+type DelayedClient interface {
+	goredis.Scripter
+	ZAdd(ctx context.Context, key string, members ...goredis.Z) *goredis.IntCmd
+	ZCard(ctx context.Context, key string) *goredis.IntCmd
+}
+
+// DelayedQueue holds jobs that become due later in a Redis sorted set per
+// queue, scored by due time in Unix milliseconds. Unlike timers in process
+// memory, scheduled jobs survive restarts; a Promoter moves them to the work
+// queue once due.
+type DelayedQueue struct {
+	client  DelayedClient
+	backend string
+	now     func() time.Time
+}
+
+// NewDelayed returns a DelayedQueue that promotes into work queues of
+// backend ("list" or "streams"), which must match the Queue consumers use.
+func NewDelayed(client DelayedClient, backend string) (*DelayedQueue, error) {
+	if client == nil {
+		return nil, ErrNilRedisClient
+	}
+	backend = strings.ToLower(strings.TrimSpace(backend))
+	switch backend {
+	case "":
+		backend = BackendList
+	case BackendList, BackendStreams:
+	default:
+		return nil, ErrUnknownBackend
+	}
+	return &DelayedQueue{client: client, backend: backend, now: time.Now}, nil
+}
+
+// DelayedKey returns the sorted set holding the scheduled jobs of queueName.
+// The braces make Redis Cluster hash the key by queueName alone, so it lands
+// in the slot of the work queue and the promote script can touch both. A
+// queue name that already has a hash tag keeps it.
+func DelayedKey(queueName string) string {
+	if strings.ContainsAny(queueName, "{}") {
+		return queueName + delayedKeySuffix
+	}
+	return "{" + queueName + "}" + delayedKeySuffix
+}
+
+// ScheduleContext stores payload to be enqueued on queueName after delay.
+func (d *DelayedQueue) ScheduleContext(ctx context.Context, queueName string, payload any, delay time.Duration) error {
+	if err := validateQueueName(queueName); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	dueAt := d.now().Add(delay).UnixMilli()
+	member := hex.EncodeToString(nonce) + delayedMemberSeparator + string(encoded)
+	return d.client.ZAdd(ctx, DelayedKey(queueName), goredis.Z{Score: float64(dueAt), Member: member}).Err()
+}
+
+// PromoteDueContext atomically moves up to limit due jobs of queueName to the
+// work queue and returns how many were moved.
+func (d *DelayedQueue) PromoteDueContext(ctx context.Context, queueName string, limit int) (int, error) {
+	if err := validateQueueName(queueName); err != nil {
+		return 0, err
+	}
+	if limit <= 0 {
+		limit = defaultPromoteBatchSize
+	}
+	now := strconv.FormatInt(d.now().UnixMilli(), 10)
+	n, err := promoteScript.Run(ctx, d.client, []string{DelayedKey(queueName), queueName}, now, limit, d.backend).Int()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ScheduledCountContext returns ZCARD of the delayed set of queueName.
+func (d *DelayedQueue) ScheduledCountContext(ctx context.Context, queueName string) (int64, error) {
+	if err := validateQueueName(queueName); err != nil {
+		return 0, err
+	}
+	return d.client.ZCard(ctx, DelayedKey(queueName)).Result()
+}
+
+// Promoter moves due jobs of QueueNames from their delayed sets to the work
+// queues every Interval. Any number of processes may run one; the Lua script
+// keeps promotions atomic.
+type Promoter struct {
+	Delayed    *DelayedQueue
+	QueueNames []string
+	Interval   time.Duration
+	BatchSize  int
+	// OnPromoted, if set, is called after jobs were moved, e.g. to count them.
+	OnPromoted func(queueName string, n int)
+}
+
+// Run promotes due jobs until ctx is cancelled.
+func (p *Promoter) Run(ctx context.Context) error {
+	if p.Delayed == nil {
+		return ErrNilRedisClient
+	}
+	interval := p.Interval
+	if interval <= 0 {
+		interval = defaultPromoteInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, name := range p.QueueNames {
+			if _, err := p.PromoteAll(ctx, name); err != nil && ctx.Err() == nil {
+				log.Printf("queue promoter: promote %q failed: %v", name, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// PromoteAll promotes batches of due jobs of queueName until none are left.
+func (p *Promoter) PromoteAll(ctx context.Context, queueName string) (int, error) {
+	batch := p.BatchSize
+	if batch <= 0 {
+		batch = defaultPromoteBatchSize
+	}
+	total := 0
+	for {
+		n, err := p.Delayed.PromoteDueContext(ctx, queueName, batch)
+		if n > 0 {
+			total += n
+			if p.OnPromoted != nil {
+				p.OnPromoted(queueName, n)
+			}
+		}
+		if err != nil || n < batch {
+			return total, err
+		}
+	}
+}
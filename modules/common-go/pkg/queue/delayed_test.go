@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	redismock "github.com/go-redis/redismock/v9"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var testNow = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestDelayedQueue(t *testing.T, client DelayedClient, backend string) *DelayedQueue {
+	t.Helper()
+	d, err := NewDelayed(client, backend)
+	if err != nil {
+		t.Fatalf("new delayed queue: %v", err)
+	}
+	d.now = func() time.Time { return testNow }
+	return d
+}
+
+func TestNewDelayed_ValidatesClientAndBackend(t *testing.T) {
+	if _, err := NewDelayed(nil, BackendList); !errors.Is(err, ErrNilRedisClient) {
+		t.Fatalf("err=%v want=%v", err, ErrNilRedisClient)
+	}
+	client, _ := redismock.NewClientMock()
+	if _, err := NewDelayed(client, "kafka"); !errors.Is(err, ErrUnknownBackend) {
+		t.Fatalf("err=%v want=%v", err, ErrUnknownBackend)
+	}
+	d, err := NewDelayed(client, "")
+	if err != nil || d.backend != BackendList {
+		t.Fatalf("default backend=%v err=%v", d, err)
+	}
+}
+
+func TestSchedule_AddsToSortedSetScoredByDueTime(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	d := newTestDelayedQueue(t, client, BackendList)
+
+	wantScore := float64(testNow.Add(time.Hour).UnixMilli())
+	mock.CustomMatch(func(_, actual []interface{}) error {
+		if len(actual) != 4 || actual[0] != "zadd" || actual[1] != "{email:send}:delayed" || actual[2] != wantScore {
+			return fmt.Errorf("unexpected command %v", actual)
+		}
+		member, _ := actual[3].(string)
+		nonce, payload, ok := strings.Cut(member, "|")
+		if !ok || len(nonce) != 16 || payload != `{"record_id":"job-1","to":"user@example.com","priority":1}` {
+			return fmt.Errorf("unexpected member %q", member)
+		}
+		return nil
+	}).ExpectZAdd("{email:send}:delayed", goredis.Z{}).SetVal(1)
+
+	if err := d.ScheduleContext(context.Background(), "email:send", emailJob{RecordID: "job-1", To: "user@example.com", Priority: 1}, time.Hour); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestPromoteDue_RunsScriptWithBackend(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	d := newTestDelayedQueue(t, client, BackendStreams)
+
+	now := fmt.Sprint(testNow.UnixMilli())
+	mock.ExpectEvalSha(promoteScript.Hash(), []string{"{email:send}:delayed", "email:send"}, now, 50, "streams").SetVal(int64(2))
+
+	n, err := d.PromoteDueContext(context.Background(), "email:send", 50)
+	if err != nil || n != 2 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestDelayedKey_SharesClusterSlotWithQueue(t *testing.T) {
+	for queueName, want := range map[string]string{
+		"email:send":       "{email:send}:delayed",
+		"{tenant:1}:email": "{tenant:1}:email:delayed",
+	} {
+		if got := DelayedKey(queueName); got != want {
+			t.Fatalf("DelayedKey(%q)=%q want %q", queueName, got, want)
+		}
+	}
+}
+
+func TestScheduledCount_UsesZCard(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	d := newTestDelayedQueue(t, client, BackendList)
+	mock.ExpectZCard("{email:send}:delayed").SetVal(3)
+
+	n, err := d.ScheduledCountContext(context.Background(), "email:send")
+	if err != nil || n != 3 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+}
+
+func TestPromoterPromoteAll_LoopsUntilBatchIsShort(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	d := newTestDelayedQueue(t, client, BackendList)
+	now := fmt.Sprint(testNow.UnixMilli())
+	keys := []string{"{email:send}:delayed", "email:send"}
+	mock.ExpectEvalSha(promoteScript.Hash(), keys, now, 2, "list").SetVal(int64(2))
+	mock.ExpectEvalSha(promoteScript.Hash(), keys, now, 2, "list").SetVal(int64(1))
+
+	promoted := map[string]int{}
+	p := &Promoter{Delayed: d, BatchSize: 2, OnPromoted: func(name string, n int) { promoted[name] += n }}
+	n, err := p.PromoteAll(context.Background(), "email:send")
+	if err != nil || n != 3 || promoted["email:send"] != 3 {
+		t.Fatalf("n=%d promoted=%v err=%v", n, promoted, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+// TestDelayedQueue_PromotesDueJobsInRedis runs the Lua script against a real
+// Redis for both backends.
+func TestDelayedQueue_PromotesDueJobsInRedis(t *testing.T) {
+	addr := strings.TrimSpace(os.Getenv("TEST_REDIS_ADDR"))
+	if addr == "" {
+		t.Skip("skip integration test: TEST_REDIS_ADDR is not set")
+	}
+	rdb := goredis.NewClient(&goredis.Options{Addr: addr})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	for _, backend := range []string{BackendList, BackendStreams} {
+		queueName := "test:delayed:" + backend
+		if err := rdb.Del(ctx, queueName, DelayedKey(queueName)).Err(); err != nil {
+			t.Fatalf("cleanup: %v", err)
+		}
+
+		d := newTestDelayedQueue(t, rdb, backend)
+		for _, delay := range []time.Duration{-time.Second, -time.Second, time.Hour} {
+			if err := d.ScheduleContext(ctx, queueName, emailJob{RecordID: "job-1"}, delay); err != nil {
+				t.Fatalf("%s schedule: %v", backend, err)
+			}
+		}
+
+		n, err := d.PromoteDueContext(ctx, queueName, 10)
+		if err != nil || n != 2 {
+			t.Fatalf("%s promote n=%d err=%v", backend, n, err)
+		}
+		if left, err := d.ScheduledCountContext(ctx, queueName); err != nil || left != 1 {
+			t.Fatalf("%s scheduled left=%d err=%v", backend, left, err)
+		}
+
+		q, err := Open(rdb, backend, StreamOptions{Consumer: "test"})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		msg, err := q.ReceiveContext(ctx, queueName, time.Second)
+		if err != nil || msg == nil || string(msg.Payload) != `{"record_id":"job-1","to":"","priority":0}` {
+			t.Fatalf("%s receive msg=%+v err=%v", backend, msg, err)
+		}
+		if err := rdb.Del(ctx, queueName, DelayedKey(queueName)).Err(); err != nil {
+			t.Fatalf("cleanup: %v", err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Job priorities, highest first. Each priority has its own queue so that
+// urgent jobs, such as one-time codes, never wait behind bulk mail.
+const (
+	PriorityTransactional = "transactional"
+	PriorityNotification  = "notification"
+	PriorityBulk          = "bulk"
+)
+
+// Priorities lists every priority from highest to lowest.
+var Priorities = []string{PriorityTransactional, PriorityNotification, PriorityBulk}
+
+var ErrUnknownPriority = errors.New("unknown_queue_priority")
+
+// PriorityQueueName returns the queue holding jobs of priority on base.
+// Transactional jobs (and an empty priority) use base itself, so producers and
+// consumers that predate priorities keep working; the others use
+// "<base>:<priority>".
+func PriorityQueueName(base, priority string) (string, error) {
+	if err := validateQueueName(base); err != nil {
+		return "", err
+	}
+	switch p := strings.ToLower(strings.TrimSpace(priority)); p {
+	case "", PriorityTransactional:
+		return base, nil
+	case PriorityNotification, PriorityBulk:
+		return base + ":" + p, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownPriority, priority)
+	}
+}
+
+// PriorityQueueNames returns the queue of every priority on base, highest
+// priority first.
+func PriorityQueueNames(base string) ([]string, error) {
+	names := make([]string, 0, len(Priorities))
+	for _, p := range Priorities {
+		name, err := PriorityQueueName(base, p)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPriorityQueueName(t *testing.T) {
+	cases := []struct {
+		priority string
+		want     string
+	}{
+		{"", "email:send"},
+		{PriorityTransactional, "email:send"},
+		{PriorityNotification, "email:send:notification"},
+		{" Bulk ", "email:send:bulk"},
+	}
+	for _, tc := range cases {
+		got, err := PriorityQueueName("email:send", tc.priority)
+		if err != nil {
+			t.Fatalf("priority %q: %v", tc.priority, err)
+		}
+		if got != tc.want {
+			t.Fatalf("priority %q: got=%q want=%q", tc.priority, got, tc.want)
+		}
+	}
+
+	if _, err := PriorityQueueName("email:send", "urgent"); !errors.Is(err, ErrUnknownPriority) {
+		t.Fatalf("err=%v want=%v", err, ErrUnknownPriority)
+	}
+	if _, err := PriorityQueueName(" ", PriorityBulk); !errors.Is(err, ErrEmptyQueueName) {
+		t.Fatalf("err=%v want=%v", err, ErrEmptyQueueName)
+	}
+}
+
+func TestPriorityQueueNames_HighestFirst(t *testing.T) {
+	got, err := PriorityQueueNames("email:send")
+	if err != nil {
+		t.Fatalf("names: %v", err)
+	}
+	want := []string{"email:send", "email:send:notification", "email:send:bulk"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+}
@@ -17,10 +17,36 @@ var (
 	ErrInvalidBLPopReply = errors.New("invalid_blpop_reply")
 )
 
+// Message is a payload received from a queue.
+type Message struct {
+	// ID identifies the message for AckContext. It is empty for list queues.
+	ID      string
+	Payload json.RawMessage
+	// Deliveries counts how often the message has been handed to a consumer,
+	// this delivery included. List queues always report 1.
+	Deliveries int64
+}
+
+// Queue is implemented by every queue backend. A received message must be
+// acknowledged once handled; backends that track deliveries hand
+// unacknowledged messages out again after their visibility timeout.
+type Queue interface {
+	EnqueueContext(ctx context.Context, queueName string, payload any) error
+	ReceiveContext(ctx context.Context, queueName string, timeout time.Duration) (*Message, error)
+	AckContext(ctx context.Context, queueName string, msg *Message) error
+	QueueLengthContext(ctx context.Context, queueName string) (int64, error)
+}
+
+var (
+	_ Queue = (*RedisQueue)(nil)
+	_ Queue = (*StreamQueue)(nil)
+)
+
 // RedisClient captures the subset of Redis commands used by the queue abstraction.
 type RedisClient interface {
 	RPush(ctx context.Context, key string, values ...interface{}) *goredis.IntCmd
 	BLPop(ctx context.Context, timeout time.Duration, keys ...string) *goredis.StringSliceCmd
+	LPop(ctx context.Context, key string) *goredis.StringCmd
 	LLen(ctx context.Context, key string) *goredis.IntCmd
 }
 
@@ -101,6 +127,40 @@ func (q *RedisQueue) DequeueIntoContext(ctx context.Context, queueName string, t
 	return true, nil
 }
 
+// ReceiveContext pops the next message like DequeueContext. It returns a nil
+// message when timeout expires; a timeout <= 0 polls without blocking (LPOP).
+// The message is removed from the list right away, so it is lost if the
+// consumer stops before handling it.
+func (q *RedisQueue) ReceiveContext(ctx context.Context, queueName string, timeout time.Duration) (*Message, error) {
+	if timeout <= 0 {
+		return q.pop(ctx, queueName)
+	}
+	payload, ok, err := q.DequeueContext(ctx, queueName, timeout)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &Message{Payload: payload, Deliveries: 1}, nil
+}
+
+func (q *RedisQueue) pop(ctx context.Context, queueName string) (*Message, error) {
+	if err := validateQueueName(queueName); err != nil {
+		return nil, err
+	}
+	res, err := q.client.LPop(ctx, queueName).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Payload: json.RawMessage(res), Deliveries: 1}, nil
+}
+
+// AckContext is a no-op: BLPOP already removed the message.
+func (q *RedisQueue) AckContext(ctx context.Context, queueName string, msg *Message) error {
+	return nil
+}
+
 // QueueLength returns LLEN(queueName).
 func (q *RedisQueue) QueueLength(queueName string) (int64, error) {
 	return q.QueueLengthContext(context.Background(), queueName)
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -117,6 +118,36 @@ func TestDequeue_TimeoutReturnsNoPayload(t *testing.T) {
 	}
 }
 
+func TestReceive_ZeroTimeoutPollsWithLPop(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	q, err := New(client)
+	if err != nil {
+		t.Fatalf("new queue: %v", err)
+	}
+
+	mock.ExpectLPop("email:send").SetVal(`{"record_id":"r1"}`)
+	mock.ExpectLPop("email:send").RedisNil()
+
+	msg, err := q.ReceiveContext(context.Background(), "email:send", 0)
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if msg == nil || string(msg.Payload) != `{"record_id":"r1"}` || msg.Deliveries != 1 {
+		t.Fatalf("msg=%+v", msg)
+	}
+
+	msg, err = q.ReceiveContext(context.Background(), "email:send", 0)
+	if err != nil {
+		t.Fatalf("receive empty: %v", err)
+	}
+	if msg != nil {
+		t.Fatalf("msg=%+v want=nil", msg)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
 func TestDequeue_InvalidBLPopReply(t *testing.T) {
 	client, mock := redismock.NewClientMock()
 	q, err := New(client)
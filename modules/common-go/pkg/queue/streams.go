@@ -0,0 +1,253 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// StreamPayloadField is the stream entry field holding the JSON payload.
+	StreamPayloadField = "payload"
+
+	defaultStreamGroup             = "workers"
+	defaultStreamVisibilityTimeout = 5 * time.Minute
+
+	errPrefixBusyGroup = "BUSYGROUP"
+	errPrefixNoGroup   = "NOGROUP"
+)
+
+var (
+	ErrEmptyConsumerName    = errors.New("empty_consumer_name")
+	ErrNilMessage           = errors.New("nil_message")
+	ErrInvalidStreamMessage = errors.New("invalid_stream_message")
+)
+
+// StreamClient captures the subset of Redis commands used by StreamQueue.
+type StreamClient interface {
+	XAdd(ctx context.Context, a *goredis.XAddArgs) *goredis.StringCmd
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *goredis.StatusCmd
+	XReadGroup(ctx context.Context, a *goredis.XReadGroupArgs) *goredis.XStreamSliceCmd
+	XAutoClaim(ctx context.Context, a *goredis.XAutoClaimArgs) *goredis.XAutoClaimCmd
+	XPendingExt(ctx context.Context, a *goredis.XPendingExtArgs) *goredis.XPendingExtCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *goredis.IntCmd
+	XDel(ctx context.Context, stream string, ids ...string) *goredis.IntCmd
+	XLen(ctx context.Context, stream string) *goredis.IntCmd
+}
+
+// StreamOptions configures a StreamQueue.
+type StreamOptions struct {
+	// Group is the consumer group shared by all workers. Defaults to "workers".
+	Group string
+	// Consumer names this worker within the group; it must be unique per
+	// process. Producers that never receive may leave it empty.
+	Consumer string
+	// VisibilityTimeout is how long a delivered message may stay
+	// unacknowledged before another consumer reclaims it. Defaults to five
+	// minutes.
+	VisibilityTimeout time.Duration
+}
+
+// StreamQueue provides JSON payload queue operations backed by Redis Streams
+// and a consumer group. Received messages stay in the group's pending entries
+// list until acknowledged, so a message whose consumer crashed is delivered
+// again once VisibilityTimeout has passed.
+type StreamQueue struct {
+	client StreamClient
+	opts   StreamOptions
+
+	mu     sync.Mutex
+	groups map[string]bool
+}
+
+func NewStream(client StreamClient, opts StreamOptions) (*StreamQueue, error) {
+	if client == nil {
+		return nil, ErrNilRedisClient
+	}
+	if strings.TrimSpace(opts.Group) == "" {
+		opts.Group = defaultStreamGroup
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = defaultStreamVisibilityTimeout
+	}
+	return &StreamQueue{client: client, opts: opts, groups: map[string]bool{}}, nil
+}
+
+// EnqueueContext appends a JSON-serialized payload to the queueName stream
+// using XADD.
+func (q *StreamQueue) EnqueueContext(ctx context.Context, queueName string, payload any) error {
+	if err := validateQueueName(queueName); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return q.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: queueName,
+		Values: []any{StreamPayloadField, string(encoded)},
+	}).Err()
+}
+
+// ReceiveContext returns the next message for this consumer. Messages left
+// unacknowledged by any consumer for longer than the visibility timeout are
+// reclaimed (XAUTOCLAIM) before new messages are read (XREADGROUP), which
+// blocks for up to timeout. It returns a nil message when timeout expires.
+func (q *StreamQueue) ReceiveContext(ctx context.Context, queueName string, timeout time.Duration) (*Message, error) {
+	if err := validateQueueName(queueName); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(q.opts.Consumer) == "" {
+		return nil, ErrEmptyConsumerName
+	}
+	if err := q.ensureGroup(ctx, queueName); err != nil {
+		return nil, err
+	}
+
+	msg, err := q.reclaim(ctx, queueName)
+	if err != nil || msg != nil {
+		return msg, err
+	}
+	return q.readNew(ctx, queueName, timeout)
+}
+
+func (q *StreamQueue) reclaim(ctx context.Context, queueName string) (*Message, error) {
+	claimed, _, err := q.client.XAutoClaim(ctx, &goredis.XAutoClaimArgs{
+		Stream:   queueName,
+		Group:    q.opts.Group,
+		Consumer: q.opts.Consumer,
+		MinIdle:  q.opts.VisibilityTimeout,
+		Start:    "0-0",
+		Count:    1,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil, nil
+		}
+		q.forgetGroupOnError(queueName, err)
+		return nil, err
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+
+	msg := streamMessage(claimed[0])
+	pending, err := q.client.XPendingExt(ctx, &goredis.XPendingExtArgs{
+		Stream: queueName,
+		Group:  q.opts.Group,
+		Start:  msg.ID,
+		End:    msg.ID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	// XAUTOCLAIM already counted this delivery; fall back to the minimum
+	// if the entry was acknowledged in between.
+	msg.Deliveries = 2
+	if len(pending) > 0 && pending[0].RetryCount > 0 {
+		msg.Deliveries = pending[0].RetryCount
+	}
+	return msg, nil
+}
+
+func (q *StreamQueue) readNew(ctx context.Context, queueName string, timeout time.Duration) (*Message, error) {
+	block := timeout
+	if block <= 0 {
+		// A zero BLOCK waits forever; a negative one omits BLOCK.
+		block = -1
+	}
+	streams, err := q.client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+		Group:    q.opts.Group,
+		Consumer: q.opts.Consumer,
+		Streams:  []string{queueName, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		q.forgetGroupOnError(queueName, err)
+		return nil, err
+	}
+	for _, stream := range streams {
+		if len(stream.Messages) == 0 {
+			continue
+		}
+		msg := streamMessage(stream.Messages[0])
+		msg.Deliveries = 1
+		return msg, nil
+	}
+	return nil, nil
+}
+
+// AckContext acknowledges msg (XACK) and deletes it from the stream (XDEL) so
+// the stream length reflects the backlog.
+func (q *StreamQueue) AckContext(ctx context.Context, queueName string, msg *Message) error {
+	if err := validateQueueName(queueName); err != nil {
+		return err
+	}
+	if msg == nil {
+		return ErrNilMessage
+	}
+	if msg.ID == "" {
+		return ErrInvalidStreamMessage
+	}
+	if err := q.client.XAck(ctx, queueName, q.opts.Group, msg.ID).Err(); err != nil {
+		return err
+	}
+	return q.client.XDel(ctx, queueName, msg.ID).Err()
+}
+
+// QueueLengthContext returns XLEN(queueName): messages not yet acknowledged,
+// including those currently being handled.
+func (q *StreamQueue) QueueLengthContext(ctx context.Context, queueName string) (int64, error) {
+	if err := validateQueueName(queueName); err != nil {
+		return 0, err
+	}
+	return q.client.XLen(ctx, queueName).Result()
+}
+
+// ensureGroup creates the consumer group (and the stream) the first time
+// queueName is received from. Entries added before the group existed are
+// delivered too.
+func (q *StreamQueue) ensureGroup(ctx context.Context, queueName string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.groups[queueName] {
+		return nil
+	}
+	err := q.client.XGroupCreateMkStream(ctx, queueName, q.opts.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), errPrefixBusyGroup) {
+		return err
+	}
+	q.groups[queueName] = true
+	return nil
+}
+
+// forgetGroupOnError makes the next receive recreate the group when the
+// stream was deleted underneath us.
+func (q *StreamQueue) forgetGroupOnError(queueName string, err error) {
+	if !strings.HasPrefix(err.Error(), errPrefixNoGroup) {
+		return
+	}
+	q.mu.Lock()
+	delete(q.groups, queueName)
+	q.mu.Unlock()
+}
+
+// streamMessage converts a stream entry. An entry without a payload field
+// yields an empty payload, which the consumer rejects and acknowledges
+// instead of leaving it to be reclaimed forever.
+func streamMessage(entry goredis.XMessage) *Message {
+	raw, _ := entry.Values[StreamPayloadField].(string)
+	return &Message{ID: entry.ID, Payload: json.RawMessage(raw)}
+}
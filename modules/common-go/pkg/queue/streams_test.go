@@ -0,0 +1,246 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	redismock "github.com/go-redis/redismock/v9"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newTestStreamQueue(t *testing.T) (*StreamQueue, redismock.ClientMock) {
+	t.Helper()
+	client, mock := redismock.NewClientMock()
+	q, err := NewStream(client, StreamOptions{Group: "email-worker", Consumer: "worker-1", VisibilityTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("new stream queue: %v", err)
+	}
+	return q, mock
+}
+
+func expectNoReclaim(mock redismock.ClientMock) {
+	mock.ExpectXAutoClaim(&goredis.XAutoClaimArgs{
+		Stream: "email:send", Group: "email-worker", Consumer: "worker-1",
+		MinIdle: time.Minute, Start: "0-0", Count: 1,
+	}).SetVal(nil, "0-0")
+}
+
+func TestNewStream_ValidatesClientAndDefaults(t *testing.T) {
+	if _, err := NewStream(nil, StreamOptions{}); !errors.Is(err, ErrNilRedisClient) {
+		t.Fatalf("err=%v want=%v", err, ErrNilRedisClient)
+	}
+	client, _ := redismock.NewClientMock()
+	q, err := NewStream(client, StreamOptions{})
+	if err != nil {
+		t.Fatalf("new stream queue: %v", err)
+	}
+	if q.opts.Group != defaultStreamGroup || q.opts.VisibilityTimeout != defaultStreamVisibilityTimeout {
+		t.Fatalf("opts=%+v", q.opts)
+	}
+}
+
+func TestStreamEnqueue_UsesXAddWithJSONPayload(t *testing.T) {
+	q, mock := newTestStreamQueue(t)
+	mock.ExpectXAdd(&goredis.XAddArgs{
+		Stream: "email:send",
+		Values: []any{"payload", `{"record_id":"job-1","to":"user@example.com","priority":10}`},
+	}).SetVal("1-0")
+
+	if err := q.EnqueueContext(context.Background(), "email:send", emailJob{RecordID: "job-1", To: "user@example.com", Priority: 10}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestStreamReceive_ReadsNewMessageAfterCreatingGroup(t *testing.T) {
+	q, mock := newTestStreamQueue(t)
+	mock.ExpectXGroupCreateMkStream("email:send", "email-worker", "0").SetErr(errors.New("BUSYGROUP Consumer Group name already exists"))
+	expectNoReclaim(mock)
+	mock.ExpectXReadGroup(&goredis.XReadGroupArgs{
+		Group: "email-worker", Consumer: "worker-1",
+		Streams: []string{"email:send", ">"}, Count: 1, Block: 5 * time.Second,
+	}).SetVal([]goredis.XStream{{
+		Stream:   "email:send",
+		Messages: []goredis.XMessage{{ID: "1-0", Values: map[string]any{"payload": `{"record_id":"job-1"}`}}},
+	}})
+	// The group is created once per queue.
+	expectNoReclaim(mock)
+	mock.ExpectXReadGroup(&goredis.XReadGroupArgs{
+		Group: "email-worker", Consumer: "worker-1",
+		Streams: []string{"email:send", ">"}, Count: 1, Block: 5 * time.Second,
+	}).RedisNil()
+
+	msg, err := q.ReceiveContext(context.Background(), "email:send", 5*time.Second)
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if msg == nil || msg.ID != "1-0" || string(msg.Payload) != `{"record_id":"job-1"}` || msg.Deliveries != 1 {
+		t.Fatalf("msg=%+v", msg)
+	}
+
+	msg, err = q.ReceiveContext(context.Background(), "email:send", 5*time.Second)
+	if err != nil || msg != nil {
+		t.Fatalf("timeout receive: msg=%+v err=%v", msg, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestStreamReceive_ReclaimsIdleMessageWithDeliveryCount(t *testing.T) {
+	q, mock := newTestStreamQueue(t)
+	mock.ExpectXGroupCreateMkStream("email:send", "email-worker", "0").SetVal("OK")
+	mock.ExpectXAutoClaim(&goredis.XAutoClaimArgs{
+		Stream: "email:send", Group: "email-worker", Consumer: "worker-1",
+		MinIdle: time.Minute, Start: "0-0", Count: 1,
+	}).SetVal([]goredis.XMessage{{ID: "7-0", Values: map[string]any{"payload": `{"record_id":"job-7"}`}}}, "0-0")
+	mock.ExpectXPendingExt(&goredis.XPendingExtArgs{
+		Stream: "email:send", Group: "email-worker", Start: "7-0", End: "7-0", Count: 1,
+	}).SetVal([]goredis.XPendingExt{{ID: "7-0", Consumer: "worker-1", Idle: 0, RetryCount: 3}})
+
+	msg, err := q.ReceiveContext(context.Background(), "email:send", 5*time.Second)
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if msg == nil || msg.ID != "7-0" || string(msg.Payload) != `{"record_id":"job-7"}` || msg.Deliveries != 3 {
+		t.Fatalf("msg=%+v", msg)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestStreamReceive_MissingPayloadFieldYieldsEmptyPayload(t *testing.T) {
+	q, mock := newTestStreamQueue(t)
+	mock.ExpectXGroupCreateMkStream("email:send", "email-worker", "0").SetVal("OK")
+	expectNoReclaim(mock)
+	mock.ExpectXReadGroup(&goredis.XReadGroupArgs{
+		Group: "email-worker", Consumer: "worker-1",
+		Streams: []string{"email:send", ">"}, Count: 1, Block: time.Second,
+	}).SetVal([]goredis.XStream{{
+		Stream:   "email:send",
+		Messages: []goredis.XMessage{{ID: "2-0", Values: map[string]any{"other": "x"}}},
+	}})
+
+	msg, err := q.ReceiveContext(context.Background(), "email:send", time.Second)
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if msg == nil || msg.ID != "2-0" || len(msg.Payload) != 0 {
+		t.Fatalf("msg=%+v", msg)
+	}
+}
+
+func TestStreamReceive_RecreatesGroupAfterNoGroup(t *testing.T) {
+	q, mock := newTestStreamQueue(t)
+	mock.ExpectXGroupCreateMkStream("email:send", "email-worker", "0").SetVal("OK")
+	mock.ExpectXAutoClaim(&goredis.XAutoClaimArgs{
+		Stream: "email:send", Group: "email-worker", Consumer: "worker-1",
+		MinIdle: time.Minute, Start: "0-0", Count: 1,
+	}).SetErr(errors.New("NOGROUP No such key 'email:send' or consumer group 'email-worker'"))
+	mock.ExpectXGroupCreateMkStream("email:send", "email-worker", "0").SetVal("OK")
+	expectNoReclaim(mock)
+	mock.ExpectXReadGroup(&goredis.XReadGroupArgs{
+		Group: "email-worker", Consumer: "worker-1",
+		Streams: []string{"email:send", ">"}, Count: 1, Block: time.Second,
+	}).RedisNil()
+
+	if _, err := q.ReceiveContext(context.Background(), "email:send", time.Second); err == nil {
+		t.Fatal("expected NOGROUP error")
+	}
+	if _, err := q.ReceiveContext(context.Background(), "email:send", time.Second); err != nil {
+		t.Fatalf("receive after NOGROUP: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestStreamReceive_RequiresConsumerName(t *testing.T) {
+	client, _ := redismock.NewClientMock()
+	q, err := NewStream(client, StreamOptions{})
+	if err != nil {
+		t.Fatalf("new stream queue: %v", err)
+	}
+	if _, err := q.ReceiveContext(context.Background(), "email:send", time.Second); !errors.Is(err, ErrEmptyConsumerName) {
+		t.Fatalf("err=%v want=%v", err, ErrEmptyConsumerName)
+	}
+}
+
+func TestStreamAck_AcknowledgesAndDeletes(t *testing.T) {
+	q, mock := newTestStreamQueue(t)
+	mock.ExpectXAck("email:send", "email-worker", "1-0").SetVal(1)
+	mock.ExpectXDel("email:send", "1-0").SetVal(1)
+
+	if err := q.AckContext(context.Background(), "email:send", &Message{ID: "1-0"}); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := q.AckContext(context.Background(), "email:send", nil); !errors.Is(err, ErrNilMessage) {
+		t.Fatalf("nil ack err=%v", err)
+	}
+	if err := q.AckContext(context.Background(), "email:send", &Message{}); !errors.Is(err, ErrInvalidStreamMessage) {
+		t.Fatalf("empty id ack err=%v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestStreamQueueLength_UsesXLen(t *testing.T) {
+	q, mock := newTestStreamQueue(t)
+	mock.ExpectXLen("email:send").SetVal(4)
+
+	n, err := q.QueueLengthContext(context.Background(), "email:send")
+	if err != nil || n != 4 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+}
+
+func TestRedisQueueReceive_WrapsBLPop(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	q, err := New(client)
+	if err != nil {
+		t.Fatalf("new queue: %v", err)
+	}
+	mock.ExpectBLPop(time.Second, "email:send").SetVal([]string{"email:send", `{"record_id":"job-1"}`})
+	mock.ExpectBLPop(time.Second, "email:send").RedisNil()
+
+	msg, err := q.ReceiveContext(context.Background(), "email:send", time.Second)
+	if err != nil || msg == nil || string(msg.Payload) != `{"record_id":"job-1"}` || msg.Deliveries != 1 {
+		t.Fatalf("msg=%+v err=%v", msg, err)
+	}
+	if err := q.AckContext(context.Background(), "email:send", msg); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	msg, err = q.ReceiveContext(context.Background(), "email:send", time.Second)
+	if err != nil || msg != nil {
+		t.Fatalf("timeout: msg=%+v err=%v", msg, err)
+	}
+}
+
+func TestOpen_SelectsBackend(t *testing.T) {
+	client, _ := redismock.NewClientMock()
+	for backend, want := range map[string]string{"": "list", "list": "list", "Streams": "streams"} {
+		q, err := Open(client, backend, StreamOptions{Consumer: "worker-1"})
+		if err != nil {
+			t.Fatalf("open %q: %v", backend, err)
+		}
+		switch q.(type) {
+		case *RedisQueue:
+			if want != "list" {
+				t.Fatalf("backend %q opened list queue", backend)
+			}
+		case *StreamQueue:
+			if want != "streams" {
+				t.Fatalf("backend %q opened stream queue", backend)
+			}
+		}
+	}
+	if _, err := Open(client, "kafka", StreamOptions{}); !errors.Is(err, ErrUnknownBackend) {
+		t.Fatalf("err=%v want=%v", err, ErrUnknownBackend)
+	}
+}
@@ -0,0 +1,206 @@
+// Package webhooks publishes tenant lifecycle events to the webhook endpoints
+// tenants register in admin-api. Publishing records a delivery per subscribed
+// endpoint and queues it; email-worker performs the signed POST and retries.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Event types tenants can subscribe to.
+const (
+	EventUserRegistered     = "user.registered"
+	EventUserEmailVerified  = "user.email_verified"
+	EventMemberAdded        = "member.added"
+	EventMemberRemoved      = "member.removed"
+	EventMemberRolesUpdated = "member.roles_updated"
+)
+
+// AllEvents subscribes an endpoint to every event type, including ones added
+// later.
+const AllEvents = "*"
+
+var eventTypes = []string{EventUserRegistered, EventUserEmailVerified, EventMemberAdded, EventMemberRemoved, EventMemberRolesUpdated}
+
+// Request headers of a delivery. SignatureHeader is sha256=<hex HMAC-SHA256
+// of the body under the endpoint secret>, the scheme email-worker verifies on
+// its inbound ESP webhook.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// DefaultQueueName is the Redis list deliveries are queued on.
+const DefaultQueueName = "webhook:deliver"
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// EventTypes returns the subscribable event types.
+func EventTypes() []string {
+	out := make([]string, len(eventTypes))
+	copy(out, eventTypes)
+	return out
+}
+
+// ValidEventType reports whether name is an event type or AllEvents.
+func ValidEventType(name string) bool {
+	if name == AllEvents {
+		return true
+	}
+	for _, t := range eventTypes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON body POSTed to endpoints. ID identifies the event and
+// is shared by its deliveries to different endpoints and by redeliveries.
+type Payload struct {
+	ID        string         `json:"id"`
+	Type      string         `json:"type"`
+	TenantID  string         `json:"tenant_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Data      map[string]any `json:"data"`
+}
+
+// Job is the queue message for one delivery attempt.
+type Job struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+// Sign returns the hex HMAC-SHA256 of body under secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random endpoint signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Queue is the subset of queue.Queue the publisher needs.
+type Queue interface {
+	EnqueueContext(ctx context.Context, queueName string, payload any) error
+}
+
+// Publisher records and queues deliveries.
+type Publisher struct {
+	DB        *pgxpool.Pool
+	Queue     Queue
+	QueueName string
+}
+
+// Publish delivers an event to the tenant's enabled endpoints subscribed to
+// eventType. It returns the number of deliveries created. A delivery whose
+// enqueue fails stays pending and can be redelivered from admin-api.
+func (p *Publisher) Publish(ctx context.Context, tenantID, eventType string, data map[string]any) (int, error) {
+	if !ValidEventType(eventType) || eventType == AllEvents {
+		return 0, fmt.Errorf("unknown webhook event type %q", eventType)
+	}
+	if data == nil {
+		data = map[string]any{}
+	}
+	eventID := uuid.NewString()
+	body, err := json.Marshal(Payload{
+		ID:        eventID,
+		Type:      eventType,
+		TenantID:  tenantID,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := p.DB.Query(ctx, `
+select id
+from webhook_endpoints
+where tenant_id = $1 and enabled and ($2 = any(events) or '*' = any(events))
+order by created_at`, tenantID, eventType)
+	if err != nil {
+		return 0, err
+	}
+	endpointIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(endpointIDs))
+	for _, endpointID := range endpointIDs {
+		id := uuid.NewString()
+		_, err = p.DB.Exec(ctx, `
+insert into webhook_deliveries(id, endpoint_id, tenant_id, event_id, event_type, payload, next_attempt_at)
+values ($1, $2, $3, $4, $5, $6::jsonb, now())`, id, endpointID, tenantID, eventID, eventType, string(body))
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+
+	var errs []error
+	for _, id := range ids {
+		if err := p.Enqueue(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("enqueue delivery %s: %w", id, err))
+		}
+	}
+	return len(ids), errors.Join(errs...)
+}
+
+// PublishForUser publishes a user-level event to every tenant the user is a
+// member of, as a separate event per tenant.
+func (p *Publisher) PublishForUser(ctx context.Context, userID, eventType string, data map[string]any) (int, error) {
+	rows, err := p.DB.Query(ctx, `select tenant_id from tenant_users where user_id = $1 order by tenant_id`, userID)
+	if err != nil {
+		return 0, err
+	}
+	tenantIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var errs []error
+	for _, tid := range tenantIDs {
+		n, err := p.Publish(ctx, tid, eventType, data)
+		total += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// Enqueue queues a pending delivery for its next attempt.
+func (p *Publisher) Enqueue(ctx context.Context, deliveryID string) error {
+	name := p.QueueName
+	if name == "" {
+		name = DefaultQueueName
+	}
+	return p.Queue.EnqueueContext(ctx, name, Job{DeliveryID: deliveryID})
+}
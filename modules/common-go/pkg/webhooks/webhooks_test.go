@@ -0,0 +1,38 @@
+package webhooks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSignMatchesHMACSHA256(t *testing.T) {
+	// echo -n '{"id":"evt"}' | openssl dgst -sha256 -hmac whsec_test
+	const want = "353875293cf5d0f8e29abbefb340263caaf144f81480c861ac2ee3532a16d760"
+	if got := Sign("whsec_test", []byte(`{"id":"evt"}`)); got != want {
+		t.Fatalf("Sign=%q want %q", got, want)
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret: %v", err)
+	}
+	b, _ := NewSecret()
+	if !strings.HasPrefix(a, "whsec_") || len(a) != len("whsec_")+64 || a == b {
+		t.Fatalf("secrets %q, %q", a, b)
+	}
+}
+
+func TestValidEventType(t *testing.T) {
+	for _, name := range append(EventTypes(), AllEvents) {
+		if !ValidEventType(name) {
+			t.Fatalf("ValidEventType(%q)=false", name)
+		}
+	}
+	for _, name := range []string{"", "member", "member.*", "user.deleted"} {
+		if ValidEventType(name) {
+			t.Fatalf("ValidEventType(%q)=true", name)
+		}
+	}
+}
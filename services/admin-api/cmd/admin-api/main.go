@@ -7,9 +7,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/cache/redis"
 	"anvilkit-auth-template/modules/common-go/pkg/cfg"
 	"anvilkit-auth-template/modules/common-go/pkg/db/pgsql"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/ginmid"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
 	"anvilkit-auth-template/services/admin-api/internal/handler"
 	"anvilkit-auth-template/services/admin-api/internal/rbac"
 	"anvilkit-auth-template/services/admin-api/internal/store"
@@ -27,14 +31,63 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	rdb, err := redis.New(ctx, cfg.GetString("REDIS_ADDR", "localhost:6379"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	watcher, err := rbac.NewRedisWatcher(ctx, rdb, cfg.GetString("RBAC_WATCHER_CHANNEL", rbac.DefaultWatcherChannel))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer watcher.Close()
+	if err = rbac.WatchPolicy(e, watcher); err != nil {
+		log.Fatal(err)
+	}
+
+	// Producers only enqueue, so the stream options can stay empty.
+	q, err := queue.Open(rdb, cfg.GetString("QUEUE_BACKEND", queue.BackendList), queue.StreamOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	deadLetters, err := queue.NewDeadLetter(rdb)
+	if err != nil {
+		log.Fatal(err)
+	}
+	webhookQueueName := cfg.GetString("TENANT_WEBHOOK_QUEUE_NAME", webhooks.DefaultQueueName)
+	// Email jobs have a queue per priority, each with its own dead letters.
+	emailQueueNames, err := queue.PriorityQueueNames(cfg.GetString("EMAIL_QUEUE_NAME", "email:send"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	st := &store.Store{DB: db}
-	h := &handler.Handler{Store: st, Enforcer: e}
+	auditLog := &audit.Log{DB: db}
+	seedPlatformAdmins(ctx, st, auditLog, cfg.GetList("PLATFORM_ADMIN_USER_IDS"))
+
+	h := &handler.Handler{
+		Store:    st,
+		Enforcer: e,
+		Policies: rbac.NewPolicySets(db, e.GetModel()),
+		Watcher:  watcher,
+		Redis:    rdb,
+		Audit:    auditLog,
+		Webhooks: &webhooks.Publisher{DB: db, Queue: q, QueueName: webhookQueueName},
+
+		DeadLetters:      deadLetters,
+		DeadLetterQueues: append(emailQueueNames, webhookQueueName),
+		Queue:            q,
+	}
 	secret := cfg.GetString("JWT_SECRET", "dev-secret-change-me")
 	issuer := cfg.GetString("JWT_ISSUER", "anvilkit-auth")
 	audience := cfg.GetString("JWT_AUDIENCE", "anvilkit-clients")
 
 	r := gin.New()
+	// Tenant IP allowlists match the client IP; only trust X-Forwarded-For
+	// from the configured proxies.
+	if err = r.SetTrustedProxies(cfg.GetList("TRUSTED_PROXIES")); err != nil {
+		log.Fatal(err)
+	}
 	r.Use(gin.Recovery())
 	r.Use(ginmid.RequestID())
 	r.Use(ginmid.Logger())
@@ -44,15 +97,102 @@ func main() {
 	r.NoRoute(handler.NotFound)
 	r.GET("/healthz", ginmid.Wrap(h.Healthz))
 
-	admin := r.Group("/api/v1/admin", ginmid.AuthN(secret, issuer, audience), handler.AdminRBAC(st, e))
+	// RBAC_DEBUG attaches policy explanations to forbidden errors; it is
+	// ignored in production.
+	explainDenials := cfg.GetBool("RBAC_DEBUG", false) && cfg.GetString("APP_ENV", "development") != "production"
+
+	admin := r.Group("/api/v1/admin", ginmid.AuthN(secret, issuer, audience), ginmid.RequireAuthzVersion(st.AuthzVersion), ginmid.RequireActiveImpersonation(st.ImpersonationActive), handler.RejectSuspendedUsers(st), handler.AdminRBACWithExplain(st, e, explainDenials))
 	admin.GET("/tenants/:tenantId/me/roles", ginmid.Wrap(h.MeRoles))
 	admin.POST("/tenants/:tenantId/users/:userId/roles/:role", ginmid.Wrap(h.AssignRole))
+	admin.DELETE("/tenants/:tenantId/users/:userId/roles/:role", ginmid.Wrap(h.RevokeRole))
 	admin.GET("/tenants/:tenantId/members", ginmid.Wrap(h.ListMembers))
 	admin.POST("/tenants/:tenantId/members", ginmid.Wrap(h.AddMember))
 	admin.PATCH("/tenants/:tenantId/members/:uid", ginmid.Wrap(h.UpdateMemberRole))
 	admin.DELETE("/tenants/:tenantId/members/:uid", ginmid.Wrap(h.RemoveMember))
+	admin.GET("/tenants/:tenantId/permissions", ginmid.Wrap(h.ListPermissions))
+	admin.GET("/tenants/:tenantId/roles", ginmid.Wrap(h.ListRoles))
+	admin.POST("/tenants/:tenantId/roles", ginmid.Wrap(h.CreateRole))
+	admin.PUT("/tenants/:tenantId/roles/:role", ginmid.Wrap(h.UpdateRole))
+	admin.DELETE("/tenants/:tenantId/roles/:role", ginmid.Wrap(h.DeleteRole))
+	admin.POST("/tenants/:tenantId/rbac/check", ginmid.Wrap(h.CheckRBAC))
+	admin.GET("/tenants/:tenantId/access-rules", ginmid.Wrap(h.GetAccessRules))
+	admin.PUT("/tenants/:tenantId/access-rules", ginmid.DenyImpersonation(), ginmid.Wrap(h.PutAccessRules))
+	admin.GET("/tenants/:tenantId/groups", ginmid.Wrap(h.ListGroups))
+	admin.POST("/tenants/:tenantId/groups", ginmid.Wrap(h.CreateGroup))
+	admin.GET("/tenants/:tenantId/groups/:groupId", ginmid.Wrap(h.GetGroup))
+	admin.PATCH("/tenants/:tenantId/groups/:groupId", ginmid.Wrap(h.UpdateGroup))
+	admin.DELETE("/tenants/:tenantId/groups/:groupId", ginmid.Wrap(h.DeleteGroup))
+	admin.PUT("/tenants/:tenantId/groups/:groupId/members", ginmid.Wrap(h.SetGroupMembers))
+	admin.POST("/tenants/:tenantId/groups/:groupId/members/:userId", ginmid.Wrap(h.AddGroupMember))
+	admin.DELETE("/tenants/:tenantId/groups/:groupId/members/:userId", ginmid.Wrap(h.RemoveGroupMember))
+	admin.GET("/tenants/:tenantId/groups/:groupId/grants", ginmid.Wrap(h.GetGroupGrants))
+	admin.PUT("/tenants/:tenantId/groups/:groupId/grants", ginmid.Wrap(h.PutGroupGrants))
+	admin.GET("/tenants/:tenantId/audit-events", ginmid.Wrap(h.ListAuditEvents))
+	admin.GET("/tenants/:tenantId/webhooks", ginmid.Wrap(h.ListWebhooks))
+	admin.POST("/tenants/:tenantId/webhooks", ginmid.Wrap(h.CreateWebhook))
+	admin.GET("/tenants/:tenantId/webhooks/:webhookId", ginmid.Wrap(h.GetWebhook))
+	admin.PATCH("/tenants/:tenantId/webhooks/:webhookId", ginmid.Wrap(h.UpdateWebhook))
+	admin.DELETE("/tenants/:tenantId/webhooks/:webhookId", ginmid.Wrap(h.DeleteWebhook))
+	admin.POST("/tenants/:tenantId/webhooks/:webhookId/rotate-secret", ginmid.Wrap(h.RotateWebhookSecret))
+	admin.GET("/tenants/:tenantId/webhooks/:webhookId/deliveries", ginmid.Wrap(h.ListWebhookDeliveries))
+	admin.GET("/tenants/:tenantId/webhooks/:webhookId/deliveries/:deliveryId", ginmid.Wrap(h.GetWebhookDelivery))
+	admin.POST("/tenants/:tenantId/webhooks/:webhookId/deliveries/:deliveryId/redeliver", ginmid.Wrap(h.RedeliverWebhook))
+
+	org := r.Group("/api/v1/admin/org/:orgId", ginmid.AuthN(secret, issuer, audience), ginmid.RequireAuthzVersion(st.AuthzVersion), ginmid.RequireActiveImpersonation(st.ImpersonationActive), handler.RejectSuspendedUsers(st), handler.OrgRBACWithExplain(st, e, explainDenials))
+	org.GET("", ginmid.Wrap(h.GetOrganization))
+	org.GET("/tenants", ginmid.Wrap(h.ListOrgTenants))
+	org.POST("/tenants", ginmid.Wrap(h.AddOrgTenant))
+	org.DELETE("/tenants/:tenantId", ginmid.Wrap(h.RemoveOrgTenant))
+	org.GET("/members", ginmid.Wrap(h.ListOrgMembers))
+	org.PUT("/members/:uid", ginmid.Wrap(h.SetOrgMember))
+	org.DELETE("/members/:uid", ginmid.Wrap(h.RemoveOrgMember))
+
+	platform := r.Group("/api/v1/admin/platform", ginmid.AuthN(secret, issuer, audience), ginmid.DenyImpersonation(), handler.RejectSuspendedUsers(st), ginmid.RequirePlatformAdmin(st.IsPlatformAdmin))
+	platform.GET("/admins", ginmid.Wrap(h.ListPlatformAdmins))
+	platform.PUT("/admins/:userId", ginmid.Wrap(h.GrantPlatformAdmin))
+	platform.DELETE("/admins/:userId", ginmid.Wrap(h.RevokePlatformAdmin))
+	platform.GET("/rbac/policy", ginmid.Wrap(h.ExportPolicy))
+	platform.PUT("/rbac/policy", ginmid.Wrap(h.ApplyPolicy))
+	platform.POST("/rbac/policy/diff", ginmid.Wrap(h.DiffPolicy))
+	platform.GET("/rbac/policy/versions", ginmid.Wrap(h.ListPolicyVersions))
+	platform.GET("/rbac/policy/versions/:version", ginmid.Wrap(h.GetPolicyVersion))
+	platform.POST("/rbac/policy/versions/:version/rollback", ginmid.Wrap(h.RollbackPolicy))
+	platform.POST("/orgs", ginmid.Wrap(h.CreateOrganization))
+	platform.GET("/tenants", ginmid.Wrap(h.SearchTenants))
+	platform.GET("/tenants/:tenantId", ginmid.Wrap(h.GetPlatformTenant))
+	platform.GET("/users", ginmid.Wrap(h.SearchUsers))
+	platform.GET("/users/:userId", ginmid.Wrap(h.GetPlatformUser))
+	platform.POST("/users/:userId/suspend", ginmid.Wrap(h.SuspendUser))
+	platform.POST("/users/:userId/reactivate", ginmid.Wrap(h.ReactivateUser))
+	platform.POST("/users/:userId/logout", ginmid.Wrap(h.ForceLogoutUser))
+	platform.POST("/users/:userId/unlock", ginmid.Wrap(h.UnlockUser))
+	platform.GET("/users/:userId/emails", ginmid.Wrap(h.GetUserEmailDeliveries))
+	platform.GET("/audit-events", ginmid.Wrap(h.ListPlatformAuditEvents))
+	platform.GET("/audit-events/verify", ginmid.Wrap(h.VerifyAuditLog))
+	platform.GET("/queues/:queue/dead-letters", ginmid.Wrap(h.ListDeadLetters))
+	platform.DELETE("/queues/:queue/dead-letters", ginmid.Wrap(h.PurgeDeadLetters))
+	platform.GET("/queues/:queue/dead-letters/:id", ginmid.Wrap(h.GetDeadLetter))
+	platform.DELETE("/queues/:queue/dead-letters/:id", ginmid.Wrap(h.DeleteDeadLetter))
+	platform.POST("/queues/:queue/dead-letters/:id/replay", ginmid.Wrap(h.ReplayDeadLetter))
 
 	if err := r.Run(":8081"); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// seedPlatformAdmins grants the platform admin role to the users listed in
+// PLATFORM_ADMIN_USER_IDS while nobody holds it, so a new deployment has
+// someone to grant it to others. Once there is a platform admin the list is
+// ignored; grants and revocations go through the platform admin endpoints.
+func seedPlatformAdmins(ctx context.Context, st *store.Store, rec audit.Recorder, userIDs []string) {
+	seeded, err := st.SeedPlatformAdmins(ctx, userIDs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, uid := range seeded {
+		e := audit.Event{Action: audit.ActionPlatformAdminGrant, TargetType: "user", TargetID: uid, Metadata: map[string]any{"source": "PLATFORM_ADMIN_USER_IDS"}}
+		if err := rec.Record(ctx, e); err != nil {
+			log.Printf("admin-api audit: record action=%q failed: %v", e.Action, err)
+		}
+	}
+}
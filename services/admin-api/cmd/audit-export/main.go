@@ -0,0 +1,181 @@
+// Command audit-export ships the audit log to a SIEM. "stream" tails
+// audit_events into a file, signed webhook or syslog sink and resumes from its
+// checkpoint after a restart; "export" writes a date range as CSV or JSON
+// lines.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/services/admin-api/internal/auditexport"
+)
+
+const usage = `usage: audit-export <command> [flags]
+
+commands:
+  stream    tail the audit log into a sink (-sink file|webhook|syslog, -name)
+  export    write a date range (-since, -until, -format csv|jsonl, -file)
+`
+
+type config struct {
+	DBDSN        string
+	TenantID     string
+	Name         string
+	BatchSize    int
+	PollInterval time.Duration
+	Sink         auditexport.SinkConfig
+	Since        string
+	Until        string
+	Format       string
+	File         string
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+	cfg := loadConfig(cmd, os.Args[2:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cmd, cfg); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "audit-export: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func loadConfig(cmd string, args []string) config {
+	cfg := config{}
+	fs := flag.NewFlagSet("audit-export "+cmd, flag.ExitOnError)
+	fs.StringVar(&cfg.DBDSN, "db-dsn", strings.TrimSpace(os.Getenv("DB_DSN")), "PostgreSQL DSN for the auth database")
+	fs.StringVar(&cfg.TenantID, "tenant", "", "Only export events of this tenant")
+	fs.StringVar(&cfg.Name, "name", envOr("AUDIT_EXPORT_NAME", "default"), "Exporter name the stream checkpoint is stored under")
+	fs.IntVar(&cfg.BatchSize, "batch-size", 500, "Records per batch")
+	fs.DurationVar(&cfg.PollInterval, "poll-interval", 5*time.Second, "Wait between polls once the stream has caught up")
+	fs.StringVar(&cfg.Sink.Kind, "sink", envOr("AUDIT_EXPORT_SINK", "file"), "Stream sink: file, webhook or syslog")
+	fs.StringVar(&cfg.Sink.File, "sink-file", strings.TrimSpace(os.Getenv("AUDIT_EXPORT_FILE")), "JSON lines file the file sink appends to")
+	fs.StringVar(&cfg.Sink.WebhookURL, "webhook-url", strings.TrimSpace(os.Getenv("AUDIT_EXPORT_WEBHOOK_URL")), "URL the webhook sink posts batches to")
+	fs.StringVar(&cfg.Sink.SyslogNetwork, "syslog-network", envOr("AUDIT_EXPORT_SYSLOG_NETWORK", "udp"), "Syslog transport: udp, tcp or tls")
+	fs.StringVar(&cfg.Sink.SyslogAddr, "syslog-addr", strings.TrimSpace(os.Getenv("AUDIT_EXPORT_SYSLOG_ADDR")), "Syslog collector host:port")
+	fs.StringVar(&cfg.Since, "since", "", "Export events at or after this time (RFC 3339 or YYYY-MM-DD)")
+	fs.StringVar(&cfg.Until, "until", "", "Export events before this time (RFC 3339 or YYYY-MM-DD)")
+	fs.StringVar(&cfg.Format, "format", auditexport.FormatJSONL, "Export format: csv or jsonl")
+	fs.StringVar(&cfg.File, "file", "-", "Export file to write; - for stdout")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	// The signing secret is only read from the environment to keep it out of
+	// process listings.
+	cfg.Sink.WebhookSecret = strings.TrimSpace(os.Getenv("AUDIT_EXPORT_WEBHOOK_SECRET"))
+	cfg.DBDSN = strings.TrimSpace(cfg.DBDSN)
+	cfg.Sink.Kind = strings.ToLower(strings.TrimSpace(cfg.Sink.Kind))
+	cfg.Format = strings.ToLower(strings.TrimSpace(cfg.Format))
+	return cfg
+}
+
+func envOr(key, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func run(ctx context.Context, cmd string, cfg config) error {
+	switch cmd {
+	case "stream", "export":
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	if cfg.DBDSN == "" {
+		return errors.New("DB_DSN is not set")
+	}
+	db, err := pgxpool.New(ctx, cfg.DBDSN)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+	log := &audit.Log{DB: db}
+	filter := audit.Filter{TenantID: strings.TrimSpace(cfg.TenantID)}
+
+	if cmd == "stream" {
+		sink, err := auditexport.NewSink(cfg.Sink)
+		if err != nil {
+			return err
+		}
+		defer sink.Close()
+		s := &auditexport.Streamer{
+			Name:         cfg.Name,
+			Source:       log,
+			Sink:         sink,
+			Checkpoints:  auditexport.DBCheckpoints{DB: db},
+			Filter:       filter,
+			BatchSize:    cfg.BatchSize,
+			PollInterval: cfg.PollInterval,
+		}
+		return s.Run(ctx)
+	}
+
+	if filter.Since, err = parseTime(cfg.Since); err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	if filter.Until, err = parseTime(cfg.Until); err != nil {
+		return fmt.Errorf("-until: %w", err)
+	}
+	var n int
+	err = writeFile(cfg.File, func(w io.Writer) error {
+		var exportErr error
+		n, exportErr = auditexport.Export(ctx, log, filter, cfg.Format, w)
+		return exportErr
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d audit events\n", n)
+	return nil
+}
+
+// parseTime accepts RFC 3339 timestamps and UTC dates.
+func parseTime(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
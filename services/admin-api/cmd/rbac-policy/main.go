@@ -0,0 +1,234 @@
+// Command rbac-policy exports, diffs and applies the global Casbin policy as
+// versioned policy sets, so policy changes can be reviewed, rolled back and
+// promoted between environments.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	casbinmodel "github.com/casbin/casbin/v2/model"
+	"github.com/jackc/pgx/v5/pgxpool"
+	goredis "github.com/redis/go-redis/v9"
+
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
+)
+
+const usage = `usage: rbac-policy <command> [flags]
+
+commands:
+  export    write the current global policy (-format csv|json, -file)
+  diff      compare a policy file with the current policy (-file)
+  apply     replace the global policy with a policy file (-file, -model, -expect-version, -comment)
+  history   list applied policy versions (-limit)
+  rollback  re-apply an earlier version (-version, -model, -comment)
+`
+
+type config struct {
+	DBDSN         string
+	RedisAddr     string
+	Channel       string
+	Format        string
+	File          string
+	Model         string
+	ExpectVersion int64
+	Version       int64
+	Limit         int
+	Comment       string
+	Actor         string
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+	cfg := loadConfig(cmd, os.Args[2:])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := run(ctx, cmd, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "rbac-policy: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func loadConfig(cmd string, args []string) config {
+	cfg := config{}
+	fs := flag.NewFlagSet("rbac-policy "+cmd, flag.ExitOnError)
+	fs.StringVar(&cfg.DBDSN, "db-dsn", strings.TrimSpace(os.Getenv("DB_DSN")), "PostgreSQL DSN for the auth database")
+	fs.StringVar(&cfg.RedisAddr, "redis-addr", strings.TrimSpace(os.Getenv("REDIS_ADDR")), "Redis address used to tell admin-api replicas to reload policy")
+	fs.StringVar(&cfg.Channel, "channel", strings.TrimSpace(os.Getenv("RBAC_WATCHER_CHANNEL")), "Redis channel admin-api replicas watch for policy changes")
+	fs.StringVar(&cfg.Format, "format", rbac.PolicyFormatCSV, "Policy format: csv or json")
+	fs.StringVar(&cfg.File, "file", "-", "Policy file to read or write; - for stdin/stdout")
+	fs.StringVar(&cfg.Model, "model", "", "Casbin model file applied rules are checked against; defaults to the built-in model.conf")
+	fs.Int64Var(&cfg.ExpectVersion, "expect-version", -1, "Fail apply unless the current policy version matches")
+	fs.Int64Var(&cfg.Version, "version", 0, "Policy version to roll back to")
+	fs.IntVar(&cfg.Limit, "limit", 20, "Number of versions to list")
+	fs.StringVar(&cfg.Comment, "comment", "", "Comment recorded with the new version")
+	fs.StringVar(&cfg.Actor, "actor", strings.TrimSpace(os.Getenv("USER")), "Actor recorded with the new version")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	cfg.DBDSN = strings.TrimSpace(cfg.DBDSN)
+	cfg.Format = strings.ToLower(strings.TrimSpace(cfg.Format))
+	cfg.File = strings.TrimSpace(cfg.File)
+	cfg.Model = strings.TrimSpace(cfg.Model)
+	return cfg
+}
+
+func run(ctx context.Context, cmd string, cfg config) error {
+	switch cmd {
+	case "export", "diff", "apply", "history", "rollback":
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	if cfg.DBDSN == "" {
+		return errors.New("DB_DSN is not set")
+	}
+	db, err := pgxpool.New(ctx, cfg.DBDSN)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+	m, err := loadModel(cfg.Model)
+	if err != nil {
+		return fmt.Errorf("load casbin model: %w", err)
+	}
+	sets := rbac.NewPolicySets(db, m)
+
+	switch cmd {
+	case "export":
+		set, err := sets.Current(ctx)
+		if err != nil {
+			return err
+		}
+		return writeFile(cfg.File, func(w io.Writer) error { return rbac.WritePolicy(w, set, cfg.Format) })
+	case "diff":
+		rules, err := readFile(cfg.File, cfg.Format)
+		if err != nil {
+			return err
+		}
+		set, err := sets.Current(ctx)
+		if err != nil {
+			return err
+		}
+		printDiff(fmt.Sprintf("policy version %d", set.Version), rbac.DiffPolicy(set.Rules, rules))
+		return nil
+	case "apply":
+		rules, err := readFile(cfg.File, cfg.Format)
+		if err != nil {
+			return err
+		}
+		opts := rbac.ApplyOptions{Comment: cfg.Comment, Actor: cfg.Actor}
+		if cfg.ExpectVersion >= 0 {
+			opts.ExpectedVersion = &cfg.ExpectVersion
+		}
+		version, diff, err := sets.Apply(ctx, rules, opts)
+		if err != nil {
+			return err
+		}
+		printDiff("the previous policy", diff)
+		fmt.Printf("applied policy version %d (%d rules, sha256 %s)\n", version.Version, version.RuleCount, version.Checksum)
+		return notifyReplicas(ctx, cfg)
+	case "history":
+		versions, err := sets.History(ctx, cfg.Limit)
+		if err != nil {
+			return err
+		}
+		if cfg.Format == rbac.PolicyFormatJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(versions)
+		}
+		for _, v := range versions {
+			fmt.Printf("%d\t%s\t%d rules\t%s\t%s\t%s\n", v.Version, v.CreatedAt.UTC().Format(time.RFC3339), v.RuleCount, v.Checksum[:12], v.CreatedBy, v.Comment)
+		}
+		return nil
+	case "rollback":
+		if cfg.Version <= 0 {
+			return errors.New("-version is required")
+		}
+		version, diff, err := sets.Rollback(ctx, cfg.Version, rbac.ApplyOptions{Comment: cfg.Comment, Actor: cfg.Actor})
+		if err != nil {
+			return err
+		}
+		printDiff("the previous policy", diff)
+		fmt.Printf("rolled back to version %d as policy version %d\n", cfg.Version, version.Version)
+		return notifyReplicas(ctx, cfg)
+	}
+	return nil
+}
+
+func loadModel(path string) (casbinmodel.Model, error) {
+	if path == "" {
+		return casbinmodel.NewModelFromString(rbac.ModelText)
+	}
+	return casbinmodel.NewModelFromFile(path)
+}
+
+func readFile(path, format string) ([]rbac.Rule, error) {
+	if path == "-" {
+		return rbac.ParsePolicy(os.Stdin, format)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return rbac.ParsePolicy(f, format)
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printDiff(base string, diff rbac.PolicyDiff) {
+	if diff.Empty() {
+		fmt.Printf("no changes against %s\n", base)
+		return
+	}
+	fmt.Printf("changes against %s:\n", base)
+	for _, r := range diff.Removed {
+		fmt.Printf("- %s\n", r)
+	}
+	for _, r := range diff.Added {
+		fmt.Printf("+ %s\n", r)
+	}
+}
+
+// notifyReplicas publishes a reload so running admin-api replicas pick up the
+// new policy; without Redis they only see it after a restart.
+func notifyReplicas(ctx context.Context, cfg config) error {
+	if cfg.RedisAddr == "" {
+		fmt.Fprintln(os.Stderr, "rbac-policy: REDIS_ADDR is not set; restart admin-api to load the new policy")
+		return nil
+	}
+	rdb := goredis.NewClient(&goredis.Options{Addr: cfg.RedisAddr})
+	defer rdb.Close()
+	return rbac.PublishReload(ctx, rdb, cfg.Channel)
+}
@@ -0,0 +1,273 @@
+// Package auditexport ships audit_events to a SIEM: Streamer tails the log
+// and writes JSON-line batches to a Sink, checkpointing after each batch, and
+// WriteCSV/WriteJSONL serve one-off exports.
+package auditexport
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+)
+
+// SignatureHeader carries the webhook body's HMAC-SHA256 as sha256=<hex>, in
+// the same format email-worker accepts from its ESP.
+const SignatureHeader = "X-Audit-Signature"
+
+// Sink receives batches of records in seq order. Write either delivers the
+// whole batch or returns an error, after which the batch is retried.
+type Sink interface {
+	Write(ctx context.Context, batch []audit.Record) error
+	Close() error
+}
+
+// MarshalLines encodes records as JSON lines.
+func MarshalLines(batch []audit.Record) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range batch {
+		if err := enc.Encode(r); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// FileSink appends JSON lines to a file and syncs it after each batch.
+type FileSink struct {
+	f *os.File
+}
+
+// NewFileSink opens path for appending, creating it if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, batch []audit.Record) error {
+	b, err := MarshalLines(batch)
+	if err != nil {
+		return err
+	}
+	if _, err = s.f.Write(b); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *FileSink) Close() error { return s.f.Close() }
+
+// WebhookSink POSTs each batch as application/x-ndjson, signed with
+// SignatureHeader. Any non-2xx response fails the batch.
+type WebhookSink struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Write(ctx context.Context, batch []audit.Record) error {
+	body, err := MarshalLines(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set(SignatureHeader, "sha256="+Sign(s.Secret, body))
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Close() error { return nil }
+
+// Sign returns the hex HMAC-SHA256 of body under secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Syslog facility and severity of exported records: authpriv.info.
+const (
+	syslogFacilityAuthpriv = 10
+	syslogSeverityInfo     = 6
+)
+
+// SyslogSink sends one RFC 5424 message per record, with the record's JSON as
+// MSG. Network is "udp", "tcp" or "tls"; stream transports use octet-counting
+// framing (RFC 6587). A failed connection is redialled on the next batch.
+type SyslogSink struct {
+	Network   string
+	Addr      string
+	AppName   string
+	Hostname  string
+	TLSConfig *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (s *SyslogSink) Write(ctx context.Context, batch []audit.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	} else {
+		_ = s.conn.SetWriteDeadline(time.Time{})
+	}
+	for _, r := range batch {
+		msg, err := s.format(r)
+		if err != nil {
+			return err
+		}
+		if s.Network != "udp" {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+		if _, err = s.conn.Write(msg); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	switch s.Network {
+	case "udp", "tcp":
+		return d.DialContext(ctx, s.Network, s.Addr)
+	case "tls":
+		td := &tls.Dialer{NetDialer: d, Config: s.TLSConfig}
+		return td.DialContext(ctx, "tcp", s.Addr)
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", s.Network)
+	}
+}
+
+// format renders r as an RFC 5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID - MSG
+func (s *SyslogSink) format(r audit.Record) ([]byte, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ",
+		syslogFacilityAuthpriv*8+syslogSeverityInfo,
+		r.OccurredAt.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		syslogField(s.Hostname, 255),
+		syslogField(s.AppName, 48),
+		os.Getpid(),
+		syslogField(r.Action, 32))
+	return append([]byte(header), body...), nil
+}
+
+// syslogField returns v as an RFC 5424 header field: printable ASCII without
+// spaces, at most max characters, or "-" when empty.
+func syslogField(v string, max int) string {
+	v = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, v)
+	if len(v) > max {
+		v = v[:max]
+	}
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// ErrUnknownSink is returned by NewSink for an unsupported kind.
+var ErrUnknownSink = errors.New("unknown sink")
+
+// SinkConfig selects and configures a sink.
+type SinkConfig struct {
+	// Kind is "file", "webhook" or "syslog".
+	Kind          string
+	File          string
+	WebhookURL    string
+	WebhookSecret string
+	SyslogNetwork string
+	SyslogAddr    string
+}
+
+// NewSink builds the sink cfg describes.
+func NewSink(cfg SinkConfig) (Sink, error) {
+	switch cfg.Kind {
+	case "file":
+		if cfg.File == "" {
+			return nil, errors.New("file sink needs a file path")
+		}
+		return NewFileSink(cfg.File)
+	case "webhook":
+		if cfg.WebhookURL == "" || cfg.WebhookSecret == "" {
+			return nil, errors.New("webhook sink needs a URL and a signing secret")
+		}
+		return &WebhookSink{URL: cfg.WebhookURL, Secret: cfg.WebhookSecret, Client: &http.Client{Timeout: 30 * time.Second}}, nil
+	case "syslog":
+		if cfg.SyslogAddr == "" {
+			return nil, errors.New("syslog sink needs an address")
+		}
+		hostname, _ := os.Hostname()
+		network := cfg.SyslogNetwork
+		if network == "" {
+			network = "udp"
+		}
+		return &SyslogSink{Network: network, Addr: cfg.SyslogAddr, AppName: "anvilkit-audit", Hostname: hostname}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownSink, cfg.Kind)
+	}
+}
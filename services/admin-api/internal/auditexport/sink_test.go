@@ -0,0 +1,157 @@
+package auditexport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+)
+
+func testRecords(n int) []audit.Record {
+	records := make([]audit.Record, 0, n)
+	for i := 1; i <= n; i++ {
+		records = append(records, audit.Record{
+			Seq:        int64(i),
+			ID:         "evt-" + strconv.Itoa(i),
+			OccurredAt: time.Date(2026, 10, 1, 12, 0, i, 0, time.UTC),
+			TenantID:   "t1",
+			ActorID:    "u1",
+			Action:     audit.ActionMemberRemove,
+			TargetType: "user",
+			TargetID:   "u" + strconv.Itoa(i+1),
+			UserAgent:  "agent, with \"quotes\"",
+			Metadata:   json.RawMessage(`{"reason": "offboarding"}`),
+			Hash:       "h" + strconv.Itoa(i),
+		})
+	}
+	return records
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for _, batch := range [][]audit.Record{testRecords(2), testRecords(3)[2:]} {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.Fatalf("NewFileSink: %v", err)
+		}
+		if err = sink.Write(context.Background(), batch); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		_ = sink.Close()
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("lines=%d want 3:\n%s", len(lines), b)
+	}
+	var r audit.Record
+	if err = json.Unmarshal([]byte(lines[2]), &r); err != nil || r.Seq != 3 || string(r.Metadata) != `{"reason":"offboarding"}` {
+		t.Fatalf("line 3=%s (%v)", lines[2], err)
+	}
+}
+
+func TestWebhookSinkSignsBatches(t *testing.T) {
+	var status = http.StatusNoContent
+	var gotBody []byte
+	var gotSig, gotType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSig = r.Header.Get(SignatureHeader)
+		gotType = r.Header.Get("Content-Type")
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{URL: srv.URL, Secret: "s3cret", Client: srv.Client()}
+	if err := sink.Write(context.Background(), testRecords(2)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if gotType != "application/x-ndjson" || strings.Count(string(gotBody), "\n") != 2 {
+		t.Fatalf("content-type=%q body=%s", gotType, gotBody)
+	}
+	if gotSig != "sha256="+Sign("s3cret", gotBody) {
+		t.Fatalf("signature=%q does not match the body", gotSig)
+	}
+
+	status = http.StatusBadGateway
+	if err := sink.Write(context.Background(), testRecords(1)); err == nil {
+		t.Fatal("Write succeeded on a 502 response")
+	}
+}
+
+func TestSyslogSinkFramesRFC5424(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	frames := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			length, err := br.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			buf := make([]byte, n)
+			if _, err = io.ReadFull(br, buf); err != nil {
+				return
+			}
+			frames <- string(buf)
+		}
+	}()
+
+	sink := &SyslogSink{Network: "tcp", Addr: ln.Addr().String(), AppName: "anvilkit-audit", Hostname: "host 1"}
+	defer sink.Close()
+	if err = sink.Write(context.Background(), testRecords(2)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		select {
+		case frame := <-frames:
+			prefix := "<86>1 2026-10-01T12:00:0" + strconv.Itoa(i) + ".000000Z host1 anvilkit-audit " + strconv.Itoa(os.Getpid()) + " member.remove - {"
+			if !strings.HasPrefix(frame, prefix) {
+				t.Fatalf("frame %d=%q want prefix %q", i, frame, prefix)
+			}
+			var r audit.Record
+			if err := json.Unmarshal([]byte(frame[len(prefix)-1:]), &r); err != nil || r.Seq != int64(i) {
+				t.Fatalf("frame %d body: %v", i, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("frame %d not received", i)
+		}
+	}
+}
+
+func TestNewSinkValidatesConfig(t *testing.T) {
+	for _, cfg := range []SinkConfig{
+		{Kind: "file"},
+		{Kind: "webhook", WebhookURL: "https://siem.example.com"},
+		{Kind: "syslog"},
+		{Kind: "kafka"},
+	} {
+		if _, err := NewSink(cfg); err == nil {
+			t.Fatalf("NewSink(%+v) succeeded", cfg)
+		}
+	}
+}
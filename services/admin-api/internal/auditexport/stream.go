@@ -0,0 +1,148 @@
+package auditexport
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+)
+
+const (
+	defaultBatchSize    = 500
+	defaultPollInterval = 5 * time.Second
+	maxRetryBackoff     = 5 * time.Minute
+)
+
+// Source pages through the audit log in seq order; *audit.Log implements it.
+type Source interface {
+	After(ctx context.Context, after int64, f audit.Filter) ([]audit.Record, error)
+}
+
+// Checkpoints stores the last exported seq per exporter name.
+type Checkpoints interface {
+	Load(ctx context.Context, name string) (int64, error)
+	Save(ctx context.Context, name string, seq int64) error
+}
+
+// DBCheckpoints keeps checkpoints in audit_export_checkpoints.
+type DBCheckpoints struct {
+	DB *pgxpool.Pool
+}
+
+func (c DBCheckpoints) Load(ctx context.Context, name string) (int64, error) {
+	var seq int64
+	err := c.DB.QueryRow(ctx, `select last_seq from audit_export_checkpoints where name = $1`, name).Scan(&seq)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return seq, err
+}
+
+func (c DBCheckpoints) Save(ctx context.Context, name string, seq int64) error {
+	_, err := c.DB.Exec(ctx, `
+insert into audit_export_checkpoints(name, last_seq, updated_at) values ($1, $2, now())
+on conflict (name) do update set last_seq = excluded.last_seq, updated_at = now()`, name, seq)
+	return err
+}
+
+// Streamer tails the audit log into a sink. Delivery is at least once: the
+// checkpoint moves only after the sink accepts a batch, so a crash between the
+// two resends that batch. Receivers can deduplicate on seq or id.
+type Streamer struct {
+	Name        string
+	Source      Source
+	Sink        Sink
+	Checkpoints Checkpoints
+	// Filter narrows the exported records, e.g. to one tenant.
+	Filter       audit.Filter
+	BatchSize    int
+	PollInterval time.Duration
+}
+
+// Run exports until ctx is done. A failed batch is retried with exponential
+// backoff; Run only returns ctx's error or a checkpoint load failure.
+func (s *Streamer) Run(ctx context.Context) error {
+	after, err := s.Checkpoints.Load(ctx, s.Name)
+	if err != nil {
+		return err
+	}
+	log.Printf("audit-export: %s resuming after seq %d", s.Name, after)
+
+	backoff := time.Duration(0)
+	for {
+		n, next, err := s.Step(ctx, after)
+		after = next
+		wait := s.pollInterval()
+		switch {
+		case err != nil && ctx.Err() == nil:
+			backoff = nextBackoff(backoff, wait)
+			log.Printf("audit-export: %s export after seq %d failed, retrying in %s: %v", s.Name, after, backoff, err)
+			wait = backoff
+		case n > 0:
+			backoff = 0
+			if n == s.batchSize() {
+				wait = 0
+			}
+		default:
+			backoff = 0
+		}
+		if wait == 0 && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Step exports one batch after seq after and saves the checkpoint. It returns
+// the number of records shipped and the new checkpoint.
+func (s *Streamer) Step(ctx context.Context, after int64) (int, int64, error) {
+	f := s.Filter
+	f.Limit = s.batchSize()
+	batch, err := s.Source.After(ctx, after, f)
+	if err != nil || len(batch) == 0 {
+		return 0, after, err
+	}
+	if err = s.Sink.Write(ctx, batch); err != nil {
+		return 0, after, err
+	}
+	last := batch[len(batch)-1].Seq
+	if err = s.Checkpoints.Save(ctx, s.Name, last); err != nil {
+		// The batch was delivered; keep going from it and persist the
+		// checkpoint with the next batch.
+		return len(batch), last, err
+	}
+	return len(batch), last, nil
+}
+
+func (s *Streamer) batchSize() int {
+	if s.BatchSize > 0 {
+		return s.BatchSize
+	}
+	return defaultBatchSize
+}
+
+func (s *Streamer) pollInterval() time.Duration {
+	if s.PollInterval > 0 {
+		return s.PollInterval
+	}
+	return defaultPollInterval
+}
+
+func nextBackoff(prev, base time.Duration) time.Duration {
+	if prev == 0 {
+		return base
+	}
+	if next := prev * 2; next < maxRetryBackoff {
+		return next
+	}
+	return maxRetryBackoff
+}
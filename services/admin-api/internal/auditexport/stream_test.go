@@ -0,0 +1,144 @@
+package auditexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/services/admin-api/internal/testutil"
+)
+
+type sliceSource []audit.Record
+
+func (s sliceSource) After(_ context.Context, after int64, f audit.Filter) ([]audit.Record, error) {
+	out := make([]audit.Record, 0)
+	for _, r := range s {
+		if r.Seq > after && (f.TenantID == "" || r.TenantID == f.TenantID) && len(out) < f.Limit {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+type memCheckpoints map[string]int64
+
+func (m memCheckpoints) Load(_ context.Context, name string) (int64, error) { return m[name], nil }
+
+func (m memCheckpoints) Save(_ context.Context, name string, seq int64) error {
+	m[name] = seq
+	return nil
+}
+
+type recordingSink struct {
+	fail bool
+	seqs []int64
+}
+
+func (s *recordingSink) Write(_ context.Context, batch []audit.Record) error {
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	for _, r := range batch {
+		s.seqs = append(s.seqs, r.Seq)
+	}
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestStreamerCheckpointsDeliveredBatches(t *testing.T) {
+	ctx := context.Background()
+	src := sliceSource(testRecords(5))
+	checkpoints := memCheckpoints{}
+	sink := &recordingSink{}
+	s := &Streamer{Name: "siem", Source: src, Sink: sink, Checkpoints: checkpoints, BatchSize: 2}
+
+	n, after, err := s.Step(ctx, 0)
+	if err != nil || n != 2 || after != 2 || checkpoints["siem"] != 2 {
+		t.Fatalf("Step=%d,%d,%v checkpoint=%d", n, after, err, checkpoints["siem"])
+	}
+
+	// A failed delivery leaves the checkpoint where it was.
+	sink.fail = true
+	if n, after, err = s.Step(ctx, after); err == nil || n != 0 || after != 2 || checkpoints["siem"] != 2 {
+		t.Fatalf("failed Step=%d,%d,%v checkpoint=%d", n, after, err, checkpoints["siem"])
+	}
+
+	// A restarted streamer resumes from the saved checkpoint.
+	sink.fail = false
+	restarted := &Streamer{Name: "siem", Source: src, Sink: sink, Checkpoints: checkpoints, BatchSize: 10}
+	resume, _ := checkpoints.Load(ctx, "siem")
+	if n, after, err = restarted.Step(ctx, resume); err != nil || n != 3 || after != 5 {
+		t.Fatalf("resumed Step=%d,%d,%v", n, after, err)
+	}
+	if got := sink.seqs; len(got) != 5 || got[0] != 1 || got[4] != 5 {
+		t.Fatalf("delivered seqs=%v", got)
+	}
+	if n, after, err = restarted.Step(ctx, after); err != nil || n != 0 || after != 5 {
+		t.Fatalf("caught-up Step=%d,%d,%v", n, after, err)
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	src := sliceSource(testRecords(3))
+
+	var buf bytes.Buffer
+	n, err := Export(context.Background(), src, audit.Filter{}, FormatCSV, &buf)
+	if err != nil || n != 3 {
+		t.Fatalf("Export csv=%d,%v", n, err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("rows=%v", rows)
+	}
+	if rows[1][0] != "1" || rows[1][2] != "2026-10-01T12:00:01Z" || rows[1][10] != `agent, with "quotes"` || rows[1][12] != `{"reason": "offboarding"}` {
+		t.Fatalf("row 1=%v", rows[1])
+	}
+
+	buf.Reset()
+	if n, err = Export(context.Background(), src, audit.Filter{}, FormatJSONL, &buf); err != nil || n != 3 {
+		t.Fatalf("Export jsonl=%d,%v", n, err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], `{"seq":1,`) {
+		t.Fatalf("jsonl=%s", buf.String())
+	}
+
+	if _, err = Export(context.Background(), src, audit.Filter{}, "xml", &buf); err == nil {
+		t.Fatal("Export accepted an unknown format")
+	}
+}
+
+func TestStreamerWithDatabase(t *testing.T) {
+	db := testutil.MustTestDB(t)
+	testutil.TruncateAuthTables(t, db)
+	ctx := context.Background()
+	log := &audit.Log{DB: db}
+	for _, tid := range []string{"t1", "t2", "t1"} {
+		if err := log.Record(ctx, audit.Event{TenantID: tid, Action: audit.ActionRoleCreate}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	checkpoints := DBCheckpoints{DB: db}
+	sink := &recordingSink{}
+	s := &Streamer{Name: "t1-siem", Source: log, Sink: sink, Checkpoints: checkpoints, Filter: audit.Filter{TenantID: "t1"}}
+	if _, _, err := s.Step(ctx, 0); err != nil {
+		t.Fatalf("Step: %v", err)
+	}
+	if len(sink.seqs) != 2 || sink.seqs[0] != 1 || sink.seqs[1] != 3 {
+		t.Fatalf("delivered seqs=%v want [1 3]", sink.seqs)
+	}
+	if seq, err := checkpoints.Load(ctx, "t1-siem"); err != nil || seq != 3 {
+		t.Fatalf("checkpoint=%d,%v want 3", seq, err)
+	}
+	if seq, err := checkpoints.Load(ctx, "other"); err != nil || seq != 0 {
+		t.Fatalf("missing checkpoint=%d,%v want 0", seq, err)
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/errcode"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
+)
+
+// GetAccessRules returns the tenant's IP allowlist and business hours.
+func (h *Handler) GetAccessRules(c *gin.Context) error {
+	rules, err := rbac.GetTenantAccessRules(h.Enforcer, c.Param("tenantId"))
+	if err != nil {
+		return err
+	}
+	resp.OK(c, rules)
+	return nil
+}
+
+// PutAccessRules replaces the tenant's access rules. Only owners of the
+// tenant or its organization may change them, and a change that would deny
+// the caller's own request is rejected.
+func (h *Handler) PutAccessRules(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	if !slices.ContainsFunc(rbacSubjects(c), rbac.IsOwnerSubject) {
+		return apperr.Forbidden(errors.New("owner_required")).WithData(map[string]any{"reason": "owner_required", "code": errcode.Forbidden})
+	}
+
+	var req rbac.TenantAccessRules
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	rules, err := rbac.NormalizeTenantAccessRules(req)
+	if err != nil {
+		return accessRulesError(err)
+	}
+	ok, err := rules.Allows(rbac.Attributes{IP: c.ClientIP(), Time: time.Now()})
+	if err != nil {
+		return accessRulesError(err)
+	}
+	if !ok {
+		return apperr.BadRequest(errors.New("would_lock_out")).WithData(map[string]any{"reason": "would_lock_out"})
+	}
+
+	if err = rbac.SetTenantAccessRules(h.Enforcer, tid, rules); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionAccessRulesUpdate, tid, "tenant", tid, map[string]any{"rules": rules})
+	resp.OK(c, rules)
+	return nil
+}
+
+func accessRulesError(err error) error {
+	switch {
+	case errors.Is(err, rbac.ErrInvalidIPAllowlist):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_ip_allowlist"})
+	case errors.Is(err, rbac.ErrInvalidBusinessHours):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_business_hours"})
+	case errors.Is(err, rbac.ErrConditionTooLong):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "condition_too_long"})
+	default:
+		return err
+	}
+}
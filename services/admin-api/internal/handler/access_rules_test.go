@@ -0,0 +1,138 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAccessConditions(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	adminID := uuid.NewString()
+	memberID := uuid.NewString()
+	targetID := uuid.NewString()
+	seed(t, db, tenantID, ownerID, adminID, memberID, targetID, "tenant-beta", uuid.NewString())
+
+	r := newTestRouter(t, db)
+	ownerToken := mustAccessToken(t, ownerID, &tenantID)
+	adminToken := mustAccessToken(t, adminID, &tenantID)
+	tenantPath := "/api/v1/admin/tenants/" + tenantID
+
+	t.Run("admin cannot manage owner", func(t *testing.T) {
+		w := performJSON(r, http.MethodPatch, tenantPath+"/members/"+ownerID, adminToken, map[string]string{"role": "member"})
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "condition_denied")
+	})
+
+	t.Run("admin manages members ranked below", func(t *testing.T) {
+		w := performJSON(r, http.MethodPatch, tenantPath+"/members/"+targetID, adminToken, map[string]string{"role": "member"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("admin cannot manage peer admin", func(t *testing.T) {
+		if w := performJSON(r, http.MethodPost, tenantPath+"/users/"+targetID+"/roles/admin", ownerToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("owner grant admin: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w := performJSON(r, http.MethodDelete, tenantPath+"/members/"+targetID, mustAccessToken(t, adminID, &tenantID), nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "condition_denied")
+		if w := performJSON(r, http.MethodDelete, tenantPath+"/members/"+targetID, ownerToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("owner delete admin: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("only owners change access rules", func(t *testing.T) {
+		w := performJSON(r, http.MethodPut, tenantPath+"/access-rules", adminToken, map[string]any{"ip_allowlist": []string{"192.0.2.0/24"}})
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "owner_required")
+	})
+
+	t.Run("invalid and self-locking rules are rejected", func(t *testing.T) {
+		w := performJSON(r, http.MethodPut, tenantPath+"/access-rules", ownerToken, map[string]any{"ip_allowlist": []string{"10.0.0.0/33"}})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "invalid_ip_allowlist")
+
+		// httptest requests come from 192.0.2.1.
+		w = performJSON(r, http.MethodPut, tenantPath+"/access-rules", ownerToken, map[string]any{"ip_allowlist": []string{"10.0.0.0/8"}})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "would_lock_out")
+	})
+
+	t.Run("ip allowlist applies to every member", func(t *testing.T) {
+		w := performJSON(r, http.MethodPut, tenantPath+"/access-rules", ownerToken, map[string]any{"ip_allowlist": []string{"192.0.2.0/24", "203.0.113.7"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+
+		w = performJSON(r, http.MethodGet, tenantPath+"/access-rules", adminToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("get access rules: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				IPAllowlist []string `json:"ip_allowlist"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if want := []string{"192.0.2.0/24", "203.0.113.7/32"}; !slices.Equal(env.Data.IPAllowlist, want) {
+			t.Fatalf("ip_allowlist=%v want %v", env.Data.IPAllowlist, want)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, tenantPath+"/members", bytes.NewReader(nil))
+		req.Header.Set("Authorization", "Bearer "+ownerToken)
+		req.RemoteAddr = "198.51.100.9:4000"
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("owner outside allowlist: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "condition_denied")
+
+		if w := performJSON(r, http.MethodPut, tenantPath+"/access-rules", ownerToken, map[string]any{}); w.Code != http.StatusOK {
+			t.Fatalf("clear access rules: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("after clearing rules: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func assertReason(t *testing.T, w *httptest.ResponseRecorder, reason string) {
+	t.Helper()
+	var body struct {
+		Data struct {
+			Reason string `json:"reason"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode envelope: %v body=%s", err, w.Body.String())
+	}
+	if body.Data.Reason != reason {
+		t.Fatalf("want reason=%s got=%s body=%s", reason, body.Data.Reason, w.Body.String())
+	}
+}
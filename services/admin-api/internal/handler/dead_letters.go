@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+)
+
+const (
+	defaultDeadLetterPageSize = 50
+	maxDeadLetterPageSize     = 500
+)
+
+type deadLettersResp struct {
+	Queue       string             `json:"queue"`
+	Total       int64              `json:"total"`
+	DeadLetters []queue.DeadLetter `json:"dead_letters"`
+	NextCursor  string             `json:"next_cursor,omitempty"`
+}
+
+// ListDeadLetters lists the dead letters of a queue, oldest first. ?cursor=
+// continues from next_cursor.
+func (h *Handler) ListDeadLetters(c *gin.Context) error {
+	name, err := h.deadLetterQueue(c)
+	if err != nil {
+		return err
+	}
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultDeadLetterPageSize)), 10, 64)
+	if err != nil || limit <= 0 || limit > maxDeadLetterPageSize {
+		return apperr.BadRequest(errors.New("invalid_limit")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	total, err := h.DeadLetters.LengthContext(c, name)
+	if err != nil {
+		return err
+	}
+	items, err := h.DeadLetters.ListContext(c, name, c.Query("cursor"), limit)
+	if err != nil {
+		return deadLetterError(err)
+	}
+	out := deadLettersResp{Queue: name, Total: total, DeadLetters: items}
+	if int64(len(items)) == limit {
+		out.NextCursor = items[len(items)-1].ID
+	}
+	resp.OK(c, out)
+	return nil
+}
+
+// GetDeadLetter returns one dead letter with its original payload.
+func (h *Handler) GetDeadLetter(c *gin.Context) error {
+	name, err := h.deadLetterQueue(c)
+	if err != nil {
+		return err
+	}
+	dl, err := h.DeadLetters.GetContext(c, name, c.Param("id"))
+	if err != nil {
+		return deadLetterError(err)
+	}
+	resp.OK(c, dl)
+	return nil
+}
+
+// DeleteDeadLetter discards one dead letter.
+func (h *Handler) DeleteDeadLetter(c *gin.Context) error {
+	name, err := h.deadLetterQueue(c)
+	if err != nil {
+		return err
+	}
+	id := c.Param("id")
+	if err := h.DeadLetters.DeleteContext(c, name, id); err != nil {
+		return deadLetterError(err)
+	}
+	h.audit(c, audit.ActionDeadLetterDelete, "", "dead_letter", id, map[string]any{"queue": name})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// PurgeDeadLetters discards every dead letter of a queue.
+func (h *Handler) PurgeDeadLetters(c *gin.Context) error {
+	name, err := h.deadLetterQueue(c)
+	if err != nil {
+		return err
+	}
+	purged, err := h.DeadLetters.PurgeContext(c, name)
+	if err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionDeadLetterPurge, "", "queue", name, map[string]any{"purged": purged})
+	resp.OK(c, map[string]any{"ok": true, "purged": purged})
+	return nil
+}
+
+// ReplayDeadLetter puts the original payload of a dead letter back on its
+// queue and removes the dead letter.
+func (h *Handler) ReplayDeadLetter(c *gin.Context) error {
+	name, err := h.deadLetterQueue(c)
+	if err != nil {
+		return err
+	}
+	if h.Queue == nil {
+		return errors.New("queue is not configured")
+	}
+	id := c.Param("id")
+	if err := h.DeadLetters.ReplayContext(c, h.Queue, name, id); err != nil {
+		return deadLetterError(err)
+	}
+	h.audit(c, audit.ActionDeadLetterReplay, "", "dead_letter", id, map[string]any{"queue": name})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// deadLetterQueue returns the :queue path parameter if it is one of the
+// queues whose dead letters may be managed.
+func (h *Handler) deadLetterQueue(c *gin.Context) (string, error) {
+	if h.DeadLetters == nil {
+		return "", errors.New("dead-letter queue is not configured")
+	}
+	name := c.Param("queue")
+	if !slices.Contains(h.DeadLetterQueues, name) {
+		return "", apperr.NotFound(errors.New("queue_not_found")).WithData(map[string]any{"reason": "queue_not_found"})
+	}
+	return name, nil
+}
+
+func deadLetterError(err error) error {
+	switch {
+	case errors.Is(err, queue.ErrDeadLetterNotFound):
+		return apperr.NotFound(err).WithData(map[string]any{"reason": "dead_letter_not_found"})
+	case errors.Is(err, queue.ErrInvalidDeadLetterID):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	case errors.Is(err, queue.ErrInvalidReplay):
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "payload_not_replayable"})
+	default:
+		return err
+	}
+}
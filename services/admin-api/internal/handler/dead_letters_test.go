@@ -0,0 +1,139 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/ginmid"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/services/admin-api/internal/handler"
+	"anvilkit-auth-template/services/admin-api/internal/store"
+	"anvilkit-auth-template/services/admin-api/internal/testutil"
+)
+
+// payloadQueue stands in for the work queue and records replayed payloads.
+type payloadQueue struct {
+	payloads []string
+}
+
+func (q *payloadQueue) EnqueueContext(_ context.Context, _ string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	q.payloads = append(q.payloads, string(raw))
+	return nil
+}
+
+func TestDeadLetterEndpoints(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+	rdb := testutil.MustTestRedis(t)
+	ctx := context.Background()
+	queueName := "test:dead-letter-endpoints"
+	if err := rdb.Del(ctx, queue.DeadLetterKey(queueName)).Err(); err != nil {
+		t.Fatalf("reset dead letters: %v", err)
+	}
+	seedPlatformAdmin(t, db)
+
+	deadLetters, err := queue.NewDeadLetter(rdb)
+	if err != nil {
+		t.Fatalf("new dead-letter queue: %v", err)
+	}
+	for _, payload := range []string{`{"record_id":"rec-1"}`, "not-json", `{"record_id":"rec-3"}`} {
+		if err := deadLetters.AddContext(ctx, queueName, []byte(payload), "queue_delivery_attempts_exhausted", 6); err != nil {
+			t.Fatalf("add dead letter: %v", err)
+		}
+	}
+
+	q := &payloadQueue{}
+	h := &handler.Handler{Store: &store.Store{DB: db}, DeadLetters: deadLetters, DeadLetterQueues: []string{queueName}, Queue: q}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginmid.ErrorHandler())
+	platform := r.Group("/api/v1/admin/platform", ginmid.AuthN("test-secret-only", "anvilkit-auth", "anvilkit-clients"), handler.RejectSuspendedUsers(h.Store), ginmid.RequirePlatformAdmin(h.Store.IsPlatformAdmin))
+	platform.GET("/queues/:queue/dead-letters", ginmid.Wrap(h.ListDeadLetters))
+	platform.DELETE("/queues/:queue/dead-letters", ginmid.Wrap(h.PurgeDeadLetters))
+	platform.GET("/queues/:queue/dead-letters/:id", ginmid.Wrap(h.GetDeadLetter))
+	platform.DELETE("/queues/:queue/dead-letters/:id", ginmid.Wrap(h.DeleteDeadLetter))
+	platform.POST("/queues/:queue/dead-letters/:id/replay", ginmid.Wrap(h.ReplayDeadLetter))
+
+	token := mustAccessToken(t, testPlatformAdminID, nil)
+	basePath := "/api/v1/admin/platform/queues/" + queueName + "/dead-letters"
+
+	var page struct {
+		Data struct {
+			Total       int64              `json:"total"`
+			DeadLetters []queue.DeadLetter `json:"dead_letters"`
+			NextCursor  string             `json:"next_cursor"`
+		} `json:"data"`
+	}
+	w := performJSON(r, http.MethodGet, basePath+"?limit=2", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: want 200 got %d body=%s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if page.Data.Total != 3 || len(page.Data.DeadLetters) != 2 || page.Data.NextCursor != page.Data.DeadLetters[1].ID {
+		t.Fatalf("unexpected page: %+v", page.Data)
+	}
+	first, invalid := page.Data.DeadLetters[0], page.Data.DeadLetters[1]
+	if first.Payload != `{"record_id":"rec-1"}` || first.Reason != "queue_delivery_attempts_exhausted" || first.Deliveries != 6 {
+		t.Fatalf("unexpected dead letter: %+v", first)
+	}
+
+	t.Run("unknown queues are not exposed", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, "/api/v1/admin/platform/queues/other/dead-letters", token, nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("want 404 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "queue_not_found")
+	})
+
+	t.Run("invalid payloads cannot be replayed", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, basePath+"/"+invalid.ID+"/replay", token, nil)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "payload_not_replayable")
+	})
+
+	t.Run("replay enqueues the payload and removes the entry", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, basePath+"/"+first.ID+"/replay", token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if len(q.payloads) != 1 || q.payloads[0] != first.Payload {
+			t.Fatalf("replayed=%v", q.payloads)
+		}
+		w = performJSON(r, http.MethodGet, basePath+"/"+first.ID, token, nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("want 404 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "dead_letter_not_found")
+	})
+
+	t.Run("delete and purge", func(t *testing.T) {
+		w := performJSON(r, http.MethodDelete, basePath+"/"+invalid.ID, token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("delete: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = performJSON(r, http.MethodDelete, basePath, token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("purge: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var purged struct {
+			Data struct {
+				Purged int64 `json:"purged"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &purged); err != nil || purged.Data.Purged != 1 {
+			t.Fatalf("purged=%+v err=%v", purged.Data, err)
+		}
+	})
+}
@@ -0,0 +1,378 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
+	"anvilkit-auth-template/services/admin-api/internal/store"
+)
+
+type groupItem struct {
+	ID          string    `json:"id"`
+	DisplayName string    `json:"display_name"`
+	ExternalID  *string   `json:"external_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type groupDetail struct {
+	groupItem
+	Members []groupMemberItem `json:"members"`
+}
+
+type groupMemberItem struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+type createGroupReq struct {
+	DisplayName string   `json:"display_name"`
+	ExternalID  *string  `json:"external_id"`
+	Members     []string `json:"members"`
+}
+
+// updateGroupReq changes the fields that are present; an empty external_id
+// clears it.
+type updateGroupReq struct {
+	DisplayName *string `json:"display_name"`
+	ExternalID  *string `json:"external_id"`
+}
+
+type groupMembersReq struct {
+	Members []string `json:"members"`
+}
+
+// ListGroups lists the tenant's groups. ?external_id= looks a group up by the
+// identifier an identity provider assigned to it.
+func (h *Handler) ListGroups(c *gin.Context) error {
+	groups, err := h.Store.ListGroups(c, c.Param("tenantId"), strings.TrimSpace(c.Query("external_id")))
+	if err != nil {
+		return err
+	}
+	items := make([]groupItem, 0, len(groups))
+	for _, g := range groups {
+		items = append(items, toGroupItem(g))
+	}
+	resp.OK(c, map[string]any{"groups": items})
+	return nil
+}
+
+// CreateGroup creates a group. Adding members gives them nothing until the
+// group is granted roles or permissions.
+func (h *Handler) CreateGroup(c *gin.Context) error {
+	tid := c.Param("tenantId")
+
+	var req createGroupReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	name := strings.TrimSpace(req.DisplayName)
+	if name == "" {
+		return apperr.BadRequest(errors.New("missing_display_name")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	externalID := req.ExternalID
+	if externalID != nil {
+		if trimmed := strings.TrimSpace(*externalID); trimmed != "" {
+			externalID = &trimmed
+		} else {
+			externalID = nil
+		}
+	}
+	for _, uid := range req.Members {
+		if err := validateUserID(uid); err != nil {
+			return err
+		}
+	}
+
+	g, err := h.Store.CreateGroup(c, tid, name, externalID, req.Members)
+	if err != nil {
+		return groupError(err)
+	}
+	h.audit(c, audit.ActionGroupCreate, tid, "group", g.ID, map[string]any{"display_name": g.DisplayName, "members": req.Members})
+	resp.OK(c, toGroupItem(g))
+	return nil
+}
+
+func (h *Handler) GetGroup(c *gin.Context) error {
+	g, found, err := h.Store.Group(c, c.Param("tenantId"), c.Param("groupId"))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return groupNotFound()
+	}
+	detail := groupDetail{groupItem: toGroupItem(g), Members: make([]groupMemberItem, 0, len(g.Members))}
+	for _, m := range g.Members {
+		detail.Members = append(detail.Members, groupMemberItem{UserID: m.UserID, Email: m.Email})
+	}
+	resp.OK(c, detail)
+	return nil
+}
+
+func (h *Handler) UpdateGroup(c *gin.Context) error {
+	var req updateGroupReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	update := store.GroupUpdate{DisplayName: req.DisplayName, ExternalID: req.ExternalID}
+	if update.DisplayName != nil {
+		name := strings.TrimSpace(*update.DisplayName)
+		if name == "" {
+			return apperr.BadRequest(errors.New("missing_display_name")).WithData(map[string]any{"reason": "invalid_argument"})
+		}
+		update.DisplayName = &name
+	}
+	if update.ExternalID != nil {
+		externalID := strings.TrimSpace(*update.ExternalID)
+		update.ExternalID = &externalID
+	}
+
+	found, err := h.Store.UpdateGroup(c, c.Param("tenantId"), c.Param("groupId"), update)
+	if err != nil {
+		return groupError(err)
+	}
+	if !found {
+		return groupNotFound()
+	}
+	h.audit(c, audit.ActionGroupUpdate, c.Param("tenantId"), "group", c.Param("groupId"), map[string]any{"display_name": update.DisplayName, "external_id": update.ExternalID})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// DeleteGroup deletes a group, its memberships and its grants. Groups nested
+// in it lose what they inherited through it.
+func (h *Handler) DeleteGroup(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	gid := c.Param("groupId")
+	// Nesting is part of the grants, so look the nested groups up first.
+	nested, err := rbac.NestedGroups(h.Enforcer, tid, gid)
+	if err != nil {
+		return err
+	}
+	found, err := h.Store.DeleteGroup(c, tid, gid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return groupNotFound()
+	}
+	if err = rbac.DeleteGroupGrants(h.Enforcer, tid, gid); err != nil {
+		return err
+	}
+	if err = h.Store.BumpGroupAuthzVersion(c, tid, nested); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionGroupDelete, tid, "group", gid, nil)
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// SetGroupMembers replaces the members of a group. Adding members hands out
+// what the group grants, so the caller must be able to grant all of it.
+func (h *Handler) SetGroupMembers(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	gid := c.Param("groupId")
+
+	var req groupMembersReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	for _, uid := range req.Members {
+		if err := validateUserID(uid); err != nil {
+			return err
+		}
+	}
+	if err := h.ensureGroupGrantable(c, tid, []string{gid}); err != nil {
+		return err
+	}
+
+	found, err := h.Store.SetGroupMembers(c, tid, gid, req.Members)
+	if err != nil {
+		return groupError(err)
+	}
+	if !found {
+		return groupNotFound()
+	}
+	h.audit(c, audit.ActionGroupMembersUpdate, tid, "group", gid, map[string]any{"members": req.Members})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+func (h *Handler) AddGroupMember(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	gid := c.Param("groupId")
+	targetUID := c.Param("userId")
+	if err := validateUserID(targetUID); err != nil {
+		return err
+	}
+	if err := h.ensureGroupGrantable(c, tid, []string{gid}); err != nil {
+		return err
+	}
+
+	found, err := h.Store.AddGroupMember(c, tid, gid, targetUID)
+	if err != nil {
+		return groupError(err)
+	}
+	if !found {
+		return groupNotFound()
+	}
+	h.audit(c, audit.ActionGroupMemberAdd, tid, "group", gid, map[string]any{"user_id": targetUID})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// RemoveGroupMember removes a user from a group. Like revoking a role, it
+// requires being able to grant what the group grants.
+func (h *Handler) RemoveGroupMember(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	gid := c.Param("groupId")
+	targetUID := c.Param("userId")
+	if err := validateUserID(targetUID); err != nil {
+		return err
+	}
+	if err := h.ensureGroupGrantable(c, tid, []string{gid}); err != nil {
+		return err
+	}
+
+	removed, err := h.Store.RemoveGroupMember(c, tid, gid, targetUID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return apperr.NotFound(errors.New("member_not_found")).WithData(map[string]any{"reason": "member_not_found"})
+	}
+	h.audit(c, audit.ActionGroupMemberRemove, tid, "group", gid, map[string]any{"user_id": targetUID})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+func (h *Handler) GetGroupGrants(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	gid := c.Param("groupId")
+	if err := h.ensureGroupExists(c, tid, gid); err != nil {
+		return err
+	}
+	grants, err := rbac.GetGroupGrants(h.Enforcer, tid, gid)
+	if err != nil {
+		return err
+	}
+	resp.OK(c, grants)
+	return nil
+}
+
+// PutGroupGrants replaces the roles, permissions and parent groups a group
+// grants its members. The caller must be able to grant both the old and the
+// new grants.
+func (h *Handler) PutGroupGrants(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	gid := c.Param("groupId")
+
+	var req rbac.GroupGrants
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	if err := h.ensureGroupExists(c, tid, gid); err != nil {
+		return err
+	}
+	exist, err := h.Store.GroupsExist(c, tid, req.Groups)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return apperr.BadRequest(errors.New("unknown_group")).WithData(map[string]any{"reason": "unknown_group"})
+	}
+	for _, role := range req.Roles {
+		if err = h.validateMemberRole(tid, role); err != nil {
+			return err
+		}
+		if err = h.ensureAssignable(c, tid, role); err != nil {
+			return err
+		}
+	}
+	if err = h.ensureGrantable(c, tid, req.Permissions); err != nil {
+		return err
+	}
+	// Both what the group grants now and what it will grant must be within
+	// the caller's reach.
+	if err = h.ensureGroupGrantable(c, tid, append([]string{gid}, req.Groups...)); err != nil {
+		return err
+	}
+
+	grants, err := rbac.SetGroupGrants(h.Enforcer, tid, gid, req)
+	if err != nil {
+		return groupError(err)
+	}
+	nested, err := rbac.NestedGroups(h.Enforcer, tid, gid)
+	if err != nil {
+		return err
+	}
+	if err = h.Store.BumpGroupAuthzVersion(c, tid, append([]string{gid}, nested...)); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionGroupGrantsUpdate, tid, "group", gid, map[string]any{"grants": grants})
+	resp.OK(c, grants)
+	return nil
+}
+
+// ensureGroupGrantable extends ensureAssignable and ensureGrantable to
+// groups: the caller must be able to assign every role and grant every
+// permission the groups carry, including through nesting.
+func (h *Handler) ensureGroupGrantable(c *gin.Context, tid string, groupIDs []string) error {
+	roles, err := rbac.GroupRoles(h.Enforcer, tid, groupIDs)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err = h.ensureAssignable(c, tid, role); err != nil {
+			return err
+		}
+	}
+	perms, err := rbac.GroupPermissions(h.Enforcer, tid, groupIDs)
+	if err != nil {
+		return err
+	}
+	return h.ensureGrantable(c, tid, perms)
+}
+
+func (h *Handler) ensureGroupExists(c *gin.Context, tid, gid string) error {
+	exist, err := h.Store.GroupsExist(c, tid, []string{gid})
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return groupNotFound()
+	}
+	return nil
+}
+
+func toGroupItem(g store.GroupDTO) groupItem {
+	return groupItem{ID: g.ID, DisplayName: g.DisplayName, ExternalID: g.ExternalID, CreatedAt: g.CreatedAt, UpdatedAt: g.UpdatedAt}
+}
+
+func groupNotFound() error {
+	return apperr.NotFound(errors.New("group_not_found")).WithData(map[string]any{"reason": "group_not_found"})
+}
+
+func groupError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrGroupExists):
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "group_exists"})
+	case errors.Is(err, store.ErrNotTenantMember):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "not_tenant_member"})
+	case errors.Is(err, rbac.ErrGroupCycle):
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "group_cycle"})
+	case errors.Is(err, rbac.ErrInvalidGroupRole):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_group_role"})
+	case errors.Is(err, rbac.ErrUnknownPermission):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "unknown_permission"})
+	default:
+		return err
+	}
+}
@@ -0,0 +1,212 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGroupEndpoints(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	adminID := uuid.NewString()
+	memberID := uuid.NewString()
+	targetID := uuid.NewString()
+	otherOwnerID := uuid.NewString()
+	seed(t, db, tenantID, ownerID, adminID, memberID, targetID, "tenant-beta", otherOwnerID)
+
+	r := newTestRouter(t, db)
+	tenantPath := "/api/v1/admin/tenants/" + tenantID
+	adminToken := mustAccessToken(t, adminID, nil)
+	memberToken := mustAccessToken(t, memberID, nil)
+
+	createGroup := func(t *testing.T, body map[string]any) string {
+		t.Helper()
+		w := performJSON(r, http.MethodPost, tenantPath+"/groups", adminToken, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("create group: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return env.Data.ID
+	}
+
+	staffID := createGroup(t, map[string]any{"display_name": "Staff"})
+	supportID := createGroup(t, map[string]any{"display_name": "Support", "external_id": "idp-support", "members": []string{memberID}})
+
+	t.Run("membership alone grants nothing", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, tenantPath+"/members", memberToken, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("members inherit grants through nested groups", func(t *testing.T) {
+		w := performJSON(r, http.MethodPut, tenantPath+"/groups/"+staffID+"/grants", adminToken, map[string]any{"permissions": []string{"members:read"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("staff grants: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = performJSON(r, http.MethodPut, tenantPath+"/groups/"+supportID+"/grants", adminToken, map[string]any{"groups": []string{staffID}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("support grants: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodGet, tenantPath+"/members", memberToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("list members: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+
+		w = performJSON(r, http.MethodPut, tenantPath+"/groups/"+staffID+"/grants", adminToken, map[string]any{"groups": []string{supportID}})
+		if w.Code != http.StatusConflict {
+			t.Fatalf("cycle: want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "group_cycle")
+	})
+
+	t.Run("group roles count for the caller", func(t *testing.T) {
+		w := performJSON(r, http.MethodPut, tenantPath+"/groups/"+staffID+"/grants", adminToken, map[string]any{"roles": []string{"admin"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("grant admin: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodPost, tenantPath+"/roles", memberToken, map[string]any{"name": "auditor", "permissions": []string{"roles:read"}}); w.Code != http.StatusOK {
+			t.Fatalf("create role: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = performJSON(r, http.MethodPut, tenantPath+"/groups/"+staffID+"/grants", adminToken, map[string]any{"roles": []string{"owner"}})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("grant owner: want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "invalid_group_role")
+	})
+
+	t.Run("group roles count for the target", func(t *testing.T) {
+		// member holds admin through staff, so a peer admin may not remove it.
+		w := performJSON(r, http.MethodDelete, tenantPath+"/members/"+memberID, adminToken, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "condition_denied")
+	})
+
+	t.Run("groups cannot hand out more than the caller holds", func(t *testing.T) {
+		if w := performJSON(r, http.MethodPost, tenantPath+"/roles", adminToken, map[string]any{"name": "group-manager", "permissions": []string{"groups:read", "groups:write"}}); w.Code != http.StatusOK {
+			t.Fatalf("create role: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodPost, tenantPath+"/users/"+targetID+"/roles/group-manager", adminToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("assign role: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		managerToken := mustAccessToken(t, targetID, nil)
+
+		w := performJSON(r, http.MethodPost, tenantPath+"/groups/"+staffID+"/members/"+targetID, managerToken, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("join admin group: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "role_not_assignable")
+
+		w = performJSON(r, http.MethodPut, tenantPath+"/groups/"+supportID+"/grants", managerToken, map[string]any{"permissions": []string{"billing:manage"}})
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("grant unheld permission: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "permission_not_held")
+	})
+
+	t.Run("groups are found by external id", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, tenantPath+"/groups?external_id=idp-support", adminToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				Groups []struct {
+					ID string `json:"id"`
+				} `json:"groups"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(env.Data.Groups) != 1 || env.Data.Groups[0].ID != supportID {
+			t.Fatalf("groups=%v want [%s]", env.Data.Groups, supportID)
+		}
+
+		w = performJSON(r, http.MethodPost, tenantPath+"/groups", adminToken, map[string]any{"display_name": "Other", "external_id": "idp-support"})
+		if w.Code != http.StatusConflict {
+			t.Fatalf("duplicate external id: want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "group_exists")
+	})
+
+	t.Run("only tenant members can join", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, tenantPath+"/groups/"+supportID+"/members/"+otherOwnerID, adminToken, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "not_tenant_member")
+	})
+
+	t.Run("group changes invalidate members' tokens", func(t *testing.T) {
+		authzVersion := func(t *testing.T, uid string) int {
+			t.Helper()
+			var v int
+			if err := db.QueryRow(context.Background(), `select authz_version from tenant_users where tenant_id = $1 and user_id = $2`, tenantID, uid).Scan(&v); err != nil {
+				t.Fatalf("authz_version: %v", err)
+			}
+			return v
+		}
+
+		before := authzVersion(t, targetID)
+		if w := performJSON(r, http.MethodPost, tenantPath+"/groups/"+supportID+"/members/"+targetID, adminToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("add member: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if got := authzVersion(t, targetID); got != before+1 {
+			t.Fatalf("after join authz_version=%d want %d", got, before+1)
+		}
+		if w := performJSON(r, http.MethodDelete, tenantPath+"/groups/"+supportID+"/members/"+targetID, adminToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("remove member: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if got := authzVersion(t, targetID); got != before+2 {
+			t.Fatalf("after leave authz_version=%d want %d", got, before+2)
+		}
+
+		// member is in support, which is nested in staff.
+		before = authzVersion(t, memberID)
+		if w := performJSON(r, http.MethodPut, tenantPath+"/groups/"+staffID+"/grants", adminToken, map[string]any{"roles": []string{"admin"}, "permissions": []string{"members:read"}}); w.Code != http.StatusOK {
+			t.Fatalf("staff grants: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if got := authzVersion(t, memberID); got <= before {
+			t.Fatalf("after nested grant change authz_version=%d want > %d", got, before)
+		}
+	})
+
+	t.Run("roles granted through groups are in use", func(t *testing.T) {
+		if w := performJSON(r, http.MethodPost, tenantPath+"/roles", adminToken, map[string]any{"name": "reviewer", "permissions": []string{"roles:read"}}); w.Code != http.StatusOK {
+			t.Fatalf("create role: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodPut, tenantPath+"/groups/"+supportID+"/grants", adminToken, map[string]any{"roles": []string{"reviewer"}, "groups": []string{staffID}}); w.Code != http.StatusOK {
+			t.Fatalf("support grants: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w := performJSON(r, http.MethodDelete, tenantPath+"/roles/reviewer", adminToken, nil)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "role_in_use")
+	})
+
+	t.Run("deleting a group revokes what it granted", func(t *testing.T) {
+		if w := performJSON(r, http.MethodDelete, tenantPath+"/groups/"+staffID, adminToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("delete: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodGet, tenantPath+"/members", memberToken, nil); w.Code != http.StatusForbidden {
+			t.Fatalf("list members: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+}
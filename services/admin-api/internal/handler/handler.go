@@ -4,25 +4,46 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"slices"
 	"strings"
 	"time"
 
 	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/persist"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgconn"
+	goredis "github.com/redis/go-redis/v9"
 
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/errcode"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
 	"anvilkit-auth-template/services/admin-api/internal/store"
 )
 
-var allowedMemberRoles = []string{"owner", "admin", "member"}
-
 type Handler struct {
 	Store    *store.Store
-	Enforcer *casbin.Enforcer
+	Enforcer *casbin.SyncedEnforcer
+	// Policies and Watcher back the platform policy endpoints; Watcher may be
+	// nil when running a single replica.
+	Policies *rbac.PolicySets
+	Watcher  persist.Watcher
+	// Redis holds auth-api's failed-login counters, which the platform unlock
+	// endpoint clears.
+	Redis *goredis.Client
+	// Audit records administrative changes and serves the audit endpoints;
+	// nothing is recorded when it is nil.
+	Audit *audit.Log
+	// Webhooks publishes member lifecycle events to tenant webhooks and
+	// queues redeliveries; nothing is published when it is nil.
+	Webhooks *webhooks.Publisher
+	// DeadLetters backs the platform dead-letter endpoints for the queues
+	// in DeadLetterQueues; replayed jobs are enqueued through Queue.
+	DeadLetters      *queue.DeadLetterQueue
+	DeadLetterQueues []string
+	Queue            queue.Enqueuer
 }
 
 type listMembersResp struct {
@@ -32,17 +53,24 @@ type listMembersResp struct {
 type memberItem struct {
 	UserID    string    `json:"user_id"`
 	Email     string    `json:"email"`
-	Role      string    `json:"role"`
+	Roles     []string  `json:"roles"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// memberRolesReq names a member's roles either as a list or, for a single
+// role, with the role shorthand.
+type memberRolesReq struct {
+	Role  string   `json:"role"`
+	Roles []string `json:"roles"`
+}
+
 type addMemberReq struct {
 	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	memberRolesReq
 }
 
 type updateMemberReq struct {
-	Role string `json:"role"`
+	memberRolesReq
 }
 
 func (h *Handler) Healthz(c *gin.Context) error {
@@ -51,36 +79,68 @@ func (h *Handler) Healthz(c *gin.Context) error {
 }
 
 func (h *Handler) MeRoles(c *gin.Context) error {
-	uid, _ := c.Get("uid")
-	tid := c.Param("tenantId")
-	roles, err := h.Store.RolesForUser(c, tid, uid.(string))
+	roles, _, err := h.Store.MemberRoles(c, c.Param("tenantId"), c.GetString("uid"))
 	if err != nil {
 		return err
 	}
-	if err := h.enforce(c, roles, tid); err != nil {
-		return err
-	}
-	resp.OK(c, map[string]any{"roles": roles})
+	resp.OK(c, map[string]any{"roles": rbac.SortTenantRoles(roles)})
 	return nil
 }
 
+// AssignRole grants one more role to a member.
 func (h *Handler) AssignRole(c *gin.Context) error {
-	uid, _ := c.Get("uid")
 	tid := c.Param("tenantId")
-	roles, err := h.Store.RolesForUser(c, tid, uid.(string))
-	if err != nil {
+	targetUID := c.Param("userId")
+	role := c.Param("role")
+	if err := validateUserID(targetUID); err != nil {
 		return err
 	}
-	if err = h.enforce(c, roles, tid); err != nil {
+	if err := h.validateMemberRole(tid, role); err != nil {
 		return err
 	}
-	if err = h.Store.AssignRole(c, tid, c.Param("userId"), c.Param("role")); err != nil {
+	if err := h.ensureAssignable(c, tid, role); err != nil {
 		return err
 	}
+
+	found, err := h.Store.GrantMemberRole(c, tid, targetUID, role)
+	if err != nil {
+		return memberRolesError(err)
+	}
+	if !found {
+		return apperr.NotFound(errors.New("member_not_found")).WithData(map[string]any{"reason": "member_not_found"})
+	}
+	h.audit(c, audit.ActionMemberRoleAssign, tid, "user", targetUID, map[string]any{"role": role})
+	h.publishMemberRoles(c, tid, targetUID)
 	resp.OK(c, map[string]any{"assigned": true})
 	return nil
 }
 
+// RevokeRole removes one role from a member. A member always keeps at least
+// one role; remove the member instead.
+func (h *Handler) RevokeRole(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	targetUID := c.Param("userId")
+	role := c.Param("role")
+	if err := validateUserID(targetUID); err != nil {
+		return err
+	}
+	if err := h.ensureAssignable(c, tid, role); err != nil {
+		return err
+	}
+
+	found, err := h.Store.RevokeMemberRole(c, tid, targetUID, role)
+	if err != nil {
+		return memberRolesError(err)
+	}
+	if !found {
+		return apperr.NotFound(errors.New("member_not_found")).WithData(map[string]any{"reason": "member_not_found"})
+	}
+	h.audit(c, audit.ActionMemberRoleRevoke, tid, "user", targetUID, map[string]any{"role": role})
+	h.publishMemberRoles(c, tid, targetUID)
+	resp.OK(c, map[string]any{"revoked": true})
+	return nil
+}
+
 func (h *Handler) ListMembers(c *gin.Context) error {
 	tid := c.Param("tenantId")
 
@@ -91,7 +151,7 @@ func (h *Handler) ListMembers(c *gin.Context) error {
 
 	items := make([]memberItem, 0, len(members))
 	for _, m := range members {
-		items = append(items, memberItem{UserID: m.UserID, Email: m.Email, Role: m.Role, CreatedAt: m.CreatedAt})
+		items = append(items, memberItem{UserID: m.UserID, Email: m.Email, Roles: rbac.SortTenantRoles(m.Roles), CreatedAt: m.CreatedAt})
 	}
 	resp.OK(c, listMembersResp{Members: items})
 	return nil
@@ -107,7 +167,8 @@ func (h *Handler) AddMember(c *gin.Context) error {
 	if err := validateUserID(req.UserID); err != nil {
 		return err
 	}
-	if err := validateRole(req.Role); err != nil {
+	roles, err := h.memberRoles(c, tid, req.memberRolesReq)
+	if err != nil {
 		return err
 	}
 
@@ -119,13 +180,15 @@ func (h *Handler) AddMember(c *gin.Context) error {
 		return apperr.NotFound(errors.New("user_not_found")).WithData(map[string]any{"reason": "user_not_found"})
 	}
 
-	if err = h.Store.AddMember(c, tid, req.UserID, req.Role); err != nil {
+	if err = h.Store.AddMember(c, tid, req.UserID, roles); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
 			return apperr.Conflict(err).WithData(map[string]any{"reason": "member_exists"})
 		}
 		return err
 	}
+	h.audit(c, audit.ActionMemberAdd, tid, "user", req.UserID, map[string]any{"roles": roles})
+	h.publish(c, tid, webhooks.EventMemberAdded, map[string]any{"user_id": req.UserID, "roles": roles})
 	resp.OK(c, map[string]any{"ok": true})
 	return nil
 }
@@ -141,17 +204,20 @@ func (h *Handler) UpdateMemberRole(c *gin.Context) error {
 	if err := c.ShouldBindJSON(&req); err != nil {
 		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
 	}
-	if err := validateRole(req.Role); err != nil {
+	roles, err := h.memberRoles(c, tid, req.memberRolesReq)
+	if err != nil {
 		return err
 	}
 
-	updated, err := h.Store.UpdateMemberRole(c, tid, targetUID, req.Role)
+	updated, err := h.Store.SetMemberRoles(c, tid, targetUID, roles)
 	if err != nil {
 		return err
 	}
 	if !updated {
 		return apperr.NotFound(errors.New("member_not_found")).WithData(map[string]any{"reason": "member_not_found"})
 	}
+	h.audit(c, audit.ActionMemberRolesUpdate, tid, "user", targetUID, map[string]any{"roles": roles})
+	h.publish(c, tid, webhooks.EventMemberRolesUpdated, map[string]any{"user_id": targetUID, "roles": roles})
 	resp.OK(c, map[string]any{"ok": true})
 	return nil
 }
@@ -170,38 +236,71 @@ func (h *Handler) RemoveMember(c *gin.Context) error {
 	if !removed {
 		return apperr.NotFound(errors.New("member_not_found")).WithData(map[string]any{"reason": "member_not_found"})
 	}
+	h.audit(c, audit.ActionMemberRemove, tid, "user", targetUID, nil)
+	h.publish(c, tid, webhooks.EventMemberRemoved, map[string]any{"user_id": targetUID})
 	resp.OK(c, map[string]any{"ok": true})
 	return nil
 }
 
-func validateRole(role string) error {
-	if !slices.Contains(allowedMemberRoles, role) {
-		return apperr.BadRequest(fmt.Errorf("invalid role: %s", role)).WithData(map[string]any{"reason": "invalid_argument"})
+// memberRoles validates the roles in req and checks the caller may assign
+// each of them. It returns them de-duplicated in display order.
+func (h *Handler) memberRoles(c *gin.Context, tid string, req memberRolesReq) ([]string, error) {
+	roles := req.Roles
+	if len(roles) == 0 && req.Role != "" {
+		roles = []string{req.Role}
+	} else if req.Role != "" {
+		return nil, apperr.BadRequest(errors.New("role_and_roles_given")).WithData(map[string]any{"reason": "invalid_argument"})
 	}
-	return nil
+	roles = rbac.SortTenantRoles(roles)
+	if len(roles) == 0 || len(roles) > rbac.MaxMemberRoles {
+		return nil, apperr.BadRequest(fmt.Errorf("a member needs 1 to %d roles", rbac.MaxMemberRoles)).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	for _, role := range roles {
+		if err := h.validateMemberRole(tid, role); err != nil {
+			return nil, err
+		}
+		if err := h.ensureAssignable(c, tid, role); err != nil {
+			return nil, err
+		}
+	}
+	return roles, nil
 }
 
-func validateUserID(id string) error {
-	if strings.TrimSpace(id) == "" {
-		return apperr.BadRequest(errors.New("missing_user_id")).WithData(map[string]any{"reason": "invalid_argument"})
+func memberRolesError(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, store.ErrLastRole):
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "last_role"})
+	case errors.As(err, &pgErr) && pgErr.Code == "23514":
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "too_many_roles"})
+	default:
+		return err
 	}
-	return nil
 }
 
-func (h *Handler) enforce(c *gin.Context, roles []string, tid string) error {
-	dom := fmt.Sprintf("tenant:%s", tid)
-	obj := c.FullPath()
-	act := c.Request.Method
-	for _, role := range roles {
-		ok, err := h.Enforcer.Enforce(role, dom, obj, act)
+// validateMemberRole accepts the built-in tenant roles and any custom role
+// defined in the tenant.
+func (h *Handler) validateMemberRole(tid, role string) error {
+	if rbac.IsBuiltinTenantRole(role) {
+		return nil
+	}
+	if h.Enforcer != nil {
+		_, exists, err := rbac.CustomRolePermissions(h.Enforcer, tid, role)
 		if err != nil {
 			return err
 		}
-		if ok {
+		if exists {
 			return nil
 		}
 	}
-	return apperr.Forbidden(nil).WithData(map[string]any{"reason": "rbac_denied", "code": errcode.Forbidden})
+	return apperr.BadRequest(fmt.Errorf("invalid role: %s", role)).WithData(map[string]any{"reason": "invalid_argument"})
+}
+
+func validateUserID(id string) error {
+	if strings.TrimSpace(id) == "" {
+		return apperr.BadRequest(errors.New("missing_user_id")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	return nil
 }
 
 func NotFound(c *gin.Context) {
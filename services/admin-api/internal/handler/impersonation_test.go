@@ -0,0 +1,56 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	ajwt "anvilkit-auth-template/modules/common-go/pkg/auth/jwt"
+)
+
+func TestImpersonationTokens(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	seed(t, db, tenantID, ownerID, uuid.NewString(), uuid.NewString(), uuid.NewString(), "tenant-beta", uuid.NewString())
+	if _, err := db.Exec(context.Background(), `insert into users(id,email,password_hash) values ($1,'platform@example.com','hash')`, testPlatformAdminID); err != nil {
+		t.Fatalf("insert platform admin: %v", err)
+	}
+	sessionID := uuid.NewString()
+	if _, err := db.Exec(context.Background(), `
+insert into impersonation_sessions(id, actor_user_id, user_id, tenant_id, reason, expires_at)
+values ($1, $2, $3, $4, 'support ticket', now() + interval '5 minutes')`, sessionID, testPlatformAdminID, ownerID, tenantID); err != nil {
+		t.Fatalf("insert impersonation session: %v", err)
+	}
+	token, err := ajwt.SignImpersonationToken("test-secret-only", "anvilkit-auth", "anvilkit-clients", ownerID, tenantID, testPlatformAdminID, sessionID, ajwt.Authz{}, time.Minute)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+
+	r := newTestRouter(t, db)
+	tenantPath := "/api/v1/admin/tenants/" + tenantID
+
+	if w := performJSON(r, http.MethodGet, tenantPath+"/members", token, nil); w.Code != http.StatusOK {
+		t.Fatalf("read as user: want 200 got %d body=%s", w.Code, w.Body.String())
+	}
+
+	w := performJSON(r, http.MethodPut, tenantPath+"/access-rules", token, map[string]any{"ip_allowlist": []string{"10.0.0.0/8"}})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("access rules: want 403 got %d body=%s", w.Code, w.Body.String())
+	}
+	assertReason(t, w, "impersonation_forbidden")
+
+	if _, err := db.Exec(context.Background(), `update impersonation_sessions set ended_at = now(), ended_by = $2 where id = $1`, sessionID, testPlatformAdminID); err != nil {
+		t.Fatalf("stop impersonation: %v", err)
+	}
+	w = performJSON(r, http.MethodGet, tenantPath+"/members", token, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("after stop: want 401 got %d body=%s", w.Code, w.Body.String())
+	}
+	assertReason(t, w, "impersonation_ended")
+}
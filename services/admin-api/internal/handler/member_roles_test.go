@@ -0,0 +1,120 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMemberMultipleRoles(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	memberID := uuid.NewString()
+	seed(t, db, tenantID, ownerID, uuid.NewString(), memberID, uuid.NewString(), "tenant-beta", uuid.NewString())
+
+	r := newTestRouter(t, db)
+	ownerToken := mustAccessToken(t, ownerID, &tenantID)
+	tenantPath := "/api/v1/admin/tenants/" + tenantID
+	rolePath := func(role string) string { return tenantPath + "/users/" + memberID + "/roles/" + role }
+
+	meRoles := func(t *testing.T, uid string) []string {
+		t.Helper()
+		w := performJSON(r, http.MethodGet, tenantPath+"/me/roles", mustAccessToken(t, uid, &tenantID), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("me/roles: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				Roles []string `json:"roles"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return env.Data.Roles
+	}
+
+	for _, name := range []string{"support", "billing"} {
+		perm := map[string]string{"support": "members:read", "billing": "billing:manage"}[name]
+		if w := performJSON(r, http.MethodPost, tenantPath+"/roles", ownerToken, map[string]any{"name": name, "permissions": []string{perm}}); w.Code != http.StatusOK {
+			t.Fatalf("create role %s: want 200 got %d body=%s", name, w.Code, w.Body.String())
+		}
+	}
+
+	t.Run("owner reads own roles", func(t *testing.T) {
+		if got := meRoles(t, ownerID); !slices.Equal(got, []string{"owner"}) {
+			t.Fatalf("roles=%v want [owner]", got)
+		}
+	})
+
+	t.Run("granted roles accumulate", func(t *testing.T) {
+		for _, role := range []string{"support", "billing", "support"} {
+			if w := performJSON(r, http.MethodPost, rolePath(role), ownerToken, nil); w.Code != http.StatusOK {
+				t.Fatalf("grant %s: want 200 got %d body=%s", role, w.Code, w.Body.String())
+			}
+		}
+		if got := meRoles(t, ownerID); !slices.Equal(got, []string{"owner"}) {
+			t.Fatalf("owner roles changed: %v", got)
+		}
+		w := performJSON(r, http.MethodGet, tenantPath+"/members", mustAccessToken(t, memberID, &tenantID), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list members with support role: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				Members []struct {
+					UserID string   `json:"user_id"`
+					Roles  []string `json:"roles"`
+				} `json:"members"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, m := range env.Data.Members {
+			if m.UserID == memberID && !slices.Equal(m.Roles, []string{"billing", "support", "member"}) {
+				t.Fatalf("member roles=%v want [billing support member]", m.Roles)
+			}
+		}
+	})
+
+	t.Run("revoking one role keeps the others", func(t *testing.T) {
+		if w := performJSON(r, http.MethodDelete, rolePath("support"), ownerToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("revoke: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodGet, tenantPath+"/members", mustAccessToken(t, memberID, &tenantID), nil); w.Code != http.StatusForbidden {
+			t.Fatalf("list members after revoke: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("patch replaces the role set", func(t *testing.T) {
+		w := performJSON(r, http.MethodPatch, tenantPath+"/members/"+memberID, ownerToken, map[string]any{"roles": []string{"support"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("patch: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = performJSON(r, http.MethodPatch, tenantPath+"/members/"+memberID, ownerToken, map[string]any{"role": "member", "roles": []string{"support"}})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("patch with role and roles: want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("last role cannot be revoked", func(t *testing.T) {
+		w := performJSON(r, http.MethodDelete, rolePath("support"), ownerToken, nil)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("unknown member", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, tenantPath+"/users/"+uuid.NewString()+"/roles/support", ownerToken, nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("want 404 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+}
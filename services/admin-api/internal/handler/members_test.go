@@ -16,8 +16,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
 	ajwt "anvilkit-auth-template/modules/common-go/pkg/auth/jwt"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/ginmid"
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
 	"anvilkit-auth-template/services/admin-api/internal/handler"
 	"anvilkit-auth-template/services/admin-api/internal/rbac"
 	"anvilkit-auth-template/services/admin-api/internal/store"
@@ -123,6 +125,17 @@ func TestMemberManagementEndpoints(t *testing.T) {
 		}
 	})
 
+	t.Run("role change invalidates authz claims", func(t *testing.T) {
+		staleToken, err := ajwt.SignAccessTokenWithAuthz("test-secret-only", "anvilkit-auth", "anvilkit-clients", targetID, tenantID, ajwt.Authz{Roles: []string{"member"}, Version: 1}, time.Hour)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		w := performJSON(r, http.MethodGet, "/api/v1/admin/tenants/"+tenantID+"/members", staleToken, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("want 401 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
 	t.Run("owner can delete member", func(t *testing.T) {
 		w := performJSON(r, http.MethodDelete, "/api/v1/admin/tenants/"+tenantID+"/members/"+targetID, ownerToken, nil)
 		if w.Code != http.StatusOK {
@@ -131,6 +144,19 @@ func TestMemberManagementEndpoints(t *testing.T) {
 	})
 }
 
+const testPlatformAdminID = "00000000-0000-0000-0000-00000000a0a0"
+
+// seedPlatformAdmin creates testPlatformAdminID holding the platform admin
+// role.
+func seedPlatformAdmin(t *testing.T, db *pgxpool.Pool) {
+	t.Helper()
+	if _, err := db.Exec(context.Background(), `
+insert into users(id,email,password_hash,status,platform_role) values ($1,'platform@example.com','hash',1,'admin')
+on conflict (id) do update set platform_role = 'admin'`, testPlatformAdminID); err != nil {
+		t.Fatalf("insert platform admin: %v", err)
+	}
+}
+
 func newTestRouter(t *testing.T, db *pgxpool.Pool) *gin.Engine {
 	t.Helper()
 	gin.SetMode(gin.TestMode)
@@ -138,14 +164,75 @@ func newTestRouter(t *testing.T, db *pgxpool.Pool) *gin.Engine {
 	if err != nil {
 		t.Fatalf("rbac.NewEnforcer: %v", err)
 	}
-	h := &handler.Handler{Store: &store.Store{DB: db}, Enforcer: enforcer}
+	h := &handler.Handler{Store: &store.Store{DB: db}, Enforcer: enforcer, Policies: rbac.NewPolicySets(db, enforcer.GetModel()), Audit: &audit.Log{DB: db}, Webhooks: &webhooks.Publisher{DB: db, Queue: testWebhookQueue}}
 	r := gin.New()
 	r.Use(ginmid.ErrorHandler())
-	admin := r.Group("/api/v1/admin", ginmid.AuthN("test-secret-only", "anvilkit-auth", "anvilkit-clients"), handler.AdminRBAC(h.Store, enforcer))
+	admin := r.Group("/api/v1/admin", ginmid.AuthN("test-secret-only", "anvilkit-auth", "anvilkit-clients"), ginmid.RequireAuthzVersion(h.Store.AuthzVersion), ginmid.RequireActiveImpersonation(h.Store.ImpersonationActive), handler.RejectSuspendedUsers(h.Store), handler.AdminRBAC(h.Store, enforcer))
+	admin.GET("/tenants/:tenantId/me/roles", ginmid.Wrap(h.MeRoles))
+	admin.POST("/tenants/:tenantId/users/:userId/roles/:role", ginmid.Wrap(h.AssignRole))
+	admin.DELETE("/tenants/:tenantId/users/:userId/roles/:role", ginmid.Wrap(h.RevokeRole))
 	admin.GET("/tenants/:tenantId/members", ginmid.Wrap(h.ListMembers))
 	admin.POST("/tenants/:tenantId/members", ginmid.Wrap(h.AddMember))
 	admin.PATCH("/tenants/:tenantId/members/:uid", ginmid.Wrap(h.UpdateMemberRole))
 	admin.DELETE("/tenants/:tenantId/members/:uid", ginmid.Wrap(h.RemoveMember))
+	admin.GET("/tenants/:tenantId/permissions", ginmid.Wrap(h.ListPermissions))
+	admin.GET("/tenants/:tenantId/roles", ginmid.Wrap(h.ListRoles))
+	admin.POST("/tenants/:tenantId/roles", ginmid.Wrap(h.CreateRole))
+	admin.PUT("/tenants/:tenantId/roles/:role", ginmid.Wrap(h.UpdateRole))
+	admin.DELETE("/tenants/:tenantId/roles/:role", ginmid.Wrap(h.DeleteRole))
+	admin.POST("/tenants/:tenantId/rbac/check", ginmid.Wrap(h.CheckRBAC))
+	admin.GET("/tenants/:tenantId/access-rules", ginmid.Wrap(h.GetAccessRules))
+	admin.PUT("/tenants/:tenantId/access-rules", ginmid.DenyImpersonation(), ginmid.Wrap(h.PutAccessRules))
+	admin.GET("/tenants/:tenantId/groups", ginmid.Wrap(h.ListGroups))
+	admin.POST("/tenants/:tenantId/groups", ginmid.Wrap(h.CreateGroup))
+	admin.GET("/tenants/:tenantId/groups/:groupId", ginmid.Wrap(h.GetGroup))
+	admin.PATCH("/tenants/:tenantId/groups/:groupId", ginmid.Wrap(h.UpdateGroup))
+	admin.DELETE("/tenants/:tenantId/groups/:groupId", ginmid.Wrap(h.DeleteGroup))
+	admin.PUT("/tenants/:tenantId/groups/:groupId/members", ginmid.Wrap(h.SetGroupMembers))
+	admin.POST("/tenants/:tenantId/groups/:groupId/members/:userId", ginmid.Wrap(h.AddGroupMember))
+	admin.DELETE("/tenants/:tenantId/groups/:groupId/members/:userId", ginmid.Wrap(h.RemoveGroupMember))
+	admin.GET("/tenants/:tenantId/groups/:groupId/grants", ginmid.Wrap(h.GetGroupGrants))
+	admin.PUT("/tenants/:tenantId/groups/:groupId/grants", ginmid.Wrap(h.PutGroupGrants))
+	admin.GET("/tenants/:tenantId/audit-events", ginmid.Wrap(h.ListAuditEvents))
+	admin.GET("/tenants/:tenantId/webhooks", ginmid.Wrap(h.ListWebhooks))
+	admin.POST("/tenants/:tenantId/webhooks", ginmid.Wrap(h.CreateWebhook))
+	admin.GET("/tenants/:tenantId/webhooks/:webhookId", ginmid.Wrap(h.GetWebhook))
+	admin.PATCH("/tenants/:tenantId/webhooks/:webhookId", ginmid.Wrap(h.UpdateWebhook))
+	admin.DELETE("/tenants/:tenantId/webhooks/:webhookId", ginmid.Wrap(h.DeleteWebhook))
+	admin.POST("/tenants/:tenantId/webhooks/:webhookId/rotate-secret", ginmid.Wrap(h.RotateWebhookSecret))
+	admin.GET("/tenants/:tenantId/webhooks/:webhookId/deliveries", ginmid.Wrap(h.ListWebhookDeliveries))
+	admin.GET("/tenants/:tenantId/webhooks/:webhookId/deliveries/:deliveryId", ginmid.Wrap(h.GetWebhookDelivery))
+	admin.POST("/tenants/:tenantId/webhooks/:webhookId/deliveries/:deliveryId/redeliver", ginmid.Wrap(h.RedeliverWebhook))
+	org := r.Group("/api/v1/admin/org/:orgId", ginmid.AuthN("test-secret-only", "anvilkit-auth", "anvilkit-clients"), ginmid.RequireAuthzVersion(h.Store.AuthzVersion), ginmid.RequireActiveImpersonation(h.Store.ImpersonationActive), handler.RejectSuspendedUsers(h.Store), handler.OrgRBAC(h.Store, enforcer))
+	org.GET("", ginmid.Wrap(h.GetOrganization))
+	org.GET("/tenants", ginmid.Wrap(h.ListOrgTenants))
+	org.POST("/tenants", ginmid.Wrap(h.AddOrgTenant))
+	org.DELETE("/tenants/:tenantId", ginmid.Wrap(h.RemoveOrgTenant))
+	org.GET("/members", ginmid.Wrap(h.ListOrgMembers))
+	org.PUT("/members/:uid", ginmid.Wrap(h.SetOrgMember))
+	org.DELETE("/members/:uid", ginmid.Wrap(h.RemoveOrgMember))
+	platform := r.Group("/api/v1/admin/platform", ginmid.AuthN("test-secret-only", "anvilkit-auth", "anvilkit-clients"), ginmid.DenyImpersonation(), handler.RejectSuspendedUsers(h.Store), ginmid.RequirePlatformAdmin(h.Store.IsPlatformAdmin))
+	platform.GET("/admins", ginmid.Wrap(h.ListPlatformAdmins))
+	platform.PUT("/admins/:userId", ginmid.Wrap(h.GrantPlatformAdmin))
+	platform.DELETE("/admins/:userId", ginmid.Wrap(h.RevokePlatformAdmin))
+	platform.GET("/rbac/policy", ginmid.Wrap(h.ExportPolicy))
+	platform.PUT("/rbac/policy", ginmid.Wrap(h.ApplyPolicy))
+	platform.POST("/rbac/policy/diff", ginmid.Wrap(h.DiffPolicy))
+	platform.GET("/rbac/policy/versions", ginmid.Wrap(h.ListPolicyVersions))
+	platform.GET("/rbac/policy/versions/:version", ginmid.Wrap(h.GetPolicyVersion))
+	platform.POST("/rbac/policy/versions/:version/rollback", ginmid.Wrap(h.RollbackPolicy))
+	platform.POST("/orgs", ginmid.Wrap(h.CreateOrganization))
+	platform.GET("/tenants", ginmid.Wrap(h.SearchTenants))
+	platform.GET("/tenants/:tenantId", ginmid.Wrap(h.GetPlatformTenant))
+	platform.GET("/users", ginmid.Wrap(h.SearchUsers))
+	platform.GET("/users/:userId", ginmid.Wrap(h.GetPlatformUser))
+	platform.POST("/users/:userId/suspend", ginmid.Wrap(h.SuspendUser))
+	platform.POST("/users/:userId/reactivate", ginmid.Wrap(h.ReactivateUser))
+	platform.POST("/users/:userId/logout", ginmid.Wrap(h.ForceLogoutUser))
+	platform.POST("/users/:userId/unlock", ginmid.Wrap(h.UnlockUser))
+	platform.GET("/users/:userId/emails", ginmid.Wrap(h.GetUserEmailDeliveries))
+	platform.GET("/audit-events", ginmid.Wrap(h.ListPlatformAuditEvents))
+	platform.GET("/audit-events/verify", ginmid.Wrap(h.VerifyAuditLog))
 	return r
 }
 
@@ -216,8 +303,8 @@ func mustTestDB(t *testing.T) *pgxpool.Pool {
 func truncateTables(t *testing.T, db *pgxpool.Pool) {
 	t.Helper()
 	testutil.TruncateAuthTables(t, db)
-	if _, err := db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule RESTART IDENTITY`); err != nil {
-		t.Fatalf("truncate casbin_rule: %v", err)
+	if _, err := db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule, casbin_policy_versions RESTART IDENTITY`); err != nil {
+		t.Fatalf("truncate casbin tables: %v", err)
 	}
 }
 
@@ -250,12 +337,12 @@ func seed(t *testing.T, db *pgxpool.Pool, tenantID, ownerID, adminID, memberID,
 	}
 
 	if _, err := db.Exec(context.Background(),
-		`insert into tenant_users(tenant_id,user_id,role) values
-  ($1,$2,'owner'),
-  ($1,$3,'admin'),
-  ($1,$4,'member'),
-  ($1,$5,'member'),
-  ($6,$7,'owner')`,
+		`insert into tenant_users(tenant_id,user_id,roles) values
+  ($1,$2,'{owner}'),
+  ($1,$3,'{admin}'),
+  ($1,$4,'{member}'),
+  ($1,$5,'{member}'),
+  ($6,$7,'{owner}')`,
 		tenantID, ownerID, adminID, memberID, targetID, otherTenantID, otherOwnerID,
 	); err != nil {
 		t.Fatalf("seed tenant_users: %v", err)
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"slices"
+	"time"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/gin-gonic/gin"
@@ -13,7 +15,16 @@ import (
 	"anvilkit-auth-template/services/admin-api/internal/store"
 )
 
-func AdminRBAC(st *store.Store, enforcer *casbin.Enforcer) gin.HandlerFunc {
+func AdminRBAC(st *store.Store, enforcer *casbin.SyncedEnforcer) gin.HandlerFunc {
+	return AdminRBACWithExplain(st, enforcer, false)
+}
+
+// AdminRBACWithExplain is AdminRBAC with an optional debug mode: when explain
+// is set, casbin_denied errors carry one rbac.Decision per member role under
+// "explain", and condition_denied errors the violated rule and the request
+// attributes. It exposes policy details and must not be enabled in
+// production.
+func AdminRBACWithExplain(st *store.Store, enforcer *casbin.SyncedEnforcer, explain bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if enforcer == nil {
 			_ = c.Error(apperr.Forbidden(errors.New("casbin_denied")).WithData(map[string]any{"reason": "casbin_denied", "code": errcode.Forbidden}))
@@ -44,7 +55,7 @@ func AdminRBAC(st *store.Store, enforcer *casbin.Enforcer) gin.HandlerFunc {
 			return
 		}
 
-		tenantRole, exists, err := st.TenantUserRole(c, pathTid, uid)
+		roles, subjects, exists, err := memberSubjects(c, st, enforcer, pathTid, uid)
 		if err != nil {
 			_ = c.Error(err)
 			c.Abort()
@@ -55,32 +66,219 @@ func AdminRBAC(st *store.Store, enforcer *casbin.Enforcer) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-
-		casbinRole, err := rbac.MapTenantRoleToCasbin(tenantRole)
-		if err != nil {
+		if len(subjects) == 0 {
 			_ = c.Error(apperr.Forbidden(errors.New("insufficient_role")).WithData(map[string]any{"reason": "insufficient_role", "code": errcode.Forbidden}))
 			c.Abort()
 			return
 		}
-		obj := c.FullPath()
-		act := c.Request.Method
-		dom := fmt.Sprintf("tenant:%s", pathTid)
-		ok, err := enforcer.Enforce(casbinRole, dom, obj, act)
+		attrs, err := requestAttributes(c, pathTid, roles, tenantMemberRoles(st, enforcer))
 		if err != nil {
 			_ = c.Error(err)
 			c.Abort()
 			return
 		}
-		if !ok {
+		if !authorize(c, enforcer, explain, subjects, rbac.TenantDomain(pathTid), attrs) {
+			return
+		}
+
+		c.Set("rbac_subjects", subjects)
+		c.Next()
+	}
+}
+
+func OrgRBAC(st *store.Store, enforcer *casbin.SyncedEnforcer) gin.HandlerFunc {
+	return OrgRBACWithExplain(st, enforcer, false)
+}
+
+// OrgRBACWithExplain guards the /org/:orgId routes: the caller must be a
+// member of the organization and one of their org roles must allow the
+// request in the org domain.
+func OrgRBACWithExplain(st *store.Store, enforcer *casbin.SyncedEnforcer, explain bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if enforcer == nil {
 			_ = c.Error(apperr.Forbidden(errors.New("casbin_denied")).WithData(map[string]any{"reason": "casbin_denied", "code": errcode.Forbidden}))
 			c.Abort()
 			return
 		}
 
+		uid := c.GetString("uid")
+		if uid == "" {
+			_ = c.Error(apperr.Unauthorized(errors.New("missing_uid")).WithData(map[string]any{"reason": "missing_uid"}))
+			c.Abort()
+			return
+		}
+		orgID := c.Param("orgId")
+		if orgID == "" {
+			_ = c.Error(apperr.BadRequest(errors.New("missing_org_id_param")).WithData(map[string]any{"reason": "missing_org_id_param", "code": errcode.BadRequest}))
+			c.Abort()
+			return
+		}
+
+		roles, exists, err := st.OrgMemberRoles(c, orgID, uid)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if !exists {
+			_ = c.Error(apperr.Forbidden(errors.New("not_in_org")).WithData(map[string]any{"reason": "not_in_org", "code": errcode.Forbidden}))
+			c.Abort()
+			return
+		}
+		subjects := make([]string, 0, len(roles))
+		for _, role := range rbac.SortTenantRoles(roles) {
+			if subject, resolveErr := rbac.MapOrgRoleToCasbin(role); resolveErr == nil {
+				subjects = append(subjects, subject)
+			}
+		}
+		attrs, err := requestAttributes(c, orgID, roles, st.OrgMemberRoles)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if !authorize(c, enforcer, explain, subjects, rbac.OrgDomain(orgID), attrs) {
+			return
+		}
+
+		c.Set("rbac_subjects", subjects)
 		c.Next()
 	}
 }
 
+// memberSubjects resolves the Casbin subjects of uid in a tenant: the roles
+// the user holds as a member, the roles granted to their groups (following
+// group nesting), the groups themselves, which may hold permissions directly,
+// and their roles in the tenant's organization. roles are the role names the
+// subjects stem from; ok reports whether uid is a member of the tenant or of
+// its organization.
+func memberSubjects(ctx context.Context, st *store.Store, enforcer *casbin.SyncedEnforcer, tid, uid string) (roles, subjects []string, ok bool, err error) {
+	memberRoles, exists, err := st.MemberRoles(ctx, tid, uid)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	orgRoles, err := st.TenantOrgRoles(ctx, tid, uid)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !exists && len(orgRoles) == 0 {
+		return nil, nil, false, nil
+	}
+	var groupIDs []string
+	if exists {
+		if groupIDs, err = st.UserGroupIDs(ctx, tid, uid); err != nil {
+			return nil, nil, false, err
+		}
+		groupRoles, err := rbac.GroupRoles(enforcer, tid, groupIDs)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		memberRoles = append(memberRoles, groupRoles...)
+	}
+
+	// A role that no longer resolves (e.g. a deleted custom role) grants
+	// nothing; the member's other roles still apply.
+	for _, role := range rbac.SortTenantRoles(memberRoles) {
+		if subject, resolveErr := rbac.ResolveTenantRole(enforcer, tid, role); resolveErr == nil {
+			subjects = append(subjects, subject)
+		}
+	}
+	for _, groupID := range groupIDs {
+		subjects = append(subjects, rbac.GroupSubject(groupID))
+	}
+	// Roles in the parent organization apply through the tenant's domain
+	// link.
+	for _, role := range rbac.SortTenantRoles(orgRoles) {
+		if subject, resolveErr := rbac.MapOrgRoleToCasbin(role); resolveErr == nil {
+			subjects = append(subjects, subject)
+		}
+	}
+	return slices.Concat(memberRoles, orgRoles), subjects, true, nil
+}
+
+// authorize enforces the request for each subject in dom. A subject must both
+// be allowed by the role policy and pass the access conditions that apply to
+// it. On denial it records the error, aborts and returns false.
+func authorize(c *gin.Context, enforcer *casbin.SyncedEnforcer, explain bool, subjects []string, dom string, attrs rbac.Attributes) bool {
+	obj := c.FullPath()
+	act := c.Request.Method
+	var violated []string
+	for _, subject := range subjects {
+		ok, err := enforcer.Enforce(subject, dom, obj, act)
+		if err == nil && ok {
+			ok, violated, err = rbac.CheckConditions(enforcer, subject, dom, obj, act, attrs)
+		}
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return false
+		}
+		if ok {
+			return true
+		}
+	}
+	if violated != nil {
+		data := map[string]any{"reason": "condition_denied", "code": errcode.Forbidden}
+		if explain {
+			data["explain"] = map[string]any{"condition": violated, "attributes": attrs}
+		}
+		_ = c.Error(apperr.Forbidden(errors.New("condition_denied")).WithData(data))
+		c.Abort()
+		return false
+	}
+	data := map[string]any{"reason": "casbin_denied", "code": errcode.Forbidden}
+	if explain {
+		decisions := make([]rbac.Decision, 0, len(subjects))
+		for _, subject := range subjects {
+			if decision, explainErr := rbac.Explain(enforcer, subject, dom, obj, act); explainErr == nil {
+				decisions = append(decisions, decision)
+			}
+		}
+		data["explain"] = decisions
+	}
+	_ = c.Error(apperr.Forbidden(errors.New("casbin_denied")).WithData(data))
+	c.Abort()
+	return false
+}
+
+// memberRolesLookup returns the roles a user holds in a tenant or an
+// organization.
+type memberRolesLookup func(ctx context.Context, scopeID, userID string) ([]string, bool, error)
+
+// tenantMemberRoles looks up every role a user holds in a tenant, including
+// through groups and the tenant's organization, as memberSubjects does for
+// the caller, so that caller and target are ranked alike.
+func tenantMemberRoles(st *store.Store, enforcer *casbin.SyncedEnforcer) memberRolesLookup {
+	return func(ctx context.Context, tid, uid string) ([]string, bool, error) {
+		roles, _, ok, err := memberSubjects(ctx, st, enforcer, tid, uid)
+		return roles, ok, err
+	}
+}
+
+// requestAttributes collects the attributes access conditions are evaluated
+// against. The target member is the one named by the :uid or :userId route
+// parameter, if any, looked up in the same tenant or organization.
+func requestAttributes(c *gin.Context, scopeID string, callerRoles []string, targetRoles memberRolesLookup) (rbac.Attributes, error) {
+	attrs := rbac.Attributes{
+		CallerRank: rbac.HighestRank(callerRoles),
+		TargetRank: rbac.RankNone,
+		IP:         c.ClientIP(),
+		Time:       time.Now(),
+	}
+	target := c.Param("uid")
+	if target == "" {
+		target = c.Param("userId")
+	}
+	if target != "" {
+		roles, _, err := targetRoles(c, scopeID, target)
+		if err != nil {
+			return rbac.Attributes{}, err
+		}
+		attrs.TargetRank = rbac.HighestRank(roles)
+	}
+	return attrs, nil
+}
+
 func tenantIDFromPath(c *gin.Context) string {
 	if tid := c.Param("tid"); tid != "" {
 		return tid
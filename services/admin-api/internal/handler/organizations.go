@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/errcode"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
+	"anvilkit-auth-template/services/admin-api/internal/store"
+)
+
+type organizationItem struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type tenantItem struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type createOrganizationReq struct {
+	Name        string `json:"name"`
+	OwnerUserID string `json:"owner_user_id"`
+}
+
+// orgTenantReq either creates a tenant (name) or attaches an existing one
+// (tenant_id).
+type orgTenantReq struct {
+	Name     string `json:"name"`
+	TenantID string `json:"tenant_id"`
+}
+
+type orgMemberReq struct {
+	Roles []string `json:"roles"`
+}
+
+// CreateOrganization creates an organization with its first owner.
+func (h *Handler) CreateOrganization(c *gin.Context) error {
+	var req createOrganizationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return apperr.BadRequest(errors.New("missing_name")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	if err := validateUserID(req.OwnerUserID); err != nil {
+		return err
+	}
+	exists, err := h.Store.UserExists(c, req.OwnerUserID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return apperr.NotFound(errors.New("user_not_found")).WithData(map[string]any{"reason": "user_not_found"})
+	}
+
+	org, err := h.Store.CreateOrganization(c, name, req.OwnerUserID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return apperr.Conflict(err).WithData(map[string]any{"reason": "org_exists"})
+		}
+		return err
+	}
+	if err = rbac.LinkOrganization(h.Enforcer, org.ID); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionOrganizationCreate, "", "organization", org.ID, map[string]any{"name": org.Name, "owner_user_id": req.OwnerUserID})
+	resp.OK(c, organizationItem{ID: org.ID, Name: org.Name, CreatedAt: org.CreatedAt})
+	return nil
+}
+
+func (h *Handler) GetOrganization(c *gin.Context) error {
+	org, found, err := h.Store.Organization(c, c.Param("orgId"))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperr.NotFound(errors.New("org_not_found")).WithData(map[string]any{"reason": "org_not_found"})
+	}
+	resp.OK(c, organizationItem{ID: org.ID, Name: org.Name, CreatedAt: org.CreatedAt})
+	return nil
+}
+
+func (h *Handler) ListOrgTenants(c *gin.Context) error {
+	tenants, err := h.Store.ListOrgTenants(c, c.Param("orgId"))
+	if err != nil {
+		return err
+	}
+	items := make([]tenantItem, 0, len(tenants))
+	for _, t := range tenants {
+		items = append(items, tenantItem{ID: t.ID, Name: t.Name, CreatedAt: t.CreatedAt})
+	}
+	resp.OK(c, map[string]any{"tenants": items})
+	return nil
+}
+
+// AddOrgTenant creates a tenant in the organization or attaches an existing
+// tenant the caller owns.
+func (h *Handler) AddOrgTenant(c *gin.Context) error {
+	orgID := c.Param("orgId")
+	var req orgTenantReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	name := strings.TrimSpace(req.Name)
+	tid := strings.TrimSpace(req.TenantID)
+	if (name == "") == (tid == "") {
+		return apperr.BadRequest(errors.New("name_or_tenant_id_required")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+
+	var tenant store.TenantDTO
+	if name != "" {
+		var err error
+		if tenant, err = h.Store.CreateOrgTenant(c, orgID, name); err != nil {
+			return orgTenantError(err)
+		}
+	} else {
+		roles, _, err := h.Store.MemberRoles(c, tid, c.GetString("uid"))
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(roles, "owner") {
+			return apperr.Forbidden(errors.New("tenant_owner_required")).WithData(map[string]any{"reason": "tenant_owner_required", "code": errcode.Forbidden})
+		}
+		found, err := h.Store.AttachTenant(c, orgID, tid)
+		if err != nil {
+			return orgTenantError(err)
+		}
+		if !found {
+			return apperr.NotFound(errors.New("tenant_not_found")).WithData(map[string]any{"reason": "tenant_not_found"})
+		}
+		tenant.ID = tid
+	}
+	if err := rbac.AttachTenant(h.Enforcer, tenant.ID, orgID); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionOrgTenantAttach, tenant.ID, "organization", orgID, map[string]any{"created": name != ""})
+	resp.OK(c, map[string]any{"tenant_id": tenant.ID})
+	return nil
+}
+
+// RemoveOrgTenant detaches a tenant from the organization. The tenant and its
+// own members are kept.
+func (h *Handler) RemoveOrgTenant(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	removed, err := h.Store.DetachTenant(c, c.Param("orgId"), tid)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return apperr.NotFound(errors.New("tenant_not_found")).WithData(map[string]any{"reason": "tenant_not_found"})
+	}
+	if err = rbac.DetachTenant(h.Enforcer, tid); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionOrgTenantDetach, tid, "organization", c.Param("orgId"), nil)
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+func (h *Handler) ListOrgMembers(c *gin.Context) error {
+	members, err := h.Store.ListOrgMembers(c, c.Param("orgId"))
+	if err != nil {
+		return err
+	}
+	items := make([]memberItem, 0, len(members))
+	for _, m := range members {
+		items = append(items, memberItem{UserID: m.UserID, Email: m.Email, Roles: rbac.SortTenantRoles(m.Roles), CreatedAt: m.CreatedAt})
+	}
+	resp.OK(c, listMembersResp{Members: items})
+	return nil
+}
+
+// SetOrgMember adds a user to the organization or replaces their org roles.
+// Only owners may grant the owner role.
+func (h *Handler) SetOrgMember(c *gin.Context) error {
+	orgID := c.Param("orgId")
+	targetUID := c.Param("uid")
+	if err := validateUserID(targetUID); err != nil {
+		return err
+	}
+	var req orgMemberReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	roles := rbac.SortTenantRoles(req.Roles)
+	if len(roles) == 0 {
+		return apperr.BadRequest(errors.New("missing_roles")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	for _, role := range roles {
+		if !rbac.IsOrgRole(role) {
+			return apperr.BadRequest(fmt.Errorf("invalid role: %s", role)).WithData(map[string]any{"reason": "invalid_argument"})
+		}
+	}
+	if slices.Contains(roles, "owner") && !slices.Contains(rbacSubjects(c), rbac.OrgRoleOwner) {
+		return apperr.Forbidden(errors.New("role_not_assignable")).WithData(map[string]any{"reason": "role_not_assignable", "code": errcode.Forbidden})
+	}
+
+	exists, err := h.Store.UserExists(c, targetUID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return apperr.NotFound(errors.New("user_not_found")).WithData(map[string]any{"reason": "user_not_found"})
+	}
+	if err = h.Store.SetOrgMemberRoles(c, orgID, targetUID, roles); err != nil {
+		return orgMemberError(err)
+	}
+	h.audit(c, audit.ActionOrgMemberUpdate, "", "user", targetUID, map[string]any{"org_id": orgID, "roles": roles})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+func (h *Handler) RemoveOrgMember(c *gin.Context) error {
+	targetUID := c.Param("uid")
+	if err := validateUserID(targetUID); err != nil {
+		return err
+	}
+	removed, err := h.Store.RemoveOrgMember(c, c.Param("orgId"), targetUID)
+	if err != nil {
+		return orgMemberError(err)
+	}
+	if !removed {
+		return apperr.NotFound(errors.New("member_not_found")).WithData(map[string]any{"reason": "member_not_found"})
+	}
+	h.audit(c, audit.ActionOrgMemberRemove, "", "user", targetUID, map[string]any{"org_id": c.Param("orgId")})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+func orgTenantError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrTenantNameConflict):
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "tenant_name_conflict"})
+	case errors.Is(err, store.ErrTenantInOtherOrg):
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "tenant_in_other_org"})
+	default:
+		return err
+	}
+}
+
+func orgMemberError(err error) error {
+	if errors.Is(err, store.ErrLastOrgOwner) {
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "last_org_owner"})
+	}
+	return err
+}
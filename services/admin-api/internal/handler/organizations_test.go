@@ -0,0 +1,132 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestOrganizationEndpoints(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	otherTenantID := "tenant-beta"
+	ownerID := uuid.NewString()
+	memberID := uuid.NewString()
+	orgAdminID := uuid.NewString()
+	seed(t, db, tenantID, ownerID, uuid.NewString(), memberID, uuid.NewString(), otherTenantID, uuid.NewString())
+	if _, err := db.Exec(context.Background(), `insert into users(id,email,password_hash) values ($1,'org-admin@example.com','hash')`, orgAdminID); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	seedPlatformAdmin(t, db)
+
+	r := newTestRouter(t, db)
+	ownerToken := mustAccessToken(t, ownerID, nil)
+	orgAdminToken := mustAccessToken(t, orgAdminID, nil)
+
+	w := performJSON(r, http.MethodPost, "/api/v1/admin/platform/orgs", mustAccessToken(t, testPlatformAdminID, nil), map[string]string{"name": "Acme Group", "owner_user_id": ownerID})
+	if w.Code != http.StatusOK {
+		t.Fatalf("create org: want 200 got %d body=%s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	orgPath := "/api/v1/admin/org/" + created.Data.ID
+
+	t.Run("owner attaches a tenant they own", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, orgPath+"/tenants", ownerToken, map[string]string{"tenant_id": tenantID})
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = performJSON(r, http.MethodPost, orgPath+"/tenants", ownerToken, map[string]string{"tenant_id": otherTenantID})
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("attach foreign tenant: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "tenant_owner_required")
+	})
+
+	t.Run("org roles inherit into child tenants", func(t *testing.T) {
+		if w := performJSON(r, http.MethodPut, orgPath+"/members/"+orgAdminID, ownerToken, map[string]any{"roles": []string{"admin"}}); w.Code != http.StatusOK {
+			t.Fatalf("add org admin: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodGet, "/api/v1/admin/tenants/"+tenantID+"/members", orgAdminToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("child tenant: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w := performJSON(r, http.MethodGet, "/api/v1/admin/tenants/"+otherTenantID+"/members", orgAdminToken, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("unrelated tenant: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "not_in_tenant")
+	})
+
+	t.Run("org admins cannot manage owners", func(t *testing.T) {
+		w := performJSON(r, http.MethodPut, orgPath+"/members/"+ownerID, orgAdminToken, map[string]any{"roles": []string{"admin"}})
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "condition_denied")
+
+		w = performJSON(r, http.MethodPut, orgPath+"/members/"+memberID, orgAdminToken, map[string]any{"roles": []string{"owner"}})
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("grant owner: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "role_not_assignable")
+	})
+
+	t.Run("org admin creates and lists tenants", func(t *testing.T) {
+		if w := performJSON(r, http.MethodPost, orgPath+"/tenants", orgAdminToken, map[string]string{"name": "Tenant C"}); w.Code != http.StatusOK {
+			t.Fatalf("create tenant: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w := performJSON(r, http.MethodGet, orgPath+"/tenants", orgAdminToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list tenants: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				Tenants []struct {
+					ID string `json:"id"`
+				} `json:"tenants"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(env.Data.Tenants) != 2 {
+			t.Fatalf("tenants=%v want 2", env.Data.Tenants)
+		}
+	})
+
+	t.Run("last owner stays", func(t *testing.T) {
+		w := performJSON(r, http.MethodDelete, orgPath+"/members/"+ownerID, ownerToken, nil)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "last_org_owner")
+	})
+
+	t.Run("non-members are rejected", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, orgPath, mustAccessToken(t, memberID, nil), nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "not_in_org")
+	})
+
+	t.Run("detached tenants lose org access", func(t *testing.T) {
+		if w := performJSON(r, http.MethodDelete, orgPath+"/tenants/"+tenantID, ownerToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("detach: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodGet, "/api/v1/admin/tenants/"+tenantID+"/members", orgAdminToken, nil); w.Code != http.StatusForbidden {
+			t.Fatalf("after detach: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+}
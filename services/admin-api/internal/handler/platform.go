@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/services/admin-api/internal/store"
+)
+
+// RejectSuspendedUsers rejects requests from users a platform admin has
+// suspended. Suspending revokes refresh sessions and invalidates tenant
+// tokens, but an access token issued before the suspension is otherwise
+// valid until it expires. It must run after AuthN.
+func RejectSuspendedUsers(st *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		suspended, err := st.UserSuspended(c, c.GetString("uid"))
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if suspended {
+			_ = c.Error(apperr.Unauthorized(errors.New("user_suspended")).WithData(map[string]any{"reason": "user_suspended"}))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListPlatformAdmins lists the users holding the platform admin role.
+func (h *Handler) ListPlatformAdmins(c *gin.Context) error {
+	admins, err := h.Store.ListPlatformAdmins(c)
+	if err != nil {
+		return err
+	}
+	items := make([]platformUserItem, 0, len(admins))
+	for _, u := range admins {
+		items = append(items, toPlatformUserItem(u))
+	}
+	resp.OK(c, map[string]any{"admins": items})
+	return nil
+}
+
+// GrantPlatformAdmin gives a user the platform admin role. Granting it to a
+// platform admin changes nothing and is not audited.
+func (h *Handler) GrantPlatformAdmin(c *gin.Context) error {
+	uid := c.Param("userId")
+	found, granted, err := h.Store.GrantPlatformAdmin(c, uid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return userNotFound()
+	}
+	if granted {
+		h.audit(c, audit.ActionPlatformAdminGrant, "", "user", uid, nil)
+	}
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// RevokePlatformAdmin takes the platform admin role from a user. The last
+// active platform admin cannot be revoked.
+func (h *Handler) RevokePlatformAdmin(c *gin.Context) error {
+	uid := c.Param("userId")
+	held, err := h.Store.RevokePlatformAdmin(c, uid)
+	if errors.Is(err, store.ErrLastPlatformAdmin) {
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "last_platform_admin"})
+	}
+	if err != nil {
+		return err
+	}
+	if !held {
+		return apperr.NotFound(errors.New("not_platform_admin")).WithData(map[string]any{"reason": "not_platform_admin"})
+	}
+	h.audit(c, audit.ActionPlatformAdminRevoke, "", "user", uid, nil)
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
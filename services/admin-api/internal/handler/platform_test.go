@@ -0,0 +1,105 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlatformAdminEndpoints(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+	seedPlatformAdmin(t, db)
+	userID := uuid.NewString()
+	if _, err := db.Exec(context.Background(), `insert into users(id,email,password_hash,status) values ($1,'support@example.com','hash',1)`, userID); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	r := newTestRouter(t, db)
+	platformToken := mustAccessToken(t, testPlatformAdminID, nil)
+	userToken := mustAccessToken(t, userID, nil)
+	adminsPath := "/api/v1/admin/platform/admins"
+	auditCount := func(t *testing.T, action string) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(context.Background(), `select count(*) from audit_events where action = $1 and target_id = $2`, action, userID).Scan(&n); err != nil {
+			t.Fatalf("count audit events: %v", err)
+		}
+		return n
+	}
+
+	t.Run("other users are not platform admins", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, adminsPath, userToken, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "not_platform_admin")
+	})
+
+	t.Run("grant", func(t *testing.T) {
+		for range 2 {
+			if w := performJSON(r, http.MethodPut, adminsPath+"/"+userID, platformToken, nil); w.Code != http.StatusOK {
+				t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+			}
+		}
+		if n := auditCount(t, "platform_admin.grant"); n != 1 {
+			t.Fatalf("grant audit events=%d want 1", n)
+		}
+
+		w := performJSON(r, http.MethodGet, adminsPath, userToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				Admins []struct {
+					ID string `json:"id"`
+				} `json:"admins"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(env.Data.Admins) != 2 {
+			t.Fatalf("admins=%+v want 2", env.Data.Admins)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		w := performJSON(r, http.MethodPut, adminsPath+"/"+uuid.NewString(), platformToken, nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("want 404 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "user_not_found")
+	})
+
+	t.Run("revoke takes effect at once", func(t *testing.T) {
+		if w := performJSON(r, http.MethodDelete, adminsPath+"/"+userID, platformToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if n := auditCount(t, "platform_admin.revoke"); n != 1 {
+			t.Fatalf("revoke audit events=%d want 1", n)
+		}
+		w := performJSON(r, http.MethodGet, adminsPath, userToken, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+
+		w = performJSON(r, http.MethodDelete, adminsPath+"/"+userID, platformToken, nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("want 404 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "not_platform_admin")
+	})
+
+	t.Run("last platform admin", func(t *testing.T) {
+		w := performJSON(r, http.MethodDelete, adminsPath+"/"+testPlatformAdminID, platformToken, nil)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "last_platform_admin")
+	})
+}
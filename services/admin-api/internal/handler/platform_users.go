@@ -0,0 +1,388 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/services/admin-api/internal/store"
+)
+
+const (
+	defaultPlatformPageSize = 50
+	maxPlatformPageSize     = 200
+	platformEmailLimit      = 50
+)
+
+type platformTenantItem struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Slug        *string   `json:"slug"`
+	Status      int16     `json:"status"`
+	OrgID       *string   `json:"org_id"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type platformTenantDetail struct {
+	platformTenantItem
+	Members []memberItem `json:"members"`
+}
+
+type platformUserItem struct {
+	ID               string     `json:"id"`
+	Email            *string    `json:"email"`
+	Status           string     `json:"status"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	SuspendedAt      *time.Time `json:"suspended_at"`
+	SuspensionReason *string    `json:"suspension_reason"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type platformUserDetail struct {
+	platformUserItem
+	Memberships    []userMembershipItem `json:"memberships"`
+	ActiveSessions int                  `json:"active_sessions"`
+}
+
+type userMembershipItem struct {
+	TenantID   string    `json:"tenant_id"`
+	TenantName string    `json:"tenant_name"`
+	Roles      []string  `json:"roles"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type emailDeliveryItem struct {
+	ID         string            `json:"id"`
+	ToEmail    string            `json:"to_email"`
+	Template   *string           `json:"template"`
+	Subject    *string           `json:"subject"`
+	ExternalID *string           `json:"external_id"`
+	Provider   *string           `json:"provider"`
+	Status     string            `json:"status"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	History    []emailStatusItem `json:"history"`
+}
+
+type emailStatusItem struct {
+	Status    string         `json:"status"`
+	Message   *string        `json:"message"`
+	Meta      map[string]any `json:"meta"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type suspendUserReq struct {
+	Reason string `json:"reason"`
+}
+
+// userStatusNames maps users.status to the names the platform API uses.
+var userStatusNames = map[int16]string{
+	store.UserStatusPending:   "pending_verification",
+	store.UserStatusActive:    "active",
+	store.UserStatusSuspended: "suspended",
+}
+
+// SearchTenants lists tenants across the platform. ?q= matches a tenant ID or
+// part of a name or slug; ?limit= and ?offset= page through the results.
+func (h *Handler) SearchTenants(c *gin.Context) error {
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+	tenants, hasMore, err := h.Store.SearchTenants(c, strings.TrimSpace(c.Query("q")), limit, offset)
+	if err != nil {
+		return err
+	}
+	items := make([]platformTenantItem, 0, len(tenants))
+	for _, t := range tenants {
+		items = append(items, toPlatformTenantItem(t))
+	}
+	resp.OK(c, map[string]any{"tenants": items, "has_more": hasMore})
+	return nil
+}
+
+// GetPlatformTenant returns a tenant of any organization with its members.
+func (h *Handler) GetPlatformTenant(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	t, found, err := h.Store.PlatformTenant(c, tid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperr.NotFound(errors.New("tenant_not_found")).WithData(map[string]any{"reason": "tenant_not_found"})
+	}
+	members, err := h.Store.ListMembers(c, tid)
+	if err != nil {
+		return err
+	}
+	detail := platformTenantDetail{platformTenantItem: toPlatformTenantItem(t), Members: make([]memberItem, 0, len(members))}
+	for _, m := range members {
+		detail.Members = append(detail.Members, memberItem{UserID: m.UserID, Email: m.Email, Roles: m.Roles, CreatedAt: m.CreatedAt})
+	}
+	resp.OK(c, detail)
+	return nil
+}
+
+// SearchUsers lists users across the platform. ?q= matches a user ID or part
+// of an email; ?status= is one of pending_verification, active or suspended.
+func (h *Handler) SearchUsers(c *gin.Context) error {
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+	var status *int16
+	if name := strings.TrimSpace(c.Query("status")); name != "" {
+		s, ok := parseUserStatus(name)
+		if !ok {
+			return apperr.BadRequest(errors.New("invalid_status")).WithData(map[string]any{"reason": "invalid_argument"})
+		}
+		status = &s
+	}
+	users, hasMore, err := h.Store.SearchUsers(c, strings.TrimSpace(c.Query("q")), status, limit, offset)
+	if err != nil {
+		return err
+	}
+	items := make([]platformUserItem, 0, len(users))
+	for _, u := range users {
+		items = append(items, toPlatformUserItem(u))
+	}
+	resp.OK(c, map[string]any{"users": items, "has_more": hasMore})
+	return nil
+}
+
+// GetPlatformUser returns a user with their tenant memberships and the number
+// of refresh sessions they have open.
+func (h *Handler) GetPlatformUser(c *gin.Context) error {
+	uid := c.Param("userId")
+	u, found, err := h.Store.PlatformUser(c, uid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return userNotFound()
+	}
+	memberships, err := h.Store.UserMemberships(c, uid)
+	if err != nil {
+		return err
+	}
+	sessions, err := h.Store.ActiveSessionCount(c, uid)
+	if err != nil {
+		return err
+	}
+	detail := platformUserDetail{platformUserItem: toPlatformUserItem(u), Memberships: make([]userMembershipItem, 0, len(memberships)), ActiveSessions: sessions}
+	for _, m := range memberships {
+		detail.Memberships = append(detail.Memberships, userMembershipItem{TenantID: m.TenantID, TenantName: m.TenantName, Roles: m.Roles, CreatedAt: m.CreatedAt})
+	}
+	resp.OK(c, detail)
+	return nil
+}
+
+// SuspendUser blocks a user from logging in and logs them out everywhere.
+// Suspending a suspended user updates the reason.
+func (h *Handler) SuspendUser(c *gin.Context) error {
+	uid := c.Param("userId")
+	var req suspendUserReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return apperr.BadRequest(errors.New("missing_reason")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	if uid == c.GetString("uid") {
+		return apperr.BadRequest(errors.New("cannot_suspend_self")).WithData(map[string]any{"reason": "cannot_suspend_self"})
+	}
+
+	found, revoked, err := h.Store.SuspendUser(c, uid, reason)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return userNotFound()
+	}
+	h.audit(c, audit.ActionUserSuspend, "", "user", uid, map[string]any{"reason": reason, "revoked_sessions": revoked})
+	resp.OK(c, map[string]any{"ok": true, "revoked_sessions": revoked})
+	return nil
+}
+
+func (h *Handler) ReactivateUser(c *gin.Context) error {
+	uid := c.Param("userId")
+	found, err := h.Store.ReactivateUser(c, uid)
+	if errors.Is(err, store.ErrUserNotSuspended) {
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "user_not_suspended"})
+	}
+	if err != nil {
+		return err
+	}
+	if !found {
+		return userNotFound()
+	}
+	h.audit(c, audit.ActionUserReactivate, "", "user", uid, nil)
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// ForceLogoutUser revokes all of a user's refresh sessions and invalidates
+// their tenant-scoped access tokens.
+func (h *Handler) ForceLogoutUser(c *gin.Context) error {
+	uid := c.Param("userId")
+	if err := h.ensurePlatformUser(c, uid); err != nil {
+		return err
+	}
+	revoked, err := h.Store.RevokeUserSessions(c, uid)
+	if err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionUserForceLogout, "", "user", uid, map[string]any{"revoked_sessions": revoked})
+	resp.OK(c, map[string]any{"ok": true, "revoked_sessions": revoked})
+	return nil
+}
+
+// UnlockUser clears the failed-login counters that lock a user out of
+// password login, from every client IP.
+func (h *Handler) UnlockUser(c *gin.Context) error {
+	uid := c.Param("userId")
+	email, found, err := h.Store.UserEmail(c, uid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return userNotFound()
+	}
+	if h.Redis == nil {
+		return errors.New("redis is not configured")
+	}
+	cleared := 0
+	if email != "" {
+		if cleared, err = h.clearLoginFailures(c, email); err != nil {
+			return err
+		}
+	}
+	h.audit(c, audit.ActionUserUnlock, "", "user", uid, map[string]any{"cleared": cleared})
+	resp.OK(c, map[string]any{"ok": true, "cleared": cleared})
+	return nil
+}
+
+// GetUserEmailDeliveries lists the latest emails sent to a user with their
+// delivery history, and whether their address is blacklisted after a bounce.
+func (h *Handler) GetUserEmailDeliveries(c *gin.Context) error {
+	uid := c.Param("userId")
+	email, found, err := h.Store.UserEmail(c, uid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return userNotFound()
+	}
+	deliveries, err := h.Store.UserEmailDeliveries(c, uid, platformEmailLimit)
+	if err != nil {
+		return err
+	}
+	blacklisted, reason, err := h.Store.EmailBlacklisted(c, email)
+	if err != nil {
+		return err
+	}
+
+	items := make([]emailDeliveryItem, 0, len(deliveries))
+	for _, d := range deliveries {
+		item := emailDeliveryItem{ID: d.ID, ToEmail: d.ToEmail, Template: d.Template, Subject: d.Subject, ExternalID: d.ExternalID, Provider: d.Provider, Status: d.Status, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt, History: make([]emailStatusItem, 0, len(d.History))}
+		for _, s := range d.History {
+			item.History = append(item.History, emailStatusItem{Status: s.Status, Message: s.Message, Meta: s.Meta, CreatedAt: s.CreatedAt})
+		}
+		items = append(items, item)
+	}
+	blacklist := map[string]any{"blacklisted": blacklisted}
+	if blacklisted {
+		blacklist["reason"] = reason
+	}
+	resp.OK(c, map[string]any{"email": email, "blacklist": blacklist, "deliveries": items})
+	return nil
+}
+
+// loginFailKeyPattern matches auth-api's failed-login counters for an email
+// across client IPs. auth-api keys them login_fail:<ip>:<lowercased email>.
+func loginFailKeyPattern(email string) string {
+	return "login_fail:*:" + escapeGlob(strings.ToLower(email))
+}
+
+func (h *Handler) clearLoginFailures(ctx context.Context, email string) (int, error) {
+	cleared := 0
+	iter := h.Redis.Scan(ctx, 0, loginFailKeyPattern(email), 100).Iterator()
+	for iter.Next(ctx) {
+		n, err := h.Redis.Del(ctx, iter.Val()).Result()
+		if err != nil {
+			return cleared, err
+		}
+		cleared += int(n)
+	}
+	return cleared, iter.Err()
+}
+
+// escapeGlob escapes the characters Redis MATCH patterns treat specially.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (h *Handler) ensurePlatformUser(c *gin.Context, uid string) error {
+	_, found, err := h.Store.UserEmail(c, uid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return userNotFound()
+	}
+	return nil
+}
+
+func parsePage(c *gin.Context) (int, int, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPlatformPageSize)))
+	if err != nil || limit <= 0 || limit > maxPlatformPageSize {
+		return 0, 0, apperr.BadRequest(errors.New("invalid_limit")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		return 0, 0, apperr.BadRequest(errors.New("invalid_offset")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	return limit, offset, nil
+}
+
+func parseUserStatus(name string) (int16, bool) {
+	for status, n := range userStatusNames {
+		if n == name {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+func toPlatformTenantItem(t store.PlatformTenantDTO) platformTenantItem {
+	return platformTenantItem{ID: t.ID, Name: t.Name, Slug: t.Slug, Status: t.Status, OrgID: t.OrgID, MemberCount: t.MemberCount, CreatedAt: t.CreatedAt}
+}
+
+func toPlatformUserItem(u store.PlatformUserDTO) platformUserItem {
+	status, ok := userStatusNames[u.Status]
+	if !ok {
+		status = strconv.Itoa(int(u.Status))
+	}
+	return platformUserItem{ID: u.ID, Email: u.Email, Status: status, EmailVerifiedAt: u.EmailVerifiedAt, SuspendedAt: u.SuspendedAt, SuspensionReason: u.SuspensionReason, CreatedAt: u.CreatedAt}
+}
+
+func userNotFound() error {
+	return apperr.NotFound(errors.New("user_not_found")).WithData(map[string]any{"reason": "user_not_found"})
+}
@@ -0,0 +1,209 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlatformUserEndpoints(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	memberID := uuid.NewString()
+	seed(t, db, tenantID, ownerID, uuid.NewString(), memberID, uuid.NewString(), "tenant-beta", uuid.NewString())
+	ctx := context.Background()
+	seedPlatformAdmin(t, db)
+	if _, err := db.Exec(ctx, `
+insert into refresh_sessions(id, user_id, token_hash, expires_at)
+values ($1, $2, 'hash-1', now() + interval '1 day'), ($3, $2, 'hash-2', now() + interval '1 day')`, uuid.NewString(), memberID, uuid.NewString()); err != nil {
+		t.Fatalf("insert refresh sessions: %v", err)
+	}
+	recordID := uuid.NewString()
+	if _, err := db.Exec(ctx, `
+insert into email_records(id, user_id, to_email, template, status, external_id, provider)
+values ($1, $2, 'member@example.com', 'verification', 'bounced', 'ext-1', 'sendgrid')`, recordID, memberID); err != nil {
+		t.Fatalf("insert email record: %v", err)
+	}
+	if _, err := db.Exec(ctx, `
+insert into email_status_history(id, email_record_id, status, message, created_at)
+values ($1, $3, 'sent', null, now() - interval '1 minute'), ($2, $3, 'bounced', 'mailbox full', now())`, uuid.NewString(), uuid.NewString(), recordID); err != nil {
+		t.Fatalf("insert email history: %v", err)
+	}
+	if _, err := db.Exec(ctx, `insert into email_blacklist(id, email, reason) values ($1, 'member@example.com', 'hard_bounce')`, uuid.NewString()); err != nil {
+		t.Fatalf("insert blacklist: %v", err)
+	}
+
+	r := newTestRouter(t, db)
+	platformToken := mustAccessToken(t, testPlatformAdminID, nil)
+	memberToken := mustAccessToken(t, memberID, nil)
+	userPath := "/api/v1/admin/platform/users/" + memberID
+
+	t.Run("tenant admins are not platform admins", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, "/api/v1/admin/platform/users", mustAccessToken(t, ownerID, nil), nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "not_platform_admin")
+	})
+
+	t.Run("search tenants", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, "/api/v1/admin/platform/tenants?q=tenant%20a&limit=1", platformToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				Tenants []struct {
+					ID          string `json:"id"`
+					MemberCount int    `json:"member_count"`
+				} `json:"tenants"`
+				HasMore bool `json:"has_more"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(env.Data.Tenants) != 1 || env.Data.Tenants[0].ID != tenantID || env.Data.Tenants[0].MemberCount != 4 || env.Data.HasMore {
+			t.Fatalf("tenants=%+v has_more=%v", env.Data.Tenants, env.Data.HasMore)
+		}
+	})
+
+	t.Run("suspend logs the user out", func(t *testing.T) {
+		if w := performJSON(r, http.MethodGet, "/api/v1/admin/tenants/"+tenantID+"/me/roles", memberToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("before suspend: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w := performJSON(r, http.MethodPost, userPath+"/suspend", platformToken, map[string]any{"reason": "abuse report"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("suspend: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				RevokedSessions int `json:"revoked_sessions"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if env.Data.RevokedSessions != 2 {
+			t.Fatalf("revoked_sessions=%d want 2", env.Data.RevokedSessions)
+		}
+
+		w = performJSON(r, http.MethodGet, "/api/v1/admin/tenants/"+tenantID+"/me/roles", memberToken, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("after suspend: want 401 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "user_suspended")
+
+		w = performJSON(r, http.MethodGet, "/api/v1/admin/platform/users?status=suspended", platformToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("search: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var list struct {
+			Data struct {
+				Users []struct {
+					ID               string `json:"id"`
+					Status           string `json:"status"`
+					SuspensionReason string `json:"suspension_reason"`
+				} `json:"users"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(list.Data.Users) != 1 || list.Data.Users[0].ID != memberID || list.Data.Users[0].SuspensionReason != "abuse report" {
+			t.Fatalf("users=%+v", list.Data.Users)
+		}
+	})
+
+	t.Run("reactivate", func(t *testing.T) {
+		if w := performJSON(r, http.MethodPost, userPath+"/reactivate", platformToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("reactivate: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w := performJSON(r, http.MethodPost, userPath+"/reactivate", platformToken, nil)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("reactivate again: want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "user_not_suspended")
+		if w := performJSON(r, http.MethodGet, "/api/v1/admin/tenants/"+tenantID+"/me/roles", memberToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("after reactivate: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("reactivating restores the status before suspension", func(t *testing.T) {
+		pendingID := uuid.NewString()
+		if _, err := db.Exec(ctx, `insert into users(id,email,password_hash,status) values ($1,'pending@example.com','hash',0)`, pendingID); err != nil {
+			t.Fatalf("insert pending user: %v", err)
+		}
+		pendingPath := "/api/v1/admin/platform/users/" + pendingID
+		if w := performJSON(r, http.MethodPost, pendingPath+"/suspend", platformToken, map[string]any{"reason": "spam"}); w.Code != http.StatusOK {
+			t.Fatalf("suspend: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		// Suspending again must not overwrite the status kept.
+		if w := performJSON(r, http.MethodPost, pendingPath+"/suspend", platformToken, map[string]any{"reason": "spam"}); w.Code != http.StatusOK {
+			t.Fatalf("suspend again: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodPost, pendingPath+"/reactivate", platformToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("reactivate: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var status int16
+		if err := db.QueryRow(ctx, `select status from users where id = $1`, pendingID).Scan(&status); err != nil {
+			t.Fatalf("status: %v", err)
+		}
+		if status != 0 {
+			t.Fatalf("status=%d want 0 (pending)", status)
+		}
+	})
+
+	t.Run("platform admins cannot suspend themselves", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, "/api/v1/admin/platform/users/"+testPlatformAdminID+"/suspend", platformToken, map[string]any{"reason": "oops"})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "cannot_suspend_self")
+	})
+
+	t.Run("email deliveries", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, userPath+"/emails", platformToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data struct {
+				Blacklist struct {
+					Blacklisted bool   `json:"blacklisted"`
+					Reason      string `json:"reason"`
+				} `json:"blacklist"`
+				Deliveries []struct {
+					ExternalID string `json:"external_id"`
+					Provider   string `json:"provider"`
+					History    []struct {
+						Status string `json:"status"`
+					} `json:"history"`
+				} `json:"deliveries"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !env.Data.Blacklist.Blacklisted || env.Data.Blacklist.Reason != "hard_bounce" {
+			t.Fatalf("blacklist=%+v", env.Data.Blacklist)
+		}
+		if len(env.Data.Deliveries) != 1 || env.Data.Deliveries[0].ExternalID != "ext-1" || env.Data.Deliveries[0].Provider != "sendgrid" || len(env.Data.Deliveries[0].History) != 2 || env.Data.Deliveries[0].History[1].Status != "bounced" {
+			t.Fatalf("deliveries=%+v", env.Data.Deliveries)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, "/api/v1/admin/platform/users/"+uuid.NewString()+"/logout", platformToken, nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("want 404 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "user_not_found")
+	})
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
+)
+
+const maxPolicyBodyBytes = 1 << 20
+
+type policyApplyResp struct {
+	Version rbac.PolicyVersion `json:"version"`
+	Diff    rbac.PolicyDiff    `json:"diff"`
+}
+
+type policyHistoryResp struct {
+	Versions []rbac.PolicyVersion `json:"versions"`
+}
+
+// ExportPolicy returns the current global policy set as JSON (default) or,
+// with ?format=csv, as a Casbin policy file.
+func (h *Handler) ExportPolicy(c *gin.Context) error {
+	set, err := h.Policies.Current(c)
+	if err != nil {
+		return err
+	}
+	return writePolicySet(c, set)
+}
+
+// DiffPolicy compares the policy set in the request body with the current one.
+func (h *Handler) DiffPolicy(c *gin.Context) error {
+	rules, err := readPolicyBody(c)
+	if err != nil {
+		return err
+	}
+	current, err := h.Policies.Current(c)
+	if err != nil {
+		return err
+	}
+	resp.OK(c, map[string]any{"version": current.Version, "diff": rbac.DiffPolicy(current.Rules, rules)})
+	return nil
+}
+
+// ApplyPolicy atomically replaces the global policy with the set in the
+// request body. ?expected_version guards against concurrent applies.
+func (h *Handler) ApplyPolicy(c *gin.Context) error {
+	rules, err := readPolicyBody(c)
+	if err != nil {
+		return err
+	}
+	opts := rbac.ApplyOptions{Comment: strings.TrimSpace(c.Query("comment")), Actor: c.GetString("uid")}
+	if raw := strings.TrimSpace(c.Query("expected_version")); raw != "" {
+		expected, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+		}
+		opts.ExpectedVersion = &expected
+	}
+	version, diff, err := h.Policies.Apply(c, rules, opts)
+	if err != nil {
+		return policyError(err)
+	}
+	if err = h.reloadPolicy(); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionPolicyApply, "", "rbac_policy", strconv.FormatInt(version.Version, 10), map[string]any{"comment": opts.Comment, "checksum": version.Checksum})
+	resp.OK(c, policyApplyResp{Version: version, Diff: diff})
+	return nil
+}
+
+func (h *Handler) ListPolicyVersions(c *gin.Context) error {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		return apperr.BadRequest(errors.New("invalid_limit")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	versions, err := h.Policies.History(c, limit)
+	if err != nil {
+		return err
+	}
+	resp.OK(c, policyHistoryResp{Versions: versions})
+	return nil
+}
+
+func (h *Handler) GetPolicyVersion(c *gin.Context) error {
+	version, err := policyVersionParam(c)
+	if err != nil {
+		return err
+	}
+	set, err := h.Policies.Version(c, version)
+	if err != nil {
+		return policyError(err)
+	}
+	return writePolicySet(c, set)
+}
+
+// RollbackPolicy re-applies an earlier version as a new version.
+func (h *Handler) RollbackPolicy(c *gin.Context) error {
+	version, err := policyVersionParam(c)
+	if err != nil {
+		return err
+	}
+	applied, diff, err := h.Policies.Rollback(c, version, rbac.ApplyOptions{Actor: c.GetString("uid")})
+	if err != nil {
+		return policyError(err)
+	}
+	if err = h.reloadPolicy(); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionPolicyRollback, "", "rbac_policy", strconv.FormatInt(applied.Version, 10), map[string]any{"rolled_back_to": version, "checksum": applied.Checksum})
+	resp.OK(c, policyApplyResp{Version: applied, Diff: diff})
+	return nil
+}
+
+// reloadPolicy refreshes the local enforcer after a policy set was written
+// directly to casbin_rule and asks the other replicas to do the same.
+func (h *Handler) reloadPolicy() error {
+	if err := h.Enforcer.LoadPolicy(); err != nil {
+		return err
+	}
+	if h.Watcher != nil {
+		if err := h.Watcher.Update(); err != nil {
+			log.Printf("admin-api policy: notify replicas failed: %v", err)
+		}
+	}
+	return nil
+}
+
+func readPolicyBody(c *gin.Context) ([]rbac.Rule, error) {
+	format := rbac.PolicyFormatJSON
+	if ct := c.ContentType(); ct == "text/csv" || ct == "text/plain" {
+		format = rbac.PolicyFormatCSV
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPolicyBodyBytes+1))
+	if err != nil {
+		return nil, apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	if len(body) > maxPolicyBodyBytes {
+		return nil, apperr.BadRequest(errors.New("policy_too_large")).WithData(map[string]any{"reason": "policy_too_large"})
+	}
+	rules, err := rbac.ParsePolicy(bytes.NewReader(body), format)
+	if err != nil {
+		return nil, policyError(err)
+	}
+	return rules, nil
+}
+
+func writePolicySet(c *gin.Context, set rbac.PolicySet) error {
+	if c.Query("format") != rbac.PolicyFormatCSV {
+		resp.OK(c, set)
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := rbac.WritePolicy(&buf, set, rbac.PolicyFormatCSV); err != nil {
+		return err
+	}
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	return nil
+}
+
+func policyVersionParam(c *gin.Context) (int64, error) {
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, apperr.BadRequest(errors.New("invalid_version")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	return version, nil
+}
+
+func policyError(err error) error {
+	switch {
+	case errors.Is(err, rbac.ErrInvalidPolicyRule):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_policy_rule"})
+	case errors.Is(err, rbac.ErrTenantScopedRule):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "tenant_scoped_rule"})
+	case errors.Is(err, rbac.ErrPolicyVersionConflict):
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "policy_version_conflict"})
+	case errors.Is(err, rbac.ErrPolicyVersionNotFound):
+		return apperr.NotFound(err).WithData(map[string]any{"reason": "policy_version_not_found"})
+	default:
+		return err
+	}
+}
@@ -0,0 +1,185 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlatformPolicyEndpoints(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	seed(t, db, tenantID, ownerID, uuid.NewString(), uuid.NewString(), uuid.NewString(), "tenant-beta", uuid.NewString())
+	if _, err := db.Exec(context.Background(), `insert into casbin_rule(ptype,v0,v1,v2) values ('g','role:support','perm:members:read','tenant:tenant-alpha')`); err != nil {
+		t.Fatalf("seed tenant rule: %v", err)
+	}
+	seedPlatformAdmin(t, db)
+
+	r := newTestRouter(t, db)
+	platformToken := mustAccessToken(t, testPlatformAdminID, nil)
+	membersPath := "/api/v1/admin/tenants/" + tenantID + "/members"
+
+	type policyVersion struct {
+		Version   int64  `json:"version"`
+		RuleCount int    `json:"rule_count"`
+		CreatedBy string `json:"created_by"`
+	}
+	type applyResp struct {
+		Version policyVersion `json:"version"`
+		Diff    struct {
+			Added   []json.RawMessage `json:"added"`
+			Removed []json.RawMessage `json:"removed"`
+		} `json:"diff"`
+	}
+	decode := func(t *testing.T, w *httptest.ResponseRecorder, out any) {
+		t.Helper()
+		env := struct {
+			Data any `json:"data"`
+		}{Data: out}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v body=%s", err, w.Body.String())
+		}
+	}
+	putCSV := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+platformToken)
+		req.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("tenant owner forbidden", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, "/api/v1/admin/platform/rbac/policy", mustAccessToken(t, ownerID, &tenantID), nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("export excludes tenant scoped rules", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, "/api/v1/admin/platform/rbac/policy?format=csv", platformToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		body := w.Body.String()
+		if !strings.HasPrefix(body, "# policy version 0") || !strings.Contains(body, "p, tenant_admin, tenant:*") {
+			t.Fatalf("unexpected export: %s", body)
+		}
+		if strings.Contains(body, "tenant:tenant-alpha") {
+			t.Fatalf("export leaked tenant scoped rule: %s", body)
+		}
+	})
+
+	// Restrict the built-in roles to read-only access.
+	restricted := "p, tenant_owner, tenant:*, /api/v1/admin/*, GET\np, tenant_admin, tenant:*, /api/v1/admin/*, GET\n"
+
+	t.Run("diff reports changes without applying", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/platform/rbac/policy/diff", strings.NewReader(restricted))
+		req.Header.Set("Authorization", "Bearer "+platformToken)
+		req.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var got applyResp
+		decode(t, w, &got)
+		if len(got.Diff.Added) == 0 || len(got.Diff.Removed) == 0 {
+			t.Fatalf("expected added and removed rules: %s", w.Body.String())
+		}
+	})
+
+	t.Run("apply replaces global policy and keeps tenant rules", func(t *testing.T) {
+		w := putCSV("/api/v1/admin/platform/rbac/policy?expected_version=0", restricted)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var got applyResp
+		decode(t, w, &got)
+		if got.Version.Version != 1 || got.Version.RuleCount != 2 || got.Version.CreatedBy != testPlatformAdminID {
+			t.Fatalf("unexpected version: %+v", got.Version)
+		}
+
+		ownerToken := mustAccessToken(t, ownerID, &tenantID)
+		if w := performJSON(r, http.MethodGet, membersPath, ownerToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("GET members want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodPost, membersPath, ownerToken, map[string]string{"user_id": uuid.NewString(), "role": "member"}); w.Code != http.StatusForbidden {
+			t.Fatalf("POST members want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+
+		var kept bool
+		if err := db.QueryRow(context.Background(), `select exists(select 1 from casbin_rule where ptype='g' and v2='tenant:tenant-alpha')`).Scan(&kept); err != nil || !kept {
+			t.Fatalf("tenant scoped rule removed: kept=%v err=%v", kept, err)
+		}
+	})
+
+	t.Run("stale expected version conflicts", func(t *testing.T) {
+		w := putCSV("/api/v1/admin/platform/rbac/policy?expected_version=0", restricted)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("tenant scoped rule rejected", func(t *testing.T) {
+		w := putCSV("/api/v1/admin/platform/rbac/policy", "g, role:support, perm:members:read, tenant:tenant-alpha\n")
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("rule the model cannot load rejected", func(t *testing.T) {
+		for _, body := range []string{
+			"p9, tenant_owner, tenant:*, /api/v1/admin/*, GET\n",
+			"p, tenant_owner, tenant:*, /api/v1/admin/*\n",
+		} {
+			w := putCSV("/api/v1/admin/platform/rbac/policy", body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("%q: want 400 got %d body=%s", body, w.Code, w.Body.String())
+			}
+		}
+		var committed bool
+		if err := db.QueryRow(context.Background(), `select exists(select 1 from casbin_rule where ptype='p9' or (ptype='p' and v3 is null))`).Scan(&committed); err != nil || committed {
+			t.Fatalf("invalid rule committed: committed=%v err=%v", committed, err)
+		}
+	})
+
+	t.Run("rollback restores an earlier version", func(t *testing.T) {
+		w := putCSV("/api/v1/admin/platform/rbac/policy", "p, tenant_owner, tenant:*, /api/v1/admin/*, *\n")
+		if w.Code != http.StatusOK {
+			t.Fatalf("apply v2 want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+
+		w = performJSON(r, http.MethodPost, "/api/v1/admin/platform/rbac/policy/versions/1/rollback", platformToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("rollback want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var got applyResp
+		decode(t, w, &got)
+		if got.Version.Version != 3 || got.Version.RuleCount != 2 {
+			t.Fatalf("unexpected rollback version: %+v", got.Version)
+		}
+
+		w = performJSON(r, http.MethodGet, "/api/v1/admin/platform/rbac/policy/versions", platformToken, nil)
+		var history struct {
+			Versions []policyVersion `json:"versions"`
+		}
+		decode(t, w, &history)
+		if len(history.Versions) != 3 || history.Versions[0].Version != 3 {
+			t.Fatalf("unexpected history: %+v", history.Versions)
+		}
+
+		w = performJSON(r, http.MethodGet, "/api/v1/admin/platform/rbac/policy/versions/99", platformToken, nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("unknown version want 404 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRBACCheckEndpoint(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	memberID := uuid.NewString()
+
+	seed(t, db, tenantID, ownerID, uuid.NewString(), memberID, uuid.NewString(), "tenant-beta", uuid.NewString())
+
+	r := newTestRouter(t, db)
+	ownerToken := mustAccessToken(t, ownerID, &tenantID)
+	checkPath := "/api/v1/admin/tenants/" + tenantID + "/rbac/check"
+	membersObj := "/api/v1/admin/tenants/:tenantId/members"
+
+	type decision struct {
+		Allowed           bool     `json:"allowed"`
+		Subject           string   `json:"subject"`
+		MatchedPolicy     []string `json:"matched_policy"`
+		ViolatedCondition []string `json:"violated_condition"`
+		Attributes        struct {
+			CallerRank int    `json:"caller_rank"`
+			TargetRank int    `json:"target_rank"`
+			IP         string `json:"ip"`
+		} `json:"attributes"`
+	}
+	check := func(t *testing.T, body map[string]any) decision {
+		t.Helper()
+		w := performJSON(r, http.MethodPost, checkPath, ownerToken, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var env struct {
+			Data decision `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return env.Data
+	}
+
+	t.Run("admin role allowed with matched policy", func(t *testing.T) {
+		d := check(t, map[string]any{"role": "admin", "object": membersObj, "action": "delete"})
+		if !d.Allowed || d.Subject != "tenant_admin" || len(d.MatchedPolicy) == 0 {
+			t.Fatalf("unexpected decision: %+v", d)
+		}
+	})
+
+	t.Run("member user denied", func(t *testing.T) {
+		d := check(t, map[string]any{"user_id": memberID, "object": membersObj, "action": "GET"})
+		if d.Allowed || d.Subject != "member" || len(d.MatchedPolicy) != 0 {
+			t.Fatalf("unexpected decision: %+v", d)
+		}
+	})
+
+	t.Run("access conditions evaluated", func(t *testing.T) {
+		memberObj := "/api/v1/admin/tenants/:tenantId/members/:uid"
+		d := check(t, map[string]any{"role": "admin", "object": memberObj, "action": "DELETE", "attributes": map[string]any{"target_user_id": ownerID}})
+		if d.Allowed || len(d.MatchedPolicy) == 0 || len(d.ViolatedCondition) == 0 {
+			t.Fatalf("admin removing owner: unexpected decision: %+v", d)
+		}
+		if d.Attributes.CallerRank != 2 || d.Attributes.TargetRank != 3 {
+			t.Fatalf("attributes=%+v want caller_rank 2, target_rank 3", d.Attributes)
+		}
+		d = check(t, map[string]any{"role": "admin", "object": memberObj, "action": "DELETE", "attributes": map[string]any{"target_user_id": memberID, "ip": "198.51.100.7"}})
+		if !d.Allowed || len(d.ViolatedCondition) != 0 || d.Attributes.IP != "198.51.100.7" {
+			t.Fatalf("admin removing member: unexpected decision: %+v", d)
+		}
+
+		w := performJSON(r, http.MethodPost, checkPath, ownerToken, map[string]any{"role": "admin", "object": memberObj, "action": "DELETE", "attributes": map[string]any{"ip": "not-an-ip"}})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("invalid ip: want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("ambiguous subject rejected", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, checkPath, ownerToken, map[string]string{"role": "admin", "user_id": memberID, "object": membersObj, "action": "GET"})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("members cannot run checks", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, checkPath, mustAccessToken(t, memberID, &tenantID), map[string]string{"role": "admin", "object": membersObj, "action": "GET"})
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+}
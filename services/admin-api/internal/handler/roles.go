@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/errcode"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
+)
+
+type listPermissionsResp struct {
+	Permissions []rbac.Permission `json:"permissions"`
+}
+
+type listRolesResp struct {
+	Roles []roleItem `json:"roles"`
+}
+
+type roleItem struct {
+	Name        string   `json:"name"`
+	Builtin     bool     `json:"builtin"`
+	Permissions []string `json:"permissions"`
+}
+
+type createRoleReq struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type updateRoleReq struct {
+	Permissions []string `json:"permissions"`
+}
+
+func (h *Handler) ListPermissions(c *gin.Context) error {
+	resp.OK(c, listPermissionsResp{Permissions: rbac.Permissions()})
+	return nil
+}
+
+func (h *Handler) ListRoles(c *gin.Context) error {
+	tid := c.Param("tenantId")
+
+	custom, err := rbac.CustomRoles(h.Enforcer, tid)
+	if err != nil {
+		return err
+	}
+
+	all := make([]string, 0, len(rbac.Permissions()))
+	for _, p := range rbac.Permissions() {
+		all = append(all, p.Name)
+	}
+	items := []roleItem{
+		{Name: "owner", Builtin: true, Permissions: all},
+		{Name: "admin", Builtin: true, Permissions: all},
+		{Name: "member", Builtin: true, Permissions: []string{}},
+	}
+	for _, r := range custom {
+		items = append(items, roleItem{Name: r.Name, Permissions: r.Permissions})
+	}
+	resp.OK(c, listRolesResp{Roles: items})
+	return nil
+}
+
+func (h *Handler) CreateRole(c *gin.Context) error {
+	tid := c.Param("tenantId")
+
+	var req createRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	if err := h.ensureGrantable(c, tid, req.Permissions); err != nil {
+		return err
+	}
+	if err := rbac.CreateCustomRole(h.Enforcer, tid, req.Name, req.Permissions); err != nil {
+		return roleError(err)
+	}
+	perms, _, err := rbac.CustomRolePermissions(h.Enforcer, tid, req.Name)
+	if err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionRoleCreate, tid, "role", req.Name, map[string]any{"permissions": perms})
+	resp.OK(c, roleItem{Name: req.Name, Permissions: perms})
+	return nil
+}
+
+func (h *Handler) UpdateRole(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	name := c.Param("role")
+	if rbac.IsBuiltinTenantRole(name) {
+		return roleError(rbac.ErrReservedRoleName)
+	}
+
+	var req updateRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	if err := h.ensureGrantable(c, tid, req.Permissions); err != nil {
+		return err
+	}
+	if err := rbac.UpdateCustomRole(h.Enforcer, tid, name, req.Permissions); err != nil {
+		return roleError(err)
+	}
+	if err := h.Store.BumpRoleAuthzVersion(c, tid, name); err != nil {
+		return err
+	}
+	groups, err := rbac.GroupsWithRole(h.Enforcer, tid, name)
+	if err != nil {
+		return err
+	}
+	if err = h.Store.BumpGroupAuthzVersion(c, tid, groups); err != nil {
+		return err
+	}
+	perms, _, err := rbac.CustomRolePermissions(h.Enforcer, tid, name)
+	if err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionRoleUpdate, tid, "role", name, map[string]any{"permissions": perms})
+	resp.OK(c, roleItem{Name: name, Permissions: perms})
+	return nil
+}
+
+func (h *Handler) DeleteRole(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	name := c.Param("role")
+	if rbac.IsBuiltinTenantRole(name) {
+		return roleError(rbac.ErrReservedRoleName)
+	}
+
+	inUse, err := h.Store.CountMembersWithRole(c, tid, name)
+	if err != nil {
+		return err
+	}
+	groups, err := rbac.GroupsWithRole(h.Enforcer, tid, name)
+	if err != nil {
+		return err
+	}
+	if inUse > 0 || len(groups) > 0 {
+		return apperr.Conflict(errors.New("role_in_use")).WithData(map[string]any{"reason": "role_in_use", "members": inUse, "groups": len(groups)})
+	}
+
+	removed, err := rbac.DeleteCustomRole(h.Enforcer, tid, name)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return roleError(rbac.ErrRoleNotFound)
+	}
+	h.audit(c, audit.ActionRoleDelete, tid, "role", name, nil)
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// ensureGrantable prevents privilege escalation through roles:write: callers
+// may only grant permissions they hold themselves.
+func (h *Handler) ensureGrantable(c *gin.Context, tid string, permissions []string) error {
+	subjects := rbacSubjects(c)
+	for _, p := range permissions {
+		if _, ok := rbac.LookupPermission(p); !ok {
+			continue
+		}
+		held := false
+		for _, subject := range subjects {
+			var err error
+			if held, err = rbac.SubjectHasPermission(h.Enforcer, tid, subject, p); err != nil {
+				return err
+			}
+			if held {
+				break
+			}
+		}
+		if !held {
+			return apperr.Forbidden(errors.New("permission_not_held")).WithData(map[string]any{"reason": "permission_not_held", "permission": p, "code": errcode.Forbidden})
+		}
+	}
+	return nil
+}
+
+// ensureAssignable applies the same rule to member role assignment: holders of
+// a custom role cannot hand out owner/admin or a custom role broader than
+// their own.
+func (h *Handler) ensureAssignable(c *gin.Context, tid, role string) error {
+	subjects := rbacSubjects(c)
+	if slices.ContainsFunc(subjects, rbac.IsAdminSubject) {
+		return nil
+	}
+	switch role {
+	case "member":
+		return nil
+	case "owner", "admin":
+		return apperr.Forbidden(errors.New("role_not_assignable")).WithData(map[string]any{"reason": "role_not_assignable", "code": errcode.Forbidden})
+	}
+	perms, _, err := rbac.CustomRolePermissions(h.Enforcer, tid, role)
+	if err != nil {
+		return err
+	}
+	return h.ensureGrantable(c, tid, perms)
+}
+
+// rbacSubjects returns the Casbin subjects AdminRBAC resolved for the
+// caller's roles.
+func rbacSubjects(c *gin.Context) []string {
+	v, _ := c.Get("rbac_subjects")
+	subjects, _ := v.([]string)
+	return subjects
+}
+
+func roleError(err error) error {
+	switch {
+	case errors.Is(err, rbac.ErrInvalidRoleName):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_role_name"})
+	case errors.Is(err, rbac.ErrReservedRoleName):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "reserved_role_name"})
+	case errors.Is(err, rbac.ErrUnknownPermission):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "unknown_permission"})
+	case errors.Is(err, rbac.ErrEmptyPermissions):
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "empty_permissions"})
+	case errors.Is(err, rbac.ErrRoleExists):
+		return apperr.Conflict(err).WithData(map[string]any{"reason": "role_exists"})
+	case errors.Is(err, rbac.ErrRoleNotFound):
+		return apperr.NotFound(err).WithData(map[string]any{"reason": "role_not_found"})
+	default:
+		return err
+	}
+}
@@ -0,0 +1,69 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCustomRoleEndpoints(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	supportID := uuid.NewString()
+	otherTenantID := "tenant-beta"
+
+	seed(t, db, tenantID, ownerID, uuid.NewString(), uuid.NewString(), supportID, otherTenantID, uuid.NewString())
+
+	r := newTestRouter(t, db)
+	ownerToken := mustAccessToken(t, ownerID, &tenantID)
+	supportToken := mustAccessToken(t, supportID, &tenantID)
+	rolesPath := "/api/v1/admin/tenants/" + tenantID + "/roles"
+	membersPath := "/api/v1/admin/tenants/" + tenantID + "/members"
+
+	t.Run("owner creates custom role", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, rolesPath, ownerToken, map[string]any{"name": "support", "permissions": []string{"members:read", "roles:read"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("unknown permission rejected", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, rolesPath, ownerToken, map[string]any{"name": "broken", "permissions": []string{"members:nuke"}})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("member assigned custom role", func(t *testing.T) {
+		w := performJSON(r, http.MethodPatch, membersPath+"/"+supportID, ownerToken, map[string]string{"role": "support"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("custom role grants only its permissions", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, membersPath, supportToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list members: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = performJSON(r, http.MethodDelete, membersPath+"/"+ownerID, supportToken, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("remove member: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = performJSON(r, http.MethodPost, rolesPath, supportToken, map[string]any{"name": "sneaky", "permissions": []string{"members:write"}})
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("create role: want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("role in use cannot be deleted", func(t *testing.T) {
+		w := performJSON(r, http.MethodDelete, rolesPath+"/support", ownerToken, nil)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("want 409 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+}
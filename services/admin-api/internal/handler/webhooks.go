@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
+	"anvilkit-auth-template/services/admin-api/internal/store"
+)
+
+const maxWebhookURLLen = 2048
+
+type webhookItem struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// createdWebhook includes the signing secret, which is only returned when an
+// endpoint is created or its secret rotated.
+type createdWebhook struct {
+	webhookItem
+	Secret string `json:"secret"`
+}
+
+type createWebhookReq struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+type updateWebhookReq struct {
+	URL         *string  `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+type webhookDeliveryItem struct {
+	ID             string     `json:"id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      *string    `json:"last_error"`
+	RedeliveryOf   *string    `json:"redelivery_of"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+type webhookDeliveryDetail struct {
+	webhookDeliveryItem
+	Payload    json.RawMessage      `json:"payload"`
+	AttemptLog []webhookAttemptItem `json:"attempt_log"`
+}
+
+type webhookAttemptItem struct {
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code"`
+	Error      *string   `json:"error"`
+	DurationMS int       `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// publish sends a lifecycle event to the tenant's webhooks. Like audit, a
+// failure is logged rather than failing the request.
+func (h *Handler) publish(ctx context.Context, tid, eventType string, data map[string]any) {
+	if h.Webhooks == nil {
+		return
+	}
+	if _, err := h.Webhooks.Publish(ctx, tid, eventType, data); err != nil {
+		log.Printf("admin-api webhooks: publish event=%q tenant=%q failed: %v", eventType, tid, err)
+	}
+}
+
+// publishMemberRoles sends member.roles_updated with the member's current
+// roles.
+func (h *Handler) publishMemberRoles(c *gin.Context, tid, uid string) {
+	if h.Webhooks == nil {
+		return
+	}
+	roles, _, err := h.Store.MemberRoles(c, tid, uid)
+	if err != nil {
+		log.Printf("admin-api webhooks: load roles of user=%q tenant=%q failed: %v", uid, tid, err)
+		return
+	}
+	h.publish(c, tid, webhooks.EventMemberRolesUpdated, map[string]any{"user_id": uid, "roles": roles})
+}
+
+func (h *Handler) ListWebhooks(c *gin.Context) error {
+	endpoints, err := h.Store.ListWebhookEndpoints(c, c.Param("tenantId"))
+	if err != nil {
+		return err
+	}
+	items := make([]webhookItem, 0, len(endpoints))
+	for _, e := range endpoints {
+		items = append(items, toWebhookItem(e))
+	}
+	resp.OK(c, map[string]any{"webhooks": items, "event_types": webhooks.EventTypes()})
+	return nil
+}
+
+// CreateWebhook registers an endpoint and returns its signing secret.
+func (h *Handler) CreateWebhook(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	var req createWebhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	endpointURL, err := parseWebhookURL(req.URL)
+	if err != nil {
+		return err
+	}
+	events, err := parseWebhookEvents(req.Events)
+	if err != nil {
+		return err
+	}
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		return err
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	e, err := h.Store.CreateWebhookEndpoint(c, tid, endpointURL, secret, events, strings.TrimSpace(req.Description), enabled)
+	if err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionWebhookCreate, tid, "webhook", e.ID, map[string]any{"url": e.URL, "events": e.Events})
+	resp.OK(c, createdWebhook{webhookItem: toWebhookItem(e), Secret: e.Secret})
+	return nil
+}
+
+func (h *Handler) GetWebhook(c *gin.Context) error {
+	e, found, err := h.Store.WebhookEndpoint(c, c.Param("tenantId"), c.Param("webhookId"))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return webhookNotFound()
+	}
+	resp.OK(c, toWebhookItem(e))
+	return nil
+}
+
+func (h *Handler) UpdateWebhook(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	wid := c.Param("webhookId")
+	var req updateWebhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return apperr.BadRequest(err).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	update := store.WebhookEndpointUpdate{Enabled: req.Enabled}
+	if req.URL != nil {
+		endpointURL, err := parseWebhookURL(*req.URL)
+		if err != nil {
+			return err
+		}
+		update.URL = &endpointURL
+	}
+	if req.Events != nil {
+		events, err := parseWebhookEvents(req.Events)
+		if err != nil {
+			return err
+		}
+		update.Events = events
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		update.Description = &description
+	}
+
+	found, err := h.Store.UpdateWebhookEndpoint(c, tid, wid, update)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return webhookNotFound()
+	}
+	h.audit(c, audit.ActionWebhookUpdate, tid, "webhook", wid, map[string]any{"url": update.URL, "events": update.Events, "enabled": update.Enabled})
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+// DeleteWebhook deletes an endpoint and its delivery log.
+func (h *Handler) DeleteWebhook(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	wid := c.Param("webhookId")
+	found, err := h.Store.DeleteWebhookEndpoint(c, tid, wid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return webhookNotFound()
+	}
+	h.audit(c, audit.ActionWebhookDelete, tid, "webhook", wid, nil)
+	resp.OK(c, map[string]any{"ok": true})
+	return nil
+}
+
+func (h *Handler) RotateWebhookSecret(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	wid := c.Param("webhookId")
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		return err
+	}
+	found, err := h.Store.RotateWebhookSecret(c, tid, wid, secret)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return webhookNotFound()
+	}
+	h.audit(c, audit.ActionWebhookRotate, tid, "webhook", wid, nil)
+	resp.OK(c, map[string]any{"secret": secret})
+	return nil
+}
+
+// ListWebhookDeliveries lists an endpoint's deliveries, newest first.
+// ?status=pending|succeeded|failed filters them; ?limit= and ?offset= page.
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) error {
+	tid := c.Param("tenantId")
+	wid := c.Param("webhookId")
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+	status := strings.TrimSpace(c.Query("status"))
+	switch status {
+	case "", webhooks.StatusPending, webhooks.StatusSucceeded, webhooks.StatusFailed:
+	default:
+		return apperr.BadRequest(errors.New("invalid_status")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	if _, found, err := h.Store.WebhookEndpoint(c, tid, wid); err != nil {
+		return err
+	} else if !found {
+		return webhookNotFound()
+	}
+
+	deliveries, more, err := h.Store.ListWebhookDeliveries(c, tid, wid, status, limit, offset)
+	if err != nil {
+		return err
+	}
+	items := make([]webhookDeliveryItem, 0, len(deliveries))
+	for _, d := range deliveries {
+		items = append(items, toWebhookDeliveryItem(d))
+	}
+	resp.OK(c, map[string]any{"deliveries": items, "has_more": more})
+	return nil
+}
+
+// GetWebhookDelivery returns a delivery with its payload and every attempt.
+func (h *Handler) GetWebhookDelivery(c *gin.Context) error {
+	d, found, err := h.Store.WebhookDelivery(c, c.Param("tenantId"), c.Param("webhookId"), c.Param("deliveryId"))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return webhookDeliveryNotFound()
+	}
+	detail := webhookDeliveryDetail{webhookDeliveryItem: toWebhookDeliveryItem(d), Payload: d.Payload, AttemptLog: make([]webhookAttemptItem, 0, len(d.AttemptLog))}
+	for _, a := range d.AttemptLog {
+		detail.AttemptLog = append(detail.AttemptLog, webhookAttemptItem{Attempt: a.Attempt, StatusCode: a.StatusCode, Error: a.Error, DurationMS: a.DurationMS, CreatedAt: a.CreatedAt})
+	}
+	resp.OK(c, detail)
+	return nil
+}
+
+// RedeliverWebhook sends a delivery's payload again as a new delivery with
+// its own attempts.
+func (h *Handler) RedeliverWebhook(c *gin.Context) error {
+	if h.Webhooks == nil {
+		return errors.New("webhook publisher is not configured")
+	}
+	tid := c.Param("tenantId")
+	wid := c.Param("webhookId")
+	did := c.Param("deliveryId")
+	id, found, err := h.Store.RedeliverWebhook(c, tid, wid, did)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return webhookDeliveryNotFound()
+	}
+	if err = h.Webhooks.Enqueue(c, id); err != nil {
+		return err
+	}
+	h.audit(c, audit.ActionWebhookRedeliver, tid, "webhook", wid, map[string]any{"delivery_id": did, "redelivery_id": id})
+	resp.OK(c, map[string]any{"delivery_id": id})
+	return nil
+}
+
+// parseWebhookURL accepts absolute http and https URLs. Whether the host is
+// reachable is decided when delivering, where non-public addresses are
+// refused.
+func parseWebhookURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || len(raw) > maxWebhookURLLen || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" || u.User != nil {
+		return "", apperr.BadRequest(errors.New("invalid_webhook_url")).WithData(map[string]any{"reason": "invalid_webhook_url"})
+	}
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+func parseWebhookEvents(events []string) ([]string, error) {
+	out := make([]string, 0, len(events))
+	seen := make(map[string]bool, len(events))
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		if !webhooks.ValidEventType(e) {
+			return nil, apperr.BadRequest(errors.New("invalid_event_type")).WithData(map[string]any{"reason": "invalid_event_type", "event_type": e})
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	if len(out) == 0 {
+		return nil, apperr.BadRequest(errors.New("missing_events")).WithData(map[string]any{"reason": "invalid_argument"})
+	}
+	return out, nil
+}
+
+func webhookNotFound() error {
+	return apperr.NotFound(errors.New("webhook_not_found")).WithData(map[string]any{"reason": "webhook_not_found"})
+}
+
+func webhookDeliveryNotFound() error {
+	return apperr.NotFound(errors.New("webhook_delivery_not_found")).WithData(map[string]any{"reason": "webhook_delivery_not_found"})
+}
+
+func toWebhookItem(e store.WebhookEndpointDTO) webhookItem {
+	return webhookItem{ID: e.ID, URL: e.URL, Events: e.Events, Description: e.Description, Enabled: e.Enabled, CreatedAt: e.CreatedAt, UpdatedAt: e.UpdatedAt}
+}
+
+func toWebhookDeliveryItem(d store.WebhookDeliveryDTO) webhookDeliveryItem {
+	return webhookDeliveryItem{
+		ID: d.ID, EventID: d.EventID, EventType: d.EventType, Status: d.Status, Attempts: d.Attempts, NextAttemptAt: d.NextAttemptAt,
+		LastStatusCode: d.LastStatusCode, LastError: d.LastError, RedeliveryOf: d.RedeliveryOf, CreatedAt: d.CreatedAt, DeliveredAt: d.DeliveredAt,
+	}
+}
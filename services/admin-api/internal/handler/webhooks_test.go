@@ -0,0 +1,233 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
+)
+
+// recordingQueue stands in for Redis and records the queued delivery IDs.
+type recordingQueue struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (q *recordingQueue) EnqueueContext(_ context.Context, _ string, payload any) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ids = append(q.ids, payload.(webhooks.Job).DeliveryID)
+	return nil
+}
+
+func (q *recordingQueue) take() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids := q.ids
+	q.ids = nil
+	return ids
+}
+
+var testWebhookQueue = &recordingQueue{}
+
+func TestWebhookEndpoints(t *testing.T) {
+	db := mustTestDB(t)
+	truncateTables(t, db)
+	testWebhookQueue.take()
+
+	tenantID := "tenant-alpha"
+	ownerID := uuid.NewString()
+	adminID := uuid.NewString()
+	memberID := uuid.NewString()
+	targetID := uuid.NewString()
+	seed(t, db, tenantID, ownerID, adminID, memberID, targetID, "tenant-beta", uuid.NewString())
+
+	r := newTestRouter(t, db)
+	ownerToken := mustAccessToken(t, ownerID, &tenantID)
+	memberToken := mustAccessToken(t, memberID, &tenantID)
+	tenantPath := "/api/v1/admin/tenants/" + tenantID
+
+	var created struct {
+		Data struct {
+			ID     string   `json:"id"`
+			URL    string   `json:"url"`
+			Events []string `json:"events"`
+			Secret string   `json:"secret"`
+		} `json:"data"`
+	}
+
+	t.Run("create validates url and events", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, tenantPath+"/webhooks", ownerToken, map[string]any{"url": "ftp://example.com", "events": []string{"member.added"}})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "invalid_webhook_url")
+
+		w = performJSON(r, http.MethodPost, tenantPath+"/webhooks", ownerToken, map[string]any{"url": "https://hooks.example.com/in", "events": []string{"member.exploded"}})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("want 400 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "invalid_event_type")
+	})
+
+	t.Run("create returns the secret once", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, tenantPath+"/webhooks", ownerToken, map[string]any{
+			"url":    "https://hooks.example.com/in",
+			"events": []string{webhooks.EventMemberAdded, webhooks.EventMemberRemoved},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if created.Data.ID == "" || len(created.Data.Secret) != len("whsec_")+64 {
+			t.Fatalf("unexpected created webhook: %+v", created.Data)
+		}
+
+		w = performJSON(r, http.MethodGet, tenantPath+"/webhooks/"+created.Data.ID, ownerToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var got map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if _, ok := got["data"].(map[string]any)["secret"]; ok {
+			t.Fatalf("secret must not be returned by GET: %s", w.Body.String())
+		}
+	})
+
+	t.Run("members without webhooks:manage are denied", func(t *testing.T) {
+		w := performJSON(r, http.MethodGet, tenantPath+"/webhooks", memberToken, nil)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403 got %d body=%s", w.Code, w.Body.String())
+		}
+	})
+
+	var deliveryID string
+	t.Run("adding a member creates a delivery", func(t *testing.T) {
+		newID := uuid.NewString()
+		if _, err := db.Exec(context.Background(), `insert into users(id,email,password_hash) values ($1,'new@example.com','hash')`, newID); err != nil {
+			t.Fatalf("seed user: %v", err)
+		}
+		w := performJSON(r, http.MethodPost, tenantPath+"/members", ownerToken, map[string]any{"user_id": newID, "role": "member"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		queued := testWebhookQueue.take()
+		if len(queued) != 1 {
+			t.Fatalf("want 1 queued delivery got %v", queued)
+		}
+		deliveryID = queued[0]
+
+		w = performJSON(r, http.MethodGet, tenantPath+"/webhooks/"+created.Data.ID+"/deliveries/"+deliveryID, ownerToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var body struct {
+			Data struct {
+				EventType string `json:"event_type"`
+				Status    string `json:"status"`
+				Payload   struct {
+					Type     string         `json:"type"`
+					TenantID string         `json:"tenant_id"`
+					Data     map[string]any `json:"data"`
+				} `json:"payload"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if body.Data.EventType != webhooks.EventMemberAdded || body.Data.Status != webhooks.StatusPending {
+			t.Fatalf("unexpected delivery: %s", w.Body.String())
+		}
+		if body.Data.Payload.TenantID != tenantID || body.Data.Payload.Data["user_id"] != newID {
+			t.Fatalf("unexpected payload: %s", w.Body.String())
+		}
+	})
+
+	t.Run("unsubscribed events are not delivered", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, tenantPath+"/users/"+targetID+"/roles/admin", ownerToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if queued := testWebhookQueue.take(); len(queued) != 0 {
+			t.Fatalf("want no deliveries got %v", queued)
+		}
+	})
+
+	t.Run("redeliver queues a copy", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, tenantPath+"/webhooks/"+created.Data.ID+"/deliveries/"+deliveryID+"/redeliver", ownerToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		queued := testWebhookQueue.take()
+		if len(queued) != 1 || queued[0] == deliveryID {
+			t.Fatalf("want one new delivery got %v", queued)
+		}
+
+		w = performJSON(r, http.MethodGet, tenantPath+"/webhooks/"+created.Data.ID+"/deliveries", ownerToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var body struct {
+			Data struct {
+				Deliveries []struct {
+					ID           string  `json:"id"`
+					RedeliveryOf *string `json:"redelivery_of"`
+				} `json:"deliveries"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(body.Data.Deliveries) != 2 || body.Data.Deliveries[0].ID != queued[0] || body.Data.Deliveries[0].RedeliveryOf == nil || *body.Data.Deliveries[0].RedeliveryOf != deliveryID {
+			t.Fatalf("unexpected deliveries: %s", w.Body.String())
+		}
+	})
+
+	t.Run("rotate, disable and delete", func(t *testing.T) {
+		w := performJSON(r, http.MethodPost, tenantPath+"/webhooks/"+created.Data.ID+"/rotate-secret", ownerToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		var rotated struct {
+			Data struct {
+				Secret string `json:"secret"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &rotated); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if rotated.Data.Secret == "" || rotated.Data.Secret == created.Data.Secret {
+			t.Fatalf("secret was not rotated: %s", w.Body.String())
+		}
+
+		w = performJSON(r, http.MethodPatch, tenantPath+"/webhooks/"+created.Data.ID, ownerToken, map[string]any{"enabled": false})
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if w := performJSON(r, http.MethodDelete, tenantPath+"/members/"+targetID, ownerToken, nil); w.Code != http.StatusOK {
+			t.Fatalf("remove member: want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		if queued := testWebhookQueue.take(); len(queued) != 0 {
+			t.Fatalf("disabled endpoint got deliveries %v", queued)
+		}
+
+		w = performJSON(r, http.MethodDelete, tenantPath+"/webhooks/"+created.Data.ID, ownerToken, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("want 200 got %d body=%s", w.Code, w.Body.String())
+		}
+		w = performJSON(r, http.MethodGet, tenantPath+"/webhooks/"+created.Data.ID, ownerToken, nil)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("want 404 got %d body=%s", w.Code, w.Body.String())
+		}
+		assertReason(t, w, "webhook_not_found")
+	})
+}
@@ -0,0 +1,385 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	// Business hour conditions name IANA zones; embed the database so they
+	// resolve in minimal images without /usr/share/zoneinfo.
+	_ "time/tzdata"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// ConditionPtype is the Casbin policy type of access conditions. A condition
+// rule is "p2, sub, dom, obj, act, cond, deny": when sub (or "*") requests a
+// matching obj/act in dom (a tenant domain or "tenant:*"), the boolean
+// expression cond must hold or the request is denied even if the role policy
+// allows it. cond is evaluated against r2.attrs, an Attributes value.
+const ConditionPtype = "p2"
+
+// Role ranks used by conditions comparing the caller with the target member.
+const (
+	RankNone   = -1
+	RankMember = 0
+	RankCustom = 1
+	RankAdmin  = 2
+	RankOwner  = 3
+)
+
+// MemberRankCondition lets owners manage anyone and everyone else only
+// members ranked below them.
+const MemberRankCondition = "r2.attrs.CallerRank == 3 || r2.attrs.TargetRank < r2.attrs.CallerRank"
+
+// Tenant access rule objects: they apply to every admin API route.
+const tenantAccessObject = "/api/v1/admin/*"
+
+// MaxConditionLength bounds a condition expression so its rule stays within
+// the casbin_rule unique index.
+const MaxConditionLength = 2000
+
+var (
+	ErrInvalidIPAllowlist   = errors.New("invalid_ip_allowlist")
+	ErrInvalidBusinessHours = errors.New("invalid_business_hours")
+	ErrConditionTooLong     = errors.New("condition_too_long")
+)
+
+var conditionContext = casbin.NewEnforceContext("2")
+
+var (
+	ipAllowedCondition   = regexp.MustCompile(`^ipAllowed\(r2\.attrs\.IP, "([^"]*)"\)$`)
+	withinHoursCondition = regexp.MustCompile(`^withinHours\(r2\.attrs\.Time, "([^"]*)"\)$`)
+)
+
+// Attributes are the request attributes access conditions are evaluated
+// against.
+type Attributes struct {
+	// CallerRank is the highest rank among the caller's roles.
+	CallerRank int `json:"caller_rank"`
+	// TargetRank is the highest rank of the member named by the route's :uid
+	// or :userId parameter, or RankNone when there is no such member.
+	TargetRank int `json:"target_rank"`
+	// IP is the client IP as resolved by gin (see SetTrustedProxies).
+	IP   string    `json:"ip"`
+	Time time.Time `json:"time"`
+}
+
+// RoleRank ranks a tenant role name: owner, admin, custom roles, member.
+func RoleRank(role string) int {
+	switch role {
+	case "owner":
+		return RankOwner
+	case "admin":
+		return RankAdmin
+	case "member":
+		return RankMember
+	default:
+		return RankCustom
+	}
+}
+
+// HighestRank returns the highest rank among roles, or RankNone for none.
+func HighestRank(roles []string) int {
+	rank := RankNone
+	for _, role := range roles {
+		rank = max(rank, RoleRank(role))
+	}
+	return rank
+}
+
+// RegisterConditionFunctions adds the functions condition expressions may
+// call:
+//
+//	ipAllowed(r2.attrs.IP, "10.0.0.0/8 203.0.113.7")
+//	withinHours(r2.attrs.Time, "Mon-Fri 09:00-17:00 Europe/Berlin")
+func RegisterConditionFunctions(enforcer casbin.IEnforcer) {
+	enforcer.AddFunction("ipAllowed", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return false, fmt.Errorf("ipAllowed: want 2 arguments, got %d", len(args))
+		}
+		ip, _ := args[0].(string)
+		list, _ := args[1].(string)
+		return ipInList(ip, list)
+	})
+	enforcer.AddFunction("withinHours", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return false, fmt.Errorf("withinHours: want 2 arguments, got %d", len(args))
+		}
+		t, _ := args[0].(time.Time)
+		spec, _ := args[1].(string)
+		hours, err := parseBusinessHours(spec)
+		if err != nil {
+			return false, err
+		}
+		return hours.contains(t), nil
+	})
+}
+
+// CheckConditions reports whether a request passes every access condition
+// that applies to it. When it does not, the violated condition rule is
+// returned.
+func CheckConditions(enforcer casbin.IEnforcer, sub, dom, obj, act string, attrs Attributes) (bool, []string, error) {
+	return enforcer.EnforceEx(conditionContext, sub, dom, obj, act, attrs)
+}
+
+// TenantAccessRules are the access conditions a tenant manages for itself.
+// They apply to every member, owners included.
+type TenantAccessRules struct {
+	// IPAllowlist lists the IPs and CIDR ranges admin requests may come from;
+	// empty allows any address.
+	IPAllowlist []string `json:"ip_allowlist"`
+	// BusinessHours restricts admin requests to a weekly window such as
+	// "Mon-Fri 09:00-17:00 Europe/Berlin"; empty allows any time.
+	BusinessHours string `json:"business_hours"`
+}
+
+// Allows reports whether a request with attrs satisfies the rules.
+func (r TenantAccessRules) Allows(attrs Attributes) (bool, error) {
+	if len(r.IPAllowlist) > 0 {
+		ok, err := ipInList(attrs.IP, strings.Join(r.IPAllowlist, " "))
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if r.BusinessHours != "" {
+		hours, err := parseBusinessHours(r.BusinessHours)
+		if err != nil {
+			return false, err
+		}
+		return hours.contains(attrs.Time), nil
+	}
+	return true, nil
+}
+
+// NormalizeTenantAccessRules validates rules and returns them in canonical
+// form.
+func NormalizeTenantAccessRules(rules TenantAccessRules) (TenantAccessRules, error) {
+	out := TenantAccessRules{IPAllowlist: []string{}}
+	for _, entry := range rules.IPAllowlist {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		n, err := parseIPOrCIDR(entry)
+		if err != nil {
+			return TenantAccessRules{}, fmt.Errorf("%w: %s", ErrInvalidIPAllowlist, entry)
+		}
+		out.IPAllowlist = append(out.IPAllowlist, n.String())
+	}
+	slices.Sort(out.IPAllowlist)
+	out.IPAllowlist = slices.Compact(out.IPAllowlist)
+
+	out.BusinessHours = strings.Join(strings.Fields(rules.BusinessHours), " ")
+	if out.BusinessHours != "" {
+		if _, err := parseBusinessHours(out.BusinessHours); err != nil {
+			return TenantAccessRules{}, err
+		}
+	}
+	for _, rule := range out.policies("") {
+		if len(rule[4]) > MaxConditionLength {
+			return TenantAccessRules{}, fmt.Errorf("%w: %d characters, at most %d", ErrConditionTooLong, len(rule[4]), MaxConditionLength)
+		}
+	}
+	return out, nil
+}
+
+// policies returns the condition rules enforcing r in dom.
+func (r TenantAccessRules) policies(dom string) [][]string {
+	var policies [][]string
+	if len(r.IPAllowlist) > 0 {
+		cond := fmt.Sprintf(`ipAllowed(r2.attrs.IP, %q)`, strings.Join(r.IPAllowlist, " "))
+		policies = append(policies, []string{"*", dom, tenantAccessObject, "*", cond, "deny"})
+	}
+	if r.BusinessHours != "" {
+		cond := fmt.Sprintf(`withinHours(r2.attrs.Time, %q)`, r.BusinessHours)
+		policies = append(policies, []string{"*", dom, tenantAccessObject, "*", cond, "deny"})
+	}
+	return policies
+}
+
+// GetTenantAccessRules reads the tenant's access rules from its condition
+// policies.
+func GetTenantAccessRules(enforcer casbin.IEnforcer, tenantID string) (TenantAccessRules, error) {
+	rules, err := enforcer.GetFilteredNamedPolicy(ConditionPtype, 1, TenantDomain(tenantID))
+	if err != nil {
+		return TenantAccessRules{}, err
+	}
+	out := TenantAccessRules{IPAllowlist: []string{}}
+	for _, rule := range rules {
+		if len(rule) < 5 {
+			continue
+		}
+		if m := ipAllowedCondition.FindStringSubmatch(rule[4]); m != nil {
+			out.IPAllowlist = strings.Fields(m[1])
+		} else if m := withinHoursCondition.FindStringSubmatch(rule[4]); m != nil {
+			out.BusinessHours = m[1]
+		}
+	}
+	return out, nil
+}
+
+// SetTenantAccessRules replaces the tenant's access rules. With the Postgres
+// adapter the replacement is a single transaction, so a failed write leaves
+// the previous rules in place. rules must have been normalized with
+// NormalizeTenantAccessRules.
+func SetTenantAccessRules(enforcer *casbin.SyncedEnforcer, tenantID string, rules TenantAccessRules) error {
+	dom := TenantDomain(tenantID)
+	current, err := enforcer.GetFilteredNamedPolicy(ConditionPtype, 1, dom)
+	if err != nil {
+		return err
+	}
+	policies := rules.policies(dom)
+	_, persisted := enforcer.GetAdapter().(*PostgresAdapter)
+	switch {
+	case len(policies) == 0:
+		_, err = enforcer.RemoveFilteredNamedPolicy(ConditionPtype, 1, dom)
+	case len(current) == 0:
+		// Casbin does not notify the watcher of an update that replaced
+		// nothing, so add instead.
+		_, err = enforcer.AddNamedPolicies(ConditionPtype, policies)
+	case !persisted:
+		// Casbin learns which rules an update replaced from the adapter;
+		// in-memory enforcers have none to ask.
+		if _, err = enforcer.RemoveFilteredNamedPolicy(ConditionPtype, 1, dom); err == nil {
+			_, err = enforcer.AddNamedPolicies(ConditionPtype, policies)
+		}
+	default:
+		_, err = enforcer.UpdateFilteredNamedPolicies(ConditionPtype, policies, 1, dom)
+	}
+	return err
+}
+
+func ipInList(ip, list string) (bool, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false, nil
+	}
+	for _, entry := range strings.Fields(list) {
+		n, err := parseIPOrCIDR(entry)
+		if err != nil {
+			return false, fmt.Errorf("%w: %s", ErrInvalidIPAllowlist, entry)
+		}
+		if n.Contains(addr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func parseIPOrCIDR(entry string) (*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, n, err := net.ParseCIDR(entry)
+		return n, err
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP %q", entry)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// businessHours is a weekly window: days from..to (wrapping past Saturday)
+// and minutes of the day [start, end) in loc; end before start spans
+// midnight.
+type businessHours struct {
+	fromDay, toDay time.Weekday
+	start, end     int
+	loc            *time.Location
+}
+
+// parseBusinessHours parses "<days> <HH:MM>-<HH:MM> [zone]" where days is a
+// weekday ("Sat") or a range ("Mon-Fri") and zone is an IANA name (UTC if
+// omitted).
+func parseBusinessHours(spec string) (businessHours, error) {
+	invalid := fmt.Errorf("%w: %q", ErrInvalidBusinessHours, spec)
+	fields := strings.Fields(spec)
+	if len(fields) < 2 || len(fields) > 3 {
+		return businessHours{}, invalid
+	}
+	h := businessHours{loc: time.UTC}
+
+	from, to, isRange := strings.Cut(strings.ToLower(fields[0]), "-")
+	if !isRange {
+		to = from
+	}
+	var ok bool
+	if h.fromDay, ok = weekdays[from]; !ok {
+		return businessHours{}, invalid
+	}
+	if h.toDay, ok = weekdays[to]; !ok {
+		return businessHours{}, invalid
+	}
+
+	startText, endText, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return businessHours{}, invalid
+	}
+	var err error
+	if h.start, err = parseClock(startText); err != nil {
+		return businessHours{}, invalid
+	}
+	if h.end, err = parseClock(endText); err != nil || h.end == h.start {
+		return businessHours{}, invalid
+	}
+
+	if len(fields) == 3 {
+		if h.loc, err = time.LoadLocation(fields[2]); err != nil {
+			return businessHours{}, invalid
+		}
+	}
+	return h, nil
+}
+
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	if !ok || len(hh) != 2 || len(mm) != 2 {
+		return 0, errors.New("invalid clock")
+	}
+	hours, err := strconv.Atoi(hh)
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, errors.New("invalid clock")
+	}
+	minutes, err := strconv.Atoi(mm)
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, errors.New("invalid clock")
+	}
+	return hours*60 + minutes, nil
+}
+
+func (h businessHours) contains(t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	local := t.In(h.loc)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	if h.end < h.start && minute < h.end {
+		// Early-morning part of a window that started the previous day.
+		day = (day + 6) % 7
+	} else if h.end > h.start && (minute < h.start || minute >= h.end) {
+		return false
+	} else if h.end < h.start && minute < h.start {
+		return false
+	}
+	return h.dayIncluded(day)
+}
+
+func (h businessHours) dayIncluded(day time.Weekday) bool {
+	if h.fromDay <= h.toDay {
+		return day >= h.fromDay && day <= h.toDay
+	}
+	return day >= h.fromDay || day <= h.toDay
+}
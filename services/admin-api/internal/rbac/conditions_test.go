@@ -0,0 +1,236 @@
+package rbac
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBusinessHoursContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{spec: "Mon-Fri 09:00-17:00", at: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC), want: true},
+		{spec: "Mon-Fri 09:00-17:00", at: time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC), want: false},
+		{spec: "Mon-Fri 09:00-17:00", at: time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC), want: false},
+		{spec: "Mon-Fri 09:00-17:00 Europe/Berlin", at: time.Date(2026, 3, 2, 8, 30, 0, 0, time.UTC), want: true},
+		{spec: "Mon-Fri 09:00-17:00 Europe/Berlin", at: time.Date(2026, 3, 2, 16, 30, 0, 0, time.UTC), want: false},
+		{spec: "Mon-Fri 09:00-17:00 Europe/Berlin", at: time.Date(2026, 3, 2, 16, 59, 0, 0, berlin), want: true},
+		{spec: "Fri-Mon 00:00-24:00", at: time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC), want: true},
+		{spec: "Fri-Mon 00:00-24:00", at: time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC), want: false},
+		// Overnight window: Friday 22:00 until Saturday 06:00 belongs to Friday.
+		{spec: "Fri 22:00-06:00", at: time.Date(2026, 3, 6, 23, 0, 0, 0, time.UTC), want: true},
+		{spec: "Fri 22:00-06:00", at: time.Date(2026, 3, 7, 5, 59, 0, 0, time.UTC), want: true},
+		{spec: "Fri 22:00-06:00", at: time.Date(2026, 3, 6, 5, 0, 0, 0, time.UTC), want: false},
+		{spec: "Fri 22:00-06:00", at: time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC), want: false},
+	}
+	for _, tt := range tests {
+		hours, err := parseBusinessHours(tt.spec)
+		if err != nil {
+			t.Fatalf("parseBusinessHours(%q): %v", tt.spec, err)
+		}
+		if got := hours.contains(tt.at); got != tt.want {
+			t.Fatalf("%q contains %s=%v want %v", tt.spec, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseBusinessHoursRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"", "Mon-Fri", "Mon-Fun 09:00-17:00", "Mon 9:00-17:00", "Mon 09:00-09:00", "Mon 09:00-25:00", "Mon 09:00-17:00 Mars/Olympus", "Mon 09:00-17:00 UTC extra"} {
+		if _, err := parseBusinessHours(spec); !errors.Is(err, ErrInvalidBusinessHours) {
+			t.Fatalf("parseBusinessHours(%q) err=%v want %v", spec, err, ErrInvalidBusinessHours)
+		}
+	}
+}
+
+func TestIPInList(t *testing.T) {
+	tests := []struct {
+		ip, list string
+		want     bool
+	}{
+		{ip: "10.1.2.3", list: "10.0.0.0/8", want: true},
+		{ip: "203.0.113.7", list: "10.0.0.0/8 203.0.113.7", want: true},
+		{ip: "203.0.113.8", list: "10.0.0.0/8 203.0.113.7", want: false},
+		{ip: "2001:db8::1", list: "2001:db8::/32", want: true},
+		{ip: "not-an-ip", list: "0.0.0.0/0", want: false},
+	}
+	for _, tt := range tests {
+		got, err := ipInList(tt.ip, tt.list)
+		if err != nil {
+			t.Fatalf("ipInList(%q, %q): %v", tt.ip, tt.list, err)
+		}
+		if got != tt.want {
+			t.Fatalf("ipInList(%q, %q)=%v want %v", tt.ip, tt.list, got, tt.want)
+		}
+	}
+	if _, err := ipInList("10.0.0.1", "10.0.0.0/33"); !errors.Is(err, ErrInvalidIPAllowlist) {
+		t.Fatalf("err=%v want %v", err, ErrInvalidIPAllowlist)
+	}
+}
+
+func TestCheckConditionsMemberRank(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	RegisterConditionFunctions(e)
+	for _, rule := range defaultConditionRules {
+		if _, err := e.AddNamedPolicy(ConditionPtype, rule); err != nil {
+			t.Fatalf("AddNamedPolicy: %v", err)
+		}
+	}
+
+	obj := "/api/v1/admin/tenants/t1/members/u2"
+	tests := []struct {
+		name         string
+		caller, tgt  int
+		act          string
+		want         bool
+		wantViolated bool
+	}{
+		{name: "owner manages owner", caller: RankOwner, tgt: RankOwner, act: "DELETE", want: true},
+		{name: "admin manages member", caller: RankAdmin, tgt: RankMember, act: "PATCH", want: true},
+		{name: "admin manages admin", caller: RankAdmin, tgt: RankAdmin, act: "PATCH", want: false, wantViolated: true},
+		{name: "admin manages owner", caller: RankAdmin, tgt: RankOwner, act: "DELETE", want: false, wantViolated: true},
+		{name: "custom role manages custom role", caller: RankCustom, tgt: RankCustom, act: "DELETE", want: false, wantViolated: true},
+		{name: "reads are unconditioned", caller: RankMember, tgt: RankOwner, act: "GET", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs := Attributes{CallerRank: tt.caller, TargetRank: tt.tgt}
+			got, violated, err := CheckConditions(e, "tenant_admin", "tenant:t1", obj, tt.act, attrs)
+			if err != nil {
+				t.Fatalf("CheckConditions: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("CheckConditions=%v want %v", got, tt.want)
+			}
+			if (len(violated) > 0) != tt.wantViolated {
+				t.Fatalf("violated=%v want violated=%v", violated, tt.wantViolated)
+			}
+		})
+	}
+}
+
+func TestTenantAccessRulesRoundTrip(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	RegisterConditionFunctions(e)
+
+	rules, err := NormalizeTenantAccessRules(TenantAccessRules{
+		IPAllowlist:   []string{" 203.0.113.7 ", "10.0.0.0/8", "10.0.0.0/8", ""},
+		BusinessHours: "Mon-Fri   09:00-17:00 UTC",
+	})
+	if err != nil {
+		t.Fatalf("NormalizeTenantAccessRules: %v", err)
+	}
+	if want := []string{"10.0.0.0/8", "203.0.113.7/32"}; !slices.Equal(rules.IPAllowlist, want) {
+		t.Fatalf("ip_allowlist=%v want %v", rules.IPAllowlist, want)
+	}
+	if err = SetTenantAccessRules(e, "t1", rules); err != nil {
+		t.Fatalf("SetTenantAccessRules: %v", err)
+	}
+	got, err := GetTenantAccessRules(e, "t1")
+	if err != nil {
+		t.Fatalf("GetTenantAccessRules: %v", err)
+	}
+	if !slices.Equal(got.IPAllowlist, rules.IPAllowlist) || got.BusinessHours != rules.BusinessHours {
+		t.Fatalf("rules=%+v want %+v", got, rules)
+	}
+
+	monday := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	check := func(dom, ip string, at time.Time) bool {
+		t.Helper()
+		ok, _, err := CheckConditions(e, "tenant_member", dom, "/api/v1/admin/tenants/t1/members", "GET", Attributes{IP: ip, Time: at})
+		if err != nil {
+			t.Fatalf("CheckConditions: %v", err)
+		}
+		return ok
+	}
+	if !check("tenant:t1", "10.2.3.4", monday) {
+		t.Fatalf("expected allowlisted IP within business hours to pass")
+	}
+	if check("tenant:t1", "192.0.2.1", monday) {
+		t.Fatalf("expected IP outside the allowlist to be denied")
+	}
+	if check("tenant:t1", "10.2.3.4", monday.Add(8*time.Hour)) {
+		t.Fatalf("expected request outside business hours to be denied")
+	}
+	if !check("tenant:t2", "192.0.2.1", monday.Add(8*time.Hour)) {
+		t.Fatalf("expected other tenants to be unaffected")
+	}
+
+	if err = SetTenantAccessRules(e, "t1", TenantAccessRules{}); err != nil {
+		t.Fatalf("SetTenantAccessRules(clear): %v", err)
+	}
+	if rules, _ := e.GetFilteredNamedPolicy(ConditionPtype, 1, TenantDomain("t1")); len(rules) != 0 {
+		t.Fatalf("expected cleared rules, got %v", rules)
+	}
+}
+
+func TestTenantAccessRulesLongAllowlist(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	RegisterConditionFunctions(e)
+
+	var allowlist []string
+	for i := range 40 {
+		allowlist = append(allowlist, fmt.Sprintf("2001:db8:%x::/48", i))
+	}
+	rules, err := NormalizeTenantAccessRules(TenantAccessRules{IPAllowlist: allowlist})
+	if err != nil {
+		t.Fatalf("NormalizeTenantAccessRules: %v", err)
+	}
+	if err = SetTenantAccessRules(e, "t1", TenantAccessRules{BusinessHours: "Sat 00:00-01:00"}); err != nil {
+		t.Fatalf("SetTenantAccessRules: %v", err)
+	}
+	if err = SetTenantAccessRules(e, "t1", rules); err != nil {
+		t.Fatalf("SetTenantAccessRules(replace): %v", err)
+	}
+	got, err := GetTenantAccessRules(e, "t1")
+	if err != nil {
+		t.Fatalf("GetTenantAccessRules: %v", err)
+	}
+	if !slices.Equal(got.IPAllowlist, rules.IPAllowlist) || got.BusinessHours != "" {
+		t.Fatalf("rules=%+v want %+v", got, rules)
+	}
+
+	for i := range 100 {
+		allowlist = append(allowlist, fmt.Sprintf("2001:db8:ffff:%x::/64", i))
+	}
+	if _, err = NormalizeTenantAccessRules(TenantAccessRules{IPAllowlist: allowlist}); !errors.Is(err, ErrConditionTooLong) {
+		t.Fatalf("err=%v want %v", err, ErrConditionTooLong)
+	}
+}
+
+func TestNormalizeTenantAccessRulesRejectsInvalidInput(t *testing.T) {
+	if _, err := NormalizeTenantAccessRules(TenantAccessRules{IPAllowlist: []string{"10.0.0.300"}}); !errors.Is(err, ErrInvalidIPAllowlist) {
+		t.Fatalf("err=%v want %v", err, ErrInvalidIPAllowlist)
+	}
+	if _, err := NormalizeTenantAccessRules(TenantAccessRules{BusinessHours: "weekdays"}); !errors.Is(err, ErrInvalidBusinessHours) {
+		t.Fatalf("err=%v want %v", err, ErrInvalidBusinessHours)
+	}
+}
+
+func TestPolicyCSVQuotesConditions(t *testing.T) {
+	rule := Rule{Ptype: ConditionPtype, Values: []string{"*", "tenant:*", "/api/v1/admin/*", "*", `ipAllowed(r2.attrs.IP, "10.0.0.0/8")`, "deny"}}
+	var buf bytes.Buffer
+	if err := WritePolicy(&buf, PolicySet{Rules: []Rule{rule}}, PolicyFormatCSV); err != nil {
+		t.Fatalf("WritePolicy: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"ipAllowed(r2.attrs.IP, ""10.0.0.0/8"")"`) {
+		t.Fatalf("condition not quoted: %s", buf.String())
+	}
+	rules, err := ParsePolicy(&buf, PolicyFormatCSV)
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	if len(rules) != 1 || !slices.Equal(rules[0].Values, rule.Values) {
+		t.Fatalf("rules=%v want [%v]", rules, rule)
+	}
+}
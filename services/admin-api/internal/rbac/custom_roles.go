@@ -0,0 +1,242 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+
+	"anvilkit-auth-template/modules/common-go/pkg/authz"
+)
+
+var (
+	ErrInvalidRoleName  = errors.New("invalid_role_name")
+	ErrReservedRoleName = errors.New("reserved_role_name")
+	ErrRoleExists       = errors.New("role_exists")
+	ErrRoleNotFound     = errors.New("role_not_found")
+	ErrEmptyPermissions = errors.New("empty_permissions")
+)
+
+var customRoleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,47}$`)
+
+// CustomRole is a tenant-defined role composed from catalog permissions.
+type CustomRole struct {
+	Name        string
+	Permissions []string
+}
+
+// TenantDomain returns the Casbin domain for tenantID.
+func TenantDomain(tenantID string) string {
+	return authz.TenantDomain(tenantID)
+}
+
+// CustomRoleSubject returns the Casbin subject of the named custom role.
+func CustomRoleSubject(name string) string {
+	return authz.CustomRoleSubject(name)
+}
+
+// ValidateCustomRoleName reports whether name can be used for a custom role.
+// Names share the tenant_users.roles array with the built-in roles, so those
+// are reserved.
+func ValidateCustomRoleName(name string) error {
+	if !customRoleNamePattern.MatchString(name) {
+		return ErrInvalidRoleName
+	}
+	if IsBuiltinTenantRole(name) {
+		return ErrReservedRoleName
+	}
+	return nil
+}
+
+// CustomRoles lists the custom roles defined in a tenant, sorted by name.
+func CustomRoles(enforcer casbin.IEnforcer, tenantID string) ([]CustomRole, error) {
+	rules, err := enforcer.GetFilteredGroupingPolicy(2, TenantDomain(tenantID))
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string][]string{}
+	for _, rule := range rules {
+		if len(rule) < 2 {
+			continue
+		}
+		name, ok := strings.CutPrefix(rule[0], authz.RoleSubjectPrefix)
+		if !ok {
+			continue
+		}
+		perm, ok := strings.CutPrefix(rule[1], authz.PermissionSubjectPrefix)
+		if !ok {
+			continue
+		}
+		byName[name] = append(byName[name], perm)
+	}
+
+	roles := make([]CustomRole, 0, len(byName))
+	for name, perms := range byName {
+		roles = append(roles, CustomRole{Name: name, Permissions: sortPermissions(perms)})
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+// CustomRolePermissions returns the permissions granted to a custom role. The
+// bool result reports whether the role exists in the tenant.
+func CustomRolePermissions(enforcer casbin.IEnforcer, tenantID, name string) ([]string, bool, error) {
+	rules, err := enforcer.GetFilteredGroupingPolicy(0, CustomRoleSubject(name), "", TenantDomain(tenantID))
+	if err != nil {
+		return nil, false, err
+	}
+	perms := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) < 2 {
+			continue
+		}
+		if perm, ok := strings.CutPrefix(rule[1], authz.PermissionSubjectPrefix); ok {
+			perms = append(perms, perm)
+		}
+	}
+	if len(perms) == 0 {
+		return nil, false, nil
+	}
+	return sortPermissions(perms), true, nil
+}
+
+// CreateCustomRole defines a new custom role in the tenant domain.
+func CreateCustomRole(enforcer casbin.IEnforcer, tenantID, name string, permissions []string) error {
+	if err := ValidateCustomRoleName(name); err != nil {
+		return err
+	}
+	perms, err := normalizeRolePermissions(permissions)
+	if err != nil {
+		return err
+	}
+	_, exists, err := CustomRolePermissions(enforcer, tenantID, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrRoleExists
+	}
+	return grantRolePermissions(enforcer, tenantID, name, perms)
+}
+
+// UpdateCustomRole replaces the permission set of an existing custom role.
+// Only the difference is written so the role never transiently loses
+// permissions it keeps.
+func UpdateCustomRole(enforcer casbin.IEnforcer, tenantID, name string, permissions []string) error {
+	perms, err := normalizeRolePermissions(permissions)
+	if err != nil {
+		return err
+	}
+	current, exists, err := CustomRolePermissions(enforcer, tenantID, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrRoleNotFound
+	}
+
+	added := make([]string, 0, len(perms))
+	for _, p := range perms {
+		if !slices.Contains(current, p) {
+			added = append(added, p)
+		}
+	}
+	if err = grantRolePermissions(enforcer, tenantID, name, added); err != nil {
+		return err
+	}
+	for _, p := range current {
+		if slices.Contains(perms, p) {
+			continue
+		}
+		if _, err = enforcer.RemoveGroupingPolicy(CustomRoleSubject(name), PermissionSubject(p), TenantDomain(tenantID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCustomRole removes a custom role, and its grants to groups, from the
+// tenant domain. It reports whether the role existed.
+func DeleteCustomRole(enforcer casbin.IEnforcer, tenantID, name string) (bool, error) {
+	removed, err := enforcer.RemoveFilteredGroupingPolicy(0, CustomRoleSubject(name), "", TenantDomain(tenantID))
+	if err != nil || !removed {
+		return removed, err
+	}
+	_, err = enforcer.RemoveFilteredGroupingPolicy(1, CustomRoleSubject(name), TenantDomain(tenantID))
+	return true, err
+}
+
+// ResolveTenantRole maps a tenant_users.roles entry to the Casbin subject used
+// for enforcement: built-in roles go through MapTenantRoleToCasbin, anything
+// else must be a custom role defined in the tenant.
+func ResolveTenantRole(enforcer casbin.IEnforcer, tenantID, role string) (string, error) {
+	if IsBuiltinTenantRole(role) {
+		return MapTenantRoleToCasbin(role)
+	}
+	_, exists, err := CustomRolePermissions(enforcer, tenantID, role)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("invalid tenant role: %s", role)
+	}
+	return CustomRoleSubject(role), nil
+}
+
+// SubjectHasPermission reports whether a resolved Casbin subject holds perm in
+// the tenant, directly or through the roles and groups it inherits. Tenant and
+// organization owners and admins implicitly hold every permission.
+func SubjectHasPermission(enforcer casbin.IEnforcer, tenantID, subject, perm string) (bool, error) {
+	if IsAdminSubject(subject) {
+		return true, nil
+	}
+	inherited, err := implicitRoles(enforcer, TenantDomain(tenantID), subject)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(inherited, PermissionSubject(perm)) || slices.ContainsFunc(inherited, IsAdminSubject), nil
+}
+
+func normalizeRolePermissions(permissions []string) ([]string, error) {
+	perms, err := NormalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	if len(perms) == 0 {
+		return nil, ErrEmptyPermissions
+	}
+	return perms, nil
+}
+
+func grantRolePermissions(enforcer casbin.IEnforcer, tenantID, name string, perms []string) error {
+	for _, p := range perms {
+		if _, err := enforcer.AddGroupingPolicy(CustomRoleSubject(name), PermissionSubject(p), TenantDomain(tenantID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortPermissions(perms []string) []string {
+	order := make(map[string]int, len(permissionCatalog))
+	for i, p := range permissionCatalog {
+		order[p.Name] = i
+	}
+	sort.SliceStable(perms, func(i, j int) bool {
+		oi, iok := order[perms[i]]
+		oj, jok := order[perms[j]]
+		switch {
+		case iok && jok:
+			return oi < oj
+		case iok != jok:
+			return iok
+		default:
+			return perms[i] < perms[j]
+		}
+	})
+	return perms
+}
@@ -0,0 +1,163 @@
+package rbac
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestValidateCustomRoleName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want error
+	}{
+		{name: "simple", in: "billing"},
+		{name: "dashes and digits", in: "support-tier2"},
+		{name: "uppercase", in: "Billing", want: ErrInvalidRoleName},
+		{name: "single char", in: "b", want: ErrInvalidRoleName},
+		{name: "leading digit", in: "2fa", want: ErrInvalidRoleName},
+		{name: "colon", in: "role:x", want: ErrInvalidRoleName},
+		{name: "builtin owner", in: "owner", want: ErrReservedRoleName},
+		{name: "builtin member", in: "member", want: ErrReservedRoleName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateCustomRoleName(tt.in); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateCustomRoleName(%q)=%v want %v", tt.in, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePermissions(t *testing.T) {
+	got, err := NormalizePermissions([]string{PermRolesRead, PermMembersRead, PermRolesRead})
+	if err != nil {
+		t.Fatalf("NormalizePermissions: %v", err)
+	}
+	if want := []string{PermMembersRead, PermRolesRead}; !slices.Equal(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+
+	if _, err = NormalizePermissions([]string{"members:delete"}); !errors.Is(err, ErrUnknownPermission) {
+		t.Fatalf("err=%v want %v", err, ErrUnknownPermission)
+	}
+}
+
+func TestCustomRoleLifecycleEnforce(t *testing.T) {
+	e := newMemoryEnforcer(t)
+
+	if err := CreateCustomRole(e, "t1", "support", []string{PermMembersRead}); err != nil {
+		t.Fatalf("CreateCustomRole: %v", err)
+	}
+	if err := CreateCustomRole(e, "t1", "support", []string{PermMembersRead}); !errors.Is(err, ErrRoleExists) {
+		t.Fatalf("duplicate create err=%v want %v", err, ErrRoleExists)
+	}
+	if err := CreateCustomRole(e, "t1", "empty", nil); !errors.Is(err, ErrEmptyPermissions) {
+		t.Fatalf("empty create err=%v want %v", err, ErrEmptyPermissions)
+	}
+
+	sub, err := ResolveTenantRole(e, "t1", "support")
+	if err != nil {
+		t.Fatalf("ResolveTenantRole: %v", err)
+	}
+	if sub != "role:support" {
+		t.Fatalf("subject=%q want role:support", sub)
+	}
+	if _, err = ResolveTenantRole(e, "t2", "support"); err == nil {
+		t.Fatalf("expected custom role to be scoped to its tenant")
+	}
+
+	membersPath := "/api/v1/admin/tenants/:tenantId/members"
+	assertEnforce(t, e, sub, "tenant:t1", membersPath, "GET", true)
+	assertEnforce(t, e, sub, "tenant:t1", membersPath, "POST", false)
+	assertEnforce(t, e, sub, "tenant:t2", membersPath, "GET", false)
+
+	if err = UpdateCustomRole(e, "t1", "support", []string{PermMembersRead, PermMembersWrite}); err != nil {
+		t.Fatalf("UpdateCustomRole: %v", err)
+	}
+	assertEnforce(t, e, sub, "tenant:t1", membersPath+"/:uid", "PATCH", true)
+
+	if err = UpdateCustomRole(e, "t1", "support", []string{PermMembersWrite}); err != nil {
+		t.Fatalf("UpdateCustomRole narrow: %v", err)
+	}
+	assertEnforce(t, e, sub, "tenant:t1", membersPath, "GET", false)
+
+	roles, err := CustomRoles(e, "t1")
+	if err != nil {
+		t.Fatalf("CustomRoles: %v", err)
+	}
+	if len(roles) != 1 || roles[0].Name != "support" || !slices.Equal(roles[0].Permissions, []string{PermMembersWrite}) {
+		t.Fatalf("unexpected roles: %+v", roles)
+	}
+
+	removed, err := DeleteCustomRole(e, "t1", "support")
+	if err != nil || !removed {
+		t.Fatalf("DeleteCustomRole removed=%v err=%v", removed, err)
+	}
+	if err = UpdateCustomRole(e, "t1", "support", []string{PermMembersRead}); !errors.Is(err, ErrRoleNotFound) {
+		t.Fatalf("update deleted role err=%v want %v", err, ErrRoleNotFound)
+	}
+}
+
+func TestSubjectHasPermission(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	if err := CreateCustomRole(e, "t1", "auditor", []string{PermRolesRead}); err != nil {
+		t.Fatalf("CreateCustomRole: %v", err)
+	}
+
+	tests := []struct {
+		subject string
+		perm    string
+		want    bool
+	}{
+		{subject: TenantRoleOwner, perm: PermBillingManage, want: true},
+		{subject: TenantRoleAdmin, perm: PermRolesWrite, want: true},
+		{subject: TenantRoleMember, perm: PermMembersRead, want: false},
+		{subject: CustomRoleSubject("auditor"), perm: PermRolesRead, want: true},
+		{subject: CustomRoleSubject("auditor"), perm: PermRolesWrite, want: false},
+	}
+	for _, tt := range tests {
+		got, err := SubjectHasPermission(e, "t1", tt.subject, tt.perm)
+		if err != nil {
+			t.Fatalf("SubjectHasPermission: %v", err)
+		}
+		if got != tt.want {
+			t.Fatalf("SubjectHasPermission(%s, %s)=%v want %v", tt.subject, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func newMemoryEnforcer(t *testing.T) *casbin.SyncedEnforcer {
+	t.Helper()
+	_, filename, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("runtime.Caller failed")
+	}
+	e, err := casbin.NewSyncedEnforcer(filepath.Join(filepath.Dir(filename), "model.conf"))
+	if err != nil {
+		t.Fatalf("casbin.NewSyncedEnforcer: %v", err)
+	}
+	e.EnableAutoSave(false)
+	for _, rule := range permissionPolicyRules() {
+		if _, err = e.AddPolicy(rule.Subject, rule.Domain, rule.Object, rule.Action); err != nil {
+			t.Fatalf("AddPolicy: %v", err)
+		}
+	}
+	return e
+}
+
+func assertEnforce(t *testing.T, e casbin.IEnforcer, sub, dom, obj, act string, want bool) {
+	t.Helper()
+	got, err := e.Enforce(sub, dom, obj, act)
+	if err != nil {
+		t.Fatalf("Enforce(%s, %s, %s, %s): %v", sub, dom, obj, act, err)
+	}
+	if got != want {
+		t.Fatalf("Enforce(%s, %s, %s, %s)=%v want %v", sub, dom, obj, act, got, want)
+	}
+}
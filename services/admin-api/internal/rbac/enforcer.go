@@ -2,25 +2,41 @@ package rbac
 
 import (
 	"context"
+	_ "embed"
 	"fmt"
 
 	"github.com/casbin/casbin/v2"
 )
 
-func NewEnforcer(dbDSN, modelPath string) (*casbin.Enforcer, error) {
+// ModelText is the model.conf shipped with admin-api, for tools that check
+// rules without an enforcer.
+//
+//go:embed model.conf
+var ModelText string
+
+func NewEnforcer(dbDSN, modelPath string) (*casbin.SyncedEnforcer, error) {
 	adapter, err := NewPostgresAdapter(context.Background(), dbDSN)
 	if err != nil {
 		return nil, fmt.Errorf("init casbin postgres adapter: %w", err)
 	}
-	enforcer, err := casbin.NewEnforcer(modelPath, adapter)
+	enforcer, err := casbin.NewSyncedEnforcer(modelPath, adapter)
 	if err != nil {
 		return nil, fmt.Errorf("create casbin enforcer: %w", err)
 	}
+	RegisterConditionFunctions(enforcer)
 	if err = enforcer.LoadPolicy(); err != nil {
 		return nil, fmt.Errorf("load casbin policy: %w", err)
 	}
-	if _, err = SeedDefaultPolicy(enforcer); err != nil {
-		return nil, fmt.Errorf("seed default casbin policy: %w", err)
+	// Once a policy set has been applied the global policy is managed through
+	// PolicySets, and seeding would silently re-add rules it removed.
+	managed, err := policySetApplied(context.Background(), adapter.db)
+	if err != nil {
+		return nil, fmt.Errorf("check casbin policy versions: %w", err)
+	}
+	if !managed {
+		if _, err = SeedDefaultPolicy(enforcer); err != nil {
+			return nil, fmt.Errorf("seed default casbin policy: %w", err)
+		}
 	}
 	return enforcer, nil
 }
@@ -36,7 +36,7 @@ func TestEnforcerWithPostgresAdapter(t *testing.T) {
 	}
 
 	testutil.ApplyMigrations(t, db)
-	if _, err = db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule RESTART IDENTITY`); err != nil {
+	if _, err = db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule, casbin_policy_versions RESTART IDENTITY`); err != nil {
 		t.Fatalf("truncate casbin_rule: %v", err)
 	}
 
@@ -97,7 +97,7 @@ func TestSeedDefaultPolicyIdempotent(t *testing.T) {
 	})
 
 	testutil.ApplyMigrations(t, db)
-	if _, err = db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule RESTART IDENTITY`); err != nil {
+	if _, err = db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule, casbin_policy_versions RESTART IDENTITY`); err != nil {
 		t.Fatalf("truncate casbin_rule: %v", err)
 	}
 
@@ -150,7 +150,7 @@ func TestDefaultPolicyEnforce(t *testing.T) {
 	})
 
 	testutil.ApplyMigrations(t, db)
-	if _, err = db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule RESTART IDENTITY`); err != nil {
+	if _, err = db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule, casbin_policy_versions RESTART IDENTITY`); err != nil {
 		t.Fatalf("truncate casbin_rule: %v", err)
 	}
 
@@ -0,0 +1,48 @@
+package rbac
+
+import (
+	"github.com/casbin/casbin/v2"
+)
+
+// Decision is an explained enforcement result.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Subject string `json:"subject"`
+	Domain  string `json:"domain"`
+	Object  string `json:"object"`
+	Action  string `json:"action"`
+	// Roles are the subjects sub inherits from in the domain, i.e. the
+	// subjects whose policies were considered.
+	Roles []string `json:"roles"`
+	// MatchedPolicy is the policy line that allowed the request; it is empty
+	// on deny.
+	MatchedPolicy []string `json:"matched_policy"`
+}
+
+// Explain enforces (sub, dom, obj, act) with EnforceEx and reports which
+// policy matched along with the roles the subject holds in the domain.
+func Explain(enforcer casbin.IEnforcer, sub, dom, obj, act string) (Decision, error) {
+	allowed, matched, err := enforcer.EnforceEx(sub, dom, obj, act)
+	if err != nil {
+		return Decision{}, err
+	}
+	roles, err := enforcer.GetImplicitRolesForUser(sub, dom)
+	if err != nil {
+		return Decision{}, err
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	if matched == nil {
+		matched = []string{}
+	}
+	return Decision{
+		Allowed:       allowed,
+		Subject:       sub,
+		Domain:        dom,
+		Object:        obj,
+		Action:        act,
+		Roles:         roles,
+		MatchedPolicy: matched,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package rbac
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	if err := CreateCustomRole(e, "t1", "support", []string{PermMembersRead}); err != nil {
+		t.Fatalf("CreateCustomRole: %v", err)
+	}
+	obj := "/api/v1/admin/tenants/:tenantId/members"
+
+	allowed, err := Explain(e, CustomRoleSubject("support"), TenantDomain("t1"), obj, "GET")
+	if err != nil {
+		t.Fatalf("Explain allow: %v", err)
+	}
+	if !allowed.Allowed {
+		t.Fatalf("expected allow: %+v", allowed)
+	}
+	if want := []string{PermissionSubject(PermMembersRead), "tenant:*", obj, "GET"}; !slices.Equal(allowed.MatchedPolicy, want) {
+		t.Fatalf("matched policy=%v want %v", allowed.MatchedPolicy, want)
+	}
+	if !slices.Contains(allowed.Roles, PermissionSubject(PermMembersRead)) {
+		t.Fatalf("roles=%v want to contain %s", allowed.Roles, PermissionSubject(PermMembersRead))
+	}
+
+	denied, err := Explain(e, CustomRoleSubject("support"), TenantDomain("t1"), obj, "POST")
+	if err != nil {
+		t.Fatalf("Explain deny: %v", err)
+	}
+	if denied.Allowed || len(denied.MatchedPolicy) != 0 {
+		t.Fatalf("expected deny without matched policy: %+v", denied)
+	}
+}
@@ -0,0 +1,252 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+
+	"anvilkit-auth-template/modules/common-go/pkg/authz"
+)
+
+var (
+	ErrGroupCycle       = errors.New("group_cycle")
+	ErrInvalidGroupRole = errors.New("invalid_group_role")
+)
+
+// GroupGrants are what a group grants its members: tenant roles (built-in
+// admin/member or custom role names), catalog permissions and the grants of
+// other groups it is nested in.
+type GroupGrants struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	Groups      []string `json:"groups"`
+}
+
+// GroupSubject returns the Casbin subject of a tenant group.
+func GroupSubject(groupID string) string {
+	return authz.GroupSubject(groupID)
+}
+
+// GetGroupGrants returns the grants held directly by a group.
+func GetGroupGrants(enforcer casbin.IEnforcer, tenantID, groupID string) (GroupGrants, error) {
+	rules, err := enforcer.GetFilteredGroupingPolicy(0, GroupSubject(groupID), "", TenantDomain(tenantID))
+	if err != nil {
+		return GroupGrants{}, err
+	}
+	grants := GroupGrants{Roles: []string{}, Permissions: []string{}, Groups: []string{}}
+	for _, rule := range rules {
+		if len(rule) < 2 {
+			continue
+		}
+		if perm, ok := strings.CutPrefix(rule[1], authz.PermissionSubjectPrefix); ok {
+			grants.Permissions = append(grants.Permissions, perm)
+		} else if group, ok := strings.CutPrefix(rule[1], authz.GroupSubjectPrefix); ok {
+			grants.Groups = append(grants.Groups, group)
+		} else if role, ok := authz.TenantRoleName(rule[1]); ok {
+			grants.Roles = append(grants.Roles, role)
+		}
+	}
+	grants.Roles = SortTenantRoles(grants.Roles)
+	grants.Permissions = sortPermissions(grants.Permissions)
+	slices.Sort(grants.Groups)
+	return grants, nil
+}
+
+// SetGroupGrants replaces the grants of a group. Roles must be admin, member
+// or a custom role of the tenant; owner cannot be granted through a group.
+// Nesting a group inside one of its own descendants fails with ErrGroupCycle.
+// The caller checks that the groups named in grants.Groups exist.
+func SetGroupGrants(enforcer casbin.IEnforcer, tenantID, groupID string, grants GroupGrants) (GroupGrants, error) {
+	dom := TenantDomain(tenantID)
+	subject := GroupSubject(groupID)
+
+	perms, err := NormalizePermissions(grants.Permissions)
+	if err != nil {
+		return GroupGrants{}, err
+	}
+	roles := SortTenantRoles(grants.Roles)
+	targets := make([]string, 0, len(roles)+len(perms)+len(grants.Groups))
+	for _, role := range roles {
+		if role == "owner" {
+			return GroupGrants{}, fmt.Errorf("%w: %s", ErrInvalidGroupRole, role)
+		}
+		target, err := ResolveTenantRole(enforcer, tenantID, role)
+		if err != nil {
+			return GroupGrants{}, fmt.Errorf("%w: %s", ErrInvalidGroupRole, role)
+		}
+		targets = append(targets, target)
+	}
+	for _, p := range perms {
+		targets = append(targets, PermissionSubject(p))
+	}
+	groups := slices.Compact(slices.Sorted(slices.Values(grants.Groups)))
+	for _, parent := range groups {
+		if parent == groupID {
+			return GroupGrants{}, ErrGroupCycle
+		}
+		inherited, err := implicitRoles(enforcer, dom, GroupSubject(parent))
+		if err != nil {
+			return GroupGrants{}, err
+		}
+		if slices.Contains(inherited, subject) {
+			return GroupGrants{}, ErrGroupCycle
+		}
+		targets = append(targets, GroupSubject(parent))
+	}
+
+	current, err := enforcer.GetFilteredGroupingPolicy(0, subject, "", dom)
+	if err != nil {
+		return GroupGrants{}, err
+	}
+	held := make([]string, 0, len(current))
+	for _, rule := range current {
+		if len(rule) >= 2 {
+			held = append(held, rule[1])
+		}
+	}
+	// Add before removing so the group never transiently loses grants it
+	// keeps.
+	for _, target := range targets {
+		if slices.Contains(held, target) {
+			continue
+		}
+		if _, err = enforcer.AddGroupingPolicy(subject, target, dom); err != nil {
+			return GroupGrants{}, err
+		}
+	}
+	for _, target := range held {
+		if slices.Contains(targets, target) {
+			continue
+		}
+		if _, err = enforcer.RemoveGroupingPolicy(subject, target, dom); err != nil {
+			return GroupGrants{}, err
+		}
+	}
+	return GroupGrants{Roles: roles, Permissions: perms, Groups: groups}, nil
+}
+
+// DeleteGroupGrants removes a group's grants and its nesting into and under
+// other groups.
+func DeleteGroupGrants(enforcer casbin.IEnforcer, tenantID, groupID string) error {
+	dom := TenantDomain(tenantID)
+	if _, err := enforcer.RemoveFilteredGroupingPolicy(0, GroupSubject(groupID), "", dom); err != nil {
+		return err
+	}
+	_, err := enforcer.RemoveFilteredGroupingPolicy(1, GroupSubject(groupID), dom)
+	return err
+}
+
+// GroupRoles returns the tenant role names granted through the given groups,
+// following group nesting.
+func GroupRoles(enforcer casbin.IEnforcer, tenantID string, groupIDs []string) ([]string, error) {
+	dom := TenantDomain(tenantID)
+	var roles []string
+	for _, groupID := range groupIDs {
+		inherited, err := implicitRoles(enforcer, dom, GroupSubject(groupID))
+		if err != nil {
+			return nil, err
+		}
+		for _, subject := range inherited {
+			if role, ok := authz.TenantRoleName(subject); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return SortTenantRoles(roles), nil
+}
+
+// GroupPermissions returns the permissions granted through the given groups,
+// directly or through the roles they grant.
+func GroupPermissions(enforcer casbin.IEnforcer, tenantID string, groupIDs []string) ([]string, error) {
+	dom := TenantDomain(tenantID)
+	var perms []string
+	for _, groupID := range groupIDs {
+		inherited, err := implicitRoles(enforcer, dom, GroupSubject(groupID))
+		if err != nil {
+			return nil, err
+		}
+		for _, subject := range inherited {
+			if perm, ok := strings.CutPrefix(subject, authz.PermissionSubjectPrefix); ok && !slices.Contains(perms, perm) {
+				perms = append(perms, perm)
+			}
+		}
+	}
+	return sortPermissions(perms), nil
+}
+
+// GroupsWithRole returns the groups whose members hold role through group
+// grants, directly or through nesting.
+func GroupsWithRole(enforcer casbin.IEnforcer, tenantID, role string) ([]string, error) {
+	subject := CustomRoleSubject(role)
+	if IsBuiltinTenantRole(role) {
+		var err error
+		if subject, err = MapTenantRoleToCasbin(role); err != nil {
+			return nil, err
+		}
+	}
+	return inheritingGroups(enforcer, TenantDomain(tenantID), subject)
+}
+
+// NestedGroups returns the groups nested in groupID, directly or through
+// other groups; their members hold what groupID grants.
+func NestedGroups(enforcer casbin.IEnforcer, tenantID, groupID string) ([]string, error) {
+	return inheritingGroups(enforcer, TenantDomain(tenantID), GroupSubject(groupID))
+}
+
+// inheritingGroups returns the IDs of the groups inheriting subject in dom
+// through g rules, sorted.
+func inheritingGroups(enforcer casbin.IEnforcer, dom, subject string) ([]string, error) {
+	seen := map[string]bool{subject: true}
+	queue := []string{subject}
+	var groups []string
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		rules, err := enforcer.GetFilteredGroupingPolicy(1, name, dom)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if len(rule) < 1 || seen[rule[0]] {
+				continue
+			}
+			group, ok := strings.CutPrefix(rule[0], authz.GroupSubjectPrefix)
+			if !ok {
+				continue
+			}
+			seen[rule[0]] = true
+			groups = append(groups, group)
+			queue = append(queue, rule[0])
+		}
+	}
+	slices.Sort(groups)
+	return groups, nil
+}
+
+// implicitRoles returns every subject subject inherits in dom through g
+// rules, breadth first.
+func implicitRoles(enforcer casbin.IEnforcer, dom, subject string) ([]string, error) {
+	seen := map[string]bool{subject: true}
+	queue := []string{subject}
+	var out []string
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		rules, err := enforcer.GetFilteredGroupingPolicy(0, name, "", dom)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if len(rule) < 2 || seen[rule[1]] {
+				continue
+			}
+			seen[rule[1]] = true
+			out = append(out, rule[1])
+			queue = append(queue, rule[1])
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package rbac
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestGroupGrantsEnforce(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	if err := CreateCustomRole(e, "t1", "auditor", []string{PermRolesRead}); err != nil {
+		t.Fatalf("CreateCustomRole: %v", err)
+	}
+
+	// support is nested in staff: its members get auditor and
+	// members:read from staff and groups:read from support itself.
+	if _, err := SetGroupGrants(e, "t1", "staff", GroupGrants{Roles: []string{"auditor"}, Permissions: []string{PermMembersRead}}); err != nil {
+		t.Fatalf("SetGroupGrants(staff): %v", err)
+	}
+	got, err := SetGroupGrants(e, "t1", "support", GroupGrants{Permissions: []string{PermGroupsRead}, Groups: []string{"staff"}})
+	if err != nil {
+		t.Fatalf("SetGroupGrants(support): %v", err)
+	}
+	if !slices.Equal(got.Groups, []string{"staff"}) || !slices.Equal(got.Permissions, []string{PermGroupsRead}) {
+		t.Fatalf("SetGroupGrants returned %+v", got)
+	}
+
+	support := GroupSubject("support")
+	assertEnforce(t, e, support, "tenant:t1", "/api/v1/admin/tenants/:tenantId/roles", "GET", true)
+	assertEnforce(t, e, support, "tenant:t1", "/api/v1/admin/tenants/:tenantId/members", "GET", true)
+	assertEnforce(t, e, support, "tenant:t1", "/api/v1/admin/tenants/:tenantId/groups", "GET", true)
+	assertEnforce(t, e, support, "tenant:t1", "/api/v1/admin/tenants/:tenantId/roles", "POST", false)
+	assertEnforce(t, e, support, "tenant:t2", "/api/v1/admin/tenants/:tenantId/members", "GET", false)
+	assertEnforce(t, e, GroupSubject("staff"), "tenant:t1", "/api/v1/admin/tenants/:tenantId/groups", "GET", false)
+
+	roles, err := GroupRoles(e, "t1", []string{"support"})
+	if err != nil || !slices.Equal(roles, []string{"auditor"}) {
+		t.Fatalf("GroupRoles=%v, %v want [auditor]", roles, err)
+	}
+	perms, err := GroupPermissions(e, "t1", []string{"support"})
+	if err != nil {
+		t.Fatalf("GroupPermissions: %v", err)
+	}
+	for _, p := range []string{PermMembersRead, PermRolesRead, PermGroupsRead} {
+		if !slices.Contains(perms, p) {
+			t.Fatalf("GroupPermissions=%v missing %s", perms, p)
+		}
+	}
+	if ok, err := SubjectHasPermission(e, "t1", support, PermRolesRead); err != nil || !ok {
+		t.Fatalf("SubjectHasPermission through nested group=%v, %v", ok, err)
+	}
+
+	if err = DeleteGroupGrants(e, "t1", "staff"); err != nil {
+		t.Fatalf("DeleteGroupGrants: %v", err)
+	}
+	assertEnforce(t, e, support, "tenant:t1", "/api/v1/admin/tenants/:tenantId/members", "GET", false)
+	assertEnforce(t, e, support, "tenant:t1", "/api/v1/admin/tenants/:tenantId/groups", "GET", true)
+}
+
+func TestSetGroupGrantsRejectsInvalidGrants(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	if _, err := SetGroupGrants(e, "t1", "a", GroupGrants{Groups: []string{"b"}}); err != nil {
+		t.Fatalf("SetGroupGrants(a): %v", err)
+	}
+	if _, err := SetGroupGrants(e, "t1", "b", GroupGrants{Groups: []string{"c"}}); err != nil {
+		t.Fatalf("SetGroupGrants(b): %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		group  string
+		grants GroupGrants
+		want   error
+	}{
+		{name: "self", group: "a", grants: GroupGrants{Groups: []string{"a"}}, want: ErrGroupCycle},
+		{name: "cycle", group: "c", grants: GroupGrants{Groups: []string{"a"}}, want: ErrGroupCycle},
+		{name: "owner", group: "a", grants: GroupGrants{Roles: []string{"owner"}}, want: ErrInvalidGroupRole},
+		{name: "unknown role", group: "a", grants: GroupGrants{Roles: []string{"nope"}}, want: ErrInvalidGroupRole},
+		{name: "unknown permission", group: "a", grants: GroupGrants{Permissions: []string{"nope:read"}}, want: ErrUnknownPermission},
+	}
+	for _, tt := range tests {
+		if _, err := SetGroupGrants(e, "t1", tt.group, tt.grants); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: err=%v want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// A rejected update leaves the existing grants in place.
+	got, err := GetGroupGrants(e, "t1", "a")
+	if err != nil || !slices.Equal(got.Groups, []string{"b"}) {
+		t.Fatalf("GetGroupGrants=%+v, %v", got, err)
+	}
+}
+
+func TestGroupsWithRole(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	if err := CreateCustomRole(e, "t1", "auditor", []string{PermRolesRead}); err != nil {
+		t.Fatalf("CreateCustomRole: %v", err)
+	}
+	// support is nested in staff, which grants auditor; ops grants admin.
+	if _, err := SetGroupGrants(e, "t1", "staff", GroupGrants{Roles: []string{"auditor"}}); err != nil {
+		t.Fatalf("SetGroupGrants(staff): %v", err)
+	}
+	if _, err := SetGroupGrants(e, "t1", "support", GroupGrants{Groups: []string{"staff"}}); err != nil {
+		t.Fatalf("SetGroupGrants(support): %v", err)
+	}
+	if _, err := SetGroupGrants(e, "t1", "ops", GroupGrants{Roles: []string{"admin"}}); err != nil {
+		t.Fatalf("SetGroupGrants(ops): %v", err)
+	}
+
+	if got, err := GroupsWithRole(e, "t1", "auditor"); err != nil || !slices.Equal(got, []string{"staff", "support"}) {
+		t.Fatalf("GroupsWithRole(auditor)=%v, %v want [staff support]", got, err)
+	}
+	if got, err := GroupsWithRole(e, "t1", "admin"); err != nil || !slices.Equal(got, []string{"ops"}) {
+		t.Fatalf("GroupsWithRole(admin)=%v, %v want [ops]", got, err)
+	}
+	if got, err := GroupsWithRole(e, "t2", "auditor"); err != nil || len(got) != 0 {
+		t.Fatalf("GroupsWithRole in another tenant=%v, %v want none", got, err)
+	}
+	if got, err := NestedGroups(e, "t1", "staff"); err != nil || !slices.Equal(got, []string{"support"}) {
+		t.Fatalf("NestedGroups(staff)=%v, %v want [support]", got, err)
+	}
+}
@@ -0,0 +1,79 @@
+package rbac
+
+import (
+	"testing"
+)
+
+func TestOrganizationRolesInheritIntoChildTenants(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	for _, rule := range defaultPolicyRules {
+		if _, err := e.AddPolicy(rule.Subject, rule.Domain, rule.Object, rule.Action); err != nil {
+			t.Fatalf("AddPolicy: %v", err)
+		}
+	}
+	for _, orgID := range []string{"o1", "o2"} {
+		if err := LinkOrganization(e, orgID); err != nil {
+			t.Fatalf("LinkOrganization: %v", err)
+		}
+	}
+	if err := AttachTenant(e, "t1", "o1"); err != nil {
+		t.Fatalf("AttachTenant: %v", err)
+	}
+
+	members := "/api/v1/admin/tenants/:tenantId/members"
+	assertEnforce(t, e, OrgRoleAdmin, "tenant:t1", members, "GET", true)
+	assertEnforce(t, e, OrgRoleOwner, "tenant:t1", members, "DELETE", true)
+	assertEnforce(t, e, OrgRoleAdmin, "tenant:t2", members, "GET", false)
+	assertEnforce(t, e, OrgRoleAdmin, "org:o1", "/api/v1/admin/org/:orgId/tenants", "POST", true)
+	// Tenant roles do not reach the organization.
+	assertEnforce(t, e, TenantRoleOwner, "org:o1", "/api/v1/admin/org/:orgId/tenants", "GET", false)
+
+	if err := AttachTenant(e, "t1", "o2"); err != nil {
+		t.Fatalf("AttachTenant(o2): %v", err)
+	}
+	if got, err := TenantOrganization(e, "t1"); err != nil || got != "org:o2" {
+		t.Fatalf("TenantOrganization=%q, %v want org:o2", got, err)
+	}
+	assertEnforce(t, e, OrgRoleAdmin, "tenant:t1", members, "GET", true)
+
+	if err := DetachTenant(e, "t1"); err != nil {
+		t.Fatalf("DetachTenant: %v", err)
+	}
+	assertEnforce(t, e, OrgRoleAdmin, "tenant:t1", members, "GET", false)
+}
+
+func TestOrganizationMemberRankCondition(t *testing.T) {
+	e := newMemoryEnforcer(t)
+	RegisterConditionFunctions(e)
+	for _, rule := range defaultConditionRules {
+		if _, err := e.AddNamedPolicy(ConditionPtype, rule); err != nil {
+			t.Fatalf("AddNamedPolicy: %v", err)
+		}
+	}
+
+	obj := "/api/v1/admin/org/:orgId/members/:uid"
+	tests := []struct {
+		name        string
+		caller, tgt int
+		want        bool
+	}{
+		{name: "owner manages owner", caller: RankOwner, tgt: RankOwner, want: true},
+		{name: "admin adds new member", caller: RankAdmin, tgt: RankNone, want: true},
+		{name: "admin manages admin", caller: RankAdmin, tgt: RankAdmin, want: false},
+	}
+	for _, tt := range tests {
+		got, _, err := CheckConditions(e, OrgRoleAdmin, "org:o1", obj, "PUT", Attributes{CallerRank: tt.caller, TargetRank: tt.tgt})
+		if err != nil {
+			t.Fatalf("%s: CheckConditions: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: CheckConditions=%v want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Tenant-wide conditions stay out of organization domains.
+	got, _, err := CheckConditions(e, OrgRoleAdmin, "org:o1", "/api/v1/admin/tenants/:tenantId/members/:uid", "DELETE", Attributes{CallerRank: RankAdmin, TargetRank: RankOwner})
+	if err != nil || !got {
+		t.Fatalf("tenant condition applied to org domain: %v, %v", got, err)
+	}
+}
@@ -0,0 +1,166 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"anvilkit-auth-template/modules/common-go/pkg/authz"
+)
+
+const (
+	// PermMembersRead allows listing the members of a tenant.
+	PermMembersRead = "members:read"
+	// PermMembersWrite allows adding, updating and removing tenant members.
+	PermMembersWrite = "members:write"
+	// PermRolesRead allows listing tenant roles and the permission catalog.
+	PermRolesRead = "roles:read"
+	// PermRolesWrite allows creating, updating and deleting tenant custom roles.
+	PermRolesWrite = "roles:write"
+	// PermGroupsRead allows listing tenant groups, their members and grants.
+	PermGroupsRead = "groups:read"
+	// PermGroupsWrite allows managing tenant groups, their members and grants.
+	PermGroupsWrite = "groups:write"
+	// PermAuditRead allows querying the tenant's audit events.
+	PermAuditRead = "audit:read"
+	// PermWebhooksManage allows managing the tenant's webhook endpoints and
+	// inspecting and redelivering their deliveries.
+	PermWebhooksManage = "webhooks:manage"
+	// PermBillingManage allows managing tenant billing resources.
+	PermBillingManage = "billing:manage"
+)
+
+var ErrUnknownPermission = errors.New("unknown_permission")
+
+// Permission is a grantable capability in the admin API. Each permission is
+// backed by global Casbin policies on its own subject (see PermissionSubject);
+// roles receive it through a domain-scoped grouping rule.
+type Permission struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Objects     []string `json:"-"`
+	Action      string   `json:"-"`
+}
+
+var permissionCatalog = []Permission{
+	{
+		Name:        PermMembersRead,
+		Description: "List tenant members",
+		Objects:     []string{"/api/v1/admin/tenants/:tenantId/members"},
+		Action:      "GET",
+	},
+	{
+		Name:        PermMembersWrite,
+		Description: "Add, update and remove tenant members and their roles",
+		Objects:     []string{"/api/v1/admin/tenants/:tenantId/members", "/api/v1/admin/tenants/:tenantId/members/:uid", "/api/v1/admin/tenants/:tenantId/users/:userId/roles/:role"},
+		Action:      "(POST|PATCH|DELETE)",
+	},
+	{
+		Name:        PermRolesRead,
+		Description: "List tenant roles and the permission catalog",
+		Objects:     []string{"/api/v1/admin/tenants/:tenantId/roles", "/api/v1/admin/tenants/:tenantId/permissions"},
+		Action:      "GET",
+	},
+	{
+		Name:        PermRolesWrite,
+		Description: "Create, update and delete tenant custom roles",
+		Objects:     []string{"/api/v1/admin/tenants/:tenantId/roles", "/api/v1/admin/tenants/:tenantId/roles/:role"},
+		Action:      "(POST|PUT|DELETE)",
+	},
+	{
+		Name:        PermGroupsRead,
+		Description: "List tenant groups, their members and grants",
+		Objects:     []string{"/api/v1/admin/tenants/:tenantId/groups", "/api/v1/admin/tenants/:tenantId/groups/:groupId", "/api/v1/admin/tenants/:tenantId/groups/:groupId/grants"},
+		Action:      "GET",
+	},
+	{
+		Name:        PermGroupsWrite,
+		Description: "Create, update and delete tenant groups, their members and grants",
+		Objects: []string{
+			"/api/v1/admin/tenants/:tenantId/groups",
+			"/api/v1/admin/tenants/:tenantId/groups/:groupId",
+			"/api/v1/admin/tenants/:tenantId/groups/:groupId/members",
+			"/api/v1/admin/tenants/:tenantId/groups/:groupId/members/:userId",
+			"/api/v1/admin/tenants/:tenantId/groups/:groupId/grants",
+		},
+		Action: "(POST|PUT|PATCH|DELETE)",
+	},
+	{
+		Name:        PermAuditRead,
+		Description: "Query the tenant audit log",
+		Objects:     []string{"/api/v1/admin/tenants/:tenantId/audit-events"},
+		Action:      "GET",
+	},
+	{
+		Name:        PermWebhooksManage,
+		Description: "Manage tenant webhook endpoints and redeliver webhooks",
+		Objects: []string{
+			"/api/v1/admin/tenants/:tenantId/webhooks",
+			"/api/v1/admin/tenants/:tenantId/webhooks/:webhookId",
+			"/api/v1/admin/tenants/:tenantId/webhooks/:webhookId/rotate-secret",
+			"/api/v1/admin/tenants/:tenantId/webhooks/:webhookId/deliveries",
+			"/api/v1/admin/tenants/:tenantId/webhooks/:webhookId/deliveries/:deliveryId",
+			"/api/v1/admin/tenants/:tenantId/webhooks/:webhookId/deliveries/:deliveryId/redeliver",
+		},
+		Action: "(GET|POST|PATCH|DELETE)",
+	},
+	{
+		Name:        PermBillingManage,
+		Description: "Manage tenant billing",
+		Objects:     []string{"/api/v1/admin/tenants/:tenantId/billing/*"},
+		Action:      "*",
+	},
+}
+
+// Permissions returns a copy of the permission catalog in display order.
+func Permissions() []Permission {
+	out := make([]Permission, len(permissionCatalog))
+	copy(out, permissionCatalog)
+	return out
+}
+
+// LookupPermission returns the catalog entry for name.
+func LookupPermission(name string) (Permission, bool) {
+	for _, p := range permissionCatalog {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Permission{}, false
+}
+
+// PermissionSubject returns the Casbin subject that carries the policies of
+// the named permission.
+func PermissionSubject(name string) string {
+	return authz.PermissionSubject(name)
+}
+
+// NormalizePermissions validates names against the catalog and returns them
+// de-duplicated in catalog order.
+func NormalizePermissions(names []string) ([]string, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if _, ok := LookupPermission(n); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, n)
+		}
+		wanted[n] = true
+	}
+	out := make([]string, 0, len(wanted))
+	for _, p := range permissionCatalog {
+		if wanted[p.Name] {
+			out = append(out, p.Name)
+		}
+	}
+	return out, nil
+}
+
+func permissionPolicyRules() []policyRule {
+	rules := make([]policyRule, 0, len(permissionCatalog)*2)
+	for _, p := range permissionCatalog {
+		for _, obj := range p.Objects {
+			rules = append(rules, policyRule{Subject: PermissionSubject(p.Name), Domain: authz.TenantDomainWildcard, Object: obj, Action: p.Action})
+		}
+	}
+	return rules
+}
@@ -6,15 +6,33 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync/atomic"
 
 	casbinmodel "github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"anvilkit-auth-template/modules/common-go/pkg/authz"
 )
 
 type PostgresAdapter struct {
-	db *pgxpool.Pool
+	db       *pgxpool.Pool
+	filtered atomic.Bool
+}
+
+// Filter selects the rules loaded by LoadFilteredPolicy: p rules whose domain
+// (v1) and g rules whose domain (v2) is one of Domains, plus the g2 domain
+// links leading up from those domains.
+type Filter struct {
+	Domains []string
+}
+
+// TenantFilter returns a Filter for the policy that applies to tenantID: its
+// own domain, the global tenant:* policies and the org:* policies its
+// organization inherits.
+func TenantFilter(tenantID string) Filter {
+	return Filter{Domains: []string{TenantDomain(tenantID), authz.TenantDomainWildcard, OrgDomainWildcard}}
 }
 
 func NewPostgresAdapter(ctx context.Context, dsn string) (*PostgresAdapter, error) {
@@ -30,7 +48,50 @@ func NewPostgresAdapter(ctx context.Context, dsn string) (*PostgresAdapter, erro
 }
 
 func (a *PostgresAdapter) LoadPolicy(model casbinmodel.Model) error {
-	rows, err := a.db.Query(context.Background(), `SELECT ptype, v0, v1, v2, v3, v4, v5 FROM casbin_rule ORDER BY id`)
+	if err := a.loadRules(context.Background(), model, `SELECT ptype, v0, v1, v2, v3, v4, v5 FROM casbin_rule ORDER BY id`); err != nil {
+		return err
+	}
+	a.filtered.Store(false)
+	return nil
+}
+
+// LoadFilteredPolicy loads only the rules selected by filter, which must be a
+// Filter or *Filter. A nil filter loads the whole policy. Casbin refuses to
+// SavePolicy while the loaded policy is filtered.
+func (a *PostgresAdapter) LoadFilteredPolicy(model casbinmodel.Model, filter interface{}) error {
+	var f Filter
+	switch v := filter.(type) {
+	case nil:
+		return a.LoadPolicy(model)
+	case Filter:
+		f = v
+	case *Filter:
+		if v == nil {
+			return a.LoadPolicy(model)
+		}
+		f = *v
+	default:
+		return fmt.Errorf("unsupported casbin filter type %T", filter)
+	}
+	err := a.loadRules(context.Background(), model, `
+SELECT ptype, v0, v1, v2, v3, v4, v5 FROM casbin_rule
+WHERE (ptype LIKE 'p%' AND v1 = ANY($1)) OR (ptype LIKE 'g%' AND v2 = ANY($1))
+   OR (ptype = 'g2' AND (v0 = ANY($1) OR v0 IN (SELECT v1 FROM casbin_rule WHERE ptype = 'g2' AND v0 = ANY($1))))
+ORDER BY id`, f.Domains)
+	if err != nil {
+		return err
+	}
+	a.filtered.Store(true)
+	return nil
+}
+
+// IsFiltered reports whether the last load was filtered.
+func (a *PostgresAdapter) IsFiltered() bool {
+	return a.filtered.Load()
+}
+
+func (a *PostgresAdapter) loadRules(ctx context.Context, model casbinmodel.Model, query string, args ...any) error {
+	rows, err := a.db.Query(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -42,21 +103,9 @@ func (a *PostgresAdapter) LoadPolicy(model casbinmodel.Model) error {
 		if err = rows.Scan(&ptype, &vals[0], &vals[1], &vals[2], &vals[3], &vals[4], &vals[5]); err != nil {
 			return err
 		}
-		line := ptype
-		last := -1
-		parts := make([]string, 6)
-		for i := range vals {
-			if vals[i] != nil {
-				parts[i] = *vals[i]
-				if parts[i] != "" {
-					last = i
-				}
-			}
-		}
-		for i := 0; i <= last; i++ {
-			line += ", " + parts[i]
-		}
-		if err = persist.LoadPolicyLine(line, model); err != nil {
+		// Values may contain commas (condition expressions), so they are
+		// loaded as an array rather than re-parsed as a CSV line.
+		if err = persist.LoadPolicyArray(append([]string{ptype}, ruleValues(vals)...), model); err != nil {
 			return fmt.Errorf("load policy line: %w", err)
 		}
 	}
@@ -64,42 +113,25 @@ func (a *PostgresAdapter) LoadPolicy(model casbinmodel.Model) error {
 }
 
 func (a *PostgresAdapter) SavePolicy(model casbinmodel.Model) error {
-	tx, err := a.db.Begin(context.Background())
-	if err != nil {
-		return err
-	}
-	defer func() {
-		rollbackErr := tx.Rollback(context.Background())
-		if rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
-			log.Printf("rbac: tx rollback failed: %v", rollbackErr)
-		}
-	}()
-
-	if _, err = tx.Exec(context.Background(), `TRUNCATE TABLE casbin_rule RESTART IDENTITY`); err != nil {
-		return err
-	}
-
-	for ptype, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			if err = insertRule(context.Background(), tx, ptype, rule); err != nil {
-				return err
-			}
+	return a.inTx(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `TRUNCATE TABLE casbin_rule RESTART IDENTITY`); err != nil {
+			return err
 		}
-	}
-	for ptype, ast := range model["g"] {
-		for _, rule := range ast.Policy {
-			if err = insertRule(context.Background(), tx, ptype, rule); err != nil {
-				return err
+		for _, sec := range []string{"p", "g"} {
+			for ptype, ast := range model[sec] {
+				for _, rule := range ast.Policy {
+					if err := insertRule(ctx, tx, ptype, rule); err != nil {
+						return err
+					}
+				}
 			}
 		}
-	}
-
-	return tx.Commit(context.Background())
+		return nil
+	})
 }
 
 func (a *PostgresAdapter) AddPolicy(_ string, ptype string, rule []string) error {
-	_, err := a.db.Exec(context.Background(),
-		`INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5) VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+	_, err := a.db.Exec(context.Background(), insertRuleSQL,
 		ptype, valueAt(rule, 0), valueAt(rule, 1), valueAt(rule, 2), valueAt(rule, 3), valueAt(rule, 4), valueAt(rule, 5),
 	)
 	return err
@@ -112,7 +144,116 @@ func (a *PostgresAdapter) RemovePolicy(_ string, ptype string, rule []string) er
 }
 
 func (a *PostgresAdapter) RemoveFilteredPolicy(_ string, ptype string, fieldIndex int, fieldValues ...string) error {
-	base := `DELETE FROM casbin_rule WHERE ptype=$1`
+	query, args := buildFilteredQuery(`DELETE FROM casbin_rule WHERE ptype=$1`, ptype, fieldIndex, fieldValues)
+	_, err := a.db.Exec(context.Background(), query, args...)
+	return err
+}
+
+// AddPolicies inserts rules in a single transaction. Rules that already exist
+// are skipped.
+func (a *PostgresAdapter) AddPolicies(_ string, ptype string, rules [][]string) error {
+	return a.inTx(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		for _, rule := range rules {
+			if err := insertRule(ctx, tx, ptype, rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemovePolicies deletes rules in a single transaction.
+func (a *PostgresAdapter) RemovePolicies(_ string, ptype string, rules [][]string) error {
+	return a.inTx(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		for _, rule := range rules {
+			if err := deleteRule(ctx, tx, ptype, rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (a *PostgresAdapter) UpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePolicies(sec, ptype, [][]string{oldRule}, [][]string{newRule})
+}
+
+// UpdatePolicies replaces each of oldRules with the rule at the same index in
+// newRules, in a single transaction.
+func (a *PostgresAdapter) UpdatePolicies(_ string, ptype string, oldRules, newRules [][]string) error {
+	if len(oldRules) != len(newRules) {
+		return fmt.Errorf("update policies: %d old rules, %d new rules", len(oldRules), len(newRules))
+	}
+	return a.inTx(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		for i := range oldRules {
+			if err := deleteRule(ctx, tx, ptype, oldRules[i]); err != nil {
+				return err
+			}
+			if err := insertRule(ctx, tx, ptype, newRules[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateFilteredPolicies replaces the rules matching the field filter with
+// newRules in a single transaction and returns the replaced rules.
+func (a *PostgresAdapter) UpdateFilteredPolicies(_ string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	var oldRules [][]string
+	err := a.inTx(context.Background(), func(ctx context.Context, tx pgx.Tx) error {
+		query, args := buildFilteredQuery(`DELETE FROM casbin_rule WHERE ptype=$1`, ptype, fieldIndex, fieldValues)
+		rows, err := tx.Query(ctx, query+` RETURNING v0, v1, v2, v3, v4, v5`, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			vals := make([]*string, 6)
+			if err = rows.Scan(&vals[0], &vals[1], &vals[2], &vals[3], &vals[4], &vals[5]); err != nil {
+				rows.Close()
+				return err
+			}
+			oldRules = append(oldRules, ruleValues(vals))
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		for _, rule := range newRules {
+			if err = insertRule(ctx, tx, ptype, rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oldRules, nil
+}
+
+func (a *PostgresAdapter) inTx(ctx context.Context, fn func(context.Context, pgx.Tx) error) error {
+	return withTx(ctx, a.db, fn)
+}
+
+func withTx(ctx context.Context, db *pgxpool.Pool, fn func(context.Context, pgx.Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rollbackErr := tx.Rollback(ctx)
+		if rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			log.Printf("rbac: tx rollback failed: %v", rollbackErr)
+		}
+	}()
+	if err = fn(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func buildFilteredQuery(base, ptype string, fieldIndex int, fieldValues []string) (string, []any) {
 	args := []any{ptype}
 	argPos := 2
 	for i, v := range fieldValues {
@@ -124,17 +265,16 @@ func (a *PostgresAdapter) RemoveFilteredPolicy(_ string, ptype string, fieldInde
 		args = append(args, v)
 		argPos++
 	}
-	_, err := a.db.Exec(context.Background(), base, args...)
-	return err
+	return base, args
 }
 
 func buildPolicyQuery(base, ptype string, rule []string) (string, []any) {
 	args := []any{ptype}
 	argPos := 2
 	for i := 0; i < 6; i++ {
-		if i < len(rule) {
+		if v := valueAt(rule, i); v != nil {
 			base += fmt.Sprintf(" AND v%d=$%d", i, argPos)
-			args = append(args, rule[i])
+			args = append(args, v)
 			argPos++
 			continue
 		}
@@ -143,14 +283,39 @@ func buildPolicyQuery(base, ptype string, rule []string) (string, []any) {
 	return base, args
 }
 
+// insertRuleSQL skips rules that already exist; duplicates are rejected by
+// the uq_casbin_rule index.
+const insertRuleSQL = `INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5) VALUES ($1,$2,$3,$4,$5,$6,$7) ON CONFLICT DO NOTHING`
+
 func insertRule(ctx context.Context, tx pgx.Tx, ptype string, rule []string) error {
-	_, err := tx.Exec(ctx,
-		`INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5) VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+	_, err := tx.Exec(ctx, insertRuleSQL,
 		ptype, valueAt(rule, 0), valueAt(rule, 1), valueAt(rule, 2), valueAt(rule, 3), valueAt(rule, 4), valueAt(rule, 5),
 	)
 	return err
 }
 
+func deleteRule(ctx context.Context, tx pgx.Tx, ptype string, rule []string) error {
+	query, args := buildPolicyQuery(`DELETE FROM casbin_rule WHERE ptype=$1`, ptype, rule)
+	_, err := tx.Exec(ctx, query, args...)
+	return err
+}
+
+// ruleValues converts scanned v0..v5 columns to a rule, dropping trailing
+// empty values.
+func ruleValues(vals []*string) []string {
+	last := -1
+	parts := make([]string, len(vals))
+	for i := range vals {
+		if vals[i] != nil {
+			parts[i] = *vals[i]
+			if parts[i] != "" {
+				last = i
+			}
+		}
+	}
+	return parts[:last+1]
+}
+
 func valueAt(rule []string, idx int) any {
 	if idx >= len(rule) {
 		return nil
@@ -162,4 +327,9 @@ func valueAt(rule []string, idx int) any {
 	return v
 }
 
-var _ persist.Adapter = (*PostgresAdapter)(nil)
+var (
+	_ persist.Adapter          = (*PostgresAdapter)(nil)
+	_ persist.BatchAdapter     = (*PostgresAdapter)(nil)
+	_ persist.UpdatableAdapter = (*PostgresAdapter)(nil)
+	_ persist.FilteredAdapter  = (*PostgresAdapter)(nil)
+)
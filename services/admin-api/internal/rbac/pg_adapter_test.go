@@ -0,0 +1,228 @@
+package rbac_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
+	"anvilkit-auth-template/services/admin-api/internal/testutil"
+)
+
+func TestPostgresAdapterBatchAndUpdate(t *testing.T) {
+	dsn, db := mustAdapterDB(t)
+	adapter, err := rbac.NewPostgresAdapter(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("rbac.NewPostgresAdapter: %v", err)
+	}
+
+	rules := [][]string{
+		{"role:support", "perm:members:read", "tenant:t1"},
+		{"role:support", "perm:roles:read", "tenant:t1"},
+		{"role:support", "perm:members:read", "tenant:t1"},
+	}
+	if err = adapter.AddPolicies("g", "g", rules); err != nil {
+		t.Fatalf("AddPolicies: %v", err)
+	}
+	if err = adapter.AddPolicy("g", "g", rules[0]); err != nil {
+		t.Fatalf("AddPolicy duplicate: %v", err)
+	}
+	assertRuleCount(t, db, 2)
+
+	if err = adapter.UpdatePolicy("g", "g", rules[1], []string{"role:support", "perm:roles:write", "tenant:t1"}); err != nil {
+		t.Fatalf("UpdatePolicy: %v", err)
+	}
+	assertHasRule(t, db, "g", "role:support", "perm:roles:write", "tenant:t1")
+
+	old, err := adapter.UpdateFilteredPolicies("g", "g", [][]string{{"role:support", "perm:billing:manage", "tenant:t1"}}, 0, "role:support", "", "tenant:t1")
+	if err != nil {
+		t.Fatalf("UpdateFilteredPolicies: %v", err)
+	}
+	if len(old) != 2 {
+		t.Fatalf("replaced %d rules want 2: %v", len(old), old)
+	}
+	assertRuleCount(t, db, 1)
+
+	if err = adapter.RemovePolicies("g", "g", [][]string{{"role:support", "perm:billing:manage", "tenant:t1"}}); err != nil {
+		t.Fatalf("RemovePolicies: %v", err)
+	}
+	assertRuleCount(t, db, 0)
+}
+
+func TestPostgresAdapterBatchIsTransactional(t *testing.T) {
+	dsn, db := mustAdapterDB(t)
+	adapter, err := rbac.NewPostgresAdapter(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("rbac.NewPostgresAdapter: %v", err)
+	}
+
+	// Postgres text cannot hold NUL bytes, so the second insert fails.
+	err = adapter.AddPolicies("g", "g", [][]string{
+		{"role:support", "perm:members:read", "tenant:t1"},
+		{"role:support", "perm:\x00", "tenant:t1"},
+	})
+	if err == nil {
+		t.Fatalf("expected AddPolicies to fail for an invalid value")
+	}
+	assertRuleCount(t, db, 0)
+}
+
+func TestPostgresAdapterLoadFilteredPolicy(t *testing.T) {
+	dsn, _ := mustAdapterDB(t)
+	adapter, err := rbac.NewPostgresAdapter(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("rbac.NewPostgresAdapter: %v", err)
+	}
+	obj := "/api/v1/admin/tenants/:tenantId/members"
+	if err = adapter.AddPolicies("p", "p", [][]string{{"perm:members:read", "tenant:*", obj, "GET"}}); err != nil {
+		t.Fatalf("AddPolicies p: %v", err)
+	}
+	if err = adapter.AddPolicies("g", "g", [][]string{
+		{"role:support", "perm:members:read", "tenant:t1"},
+		{"role:support", "perm:members:read", "tenant:t2"},
+	}); err != nil {
+		t.Fatalf("AddPolicies g: %v", err)
+	}
+
+	e, err := casbin.NewSyncedEnforcer(modelPath(t), adapter)
+	if err != nil {
+		t.Fatalf("casbin.NewSyncedEnforcer: %v", err)
+	}
+	if err = e.LoadFilteredPolicy(rbac.TenantFilter("t1")); err != nil {
+		t.Fatalf("LoadFilteredPolicy: %v", err)
+	}
+	if !adapter.IsFiltered() {
+		t.Fatalf("expected adapter to report a filtered policy")
+	}
+
+	grouping, err := e.GetGroupingPolicy()
+	if err != nil {
+		t.Fatalf("GetGroupingPolicy: %v", err)
+	}
+	if !slices.EqualFunc(grouping, [][]string{{"role:support", "perm:members:read", "tenant:t1"}}, slices.Equal[[]string]) {
+		t.Fatalf("grouping policy=%v want only tenant:t1", grouping)
+	}
+	assertEnforce(t, e, "role:support", "tenant:t1", obj, "GET", true)
+	assertEnforce(t, e, "role:support", "tenant:t2", obj, "GET", false)
+
+	if err = e.SavePolicy(); err == nil {
+		t.Fatalf("expected SavePolicy to refuse a filtered policy")
+	}
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	if adapter.IsFiltered() {
+		t.Fatalf("expected full load to clear the filtered flag")
+	}
+	assertEnforce(t, e, "role:support", "tenant:t2", obj, "GET", true)
+}
+
+func TestTenantAccessRulesPersistLongAllowlist(t *testing.T) {
+	dsn, db := mustAdapterDB(t)
+	adapter, err := rbac.NewPostgresAdapter(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("rbac.NewPostgresAdapter: %v", err)
+	}
+	e, err := casbin.NewSyncedEnforcer(modelPath(t), adapter)
+	if err != nil {
+		t.Fatalf("casbin.NewSyncedEnforcer: %v", err)
+	}
+
+	var allowlist []string
+	for i := range 20 {
+		allowlist = append(allowlist, fmt.Sprintf("10.%d.0.0/16", i))
+	}
+	rules, err := rbac.NormalizeTenantAccessRules(rbac.TenantAccessRules{
+		IPAllowlist:   allowlist,
+		BusinessHours: "Mon-Fri 09:00-17:00 America/Argentina/ComodRivadavia",
+	})
+	if err != nil {
+		t.Fatalf("NormalizeTenantAccessRules: %v", err)
+	}
+	if err = rbac.SetTenantAccessRules(e, "t1", rules); err != nil {
+		t.Fatalf("SetTenantAccessRules: %v", err)
+	}
+
+	rules.IPAllowlist = rules.IPAllowlist[:10]
+	if err = rbac.SetTenantAccessRules(e, "t1", rules); err != nil {
+		t.Fatalf("SetTenantAccessRules(replace): %v", err)
+	}
+	assertRuleCount(t, db, 2)
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	got, err := rbac.GetTenantAccessRules(e, "t1")
+	if err != nil {
+		t.Fatalf("GetTenantAccessRules: %v", err)
+	}
+	if !slices.Equal(got.IPAllowlist, rules.IPAllowlist) || got.BusinessHours != rules.BusinessHours {
+		t.Fatalf("rules=%+v want %+v", got, rules)
+	}
+}
+
+func mustAdapterDB(t *testing.T) (string, *pgxpool.Pool) {
+	t.Helper()
+	dsn := strings.TrimSpace(os.Getenv("TEST_DB_DSN"))
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+
+	db, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("pgxpool.New: %v", err)
+	}
+	lockConn := lockDB(t, db)
+	t.Cleanup(func() {
+		unlockDB(t, lockConn)
+		lockConn.Release()
+		db.Close()
+	})
+
+	testutil.ApplyMigrations(t, db)
+	if _, err = db.Exec(context.Background(), `TRUNCATE TABLE casbin_rule, casbin_policy_versions RESTART IDENTITY`); err != nil {
+		t.Fatalf("truncate casbin_rule: %v", err)
+	}
+	return dsn, db
+}
+
+func assertRuleCount(t *testing.T, db *pgxpool.Pool, want int) {
+	t.Helper()
+	var got int
+	if err := db.QueryRow(context.Background(), `select count(*) from casbin_rule`).Scan(&got); err != nil {
+		t.Fatalf("count casbin_rule: %v", err)
+	}
+	if got != want {
+		t.Fatalf("casbin_rule rows=%d want=%d", got, want)
+	}
+}
+
+func assertHasRule(t *testing.T, db *pgxpool.Pool, ptype, v0, v1, v2 string) {
+	t.Helper()
+	var ok bool
+	err := db.QueryRow(context.Background(), `select exists(select 1 from casbin_rule where ptype=$1 and v0=$2 and v1=$3 and v2=$4)`, ptype, v0, v1, v2).Scan(&ok)
+	if err != nil {
+		t.Fatalf("query casbin_rule: %v", err)
+	}
+	if !ok {
+		t.Fatalf("missing rule %s, %s, %s, %s", ptype, v0, v1, v2)
+	}
+}
+
+func assertEnforce(t *testing.T, e casbin.IEnforcer, sub, dom, obj, act string, want bool) {
+	t.Helper()
+	got, err := e.Enforce(sub, dom, obj, act)
+	if err != nil {
+		t.Fatalf("Enforce(%s, %s, %s, %s): %v", sub, dom, obj, act, err)
+	}
+	if got != want {
+		t.Fatalf("Enforce(%s, %s, %s, %s)=%v want %v", sub, dom, obj, act, got, want)
+	}
+}
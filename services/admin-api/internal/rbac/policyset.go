@@ -0,0 +1,432 @@
+package rbac
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	casbinmodel "github.com/casbin/casbin/v2/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"anvilkit-auth-template/modules/common-go/pkg/authz"
+)
+
+var (
+	ErrPolicyVersionConflict = errors.New("policy_version_conflict")
+	ErrPolicyVersionNotFound = errors.New("policy_version_not_found")
+	ErrInvalidPolicyRule     = errors.New("invalid_policy_rule")
+	ErrTenantScopedRule      = errors.New("tenant_scoped_rule")
+)
+
+// Policy set formats accepted by ParsePolicy and WritePolicy.
+const (
+	PolicyFormatCSV  = "csv"
+	PolicyFormatJSON = "json"
+)
+
+// globalRuleSQL selects the rules managed as a policy set: everything except
+// rules bound to a concrete tenant domain, which belong to tenant custom roles,
+// and the domain links maintained for organizations.
+const globalRuleSQL = `NOT (
+  (ptype LIKE 'p%' AND COALESCE(v1, '') LIKE 'tenant:%' AND v1 <> 'tenant:*') OR
+  (ptype LIKE 'g%' AND COALESCE(v2, '') LIKE 'tenant:%' AND v2 <> 'tenant:*') OR
+  ptype = 'g2'
+)`
+
+// policyLockKey serializes policy set applies across processes.
+const policyLockKey int64 = 240831
+
+// Rule is a single Casbin policy line.
+type Rule struct {
+	Ptype  string   `json:"ptype"`
+	Values []string `json:"values"`
+}
+
+// String renders the rule in Casbin CSV form, e.g. "p, sub, dom, obj, act".
+// Values containing commas or quotes, such as condition expressions, are
+// quoted.
+func (r Rule) String() string {
+	fields := make([]string, 0, len(r.Values)+1)
+	fields = append(fields, r.Ptype)
+	for _, v := range r.Values {
+		if strings.ContainsAny(v, ",\"\n") {
+			v = `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+		}
+		fields = append(fields, v)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// PolicySet is the global policy at a version. Version 0 means the policy has
+// never been applied as a set.
+type PolicySet struct {
+	Version int64  `json:"version"`
+	Rules   []Rule `json:"rules"`
+}
+
+// PolicyDiff lists the rules a desired policy set adds and removes relative to
+// the current one.
+type PolicyDiff struct {
+	Added   []Rule `json:"added"`
+	Removed []Rule `json:"removed"`
+}
+
+// Empty reports whether the diff has no changes.
+func (d PolicyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// PolicyVersion describes one applied policy set.
+type PolicyVersion struct {
+	Version   int64     `json:"version"`
+	Checksum  string    `json:"checksum"`
+	RuleCount int       `json:"rule_count"`
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ApplyOptions control PolicySets.Apply.
+type ApplyOptions struct {
+	// ExpectedVersion, when set, makes Apply fail with
+	// ErrPolicyVersionConflict unless it matches the current version.
+	ExpectedVersion *int64
+	Comment         string
+	Actor           string
+}
+
+// ParsePolicy reads a policy set in CSV (Casbin policy lines; blank lines and
+// lines starting with # are skipped) or JSON (a PolicySet; its version is
+// ignored) form. Rules are validated, de-duplicated and sorted.
+func ParsePolicy(r io.Reader, format string) ([]Rule, error) {
+	var rules []Rule
+	switch format {
+	case PolicyFormatCSV:
+		reader := csv.NewReader(r)
+		reader.Comment = '#'
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidPolicyRule, err)
+			}
+			if len(record) < 2 {
+				line, _ := reader.FieldPos(0)
+				return nil, fmt.Errorf("%w: line %d", ErrInvalidPolicyRule, line)
+			}
+			rules = append(rules, Rule{Ptype: record[0], Values: record[1:]})
+		}
+	case PolicyFormatJSON:
+		var set PolicySet
+		if err := json.NewDecoder(r).Decode(&set); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPolicyRule, err)
+		}
+		rules = set.Rules
+	default:
+		return nil, fmt.Errorf("unsupported policy format %q", format)
+	}
+	return normalizeRules(rules)
+}
+
+// WritePolicy writes set in CSV or JSON form.
+func WritePolicy(w io.Writer, set PolicySet, format string) error {
+	switch format {
+	case PolicyFormatCSV:
+		if _, err := fmt.Fprintf(w, "# policy version %d\n", set.Version); err != nil {
+			return err
+		}
+		for _, r := range set.Rules {
+			if _, err := fmt.Fprintln(w, r.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case PolicyFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(set)
+	default:
+		return fmt.Errorf("unsupported policy format %q", format)
+	}
+}
+
+// DiffPolicy compares two normalized rule sets.
+func DiffPolicy(current, desired []Rule) PolicyDiff {
+	diff := PolicyDiff{Added: []Rule{}, Removed: []Rule{}}
+	have := make(map[string]bool, len(current))
+	for _, r := range current {
+		have[r.String()] = true
+	}
+	want := make(map[string]bool, len(desired))
+	for _, r := range desired {
+		want[r.String()] = true
+		if !have[r.String()] {
+			diff.Added = append(diff.Added, r)
+		}
+	}
+	for _, r := range current {
+		if !want[r.String()] {
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+	return diff
+}
+
+// PolicyChecksum returns a stable hash of a normalized rule set, usable to
+// compare policy between environments.
+func PolicyChecksum(rules []Rule) string {
+	var buf bytes.Buffer
+	for _, r := range rules {
+		buf.WriteString(r.String())
+		buf.WriteByte('\n')
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// PolicySets manages the global Casbin policy as versioned sets stored in
+// casbin_policy_versions. Tenant-scoped rules in casbin_rule are never read or
+// written by it.
+type PolicySets struct {
+	db    *pgxpool.Pool
+	model casbinmodel.Model
+}
+
+// NewPolicySets returns PolicySets that only apply rules m can load, m being
+// the model of the enforcers reading casbin_rule.
+func NewPolicySets(db *pgxpool.Pool, m casbinmodel.Model) *PolicySets {
+	return &PolicySets{db: db, model: m}
+}
+
+// Current returns the global rules in casbin_rule and the latest version.
+func (p *PolicySets) Current(ctx context.Context) (PolicySet, error) {
+	tx, err := p.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly, IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return PolicySet{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	return currentPolicySet(ctx, tx)
+}
+
+// Apply atomically replaces the global rules in casbin_rule with rules and
+// records the result as a new version. Callers must reload enforcers
+// afterwards.
+func (p *PolicySets) Apply(ctx context.Context, rules []Rule, opts ApplyOptions) (PolicyVersion, PolicyDiff, error) {
+	rules, err := normalizeRules(rules)
+	if err != nil {
+		return PolicyVersion{}, PolicyDiff{}, err
+	}
+	// A rule the model cannot load would break LoadPolicy on every replica,
+	// and on restart, once committed.
+	if err = checkRules(p.model, rules); err != nil {
+		return PolicyVersion{}, PolicyDiff{}, err
+	}
+
+	var (
+		version PolicyVersion
+		diff    PolicyDiff
+	)
+	err = withTx(ctx, p.db, func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, policyLockKey); err != nil {
+			return err
+		}
+		current, err := currentPolicySet(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if opts.ExpectedVersion != nil && *opts.ExpectedVersion != current.Version {
+			return fmt.Errorf("%w: current version is %d", ErrPolicyVersionConflict, current.Version)
+		}
+		diff = DiffPolicy(current.Rules, rules)
+
+		if _, err = tx.Exec(ctx, `DELETE FROM casbin_rule WHERE `+globalRuleSQL); err != nil {
+			return err
+		}
+		for _, r := range rules {
+			if err = insertRule(ctx, tx, r.Ptype, r.Values); err != nil {
+				return err
+			}
+		}
+
+		snapshot, err := json.Marshal(rules)
+		if err != nil {
+			return err
+		}
+		version = PolicyVersion{
+			Checksum:  PolicyChecksum(rules),
+			RuleCount: len(rules),
+			Comment:   opts.Comment,
+			CreatedBy: opts.Actor,
+		}
+		return tx.QueryRow(ctx, `
+INSERT INTO casbin_policy_versions (rules, checksum, rule_count, comment, created_by)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING version, created_at`,
+			snapshot, version.Checksum, version.RuleCount, version.Comment, version.CreatedBy,
+		).Scan(&version.Version, &version.CreatedAt)
+	})
+	if err != nil {
+		return PolicyVersion{}, PolicyDiff{}, err
+	}
+	return version, diff, nil
+}
+
+// History lists applied versions, newest first.
+func (p *PolicySets) History(ctx context.Context, limit int) ([]PolicyVersion, error) {
+	rows, err := p.db.Query(ctx, `
+SELECT version, checksum, rule_count, comment, created_by, created_at
+FROM casbin_policy_versions
+ORDER BY version DESC
+LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]PolicyVersion, 0)
+	for rows.Next() {
+		var v PolicyVersion
+		if err = rows.Scan(&v.Version, &v.Checksum, &v.RuleCount, &v.Comment, &v.CreatedBy, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// Version returns the rules recorded for an applied version.
+func (p *PolicySets) Version(ctx context.Context, version int64) (PolicySet, error) {
+	var snapshot []byte
+	err := p.db.QueryRow(ctx, `SELECT rules FROM casbin_policy_versions WHERE version = $1`, version).Scan(&snapshot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PolicySet{}, ErrPolicyVersionNotFound
+	}
+	if err != nil {
+		return PolicySet{}, err
+	}
+	set := PolicySet{Version: version}
+	if err = json.Unmarshal(snapshot, &set.Rules); err != nil {
+		return PolicySet{}, err
+	}
+	return set, nil
+}
+
+// Rollback re-applies the rules of an earlier version as a new version.
+func (p *PolicySets) Rollback(ctx context.Context, version int64, opts ApplyOptions) (PolicyVersion, PolicyDiff, error) {
+	set, err := p.Version(ctx, version)
+	if err != nil {
+		return PolicyVersion{}, PolicyDiff{}, err
+	}
+	if opts.Comment == "" {
+		opts.Comment = fmt.Sprintf("rollback to version %d", version)
+	}
+	return p.Apply(ctx, set.Rules, opts)
+}
+
+func policySetApplied(ctx context.Context, db *pgxpool.Pool) (bool, error) {
+	var applied bool
+	err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM casbin_policy_versions)`).Scan(&applied)
+	return applied, err
+}
+
+func currentPolicySet(ctx context.Context, tx pgx.Tx) (PolicySet, error) {
+	var set PolicySet
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM casbin_policy_versions`).Scan(&set.Version); err != nil {
+		return PolicySet{}, err
+	}
+	rows, err := tx.Query(ctx, `SELECT ptype, v0, v1, v2, v3, v4, v5 FROM casbin_rule WHERE `+globalRuleSQL)
+	if err != nil {
+		return PolicySet{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ptype string
+		vals := make([]*string, 6)
+		if err = rows.Scan(&ptype, &vals[0], &vals[1], &vals[2], &vals[3], &vals[4], &vals[5]); err != nil {
+			return PolicySet{}, err
+		}
+		set.Rules = append(set.Rules, Rule{Ptype: ptype, Values: ruleValues(vals)})
+	}
+	if err = rows.Err(); err != nil {
+		return PolicySet{}, err
+	}
+	if set.Rules, err = normalizeRules(set.Rules); err != nil {
+		return PolicySet{}, err
+	}
+	return set, nil
+}
+
+// normalizeRules validates rules for use as a global policy set and returns
+// them trimmed, de-duplicated and sorted.
+func normalizeRules(rules []Rule) ([]Rule, error) {
+	seen := make(map[string]bool, len(rules))
+	out := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		r.Ptype = strings.TrimSpace(r.Ptype)
+		values := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			values[i] = strings.TrimSpace(v)
+		}
+		for len(values) > 0 && values[len(values)-1] == "" {
+			values = values[:len(values)-1]
+		}
+		r.Values = values
+
+		if (!strings.HasPrefix(r.Ptype, "p") && !strings.HasPrefix(r.Ptype, "g")) || len(r.Values) == 0 || len(r.Values) > 6 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPolicyRule, r)
+		}
+		if isTenantScoped(r) {
+			return nil, fmt.Errorf("%w: %s", ErrTenantScopedRule, r)
+		}
+		if key := r.String(); !seen[key] {
+			seen[key] = true
+			out = append(out, r)
+		}
+	}
+	slices.SortFunc(out, func(a, b Rule) int { return strings.Compare(a.String(), b.String()) })
+	return out, nil
+}
+
+// checkRules verifies that each rule's ptype is defined by m and that the
+// rule has a value for every field of that ptype.
+func checkRules(m casbinmodel.Model, rules []Rule) error {
+	for _, r := range rules {
+		assertion, err := m.GetAssertion(r.Ptype[:1], r.Ptype)
+		if err != nil {
+			return fmt.Errorf("%w: unknown ptype: %s", ErrInvalidPolicyRule, r)
+		}
+		if len(r.Values) != len(assertion.Tokens) {
+			return fmt.Errorf("%w: %s has %d values, want %d", ErrInvalidPolicyRule, r, len(r.Values), len(assertion.Tokens))
+		}
+	}
+	return nil
+}
+
+func isTenantScoped(r Rule) bool {
+	if r.Ptype == DomainLinkPtype {
+		return true
+	}
+	idx := 1
+	if strings.HasPrefix(r.Ptype, "g") {
+		idx = 2
+	}
+	if idx >= len(r.Values) {
+		return false
+	}
+	dom := r.Values[idx]
+	return strings.HasPrefix(dom, authz.TenantDomainPrefix) && dom != authz.TenantDomainWildcard
+}
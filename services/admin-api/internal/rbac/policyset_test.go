@@ -0,0 +1,126 @@
+package rbac
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	casbinmodel "github.com/casbin/casbin/v2/model"
+)
+
+func TestParsePolicyCSV(t *testing.T) {
+	input := `# policy version 3
+p, tenant_admin, tenant:*, /api/v1/admin/*, (GET|POST)
+
+g,  org_admin ,tenant_admin, tenant:*
+p, tenant_admin, tenant:*, /api/v1/admin/*, (GET|POST)
+`
+	rules, err := ParsePolicy(strings.NewReader(input), PolicyFormatCSV)
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	want := []string{
+		"g, org_admin, tenant_admin, tenant:*",
+		"p, tenant_admin, tenant:*, /api/v1/admin/*, (GET|POST)",
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("rules=%v want %v", rules, want)
+	}
+	for i, r := range rules {
+		if r.String() != want[i] {
+			t.Fatalf("rule %d=%q want %q", i, r, want[i])
+		}
+	}
+}
+
+func TestParsePolicyRejectsInvalidRules(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		format string
+		want   error
+	}{
+		{name: "unknown ptype", input: "x, a, b", format: PolicyFormatCSV, want: ErrInvalidPolicyRule},
+		{name: "missing values", input: "p", format: PolicyFormatCSV, want: ErrInvalidPolicyRule},
+		{name: "tenant scoped grouping", input: "g, role:support, perm:members:read, tenant:t1", format: PolicyFormatCSV, want: ErrTenantScopedRule},
+		{name: "organization domain link", input: "g2, tenant:t1, org:o1", format: PolicyFormatCSV, want: ErrTenantScopedRule},
+		{name: "tenant scoped policy", input: `{"rules":[{"ptype":"p","values":["a","tenant:t1","/x","GET"]}]}`, format: PolicyFormatJSON, want: ErrTenantScopedRule},
+		{name: "malformed json", input: `{"rules":`, format: PolicyFormatJSON, want: ErrInvalidPolicyRule},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParsePolicy(strings.NewReader(tc.input), tc.format)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err=%v want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckRulesAgainstModel(t *testing.T) {
+	m, err := casbinmodel.NewModelFromString(ModelText)
+	if err != nil {
+		t.Fatalf("NewModelFromString: %v", err)
+	}
+	valid := []Rule{
+		{Ptype: "p", Values: []string{"tenant_admin", "tenant:*", "/api/v1/admin/*", "GET"}},
+		{Ptype: "p2", Values: []string{"*", "tenant:*", "/api/v1/admin/*", "*", "true", "deny"}},
+		{Ptype: "g", Values: []string{"org_admin", "tenant_admin", "tenant:*"}},
+	}
+	if err = checkRules(m, valid); err != nil {
+		t.Fatalf("checkRules: %v", err)
+	}
+
+	cases := map[string]Rule{
+		"unknown ptype":  {Ptype: "p9", Values: []string{"a", "tenant:*", "/x", "GET"}},
+		"short p rule":   {Ptype: "p", Values: []string{"tenant_admin", "tenant:*", "/api/v1/admin/*"}},
+		"long p rule":    {Ptype: "p", Values: []string{"tenant_admin", "tenant:*", "/api/v1/admin/*", "GET", "deny"}},
+		"short p2 rule":  {Ptype: "p2", Values: []string{"*", "tenant:*", "/api/v1/admin/*", "*", "true"}},
+		"short grouping": {Ptype: "g", Values: []string{"org_admin", "tenant_admin"}},
+	}
+	for name, rule := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := checkRules(m, []Rule{rule}); !errors.Is(err, ErrInvalidPolicyRule) {
+				t.Fatalf("err=%v want %v", err, ErrInvalidPolicyRule)
+			}
+		})
+	}
+}
+
+func TestWritePolicyRoundTrip(t *testing.T) {
+	set := PolicySet{Version: 7, Rules: []Rule{
+		{Ptype: "g", Values: []string{"org_admin", "tenant_admin", "tenant:*"}},
+		{Ptype: "p", Values: []string{"tenant_admin", "tenant:*", "/api/v1/admin/*", "GET"}},
+	}}
+	for _, format := range []string{PolicyFormatCSV, PolicyFormatJSON} {
+		var buf bytes.Buffer
+		if err := WritePolicy(&buf, set, format); err != nil {
+			t.Fatalf("WritePolicy %s: %v", format, err)
+		}
+		rules, err := ParsePolicy(&buf, format)
+		if err != nil {
+			t.Fatalf("ParsePolicy %s: %v", format, err)
+		}
+		if PolicyChecksum(rules) != PolicyChecksum(set.Rules) {
+			t.Fatalf("%s round trip changed rules: %v", format, rules)
+		}
+	}
+}
+
+func TestDiffPolicy(t *testing.T) {
+	a := Rule{Ptype: "p", Values: []string{"a", "tenant:*", "/x", "GET"}}
+	b := Rule{Ptype: "p", Values: []string{"b", "tenant:*", "/x", "GET"}}
+	c := Rule{Ptype: "g", Values: []string{"c", "a", "tenant:*"}}
+
+	diff := DiffPolicy([]Rule{a, b}, []Rule{b, c})
+	if len(diff.Added) != 1 || diff.Added[0].String() != c.String() {
+		t.Fatalf("added=%v want [%s]", diff.Added, c)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].String() != a.String() {
+		t.Fatalf("removed=%v want [%s]", diff.Removed, a)
+	}
+	if !DiffPolicy([]Rule{a}, []Rule{a}).Empty() {
+		t.Fatalf("expected empty diff for identical sets")
+	}
+}
@@ -1,28 +1,42 @@
 package rbac
 
-import "fmt"
+import (
+	"fmt"
+
+	"anvilkit-auth-template/modules/common-go/pkg/authz"
+)
 
 const (
 	// TenantRoleOwner is the Casbin role identifier used in RBAC policies for a tenant owner.
-	TenantRoleOwner = "tenant_owner"
+	TenantRoleOwner = authz.SubjectTenantOwner
 	// TenantRoleAdmin is the Casbin role identifier used in RBAC policies for a tenant administrator.
-	TenantRoleAdmin = "tenant_admin"
+	TenantRoleAdmin = authz.SubjectTenantAdmin
 	// TenantRoleMember is the Casbin role identifier used in RBAC policies for a tenant member.
-	TenantRoleMember = "member"
+	TenantRoleMember = authz.SubjectTenantMember
 )
 
+// IsBuiltinTenantRole reports whether role is one of the built-in tenant role
+// names ("owner", "admin", "member").
+func IsBuiltinTenantRole(role string) bool {
+	return authz.IsBuiltinTenantRole(role)
+}
+
 // MapTenantRoleToCasbin maps tenant role names ("owner", "admin", "member")
 // to their corresponding Casbin role identifiers. It returns an error if the
 // provided role name does not match a supported tenant role.
 func MapTenantRoleToCasbin(role string) (string, error) {
-	switch role {
-	case "owner":
-		return TenantRoleOwner, nil
-	case "admin":
-		return TenantRoleAdmin, nil
-	case "member":
-		return TenantRoleMember, nil
-	default:
-		return "", fmt.Errorf("invalid tenant role: %s", role)
+	if subject, ok := authz.BuiltinTenantRoleSubject(role); ok {
+		return subject, nil
 	}
+	return "", fmt.Errorf("invalid tenant role: %s", role)
+}
+
+// MaxMemberRoles caps the roles a tenant member can hold; it matches the cap
+// on the roles claim of tenant access tokens.
+const MaxMemberRoles = 16
+
+// SortTenantRoles de-duplicates tenant role names and orders them owner,
+// admin, custom roles alphabetically, then member.
+func SortTenantRoles(roles []string) []string {
+	return authz.SortTenantRoles(roles)
 }
@@ -0,0 +1,14 @@
+package rbac
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSortTenantRoles(t *testing.T) {
+	got := SortTenantRoles([]string{"member", "support", "owner", "billing", "support", "admin"})
+	want := []string{"owner", "admin", "billing", "support", "member"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("SortTenantRoles=%v want %v", got, want)
+	}
+}
@@ -1,6 +1,10 @@
 package rbac
 
-import "github.com/casbin/casbin/v2"
+import (
+	"slices"
+
+	"github.com/casbin/casbin/v2"
+)
 
 type policyRule struct {
 	Subject string
@@ -14,15 +18,29 @@ var defaultPolicyRules = []policyRule{
 	{Subject: "tenant_admin", Domain: "tenant:*", Object: "/v1/admin/*", Action: "*"},
 	{Subject: "tenant_owner", Domain: "tenant:*", Object: "/api/v1/admin/*", Action: "*"},
 	{Subject: "tenant_admin", Domain: "tenant:*", Object: "/api/v1/admin/*", Action: "*"},
+	// Organization roles apply to the organization and, through domain links,
+	// to each of its child tenants.
+	{Subject: "org_owner", Domain: "org:*", Object: "/api/v1/admin/*", Action: "*"},
+	{Subject: "org_admin", Domain: "org:*", Object: "/api/v1/admin/*", Action: "*"},
+}
+
+// defaultConditionRules restrict member management to members ranked below
+// the caller (owners may manage anyone).
+var defaultConditionRules = [][]string{
+	{"*", "tenant:*", "/api/v1/admin/tenants/:tenantId/members/:uid", "(PATCH|DELETE)", MemberRankCondition, "deny"},
+	{"*", "tenant:*", "/api/v1/admin/tenants/:tenantId/users/:userId/roles/:role", "(POST|DELETE)", MemberRankCondition, "deny"},
+	{"*", "org:*", "/api/v1/admin/org/:orgId/members/:uid", "(PUT|DELETE)", MemberRankCondition, "deny"},
 }
 
-// SeedDefaultPolicy adds default RBAC policies to the given enforcer if they do not already exist.
+// SeedDefaultPolicy adds default RBAC policies, including the policies backing
+// each catalog permission and the default access conditions, to the given
+// enforcer if they do not already exist.
 // It is idempotent: calling it multiple times will not create duplicate policies.
 // It returns true if any policies were added and persisted, false if no changes were made,
 // and an error if checking, adding, or saving policies fails.
-func SeedDefaultPolicy(enforcer *casbin.Enforcer) (bool, error) {
+func SeedDefaultPolicy(enforcer casbin.IEnforcer) (bool, error) {
 	changed := false
-	for _, rule := range defaultPolicyRules {
+	for _, rule := range slices.Concat(defaultPolicyRules, permissionPolicyRules()) {
 		has, err := enforcer.HasPolicy(rule.Subject, rule.Domain, rule.Object, rule.Action)
 		if err != nil {
 			return false, err
@@ -38,6 +56,26 @@ func SeedDefaultPolicy(enforcer *casbin.Enforcer) (bool, error) {
 			changed = true
 		}
 	}
+	for _, rule := range defaultConditionRules {
+		params := make([]interface{}, len(rule))
+		for i, v := range rule {
+			params[i] = v
+		}
+		has, err := enforcer.HasNamedPolicy(ConditionPtype, params...)
+		if err != nil {
+			return false, err
+		}
+		if has {
+			continue
+		}
+		added, err := enforcer.AddNamedPolicy(ConditionPtype, params...)
+		if err != nil {
+			return false, err
+		}
+		if added {
+			changed = true
+		}
+	}
 	if !changed {
 		return false, nil
 	}
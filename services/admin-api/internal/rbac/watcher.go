@@ -0,0 +1,304 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// DefaultWatcherChannel is the Redis pub/sub channel policy changes are
+// broadcast on.
+const DefaultWatcherChannel = "casbin:policy"
+
+const (
+	watcherPublishTimeout = 5 * time.Second
+	watcherRetryDelay     = time.Second
+)
+
+// Policy update methods carried in watcher messages.
+const (
+	updateAddPolicies          = "add_policies"
+	updateRemovePolicies       = "remove_policies"
+	updateRemoveFilteredPolicy = "remove_filtered_policy"
+	updateUpdatePolicies       = "update_policies"
+	updateReload               = "reload"
+)
+
+var (
+	_ persist.WatcherEx        = (*RedisWatcher)(nil)
+	_ persist.UpdatableWatcher = (*RedisWatcher)(nil)
+)
+
+// PolicyUpdate is the message a RedisWatcher publishes after a local policy
+// change. Replicas apply incremental updates in place and fall back to a full
+// LoadPolicy for "reload" or anything they cannot apply.
+type PolicyUpdate struct {
+	Instance    string     `json:"instance"`
+	Method      string     `json:"method"`
+	Sec         string     `json:"sec,omitempty"`
+	Ptype       string     `json:"ptype,omitempty"`
+	Rules       [][]string `json:"rules,omitempty"`
+	OldRules    [][]string `json:"old_rules,omitempty"`
+	FieldIndex  int        `json:"field_index,omitempty"`
+	FieldValues []string   `json:"field_values,omitempty"`
+}
+
+// RedisWatcher is a Casbin watcher that keeps the policy of admin-api replicas
+// in sync over Redis pub/sub. Messages published by an instance are ignored by
+// that instance.
+type RedisWatcher struct {
+	rdb      *goredis.Client
+	channel  string
+	instance string
+	pubsub   *goredis.PubSub
+
+	mu       sync.RWMutex
+	callback func(string)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewRedisWatcher subscribes to channel and starts delivering policy updates
+// from other instances to the update callback.
+func NewRedisWatcher(ctx context.Context, rdb *goredis.Client, channel string) (*RedisWatcher, error) {
+	if channel == "" {
+		channel = DefaultWatcherChannel
+	}
+	pubsub := rdb.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, fmt.Errorf("subscribe casbin watcher channel: %w", err)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	w := &RedisWatcher{
+		rdb:      rdb,
+		channel:  channel,
+		instance: uuid.NewString(),
+		pubsub:   pubsub,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go w.run(runCtx)
+	return w, nil
+}
+
+// WatchPolicy attaches w to enforcer so local changes are broadcast and
+// changes made by other replicas are applied to enforcer.
+func WatchPolicy(enforcer *casbin.SyncedEnforcer, w *RedisWatcher) error {
+	if err := enforcer.SetWatcher(w); err != nil {
+		return err
+	}
+	return w.SetUpdateCallback(PolicyUpdateCallback(enforcer))
+}
+
+// SetUpdateCallback sets the function called with each raw message received
+// from another instance.
+func (w *RedisWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update asks other instances to reload the full policy.
+func (w *RedisWatcher) Update() error {
+	return w.publish(PolicyUpdate{Method: updateReload})
+}
+
+// UpdateForSavePolicy asks other instances to reload the full policy.
+func (w *RedisWatcher) UpdateForSavePolicy(model.Model) error {
+	return w.Update()
+}
+
+func (w *RedisWatcher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return w.UpdateForAddPolicies(sec, ptype, params)
+}
+
+func (w *RedisWatcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return w.UpdateForRemovePolicies(sec, ptype, params)
+}
+
+func (w *RedisWatcher) UpdateForAddPolicies(sec, ptype string, rules ...[]string) error {
+	return w.publish(PolicyUpdate{Method: updateAddPolicies, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+func (w *RedisWatcher) UpdateForRemovePolicies(sec, ptype string, rules ...[]string) error {
+	return w.publish(PolicyUpdate{Method: updateRemovePolicies, Sec: sec, Ptype: ptype, Rules: rules})
+}
+
+func (w *RedisWatcher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.publish(PolicyUpdate{Method: updateRemoveFilteredPolicy, Sec: sec, Ptype: ptype, FieldIndex: fieldIndex, FieldValues: fieldValues})
+}
+
+func (w *RedisWatcher) UpdateForUpdatePolicy(sec, ptype string, oldRule, newRule []string) error {
+	return w.UpdateForUpdatePolicies(sec, ptype, [][]string{oldRule}, [][]string{newRule})
+}
+
+func (w *RedisWatcher) UpdateForUpdatePolicies(sec, ptype string, oldRules, newRules [][]string) error {
+	return w.publish(PolicyUpdate{Method: updateUpdatePolicies, Sec: sec, Ptype: ptype, OldRules: oldRules, Rules: newRules})
+}
+
+// Close unsubscribes and stops delivering updates.
+func (w *RedisWatcher) Close() {
+	w.once.Do(func() {
+		w.cancel()
+		_ = w.pubsub.Close()
+		<-w.done
+	})
+}
+
+func (w *RedisWatcher) publish(update PolicyUpdate) error {
+	update.Instance = w.instance
+	payload, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), watcherPublishTimeout)
+	defer cancel()
+	if err = w.rdb.Publish(ctx, w.channel, payload).Err(); err != nil {
+		return fmt.Errorf("publish casbin policy update: %w", err)
+	}
+	return nil
+}
+
+// PublishReload asks every replica listening on channel to reload the full
+// policy. It is used by tools that write casbin_rule without an enforcer.
+func PublishReload(ctx context.Context, rdb *goredis.Client, channel string) error {
+	if channel == "" {
+		channel = DefaultWatcherChannel
+	}
+	payload, err := json.Marshal(PolicyUpdate{Instance: uuid.NewString(), Method: updateReload})
+	if err != nil {
+		return err
+	}
+	if err = rdb.Publish(ctx, channel, payload).Err(); err != nil {
+		return fmt.Errorf("publish casbin policy reload: %w", err)
+	}
+	return nil
+}
+
+func (w *RedisWatcher) run(ctx context.Context) {
+	defer close(w.done)
+	for {
+		msg, err := w.pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, goredis.ErrClosed) {
+				return
+			}
+			log.Printf("admin-api rbac watcher: receive failed: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watcherRetryDelay):
+			}
+			continue
+		}
+		switch m := msg.(type) {
+		case *goredis.Subscription:
+			// go-redis resubscribes after a reconnect; anything published
+			// while disconnected was lost, so catch up with a full reload.
+			if m.Kind == "subscribe" {
+				w.deliver(w.reloadMessage())
+			}
+		case *goredis.Message:
+			var update PolicyUpdate
+			if err := json.Unmarshal([]byte(m.Payload), &update); err == nil && update.Instance == w.instance {
+				continue
+			}
+			w.deliver(m.Payload)
+		}
+	}
+}
+
+func (w *RedisWatcher) deliver(payload string) {
+	w.mu.RLock()
+	callback := w.callback
+	w.mu.RUnlock()
+	if callback != nil {
+		callback(payload)
+	}
+}
+
+func (w *RedisWatcher) reloadMessage() string {
+	payload, _ := json.Marshal(PolicyUpdate{Method: updateReload})
+	return string(payload)
+}
+
+// PolicyUpdateCallback returns a watcher callback that applies PolicyUpdate
+// messages to enforcer. Incremental updates only touch the in-memory model:
+// the originating replica has already persisted them through the adapter.
+// Unknown or unparsable messages, and updates that fail to apply, trigger a
+// full LoadPolicy.
+func PolicyUpdateCallback(enforcer *casbin.SyncedEnforcer) func(string) {
+	return func(payload string) {
+		var update PolicyUpdate
+		if err := json.Unmarshal([]byte(payload), &update); err != nil {
+			log.Printf("admin-api rbac watcher: invalid policy update, reloading: %v", err)
+			reloadPolicy(enforcer)
+			return
+		}
+		if err := applyPolicyUpdate(enforcer, update); err != nil {
+			log.Printf("admin-api rbac watcher: apply %s failed, reloading: %v", update.Method, err)
+			reloadPolicy(enforcer)
+		}
+	}
+}
+
+func applyPolicyUpdate(enforcer *casbin.SyncedEnforcer, update PolicyUpdate) error {
+	if update.Method == updateReload || update.Method == "" {
+		return enforcer.LoadPolicy()
+	}
+
+	// The Self* methods skip the watcher but still write through the adapter
+	// when auto-save is on. Detaching the adapter under the enforcer lock
+	// keeps the change in memory without racing local writers, and leaves
+	// the auto-save setting as the caller chose it.
+	lock := enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+	e := enforcer.Enforcer
+	adapter := e.GetAdapter()
+	e.SetAdapter(nil)
+	defer e.SetAdapter(adapter)
+
+	var err error
+	switch update.Method {
+	case updateAddPolicies:
+		_, err = e.SelfAddPoliciesEx(update.Sec, update.Ptype, update.Rules)
+	case updateRemovePolicies:
+		_, err = e.SelfRemovePolicies(update.Sec, update.Ptype, update.Rules)
+	case updateRemoveFilteredPolicy:
+		_, err = e.SelfRemoveFilteredPolicy(update.Sec, update.Ptype, update.FieldIndex, update.FieldValues...)
+	case updateUpdatePolicies:
+		if len(update.OldRules) == len(update.Rules) {
+			_, err = e.SelfUpdatePolicies(update.Sec, update.Ptype, update.OldRules, update.Rules)
+			break
+		}
+		// A filtered update may replace a different number of rules.
+		if _, err = e.SelfRemovePolicies(update.Sec, update.Ptype, update.OldRules); err == nil {
+			_, err = e.SelfAddPoliciesEx(update.Sec, update.Ptype, update.Rules)
+		}
+	default:
+		err = fmt.Errorf("unknown policy update method %q", update.Method)
+	}
+	return err
+}
+
+func reloadPolicy(enforcer *casbin.SyncedEnforcer) {
+	if err := enforcer.LoadPolicy(); err != nil {
+		log.Printf("admin-api rbac watcher: reload policy failed: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package rbac_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+
+	"anvilkit-auth-template/services/admin-api/internal/rbac"
+	"anvilkit-auth-template/services/admin-api/internal/testutil"
+)
+
+func TestRedisWatcherSyncsTwoEnforcers(t *testing.T) {
+	rdb := testutil.MustTestRedis(t)
+	channel := "casbin:policy:test:" + uuid.NewString()
+
+	policyPath := filepath.Join(t.TempDir(), "policy.csv")
+	if err := os.WriteFile(policyPath, nil, 0o600); err != nil {
+		t.Fatalf("write policy file: %v", err)
+	}
+	a := newWatchedEnforcer(t, rdb, channel, policyPath)
+	b := newWatchedEnforcer(t, rdb, channel, policyPath)
+
+	obj := "/api/v1/admin/tenants/:tenantId/members"
+
+	if _, err := a.AddPolicy("perm:members:read", "tenant:*", obj, "GET"); err != nil {
+		t.Fatalf("AddPolicy: %v", err)
+	}
+	if _, err := a.AddGroupingPolicy("role:support", "perm:members:read", "tenant:t1"); err != nil {
+		t.Fatalf("AddGroupingPolicy: %v", err)
+	}
+	waitForEnforce(t, b, "role:support", "tenant:t1", obj, "GET", true)
+
+	if _, err := a.RemoveFilteredGroupingPolicy(0, "role:support", "", "tenant:t1"); err != nil {
+		t.Fatalf("RemoveFilteredGroupingPolicy: %v", err)
+	}
+	waitForEnforce(t, b, "role:support", "tenant:t1", obj, "GET", false)
+
+	if _, err := a.AddGroupingPolicy("role:support", "perm:members:read", "tenant:t1"); err != nil {
+		t.Fatalf("AddGroupingPolicy: %v", err)
+	}
+	waitForEnforce(t, b, "role:support", "tenant:t1", obj, "GET", true)
+	if _, err := a.RemovePolicy("perm:members:read", "tenant:*", obj, "GET"); err != nil {
+		t.Fatalf("RemovePolicy: %v", err)
+	}
+	waitForEnforce(t, b, "role:support", "tenant:t1", obj, "GET", false)
+
+	// A change made without notification only reaches b through the
+	// full-reload path triggered by SavePolicy.
+	a.EnableAutoNotifyWatcher(false)
+	if _, err := a.AddPolicy("perm:members:read", "tenant:*", obj, "GET"); err != nil {
+		t.Fatalf("AddPolicy: %v", err)
+	}
+	a.EnableAutoNotifyWatcher(true)
+	if err := a.SavePolicy(); err != nil {
+		t.Fatalf("SavePolicy: %v", err)
+	}
+	waitForEnforce(t, b, "role:support", "tenant:t1", obj, "GET", true)
+}
+
+func TestPolicyUpdateCallbackAppliesIncrementalUpdates(t *testing.T) {
+	e, err := casbin.NewSyncedEnforcer(modelPath(t))
+	if err != nil {
+		t.Fatalf("casbin.NewSyncedEnforcer: %v", err)
+	}
+	apply := rbac.PolicyUpdateCallback(e)
+	send := func(update rbac.PolicyUpdate) {
+		t.Helper()
+		payload, err := json.Marshal(update)
+		if err != nil {
+			t.Fatalf("marshal update: %v", err)
+		}
+		apply(string(payload))
+	}
+
+	obj := "/api/v1/admin/tenants/:tenantId/roles"
+	send(rbac.PolicyUpdate{Method: "add_policies", Sec: "p", Ptype: "p", Rules: [][]string{{"perm:roles:read", "tenant:*", obj, "GET"}}})
+	send(rbac.PolicyUpdate{Method: "add_policies", Sec: "g", Ptype: "g", Rules: [][]string{{"role:auditor", "perm:roles:read", "tenant:t1"}}})
+	assertEnforced(t, e, "role:auditor", "tenant:t1", obj, "GET", true)
+
+	send(rbac.PolicyUpdate{Method: "update_policies", Sec: "p", Ptype: "p",
+		OldRules: [][]string{{"perm:roles:read", "tenant:*", obj, "GET"}},
+		Rules:    [][]string{{"perm:roles:read", "tenant:*", obj, "(GET|HEAD)"}},
+	})
+	assertEnforced(t, e, "role:auditor", "tenant:t1", obj, "HEAD", true)
+
+	send(rbac.PolicyUpdate{Method: "update_policies", Sec: "g", Ptype: "g",
+		OldRules: [][]string{{"role:auditor", "perm:roles:read", "tenant:t1"}},
+		Rules:    [][]string{{"role:auditor", "perm:roles:read", "tenant:t1"}, {"role:viewer", "perm:roles:read", "tenant:t1"}},
+	})
+	assertEnforced(t, e, "role:viewer", "tenant:t1", obj, "GET", true)
+
+	send(rbac.PolicyUpdate{Method: "remove_filtered_policy", Sec: "g", Ptype: "g", FieldIndex: 2, FieldValues: []string{"tenant:t1"}})
+	assertEnforced(t, e, "role:auditor", "tenant:t1", obj, "GET", false)
+}
+
+func TestPolicyUpdateCallbackKeepsAutoSaveSetting(t *testing.T) {
+	for _, autoSave := range []bool{false, true} {
+		adapter := &recordingAdapter{}
+		e, err := casbin.NewSyncedEnforcer(modelPath(t), adapter)
+		if err != nil {
+			t.Fatalf("casbin.NewSyncedEnforcer: %v", err)
+		}
+		e.EnableAutoSave(autoSave)
+		payload, err := json.Marshal(rbac.PolicyUpdate{Method: "add_policies", Sec: "g", Ptype: "g", Rules: [][]string{{"role:auditor", "perm:roles:read", "tenant:t1"}}})
+		if err != nil {
+			t.Fatalf("marshal update: %v", err)
+		}
+		rbac.PolicyUpdateCallback(e)(string(payload))
+		if adapter.writes != 0 {
+			t.Fatalf("autoSave=%v: remote update written through the adapter %d times", autoSave, adapter.writes)
+		}
+
+		if _, err = e.SelfAddPolicy("g", "g", []string{"role:viewer", "perm:roles:read", "tenant:t1"}); err != nil {
+			t.Fatalf("SelfAddPolicy: %v", err)
+		}
+		if want := map[bool]int{false: 0, true: 1}[autoSave]; adapter.writes != want {
+			t.Fatalf("autoSave=%v: local writes=%d want %d", autoSave, adapter.writes, want)
+		}
+	}
+}
+
+// recordingAdapter counts the policy writes casbin makes through it.
+type recordingAdapter struct {
+	writes int
+}
+
+func (a *recordingAdapter) LoadPolicy(model.Model) error { return nil }
+func (a *recordingAdapter) SavePolicy(model.Model) error { return nil }
+func (a *recordingAdapter) AddPolicy(string, string, []string) error {
+	a.writes++
+	return nil
+}
+func (a *recordingAdapter) AddPolicies(string, string, [][]string) error {
+	a.writes++
+	return nil
+}
+func (a *recordingAdapter) RemovePolicy(string, string, []string) error {
+	a.writes++
+	return nil
+}
+func (a *recordingAdapter) RemovePolicies(string, string, [][]string) error {
+	a.writes++
+	return nil
+}
+func (a *recordingAdapter) RemoveFilteredPolicy(string, string, int, ...string) error {
+	a.writes++
+	return nil
+}
+
+func newWatchedEnforcer(t *testing.T, rdb *goredis.Client, channel, policyPath string) *casbin.SyncedEnforcer {
+	t.Helper()
+	e, err := casbin.NewSyncedEnforcer(modelPath(t), fileadapter.NewAdapter(policyPath))
+	if err != nil {
+		t.Fatalf("casbin.NewSyncedEnforcer: %v", err)
+	}
+	w, err := rbac.NewRedisWatcher(context.Background(), rdb, channel)
+	if err != nil {
+		t.Fatalf("rbac.NewRedisWatcher: %v", err)
+	}
+	t.Cleanup(w.Close)
+	if err = rbac.WatchPolicy(e, w); err != nil {
+		t.Fatalf("rbac.WatchPolicy: %v", err)
+	}
+	return e
+}
+
+func waitForEnforce(t *testing.T, e *casbin.SyncedEnforcer, sub, dom, obj, act string, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		got, err := e.Enforce(sub, dom, obj, act)
+		if err != nil {
+			t.Fatalf("Enforce: %v", err)
+		}
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Enforce(%s, %s, %s, %s)=%v want %v after 3s", sub, dom, obj, act, got, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func assertEnforced(t *testing.T, e *casbin.SyncedEnforcer, sub, dom, obj, act string, want bool) {
+	t.Helper()
+	got, err := e.Enforce(sub, dom, obj, act)
+	if err != nil {
+		t.Fatalf("Enforce: %v", err)
+	}
+	if got != want {
+		t.Fatalf("Enforce(%s, %s, %s, %s)=%v want %v", sub, dom, obj, act, got, want)
+	}
+}
@@ -0,0 +1,297 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrGroupExists is returned when a group's display name or external ID
+	// is already used in the tenant.
+	ErrGroupExists = errors.New("group_exists")
+	// ErrNotTenantMember is returned when adding a user who is not a member of
+	// the tenant to one of its groups.
+	ErrNotTenantMember = errors.New("not_tenant_member")
+)
+
+type GroupDTO struct {
+	ID          string
+	DisplayName string
+	ExternalID  *string
+	Members     []GroupMemberDTO
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type GroupMemberDTO struct {
+	UserID string
+	Email  string
+}
+
+// GroupUpdate carries the fields of a group to change; nil fields are kept.
+// An empty ExternalID clears it.
+type GroupUpdate struct {
+	DisplayName *string
+	ExternalID  *string
+}
+
+// ListGroups lists the tenant's groups without their members, optionally
+// only the one with the given external ID.
+func (s *Store) ListGroups(ctx context.Context, tenantID, externalID string) ([]GroupDTO, error) {
+	rows, err := s.DB.Query(ctx, `
+select id, display_name, external_id, created_at, updated_at
+from tenant_groups
+where tenant_id = $1 and ($2 = '' or external_id = $2)
+order by display_name asc`, tenantID, externalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]GroupDTO, 0)
+	for rows.Next() {
+		var g GroupDTO
+		if err := rows.Scan(&g.ID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// Group returns a group with its members.
+func (s *Store) Group(ctx context.Context, tenantID, groupID string) (GroupDTO, bool, error) {
+	var g GroupDTO
+	err := s.DB.QueryRow(ctx, `select id, display_name, external_id, created_at, updated_at from tenant_groups where tenant_id = $1 and id = $2`, tenantID, groupID).
+		Scan(&g.ID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return GroupDTO{}, false, nil
+	}
+	if err != nil {
+		return GroupDTO{}, false, err
+	}
+
+	rows, err := s.DB.Query(ctx, `
+select gm.user_id, coalesce(u.email, '')
+from tenant_group_members gm
+join users u on u.id = gm.user_id
+where gm.group_id = $1
+order by gm.created_at asc, gm.user_id asc`, groupID)
+	if err != nil {
+		return GroupDTO{}, false, err
+	}
+	defer rows.Close()
+	g.Members = make([]GroupMemberDTO, 0)
+	for rows.Next() {
+		var m GroupMemberDTO
+		if err := rows.Scan(&m.UserID, &m.Email); err != nil {
+			return GroupDTO{}, false, err
+		}
+		g.Members = append(g.Members, m)
+	}
+	return g, true, rows.Err()
+}
+
+// GroupsExist reports whether every one of groupIDs is a group of the tenant.
+func (s *Store) GroupsExist(ctx context.Context, tenantID string, groupIDs []string) (bool, error) {
+	if len(groupIDs) == 0 {
+		return true, nil
+	}
+	var n int
+	err := s.DB.QueryRow(ctx, `select count(*) from tenant_groups where tenant_id = $1 and id = any($2)`, tenantID, groupIDs).Scan(&n)
+	return n == len(groupIDs), err
+}
+
+// CreateGroup creates a group with the given members.
+func (s *Store) CreateGroup(ctx context.Context, tenantID, displayName string, externalID *string, members []string) (GroupDTO, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return GroupDTO{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	g := GroupDTO{ID: uuid.NewString(), DisplayName: displayName, ExternalID: externalID}
+	err = tx.QueryRow(ctx, `
+insert into tenant_groups(id, tenant_id, display_name, external_id, created_at, updated_at)
+values($1, $2, $3, $4, now(), now())
+returning created_at, updated_at`, g.ID, tenantID, displayName, externalID).Scan(&g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return GroupDTO{}, groupError(err)
+	}
+	if err = insertGroupMembers(ctx, tx, tenantID, g.ID, members); err != nil {
+		return GroupDTO{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return GroupDTO{}, err
+	}
+	return g, nil
+}
+
+// UpdateGroup changes a group's display name and/or external ID. It reports
+// whether the group exists.
+func (s *Store) UpdateGroup(ctx context.Context, tenantID, groupID string, update GroupUpdate) (bool, error) {
+	cmd, err := s.DB.Exec(ctx, `
+update tenant_groups
+set display_name = coalesce($3, display_name),
+    external_id = case when $4::text is null then external_id else nullif($4, '') end,
+    updated_at = now()
+where tenant_id = $1 and id = $2`, tenantID, groupID, update.DisplayName, update.ExternalID)
+	if err != nil {
+		return false, groupError(err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+func (s *Store) DeleteGroup(ctx context.Context, tenantID, groupID string) (bool, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// The members lose what the group granted along with their membership.
+	if _, err = tx.Exec(ctx, bumpGroupMembersSQL, tenantID, []string{groupID}); err != nil {
+		return false, err
+	}
+	cmd, err := tx.Exec(ctx, `delete from tenant_groups where tenant_id = $1 and id = $2`, tenantID, groupID)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, nil
+	}
+	return true, tx.Commit(ctx)
+}
+
+// SetGroupMembers replaces the members of a group and invalidates the
+// authorization claims of the users added or removed. It reports whether the
+// group exists.
+func (s *Store) SetGroupMembers(ctx context.Context, tenantID, groupID string, members []string) (bool, error) {
+	if members == nil {
+		members = []string{}
+	}
+	return s.withGroup(ctx, tenantID, groupID, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+update tenant_users set authz_version = authz_version + 1
+where tenant_id = $1 and user_id in (
+  select user_id from tenant_group_members where group_id = $2 and not (user_id = any($3))
+  union
+  select m from unnest($3::text[]) m
+  where not exists (select 1 from tenant_group_members where group_id = $2 and user_id = m)
+)`, tenantID, groupID, members); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `delete from tenant_group_members where group_id = $1 and not (user_id = any($2))`, groupID, members); err != nil {
+			return err
+		}
+		return insertGroupMembers(ctx, tx, tenantID, groupID, members)
+	})
+}
+
+// AddGroupMember adds a tenant member to a group; adding an existing member
+// is a no-op. It reports whether the group exists.
+func (s *Store) AddGroupMember(ctx context.Context, tenantID, groupID, userID string) (bool, error) {
+	return s.withGroup(ctx, tenantID, groupID, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+update tenant_users set authz_version = authz_version + 1
+where tenant_id = $1 and user_id = $3
+  and not exists (select 1 from tenant_group_members where group_id = $2 and user_id = $3)`, tenantID, groupID, userID); err != nil {
+			return err
+		}
+		return insertGroupMembers(ctx, tx, tenantID, groupID, []string{userID})
+	})
+}
+
+// RemoveGroupMember removes a user from a group. It reports whether the user
+// was a member.
+func (s *Store) RemoveGroupMember(ctx context.Context, tenantID, groupID, userID string) (bool, error) {
+	var removed int
+	err := s.DB.QueryRow(ctx, `
+with removed as (
+  delete from tenant_group_members where tenant_id = $1 and group_id = $2 and user_id = $3
+  returning user_id
+), bumped as (
+  update tenant_users set authz_version = authz_version + 1
+  where tenant_id = $1 and user_id in (select user_id from removed)
+)
+select count(*) from removed`, tenantID, groupID, userID).Scan(&removed)
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+const bumpGroupMembersSQL = `
+update tenant_users set authz_version = authz_version + 1
+where tenant_id = $1 and user_id in (
+  select user_id from tenant_group_members where tenant_id = $1 and group_id = any($2)
+)`
+
+// BumpGroupAuthzVersion invalidates the authorization claims of the members
+// of the given groups, e.g. after what the groups grant changed.
+func (s *Store) BumpGroupAuthzVersion(ctx context.Context, tenantID string, groupIDs []string) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	_, err := s.DB.Exec(ctx, bumpGroupMembersSQL, tenantID, groupIDs)
+	return err
+}
+
+// withGroup runs fn in a transaction after touching the group's updated_at.
+// It reports whether the group exists.
+func (s *Store) withGroup(ctx context.Context, tenantID, groupID string, fn func(tx pgx.Tx) error) (bool, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	cmd, err := tx.Exec(ctx, `update tenant_groups set updated_at = now() where tenant_id = $1 and id = $2`, tenantID, groupID)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, nil
+	}
+	if err = fn(tx); err != nil {
+		return true, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// UserGroupIDs returns the groups userID directly belongs to in the tenant.
+func (s *Store) UserGroupIDs(ctx context.Context, tenantID, userID string) ([]string, error) {
+	rows, err := s.DB.Query(ctx, `select group_id from tenant_group_members where tenant_id = $1 and user_id = $2 order by group_id`, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func insertGroupMembers(ctx context.Context, tx pgx.Tx, tenantID, groupID string, members []string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `
+insert into tenant_group_members(group_id, tenant_id, user_id, created_at)
+select $1, $2, unnest($3::text[]), now()
+on conflict (group_id, user_id) do nothing`, groupID, tenantID, members)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrNotTenantMember
+	}
+	return err
+}
+
+func groupError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrGroupExists
+	}
+	return err
+}
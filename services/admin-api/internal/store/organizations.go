@@ -0,0 +1,287 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrTenantNameConflict is returned when creating a tenant whose name is
+	// taken.
+	ErrTenantNameConflict = errors.New("tenant_name_conflict")
+	// ErrTenantInOtherOrg is returned when attaching a tenant that already
+	// belongs to another organization.
+	ErrTenantInOtherOrg = errors.New("tenant_in_other_org")
+	// ErrLastOrgOwner is returned when a change would leave an organization
+	// without an owner.
+	ErrLastOrgOwner = errors.New("last_org_owner")
+)
+
+type OrganizationDTO struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+type TenantDTO struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// CreateOrganization creates an organization owned by ownerID.
+func (s *Store) CreateOrganization(ctx context.Context, name, ownerID string) (OrganizationDTO, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return OrganizationDTO{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	org := OrganizationDTO{ID: uuid.NewString(), Name: name}
+	if err = tx.QueryRow(ctx, `insert into organizations(id, name, created_at) values($1, $2, now()) returning created_at`, org.ID, name).Scan(&org.CreatedAt); err != nil {
+		return OrganizationDTO{}, err
+	}
+	if _, err = tx.Exec(ctx, `insert into organization_members(org_id, user_id, roles, created_at) values($1, $2, '{owner}', now())`, org.ID, ownerID); err != nil {
+		return OrganizationDTO{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return OrganizationDTO{}, err
+	}
+	return org, nil
+}
+
+func (s *Store) Organization(ctx context.Context, orgID string) (OrganizationDTO, bool, error) {
+	var org OrganizationDTO
+	err := s.DB.QueryRow(ctx, `select id, name, created_at from organizations where id = $1`, orgID).Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err == nil {
+		return org, true, nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return OrganizationDTO{}, false, nil
+	}
+	return OrganizationDTO{}, false, err
+}
+
+// OrgMemberRoles returns the roles userID holds in the organization and
+// whether the user is a member at all.
+func (s *Store) OrgMemberRoles(ctx context.Context, orgID, userID string) ([]string, bool, error) {
+	var roles []string
+	err := s.DB.QueryRow(ctx, `select roles from organization_members where org_id = $1 and user_id = $2`, orgID, userID).Scan(&roles)
+	if err == nil {
+		return roles, true, nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	return nil, false, err
+}
+
+// TenantOrgRoles returns the roles userID holds in the organization the
+// tenant belongs to, if any.
+func (s *Store) TenantOrgRoles(ctx context.Context, tenantID, userID string) ([]string, error) {
+	var roles []string
+	err := s.DB.QueryRow(ctx, `
+select om.roles
+from tenants t
+join organization_members om on om.org_id = t.org_id
+where t.id = $1 and om.user_id = $2`, tenantID, userID).Scan(&roles)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return roles, err
+}
+
+func (s *Store) ListOrgMembers(ctx context.Context, orgID string) ([]MemberDTO, error) {
+	rows, err := s.DB.Query(ctx, `
+select om.user_id, coalesce(u.email, ''), om.roles, om.created_at
+from organization_members om
+join users u on u.id = om.user_id
+where om.org_id = $1
+order by om.created_at asc`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]MemberDTO, 0)
+	for rows.Next() {
+		var m MemberDTO
+		if err := rows.Scan(&m.UserID, &m.Email, &m.Roles, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetOrgMemberRoles adds userID to the organization or replaces the roles of
+// an existing member, invalidating the authorization claims of their
+// memberships in the organization's tenants. It fails with ErrLastOrgOwner
+// rather than demote the last owner.
+func (s *Store) SetOrgMemberRoles(ctx context.Context, orgID, userID string, roles []string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err = lockOrganization(ctx, tx, orgID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `
+insert into organization_members(org_id, user_id, roles, created_at) values($1, $2, $3, now())
+on conflict (org_id, user_id) do update set roles = excluded.roles`, orgID, userID, roles); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, bumpOrgMemberSQL, orgID, userID); err != nil {
+		return err
+	}
+	if err = ensureOrgOwner(ctx, tx, orgID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RemoveOrgMember removes userID from the organization. It fails with
+// ErrLastOrgOwner rather than remove the last owner.
+func (s *Store) RemoveOrgMember(ctx context.Context, orgID, userID string) (bool, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err = lockOrganization(ctx, tx, orgID); err != nil {
+		return false, err
+	}
+	cmd, err := tx.Exec(ctx, `delete from organization_members where org_id = $1 and user_id = $2`, orgID, userID)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, nil
+	}
+	if _, err = tx.Exec(ctx, bumpOrgMemberSQL, orgID, userID); err != nil {
+		return true, err
+	}
+	if err = ensureOrgOwner(ctx, tx, orgID); err != nil {
+		return true, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// ListOrgTenants lists the tenants that belong to the organization.
+func (s *Store) ListOrgTenants(ctx context.Context, orgID string) ([]TenantDTO, error) {
+	rows, err := s.DB.Query(ctx, `select id, name, created_at from tenants where org_id = $1 order by created_at asc`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := make([]TenantDTO, 0)
+	for rows.Next() {
+		var t TenantDTO
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// CreateOrgTenant creates a tenant inside the organization. Its members are
+// managed by the organization's owners and admins until it has its own.
+func (s *Store) CreateOrgTenant(ctx context.Context, orgID, name string) (TenantDTO, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return TenantDTO{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var exists bool
+	if err = tx.QueryRow(ctx, `select exists(select 1 from tenants where name = $1)`, name).Scan(&exists); err != nil {
+		return TenantDTO{}, err
+	}
+	if exists {
+		return TenantDTO{}, ErrTenantNameConflict
+	}
+	t := TenantDTO{ID: uuid.NewString(), Name: name}
+	if err = tx.QueryRow(ctx, `insert into tenants(id, name, org_id, created_at) values($1, $2, $3, now()) returning created_at`, t.ID, name, orgID).Scan(&t.CreatedAt); err != nil {
+		return TenantDTO{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return TenantDTO{}, err
+	}
+	return t, nil
+}
+
+// AttachTenant moves an existing tenant into the organization. It reports
+// whether the tenant exists and fails with ErrTenantInOtherOrg if it already
+// belongs to a different organization.
+func (s *Store) AttachTenant(ctx context.Context, orgID, tenantID string) (bool, error) {
+	var current *string
+	err := s.DB.QueryRow(ctx, `select org_id from tenants where id = $1`, tenantID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cmd, err := s.DB.Exec(ctx, `update tenants set org_id = $1 where id = $2 and (org_id is null or org_id = $1)`, orgID, tenantID)
+	if err != nil {
+		return true, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return true, ErrTenantInOtherOrg
+	}
+	_, err = s.DB.Exec(ctx, bumpOrgTenantSQL, orgID, tenantID)
+	return true, err
+}
+
+// DetachTenant removes a tenant from the organization. It reports whether the
+// tenant belonged to it.
+func (s *Store) DetachTenant(ctx context.Context, orgID, tenantID string) (bool, error) {
+	cmd, err := s.DB.Exec(ctx, `update tenants set org_id = null where id = $1 and org_id = $2`, tenantID, orgID)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, nil
+	}
+	_, err = s.DB.Exec(ctx, bumpOrgTenantSQL, orgID, tenantID)
+	return true, err
+}
+
+// Organization roles are part of the authorization claims of tenant access
+// tokens, so changing them, or the tenants they apply to, invalidates the
+// claims of the tenant memberships affected.
+const (
+	bumpOrgMemberSQL = `
+update tenant_users set authz_version = authz_version + 1
+where user_id = $2 and tenant_id in (select id from tenants where org_id = $1)`
+	bumpOrgTenantSQL = `
+update tenant_users set authz_version = authz_version + 1
+where tenant_id = $2 and user_id in (select user_id from organization_members where org_id = $1)`
+)
+
+// lockOrganization serializes membership changes of an organization so the
+// last-owner check cannot race.
+func lockOrganization(ctx context.Context, tx pgx.Tx, orgID string) error {
+	_, err := tx.Exec(ctx, `select 1 from organizations where id = $1 for update`, orgID)
+	return err
+}
+
+func ensureOrgOwner(ctx context.Context, tx pgx.Tx, orgID string) error {
+	var owners int
+	if err := tx.QueryRow(ctx, `select count(*) from organization_members where org_id = $1 and 'owner' = any(roles)`, orgID).Scan(&owners); err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOrgOwner
+	}
+	return nil
+}
@@ -0,0 +1,503 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"anvilkit-auth-template/modules/common-go/pkg/authz"
+)
+
+const (
+	// UserStatusPending is a user who has not verified their email yet.
+	UserStatusPending int16 = 0
+	// UserStatusActive is a user who may log in.
+	UserStatusActive int16 = 1
+	// UserStatusSuspended is a user a platform admin has locked out.
+	UserStatusSuspended int16 = 2
+)
+
+// ErrUserNotSuspended is returned when reactivating a user who is not
+// suspended.
+var ErrUserNotSuspended = errors.New("user_not_suspended")
+
+// ErrLastPlatformAdmin is returned when revoking the platform admin role from
+// the only user who holds it.
+var ErrLastPlatformAdmin = errors.New("last_platform_admin")
+
+type PlatformTenantDTO struct {
+	ID          string
+	Name        string
+	Slug        *string
+	Status      int16
+	OrgID       *string
+	MemberCount int
+	CreatedAt   time.Time
+}
+
+type PlatformUserDTO struct {
+	ID               string
+	Email            *string
+	Status           int16
+	EmailVerifiedAt  *time.Time
+	SuspendedAt      *time.Time
+	SuspensionReason *string
+	CreatedAt        time.Time
+}
+
+// UserMembershipDTO is one tenant a user belongs to.
+type UserMembershipDTO struct {
+	TenantID   string
+	TenantName string
+	Roles      []string
+	CreatedAt  time.Time
+}
+
+type EmailDeliveryDTO struct {
+	ID         string
+	ToEmail    string
+	Template   *string
+	Subject    *string
+	ExternalID *string
+	// Provider is the email provider that accepted the email.
+	Provider  *string
+	Status    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	History   []EmailStatusDTO
+}
+
+type EmailStatusDTO struct {
+	Status    string
+	Message   *string
+	Meta      map[string]any
+	CreatedAt time.Time
+}
+
+// SearchTenants lists tenants across the platform, newest first. query
+// matches a tenant ID exactly or a substring of its name or slug. It returns
+// at most limit tenants and whether more follow.
+func (s *Store) SearchTenants(ctx context.Context, query string, limit, offset int) ([]PlatformTenantDTO, bool, error) {
+	rows, err := s.DB.Query(ctx, `
+select t.id, t.name, t.slug, t.status, t.org_id,
+       (select count(*) from tenant_users tu where tu.tenant_id = t.id),
+       t.created_at
+from tenants t
+where $1 = '' or t.id = $1 or t.name ilike '%' || $1 || '%' or t.slug ilike '%' || $1 || '%'
+order by t.created_at desc, t.id
+limit $2 offset $3`, query, limit+1, offset)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	tenants := make([]PlatformTenantDTO, 0, limit)
+	for rows.Next() {
+		var t PlatformTenantDTO
+		if err := rows.Scan(&t.ID, &t.Name, &t.Slug, &t.Status, &t.OrgID, &t.MemberCount, &t.CreatedAt); err != nil {
+			return nil, false, err
+		}
+		tenants = append(tenants, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(tenants) > limit {
+		return tenants[:limit], true, nil
+	}
+	return tenants, false, nil
+}
+
+func (s *Store) PlatformTenant(ctx context.Context, tenantID string) (PlatformTenantDTO, bool, error) {
+	var t PlatformTenantDTO
+	err := s.DB.QueryRow(ctx, `
+select t.id, t.name, t.slug, t.status, t.org_id,
+       (select count(*) from tenant_users tu where tu.tenant_id = t.id),
+       t.created_at
+from tenants t
+where t.id = $1`, tenantID).Scan(&t.ID, &t.Name, &t.Slug, &t.Status, &t.OrgID, &t.MemberCount, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PlatformTenantDTO{}, false, nil
+	}
+	if err != nil {
+		return PlatformTenantDTO{}, false, err
+	}
+	return t, true, nil
+}
+
+// SearchUsers lists users across the platform, newest first. query matches a
+// user ID exactly or a substring of the email; status, if set, filters by
+// users.status. It returns at most limit users and whether more follow.
+func (s *Store) SearchUsers(ctx context.Context, query string, status *int16, limit, offset int) ([]PlatformUserDTO, bool, error) {
+	rows, err := s.DB.Query(ctx, `
+select id, email, status, email_verified_at, suspended_at, suspension_reason, created_at
+from users
+where ($1 = '' or id = $1 or email ilike '%' || $1 || '%')
+  and ($2::smallint is null or status = $2)
+order by created_at desc, id
+limit $3 offset $4`, query, status, limit+1, offset)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	users := make([]PlatformUserDTO, 0, limit)
+	for rows.Next() {
+		var u PlatformUserDTO
+		if err := rows.Scan(&u.ID, &u.Email, &u.Status, &u.EmailVerifiedAt, &u.SuspendedAt, &u.SuspensionReason, &u.CreatedAt); err != nil {
+			return nil, false, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(users) > limit {
+		return users[:limit], true, nil
+	}
+	return users, false, nil
+}
+
+func (s *Store) PlatformUser(ctx context.Context, userID string) (PlatformUserDTO, bool, error) {
+	var u PlatformUserDTO
+	err := s.DB.QueryRow(ctx, `
+select id, email, status, email_verified_at, suspended_at, suspension_reason, created_at
+from users
+where id = $1`, userID).Scan(&u.ID, &u.Email, &u.Status, &u.EmailVerifiedAt, &u.SuspendedAt, &u.SuspensionReason, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PlatformUserDTO{}, false, nil
+	}
+	if err != nil {
+		return PlatformUserDTO{}, false, err
+	}
+	return u, true, nil
+}
+
+// UserMemberships lists the tenants a user belongs to.
+func (s *Store) UserMemberships(ctx context.Context, userID string) ([]UserMembershipDTO, error) {
+	rows, err := s.DB.Query(ctx, `
+select tu.tenant_id, t.name, tu.roles, tu.created_at
+from tenant_users tu
+join tenants t on t.id = tu.tenant_id
+where tu.user_id = $1
+order by tu.created_at asc`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := make([]UserMembershipDTO, 0)
+	for rows.Next() {
+		var m UserMembershipDTO
+		if err := rows.Scan(&m.TenantID, &m.TenantName, &m.Roles, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+// ActiveSessionCount counts the user's unrevoked, unexpired refresh sessions.
+func (s *Store) ActiveSessionCount(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.DB.QueryRow(ctx, `select count(*) from refresh_sessions where user_id = $1 and revoked_at is null and expires_at > now()`, userID).Scan(&n)
+	return n, err
+}
+
+// UserSuspended reports whether a platform admin has suspended the user.
+func (s *Store) UserSuspended(ctx context.Context, userID string) (bool, error) {
+	var suspended bool
+	err := s.DB.QueryRow(ctx, `select exists(select 1 from users where id = $1 and status = $2)`, userID, UserStatusSuspended).Scan(&suspended)
+	return suspended, err
+}
+
+// IsPlatformAdmin reports whether the user holds the platform admin role.
+func (s *Store) IsPlatformAdmin(ctx context.Context, userID string) (bool, error) {
+	return authz.IsPlatformAdmin(ctx, s.DB, userID)
+}
+
+// ListPlatformAdmins lists the users holding the platform admin role, oldest
+// first.
+func (s *Store) ListPlatformAdmins(ctx context.Context) ([]PlatformUserDTO, error) {
+	rows, err := s.DB.Query(ctx, `
+select id, email, status, email_verified_at, suspended_at, suspension_reason, created_at
+from users
+where platform_role = $1
+order by created_at, id`, authz.PlatformRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []PlatformUserDTO{}
+	for rows.Next() {
+		var u PlatformUserDTO
+		if err := rows.Scan(&u.ID, &u.Email, &u.Status, &u.EmailVerifiedAt, &u.SuspendedAt, &u.SuspensionReason, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GrantPlatformAdmin gives the user the platform admin role. It reports
+// whether the user exists and whether they did not hold the role yet.
+func (s *Store) GrantPlatformAdmin(ctx context.Context, userID string) (found, granted bool, err error) {
+	var previous *string
+	err = s.DB.QueryRow(ctx, `
+update users u
+set platform_role = $2, updated_at = now()
+from (select id, platform_role from users where id = $1 for update) prev
+where u.id = prev.id
+returning prev.platform_role`, userID, authz.PlatformRoleAdmin).Scan(&previous)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, previous == nil, nil
+}
+
+// RevokePlatformAdmin takes the platform admin role from the user. It
+// reports whether the user held it and fails with ErrLastPlatformAdmin if
+// no active platform admin would be left.
+func (s *Store) RevokePlatformAdmin(ctx context.Context, userID string) (bool, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Lock every admin so concurrent revocations cannot both pass the check.
+	rows, err := tx.Query(ctx, `select id, status from users where platform_role = $1 for update`, authz.PlatformRoleAdmin)
+	if err != nil {
+		return false, err
+	}
+	held, others := false, 0
+	for rows.Next() {
+		var (
+			id     string
+			status int16
+		)
+		if err := rows.Scan(&id, &status); err != nil {
+			rows.Close()
+			return false, err
+		}
+		if id == userID {
+			held = true
+		} else if status != UserStatusSuspended {
+			others++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if !held {
+		return false, nil
+	}
+	if others == 0 {
+		return true, ErrLastPlatformAdmin
+	}
+	if _, err := tx.Exec(ctx, `update users set platform_role = null, updated_at = now() where id = $1`, userID); err != nil {
+		return true, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// SeedPlatformAdmins grants the platform admin role to those of userIDs that
+// exist, provided nobody holds it yet, and returns their IDs.
+func (s *Store) SeedPlatformAdmins(ctx context.Context, userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := s.DB.Query(ctx, `
+update users
+set platform_role = $2, updated_at = now()
+where id = any($1) and platform_role is null
+  and not exists (select 1 from users where platform_role = $2)
+returning id`, userIDs, authz.PlatformRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// SuspendUser suspends a user and logs them out everywhere (see
+// RevokeUserSessions), keeping their status for ReactivateUser. It reports
+// whether the user exists and how many refresh sessions were revoked.
+func (s *Store) SuspendUser(ctx context.Context, userID, reason string) (bool, int64, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	cmd, err := tx.Exec(ctx, `
+update users
+set status = $2,
+    status_before_suspension = case when status = $2 then status_before_suspension else status end,
+    suspended_at = coalesce(suspended_at, now()), suspension_reason = nullif($3, ''), updated_at = now()
+where id = $1`, userID, UserStatusSuspended, reason)
+	if err != nil {
+		return false, 0, err
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, 0, nil
+	}
+	revoked, err := revokeUserSessions(ctx, tx, userID)
+	if err != nil {
+		return true, 0, err
+	}
+	return true, revoked, tx.Commit(ctx)
+}
+
+// ReactivateUser lifts a suspension and restores the status the user had
+// before it, so a user who had not verified their email is pending again. It
+// reports whether the user exists and fails with ErrUserNotSuspended if they
+// are not suspended.
+func (s *Store) ReactivateUser(ctx context.Context, userID string) (bool, error) {
+	cmd, err := s.DB.Exec(ctx, `
+update users
+set status = coalesce(status_before_suspension, case when email_verified_at is null then $2 else $3 end),
+    status_before_suspension = null, suspended_at = null, suspension_reason = null, updated_at = now()
+where id = $1 and status = $4`, userID, UserStatusPending, UserStatusActive, UserStatusSuspended)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() > 0 {
+		return true, nil
+	}
+	var exists bool
+	if err = s.DB.QueryRow(ctx, `select exists(select 1 from users where id = $1)`, userID).Scan(&exists); err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, nil
+	}
+	return true, ErrUserNotSuspended
+}
+
+// RevokeUserSessions logs a user out everywhere: it revokes their refresh
+// sessions and bumps the authorization version of their memberships so their
+// tenant-scoped access tokens are rejected as stale. It returns the number of
+// refresh sessions revoked.
+func (s *Store) RevokeUserSessions(ctx context.Context, userID string) (int64, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	revoked, err := revokeUserSessions(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return revoked, tx.Commit(ctx)
+}
+
+// UserEmail returns a user's email address, or "" if they have none.
+func (s *Store) UserEmail(ctx context.Context, userID string) (string, bool, error) {
+	var email *string
+	err := s.DB.QueryRow(ctx, `select email from users where id = $1`, userID).Scan(&email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if email == nil {
+		return "", true, nil
+	}
+	return *email, true, nil
+}
+
+// UserEmailDeliveries returns the most recent emails sent to a user, newest
+// first, with their status history.
+func (s *Store) UserEmailDeliveries(ctx context.Context, userID string, limit int) ([]EmailDeliveryDTO, error) {
+	rows, err := s.DB.Query(ctx, `
+select id, to_email, template, subject, external_id, provider, status, created_at, updated_at
+from email_records
+where user_id = $1
+order by created_at desc, id
+limit $2`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]EmailDeliveryDTO, 0)
+	ids := make([]string, 0)
+	for rows.Next() {
+		var d EmailDeliveryDTO
+		if err := rows.Scan(&d.ID, &d.ToEmail, &d.Template, &d.Subject, &d.ExternalID, &d.Provider, &d.Status, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		d.History = make([]EmailStatusDTO, 0)
+		deliveries = append(deliveries, d)
+		ids = append(ids, d.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	rows, err = s.DB.Query(ctx, `
+select email_record_id, status, message, meta, created_at
+from email_status_history
+where email_record_id = any($1)
+order by created_at asc, id asc`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[string]int, len(deliveries))
+	for i, d := range deliveries {
+		index[d.ID] = i
+	}
+	for rows.Next() {
+		var recordID string
+		var h EmailStatusDTO
+		if err := rows.Scan(&recordID, &h.Status, &h.Message, &h.Meta, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[recordID]; ok {
+			deliveries[i].History = append(deliveries[i].History, h)
+		}
+	}
+	return deliveries, rows.Err()
+}
+
+// EmailBlacklisted reports whether an address is suppressed after a hard
+// bounce, and why.
+func (s *Store) EmailBlacklisted(ctx context.Context, email string) (bool, string, error) {
+	var reason *string
+	err := s.DB.QueryRow(ctx, `select reason from email_blacklist where email = lower($1)`, email).Scan(&reason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if reason == nil {
+		return true, "", nil
+	}
+	return true, *reason, nil
+}
+
+func revokeUserSessions(ctx context.Context, tx pgx.Tx, userID string) (int64, error) {
+	cmd, err := tx.Exec(ctx, `update refresh_sessions set revoked_at = now() where user_id = $1 and revoked_at is null`, userID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec(ctx, `update tenant_users set authz_version = authz_version + 1 where user_id = $1`, userID); err != nil {
+		return 0, err
+	}
+	return cmd.RowsAffected(), nil
+}
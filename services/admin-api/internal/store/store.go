@@ -11,28 +11,33 @@ import (
 
 type Store struct{ DB *pgxpool.Pool }
 
+// ErrLastRole is returned when removing a member's only role.
+var ErrLastRole = errors.New("last_role")
+
 type MemberDTO struct {
 	UserID    string
 	Email     string
-	Role      string
+	Roles     []string
 	CreatedAt time.Time
 }
 
-func (s *Store) TenantUserRole(ctx context.Context, tenantID, userID string) (string, bool, error) {
-	var role string
-	err := s.DB.QueryRow(ctx, `select role from tenant_users where tenant_id=$1 and user_id=$2`, tenantID, userID).Scan(&role)
+// MemberRoles returns the roles userID holds in the tenant and whether the
+// user is a member at all.
+func (s *Store) MemberRoles(ctx context.Context, tenantID, userID string) ([]string, bool, error) {
+	var roles []string
+	err := s.DB.QueryRow(ctx, `select roles from tenant_users where tenant_id=$1 and user_id=$2`, tenantID, userID).Scan(&roles)
 	if err == nil {
-		return role, true, nil
+		return roles, true, nil
 	}
 	if errors.Is(err, pgx.ErrNoRows) {
-		return "", false, nil
+		return nil, false, nil
 	}
-	return "", false, err
+	return nil, false, err
 }
 
 func (s *Store) ListMembers(ctx context.Context, tenantID string) ([]MemberDTO, error) {
 	rows, err := s.DB.Query(ctx, `
-select tu.user_id, coalesce(u.email, ''), tu.role, tu.created_at
+select tu.user_id, coalesce(u.email, ''), tu.roles, tu.created_at
 from tenant_users tu
 join users u on u.id = tu.user_id
 where tu.tenant_id = $1
@@ -45,7 +50,7 @@ order by tu.created_at asc`, tenantID)
 	members := make([]MemberDTO, 0)
 	for rows.Next() {
 		var m MemberDTO
-		if err := rows.Scan(&m.UserID, &m.Email, &m.Role, &m.CreatedAt); err != nil {
+		if err := rows.Scan(&m.UserID, &m.Email, &m.Roles, &m.CreatedAt); err != nil {
 			return nil, err
 		}
 		members = append(members, m)
@@ -53,19 +58,59 @@ order by tu.created_at asc`, tenantID)
 	return members, rows.Err()
 }
 
-func (s *Store) AddMember(ctx context.Context, tenantID, userID, role string) error {
-	_, err := s.DB.Exec(ctx, `insert into tenant_users(tenant_id, user_id, role, created_at) values($1, $2, $3, now())`, tenantID, userID, role)
+func (s *Store) AddMember(ctx context.Context, tenantID, userID string, roles []string) error {
+	_, err := s.DB.Exec(ctx, `insert into tenant_users(tenant_id, user_id, roles, created_at) values($1, $2, $3, now())`, tenantID, userID, roles)
 	return err
 }
 
-func (s *Store) UpdateMemberRole(ctx context.Context, tenantID, userID, role string) (bool, error) {
-	cmd, err := s.DB.Exec(ctx, `update tenant_users set role = $3 where tenant_id = $1 and user_id = $2`, tenantID, userID, role)
+// SetMemberRoles replaces the roles of a member. It reports whether the
+// membership exists.
+func (s *Store) SetMemberRoles(ctx context.Context, tenantID, userID string, roles []string) (bool, error) {
+	cmd, err := s.DB.Exec(ctx, `update tenant_users set roles = $3, authz_version = authz_version + 1 where tenant_id = $1 and user_id = $2`, tenantID, userID, roles)
+	if err != nil {
+		return false, err
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// GrantMemberRole adds role to a member's roles; granting a role the member
+// already holds is a no-op. It reports whether the membership exists.
+func (s *Store) GrantMemberRole(ctx context.Context, tenantID, userID, role string) (bool, error) {
+	cmd, err := s.DB.Exec(ctx, `
+update tenant_users
+set roles = case when $3 = any(roles) then roles else array_append(roles, $3) end,
+    authz_version = case when $3 = any(roles) then authz_version else authz_version + 1 end
+where tenant_id = $1 and user_id = $2`, tenantID, userID, role)
 	if err != nil {
 		return false, err
 	}
 	return cmd.RowsAffected() > 0, nil
 }
 
+// RevokeMemberRole removes role from a member's roles; revoking a role the
+// member does not hold is a no-op. It reports whether the membership exists
+// and fails with ErrLastRole rather than leave the member without a role.
+func (s *Store) RevokeMemberRole(ctx context.Context, tenantID, userID, role string) (bool, error) {
+	cmd, err := s.DB.Exec(ctx, `
+update tenant_users
+set roles = array_remove(roles, $3), authz_version = authz_version + 1
+where tenant_id = $1 and user_id = $2 and $3 = any(roles) and cardinality(roles) > 1`, tenantID, userID, role)
+	if err != nil {
+		return false, err
+	}
+	if cmd.RowsAffected() > 0 {
+		return true, nil
+	}
+	roles, exists, err := s.MemberRoles(ctx, tenantID, userID)
+	if err != nil || !exists {
+		return false, err
+	}
+	if len(roles) == 1 && roles[0] == role {
+		return true, ErrLastRole
+	}
+	return true, nil
+}
+
 func (s *Store) RemoveMember(ctx context.Context, tenantID, userID string) (bool, error) {
 	cmd, err := s.DB.Exec(ctx, `delete from tenant_users where tenant_id = $1 and user_id = $2`, tenantID, userID)
 	if err != nil {
@@ -80,24 +125,38 @@ func (s *Store) UserExists(ctx context.Context, userID string) (bool, error) {
 	return ok, err
 }
 
-func (s *Store) RolesForUser(ctx context.Context, tenantID, userID string) ([]string, error) {
-	rows, err := s.DB.Query(ctx, `select role from user_roles where tenant_id=$1 and user_id=$2`, tenantID, userID)
-	if err != nil {
-		return nil, err
+func (s *Store) CountMembersWithRole(ctx context.Context, tenantID, role string) (int, error) {
+	var n int
+	err := s.DB.QueryRow(ctx, `select count(*) from tenant_users where tenant_id = $1 and $2 = any(roles)`, tenantID, role).Scan(&n)
+	return n, err
+}
+
+// AuthzVersion returns the authorization version of a tenant membership. It
+// matches ginmid.AuthzVersionLookup.
+func (s *Store) AuthzVersion(ctx context.Context, tenantID, userID string) (int64, bool, error) {
+	var v int64
+	err := s.DB.QueryRow(ctx, `select authz_version from tenant_users where tenant_id=$1 and user_id=$2`, tenantID, userID).Scan(&v)
+	if err == nil {
+		return v, true, nil
 	}
-	defer rows.Close()
-	roles := []string{}
-	for rows.Next() {
-		var r string
-		if err := rows.Scan(&r); err != nil {
-			return nil, err
-		}
-		roles = append(roles, r)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
 	}
-	return roles, rows.Err()
+	return 0, false, err
+}
+
+// ImpersonationActive reports whether an impersonation session started in
+// auth-api is neither stopped nor expired. It matches
+// ginmid.ImpersonationLookup.
+func (s *Store) ImpersonationActive(ctx context.Context, id string) (bool, error) {
+	var active bool
+	err := s.DB.QueryRow(ctx, `select exists(select 1 from impersonation_sessions where id=$1 and ended_at is null and expires_at > now())`, id).Scan(&active)
+	return active, err
 }
 
-func (s *Store) AssignRole(ctx context.Context, tenantID, userID, role string) error {
-	_, err := s.DB.Exec(ctx, `insert into user_roles(tenant_id,user_id,role,created_at) values($1,$2,$3,now()) on conflict do nothing`, tenantID, userID, role)
+// BumpRoleAuthzVersion invalidates the authorization claims of every member
+// holding role in the tenant, e.g. after the role's permissions changed.
+func (s *Store) BumpRoleAuthzVersion(ctx context.Context, tenantID, role string) error {
+	_, err := s.DB.Exec(ctx, `update tenant_users set authz_version = authz_version + 1 where tenant_id = $1 and $2 = any(roles)`, tenantID, role)
 	return err
 }
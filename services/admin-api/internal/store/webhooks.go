@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type WebhookEndpointDTO struct {
+	ID          string
+	URL         string
+	Secret      string
+	Events      []string
+	Description string
+	Enabled     bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// WebhookEndpointUpdate carries the fields of an endpoint to change; nil
+// fields are kept.
+type WebhookEndpointUpdate struct {
+	URL         *string
+	Events      []string
+	Description *string
+	Enabled     *bool
+}
+
+type WebhookDeliveryDTO struct {
+	ID             string
+	EndpointID     string
+	EventID        string
+	EventType      string
+	Status         string
+	Attempts       int
+	NextAttemptAt  *time.Time
+	LastStatusCode *int
+	LastError      *string
+	RedeliveryOf   *string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeliveredAt    *time.Time
+	// Payload and AttemptLog are only loaded by WebhookDelivery.
+	Payload    json.RawMessage
+	AttemptLog []WebhookAttemptDTO
+}
+
+type WebhookAttemptDTO struct {
+	Attempt    int
+	StatusCode *int
+	Error      *string
+	DurationMS int
+	CreatedAt  time.Time
+}
+
+const webhookEndpointColumns = `id, url, secret, events, description, enabled, created_at, updated_at`
+
+func scanWebhookEndpoint(row pgx.Row) (WebhookEndpointDTO, error) {
+	var e WebhookEndpointDTO
+	err := row.Scan(&e.ID, &e.URL, &e.Secret, &e.Events, &e.Description, &e.Enabled, &e.CreatedAt, &e.UpdatedAt)
+	return e, err
+}
+
+func (s *Store) ListWebhookEndpoints(ctx context.Context, tenantID string) ([]WebhookEndpointDTO, error) {
+	rows, err := s.DB.Query(ctx, `select `+webhookEndpointColumns+` from webhook_endpoints where tenant_id = $1 order by created_at asc, id asc`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := make([]WebhookEndpointDTO, 0)
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, rows.Err()
+}
+
+func (s *Store) CreateWebhookEndpoint(ctx context.Context, tenantID, url, secret string, events []string, description string, enabled bool) (WebhookEndpointDTO, error) {
+	return scanWebhookEndpoint(s.DB.QueryRow(ctx, `
+insert into webhook_endpoints(id, tenant_id, url, secret, events, description, enabled)
+values ($1, $2, $3, $4, $5, $6, $7)
+returning `+webhookEndpointColumns, uuid.NewString(), tenantID, url, secret, events, description, enabled))
+}
+
+func (s *Store) WebhookEndpoint(ctx context.Context, tenantID, endpointID string) (WebhookEndpointDTO, bool, error) {
+	e, err := scanWebhookEndpoint(s.DB.QueryRow(ctx, `select `+webhookEndpointColumns+` from webhook_endpoints where tenant_id = $1 and id = $2`, tenantID, endpointID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WebhookEndpointDTO{}, false, nil
+	}
+	if err != nil {
+		return WebhookEndpointDTO{}, false, err
+	}
+	return e, true, nil
+}
+
+func (s *Store) UpdateWebhookEndpoint(ctx context.Context, tenantID, endpointID string, update WebhookEndpointUpdate) (bool, error) {
+	ct, err := s.DB.Exec(ctx, `
+update webhook_endpoints
+set url = coalesce($3, url),
+    events = coalesce($4, events),
+    description = coalesce($5, description),
+    enabled = coalesce($6, enabled),
+    updated_at = now()
+where tenant_id = $1 and id = $2`, tenantID, endpointID, update.URL, update.Events, update.Description, update.Enabled)
+	if err != nil {
+		return false, err
+	}
+	return ct.RowsAffected() > 0, nil
+}
+
+// RotateWebhookSecret replaces an endpoint's signing secret. Deliveries
+// already queued are signed with the new secret.
+func (s *Store) RotateWebhookSecret(ctx context.Context, tenantID, endpointID, secret string) (bool, error) {
+	ct, err := s.DB.Exec(ctx, `update webhook_endpoints set secret = $3, updated_at = now() where tenant_id = $1 and id = $2`, tenantID, endpointID, secret)
+	if err != nil {
+		return false, err
+	}
+	return ct.RowsAffected() > 0, nil
+}
+
+// DeleteWebhookEndpoint deletes an endpoint with its delivery log.
+func (s *Store) DeleteWebhookEndpoint(ctx context.Context, tenantID, endpointID string) (bool, error) {
+	ct, err := s.DB.Exec(ctx, `delete from webhook_endpoints where tenant_id = $1 and id = $2`, tenantID, endpointID)
+	if err != nil {
+		return false, err
+	}
+	return ct.RowsAffected() > 0, nil
+}
+
+const webhookDeliveryColumns = `id, endpoint_id, event_id, event_type, status, attempts, next_attempt_at, last_status_code, last_error,
+       redelivery_of, created_at, updated_at, delivered_at`
+
+func scanWebhookDelivery(row pgx.Row, extra ...any) (WebhookDeliveryDTO, error) {
+	var d WebhookDeliveryDTO
+	dest := append([]any{&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastStatusCode,
+		&d.LastError, &d.RedeliveryOf, &d.CreatedAt, &d.UpdatedAt, &d.DeliveredAt}, extra...)
+	err := row.Scan(dest...)
+	return d, err
+}
+
+// ListWebhookDeliveries lists an endpoint's deliveries, newest first,
+// optionally with one status. It fetches one row more than limit to report
+// whether more follow.
+func (s *Store) ListWebhookDeliveries(ctx context.Context, tenantID, endpointID, status string, limit, offset int) ([]WebhookDeliveryDTO, bool, error) {
+	rows, err := s.DB.Query(ctx, `
+select `+webhookDeliveryColumns+`
+from webhook_deliveries
+where tenant_id = $1 and endpoint_id = $2 and ($3 = '' or status = $3)
+order by created_at desc, id desc
+limit $4 offset $5`, tenantID, endpointID, status, limit+1, offset)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]WebhookDeliveryDTO, 0)
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(deliveries) > limit {
+		return deliveries[:limit], true, nil
+	}
+	return deliveries, false, nil
+}
+
+// WebhookDelivery returns a delivery with its payload and attempt log.
+func (s *Store) WebhookDelivery(ctx context.Context, tenantID, endpointID, deliveryID string) (WebhookDeliveryDTO, bool, error) {
+	var payload string
+	d, err := scanWebhookDelivery(s.DB.QueryRow(ctx, `
+select `+webhookDeliveryColumns+`, payload::text
+from webhook_deliveries
+where tenant_id = $1 and endpoint_id = $2 and id = $3`, tenantID, endpointID, deliveryID), &payload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return WebhookDeliveryDTO{}, false, nil
+	}
+	if err != nil {
+		return WebhookDeliveryDTO{}, false, err
+	}
+	d.Payload = json.RawMessage(payload)
+
+	rows, err := s.DB.Query(ctx, `
+select attempt, status_code, error, duration_ms, created_at
+from webhook_delivery_attempts
+where delivery_id = $1
+order by attempt asc`, deliveryID)
+	if err != nil {
+		return WebhookDeliveryDTO{}, false, err
+	}
+	defer rows.Close()
+	d.AttemptLog = make([]WebhookAttemptDTO, 0)
+	for rows.Next() {
+		var a WebhookAttemptDTO
+		if err := rows.Scan(&a.Attempt, &a.StatusCode, &a.Error, &a.DurationMS, &a.CreatedAt); err != nil {
+			return WebhookDeliveryDTO{}, false, err
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return d, true, rows.Err()
+}
+
+// RedeliverWebhook copies a delivery into a new pending delivery of the same
+// payload and returns its ID. The caller queues it.
+func (s *Store) RedeliverWebhook(ctx context.Context, tenantID, endpointID, deliveryID string) (string, bool, error) {
+	id := uuid.NewString()
+	ct, err := s.DB.Exec(ctx, `
+insert into webhook_deliveries(id, endpoint_id, tenant_id, event_id, event_type, payload, next_attempt_at, redelivery_of)
+select $4, endpoint_id, tenant_id, event_id, event_type, payload, now(), id
+from webhook_deliveries
+where tenant_id = $1 and endpoint_id = $2 and id = $3`, tenantID, endpointID, deliveryID, id)
+	if err != nil {
+		return "", false, err
+	}
+	if ct.RowsAffected() == 0 {
+		return "", false, nil
+	}
+	return id, true, nil
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 func MustTestDB(t *testing.T) *pgxpool.Pool {
@@ -57,9 +58,24 @@ func ApplyMigrations(t *testing.T, db *pgxpool.Pool) {
 	}
 }
 
+func MustTestRedis(t *testing.T) *goredis.Client {
+	t.Helper()
+	addr := strings.TrimSpace(os.Getenv("TEST_REDIS_ADDR"))
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	rdb := goredis.NewClient(&goredis.Options{Addr: addr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		_ = rdb.Close()
+		t.Fatalf("redis ping: %v", err)
+	}
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb
+}
+
 func TruncateAuthTables(t *testing.T, db *pgxpool.Pool) {
 	t.Helper()
-	_, err := db.Exec(context.Background(), `TRUNCATE TABLE user_roles, tenant_users, refresh_tokens, refresh_sessions, user_password_credentials, tenants, users RESTART IDENTITY CASCADE`)
+	_, err := db.Exec(context.Background(), `TRUNCATE TABLE audit_export_checkpoints, audit_events, impersonation_sessions, tenant_group_members, tenant_groups, organization_members, tenant_users, refresh_tokens, refresh_sessions, user_password_credentials, tenants, organizations, users RESTART IDENTITY CASCADE`)
 	if err != nil {
 		t.Fatalf("truncate auth tables: %v", err)
 	}
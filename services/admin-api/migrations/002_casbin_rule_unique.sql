@@ -0,0 +1,21 @@
+-- Unique Casbin rules
+-- Remove duplicate rules left by earlier non-idempotent inserts, then enforce
+-- uniqueness so the adapter can insert with ON CONFLICT DO NOTHING.
+
+DELETE FROM casbin_rule a
+USING casbin_rule b
+WHERE a.id > b.id
+  AND a.ptype = b.ptype
+  AND a.v0 IS NOT DISTINCT FROM b.v0
+  AND a.v1 IS NOT DISTINCT FROM b.v1
+  AND a.v2 IS NOT DISTINCT FROM b.v2
+  AND a.v3 IS NOT DISTINCT FROM b.v3
+  AND a.v4 IS NOT DISTINCT FROM b.v4
+  AND a.v5 IS NOT DISTINCT FROM b.v5;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_casbin_rule
+  ON casbin_rule (ptype, COALESCE(v0, ''), COALESCE(v1, ''), COALESCE(v2, ''), COALESCE(v3, ''), COALESCE(v4, ''), COALESCE(v5, ''));
+
+-- Filtered loading selects p rules by v1 and g rules by v2.
+CREATE INDEX IF NOT EXISTS idx_casbin_rule_ptype_v1 ON casbin_rule(ptype, v1);
+CREATE INDEX IF NOT EXISTS idx_casbin_rule_ptype_v2 ON casbin_rule(ptype, v2);
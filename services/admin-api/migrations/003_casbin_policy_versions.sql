@@ -0,0 +1,13 @@
+-- Versioned global policy sets
+-- Each row is a snapshot of the global (non tenant-scoped) casbin_rule set as
+-- applied by rbac.PolicySets; the highest version is the current one.
+
+CREATE TABLE IF NOT EXISTS casbin_policy_versions (
+  version BIGSERIAL PRIMARY KEY,
+  rules JSONB NOT NULL,
+  checksum VARCHAR(64) NOT NULL,
+  rule_count INTEGER NOT NULL,
+  comment TEXT NOT NULL DEFAULT '',
+  created_by VARCHAR(100) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,9 @@
+-- Audit export checkpoints
+-- The audit-export stream command ships audit_events to a SIEM and
+-- records the last exported seq per exporter name here after each batch, so a
+-- restarted exporter resumes where it stopped.
+create table if not exists audit_export_checkpoints (
+  name text primary key,
+  last_seq bigint not null default 0,
+  updated_at timestamptz not null default now()
+);
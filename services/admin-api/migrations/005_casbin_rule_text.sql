@@ -0,0 +1,11 @@
+-- Unbounded casbin_rule values
+-- Access condition rules (p2) keep whole expressions, such as an IP allowlist,
+-- in v4, which outgrow VARCHAR(100). Conditions are capped in the application
+-- (rbac.MaxConditionLength) so rules still fit the unique index.
+ALTER TABLE casbin_rule
+  ALTER COLUMN v0 TYPE TEXT,
+  ALTER COLUMN v1 TYPE TEXT,
+  ALTER COLUMN v2 TYPE TEXT,
+  ALTER COLUMN v3 TYPE TEXT,
+  ALTER COLUMN v4 TYPE TEXT,
+  ALTER COLUMN v5 TYPE TEXT;
@@ -8,12 +8,16 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"anvilkit-auth-template/modules/common-go/pkg/analytics"
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
 	"anvilkit-auth-template/modules/common-go/pkg/cache/redis"
 	"anvilkit-auth-template/modules/common-go/pkg/cfg"
 	"anvilkit-auth-template/modules/common-go/pkg/db/pgsql"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/ginmid"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
 	"anvilkit-auth-template/services/auth-api/internal/config"
 	"anvilkit-auth-template/services/auth-api/internal/handler"
+	"anvilkit-auth-template/services/auth-api/internal/outbox"
 	"anvilkit-auth-template/services/auth-api/internal/store"
 )
 
@@ -38,9 +42,24 @@ func main() {
 	if !authCfg.Analytics.Enabled {
 		analyticsClient = nil
 	}
+	// Producers only enqueue, so the stream options can stay empty.
+	q, err := queue.Open(rdb, cfg.GetString("QUEUE_BACKEND", queue.BackendList), queue.StreamOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	st := &store.Store{DB: db}
+	// The relay also picks up email jobs left in the outbox while Redis was
+	// unavailable, including those of other replicas.
+	relay := &outbox.Relay{Store: st, Queue: q, Interval: time.Duration(cfg.GetInt("EMAIL_OUTBOX_POLL_MS", 1000)) * time.Millisecond}
+	go func() {
+		if err := relay.Run(ctx); err != nil {
+			log.Printf("auth-api outbox relay stopped: %v", err)
+		}
+	}()
 
 	h := &handler.Handler{
-		Store:           &store.Store{DB: db},
+		Store:           st,
 		Redis:           rdb,
 		Analytics:       analyticsClient,
 		JWTIssuer:       authCfg.JWTIssuer,
@@ -54,6 +73,12 @@ func main() {
 		BcryptCost:      authCfg.BcryptCost,
 		LoginFailLimit:  authCfg.LoginFailLimit,
 		LoginFailWindow: authCfg.LoginFailWindow,
+
+		ImpersonationTTL: authCfg.ImpersonationTTL,
+
+		Outbox:   relay,
+		Audit:    &audit.Log{DB: db},
+		Webhooks: &webhooks.Publisher{DB: db, Queue: q, QueueName: cfg.GetString("TENANT_WEBHOOK_QUEUE_NAME", webhooks.DefaultQueueName)},
 	}
 
 	r := gin.New()
@@ -75,8 +100,12 @@ func main() {
 	v1.POST("/auth/login", ginmid.RateLimit(rdb, "rl:login", 30, time.Minute), ginmid.Wrap(h.Login))
 	v1.POST("/auth/refresh", ginmid.Wrap(h.Refresh))
 	v1.POST("/auth/logout", ginmid.Wrap(h.Logout))
-	v1.POST("/auth/logout_all", ginmid.AuthN(h.JWTSecret, h.JWTIssuer, h.JWTAudience), ginmid.Wrap(h.LogoutAll))
-	v1.POST("/auth/switch_tenant", ginmid.AuthN(h.JWTSecret, h.JWTIssuer, h.JWTAudience), ginmid.Wrap(h.SwitchTenant))
+	// Impersonation tokens cannot manage the user's sessions, mint tokens
+	// for other tenants or start further impersonations.
+	v1.POST("/auth/logout_all", ginmid.AuthN(h.JWTSecret, h.JWTIssuer, h.JWTAudience), ginmid.DenyImpersonation(), ginmid.Wrap(h.LogoutAll))
+	v1.POST("/auth/switch_tenant", ginmid.AuthN(h.JWTSecret, h.JWTIssuer, h.JWTAudience), ginmid.DenyImpersonation(), ginmid.Wrap(h.SwitchTenant))
+	v1.POST("/auth/impersonate", ginmid.AuthN(h.JWTSecret, h.JWTIssuer, h.JWTAudience), ginmid.DenyImpersonation(), ginmid.RequirePlatformAdmin(st.IsPlatformAdmin), ginmid.Wrap(h.Impersonate))
+	v1.POST("/auth/impersonate/stop", ginmid.AuthN(h.JWTSecret, h.JWTIssuer, h.JWTAudience), ginmid.Wrap(h.StopImpersonation))
 
 	if err := r.Run(":8080"); err != nil {
 		log.Fatal(err)
@@ -19,6 +19,7 @@ const (
 	defaultBcryptCost       = 12
 	defaultLoginFailLimit   = 5
 	defaultLoginFailWindowM = 10
+	defaultImpersonationMin = 15
 	defaultPublicBaseURL    = "http://localhost:8080"
 )
 
@@ -35,6 +36,8 @@ type AuthConfig struct {
 	BcryptCost      int
 	LoginFailLimit  int
 	LoginFailWindow time.Duration
+
+	ImpersonationTTL time.Duration
 }
 
 func LoadAuthConfigFromEnv() (AuthConfig, error) {
@@ -82,6 +85,10 @@ func LoadAuthConfigFromEnv() (AuthConfig, error) {
 	if err != nil {
 		return AuthConfig{}, err
 	}
+	impersonationTTLMin, err := getPositiveIntFromEnv("IMPERSONATION_TTL_MIN", defaultImpersonationMin)
+	if err != nil {
+		return AuthConfig{}, err
+	}
 	publicBaseURL, err := getPublicBaseURLFromEnv("AUTH_PUBLIC_BASE_URL", defaultPublicBaseURL)
 	if err != nil {
 		return AuthConfig{}, err
@@ -104,6 +111,8 @@ func LoadAuthConfigFromEnv() (AuthConfig, error) {
 		BcryptCost:      bcryptCost,
 		LoginFailLimit:  loginFailLimit,
 		LoginFailWindow: time.Duration(loginFailWindowMin) * time.Minute,
+
+		ImpersonationTTL: time.Duration(impersonationTTLMin) * time.Minute,
 	}, nil
 }
 
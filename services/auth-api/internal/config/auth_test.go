@@ -56,6 +56,7 @@ func TestLoadAuthConfigFromEnvSuccess(t *testing.T) {
 	t.Setenv("LOGIN_FAIL_LIMIT", "7")
 	t.Setenv("LOGIN_FAIL_WINDOW_MIN", "30")
 	t.Setenv("AUTH_PUBLIC_BASE_URL", "https://auth.example.com")
+	t.Setenv("IMPERSONATION_TTL_MIN", "5")
 
 	cfg, err := LoadAuthConfigFromEnv()
 	if err != nil {
@@ -85,6 +86,9 @@ func TestLoadAuthConfigFromEnvSuccess(t *testing.T) {
 	if cfg.PublicBaseURL != "https://auth.example.com" {
 		t.Fatalf("PublicBaseURL = %q, want %q", cfg.PublicBaseURL, "https://auth.example.com")
 	}
+	if cfg.ImpersonationTTL != 5*time.Minute {
+		t.Fatalf("ImpersonationTTL = %v, want %v", cfg.ImpersonationTTL, 5*time.Minute)
+	}
 }
 
 func TestLoadAuthConfigFromEnvInvalidVerificationTTL(t *testing.T) {
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/ginmid"
+	"anvilkit-auth-template/services/auth-api/internal/testutil"
+)
+
+func TestLoginIsAudited(t *testing.T) {
+	db := newTestDB(t)
+	rdb := newTestRedis(t)
+	testutil.TruncateAuthTables(t, db)
+	testutil.FlushRedisKeys(t, rdb, "login_fail:*")
+	seedLoginUser(t, db, "audited@example.com", "Passw0rd!", 1, true)
+
+	gin.SetMode(gin.TestMode)
+	log := &audit.Log{DB: db}
+	h := newTestAuthHandler(t, db, rdb)
+	h.Audit = log
+	r := gin.New()
+	r.Use(ginmid.RequestID(), ginmid.ErrorHandler())
+	r.POST("/v1/auth/login", func(c *gin.Context) { c.Request.RemoteAddr = "192.0.2.1:12345"; ginmid.Wrap(h.Login)(c) })
+
+	for _, password := range []string{"wrong-password", "Passw0rd!"} {
+		performJSONRequest(t, r, http.MethodPost, "/v1/auth/login", map[string]string{"email": "audited@example.com", "password": password})
+	}
+
+	events, _, err := log.List(context.Background(), audit.Filter{TargetID: "audited-example.com", Limit: 10})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(events) != 2 || events[0].Action != audit.ActionLogin || events[1].Action != audit.ActionLoginFailed {
+		t.Fatalf("events=%+v", events)
+	}
+	if events[0].ActorID != "audited-example.com" || events[0].IP != "192.0.2.1" || events[0].RequestID == "" {
+		t.Fatalf("login event=%+v", events[0])
+	}
+	if events[1].ActorID != "" || string(events[1].Metadata) != `{"email": "audited@example.com", "reason": "bad_password"}` {
+		t.Fatalf("failed login event=%+v metadata=%s", events[1], events[1].Metadata)
+	}
+	if checked, err := log.Verify(context.Background()); err != nil || checked != 2 {
+		t.Fatalf("Verify=%d, %v", checked, err)
+	}
+
+	if _, err = db.Exec(context.Background(), `update audit_events set action = 'auth.logout'`); err == nil {
+		t.Fatal("audit_events accepted an update")
+	}
+}
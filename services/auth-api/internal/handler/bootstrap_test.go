@@ -70,7 +70,7 @@ func TestBootstrapSuccessAndLogin(t *testing.T) {
 	}
 
 	var relCount int
-	if err := db.QueryRow(context.Background(), `select count(1) from tenant_users where tenant_id=$1 and user_id=$2 and role='owner'`, body.Data.Tenant.ID, body.Data.OwnerUser.ID).Scan(&relCount); err != nil {
+	if err := db.QueryRow(context.Background(), `select count(1) from tenant_users where tenant_id=$1 and user_id=$2 and roles = '{owner}'`, body.Data.Tenant.ID, body.Data.OwnerUser.ID).Scan(&relCount); err != nil {
 		t.Fatalf("query tenant_users: %v", err)
 	}
 	if relCount != 1 {
@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 // Bootstrap
 
 type BootstrapRequest struct {
@@ -113,3 +115,22 @@ type SwitchTenantResponse struct {
 	AccessToken string `json:"access_token"`
 	ExpiresIn   int    `json:"expires_in"`
 }
+
+// Impersonation
+
+type ImpersonateRequest struct {
+	UserID   string `json:"user_id" binding:"required"`
+	TenantID string `json:"tenant_id"`
+	Reason   string `json:"reason" binding:"required"`
+}
+
+type ImpersonateResponse struct {
+	AccessToken     string    `json:"access_token"`
+	ExpiresIn       int       `json:"expires_in"`
+	ImpersonationID string    `json:"impersonation_id"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+type StopImpersonationResponse struct {
+	OK bool `json:"ok"`
+}
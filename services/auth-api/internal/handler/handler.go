@@ -20,20 +20,22 @@ import (
 	goredis "github.com/redis/go-redis/v9"
 
 	"anvilkit-auth-template/modules/common-go/pkg/analytics"
+	"anvilkit-auth-template/modules/common-go/pkg/audit"
 	ajwt "anvilkit-auth-template/modules/common-go/pkg/auth/jwt"
 	commonemail "anvilkit-auth-template/modules/common-go/pkg/email"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/apperr"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/resp"
-	"anvilkit-auth-template/modules/common-go/pkg/queue"
 	"anvilkit-auth-template/modules/common-go/pkg/util"
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
 	"anvilkit-auth-template/services/auth-api/internal/auth/crypto"
 	"anvilkit-auth-template/services/auth-api/internal/handler/dto"
+	"anvilkit-auth-template/services/auth-api/internal/outbox"
 	"anvilkit-auth-template/services/auth-api/internal/store"
 )
 
 const (
 	userStatusActive             int16 = 1
-	emailQueueName                     = "email:send"
+	emailQueueName                     = store.EmailQueueName
 	defaultVerificationTTL             = 15 * time.Minute
 	verificationEmailSubject           = "Verify your email"
 	verificationAcceptedMessage        = "registration accepted, please check your email for verification"
@@ -62,18 +64,6 @@ end
 return {current, ttl}
 `)
 
-type emailSendJob struct {
-	RecordID  string `json:"record_id"`
-	To        string `json:"to"`
-	Subject   string `json:"subject"`
-	HTMLBody  string `json:"html_body"`
-	TextBody  string `json:"text_body"`
-	OTP       string `json:"otp"`
-	MagicLink string `json:"magic_link"`
-	ExpiresIn string `json:"expires_in"`
-	ResendIn  string `json:"resend_in,omitempty"`
-}
-
 type Handler struct {
 	Store           *store.Store
 	Redis           *goredis.Client
@@ -89,6 +79,19 @@ type Handler struct {
 	BcryptCost      int
 	LoginFailLimit  int
 	LoginFailWindow time.Duration
+
+	ImpersonationTTL time.Duration
+
+	// Audit records logins, logouts, bootstrap and impersonation; nothing is
+	// recorded when it is nil.
+	Audit audit.Recorder
+	// Outbox publishes the email jobs the store writes to email_outbox.
+	// Handlers flush it after committing; without it jobs wait for the
+	// relay of another process.
+	Outbox *outbox.Relay
+	// Webhooks publishes user and membership events to tenant webhooks;
+	// nothing is published when it is nil.
+	Webhooks *webhooks.Publisher
 }
 
 func (h *Handler) Healthz(c *gin.Context) error {
@@ -133,8 +136,16 @@ func (h *Handler) Bootstrap(c *gin.Context) error {
 		}
 		return err
 	}
+	e := audit.FromRequest(c, audit.ActionBootstrap)
+	e.ActorID, e.TenantID, e.TargetType, e.TargetID = res.UserID, res.TenantID, "tenant", res.TenantID
+	e.Metadata = map[string]any{"tenant_name": res.TenantName, "new_user": res.NeedsEmailVerification}
+	h.audit(c, e)
+	if res.NeedsEmailVerification {
+		h.publish(c, res.TenantID, webhooks.EventUserRegistered, map[string]any{"user_id": res.UserID, "email": res.UserEmail})
+	}
+	h.publish(c, res.TenantID, webhooks.EventMemberAdded, map[string]any{"user_id": res.UserID, "roles": []string{"owner"}})
 	if res.NeedsEmailVerification {
-		magicLinkState, expiresAt, err := h.enqueueVerificationEmail(c, res.UserID, res.UserEmail)
+		magicLinkState, expiresAt, err := h.enqueueVerificationEmail(c, res.UserID)
 		if err != nil {
 			return err
 		}
@@ -183,39 +194,12 @@ func (h *Handler) Register(c *gin.Context) error {
 	}
 	verificationTTL := h.verificationTTL()
 	expiresAt := time.Now().Add(verificationTTL)
-	registered, err := h.Store.RegisterWithVerification(c, email, req.Password, h.BcryptCost, otp, magicToken, expiresAt)
-	if err != nil {
-		return err
-	}
-
-	magicLink := buildMagicLink(h.PublicBaseURL, magicToken, magicLinkState)
-	if h.Redis == nil {
-		if cleanupErr := h.Store.CleanupPendingRegistration(c, registered.User.ID); cleanupErr != nil {
-			return fmt.Errorf("redis unavailable; cleanup pending registration: %v", cleanupErr)
-		}
-		return errors.New("redis_unavailable")
-	}
-	q, err := queue.New(h.Redis)
+	registered, err := h.Store.RegisterWithVerification(c, email, req.Password, h.BcryptCost, otp, magicToken, expiresAt,
+		verificationEmailJob(otp, buildMagicLink(h.PublicBaseURL, magicToken, magicLinkState), verificationTTL))
 	if err != nil {
-		if cleanupErr := h.Store.CleanupPendingRegistration(c, registered.User.ID); cleanupErr != nil {
-			return fmt.Errorf("init queue: %w; cleanup pending registration: %v", err, cleanupErr)
-		}
-		return err
-	}
-	if err := q.EnqueueContext(c, emailQueueName, emailSendJob{
-		RecordID:  registered.EmailRecordID,
-		To:        registered.User.Email,
-		Subject:   verificationEmailSubject,
-		OTP:       otp,
-		MagicLink: magicLink,
-		ExpiresIn: formatVerificationExpiresIn(verificationTTL),
-		ResendIn:  formatResendIn(resendVerificationWindow),
-	}); err != nil {
-		if cleanupErr := h.Store.CleanupPendingRegistration(c, registered.User.ID); cleanupErr != nil {
-			return fmt.Errorf("enqueue verification email job: %w; cleanup pending registration: %v", err, cleanupErr)
-		}
 		return err
 	}
+	h.flushOutbox(c, registered.EmailRecordID)
 	setMagicLinkStateCookie(c, magicLinkState, expiresAt)
 	h.trackVerificationRegistrationStarted(c, registered.User.ID, registered.User.Email, "register")
 
@@ -270,44 +254,19 @@ func (h *Handler) ResendVerification(c *gin.Context) error {
 	verificationTTL := h.verificationTTL()
 	expiresAt := now.Add(verificationTTL)
 
-	resend, err := h.Store.ResendVerification(c, emailAddr, otp, magicToken, expiresAt, now)
+	magicLinkState, err := getOrCreateMagicLinkState(c)
+	if err != nil {
+		return err
+	}
+	resent, err := h.Store.ResendVerification(c, emailAddr, otp, magicToken, expiresAt, now,
+		verificationEmailJob(otp, buildMagicLink(h.PublicBaseURL, magicToken, magicLinkState), verificationTTL))
 	if err != nil {
 		if errors.Is(err, store.ErrResendUserNotFound) || errors.Is(err, store.ErrResendAlreadyVerified) {
 			return apperr.BadRequest(errors.New("resend_not_allowed")).WithData(map[string]any{"reason": "resend_not_allowed"})
 		}
 		return err
 	}
-	rollbackResend := func(cause error) error {
-		rollbackErr := h.Store.RollbackResendVerification(c, resend)
-		if rollbackErr == nil {
-			return cause
-		}
-		return fmt.Errorf("%w; rollback resend verification: %v", cause, rollbackErr)
-	}
-
-	magicLinkState, err := getOrCreateMagicLinkState(c)
-	if err != nil {
-		return rollbackResend(err)
-	}
-	magicLink := buildMagicLink(h.PublicBaseURL, magicToken, magicLinkState)
-	if h.Redis == nil {
-		return rollbackResend(errors.New("redis_unavailable"))
-	}
-	q, err := queue.New(h.Redis)
-	if err != nil {
-		return rollbackResend(err)
-	}
-	if err := q.EnqueueContext(c, emailQueueName, emailSendJob{
-		RecordID:  resend.EmailRecordID,
-		To:        resend.UserEmail,
-		Subject:   verificationEmailSubject,
-		OTP:       otp,
-		MagicLink: magicLink,
-		ExpiresIn: formatVerificationExpiresIn(verificationTTL),
-		ResendIn:  formatResendIn(resendVerificationWindow),
-	}); err != nil {
-		return rollbackResend(err)
-	}
+	h.flushOutbox(c, resent.EmailRecordID)
 
 	setMagicLinkStateCookie(c, magicLinkState, expiresAt)
 	c.JSON(http.StatusAccepted, resp.Envelope{
@@ -354,10 +313,11 @@ func (h *Handler) VerifyEmail(c *gin.Context) error {
 		}
 		return err
 	}
-	if activatedNow && h.Analytics != nil {
+	if activatedNow && (h.Analytics != nil || h.Webhooks != nil) {
 		if user, err := h.Store.LookupAnalyticsUserByEmail(c, emailAddr); err != nil {
 			log.Printf("auth-api analytics: lookup otp activation user email=%q: %v", emailAddr, err)
 		} else {
+			h.publishForUser(c, user.UserID, webhooks.EventUserEmailVerified, map[string]any{"user_id": user.UserID, "email": user.Email, "method": "otp"})
 			h.track(c, analytics.Event{
 				Name:      "account_activated",
 				UserID:    user.UserID,
@@ -388,7 +348,7 @@ func (h *Handler) VerifyMagicLink(c *gin.Context) error {
 	}
 	now := time.Now()
 	var magicLinkDetails *store.MagicLinkAnalytics
-	if h.Analytics != nil {
+	if h.Analytics != nil || h.Webhooks != nil {
 		details, err := h.Store.LookupMagicLinkAnalytics(c, token, now)
 		if err != nil {
 			if !errors.Is(err, pgx.ErrNoRows) {
@@ -467,8 +427,9 @@ func (h *Handler) VerifyMagicLink(c *gin.Context) error {
 		}
 		return err
 	}
-	if activatedNow && h.Analytics != nil {
+	if activatedNow && (h.Analytics != nil || h.Webhooks != nil) {
 		if magicLinkDetails != nil {
+			h.publishForUser(c, magicLinkDetails.UserID, webhooks.EventUserEmailVerified, map[string]any{"user_id": magicLinkDetails.UserID, "email": magicLinkDetails.Email, "method": "magic_link"})
 			h.track(c, analytics.Event{
 				Name:      "account_activated",
 				UserID:    magicLinkDetails.UserID,
@@ -507,6 +468,39 @@ func buildMagicLink(publicBaseURL, token, state string) string {
 	return u.String()
 }
 
+// audit records e in the audit log. A failure to record is logged rather than
+// failing the request.
+func (h *Handler) audit(ctx context.Context, e audit.Event) {
+	if h.Audit == nil {
+		return
+	}
+	if err := h.Audit.Record(ctx, e); err != nil {
+		log.Printf("auth-api audit: record action=%q failed: %v", e.Action, err)
+	}
+}
+
+// publish sends an event to the tenant's webhooks. Like audit, a failure is
+// logged rather than failing the request.
+func (h *Handler) publish(ctx context.Context, tid, eventType string, data map[string]any) {
+	if h.Webhooks == nil {
+		return
+	}
+	if _, err := h.Webhooks.Publish(ctx, tid, eventType, data); err != nil {
+		log.Printf("auth-api webhooks: publish event=%q tenant=%q failed: %v", eventType, tid, err)
+	}
+}
+
+// publishForUser sends a user event to the webhooks of each of the user's
+// tenants.
+func (h *Handler) publishForUser(ctx context.Context, userID, eventType string, data map[string]any) {
+	if h.Webhooks == nil {
+		return
+	}
+	if _, err := h.Webhooks.PublishForUser(ctx, userID, eventType, data); err != nil {
+		log.Printf("auth-api webhooks: publish event=%q user=%q failed: %v", eventType, userID, err)
+	}
+}
+
 func (h *Handler) track(ctx context.Context, event analytics.Event) {
 	if h.Analytics == nil {
 		return
@@ -692,7 +686,7 @@ func (h *Handler) verificationTTL() time.Duration {
 	return h.VerificationTTL
 }
 
-func (h *Handler) enqueueVerificationEmail(c *gin.Context, userID, email string) (string, time.Time, error) {
+func (h *Handler) enqueueVerificationEmail(c *gin.Context, userID string) (string, time.Time, error) {
 	otp, err := commonemail.GenerateOTP()
 	if err != nil {
 		return "", time.Time{}, err
@@ -712,30 +706,36 @@ func (h *Handler) enqueueVerificationEmail(c *gin.Context, userID, email string)
 		OTP:        otp,
 		MagicToken: magicToken,
 		ExpiresAt:  expiresAt,
+		Email:      verificationEmailJob(otp, buildMagicLink(h.PublicBaseURL, magicToken, magicLinkState), verificationTTL),
 	})
 	if err != nil {
 		return "", time.Time{}, err
 	}
-	if h.Redis == nil {
-		return "", time.Time{}, errors.New("redis_unavailable")
-	}
-	q, err := queue.New(h.Redis)
-	if err != nil {
-		return "", time.Time{}, err
-	}
-	magicLink := buildMagicLink(h.PublicBaseURL, magicToken, magicLinkState)
-	if err := q.EnqueueContext(c, emailQueueName, emailSendJob{
-		RecordID:  created.EmailRecordID,
-		To:        email,
+	h.flushOutbox(c, created.EmailRecordID)
+	return magicLinkState, expiresAt, nil
+}
+
+// verificationEmailJob is the verification email for the outbox; the store
+// fills in the record ID and recipient.
+func verificationEmailJob(otp, magicLink string, verificationTTL time.Duration) store.EmailSendJob {
+	return store.EmailSendJob{
 		Subject:   verificationEmailSubject,
 		OTP:       otp,
 		MagicLink: magicLink,
 		ExpiresIn: formatVerificationExpiresIn(verificationTTL),
 		ResendIn:  formatResendIn(resendVerificationWindow),
-	}); err != nil {
-		return "", time.Time{}, err
 	}
-	return magicLinkState, expiresAt, nil
+}
+
+// flushOutbox queues the email job of the record just committed. A failure
+// or timeout is logged; the job stays in the outbox and the relay retries it.
+func (h *Handler) flushOutbox(ctx context.Context, emailRecordID string) {
+	if h.Outbox == nil {
+		return
+	}
+	if _, err := h.Outbox.Publish(ctx, emailRecordID); err != nil {
+		log.Printf("auth-api outbox: flush failed: %v", err)
+	}
 }
 
 func (h *Handler) Login(c *gin.Context) error {
@@ -757,6 +757,7 @@ func (h *Handler) Login(c *gin.Context) error {
 	if blocked, err := h.isLoginRateLimited(c, key); err != nil {
 		return err
 	} else if blocked {
+		h.auditLoginFailure(c, "", email, "rate_limited")
 		return apperr.RateLimited(errors.New("login_rate_limited"))
 	}
 
@@ -764,6 +765,7 @@ func (h *Handler) Login(c *gin.Context) error {
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			h.increaseLoginFailCount(c, key)
+			h.auditLoginFailure(c, "", email, "unknown_user")
 			return apperr.Unauthorized(errors.New("invalid_credentials"))
 		}
 		return err
@@ -775,10 +777,12 @@ func (h *Handler) Login(c *gin.Context) error {
 		})
 	}
 	if user.Status != userStatusActive {
+		h.auditLoginFailure(c, user.ID, email, "user_inactive")
 		return apperr.Unauthorized(errors.New("invalid_credentials"))
 	}
 	if crypto.VerifyPassword(user.PasswordHash, req.Password) != nil {
 		h.increaseLoginFailCount(c, key)
+		h.auditLoginFailure(c, user.ID, email, "bad_password")
 		return apperr.Unauthorized(errors.New("invalid_credentials"))
 	}
 
@@ -789,6 +793,9 @@ func (h *Handler) Login(c *gin.Context) error {
 	if h.Redis != nil {
 		_ = h.Redis.Del(c, key).Err()
 	}
+	e := audit.FromRequest(c, audit.ActionLogin)
+	e.ActorID, e.TargetType, e.TargetID = user.ID, "user", user.ID
+	h.audit(c, e)
 
 	resp.OK(c, dto.LoginResponse{
 		AccessToken:      at,
@@ -840,9 +847,15 @@ func (h *Handler) Logout(c *gin.Context) error {
 	if err := c.ShouldBindJSON(&req); err != nil {
 		return apperr.BadRequest(err)
 	}
-	if err := h.Store.RevokeRefreshToken(c, req.RefreshToken); err != nil {
+	uid, err := h.Store.RevokeRefreshToken(c, req.RefreshToken)
+	if err != nil {
 		return err
 	}
+	if uid != "" {
+		e := audit.FromRequest(c, audit.ActionLogout)
+		e.ActorID, e.TargetType, e.TargetID = uid, "user", uid
+		h.audit(c, e)
+	}
 	resp.OK(c, dto.LogoutResponse{OK: true})
 	return nil
 }
@@ -856,6 +869,10 @@ func (h *Handler) LogoutAll(c *gin.Context) error {
 	if err != nil {
 		return err
 	}
+	e := audit.FromRequest(c, audit.ActionLogoutAll)
+	e.TargetType, e.TargetID = "user", uid
+	e.Metadata = map[string]any{"revoked_count": revokedCount}
+	h.audit(c, e)
 	resp.OK(c, dto.LogoutAllResponse{OK: true, RevokedCount: revokedCount})
 	return nil
 }
@@ -878,14 +895,22 @@ func (h *Handler) SwitchTenant(c *gin.Context) error {
 		return apperr.BadRequest(errors.New("invalid_tenant_id"))
 	}
 
-	if err := h.Store.EnsureUserInTenant(c, uid, tenantID); err != nil {
+	tenantAuthz, err := h.Store.TenantAuthz(c, uid, tenantID)
+	if err != nil {
 		if errors.Is(err, store.ErrNotInTenant) {
 			return apperr.Forbidden(err).WithData(map[string]any{"reason": "not_in_tenant"})
 		}
 		return err
 	}
 
-	at, err := ajwt.SignAccessToken(h.JWTSecret, h.JWTIssuer, h.JWTAudience, uid, &tenantID, h.AccessTTL)
+	authz := ajwt.Authz{Roles: tenantAuthz.Roles, Scopes: tenantAuthz.Permissions, Version: tenantAuthz.Version}
+	at, err := ajwt.SignAccessTokenWithAuthz(h.JWTSecret, h.JWTIssuer, h.JWTAudience, uid, tenantID, authz, h.AccessTTL)
+	if errors.Is(err, ajwt.ErrAuthzClaimsTooLarge) {
+		// Fall back to a token without roles/scp; services then resolve
+		// permissions server-side as before.
+		log.Printf("auth-api switch_tenant: authz claims dropped tenant_id=%q: %v", tenantID, err)
+		at, err = ajwt.SignAccessTokenWithAuthz(h.JWTSecret, h.JWTIssuer, h.JWTAudience, uid, tenantID, ajwt.Authz{Version: tenantAuthz.Version}, h.AccessTTL)
+	}
 	if err != nil {
 		return err
 	}
@@ -945,6 +970,15 @@ func (h *Handler) checkResendRateLimit(ctx context.Context, emailAddr string) (i
 	return count, retryAfterSeconds, nil
 }
 
+// auditLoginFailure records a rejected password login. userID is empty when
+// no user has the email.
+func (h *Handler) auditLoginFailure(c *gin.Context, userID, email, reason string) {
+	e := audit.FromRequest(c, audit.ActionLoginFailed)
+	e.TargetType, e.TargetID = "user", userID
+	e.Metadata = map[string]any{"email": email, "reason": reason}
+	h.audit(c, e)
+}
+
 func (h *Handler) isLoginRateLimited(ctx context.Context, key string) (bool, error) {
 	if h.Redis == nil {
 		return false, nil
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	ajwt "anvilkit-auth-template/modules/common-go/pkg/auth/jwt"
+	"anvilkit-auth-template/modules/common-go/pkg/httpx/ginmid"
+	"anvilkit-auth-template/services/auth-api/internal/store"
+	"anvilkit-auth-template/services/auth-api/internal/testutil"
+)
+
+func TestImpersonationLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	rdb := newTestRedis(t)
+	testutil.TruncateAuthTables(t, db)
+
+	adminID := uuid.NewString()
+	userID := uuid.NewString()
+	tenantID := uuid.NewString()
+	seedAuthUser(t, db, adminID, "platform-admin@example.com")
+	seedAuthUser(t, db, userID, "customer@example.com")
+	if _, err := db.Exec(context.Background(), `update users set platform_role='admin' where id=$1`, adminID); err != nil {
+		t.Fatalf("grant platform admin: %v", err)
+	}
+	if _, err := db.Exec(context.Background(), `insert into tenants(id,name,created_at) values($1,$2,now())`, tenantID, "Acme"); err != nil {
+		t.Fatalf("insert tenant: %v", err)
+	}
+	if _, err := db.Exec(context.Background(), `insert into tenant_users(tenant_id,user_id,roles,created_at) values($1,$2,'{member}',now())`, tenantID, userID); err != nil {
+		t.Fatalf("insert tenant_users: %v", err)
+	}
+
+	h := newTestAuthHandler(t, db, rdb)
+	h.ImpersonationTTL = 5 * time.Minute
+	r := newImpersonationRouter(h)
+
+	adminToken, err := ajwt.SignAccessToken(h.JWTSecret, h.JWTIssuer, h.JWTAudience, adminID, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("sign admin token: %v", err)
+	}
+	userToken, err := ajwt.SignAccessToken(h.JWTSecret, h.JWTIssuer, h.JWTAudience, userID, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("sign user token: %v", err)
+	}
+
+	res := performAuthedJSONRequest(t, r, http.MethodPost, "/v1/auth/impersonate", userToken, map[string]string{"user_id": adminID, "reason": "curious"})
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("non-admin status=%d want=%d body=%s", res.Code, http.StatusForbidden, res.Body.String())
+	}
+
+	res = performAuthedJSONRequest(t, r, http.MethodPost, "/v1/auth/impersonate", adminToken, map[string]string{"user_id": userID, "tenant_id": tenantID, "reason": "ticket 4711"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("impersonate status=%d want=%d body=%s", res.Code, http.StatusOK, res.Body.String())
+	}
+	var body struct {
+		Data struct {
+			AccessToken     string `json:"access_token"`
+			ExpiresIn       int    `json:"expires_in"`
+			ImpersonationID string `json:"impersonation_id"`
+		} `json:"data"`
+	}
+	decodeResponse(t, res, &body)
+	if body.Data.ExpiresIn != 300 {
+		t.Fatalf("expires_in=%d want=300", body.Data.ExpiresIn)
+	}
+	claims, err := ajwt.Parse(h.JWTSecret, h.JWTIssuer, h.JWTAudience, body.Data.AccessToken)
+	if err != nil {
+		t.Fatalf("parse impersonation token: %v", err)
+	}
+	if claims.Subject != userID || claims.TID != tenantID || claims.Act == nil || claims.Act.Sub != adminID || claims.ID != body.Data.ImpersonationID {
+		t.Fatalf("claims sub=%q tid=%q act=%+v jti=%q", claims.Subject, claims.TID, claims.Act, claims.ID)
+	}
+	if !slices.Equal(claims.Roles, []string{"member"}) {
+		t.Fatalf("claims.roles=%v want [member]", claims.Roles)
+	}
+
+	for _, path := range []string{"/v1/auth/switch_tenant", "/v1/auth/logout_all", "/v1/auth/impersonate"} {
+		res = performAuthedJSONRequest(t, r, http.MethodPost, path, body.Data.AccessToken, map[string]string{"tenant_id": tenantID, "user_id": adminID, "reason": "nested"})
+		if res.Code != http.StatusForbidden {
+			t.Fatalf("%s status=%d want=%d body=%s", path, res.Code, http.StatusForbidden, res.Body.String())
+		}
+	}
+
+	st := &store.Store{DB: db}
+	if active, err := st.ImpersonationActive(context.Background(), body.Data.ImpersonationID); err != nil || !active {
+		t.Fatalf("ImpersonationActive=%v, %v want true", active, err)
+	}
+	res = performAuthedJSONRequest(t, r, http.MethodPost, "/v1/auth/impersonate/stop", body.Data.AccessToken, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("stop status=%d want=%d body=%s", res.Code, http.StatusOK, res.Body.String())
+	}
+	if active, err := st.ImpersonationActive(context.Background(), body.Data.ImpersonationID); err != nil || active {
+		t.Fatalf("ImpersonationActive after stop=%v, %v want false", active, err)
+	}
+
+	var actor, reason, endedBy string
+	err = db.QueryRow(context.Background(), `select actor_user_id, reason, ended_by from impersonation_sessions where id=$1`, body.Data.ImpersonationID).Scan(&actor, &reason, &endedBy)
+	if err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	if actor != adminID || reason != "ticket 4711" || endedBy != adminID {
+		t.Fatalf("session actor=%q reason=%q ended_by=%q", actor, reason, endedBy)
+	}
+}
+
+func newImpersonationRouter(h *Handler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginmid.RequestID(), ginmid.ErrorHandler())
+	authn := ginmid.AuthN(h.JWTSecret, h.JWTIssuer, h.JWTAudience)
+	r.POST("/v1/auth/logout_all", authn, ginmid.DenyImpersonation(), ginmid.Wrap(h.LogoutAll))
+	r.POST("/v1/auth/switch_tenant", authn, ginmid.DenyImpersonation(), ginmid.Wrap(h.SwitchTenant))
+	r.POST("/v1/auth/impersonate", authn, ginmid.DenyImpersonation(), ginmid.RequirePlatformAdmin(h.Store.IsPlatformAdmin), ginmid.Wrap(h.Impersonate))
+	r.POST("/v1/auth/impersonate/stop", authn, ginmid.Wrap(h.StopImpersonation))
+	return r
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -18,6 +19,7 @@ import (
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/errcode"
 	"anvilkit-auth-template/modules/common-go/pkg/httpx/ginmid"
 	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/services/auth-api/internal/outbox"
 	"anvilkit-auth-template/services/auth-api/internal/testutil"
 )
 
@@ -480,53 +482,128 @@ func TestVerifyEmailTooManyAttemptsReturnsTooManyAttempts(t *testing.T) {
 	assertVerifyEmailErrorReason(t, correctAfterLockRes, "too_many_attempts")
 }
 
-func TestRegisterQueueUnavailableCleansUpPendingUser(t *testing.T) {
+func TestRegisterQueueUnavailableKeepsJobInOutbox(t *testing.T) {
 	db := newTestDB(t)
+	rdb := newTestRedis(t)
 	testutil.TruncateAuthTables(t, db)
+	testutil.FlushRedisKeys(t, rdb, emailQueueName)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginmid.RequestID(), ginmid.ErrorHandler())
+	h := newTestAuthHandler(t, db, nil)
+	h.Outbox = &outbox.Relay{Store: h.Store, Queue: failingQueue{}}
+	r.POST("/v1/auth/register", ginmid.Wrap(h.Register))
 
-	r := newRegisterRouter(t, db, nil, 8)
 	res := performJSONRequest(t, r, http.MethodPost, "/v1/auth/register", map[string]string{
 		"email":    "queue-down@example.com",
 		"password": "Passw0rd!",
 	})
-	if res.Code != http.StatusInternalServerError {
-		t.Fatalf("status=%d want=%d body=%s", res.Code, http.StatusInternalServerError, res.Body.String())
-	}
-
-	var body struct {
-		Code int `json:"code"`
-	}
-	decodeResponse(t, res, &body)
-	if body.Code != errcode.InternalError {
-		t.Fatalf("code=%d want=%d", body.Code, errcode.InternalError)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("status=%d want=%d body=%s", res.Code, http.StatusAccepted, res.Body.String())
 	}
 
 	var usersCount int
 	if err := db.QueryRow(context.Background(), `select count(1) from users where email=$1`, "queue-down@example.com").Scan(&usersCount); err != nil {
 		t.Fatalf("query users: %v", err)
 	}
-	if usersCount != 0 {
-		t.Fatalf("users count=%d want=0", usersCount)
+	if usersCount != 1 {
+		t.Fatalf("users count=%d want=1", usersCount)
+	}
+	var (
+		attempts  int
+		lastError *string
+	)
+	if err := db.QueryRow(context.Background(), `select attempts, last_error from email_outbox where payload->>'to' = $1`, "queue-down@example.com").Scan(&attempts, &lastError); err != nil {
+		t.Fatalf("query email_outbox: %v", err)
+	}
+	if attempts != 1 || lastError == nil || *lastError != "redis down" {
+		t.Fatalf("outbox attempts=%d last_error=%v want 1 and redis down", attempts, lastError)
 	}
 
-	var verificationsCount int
-	if err := db.QueryRow(context.Background(), `
-select count(1)
-from email_verifications ev
-join users u on u.id=ev.user_id
-where u.email=$1`, "queue-down@example.com").Scan(&verificationsCount); err != nil {
-		t.Fatalf("query email_verifications: %v", err)
+	// Once Redis is back the relay queues the job.
+	if _, err := db.Exec(context.Background(), `update email_outbox set available_at=now()`); err != nil {
+		t.Fatalf("reset available_at: %v", err)
+	}
+	q, err := queue.New(rdb)
+	if err != nil {
+		t.Fatalf("new queue: %v", err)
+	}
+	relay := &outbox.Relay{Store: h.Store, Queue: q}
+	if n, err := relay.Flush(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Flush n=%d err=%v want 1", n, err)
+	}
+	job, err := popQueuedJob(t, rdb)
+	if err != nil {
+		t.Fatalf("pop queued job: %v", err)
+	}
+	if job.To != "queue-down@example.com" || job.RecordID == "" || !otpPattern.MatchString(job.OTP) {
+		t.Fatalf("unexpected queued job: %+v", job)
+	}
+	var outboxCount int
+	if err := db.QueryRow(context.Background(), `select count(1) from email_outbox`).Scan(&outboxCount); err != nil {
+		t.Fatalf("query email_outbox: %v", err)
 	}
-	if verificationsCount != 0 {
-		t.Fatalf("email_verifications count=%d want=0", verificationsCount)
+	if outboxCount != 0 {
+		t.Fatalf("email_outbox count=%d want=0", outboxCount)
 	}
+}
 
-	var recordsCount int
-	if err := db.QueryRow(context.Background(), `select count(1) from email_records where to_email=$1`, "queue-down@example.com").Scan(&recordsCount); err != nil {
-		t.Fatalf("query email_records: %v", err)
+func TestRegisterDoesNotWaitForStuckRelay(t *testing.T) {
+	db := newTestDB(t)
+	testutil.TruncateAuthTables(t, db)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginmid.RequestID(), ginmid.ErrorHandler())
+	h := newTestAuthHandler(t, db, nil)
+	r.POST("/v1/auth/register", ginmid.Wrap(h.Register))
+
+	// Leave one job in the outbox, then have a background flush hang on it
+	// while holding the relay's lock and the row.
+	res := performJSONRequest(t, r, http.MethodPost, "/v1/auth/register", map[string]string{
+		"email":    "stuck-first@example.com",
+		"password": "Passw0rd!",
+	})
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("status=%d want=%d body=%s", res.Code, http.StatusAccepted, res.Body.String())
+	}
+	q := &hangingQueue{entered: make(chan struct{}, 2)}
+	h.Outbox = &outbox.Relay{Store: h.Store, Queue: q, PublishTimeout: 100 * time.Millisecond}
+	flushCtx, cancelFlush := context.WithCancel(context.Background())
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		_, _ = h.Outbox.Flush(flushCtx)
+	}()
+	t.Cleanup(func() {
+		cancelFlush()
+		<-flushed
+	})
+	select {
+	case <-q.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("flush did not reach the queue")
+	}
+
+	start := time.Now()
+	res = performJSONRequest(t, r, http.MethodPost, "/v1/auth/register", map[string]string{
+		"email":    "stuck-second@example.com",
+		"password": "Passw0rd!",
+	})
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("status=%d want=%d body=%s", res.Code, http.StatusAccepted, res.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("register took %v while the relay was stuck", elapsed)
+	}
+
+	var outboxCount int
+	if err := db.QueryRow(context.Background(), `select count(1) from email_outbox`).Scan(&outboxCount); err != nil {
+		t.Fatalf("query email_outbox: %v", err)
 	}
-	if recordsCount != 0 {
-		t.Fatalf("email_records count=%d want=0", recordsCount)
+	if outboxCount != 2 {
+		t.Fatalf("email_outbox count=%d want=2", outboxCount)
 	}
 }
 
@@ -867,6 +944,26 @@ func TestIsSecureRequestByTLSOrProxyHeaders(t *testing.T) {
 	}
 }
 
+type failingQueue struct{}
+
+func (failingQueue) EnqueueContext(context.Context, string, any) error {
+	return errors.New("redis down")
+}
+
+// hangingQueue blocks every enqueue until its context ends.
+type hangingQueue struct {
+	entered chan struct{}
+}
+
+func (q *hangingQueue) EnqueueContext(ctx context.Context, _ string, _ any) error {
+	select {
+	case q.entered <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
 func popQueuedJob(t *testing.T, rdb *goredis.Client) (queuedEmailJob, error) {
 	t.Helper()
 	raw, err := rdb.LPop(context.Background(), emailQueueName).Result()
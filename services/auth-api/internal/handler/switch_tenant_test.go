@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"net/http"
+	"slices"
 	"testing"
 	"time"
 
@@ -28,7 +29,7 @@ func TestSwitchTenantSuccessReturnsTokenWithTID(t *testing.T) {
 	if err != nil {
 		t.Fatalf("insert tenant: %v", err)
 	}
-	_, err = db.Exec(context.Background(), `insert into tenant_users(tenant_id,user_id,role,created_at) values($1,$2,'member',now())`, tenantID, uid)
+	_, err = db.Exec(context.Background(), `insert into tenant_users(tenant_id,user_id,roles,created_at) values($1,$2,'{member}',now())`, tenantID, uid)
 	if err != nil {
 		t.Fatalf("insert tenant_users: %v", err)
 	}
@@ -67,6 +68,150 @@ func TestSwitchTenantSuccessReturnsTokenWithTID(t *testing.T) {
 	if claims.TID != tenantID {
 		t.Fatalf("claims.tid=%q want=%q", claims.TID, tenantID)
 	}
+	if !slices.Equal(claims.Roles, []string{"member"}) || len(claims.Scp) != 0 || claims.AuthzVer != 1 {
+		t.Fatalf("authz claims roles=%v scp=%v azv=%d", claims.Roles, claims.Scp, claims.AuthzVer)
+	}
+}
+
+func TestSwitchTenantEmbedsCustomRoleScopes(t *testing.T) {
+	db := newTestDB(t)
+	rdb := newTestRedis(t)
+	testutil.TruncateAuthTables(t, db)
+
+	uid := uuid.NewString()
+	tenantID := uuid.NewString()
+	seedAuthUser(t, db, uid, "switch-scopes@example.com")
+	_, err := db.Exec(context.Background(), `insert into tenants(id,name,created_at) values($1,$2,now())`, tenantID, "Scoped")
+	if err != nil {
+		t.Fatalf("insert tenant: %v", err)
+	}
+	_, err = db.Exec(context.Background(), `insert into tenant_users(tenant_id,user_id,roles,authz_version,created_at) values($1,$2,'{support}',4,now())`, tenantID, uid)
+	if err != nil {
+		t.Fatalf("insert tenant_users: %v", err)
+	}
+	domain := "tenant:" + tenantID
+	_, err = db.Exec(context.Background(), `insert into casbin_rule(ptype,v0,v1,v2) values('g','role:support','perm:members:read',$1),('g','role:support','perm:roles:read',$1)`, domain)
+	if err != nil {
+		t.Fatalf("insert casbin_rule: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(context.Background(), `delete from casbin_rule where v2=$1`, domain)
+	})
+
+	h := newTestAuthHandler(t, db, rdb)
+	token, err := ajwt.SignAccessToken(h.JWTSecret, h.JWTIssuer, h.JWTAudience, uid, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("sign access token: %v", err)
+	}
+
+	r := newSwitchTenantRouter(h)
+	res := performAuthedJSONRequest(t, r, http.MethodPost, "/v1/auth/switch_tenant", token, map[string]string{"tenant_id": tenantID})
+	if res.Code != http.StatusOK {
+		t.Fatalf("status=%d want=%d body=%s", res.Code, http.StatusOK, res.Body.String())
+	}
+
+	var body struct {
+		Data struct {
+			AccessToken string `json:"access_token"`
+		} `json:"data"`
+	}
+	decodeResponse(t, res, &body)
+	claims, err := ajwt.Parse(h.JWTSecret, h.JWTIssuer, h.JWTAudience, body.Data.AccessToken)
+	if err != nil {
+		t.Fatalf("parse switched token: %v", err)
+	}
+	if !slices.Equal(claims.Roles, []string{"support"}) {
+		t.Fatalf("claims.roles=%v want=[support]", claims.Roles)
+	}
+	if !slices.Equal(claims.Scp, []string{"members:read", "roles:read"}) {
+		t.Fatalf("claims.scp=%v want=[members:read roles:read]", claims.Scp)
+	}
+	if claims.AuthzVer != 4 {
+		t.Fatalf("claims.azv=%d want=4", claims.AuthzVer)
+	}
+}
+
+func TestSwitchTenantEmbedsGroupAndOrgRoles(t *testing.T) {
+	db := newTestDB(t)
+	rdb := newTestRedis(t)
+	testutil.TruncateAuthTables(t, db)
+
+	ctx := context.Background()
+	memberID := uuid.NewString()
+	orgAdminID := uuid.NewString()
+	tenantID := uuid.NewString()
+	orgID := uuid.NewString()
+	seedAuthUser(t, db, memberID, "switch-groups@example.com")
+	seedAuthUser(t, db, orgAdminID, "switch-org@example.com")
+	domain := "tenant:" + tenantID
+	for _, stmt := range []struct {
+		sql  string
+		args []any
+	}{
+		{`insert into organizations(id,name,created_at) values($1,$1,now())`, []any{orgID}},
+		{`insert into tenants(id,name,org_id,created_at) values($1,$2,$3,now())`, []any{tenantID, "Grouped", orgID}},
+		{`insert into tenant_users(tenant_id,user_id,roles,created_at) values($1,$2,'{member}',now()),($1,$3,'{member}',now())`, []any{tenantID, memberID, orgAdminID}},
+		{`insert into organization_members(org_id,user_id,roles,created_at) values($1,$2,'{admin}',now())`, []any{orgID, orgAdminID}},
+		{`insert into tenant_groups(id,tenant_id,display_name) values('support',$1,'Support'),('staff',$1,'Staff')`, []any{tenantID}},
+		{`insert into tenant_group_members(group_id,tenant_id,user_id) values('support',$1,$2)`, []any{tenantID, memberID}},
+		// support grants the auditor role and is nested in staff, which grants
+		// audit:read directly.
+		{`insert into casbin_rule(ptype,v0,v1,v2) values
+  ('g','role:auditor','perm:roles:read',$1),
+  ('g','group:support','role:auditor',$1),
+  ('g','group:support','group:staff',$1),
+  ('g','group:staff','perm:audit:read',$1)`, []any{domain}},
+		{`insert into casbin_rule(ptype,v0,v1,v2,v3) values('p','perm:members:read','tenant:*','/api/v1/admin/tenants/:tenantId/members','GET')`, nil},
+	} {
+		if _, err := db.Exec(ctx, stmt.sql, stmt.args...); err != nil {
+			t.Fatalf("seed %q: %v", stmt.sql, err)
+		}
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(context.Background(), `delete from casbin_rule where v2=$1 or (ptype='p' and v0='perm:members:read')`, domain)
+		_, _ = db.Exec(context.Background(), `delete from organizations where id=$1`, orgID)
+	})
+
+	h := newTestAuthHandler(t, db, rdb)
+	r := newSwitchTenantRouter(h)
+	switchClaims := func(t *testing.T, uid string) *ajwt.Claims {
+		t.Helper()
+		token, err := ajwt.SignAccessToken(h.JWTSecret, h.JWTIssuer, h.JWTAudience, uid, nil, time.Minute)
+		if err != nil {
+			t.Fatalf("sign access token: %v", err)
+		}
+		res := performAuthedJSONRequest(t, r, http.MethodPost, "/v1/auth/switch_tenant", token, map[string]string{"tenant_id": tenantID})
+		if res.Code != http.StatusOK {
+			t.Fatalf("status=%d want=%d body=%s", res.Code, http.StatusOK, res.Body.String())
+		}
+		var body struct {
+			Data struct {
+				AccessToken string `json:"access_token"`
+			} `json:"data"`
+		}
+		decodeResponse(t, res, &body)
+		claims, err := ajwt.Parse(h.JWTSecret, h.JWTIssuer, h.JWTAudience, body.Data.AccessToken)
+		if err != nil {
+			t.Fatalf("parse switched token: %v", err)
+		}
+		return claims
+	}
+
+	claims := switchClaims(t, memberID)
+	if !slices.Equal(claims.Roles, []string{"auditor", "member"}) {
+		t.Fatalf("group member roles=%v want=[auditor member]", claims.Roles)
+	}
+	if !slices.Equal(claims.Scp, []string{"audit:read", "roles:read"}) {
+		t.Fatalf("group member scp=%v want=[audit:read roles:read]", claims.Scp)
+	}
+
+	claims = switchClaims(t, orgAdminID)
+	if !slices.Equal(claims.Roles, []string{"admin", "member"}) {
+		t.Fatalf("org admin roles=%v want=[admin member]", claims.Roles)
+	}
+	if !slices.Contains(claims.Scp, "members:read") {
+		t.Fatalf("org admin scp=%v want every permission", claims.Scp)
+	}
 }
 
 func TestSwitchTenantForbiddenWhenNotInTenant(t *testing.T) {
@@ -14,6 +14,8 @@ import (
 	goredis "github.com/redis/go-redis/v9"
 
 	"anvilkit-auth-template/modules/common-go/pkg/analytics"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/services/auth-api/internal/outbox"
 	"anvilkit-auth-template/services/auth-api/internal/store"
 	"anvilkit-auth-template/services/auth-api/internal/testutil"
 )
@@ -100,8 +102,18 @@ func decodeResponse(t *testing.T, res *httptest.ResponseRecorder, out any) {
 
 func newTestAuthHandler(t *testing.T, db *pgxpool.Pool, rdb *goredis.Client) *Handler {
 	t.Helper()
+	st := &store.Store{DB: db}
+	var relay *outbox.Relay
+	if rdb != nil {
+		q, err := queue.New(rdb)
+		if err != nil {
+			t.Fatalf("new queue: %v", err)
+		}
+		relay = &outbox.Relay{Store: st, Queue: q}
+	}
 	return &Handler{
-		Store:           &store.Store{DB: db},
+		Store:           st,
+		Outbox:          relay,
 		Redis:           rdb,
 		Analytics:       analytics.NoopClient{},
 		JWTIssuer:       "anvilkit-auth",
@@ -0,0 +1,105 @@
+// Package outbox publishes email jobs from the email_outbox table to the Redis
+// queue.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"anvilkit-auth-template/services/auth-api/internal/store"
+)
+
+const (
+	defaultBatchSize      = 100
+	defaultInterval       = time.Second
+	defaultPublishTimeout = 2 * time.Second
+)
+
+// Queue is the subset of queue.Queue the relay needs.
+type Queue interface {
+	EnqueueContext(ctx context.Context, queueName string, payload any) error
+}
+
+// Relay moves committed outbox rows to the queue. Handlers call Publish for
+// the rows they committed so emails go out without waiting for the next
+// poll; Run polls for rows left behind when Redis was unavailable.
+type Relay struct {
+	Store     *store.Store
+	Queue     Queue
+	BatchSize int
+	Interval  time.Duration
+	// PublishTimeout bounds Publish so a slow or failing queue does not hold
+	// up the request that called it.
+	PublishTimeout time.Duration
+
+	// flushing serializes Flush calls of this process; other replicas are
+	// kept apart by row locks.
+	flushing sync.Mutex
+}
+
+// Run flushes the outbox every Interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("auth-api outbox: relay failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes due outbox messages until none are left and returns how
+// many were published.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	if r.Queue == nil {
+		return 0, errors.New("outbox relay has no queue")
+	}
+	batch := r.BatchSize
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+	r.flushing.Lock()
+	defer r.flushing.Unlock()
+
+	total := 0
+	for {
+		n, err := r.Store.RelayEmailOutbox(ctx, batch, r.publish)
+		total += n
+		if err != nil || n < batch {
+			return total, err
+		}
+	}
+}
+
+// Publish queues the due outbox messages of the given email records and
+// returns how many were published. Unlike Flush it does not wait for other
+// flushes of this process, skips rows another relay holds and gives up after
+// PublishTimeout; what it leaves behind is picked up by Run.
+func (r *Relay) Publish(ctx context.Context, emailRecordIDs ...string) (int, error) {
+	if r.Queue == nil {
+		return 0, errors.New("outbox relay has no queue")
+	}
+	timeout := r.PublishTimeout
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return r.Store.RelayEmailOutboxRecords(ctx, emailRecordIDs, r.publish)
+}
+
+func (r *Relay) publish(ctx context.Context, m store.OutboxMessage) error {
+	return r.Queue.EnqueueContext(ctx, m.QueueName, m.Payload)
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrUserNotFound = errors.New("user_not_found")
+
+// StartImpersonationParams describes an impersonation being started.
+type StartImpersonationParams struct {
+	ActorUserID string
+	UserID      string
+	TenantID    string
+	Reason      string
+	IP          string
+	UserAgent   string
+	ExpiresAt   time.Time
+}
+
+type ImpersonationSession struct {
+	ID        string
+	StartedAt time.Time
+	ExpiresAt time.Time
+}
+
+// StartImpersonation records the start of an impersonation. It fails with
+// ErrUserNotFound if the user to impersonate does not exist.
+func (s *Store) StartImpersonation(ctx context.Context, params StartImpersonationParams) (*ImpersonationSession, error) {
+	var tenantID *string
+	if params.TenantID != "" {
+		tenantID = &params.TenantID
+	}
+	session := ImpersonationSession{ID: uuid.NewString()}
+	err := s.DB.QueryRow(ctx, `
+insert into impersonation_sessions(id, actor_user_id, user_id, tenant_id, reason, ip, user_agent, started_at, expires_at)
+select $1, $2, u.id, $4, $5, $6, $7, now(), $8
+from users u
+where u.id = $3
+returning started_at, expires_at`,
+		session.ID, params.ActorUserID, params.UserID, tenantID, params.Reason, params.IP, params.UserAgent, params.ExpiresAt,
+	).Scan(&session.StartedAt, &session.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// StopImpersonation ends an active impersonation session. It reports whether
+// the session was still active.
+func (s *Store) StopImpersonation(ctx context.Context, id, endedBy string) (bool, error) {
+	ct, err := s.DB.Exec(ctx, `update impersonation_sessions set ended_at=now(), ended_by=$2 where id=$1 and ended_at is null`, id, endedBy)
+	if err != nil {
+		return false, err
+	}
+	return ct.RowsAffected() > 0, nil
+}
+
+// ImpersonationActive reports whether an impersonation session is neither
+// stopped nor expired.
+func (s *Store) ImpersonationActive(ctx context.Context, id string) (bool, error) {
+	var active bool
+	err := s.DB.QueryRow(ctx, `select exists(select 1 from impersonation_sessions where id=$1 and ended_at is null and expires_at > now())`, id).Scan(&active)
+	return active, err
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+)
+
+// EmailQueueName is the Redis queue email-worker consumes transactional
+// email from; other priorities use queues derived from it.
+const EmailQueueName = "email:send"
+
+// EmailQueueFor returns the queue for email jobs of priority, one of the
+// queue.Priority constants. One-time codes and verification links are
+// transactional so they never wait behind notifications or bulk mail.
+func EmailQueueFor(priority string) (string, error) {
+	return queue.PriorityQueueName(EmailQueueName, priority)
+}
+
+// EmailSendJob is the email-worker job payload.
+type EmailSendJob struct {
+	RecordID  string `json:"record_id"`
+	To        string `json:"to"`
+	Subject   string `json:"subject"`
+	HTMLBody  string `json:"html_body"`
+	TextBody  string `json:"text_body"`
+	OTP       string `json:"otp"`
+	MagicLink string `json:"magic_link"`
+	ExpiresIn string `json:"expires_in"`
+	ResendIn  string `json:"resend_in,omitempty"`
+}
+
+// OutboxMessage is a job waiting in email_outbox to be queued.
+type OutboxMessage struct {
+	ID        int64
+	QueueName string
+	Payload   json.RawMessage
+	Attempts  int
+}
+
+func insertEmailOutboxTx(ctx context.Context, tx pgx.Tx, queueName, emailRecordID string, job EmailSendJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+insert into email_outbox(queue_name, email_record_id, payload)
+values ($1, $2, $3::jsonb)`, queueName, emailRecordID, string(payload))
+	return err
+}
+
+// RelayEmailOutbox hands up to limit due outbox messages, oldest first, to
+// publish and deletes those it accepted. Rows are locked with SKIP LOCKED, so
+// concurrent relays take disjoint batches.
+//
+// The batch stops at the first publish error: that message is retried after
+// 2^attempts seconds (at most a minute) and the error is returned with the
+// number published so far. If the commit fails after publishing, the
+// messages are published again later, so delivery is at least once.
+func (s *Store) RelayEmailOutbox(ctx context.Context, limit int, publish func(context.Context, OutboxMessage) error) (int, error) {
+	return s.relayEmailOutbox(ctx, publish, `
+select id, queue_name, payload, attempts
+from email_outbox
+where available_at <= now()
+order by id
+limit $1
+for update skip locked`, limit)
+}
+
+// RelayEmailOutboxRecords is RelayEmailOutbox for the due messages of the
+// given email records only. Messages locked by another relay are skipped.
+func (s *Store) RelayEmailOutboxRecords(ctx context.Context, emailRecordIDs []string, publish func(context.Context, OutboxMessage) error) (int, error) {
+	return s.relayEmailOutbox(ctx, publish, `
+select id, queue_name, payload, attempts
+from email_outbox
+where email_record_id = any($1)
+  and available_at <= now()
+order by id
+for update skip locked`, emailRecordIDs)
+}
+
+func (s *Store) relayEmailOutbox(ctx context.Context, publish func(context.Context, OutboxMessage) error, query string, args ...any) (int, error) {
+	tx, err := s.DB.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxMessage, error) {
+		var m OutboxMessage
+		err := row.Scan(&m.ID, &m.QueueName, &m.Payload, &m.Attempts)
+		return m, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	published := make([]int64, 0, len(messages))
+	var publishErr error
+	for _, m := range messages {
+		if publishErr = publish(ctx, m); publishErr != nil {
+			if _, err = tx.Exec(ctx, `
+update email_outbox
+set attempts = attempts + 1,
+    last_error = $2,
+    available_at = now() + least(interval '1 second' * power(2, attempts), interval '1 minute')
+where id = $1`, m.ID, publishErr.Error()); err != nil {
+				return 0, err
+			}
+			break
+		}
+		published = append(published, m.ID)
+	}
+	if len(published) > 0 {
+		if _, err = tx.Exec(ctx, `delete from email_outbox where id = any($1)`, published); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(published), publishErr
+}
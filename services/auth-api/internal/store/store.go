@@ -11,7 +11,9 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"anvilkit-auth-template/modules/common-go/pkg/authz"
 	"anvilkit-auth-template/modules/common-go/pkg/email"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
 	"anvilkit-auth-template/services/auth-api/internal/auth/crypto"
 )
 
@@ -29,7 +31,6 @@ var (
 	ErrInvalidMagicLink          = errors.New("invalid_magic_link")
 	ErrVerificationExpired       = errors.New("verification_expired")
 	ErrTooManyOTPAttempts        = errors.New("too_many_otp_attempts")
-	ErrPendingRegistrationGone   = errors.New("pending_registration_not_found")
 	ErrResendUserNotFound        = errors.New("resend_user_not_found")
 	ErrResendAlreadyVerified     = errors.New("resend_already_verified")
 )
@@ -54,6 +55,9 @@ type CreateVerificationParams struct {
 	OTP        string
 	MagicToken string
 	ExpiresAt  time.Time
+	// Email is the verification email job written to the outbox; RecordID
+	// and To are filled in.
+	Email EmailSendJob
 }
 
 type CreateVerificationResult struct {
@@ -65,19 +69,10 @@ type RegisterWithVerificationResult struct {
 	EmailRecordID string
 }
 
-type RevokedVerificationSnapshot struct {
-	ID        string
-	ExpiresAt time.Time
-}
-
 type ResendVerificationResult struct {
-	UserID               string
-	UserEmail            string
-	EmailRecordID        string
-	OTPVerificationID    string
-	MagicVerificationID  string
-	RevokedAt            time.Time
-	RevokedVerifications []RevokedVerificationSnapshot
+	UserID        string
+	UserEmail     string
+	EmailRecordID string
 }
 
 type AnalyticsUser struct {
@@ -91,6 +86,14 @@ type MagicLinkAnalytics struct {
 	SentAt *time.Time
 }
 
+// TenantAuthz is the authorization state of a tenant membership as embedded
+// in tenant-scoped access tokens.
+type TenantAuthz struct {
+	Roles       []string
+	Version     int64
+	Permissions []string
+}
+
 type LoginUser struct {
 	ID              string
 	Email           string
@@ -126,6 +129,7 @@ func (s *Store) RegisterWithVerification(
 	bcryptCost int,
 	otp, magicToken string,
 	expiresAt time.Time,
+	job EmailSendJob,
 ) (*RegisterWithVerificationResult, error) {
 	tx, err := s.DB.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
@@ -146,6 +150,7 @@ func (s *Store) RegisterWithVerification(
 		OTP:        otp,
 		MagicToken: magicToken,
 		ExpiresAt:  expiresAt,
+		Email:      job,
 	})
 	if err != nil {
 		return nil, err
@@ -186,6 +191,7 @@ func (s *Store) ResendVerification(
 	ctx context.Context,
 	emailAddr, otp, magicToken string,
 	expiresAt, now time.Time,
+	job EmailSendJob,
 ) (*ResendVerificationResult, error) {
 	tx, err := s.DB.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
@@ -219,33 +225,6 @@ for update`,
 		return nil, ErrResendAlreadyVerified
 	}
 
-	rows, err := tx.Query(ctx, `
-select id, expires_at
-from email_verifications
-where user_id = $1
-  and verified_at is null
-  and expires_at > $2
-for update`,
-		userID,
-		now,
-	)
-	if err != nil {
-		return nil, err
-	}
-	revoked := make([]RevokedVerificationSnapshot, 0, 4)
-	for rows.Next() {
-		var snap RevokedVerificationSnapshot
-		if err = rows.Scan(&snap.ID, &snap.ExpiresAt); err != nil {
-			rows.Close()
-			return nil, err
-		}
-		revoked = append(revoked, snap)
-	}
-	rows.Close()
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
 	if _, err = tx.Exec(ctx, `
 update email_verifications
 set expires_at = $2
@@ -258,11 +237,12 @@ where user_id = $1
 		return nil, err
 	}
 
-	created, err := createVerificationWithIDsTx(ctx, tx, CreateVerificationParams{
+	emailRecordID, err := createVerificationTx(ctx, tx, CreateVerificationParams{
 		UserID:     userID,
 		OTP:        otp,
 		MagicToken: magicToken,
 		ExpiresAt:  expiresAt,
+		Email:      job,
 	})
 	if err != nil {
 		return nil, err
@@ -272,76 +252,12 @@ where user_id = $1
 		return nil, err
 	}
 	return &ResendVerificationResult{
-		UserID:               userID,
-		UserEmail:            userEmail,
-		EmailRecordID:        created.EmailRecordID,
-		OTPVerificationID:    created.OTPVerificationID,
-		MagicVerificationID:  created.MagicVerificationID,
-		RevokedAt:            now,
-		RevokedVerifications: revoked,
+		UserID:        userID,
+		UserEmail:     userEmail,
+		EmailRecordID: emailRecordID,
 	}, nil
 }
 
-func (s *Store) RollbackResendVerification(ctx context.Context, resend *ResendVerificationResult) error {
-	if resend == nil {
-		return nil
-	}
-	tx, err := s.DB.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if rbErr := tx.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
-			_ = rbErr
-		}
-	}()
-
-	verificationIDs := []string{resend.OTPVerificationID, resend.MagicVerificationID}
-	if _, err = tx.Exec(ctx, `
-delete from email_verifications
-where user_id = $1
-  and verified_at is null
-  and id = any($2)`,
-		resend.UserID,
-		verificationIDs,
-	); err != nil {
-		return err
-	}
-
-	if _, err = tx.Exec(ctx, `
-delete from email_records
-where id = $1
-  and user_id = $2`,
-		resend.EmailRecordID,
-		resend.UserID,
-	); err != nil {
-		return err
-	}
-
-	rollbackAt := resend.RevokedAt
-	if rollbackAt.IsZero() {
-		rollbackAt = time.Now()
-	}
-	for _, snap := range resend.RevokedVerifications {
-		if _, err = tx.Exec(ctx, `
-update email_verifications
-set expires_at = $2
-where id = $1
-  and user_id = $3
-  and verified_at is null
-  and expires_at <= $4`,
-			snap.ID,
-			snap.ExpiresAt,
-			resend.UserID,
-			rollbackAt,
-		); err != nil {
-			return err
-		}
-	}
-
-	return tx.Commit(ctx)
-}
-
 func (s *Store) VerifyEmailOTP(ctx context.Context, emailAddr, otp string, now time.Time) (bool, error) {
 	tx, err := s.DB.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
@@ -539,30 +455,6 @@ where token_type = 'magic_link'
 	return nil
 }
 
-func (s *Store) CleanupPendingRegistration(ctx context.Context, userID string) error {
-	tx, err := s.DB.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if rbErr := tx.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
-			_ = rbErr
-		}
-	}()
-
-	if _, err = tx.Exec(ctx, `delete from email_records where user_id=$1`, userID); err != nil {
-		return err
-	}
-	ct, err := tx.Exec(ctx, `delete from users where id=$1 and status=0 and email_verified_at is null`, userID)
-	if err != nil {
-		return err
-	}
-	if ct.RowsAffected() == 0 {
-		return ErrPendingRegistrationGone
-	}
-	return tx.Commit(ctx)
-}
-
 func (s *Store) Bootstrap(ctx context.Context, email, password, tenantName string, bcryptCost int) (*BootstrapResult, error) {
 	tx, err := s.DB.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
@@ -578,12 +470,13 @@ func (s *Store) Bootstrap(ctx context.Context, email, password, tenantName strin
 	var (
 		pwdHash         *string
 		emailVerifiedAt *time.Time
+		status          int16
 	)
 	err = tx.QueryRow(ctx, `
-select u.id, upc.password_hash, u.email_verified_at
+select u.id, upc.password_hash, u.email_verified_at, u.status
 from users u
 left join user_password_credentials upc on upc.user_id = u.id
-where u.email=$1`, email).Scan(&uid, &pwdHash, &emailVerifiedAt)
+where u.email=$1`, email).Scan(&uid, &pwdHash, &emailVerifiedAt, &status)
 	if err != nil {
 		if !errors.Is(err, pgx.ErrNoRows) {
 			return nil, err
@@ -600,7 +493,9 @@ where u.email=$1`, email).Scan(&uid, &pwdHash, &emailVerifiedAt)
 			return nil, err
 		}
 	} else {
-		if pwdHash == nil || crypto.VerifyPassword(*pwdHash, password) != nil {
+		// A suspended user is refused like a failed login; bootstrapping
+		// must not reactivate them.
+		if pwdHash == nil || status == 2 || crypto.VerifyPassword(*pwdHash, password) != nil {
 			return nil, ErrBootstrapPasswordMismatch
 		}
 		if emailVerifiedAt == nil {
@@ -623,10 +518,7 @@ where u.email=$1`, email).Scan(&uid, &pwdHash, &emailVerifiedAt)
 	if _, err = tx.Exec(ctx, `insert into tenants(id,name,created_at) values($1,$2,now())`, tid, tenantName); err != nil {
 		return nil, err
 	}
-	if _, err = tx.Exec(ctx, `insert into tenant_users(tenant_id,user_id,role,created_at) values($1,$2,'owner',now())`, tid, uid); err != nil {
-		return nil, err
-	}
-	if _, err = tx.Exec(ctx, `insert into user_roles(tenant_id,user_id,role,created_at) values($1,$2,'tenant_admin',now())`, tid, uid); err != nil {
+	if _, err = tx.Exec(ctx, `insert into tenant_users(tenant_id,user_id,roles,created_at) values($1,$2,'{owner}',now())`, tid, uid); err != nil {
 		return nil, err
 	}
 	if err = tx.Commit(ctx); err != nil {
@@ -720,10 +612,16 @@ where token_hash=$1 and revoked_at is null`, oldHash, newID); err != nil {
 	return uid, "", nil
 }
 
-func (s *Store) RevokeRefreshToken(ctx context.Context, token string) error {
+// RevokeRefreshToken revokes the session of a refresh token. It returns the
+// session's user, or "" if the token was unknown or already revoked.
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) (string, error) {
 	h := sha256.Sum256([]byte(token))
-	_, err := s.DB.Exec(ctx, `update refresh_sessions set revoked_at=now() where token_hash=$1 and revoked_at is null`, hex.EncodeToString(h[:]))
-	return err
+	var userID string
+	err := s.DB.QueryRow(ctx, `update refresh_sessions set revoked_at=now() where token_hash=$1 and revoked_at is null returning user_id`, hex.EncodeToString(h[:])).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return userID, err
 }
 
 func (s *Store) RevokeAllRefreshTokensByUser(ctx context.Context, userID string) (int64, error) {
@@ -745,6 +643,52 @@ func (s *Store) EnsureUserInTenant(ctx context.Context, userID, tenantID string)
 	return nil
 }
 
+// IsPlatformAdmin reports whether userID holds the platform admin role.
+func (s *Store) IsPlatformAdmin(ctx context.Context, userID string) (bool, error) {
+	return authz.IsPlatformAdmin(ctx, s.DB, userID)
+}
+
+// TenantAuthz loads the roles, authorization version and permission names of
+// userID's membership in tenantID. Roles are resolved as admin-api's AdminRBAC
+// resolves them: the membership's own roles, the roles granted through the
+// member's groups and their roles in the tenant's organization. Owners and
+// admins hold every permission in the catalog; other grants are resolved
+// from admin-api's policy by authz.ResolveTenantGrants.
+func (s *Store) TenantAuthz(ctx context.Context, userID, tenantID string) (*TenantAuthz, error) {
+	var (
+		out         TenantAuthz
+		memberRoles []string
+	)
+	// Suspended users keep their memberships but cannot act in them.
+	err := s.DB.QueryRow(ctx, `
+select tu.roles, tu.authz_version
+from tenant_users tu
+join users u on u.id = tu.user_id
+where tu.tenant_id=$1 and tu.user_id=$2 and u.status <> 2`, tenantID, userID).Scan(&memberRoles, &out.Version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotInTenant
+		}
+		return nil, err
+	}
+
+	var orgRoles []string
+	err = s.DB.QueryRow(ctx, `
+select om.roles
+from tenants t
+join organization_members om on om.org_id = t.org_id
+where t.id=$1 and om.user_id=$2`, tenantID, userID).Scan(&orgRoles)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	out.Roles, out.Permissions, err = authz.ResolveTenantGrants(ctx, s.DB, tenantID, userID, memberRoles, orgRoles)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 func insertRegisteredUserWithPassword(ctx context.Context, tx pgx.Tx, userID, emailAddr, password string, bcryptCost int) error {
 	hashedPassword, err := crypto.HashPassword(password, bcryptCost)
 	if err != nil {
@@ -759,49 +703,33 @@ func insertRegisteredUserWithPassword(ctx context.Context, tx pgx.Tx, userID, em
 	return nil
 }
 
-type createVerificationTxResult struct {
-	EmailRecordID       string
-	OTPVerificationID   string
-	MagicVerificationID string
-}
-
 func createVerificationTx(ctx context.Context, tx pgx.Tx, params CreateVerificationParams) (string, error) {
-	res, err := createVerificationWithIDsTx(ctx, tx, params)
-	if err != nil {
-		return "", err
-	}
-	return res.EmailRecordID, nil
-}
-
-func createVerificationWithIDsTx(ctx context.Context, tx pgx.Tx, params CreateVerificationParams) (*createVerificationTxResult, error) {
 	var recipientEmail string
 	if err := tx.QueryRow(ctx, `select email from users where id=$1`, params.UserID).Scan(&recipientEmail); err != nil {
-		return nil, err
+		return "", err
 	}
 
 	otpHash := email.HashToken(params.OTP)
 	magicLinkHash := email.HashToken(params.MagicToken)
-	otpVerificationID := uuid.NewString()
 	if _, err := tx.Exec(
 		ctx,
 		`insert into email_verifications(id,user_id,token_hash,token_type,expires_at,created_at) values($1,$2,$3,'otp',$4,now())`,
-		otpVerificationID,
+		uuid.NewString(),
 		params.UserID,
 		otpHash,
 		params.ExpiresAt,
 	); err != nil {
-		return nil, err
+		return "", err
 	}
-	magicVerificationID := uuid.NewString()
 	if _, err := tx.Exec(
 		ctx,
 		`insert into email_verifications(id,user_id,token_hash,token_type,expires_at,created_at) values($1,$2,$3,'magic_link',$4,now())`,
-		magicVerificationID,
+		uuid.NewString(),
 		params.UserID,
 		magicLinkHash,
 		params.ExpiresAt,
 	); err != nil {
-		return nil, err
+		return "", err
 	}
 
 	emailRecordID := uuid.NewString()
@@ -812,11 +740,18 @@ func createVerificationWithIDsTx(ctx context.Context, tx pgx.Tx, params CreateVe
 		params.UserID,
 		recipientEmail,
 	); err != nil {
-		return nil, err
+		return "", err
 	}
-	return &createVerificationTxResult{
-		EmailRecordID:       emailRecordID,
-		OTPVerificationID:   otpVerificationID,
-		MagicVerificationID: magicVerificationID,
-	}, nil
+
+	job := params.Email
+	job.RecordID = emailRecordID
+	job.To = recipientEmail
+	queueName, err := EmailQueueFor(queue.PriorityTransactional)
+	if err != nil {
+		return "", err
+	}
+	if err := insertEmailOutboxTx(ctx, tx, queueName, emailRecordID, job); err != nil {
+		return "", err
+	}
+	return emailRecordID, nil
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -208,18 +210,17 @@ values($1,$2,$3,'otp',$4,now())`,
 	}
 }
 
-func TestStoreRollbackResendVerificationRestoresPreviousVerificationRows(t *testing.T) {
+func TestStoreResendVerificationRevokesPreviousAndWritesOutbox(t *testing.T) {
 	db := testutil.MustTestDB(t)
 	testutil.TruncateAuthTables(t, db)
 
 	s := &Store{DB: db}
-	userID := "store-resend-rollback-user"
-	emailAddr := "store-resend-rollback@example.com"
+	userID := "store-resend-user"
+	emailAddr := "store-resend@example.com"
 	seedStoreUser(t, db, userID, emailAddr)
 
 	oldExpiresAt := time.Now().Add(10 * time.Minute).Round(time.Second)
 	oldOTPID := "store-resend-old-otp"
-	oldMagicID := "store-resend-old-magic"
 	if _, err := db.Exec(context.Background(), `
 insert into email_verifications(id,user_id,token_hash,token_type,expires_at,created_at)
 values($1,$2,$3,'otp',$4,now()-interval '3 minutes')`,
@@ -230,71 +231,29 @@ values($1,$2,$3,'otp',$4,now()-interval '3 minutes')`,
 	); err != nil {
 		t.Fatalf("insert old otp verification: %v", err)
 	}
-	if _, err := db.Exec(context.Background(), `
-insert into email_verifications(id,user_id,token_hash,token_type,expires_at,created_at)
-values($1,$2,$3,'magic_link',$4,now()-interval '3 minutes')`,
-		oldMagicID,
-		userID,
-		commonemail.HashToken("old-magic-token"),
-		oldExpiresAt,
-	); err != nil {
-		t.Fatalf("insert old magic verification: %v", err)
-	}
 
 	now := time.Now().Round(time.Second)
 	ctx, cancel := testCtx(t)
 	defer cancel()
-	resend, err := s.ResendVerification(ctx, emailAddr, "222222", "new-magic-token", now.Add(15*time.Minute), now)
+	resend, err := s.ResendVerification(ctx, emailAddr, "222222", "new-magic-token", now.Add(15*time.Minute), now, EmailSendJob{Subject: "Verify your email", OTP: "222222"})
 	if err != nil {
 		t.Fatalf("ResendVerification: %v", err)
 	}
-	if resend == nil || resend.EmailRecordID == "" || resend.OTPVerificationID == "" || resend.MagicVerificationID == "" {
+	if resend == nil || resend.EmailRecordID == "" || resend.UserID != userID {
 		t.Fatalf("unexpected resend result: %+v", resend)
 	}
-	if len(resend.RevokedVerifications) != 2 {
-		t.Fatalf("revoked verification count=%d want=2", len(resend.RevokedVerifications))
-	}
 
-	ctxRollback, cancelRollback := testCtx(t)
-	defer cancelRollback()
-	if err := s.RollbackResendVerification(ctxRollback, resend); err != nil {
-		t.Fatalf("RollbackResendVerification: %v", err)
+	var oldExpiry time.Time
+	if err := db.QueryRow(context.Background(), `select expires_at from email_verifications where id=$1`, oldOTPID).Scan(&oldExpiry); err != nil {
+		t.Fatalf("query old otp expiry: %v", err)
 	}
-
-	var deletedCount int
-	if err := db.QueryRow(context.Background(), `
-select count(1)
-from email_verifications
-where user_id=$1 and id = any($2)`,
-		userID,
-		[]string{resend.OTPVerificationID, resend.MagicVerificationID},
-	).Scan(&deletedCount); err != nil {
-		t.Fatalf("query new verification rows: %v", err)
-	}
-	if deletedCount != 0 {
-		t.Fatalf("new verification rows remaining=%d want=0", deletedCount)
-	}
-
-	var restoredOTPExpiry, restoredMagicExpiry time.Time
-	if err := db.QueryRow(context.Background(), `select expires_at from email_verifications where id=$1`, oldOTPID).Scan(&restoredOTPExpiry); err != nil {
-		t.Fatalf("query restored old otp expiry: %v", err)
-	}
-	if err := db.QueryRow(context.Background(), `select expires_at from email_verifications where id=$1`, oldMagicID).Scan(&restoredMagicExpiry); err != nil {
-		t.Fatalf("query restored old magic expiry: %v", err)
-	}
-	if !restoredOTPExpiry.Round(time.Second).Equal(oldExpiresAt) {
-		t.Fatalf("old otp expires_at=%s want=%s", restoredOTPExpiry, oldExpiresAt)
-	}
-	if !restoredMagicExpiry.Round(time.Second).Equal(oldExpiresAt) {
-		t.Fatalf("old magic expires_at=%s want=%s", restoredMagicExpiry, oldExpiresAt)
+	if oldExpiry.After(now) {
+		t.Fatalf("old otp expires_at=%s want <= %s", oldExpiry, now)
 	}
 
-	var emailRecordCount int
-	if err := db.QueryRow(context.Background(), `select count(1) from email_records where id=$1`, resend.EmailRecordID).Scan(&emailRecordCount); err != nil {
-		t.Fatalf("query resend email record: %v", err)
-	}
-	if emailRecordCount != 0 {
-		t.Fatalf("resend email record count=%d want=0", emailRecordCount)
+	job := mustOutboxJob(t, db, resend.EmailRecordID)
+	if job.RecordID != resend.EmailRecordID || job.To != emailAddr || job.OTP != "222222" {
+		t.Fatalf("unexpected outbox job: %+v", job)
 	}
 }
 
@@ -650,7 +609,7 @@ values
 	}
 }
 
-func TestStoreRegisterWithVerificationAndCleanupPendingRegistration(t *testing.T) {
+func TestStoreRegisterWithVerificationWritesOutbox(t *testing.T) {
 	db := testutil.MustTestDB(t)
 	testutil.TruncateAuthTables(t, db)
 
@@ -665,6 +624,7 @@ func TestStoreRegisterWithVerificationAndCleanupPendingRegistration(t *testing.T
 		"123456",
 		"magic-atomic-token",
 		time.Now().Add(15*time.Minute),
+		EmailSendJob{Subject: "Verify your email", OTP: "123456", MagicLink: "https://auth.example.com/link"},
 	)
 	if err != nil {
 		t.Fatalf("RegisterWithVerification: %v", err)
@@ -695,30 +655,83 @@ func TestStoreRegisterWithVerificationAndCleanupPendingRegistration(t *testing.T
 		t.Fatalf("email_records count=%d want=1", recordsCount)
 	}
 
-	ctxCleanup, cancelCleanup := testCtx(t)
-	defer cancelCleanup()
-	if err := s.CleanupPendingRegistration(ctxCleanup, res.User.ID); err != nil {
-		t.Fatalf("CleanupPendingRegistration: %v", err)
+	job := mustOutboxJob(t, db, res.EmailRecordID)
+	if job.RecordID != res.EmailRecordID || job.To != "atomic-register@example.com" || job.MagicLink != "https://auth.example.com/link" {
+		t.Fatalf("unexpected outbox job: %+v", job)
 	}
+}
 
-	if err := db.QueryRow(context.Background(), `select count(1) from users where id=$1`, res.User.ID).Scan(&usersCount); err != nil {
-		t.Fatalf("query users after cleanup: %v", err)
+func TestStoreRelayEmailOutbox(t *testing.T) {
+	db := testutil.MustTestDB(t)
+	testutil.TruncateAuthTables(t, db)
+
+	s := &Store{DB: db}
+	userID := "store-outbox-user"
+	seedStoreUser(t, db, userID, "store-outbox@example.com")
+	for i := 0; i < 3; i++ {
+		if _, err := s.CreateVerification(context.Background(), CreateVerificationParams{
+			UserID:     userID,
+			OTP:        fmt.Sprintf("00000%d", i),
+			MagicToken: fmt.Sprintf("outbox-magic-%d", i),
+			ExpiresAt:  time.Now().Add(15 * time.Minute),
+			Email:      EmailSendJob{OTP: fmt.Sprintf("00000%d", i)},
+		}); err != nil {
+			t.Fatalf("CreateVerification: %v", err)
+		}
+	}
+
+	// The batch stops at the first failure and keeps that message for later.
+	var published []OutboxMessage
+	n, err := s.RelayEmailOutbox(context.Background(), 10, func(_ context.Context, m OutboxMessage) error {
+		if len(published) == 1 {
+			return errors.New("redis down")
+		}
+		published = append(published, m)
+		return nil
+	})
+	if err == nil || n != 1 || len(published) != 1 {
+		t.Fatalf("first relay n=%d err=%v published=%d want 1 and an error", n, err, len(published))
 	}
-	if usersCount != 0 {
-		t.Fatalf("users count after cleanup=%d want=0", usersCount)
+	if published[0].QueueName != EmailQueueName {
+		t.Fatalf("queue=%q want=%q", published[0].QueueName, EmailQueueName)
 	}
-	if err := db.QueryRow(context.Background(), `select count(1) from email_verifications where user_id=$1`, res.User.ID).Scan(&verificationsCount); err != nil {
-		t.Fatalf("query email_verifications after cleanup: %v", err)
+	var attempts int
+	var availableAt time.Time
+	if err := db.QueryRow(context.Background(), `select attempts, available_at from email_outbox order by id limit 1`).Scan(&attempts, &availableAt); err != nil {
+		t.Fatalf("query failed message: %v", err)
 	}
-	if verificationsCount != 0 {
-		t.Fatalf("email_verifications after cleanup=%d want=0", verificationsCount)
+	if attempts != 1 || !availableAt.After(time.Now()) {
+		t.Fatalf("failed message attempts=%d available_at=%s want 1 and a later retry", attempts, availableAt)
 	}
-	if err := db.QueryRow(context.Background(), `select count(1) from email_records where id=$1`, res.EmailRecordID).Scan(&recordsCount); err != nil {
-		t.Fatalf("query email_records after cleanup: %v", err)
+
+	// The failed message is not due yet; the remaining one is.
+	n, err = s.RelayEmailOutbox(context.Background(), 10, func(_ context.Context, m OutboxMessage) error {
+		published = append(published, m)
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("second relay n=%d err=%v want 1", n, err)
+	}
+	var remaining int
+	if err := db.QueryRow(context.Background(), `select count(1) from email_outbox`).Scan(&remaining); err != nil {
+		t.Fatalf("count email_outbox: %v", err)
+	}
+	if remaining != 1 {
+		t.Fatalf("email_outbox count=%d want=1", remaining)
+	}
+}
+
+func mustOutboxJob(t *testing.T, db *pgxpool.Pool, emailRecordID string) EmailSendJob {
+	t.Helper()
+	var payload []byte
+	if err := db.QueryRow(context.Background(), `select payload from email_outbox where email_record_id=$1`, emailRecordID).Scan(&payload); err != nil {
+		t.Fatalf("query email_outbox: %v", err)
 	}
-	if recordsCount != 0 {
-		t.Fatalf("email_records after cleanup=%d want=0", recordsCount)
+	var job EmailSendJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		t.Fatalf("decode outbox payload: %v", err)
 	}
+	return job
 }
 
 func TestStoreRotateRefreshTokenRevokesOldAndCreatesNew(t *testing.T) {
@@ -781,13 +794,17 @@ func TestStoreRevokeRefreshTokenMakesRotationFail(t *testing.T) {
 
 	ctxRevoke, cancelRevoke := testCtx(t)
 	defer cancelRevoke()
-	if err := s.RevokeRefreshToken(ctxRevoke, refreshToken); err != nil {
+	revokedUserID, err := s.RevokeRefreshToken(ctxRevoke, refreshToken)
+	if err != nil {
 		t.Fatalf("RevokeRefreshToken: %v", err)
 	}
+	if revokedUserID != uid {
+		t.Fatalf("RevokeRefreshToken user=%q want %q", revokedUserID, uid)
+	}
 
 	ctxRotate, cancelRotate := testCtx(t)
 	defer cancelRotate()
-	_, _, err := s.RotateRefreshToken(ctxRotate, refreshToken, "another-token", time.Now().Add(time.Hour))
+	_, _, err = s.RotateRefreshToken(ctxRotate, refreshToken, "another-token", time.Now().Add(time.Hour))
 	if !errors.Is(err, ErrRefreshSessionRevoked) {
 		t.Fatalf("RotateRefreshToken err=%v, want %v", err, ErrRefreshSessionRevoked)
 	}
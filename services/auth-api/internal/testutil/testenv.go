@@ -97,7 +97,7 @@ func MustJWTSecret(t *testing.T) string {
 
 func ApplyMigrations(t *testing.T, db *pgxpool.Pool) {
 	t.Helper()
-	for _, name := range []string{"001_init.sql", "002_authn_core.sql", "003_multitenant.sql", "004_email_service.sql", "005_email_verifications_token_hash_scope.sql", "006_email_blacklist.sql", "007_email_blacklist_normalization.sql"} {
+	for _, name := range []string{"001_init.sql", "002_authn_core.sql", "003_multitenant.sql", "004_email_service.sql", "005_email_verifications_token_hash_scope.sql", "006_email_blacklist.sql", "007_email_blacklist_normalization.sql", "008_tenant_custom_roles.sql", "009_tenant_users_authz_version.sql", "010_tenant_member_roles.sql", "011_organizations.sql", "012_tenant_groups.sql", "013_impersonation_sessions.sql", "014_user_suspension.sql", "015_audit_events.sql", "016_webhooks.sql", "017_email_outbox.sql", "018_email_provider.sql", "019_user_status_before_suspension.sql", "020_user_platform_role.sql"} {
 		sqlPath := filepath.Join(migrationsDir(t), name)
 		sqlBytes, err := os.ReadFile(sqlPath)
 		if err != nil {
@@ -107,17 +107,28 @@ func ApplyMigrations(t *testing.T, db *pgxpool.Pool) {
 			t.Fatalf("apply migration %s: %v", name, err)
 		}
 	}
+	// Tenant access tokens resolve custom roles and groups (see authz) from
+	// admin-api's casbin_rule table, which lives in the same database.
+	casbinPath := filepath.Join(migrationsDir(t), "..", "..", "admin-api", "migrations", "001_casbin_rule.sql")
+	sqlBytes, err := os.ReadFile(casbinPath)
+	if err != nil {
+		t.Fatalf("read migration %s: %v", casbinPath, err)
+	}
+	if _, err = db.Exec(context.Background(), string(sqlBytes)); err != nil {
+		t.Fatalf("apply migration %s: %v", casbinPath, err)
+	}
 }
 
 func TruncateAuthTables(t *testing.T, db *pgxpool.Pool) {
 	t.Helper()
 	_, err := db.Exec(context.Background(), `
 truncate table
+  audit_events,
+  email_outbox,
   email_status_history,
   email_records,
   email_jobs,
   email_verifications,
-  user_roles,
   tenant_users,
   refresh_tokens,
   refresh_sessions,
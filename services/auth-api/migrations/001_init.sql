@@ -18,13 +18,25 @@ create table if not exists tenant_users (
   primary key (tenant_id, user_id)
 );
 
-create table if not exists user_roles (
-  tenant_id text not null references tenants(id) on delete cascade,
-  user_id text not null references users(id) on delete cascade,
-  role text not null,
-  created_at timestamptz not null default now(),
-  primary key (tenant_id, user_id, role)
-);
+-- 010_tenant_member_roles.sql folds user_roles into tenant_users.roles and
+-- drops it; do not recreate it once that migration has run.
+do $$
+begin
+  if not exists (
+    select 1 from information_schema.columns
+    where table_schema = current_schema() and table_name = 'tenant_users' and column_name = 'roles'
+  ) then
+    create table if not exists user_roles (
+      tenant_id text not null references tenants(id) on delete cascade,
+      user_id text not null references users(id) on delete cascade,
+      role text not null,
+      created_at timestamptz not null default now(),
+      primary key (tenant_id, user_id, role)
+    );
+    create index if not exists idx_user_roles_tenant_user on user_roles(tenant_id, user_id);
+  end if;
+end
+$$;
 
 create table if not exists refresh_tokens (
   token_hash text primary key,
@@ -37,4 +49,3 @@ create table if not exists refresh_tokens (
 
 create index if not exists idx_refresh_tokens_user_tenant on refresh_tokens(user_id, tenant_id);
 create index if not exists idx_refresh_tokens_expires on refresh_tokens(expires_at);
-create index if not exists idx_user_roles_tenant_user on user_roles(tenant_id, user_id);
@@ -27,21 +27,33 @@ create table if not exists tenant_users (
   constraint chk_tenant_users_role check (role in ('owner', 'admin', 'member'))
 );
 
-alter table if exists tenant_users
-  add column if not exists role text not null default 'member';
-
-update tenant_users
-set role = 'member'
-where role is null;
-
-alter table tenant_users
-  alter column role set not null,
-  alter column role set default 'member';
-
-alter table if exists tenant_users
-  drop constraint if exists chk_tenant_users_role;
-
-alter table if exists tenant_users
-  add constraint chk_tenant_users_role check (role in ('owner', 'admin', 'member'));
+-- 010_tenant_member_roles.sql replaces tenant_users.role with the roles
+-- array; do not re-add the column once that migration has run. 008 replaces
+-- the role check with a role name format check; do not re-add it once that
+-- migration has run either.
+do $$
+begin
+  if not exists (
+    select 1 from information_schema.columns
+    where table_schema = current_schema() and table_name = 'tenant_users' and column_name = 'roles'
+  ) then
+    alter table tenant_users
+      add column if not exists role text not null default 'member';
+
+    update tenant_users
+    set role = 'member'
+    where role is null;
+
+    alter table tenant_users
+      alter column role set not null,
+      alter column role set default 'member';
+
+    if not exists (select 1 from pg_constraint where conname = 'chk_tenant_users_role_name') then
+      alter table tenant_users drop constraint if exists chk_tenant_users_role;
+      alter table tenant_users add constraint chk_tenant_users_role check (role in ('owner', 'admin', 'member'));
+    end if;
+  end if;
+end
+$$;
 
 create index if not exists idx_tenant_users_user_id on tenant_users(user_id);
@@ -0,0 +1,26 @@
+-- Tenant-defined custom roles
+-- Custom roles live as Casbin policies in the tenant domain (admin-api), and
+-- tenant_users.role may now reference them by name.
+
+-- 010_tenant_member_roles.sql drops tenant_users.role; there is nothing to
+-- do once that migration has run.
+do $$
+begin
+  if exists (
+    select 1 from information_schema.columns
+    where table_schema = current_schema() and table_name = 'tenant_users' and column_name = 'role'
+  ) then
+    alter table tenant_users
+      drop constraint if exists chk_tenant_users_role;
+
+    alter table tenant_users
+      drop constraint if exists chk_tenant_users_role_name;
+
+    alter table tenant_users
+      add constraint chk_tenant_users_role_name check (role ~ '^[a-z][a-z0-9_-]{1,47}$');
+
+    create index if not exists idx_tenant_users_tenant_role
+      on tenant_users(tenant_id, role);
+  end if;
+end
+$$;
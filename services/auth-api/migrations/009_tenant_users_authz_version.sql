@@ -0,0 +1,6 @@
+-- Authorization version for tenant memberships
+-- Tenant-scoped access tokens carry the version in their azv claim; bumping it
+-- on a role change invalidates the roles/scp claims of tokens already issued.
+
+alter table if exists tenant_users
+  add column if not exists authz_version bigint not null default 1;
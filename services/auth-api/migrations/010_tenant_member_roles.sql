@@ -0,0 +1,81 @@
+-- Unified tenant role model
+-- A membership holds one or more roles in tenant_users.roles: built-in names
+-- (owner, admin, member) and tenant custom role names. The single
+-- tenant_users.role column and the legacy user_roles table, which stored
+-- Casbin subjects such as tenant_admin, are folded into it and dropped.
+
+alter table if exists tenant_users
+  add column if not exists roles text[];
+
+-- Only memberships that have not been migrated yet are backfilled from
+-- tenant_users.role, which is gone once this migration has run.
+do $$
+begin
+  if exists (
+    select 1 from information_schema.columns
+    where table_schema = current_schema() and table_name = 'tenant_users' and column_name = 'role'
+  ) then
+    update tenant_users set roles = array[role] where roles is null;
+  end if;
+end
+$$;
+
+update tenant_users set roles = '{member}' where roles is null;
+
+-- Merge legacy user_roles into existing memberships. Rows without a
+-- membership never granted access (AdminRBAC requires one) and are dropped.
+-- Owners already imply admin, so the tenant_admin row written next to every
+-- registered owner is not carried over.
+do $$
+begin
+  if to_regclass('user_roles') is not null then
+    update tenant_users tu
+    set roles = (
+          select array_agg(distinct r order by r)
+          from (
+            select unnest(tu.roles) as r
+            union
+            select case ur.role
+                     when 'tenant_owner' then 'owner'
+                     when 'tenant_admin' then case when 'owner' = any(tu.roles) then null else 'admin' end
+                     else regexp_replace(ur.role, '^role:', '')
+                   end
+            from user_roles ur
+            where ur.tenant_id = tu.tenant_id and ur.user_id = tu.user_id
+          ) merged
+          where r ~ '^[a-z][a-z0-9_-]{1,47}$'
+        ),
+        authz_version = tu.authz_version + 1
+    where exists (
+      select 1 from user_roles ur
+      where ur.tenant_id = tu.tenant_id and ur.user_id = tu.user_id
+    );
+
+    drop table user_roles;
+  end if;
+end
+$$;
+
+alter table tenant_users
+  alter column roles set default '{member}',
+  alter column roles set not null;
+
+do $$
+begin
+  if not exists (select 1 from pg_constraint where conname = 'chk_tenant_users_roles') then
+    alter table tenant_users
+      add constraint chk_tenant_users_roles check (
+        cardinality(roles) between 1 and 16
+        and array_to_string(roles, ',') ~ '^[a-z][a-z0-9_-]{1,47}(,[a-z][a-z0-9_-]{1,47})*$'
+      );
+  end if;
+end
+$$;
+
+drop index if exists idx_tenant_users_tenant_role;
+
+alter table tenant_users
+  drop column if exists role;
+
+create index if not exists idx_tenant_users_roles
+  on tenant_users using gin (roles);
@@ -0,0 +1,27 @@
+-- Organizations group tenants. Org members hold org roles (owner, admin)
+-- that admin-api extends to every child tenant through a Casbin domain link
+-- (g2, tenant:<id>, org:<id>).
+
+create table if not exists organizations (
+  id text primary key,
+  name text not null unique,
+  created_at timestamptz not null default now()
+);
+
+alter table if exists tenants
+  add column if not exists org_id text references organizations(id) on delete set null;
+
+create index if not exists idx_tenants_org_id on tenants(org_id);
+
+create table if not exists organization_members (
+  org_id text not null references organizations(id) on delete cascade,
+  user_id text not null references users(id) on delete cascade,
+  roles text[] not null,
+  created_at timestamptz not null default now(),
+  primary key (org_id, user_id),
+  constraint chk_organization_members_roles check (
+    cardinality(roles) between 1 and 2 and roles <@ array['owner', 'admin']::text[]
+  )
+);
+
+create index if not exists idx_organization_members_user_id on organization_members(user_id);
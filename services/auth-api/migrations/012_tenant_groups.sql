@@ -0,0 +1,34 @@
+-- Tenant groups
+-- Groups bundle tenant members so roles and permissions can be granted once
+-- per group. The grants themselves, including group nesting, are Casbin
+-- grouping rules kept by admin-api (g, group:<id>, <role>, tenant:<id>).
+-- display_name and external_id mirror the SCIM Group resource so an identity
+-- provider can sync groups by its own identifier.
+
+create table if not exists tenant_groups (
+  id text primary key,
+  tenant_id text not null references tenants(id) on delete cascade,
+  display_name text not null,
+  external_id text,
+  created_at timestamptz not null default now(),
+  updated_at timestamptz not null default now(),
+  constraint uq_tenant_groups_display_name unique (tenant_id, display_name),
+  constraint uq_tenant_groups_id_tenant unique (id, tenant_id)
+);
+
+create unique index if not exists uq_tenant_groups_external_id
+  on tenant_groups(tenant_id, external_id) where external_id is not null;
+
+-- Members must belong to the group's tenant; leaving the tenant removes them
+-- from its groups.
+create table if not exists tenant_group_members (
+  group_id text not null,
+  tenant_id text not null,
+  user_id text not null,
+  created_at timestamptz not null default now(),
+  primary key (group_id, user_id),
+  foreign key (group_id, tenant_id) references tenant_groups(id, tenant_id) on delete cascade,
+  foreign key (tenant_id, user_id) references tenant_users(tenant_id, user_id) on delete cascade
+);
+
+create index if not exists idx_tenant_group_members_user on tenant_group_members(tenant_id, user_id);
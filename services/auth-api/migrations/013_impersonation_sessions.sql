@@ -0,0 +1,24 @@
+-- Impersonation sessions
+-- Platform admins can act as a user through a short-lived access token whose
+-- act claim names the admin and whose jti is the session ID. Each row is the
+-- audit record of one impersonation: who started it, for whom, why and from
+-- where, and when and by whom it was stopped. Services reject tokens of a
+-- stopped session before they expire.
+
+create table if not exists impersonation_sessions (
+  id text primary key,
+  actor_user_id text not null references users(id) on delete cascade,
+  user_id text not null references users(id) on delete cascade,
+  tenant_id text references tenants(id) on delete set null,
+  reason text not null,
+  ip text,
+  user_agent text,
+  started_at timestamptz not null default now(),
+  expires_at timestamptz not null,
+  ended_at timestamptz,
+  ended_by text,
+  constraint chk_impersonation_sessions_not_self check (actor_user_id <> user_id)
+);
+
+create index if not exists idx_impersonation_sessions_actor on impersonation_sessions(actor_user_id, started_at desc);
+create index if not exists idx_impersonation_sessions_user on impersonation_sessions(user_id, started_at desc);
@@ -0,0 +1,10 @@
+-- User suspension
+-- Platform admins suspend users through admin-api by setting users.status to
+-- 2 (0 = pending email verification, 1 = active); login only admits active
+-- users. Suspending also revokes the user's refresh sessions.
+
+alter table if exists users
+  add column if not exists suspended_at timestamptz,
+  add column if not exists suspension_reason text;
+
+create index if not exists idx_users_status on users(status);
@@ -0,0 +1,40 @@
+-- Audit log
+-- auth-api and admin-api append security-relevant actions through the
+-- common-go audit package. Each row's hash covers its fields and the previous
+-- row's hash (prev_hash), so edits and deletions break the chain; seq is
+-- assigned under an advisory lock and has no gaps. Rows have no foreign keys
+-- so that the record outlives users and tenants.
+create table if not exists audit_events (
+  seq bigint primary key,
+  id text not null unique,
+  occurred_at timestamptz not null,
+  tenant_id text,
+  actor_user_id text,
+  impersonator_user_id text,
+  action text not null,
+  target_type text,
+  target_id text,
+  ip text,
+  user_agent text,
+  request_id text,
+  metadata jsonb not null default '{}'::jsonb,
+  prev_hash text not null,
+  hash text not null
+);
+
+create index if not exists idx_audit_events_tenant_seq on audit_events(tenant_id, seq desc);
+create index if not exists idx_audit_events_actor_seq on audit_events(actor_user_id, seq desc);
+create index if not exists idx_audit_events_target_seq on audit_events(target_id, seq desc);
+create index if not exists idx_audit_events_occurred_at on audit_events(occurred_at);
+
+-- Append-only: reject updates and deletes.
+create or replace function audit_events_append_only() returns trigger as $$
+begin
+  raise exception 'audit_events is append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists trg_audit_events_append_only on audit_events;
+create trigger trg_audit_events_append_only
+  before update or delete on audit_events
+  for each row execute function audit_events_append_only();
@@ -0,0 +1,54 @@
+-- Tenant webhooks
+-- Tenants register endpoints subscribed to lifecycle event types. Publishing
+-- an event inserts one webhook_deliveries row per subscribed endpoint and
+-- queues it on Redis; email-worker POSTs the payload signed with the
+-- endpoint's secret and records every attempt in webhook_delivery_attempts.
+-- Manual redelivery copies a delivery into a new row (redelivery_of).
+create table if not exists webhook_endpoints (
+  id text primary key,
+  tenant_id text not null references tenants(id) on delete cascade,
+  url text not null,
+  secret text not null,
+  events text[] not null,
+  description text not null default '',
+  enabled boolean not null default true,
+  created_at timestamptz not null default now(),
+  updated_at timestamptz not null default now()
+);
+
+create index if not exists idx_webhook_endpoints_tenant on webhook_endpoints(tenant_id);
+
+-- status: pending (queued or waiting for a retry), succeeded, failed (gave up).
+create table if not exists webhook_deliveries (
+  id text primary key,
+  endpoint_id text not null references webhook_endpoints(id) on delete cascade,
+  tenant_id text not null,
+  event_id text not null,
+  event_type text not null,
+  payload jsonb not null,
+  status text not null default 'pending',
+  attempts int not null default 0,
+  next_attempt_at timestamptz,
+  last_status_code int,
+  last_error text,
+  redelivery_of text references webhook_deliveries(id) on delete set null,
+  created_at timestamptz not null default now(),
+  updated_at timestamptz not null default now(),
+  delivered_at timestamptz,
+  constraint webhook_deliveries_status_check check (status in ('pending', 'succeeded', 'failed'))
+);
+
+create index if not exists idx_webhook_deliveries_endpoint_created on webhook_deliveries(endpoint_id, created_at desc);
+create index if not exists idx_webhook_deliveries_pending on webhook_deliveries(next_attempt_at) where status = 'pending';
+
+create table if not exists webhook_delivery_attempts (
+  id bigserial primary key,
+  delivery_id text not null references webhook_deliveries(id) on delete cascade,
+  attempt int not null,
+  status_code int,
+  error text,
+  duration_ms int not null,
+  created_at timestamptz not null default now()
+);
+
+create index if not exists idx_webhook_delivery_attempts_delivery on webhook_delivery_attempts(delivery_id, attempt);
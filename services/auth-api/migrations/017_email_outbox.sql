@@ -0,0 +1,19 @@
+-- Email outbox
+-- Email jobs are written here in the transaction that creates their
+-- email_records row, and the auth-api outbox relay publishes them to the
+-- Redis queue and deletes them. A row is therefore queued at least once even
+-- if Redis is down when the request commits. Payloads carry the plaintext OTP
+-- and magic link, so published rows are not kept.
+
+create table if not exists email_outbox (
+  id bigserial primary key,
+  queue_name text not null,
+  email_record_id text references email_records(id) on delete cascade,
+  payload jsonb not null,
+  attempts integer not null default 0,
+  last_error text,
+  available_at timestamptz not null default now(),
+  created_at timestamptz not null default now()
+);
+
+create index if not exists idx_email_outbox_available on email_outbox(available_at, id);
@@ -0,0 +1,7 @@
+-- Email provider
+-- email-worker may route emails over several providers; provider records
+-- which one accepted each email, so its external_id can be looked up there.
+-- It is null for emails not sent yet and for those sent before routing.
+
+alter table if exists email_records
+  add column if not exists provider text;
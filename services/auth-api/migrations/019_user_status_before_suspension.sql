@@ -0,0 +1,12 @@
+-- Status before suspension
+-- Suspending a user keeps the status they had (0 = pending email
+-- verification, 1 = active) so reactivating restores it instead of making a
+-- pending user active. Users suspended before this migration get the status
+-- their email verification implies.
+
+alter table if exists users
+  add column if not exists status_before_suspension smallint;
+
+update users
+set status_before_suspension = case when email_verified_at is null then 0 else 1 end
+where status = 2 and status_before_suspension is null;
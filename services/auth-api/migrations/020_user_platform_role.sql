@@ -0,0 +1,21 @@
+-- Platform roles
+-- users.platform_role = 'admin' lets a user use the admin-api platform
+-- endpoints and impersonate users. Platform admins grant and revoke it through
+-- admin-api, which records each change in the audit log;
+-- PLATFORM_ADMIN_USER_IDS only seeds it.
+
+alter table if exists users
+  add column if not exists platform_role text;
+
+do $$
+begin
+  if not exists (select 1 from pg_constraint where conname = 'chk_users_platform_role') then
+    alter table users
+      add constraint chk_users_platform_role check (platform_role in ('admin'));
+  end if;
+end
+$$;
+
+create index if not exists idx_users_platform_role
+  on users(platform_role)
+  where platform_role is not null;
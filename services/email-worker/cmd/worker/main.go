@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,8 +19,10 @@ import (
 	"anvilkit-auth-template/services/email-worker/internal/config"
 	"anvilkit-auth-template/services/email-worker/internal/consumer"
 	"anvilkit-auth-template/services/email-worker/internal/monitoring"
+	"anvilkit-auth-template/services/email-worker/internal/outbound"
 	"anvilkit-auth-template/services/email-worker/internal/sender"
 	"anvilkit-auth-template/services/email-worker/internal/store"
+	"anvilkit-auth-template/services/email-worker/internal/throttle"
 	"anvilkit-auth-template/services/email-worker/internal/webhook"
 
 	"golang.org/x/sync/errgroup"
@@ -59,7 +64,19 @@ func main() {
 		}
 	}()
 
-	q, err := queue.New(rdb)
+	q, err := queue.Open(rdb, cfg.QueueBackend, cfg.QueueStreamOptions())
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Soft-bounce and webhook retries wait in Redis sorted sets until the
+	// promoter moves them back to their queue.
+	delayed, err := queue.NewDelayed(rdb, cfg.QueueBackend)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Undecodable and exhausted jobs are kept in "<queue>:dead" streams for
+	// inspection and replay through admin-api.
+	deadLetters, err := queue.NewDeadLetter(rdb)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -68,15 +85,92 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Each job priority has its own queue derived from EMAIL_QUEUE_NAME.
+	emailQueueNames, err := cfg.EmailQueueNames()
+	if err != nil {
+		log.Fatal(err)
+	}
+	emailQueues := make([]consumer.PriorityQueue, 0, len(emailQueueNames))
+	for i, name := range emailQueueNames {
+		emailQueues = append(emailQueues, consumer.PriorityQueue{Name: name, Weight: cfg.QueueWeights[queue.Priorities[i]]})
+	}
+
+	// Emails are routed over the configured providers by weight, failing
+	// over while a provider is down.
+	routes := make([]sender.Route, 0, len(cfg.EmailProviders))
+	providerNames := make([]string, 0, len(cfg.EmailProviders))
+	for _, p := range cfg.EmailProviders {
+		provider, err := sender.NewProvider(cfg.ProviderConfig(p.Name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		routes = append(routes, sender.Route{Name: p.Name, Provider: provider, Weight: p.Weight})
+		providerNames = append(providerNames, fmt.Sprintf("%s=%d", p.Name, p.Weight))
+		metrics.SetProviderCircuitOpen(p.Name, false)
+	}
+	router, err := sender.NewRouter(routes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := router.Close(); err != nil {
+			log.Printf("email-worker: close email providers: %v", err)
+		}
+	}()
+	router.FailureThreshold = cfg.ProviderFailureThreshold
+	router.Cooldown = cfg.ProviderCooldown
+	router.OnResult = metrics.ObserveProviderResult
+	router.OnCircuit = func(provider string, open bool) {
+		metrics.SetProviderCircuitOpen(provider, open)
+		if open {
+			log.Printf("email provider %s unavailable; skipping it for %s", provider, cfg.ProviderCooldown)
+		} else {
+			log.Printf("email provider %s recovered", provider)
+		}
+	}
+
 	dataStore := &store.Store{DB: db}
 	worker := &consumer.Consumer{
 		Queue:     q,
 		QueueName: cfg.QueueName,
+		Queues:    emailQueues,
+		Weighted:  cfg.QueuePriorityMode == config.PriorityModeWeighted,
 		Timeout:   cfg.QueuePopTimeout,
-		Sender:    sender.New(cfg.SMTPConfig()),
+		Sender:    router,
 		Store:     dataStore,
 		Analytics: analyticsClient,
+		Scheduler: delayed,
 		Metrics:   metrics,
+
+		MaxDeliveries: cfg.QueueMaxDeliveries,
+		DeadLetters:   deadLetters,
+		Concurrency:   cfg.Concurrency,
+		DrainTimeout:  cfg.DrainTimeout,
+	}
+	if len(cfg.DomainLimits) > 0 {
+		limiter, err := throttle.New(rdb, cfg.DomainLimits)
+		if err != nil {
+			log.Fatal(err)
+		}
+		worker.Throttle = limiter
+	}
+
+	dispatcher := &outbound.Dispatcher{
+		Queue:       q,
+		QueueName:   cfg.TenantWebhookQueueName,
+		Timeout:     cfg.QueuePopTimeout,
+		Store:       dataStore,
+		Client:      outbound.NewHTTPClient(cfg.TenantWebhookTimeout, cfg.TenantWebhookAllowPrivate),
+		MaxAttempts: cfg.TenantWebhookMaxAttempts,
+		Scheduler:   delayed,
+		Metrics:     metrics,
+		DeadLetters: deadLetters,
+	}
+	promoter := &queue.Promoter{
+		Delayed:    delayed,
+		QueueNames: append(slices.Clone(emailQueueNames), cfg.TenantWebhookQueueName),
+		Interval:   cfg.QueuePromoteInterval,
+		OnPromoted: metrics.AddPromotedJobs,
 	}
 
 	webhookHandler, err := webhook.NewHandler(webhook.Server{
@@ -130,13 +224,41 @@ func main() {
 		return metricsServer.Shutdown(shutdownCtx)
 	})
 	g.Go(func() error {
-		log.Printf("email-worker consumer started: queue=%s redis=%s", cfg.QueueName, cfg.RedisAddr)
+		log.Printf("email-worker consumer started: providers=%s queues=%s priority=%s backend=%s redis=%s concurrency=%d", strings.Join(providerNames, ","), strings.Join(emailQueueNames, ","), cfg.QueuePriorityMode, cfg.QueueBackend, cfg.RedisAddr, cfg.Concurrency)
 		return worker.Run(gctx)
 	})
+	g.Go(func() error {
+		log.Printf("email-worker webhook dispatcher started: queue=%s", cfg.TenantWebhookQueueName)
+		return dispatcher.Run(gctx)
+	})
+	g.Go(func() error {
+		log.Printf("email-worker retry promoter started: interval=%s", cfg.QueuePromoteInterval)
+		return promoter.Run(gctx)
+	})
+	g.Go(func() error {
+		collector := &monitoring.ScheduledJobsCollector{
+			Delayed:      delayed,
+			QueueNames:   promoter.QueueNames,
+			PollInterval: cfg.QueuePollInterval,
+			Metrics:      metrics,
+			Logger:       log.Default(),
+		}
+		return collector.Run(gctx)
+	})
+	g.Go(func() error {
+		collector := &monitoring.DeadLetterCollector{
+			DeadLetters:  deadLetters,
+			QueueNames:   promoter.QueueNames,
+			PollInterval: cfg.QueuePollInterval,
+			Metrics:      metrics,
+			Logger:       log.Default(),
+		}
+		return collector.Run(gctx)
+	})
 	g.Go(func() error {
 		collector := &monitoring.QueueBacklogCollector{
 			Queue:        q,
-			QueueName:    cfg.QueueName,
+			QueueNames:   emailQueueNames,
 			PollInterval: cfg.QueuePollInterval,
 			Metrics:      metrics,
 			Logger:       log.Default(),
@@ -1,15 +1,20 @@
 package config
 
 import (
+	"crypto/x509"
 	"fmt"
 	"net/mail"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"anvilkit-auth-template/modules/common-go/pkg/analytics"
 	"anvilkit-auth-template/modules/common-go/pkg/email"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/services/email-worker/internal/sender"
+	"anvilkit-auth-template/services/email-worker/internal/throttle"
 )
 
 const (
@@ -24,8 +29,37 @@ const (
 	defaultSMTPPort        = 1025
 	defaultSMTPFromEmail   = "noreply@example.com"
 	defaultSMTPFromName    = "Anvilkit Auth"
+	defaultTenantHookQueue = "webhook:deliver"
+	defaultTenantHookTries = 8
+	defaultTenantHookSec   = 10
+	defaultStreamGroup     = "email-worker"
+	defaultVisibilitySec   = 300
+	defaultMaxDeliveries   = 5
+	defaultPromoteMS       = 1000
+	defaultConcurrency     = 4
+	defaultDrainSec        = 30
+	defaultQueueWeights    = "transactional=10,notification=3,bulk=1"
+	defaultProviderSec     = 10
+	defaultBreakerFailures = 5
+	defaultBreakerSec      = 30
+	defaultSMTPDialSec     = 10
+	defaultSMTPCommandSec  = 30
+	defaultSMTPIdleSec     = 30
+	defaultSMTPMaxMessages = 100
 )
 
+// Ways of choosing between the email priority queues.
+const (
+	PriorityModeStrict   = "strict"
+	PriorityModeWeighted = "weighted"
+)
+
+// ProviderWeight is an email provider and its share of emails.
+type ProviderWeight struct {
+	Name   string
+	Weight int
+}
+
 type Config struct {
 	DBDSN             string
 	RedisAddr         string
@@ -42,6 +76,63 @@ type Config struct {
 	SMTPFromEmail     string
 	SMTPFromName      string
 	Analytics         analytics.Config
+
+	// SMTP connection settings (see email.SMTPConfig). The TLS policy
+	// defaults to implicit TLS on port 465 and opportunistic STARTTLS on
+	// other ports. Up to SMTPMaxIdleConns connections are kept open, by
+	// default one per concurrent job.
+	SMTPTLSPolicy          string
+	SMTPRootCAs            *x509.CertPool
+	SMTPAuthMechanism      string
+	SMTPDialTimeout        time.Duration
+	SMTPCommandTimeout     time.Duration
+	SMTPMaxIdleConns       int
+	SMTPIdleTimeout        time.Duration
+	SMTPMaxMessagesPerConn int
+
+	// Email provider: "smtp" or an HTTP API (see sender.NewProvider). The
+	// SMTP_FROM_* sender is used by every provider. EmailProviders routes
+	// emails over several providers by weight (see sender.Router); it
+	// holds just EmailProvider unless EMAIL_PROVIDERS is set.
+	EmailProvider   string
+	EmailProviders  []ProviderWeight
+	ProviderTimeout time.Duration
+	// Consecutive failures after which a provider is skipped for
+	// ProviderCooldown.
+	ProviderFailureThreshold int
+	ProviderCooldown         time.Duration
+	SES                      sender.SESConfig
+	SendGrid                 sender.SendGridConfig
+	Mailgun                  sender.MailgunConfig
+	Postmark                 sender.PostmarkConfig
+
+	// Email jobs handled at a time, and how long in-flight jobs may finish
+	// on shutdown.
+	Concurrency  int
+	DrainTimeout time.Duration
+	// How jobs are taken from the queue of each priority: "strict" drains
+	// higher priorities first, "weighted" shares jobs by QueueWeights.
+	QueuePriorityMode string
+	QueueWeights      map[string]int
+	// Send budgets per recipient domain, shared by all replicas through
+	// Redis; empty disables throttling.
+	DomainLimits []throttle.Limit
+
+	// Queue backend shared by the email and webhook queues; producers must
+	// use the same QUEUE_BACKEND. The stream settings apply to "streams".
+	QueueBackend           string
+	QueueStreamGroup       string
+	QueueStreamConsumer    string
+	QueueVisibilityTimeout time.Duration
+	QueueMaxDeliveries     int
+	// How often due delayed jobs (retries) are moved to their work queue.
+	QueuePromoteInterval time.Duration
+
+	// Outbound tenant webhooks (see the outbound package).
+	TenantWebhookQueueName    string
+	TenantWebhookMaxAttempts  int
+	TenantWebhookTimeout      time.Duration
+	TenantWebhookAllowPrivate bool
 }
 
 func LoadFromEnv() (Config, error) {
@@ -54,12 +145,105 @@ func LoadFromEnv() (Config, error) {
 		return Config{}, err
 	}
 
+	concurrency, err := getPositiveIntFromEnv("EMAIL_WORKER_CONCURRENCY", defaultConcurrency)
+	if err != nil {
+		return Config{}, err
+	}
+	drainSec, err := getPositiveIntFromEnv("EMAIL_WORKER_DRAIN_TIMEOUT_SEC", defaultDrainSec)
+	if err != nil {
+		return Config{}, err
+	}
+
+	queueWeights, err := parseQueueWeights(getStringFromEnv("EMAIL_QUEUE_WEIGHTS", defaultQueueWeights))
+	if err != nil {
+		return Config{}, fmt.Errorf("EMAIL_QUEUE_WEIGHTS: %w", err)
+	}
+
+	providerSec, err := getPositiveIntFromEnv("EMAIL_PROVIDER_TIMEOUT_SEC", defaultProviderSec)
+	if err != nil {
+		return Config{}, err
+	}
+	emailProviders, err := parseProviderWeights(getStringFromEnv("EMAIL_PROVIDERS", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("EMAIL_PROVIDERS: %w", err)
+	}
+	breakerFailures, err := getPositiveIntFromEnv("EMAIL_PROVIDER_BREAKER_FAILURES", defaultBreakerFailures)
+	if err != nil {
+		return Config{}, err
+	}
+	breakerSec, err := getPositiveIntFromEnv("EMAIL_PROVIDER_BREAKER_COOLDOWN_SEC", defaultBreakerSec)
+	if err != nil {
+		return Config{}, err
+	}
+
+	smtpDialSec, err := getPositiveIntFromEnv("SMTP_DIAL_TIMEOUT_SEC", defaultSMTPDialSec)
+	if err != nil {
+		return Config{}, err
+	}
+	smtpCommandSec, err := getPositiveIntFromEnv("SMTP_COMMAND_TIMEOUT_SEC", defaultSMTPCommandSec)
+	if err != nil {
+		return Config{}, err
+	}
+	smtpMaxIdle, err := getPositiveIntFromEnv("SMTP_MAX_IDLE_CONNS", concurrency)
+	if err != nil {
+		return Config{}, err
+	}
+	smtpIdleSec, err := getPositiveIntFromEnv("SMTP_IDLE_TIMEOUT_SEC", defaultSMTPIdleSec)
+	if err != nil {
+		return Config{}, err
+	}
+	smtpMaxMessages, err := getPositiveIntFromEnv("SMTP_MAX_MESSAGES_PER_CONN", defaultSMTPMaxMessages)
+	if err != nil {
+		return Config{}, err
+	}
+	smtpRootCAs, err := loadCertPool(getStringFromEnv("SMTP_CA_FILE", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("SMTP_CA_FILE: %w", err)
+	}
+
+	domainLimits, err := throttle.ParseLimits(os.Getenv("EMAIL_DOMAIN_LIMITS"))
+	if err != nil {
+		return Config{}, fmt.Errorf("EMAIL_DOMAIN_LIMITS: %w", err)
+	}
+
+	visibilitySec, err := getPositiveIntFromEnv("QUEUE_VISIBILITY_TIMEOUT_SEC", defaultVisibilitySec)
+	if err != nil {
+		return Config{}, err
+	}
+	maxDeliveries, err := getPositiveIntFromEnv("EMAIL_QUEUE_MAX_DELIVERIES", defaultMaxDeliveries)
+	if err != nil {
+		return Config{}, err
+	}
+
+	promoteMS, err := getPositiveIntFromEnv("QUEUE_PROMOTE_INTERVAL_MS", defaultPromoteMS)
+	if err != nil {
+		return Config{}, err
+	}
+
+	tenantHookTries, err := getPositiveIntFromEnv("TENANT_WEBHOOK_MAX_ATTEMPTS", defaultTenantHookTries)
+	if err != nil {
+		return Config{}, err
+	}
+	tenantHookSec, err := getPositiveIntFromEnv("TENANT_WEBHOOK_TIMEOUT_SEC", defaultTenantHookSec)
+	if err != nil {
+		return Config{}, err
+	}
+	tenantHookAllowPrivate, err := getBoolFromEnv("TENANT_WEBHOOK_ALLOW_PRIVATE_NETWORKS", false)
+	if err != nil {
+		return Config{}, err
+	}
+
 	cfg := Config{
 		DBDSN:             getStringFromEnv("DB_DSN", defaultDBDSN),
 		RedisAddr:         getStringFromEnv("REDIS_ADDR", defaultRedisAddr),
 		QueueName:         getStringFromEnv("EMAIL_QUEUE_NAME", defaultQueueName),
 		QueuePopTimeout:   time.Duration(queueTimeoutSec) * time.Second,
 		QueuePollInterval: time.Duration(queuePollSec) * time.Second,
+		Concurrency:       concurrency,
+		DrainTimeout:      time.Duration(drainSec) * time.Second,
+		QueuePriorityMode: strings.ToLower(getStringFromEnv("EMAIL_QUEUE_PRIORITY_MODE", PriorityModeStrict)),
+		QueueWeights:      queueWeights,
+		DomainLimits:      domainLimits,
 		WebhookAddr:       getStringFromEnv("EMAIL_WEBHOOK_ADDR", defaultWebhookAddr),
 		MetricsAddr:       getStringFromEnv("EMAIL_METRICS_ADDR", defaultMetricsAddr),
 		WebhookSecret:     strings.TrimSpace(os.Getenv("EMAIL_WEBHOOK_SECRET")),
@@ -69,6 +253,55 @@ func LoadFromEnv() (Config, error) {
 		SMTPPassword:      os.Getenv("SMTP_PASSWORD"),
 		SMTPFromEmail:     getStringFromEnv("SMTP_FROM_EMAIL", defaultSMTPFromEmail),
 		SMTPFromName:      getStringFromEnv("SMTP_FROM_NAME", defaultSMTPFromName),
+
+		SMTPTLSPolicy:          strings.ToLower(getStringFromEnv("SMTP_TLS_POLICY", "")),
+		SMTPRootCAs:            smtpRootCAs,
+		SMTPAuthMechanism:      strings.ToUpper(getStringFromEnv("SMTP_AUTH_MECHANISM", "")),
+		SMTPDialTimeout:        time.Duration(smtpDialSec) * time.Second,
+		SMTPCommandTimeout:     time.Duration(smtpCommandSec) * time.Second,
+		SMTPMaxIdleConns:       smtpMaxIdle,
+		SMTPIdleTimeout:        time.Duration(smtpIdleSec) * time.Second,
+		SMTPMaxMessagesPerConn: smtpMaxMessages,
+
+		EmailProvider:            strings.ToLower(getStringFromEnv("EMAIL_PROVIDER", sender.ProviderSMTP)),
+		EmailProviders:           emailProviders,
+		ProviderTimeout:          time.Duration(providerSec) * time.Second,
+		ProviderFailureThreshold: breakerFailures,
+		ProviderCooldown:         time.Duration(breakerSec) * time.Second,
+		SES: sender.SESConfig{
+			Region:           getStringFromEnv("SES_REGION", getStringFromEnv("AWS_REGION", "")),
+			AccessKeyID:      getStringFromEnv("AWS_ACCESS_KEY_ID", ""),
+			SecretAccessKey:  os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:     os.Getenv("AWS_SESSION_TOKEN"),
+			ConfigurationSet: getStringFromEnv("SES_CONFIGURATION_SET", ""),
+			Endpoint:         getStringFromEnv("SES_ENDPOINT", ""),
+		},
+		SendGrid: sender.SendGridConfig{
+			APIKey:  os.Getenv("SENDGRID_API_KEY"),
+			BaseURL: getStringFromEnv("SENDGRID_BASE_URL", ""),
+		},
+		Mailgun: sender.MailgunConfig{
+			APIKey:  os.Getenv("MAILGUN_API_KEY"),
+			Domain:  getStringFromEnv("MAILGUN_DOMAIN", ""),
+			BaseURL: getStringFromEnv("MAILGUN_BASE_URL", ""),
+		},
+		Postmark: sender.PostmarkConfig{
+			ServerToken:   os.Getenv("POSTMARK_SERVER_TOKEN"),
+			MessageStream: getStringFromEnv("POSTMARK_MESSAGE_STREAM", ""),
+			BaseURL:       getStringFromEnv("POSTMARK_BASE_URL", ""),
+		},
+
+		QueueBackend:           strings.ToLower(getStringFromEnv("QUEUE_BACKEND", queue.BackendList)),
+		QueueStreamGroup:       getStringFromEnv("QUEUE_STREAM_GROUP", defaultStreamGroup),
+		QueueStreamConsumer:    getStringFromEnv("QUEUE_STREAM_CONSUMER", defaultConsumerName()),
+		QueueVisibilityTimeout: time.Duration(visibilitySec) * time.Second,
+		QueueMaxDeliveries:     maxDeliveries,
+		QueuePromoteInterval:   time.Duration(promoteMS) * time.Millisecond,
+
+		TenantWebhookQueueName:    getStringFromEnv("TENANT_WEBHOOK_QUEUE_NAME", defaultTenantHookQueue),
+		TenantWebhookMaxAttempts:  tenantHookTries,
+		TenantWebhookTimeout:      time.Duration(tenantHookSec) * time.Second,
+		TenantWebhookAllowPrivate: tenantHookAllowPrivate,
 	}
 	cfg.Analytics, err = analytics.LoadConfigFromEnv()
 	if err != nil {
@@ -84,6 +317,15 @@ func LoadFromEnv() (Config, error) {
 	if strings.TrimSpace(cfg.QueueName) == "" {
 		return Config{}, fmt.Errorf("EMAIL_QUEUE_NAME cannot be empty")
 	}
+	if cfg.QueuePriorityMode != PriorityModeStrict && cfg.QueuePriorityMode != PriorityModeWeighted {
+		return Config{}, fmt.Errorf("EMAIL_QUEUE_PRIORITY_MODE must be %q or %q", PriorityModeStrict, PriorityModeWeighted)
+	}
+	if cfg.QueueBackend != queue.BackendList && cfg.QueueBackend != queue.BackendStreams {
+		return Config{}, fmt.Errorf("QUEUE_BACKEND must be %q or %q", queue.BackendList, queue.BackendStreams)
+	}
+	if cfg.QueueBackend == queue.BackendStreams && strings.TrimSpace(cfg.QueueStreamConsumer) == "" {
+		return Config{}, fmt.Errorf("QUEUE_STREAM_CONSUMER cannot be empty")
+	}
 	if strings.TrimSpace(cfg.WebhookAddr) == "" {
 		return Config{}, fmt.Errorf("EMAIL_WEBHOOK_ADDR cannot be empty")
 	}
@@ -102,6 +344,28 @@ func LoadFromEnv() (Config, error) {
 	if _, err := mail.ParseAddress(cfg.SMTPFromEmail); err != nil {
 		return Config{}, fmt.Errorf("SMTP_FROM_EMAIL must be a valid email address")
 	}
+	if cfg.SMTPTLSPolicy == "" {
+		cfg.SMTPTLSPolicy = email.TLSOpportunistic
+		if cfg.SMTPPort == 465 {
+			cfg.SMTPTLSPolicy = email.TLSImplicit
+		}
+	}
+	if !slices.Contains([]string{email.TLSOpportunistic, email.TLSStartTLS, email.TLSImplicit, email.TLSNone}, cfg.SMTPTLSPolicy) {
+		return Config{}, fmt.Errorf("SMTP_TLS_POLICY must be one of %q, %q, %q or %q", email.TLSOpportunistic, email.TLSStartTLS, email.TLSImplicit, email.TLSNone)
+	}
+	if cfg.SMTPAuthMechanism != "" && !slices.Contains([]string{email.AuthPlain, email.AuthLogin, email.AuthCRAMMD5}, cfg.SMTPAuthMechanism) {
+		return Config{}, fmt.Errorf("SMTP_AUTH_MECHANISM must be %q, %q or %q", email.AuthPlain, email.AuthLogin, email.AuthCRAMMD5)
+	}
+	providersKey := "EMAIL_PROVIDERS"
+	if len(cfg.EmailProviders) == 0 {
+		providersKey = "EMAIL_PROVIDER"
+		cfg.EmailProviders = []ProviderWeight{{Name: cfg.EmailProvider, Weight: 1}}
+	}
+	for _, provider := range cfg.EmailProviders {
+		if err := cfg.validateProvider(providersKey, provider.Name); err != nil {
+			return Config{}, err
+		}
+	}
 
 	return cfg, nil
 }
@@ -114,7 +378,151 @@ func (c Config) SMTPConfig() email.SMTPConfig {
 		Password:  c.SMTPPassword,
 		FromEmail: c.SMTPFromEmail,
 		FromName:  c.SMTPFromName,
+
+		TLSPolicy:          c.SMTPTLSPolicy,
+		RootCAs:            c.SMTPRootCAs,
+		AuthMechanism:      c.SMTPAuthMechanism,
+		DialTimeout:        c.SMTPDialTimeout,
+		CommandTimeout:     c.SMTPCommandTimeout,
+		MaxIdleConns:       c.SMTPMaxIdleConns,
+		IdleTimeout:        c.SMTPIdleTimeout,
+		MaxMessagesPerConn: c.SMTPMaxMessagesPerConn,
+	}
+}
+
+// ProviderConfig returns the settings of the named provider for
+// sender.NewProvider.
+func (c Config) ProviderConfig(name string) sender.ProviderConfig {
+	return sender.ProviderConfig{
+		Name:     name,
+		From:     sender.Address{Email: c.SMTPFromEmail, Name: c.SMTPFromName},
+		Timeout:  c.ProviderTimeout,
+		SMTP:     c.SMTPConfig(),
+		SES:      c.SES,
+		SendGrid: c.SendGrid,
+		Mailgun:  c.Mailgun,
+		Postmark: c.Postmark,
+	}
+}
+
+// validateProvider reports the first missing setting of the named provider,
+// which was configured by key.
+func (c Config) validateProvider(key, name string) error {
+	var required [][2]string
+	switch name {
+	case sender.ProviderSMTP:
+		return nil
+	case sender.ProviderSES:
+		required = [][2]string{{"SES_REGION", c.SES.Region}, {"AWS_ACCESS_KEY_ID", c.SES.AccessKeyID}, {"AWS_SECRET_ACCESS_KEY", c.SES.SecretAccessKey}}
+	case sender.ProviderSendGrid:
+		required = [][2]string{{"SENDGRID_API_KEY", c.SendGrid.APIKey}}
+	case sender.ProviderMailgun:
+		required = [][2]string{{"MAILGUN_API_KEY", c.Mailgun.APIKey}, {"MAILGUN_DOMAIN", c.Mailgun.Domain}}
+	case sender.ProviderPostmark:
+		required = [][2]string{{"POSTMARK_SERVER_TOKEN", c.Postmark.ServerToken}}
+	default:
+		return fmt.Errorf("%s: provider %q must be one of %q, %q, %q, %q or %q", key, name,
+			sender.ProviderSMTP, sender.ProviderSES, sender.ProviderSendGrid, sender.ProviderMailgun, sender.ProviderPostmark)
 	}
+	for _, setting := range required {
+		if strings.TrimSpace(setting[1]) == "" {
+			return fmt.Errorf("%s cannot be empty when %s uses %s", setting[0], key, name)
+		}
+	}
+	return nil
+}
+
+func (c Config) QueueStreamOptions() queue.StreamOptions {
+	return queue.StreamOptions{
+		Group:             c.QueueStreamGroup,
+		Consumer:          c.QueueStreamConsumer,
+		VisibilityTimeout: c.QueueVisibilityTimeout,
+	}
+}
+
+// EmailQueueNames returns the email queue of every priority, highest first.
+func (c Config) EmailQueueNames() ([]string, error) {
+	return queue.PriorityQueueNames(c.QueueName)
+}
+
+// parseQueueWeights parses "priority=weight" pairs separated by commas.
+// Priorities left out get weight 1.
+func parseQueueWeights(raw string) (map[string]int, error) {
+	weights := map[string]int{}
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		priority, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q must be priority=weight", pair)
+		}
+		priority = strings.ToLower(strings.TrimSpace(priority))
+		if !slices.Contains(queue.Priorities, priority) {
+			return nil, fmt.Errorf("unknown priority %q", priority)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("weight of %q must be a positive integer", priority)
+		}
+		weights[priority] = weight
+	}
+	return weights, nil
+}
+
+// parseProviderWeights parses "provider=weight" pairs separated by commas,
+// in order. A provider without a weight gets weight 1.
+func parseProviderWeights(raw string) ([]ProviderWeight, error) {
+	var providers []ProviderWeight
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, hasWeight := strings.Cut(pair, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1
+		if hasWeight {
+			var err error
+			weight, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("weight of %q must be a positive integer", name)
+			}
+		}
+		if slices.ContainsFunc(providers, func(p ProviderWeight) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("provider %q is listed twice", name)
+		}
+		providers = append(providers, ProviderWeight{Name: name, Weight: weight})
+	}
+	return providers, nil
+}
+
+// loadCertPool reads PEM certificates from path; an empty path returns nil,
+// meaning the system roots.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// defaultConsumerName names this worker in the consumer group after the host,
+// which is unique per pod or container.
+func defaultConsumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return host
 }
 
 func getStringFromEnv(key, def string) string {
@@ -137,6 +545,18 @@ func getIntFromEnv(key string, def int) int {
 	return value
 }
 
+func getBoolFromEnv(key string, def bool) (bool, error) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean", key)
+	}
+	return value, nil
+}
+
 func getPositiveIntFromEnv(key string, def int) (int, error) {
 	raw := strings.TrimSpace(os.Getenv(key))
 	if raw == "" {
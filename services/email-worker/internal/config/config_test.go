@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -76,7 +78,263 @@ func TestLoadFromEnvMetricsAddrConfig(t *testing.T) {
 	}
 }
 
+func TestLoadFromEnvTenantWebhookConfig(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if cfg.TenantWebhookQueueName != "webhook:deliver" || cfg.TenantWebhookMaxAttempts != 8 || cfg.TenantWebhookTimeout != 10*time.Second || cfg.TenantWebhookAllowPrivate {
+		t.Fatalf("defaults = %q %d %v %v", cfg.TenantWebhookQueueName, cfg.TenantWebhookMaxAttempts, cfg.TenantWebhookTimeout, cfg.TenantWebhookAllowPrivate)
+	}
+
+	t.Setenv("TENANT_WEBHOOK_MAX_ATTEMPTS", "3")
+	t.Setenv("TENANT_WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	if cfg, err = LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if cfg.TenantWebhookMaxAttempts != 3 || !cfg.TenantWebhookAllowPrivate {
+		t.Fatalf("overrides = %d %v", cfg.TenantWebhookMaxAttempts, cfg.TenantWebhookAllowPrivate)
+	}
+
+	t.Setenv("TENANT_WEBHOOK_ALLOW_PRIVATE_NETWORKS", "sometimes")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "TENANT_WEBHOOK_ALLOW_PRIVATE_NETWORKS") {
+		t.Fatalf("LoadFromEnv() error = %v, want TENANT_WEBHOOK_ALLOW_PRIVATE_NETWORKS", err)
+	}
+}
+
+func TestLoadFromEnvQueueBackendConfig(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if cfg.QueueBackend != "list" || cfg.QueueStreamGroup != "email-worker" || cfg.QueueVisibilityTimeout != 5*time.Minute || cfg.QueueMaxDeliveries != 5 || cfg.QueuePromoteInterval != time.Second {
+		t.Fatalf("defaults = %q %q %v %d %v", cfg.QueueBackend, cfg.QueueStreamGroup, cfg.QueueVisibilityTimeout, cfg.QueueMaxDeliveries, cfg.QueuePromoteInterval)
+	}
+
+	t.Setenv("QUEUE_BACKEND", "Streams")
+	t.Setenv("QUEUE_STREAM_CONSUMER", "worker-a")
+	t.Setenv("QUEUE_VISIBILITY_TIMEOUT_SEC", "60")
+	if cfg, err = LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	opts := cfg.QueueStreamOptions()
+	if cfg.QueueBackend != "streams" || opts.Consumer != "worker-a" || opts.Group != "email-worker" || opts.VisibilityTimeout != time.Minute {
+		t.Fatalf("overrides = %q %+v", cfg.QueueBackend, opts)
+	}
+
+	t.Setenv("QUEUE_BACKEND", "kafka")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "QUEUE_BACKEND") {
+		t.Fatalf("LoadFromEnv() error = %v, want QUEUE_BACKEND", err)
+	}
+}
+
 func setRequiredEnv(t *testing.T) {
 	t.Helper()
 	t.Setenv("EMAIL_WEBHOOK_SECRET", "secret")
 }
+
+func TestLoadFromEnvConcurrencyConfig(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if cfg.Concurrency != 4 || cfg.DrainTimeout != 30*time.Second {
+		t.Fatalf("defaults = %d %v", cfg.Concurrency, cfg.DrainTimeout)
+	}
+
+	t.Setenv("EMAIL_WORKER_CONCURRENCY", "0")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "EMAIL_WORKER_CONCURRENCY") {
+		t.Fatalf("LoadFromEnv() error = %v, want EMAIL_WORKER_CONCURRENCY", err)
+	}
+}
+
+func TestLoadFromEnvDomainLimitsConfig(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if len(cfg.DomainLimits) != 0 {
+		t.Fatalf("default limits = %+v, want none", cfg.DomainLimits)
+	}
+
+	t.Setenv("EMAIL_DOMAIN_LIMITS", "gmail.com=20/s:10,*=5/s")
+	if cfg, err = LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if len(cfg.DomainLimits) != 2 || cfg.DomainLimits[0].Domain != "gmail.com" || cfg.DomainLimits[0].MaxConcurrent != 10 {
+		t.Fatalf("limits = %+v", cfg.DomainLimits)
+	}
+
+	t.Setenv("EMAIL_DOMAIN_LIMITS", "gmail.com=fast")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "EMAIL_DOMAIN_LIMITS") {
+		t.Fatalf("LoadFromEnv() error = %v, want EMAIL_DOMAIN_LIMITS", err)
+	}
+}
+
+func TestLoadFromEnvQueuePriorityConfig(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if cfg.QueuePriorityMode != PriorityModeStrict || cfg.QueueWeights["transactional"] != 10 || cfg.QueueWeights["bulk"] != 1 {
+		t.Fatalf("defaults = %q %v", cfg.QueuePriorityMode, cfg.QueueWeights)
+	}
+	names, err := cfg.EmailQueueNames()
+	if err != nil || strings.Join(names, ",") != "email:send,email:send:notification,email:send:bulk" {
+		t.Fatalf("EmailQueueNames() = %v, %v", names, err)
+	}
+
+	t.Setenv("EMAIL_QUEUE_PRIORITY_MODE", "Weighted")
+	t.Setenv("EMAIL_QUEUE_WEIGHTS", "transactional=5, bulk=2")
+	if cfg, err = LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if cfg.QueuePriorityMode != PriorityModeWeighted || len(cfg.QueueWeights) != 2 || cfg.QueueWeights["bulk"] != 2 {
+		t.Fatalf("config = %q %v", cfg.QueuePriorityMode, cfg.QueueWeights)
+	}
+
+	t.Setenv("EMAIL_QUEUE_WEIGHTS", "urgent=5")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "EMAIL_QUEUE_WEIGHTS") {
+		t.Fatalf("LoadFromEnv() error = %v, want EMAIL_QUEUE_WEIGHTS", err)
+	}
+
+	t.Setenv("EMAIL_QUEUE_WEIGHTS", "")
+	t.Setenv("EMAIL_QUEUE_PRIORITY_MODE", "fifo")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "EMAIL_QUEUE_PRIORITY_MODE") {
+		t.Fatalf("LoadFromEnv() error = %v, want EMAIL_QUEUE_PRIORITY_MODE", err)
+	}
+}
+
+func TestLoadFromEnvEmailProviderConfig(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if cfg.EmailProvider != "smtp" || cfg.ProviderTimeout != 10*time.Second {
+		t.Fatalf("defaults = %q %v", cfg.EmailProvider, cfg.ProviderTimeout)
+	}
+	if len(cfg.EmailProviders) != 1 || cfg.EmailProviders[0] != (ProviderWeight{Name: "smtp", Weight: 1}) {
+		t.Fatalf("EmailProviders = %+v, want smtp alone", cfg.EmailProviders)
+	}
+
+	t.Setenv("EMAIL_PROVIDER", "Mailgun")
+	t.Setenv("MAILGUN_API_KEY", "key")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "MAILGUN_DOMAIN") {
+		t.Fatalf("LoadFromEnv() error = %v, want MAILGUN_DOMAIN", err)
+	}
+
+	t.Setenv("MAILGUN_DOMAIN", "mg.example.com")
+	t.Setenv("MAILGUN_BASE_URL", "https://api.eu.mailgun.net")
+	if cfg, err = LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	pc := cfg.ProviderConfig(cfg.EmailProviders[0].Name)
+	if pc.Name != "mailgun" || pc.Mailgun.Domain != "mg.example.com" || pc.Mailgun.BaseURL != "https://api.eu.mailgun.net" || pc.From.Email != "noreply@example.com" {
+		t.Fatalf("ProviderConfig() = %+v", pc)
+	}
+
+	t.Setenv("EMAIL_PROVIDER", "pigeon")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "EMAIL_PROVIDER") {
+		t.Fatalf("LoadFromEnv() error = %v, want EMAIL_PROVIDER", err)
+	}
+}
+
+func TestLoadFromEnvEmailProvidersRouting(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if cfg.ProviderFailureThreshold != 5 || cfg.ProviderCooldown != 30*time.Second {
+		t.Fatalf("breaker defaults = %d %v", cfg.ProviderFailureThreshold, cfg.ProviderCooldown)
+	}
+
+	t.Setenv("EMAIL_PROVIDER", "pigeon")
+	t.Setenv("EMAIL_PROVIDERS", "SendGrid=3, smtp")
+	t.Setenv("SENDGRID_API_KEY", "key")
+	t.Setenv("EMAIL_PROVIDER_BREAKER_FAILURES", "2")
+	t.Setenv("EMAIL_PROVIDER_BREAKER_COOLDOWN_SEC", "60")
+	if cfg, err = LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	want := []ProviderWeight{{Name: "sendgrid", Weight: 3}, {Name: "smtp", Weight: 1}}
+	if len(cfg.EmailProviders) != 2 || cfg.EmailProviders[0] != want[0] || cfg.EmailProviders[1] != want[1] {
+		t.Fatalf("EmailProviders = %+v, want %+v", cfg.EmailProviders, want)
+	}
+	if cfg.ProviderFailureThreshold != 2 || cfg.ProviderCooldown != time.Minute {
+		t.Fatalf("breaker = %d %v", cfg.ProviderFailureThreshold, cfg.ProviderCooldown)
+	}
+
+	t.Setenv("EMAIL_PROVIDERS", "sendgrid,postmark")
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "POSTMARK_SERVER_TOKEN") {
+		t.Fatalf("LoadFromEnv() error = %v, want POSTMARK_SERVER_TOKEN", err)
+	}
+
+	for _, raw := range []string{"sendgrid=0", "sendgrid,sendgrid", "sendgrid,pigeon"} {
+		t.Setenv("EMAIL_PROVIDERS", raw)
+		if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "EMAIL_PROVIDERS") {
+			t.Fatalf("EMAIL_PROVIDERS=%q: LoadFromEnv() error = %v, want EMAIL_PROVIDERS", raw, err)
+		}
+	}
+}
+
+func TestLoadFromEnvSMTPConnectionConfig(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	smtp := cfg.SMTPConfig()
+	if smtp.TLSPolicy != "opportunistic" || smtp.RootCAs != nil || smtp.AuthMechanism != "" {
+		t.Fatalf("TLS/auth defaults = %q %v %q", smtp.TLSPolicy, smtp.RootCAs, smtp.AuthMechanism)
+	}
+	if smtp.DialTimeout != 10*time.Second || smtp.CommandTimeout != 30*time.Second || smtp.IdleTimeout != 30*time.Second {
+		t.Fatalf("timeout defaults = %v %v %v", smtp.DialTimeout, smtp.CommandTimeout, smtp.IdleTimeout)
+	}
+	if smtp.MaxIdleConns != 4 || smtp.MaxMessagesPerConn != 100 {
+		t.Fatalf("pool defaults = %d %d, want one idle connection per worker", smtp.MaxIdleConns, smtp.MaxMessagesPerConn)
+	}
+
+	t.Setenv("SMTP_PORT", "465")
+	t.Setenv("SMTP_AUTH_MECHANISM", "login")
+	t.Setenv("SMTP_COMMAND_TIMEOUT_SEC", "5")
+	if cfg, err = LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if smtp = cfg.SMTPConfig(); smtp.TLSPolicy != "implicit" || smtp.AuthMechanism != "LOGIN" || smtp.CommandTimeout != 5*time.Second {
+		t.Fatalf("SMTPConfig() = %q %q %v", smtp.TLSPolicy, smtp.AuthMechanism, smtp.CommandTimeout)
+	}
+
+	t.Setenv("SMTP_TLS_POLICY", "STARTTLS")
+	if cfg, err = LoadFromEnv(); err != nil || cfg.SMTPTLSPolicy != "starttls" {
+		t.Fatalf("LoadFromEnv() = %q, %v, want starttls", cfg.SMTPTLSPolicy, err)
+	}
+
+	for key, value := range map[string]string{
+		"SMTP_TLS_POLICY":     "sometimes",
+		"SMTP_AUTH_MECHANISM": "XOAUTH2",
+		"SMTP_CA_FILE":        filepath.Join(t.TempDir(), "missing.pem"),
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := LoadFromEnv(); err == nil || !strings.Contains(err.Error(), key) {
+				t.Fatalf("LoadFromEnv() error = %v, want %s", err, key)
+			}
+		})
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+	t.Setenv("SMTP_CA_FILE", notPEM)
+	if _, err = LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "SMTP_CA_FILE") {
+		t.Fatalf("LoadFromEnv() error = %v, want SMTP_CA_FILE", err)
+	}
+}
@@ -9,13 +9,16 @@ import (
 	htmltemplate "html/template"
 	"log"
 	"strings"
+	"sync"
 	texttemplate "text/template"
 	"time"
 
 	"anvilkit-auth-template/modules/common-go/pkg/analytics"
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
 	"anvilkit-auth-template/services/email-worker/internal/monitoring"
 	"anvilkit-auth-template/services/email-worker/internal/sender"
 	workerstore "anvilkit-auth-template/services/email-worker/internal/store"
+	"anvilkit-auth-template/services/email-worker/internal/throttle"
 	emailtemplates "anvilkit-auth-template/services/email-worker/templates"
 )
 
@@ -23,6 +26,7 @@ var (
 	ErrNilQueue           = errors.New("nil_queue")
 	ErrNilSender          = errors.New("nil_sender")
 	ErrNilStore           = errors.New("nil_store")
+	ErrNilScheduler       = errors.New("nil_scheduler")
 	ErrEmptyQueue         = errors.New("empty_queue_name")
 	ErrInvalidJob         = errors.New("invalid_email_job")
 	ErrEmptyRecord        = errors.New("empty_record_id")
@@ -32,25 +36,53 @@ var (
 	ErrEmptyExpiry        = errors.New("empty_expires_in")
 	ErrEmailBlacklisted   = errors.New("email_blacklisted")
 	ErrSoftBounceExceeded = errors.New("soft_bounce_retry_exhausted")
+	// ErrProviderRetryExceeded fails a job whose providers stayed
+	// unavailable through every retry.
+	ErrProviderRetryExceeded = errors.New("provider_retry_exhausted")
+	ErrDeliveriesExceeded    = errors.New("queue_delivery_attempts_exhausted")
+)
+
+const (
+	defaultMaxDeliveries = 5
+	defaultDrainTimeout  = 30 * time.Second
+	reasonInvalidPayload = "invalid_payload"
 )
 
 var (
 	verificationHTMLTemplate = htmltemplate.Must(htmltemplate.ParseFS(emailtemplates.FS, "verification_email.html.tmpl"))
 	verificationTextTemplate = texttemplate.Must(texttemplate.ParseFS(emailtemplates.FS, "verification_email.txt.tmpl"))
 	softBounceRetryIntervals = []time.Duration{time.Hour, 4 * time.Hour, 24 * time.Hour}
+	providerRetryIntervals   = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute}
 )
 
+// Queue is the subset of queue.Queue the consumer needs. Messages are
+// acknowledged once handled; with the streams backend a message whose
+// handling was interrupted is delivered again.
 type Queue interface {
-	DequeueIntoContext(ctx context.Context, queueName string, timeout time.Duration, out any) (bool, error)
-	EnqueueContext(ctx context.Context, queueName string, payload any) error
+	ReceiveContext(ctx context.Context, queueName string, timeout time.Duration) (*queue.Message, error)
+	AckContext(ctx context.Context, queueName string, msg *queue.Message) error
+}
+
+// DeadLetterWriter keeps jobs that cannot be processed together with the
+// reason, such as queue.DeadLetterQueue.
+type DeadLetterWriter interface {
+	AddContext(ctx context.Context, queueName string, payload []byte, reason string, deliveries int64) error
 }
 
 type Sender interface {
 	Send(ctx context.Context, req sender.Request) (string, error)
 }
 
+// RoutedSender is a Sender over several providers, such as sender.Router,
+// that reports which one accepted each email.
+type RoutedSender interface {
+	SendVia(ctx context.Context, req sender.Request) (externalID, provider string, err error)
+}
+
 type Store interface {
-	MarkSent(ctx context.Context, recordID, externalID string) error
+	// MarkSent records the email as sent; provider is empty when the Sender
+	// does not report it.
+	MarkSent(ctx context.Context, recordID, externalID, provider string) error
 	MarkFailed(ctx context.Context, recordID, reason string) error
 	MarkBounced(ctx context.Context, recordID, reason, bounceType string, smtpCode, retryCount int) error
 	Blacklist(ctx context.Context, emailAddr, reason string) error
@@ -58,14 +90,16 @@ type Store interface {
 	LookupAnalyticsRecordByID(ctx context.Context, recordID string) (*workerstore.AnalyticsRecord, error)
 }
 
+// Scheduler persists jobs to be enqueued after a delay, such as
+// queue.DelayedQueue, so pending retries survive restarts.
 type Scheduler interface {
-	AfterFunc(d time.Duration, f func())
+	ScheduleContext(ctx context.Context, queueName string, payload any, delay time.Duration) error
 }
 
-type realScheduler struct{}
-
-func (realScheduler) AfterFunc(d time.Duration, f func()) {
-	time.AfterFunc(d, f)
+// Throttle limits sends per recipient domain, such as *throttle.Limiter.
+type Throttle interface {
+	Acquire(ctx context.Context, to string) (throttle.Decision, error)
+	Release(ctx context.Context, d throttle.Decision) error
 }
 
 type EmailJob struct {
@@ -79,19 +113,74 @@ type EmailJob struct {
 	ExpiresIn  string `json:"expires_in"`
 	ResendIn   string `json:"resend_in,omitempty"`
 	RetryCount int    `json:"retry_count,omitempty"`
+	// ProviderRetries counts the retries after provider outages, which are
+	// not bounces and do not count towards RetryCount.
+	ProviderRetries int `json:"provider_retries,omitempty"`
 }
 
 type Consumer struct {
 	Queue     Queue
 	QueueName string
+	// Queues, if set, are consumed instead of QueueName, highest priority
+	// first. Retried, throttled and dead-lettered jobs keep the queue they
+	// were received from.
+	Queues []PriorityQueue
+	// Weighted picks the queue to take the next job from at random in
+	// proportion to its weight instead of always preferring the highest
+	// priority with jobs waiting, so lower priorities cannot starve.
+	Weighted  bool
 	Timeout   time.Duration
 	Sender    Sender
 	Store     Store
 	Analytics analytics.Client
+	// Scheduler holds soft-bounce retries and retries after provider
+	// outages; without one soft bounces are not retried and jobs that find
+	// every provider unavailable are left unacknowledged.
 	Scheduler Scheduler
 	Metrics   *monitoring.Metrics
+	// MaxDeliveries fails a job handed out more often than this, which
+	// happens when a worker keeps crashing or losing its store while
+	// handling it. Defaults to 5.
+	MaxDeliveries int
+	// DeadLetters receives undecodable payloads and exhausted jobs; they
+	// are dropped when it is nil.
+	DeadLetters DeadLetterWriter
+	// Concurrency is how many jobs are handled at a time. With 1, the
+	// default, jobs are handled in queue order; with more they start in
+	// queue order but may finish in any order.
+	Concurrency int
+	// DrainTimeout is how long Run waits for in-flight jobs after ctx is
+	// cancelled before cancelling them too. Defaults to 30s.
+	DrainTimeout time.Duration
+	// Throttle, if set, defers jobs to domains whose send budget is spent
+	// through Scheduler, which it requires.
+	Throttle Throttle
+
+	receiveFrom []PriorityQueue
+}
+
+// retryableError marks failures of the worker's own store. The message is
+// left unacknowledged so the streams backend delivers it again.
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string { return e.err.Error() }
+
+func (e retryableError) Unwrap() error { return e.err }
+
+func retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retryableError{err: err}
 }
 
+// Run handles jobs from Queues, or QueueName, with up to Concurrency workers. A job is
+// received only once a worker is free, so none waits in memory. When ctx is
+// cancelled Run stops receiving and lets in-flight jobs finish for up to
+// DrainTimeout; jobs still running then are cancelled and, being
+// unacknowledged, delivered again by the streams backend.
 func (c *Consumer) Run(ctx context.Context) error {
 	if c.Queue == nil {
 		return ErrNilQueue
@@ -102,62 +191,183 @@ func (c *Consumer) Run(ctx context.Context) error {
 	if c.Store == nil {
 		return ErrNilStore
 	}
-	if strings.TrimSpace(c.QueueName) == "" {
-		return ErrEmptyQueue
+	receiveFrom, err := c.priorityQueues()
+	if err != nil {
+		return err
+	}
+	c.receiveFrom = receiveFrom
+	if c.Throttle != nil && c.Scheduler == nil {
+		return ErrNilScheduler
 	}
 	if c.Timeout <= 0 {
 		c.Timeout = 5 * time.Second
 	}
-	if c.Scheduler == nil {
-		c.Scheduler = realScheduler{}
+	if c.MaxDeliveries <= 0 {
+		c.MaxDeliveries = defaultMaxDeliveries
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 1
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = defaultDrainTimeout
+	}
+	if c.Metrics != nil {
+		c.Metrics.SetWorkers(c.Concurrency)
+	}
+
+	// Jobs outlive ctx until the drain timeout.
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+	workers := make(chan int, c.Concurrency)
+	for id := 0; id < c.Concurrency; id++ {
+		workers <- id
 	}
+	var inFlight sync.WaitGroup
 
+	err = c.receive(ctx, jobCtx, workers, &inFlight)
+	c.drain(&inFlight, cancelJobs)
+	return err
+}
+
+// receive hands each message to a free worker from workers until ctx is
+// cancelled or the queue fails.
+func (c *Consumer) receive(ctx, jobCtx context.Context, workers chan int, inFlight *sync.WaitGroup) error {
 	for {
-		if err := ctx.Err(); err != nil {
+		var worker int
+		select {
+		case <-ctx.Done():
 			return nil
+		case worker = <-workers:
 		}
 
-		var job EmailJob
-		ok, err := c.Queue.DequeueIntoContext(ctx, c.QueueName, c.Timeout, &job)
-		if err != nil {
+		queueName, msg, err := c.next(ctx)
+		if err != nil || msg == nil {
+			workers <- worker
+			if err == nil {
+				continue
+			}
 			if ctx.Err() != nil {
 				return nil
 			}
-			if isPayloadDecodeError(err) {
-				log.Printf("email-worker: dropped invalid payload from queue=%q: %v", c.QueueName, err)
-				continue
-			}
-			return fmt.Errorf("dequeue email job: %w", err)
+			return fmt.Errorf("receive email job: %w", err)
 		}
-		if !ok {
-			continue
+
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			defer func() { workers <- worker }()
+			c.handleOnWorker(jobCtx, worker, queueName, msg)
+		}()
+	}
+}
+
+func (c *Consumer) handleOnWorker(ctx context.Context, worker int, queueName string, msg *queue.Message) {
+	if c.Metrics == nil {
+		c.handleMessage(ctx, queueName, msg)
+		return
+	}
+	startedAt := time.Now()
+	c.Metrics.StartWorkerJob()
+	c.handleMessage(ctx, queueName, msg)
+	c.Metrics.FinishWorkerJob(worker, time.Since(startedAt))
+}
+
+// drain waits for in-flight jobs, cancelling them after DrainTimeout.
+func (c *Consumer) drain(inFlight *sync.WaitGroup, cancelJobs context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(c.DrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Printf("email-worker: cancelling in-flight jobs after drain timeout %s", c.DrainTimeout)
+		cancelJobs()
+		<-done
+	}
+}
+
+// handleMessage processes msg received from queueName and acknowledges it
+// unless the job should be delivered again: the store failed or the worker is
+// shutting down.
+func (c *Consumer) handleMessage(ctx context.Context, queueName string, msg *queue.Message) {
+	var job EmailJob
+	if err := json.Unmarshal(msg.Payload, &job); err != nil {
+		c.deadLetterAndAck(ctx, queueName, msg, fmt.Sprintf("%s: %v", reasonInvalidPayload, err))
+		return
+	}
+
+	if msg.Deliveries > int64(c.MaxDeliveries) {
+		if strings.TrimSpace(job.RecordID) != "" {
+			if err := c.Store.MarkFailed(ctx, job.RecordID, ErrDeliveriesExceeded.Error()); err != nil {
+				log.Printf("email-worker: mark failed record_id=%q: %v", job.RecordID, err)
+				return
+			}
 		}
+		c.deadLetterAndAck(ctx, queueName, msg, ErrDeliveriesExceeded.Error())
+		return
+	}
 
-		if err := c.handleJob(ctx, job); err != nil {
-			log.Printf("email-worker: failed to process record_id=%q: %v", job.RecordID, err)
+	if err := c.handleJob(ctx, queueName, job); err != nil {
+		log.Printf("email-worker: failed to process record_id=%q: %v", job.RecordID, err)
+		var retryErr retryableError
+		if errors.As(err, &retryErr) || ctx.Err() != nil {
+			return
 		}
+		if errors.Is(err, ErrSoftBounceExceeded) || errors.Is(err, ErrProviderRetryExceeded) {
+			c.deadLetterAndAck(ctx, queueName, msg, err.Error())
+			return
+		}
+	}
+	c.ack(ctx, queueName, msg)
+}
+
+// deadLetterAndAck moves msg to the dead-letter queue. If that fails the
+// message stays unacknowledged; without a dead-letter queue it is dropped.
+func (c *Consumer) deadLetterAndAck(ctx context.Context, queueName string, msg *queue.Message, reason string) {
+	if c.DeadLetters == nil {
+		log.Printf("email-worker: dropped message id=%q from queue=%q: %s", msg.ID, queueName, reason)
+		c.ack(ctx, queueName, msg)
+		return
+	}
+	if err := c.DeadLetters.AddContext(context.WithoutCancel(ctx), queueName, msg.Payload, reason, msg.Deliveries); err != nil {
+		log.Printf("email-worker: dead-letter message id=%q from queue=%q failed: %v", msg.ID, queueName, err)
+		return
 	}
+	log.Printf("email-worker: dead-lettered message id=%q from queue=%q: %s", msg.ID, queueName, reason)
+	c.ack(ctx, queueName, msg)
 }
 
-func (c *Consumer) handleJob(ctx context.Context, job EmailJob) error {
+// ack acknowledges msg even when ctx was cancelled while it was handled, so
+// a job finished during shutdown is not delivered again.
+func (c *Consumer) ack(ctx context.Context, queueName string, msg *queue.Message) {
+	if err := c.Queue.AckContext(context.WithoutCancel(ctx), queueName, msg); err != nil {
+		log.Printf("email-worker: ack message id=%q from queue=%q failed: %v", msg.ID, queueName, err)
+	}
+}
+
+func (c *Consumer) handleJob(ctx context.Context, queueName string, job EmailJob) error {
 	if strings.TrimSpace(job.RecordID) == "" {
 		return fmt.Errorf("%w: %v", ErrInvalidJob, ErrEmptyRecord)
 	}
 	if strings.TrimSpace(job.To) == "" {
 		reason := fmt.Sprintf("%v: %v", ErrInvalidJob, ErrEmptyToEmail)
 		if err := c.Store.MarkFailed(ctx, job.RecordID, reason); err != nil {
-			return fmt.Errorf("%s; mark failed: %v", reason, err)
+			return retryable(fmt.Errorf("%s; mark failed: %v", reason, err))
 		}
 		return errors.New(reason)
 	}
 	isBlacklisted, err := c.Store.IsBlacklisted(ctx, job.To)
 	if err != nil {
-		return err
+		return retryable(err)
 	}
 	if isBlacklisted {
 		reason := ErrEmailBlacklisted.Error()
 		if markErr := c.Store.MarkFailed(ctx, job.RecordID, reason); markErr != nil {
-			return fmt.Errorf("%s; mark failed: %v", reason, markErr)
+			return retryable(fmt.Errorf("%s; mark failed: %v", reason, markErr))
 		}
 		return ErrEmailBlacklisted
 	}
@@ -169,7 +379,7 @@ func (c *Consumer) handleJob(ctx context.Context, job EmailJob) error {
 		if err != nil {
 			reason := fmt.Sprintf("%v: %v", ErrInvalidJob, err)
 			if markErr := c.Store.MarkFailed(ctx, job.RecordID, reason); markErr != nil {
-				return fmt.Errorf("%s; mark failed: %v", reason, markErr)
+				return retryable(fmt.Errorf("%s; mark failed: %v", reason, markErr))
 			}
 			return errors.New(reason)
 		}
@@ -177,31 +387,84 @@ func (c *Consumer) handleJob(ctx context.Context, job EmailJob) error {
 		textBody = renderedText
 	}
 
+	decision, err := c.acquireSend(ctx, job)
+	if err != nil {
+		return retryable(fmt.Errorf("throttle: %w", err))
+	}
+	if !decision.Allowed {
+		return c.deferJob(ctx, queueName, job, decision)
+	}
+	defer c.releaseSend(ctx, decision)
+
 	startedAt := time.Now()
-	externalID, err := c.Sender.Send(ctx, sender.Request{To: job.To, Subject: job.Subject, HTMLBody: htmlBody, TextBody: textBody})
+	externalID, provider, err := c.send(ctx, sender.Request{To: job.To, Subject: job.Subject, HTMLBody: htmlBody, TextBody: textBody})
 	if err != nil {
 		if c.Metrics != nil {
 			c.Metrics.ObserveSendFailure(time.Since(startedAt))
 		}
-		return c.handleDeliveryError(ctx, job, err)
+		return c.handleDeliveryError(ctx, queueName, job, err)
 	}
 	if c.Metrics != nil {
 		c.Metrics.ObserveSendSuccess(time.Since(startedAt))
 	}
 
-	if err := c.Store.MarkSent(ctx, job.RecordID, externalID); err != nil {
-		return err
+	if err := c.Store.MarkSent(ctx, job.RecordID, externalID, provider); err != nil {
+		return retryable(err)
 	}
 	c.trackVerificationEmailSent(ctx, job.RecordID)
 
 	return nil
 }
 
-func (c *Consumer) handleDeliveryError(ctx context.Context, job EmailJob, sendErr error) error {
+func (c *Consumer) send(ctx context.Context, req sender.Request) (string, string, error) {
+	if routed, ok := c.Sender.(RoutedSender); ok {
+		return routed.SendVia(ctx, req)
+	}
+	externalID, err := c.Sender.Send(ctx, req)
+	return externalID, "", err
+}
+
+func (c *Consumer) acquireSend(ctx context.Context, job EmailJob) (throttle.Decision, error) {
+	if c.Throttle == nil {
+		return throttle.Decision{Allowed: true}, nil
+	}
+	decision, err := c.Throttle.Acquire(ctx, job.To)
+	if err != nil {
+		return decision, err
+	}
+	if c.Metrics != nil && decision.Label != "" {
+		c.Metrics.ObserveDomainThrottle(decision.Label, decision.Reason)
+	}
+	return decision, nil
+}
+
+func (c *Consumer) releaseSend(ctx context.Context, decision throttle.Decision) {
+	if c.Throttle == nil {
+		return
+	}
+	if err := c.Throttle.Release(context.WithoutCancel(ctx), decision); err != nil {
+		log.Printf("email-worker: release throttle slot domain=%q: %v", decision.Label, err)
+	}
+}
+
+// deferJob puts a job back for when its domain has budget again. It is not
+// a delivery attempt, so the job keeps its retry count.
+func (c *Consumer) deferJob(ctx context.Context, queueName string, job EmailJob, decision throttle.Decision) error {
+	if err := c.Scheduler.ScheduleContext(ctx, queueName, job, decision.RetryAfter); err != nil {
+		return retryable(fmt.Errorf("defer throttled job: %w", err))
+	}
+	return nil
+}
+
+func (c *Consumer) handleDeliveryError(ctx context.Context, queueName string, job EmailJob, sendErr error) error {
+	var unavailableErr *sender.UnavailableError
+	if errors.As(sendErr, &unavailableErr) {
+		return c.retryUnavailable(ctx, queueName, job, sendErr)
+	}
 	var deliveryErr *sender.DeliveryError
 	if !errors.As(sendErr, &deliveryErr) || deliveryErr.Classification.Type == sender.BounceTypeNone {
 		if markErr := c.Store.MarkFailed(ctx, job.RecordID, sendErr.Error()); markErr != nil {
-			return fmt.Errorf("send email: %w; mark failed: %v", sendErr, markErr)
+			return retryable(fmt.Errorf("send email: %w; mark failed: %v", sendErr, markErr))
 		}
 		return sendErr
 	}
@@ -210,7 +473,7 @@ func (c *Consumer) handleDeliveryError(ctx context.Context, job EmailJob, sendEr
 	switch deliveryErr.Classification.Type {
 	case sender.BounceTypeHard:
 		if err := c.Store.MarkBounced(ctx, job.RecordID, sendErr.Error(), string(sender.BounceTypeHard), smtpCode, job.RetryCount); err != nil {
-			return err
+			return retryable(err)
 		}
 		c.trackVerificationEmailBounced(ctx, job.RecordID, string(sender.BounceTypeHard))
 		if err := c.Store.Blacklist(ctx, job.To, sendErr.Error()); err != nil {
@@ -219,10 +482,10 @@ func (c *Consumer) handleDeliveryError(ctx context.Context, job EmailJob, sendEr
 		return sendErr
 	case sender.BounceTypeSoft:
 		if err := c.Store.MarkBounced(ctx, job.RecordID, sendErr.Error(), string(sender.BounceTypeSoft), smtpCode, job.RetryCount); err != nil {
-			return err
+			return retryable(err)
 		}
 		c.trackVerificationEmailBounced(ctx, job.RecordID, string(sender.BounceTypeSoft))
-		if job.RetryCount >= len(softBounceRetryIntervals) {
+		if job.RetryCount >= len(softBounceRetryIntervals) || c.Scheduler == nil {
 			if err := c.Store.MarkFailed(ctx, job.RecordID, ErrSoftBounceExceeded.Error()); err != nil {
 				return err
 			}
@@ -231,20 +494,41 @@ func (c *Consumer) handleDeliveryError(ctx context.Context, job EmailJob, sendEr
 		delay := softBounceRetryIntervals[job.RetryCount]
 		retryJob := job
 		retryJob.RetryCount++
-		c.Scheduler.AfterFunc(delay, func() {
-			if err := c.Queue.EnqueueContext(context.Background(), c.QueueName, retryJob); err != nil {
-				log.Printf("email-worker: failed to enqueue soft-bounce retry record_id=%q: %v", job.RecordID, err)
-			}
-		})
+		if err := c.Scheduler.ScheduleContext(ctx, queueName, retryJob, delay); err != nil {
+			return retryable(fmt.Errorf("schedule soft-bounce retry: %w", err))
+		}
 		return nil
 	default:
 		if markErr := c.Store.MarkFailed(ctx, job.RecordID, sendErr.Error()); markErr != nil {
-			return fmt.Errorf("send email: %w; mark failed: %v", sendErr, markErr)
+			return retryable(fmt.Errorf("send email: %w; mark failed: %v", sendErr, markErr))
 		}
 		return sendErr
 	}
 }
 
+// retryUnavailable sends a job again shortly after its provider was
+// unavailable. The email did not bounce, so its record is left queued and the
+// job keeps its bounce retry count.
+func (c *Consumer) retryUnavailable(ctx context.Context, queueName string, job EmailJob, sendErr error) error {
+	if c.Scheduler == nil {
+		return retryable(fmt.Errorf("send email: %w", sendErr))
+	}
+	if job.ProviderRetries >= len(providerRetryIntervals) {
+		reason := fmt.Sprintf("%v: %v", ErrProviderRetryExceeded, sendErr)
+		if err := c.Store.MarkFailed(ctx, job.RecordID, reason); err != nil {
+			return retryable(fmt.Errorf("%s; mark failed: %v", reason, err))
+		}
+		return fmt.Errorf("%w: %w", ErrProviderRetryExceeded, sendErr)
+	}
+	delay := providerRetryIntervals[job.ProviderRetries]
+	retryJob := job
+	retryJob.ProviderRetries++
+	if err := c.Scheduler.ScheduleContext(ctx, queueName, retryJob, delay); err != nil {
+		return retryable(fmt.Errorf("schedule provider retry: %w", err))
+	}
+	return nil
+}
+
 func renderVerificationEmailBody(job EmailJob) (string, string, error) {
 	if strings.TrimSpace(job.OTP) == "" {
 		return "", "", ErrEmptyOTP
@@ -278,12 +562,6 @@ func renderVerificationEmailBody(job EmailJob) (string, string, error) {
 	return htmlBody.String(), textBody.String(), nil
 }
 
-func isPayloadDecodeError(err error) bool {
-	var syntaxErr *json.SyntaxError
-	var typeErr *json.UnmarshalTypeError
-	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
-}
-
 func (c *Consumer) trackVerificationEmailSent(ctx context.Context, recordID string) {
 	c.trackRecordEvent(ctx, recordID, "verification_email_sent", func(record *workerstore.AnalyticsRecord) map[string]any {
 		props := map[string]any{}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -17,56 +18,66 @@ import (
 	"anvilkit-auth-template/services/email-worker/internal/monitoring"
 	"anvilkit-auth-template/services/email-worker/internal/sender"
 	workerstore "anvilkit-auth-template/services/email-worker/internal/store"
+	"anvilkit-auth-template/services/email-worker/internal/throttle"
 
 	redismock "github.com/go-redis/redismock/v9"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 type queueResp struct {
-	job EmailJob
-	ok  bool
-	err error
+	job        EmailJob
+	raw        string
+	deliveries int64
+	ok         bool
+	err        error
 }
 
 type fakeQueue struct {
 	mu       sync.Mutex
 	resps    []queueResp
 	timeouts []time.Duration
-	enqueued []EmailJob
+	acked    []string
+	received int
 }
 
-func (q *fakeQueue) DequeueIntoContext(ctx context.Context, queueName string, timeout time.Duration, out any) (bool, error) {
+func (q *fakeQueue) ReceiveContext(ctx context.Context, queueName string, timeout time.Duration) (*commonqueue.Message, error) {
 	q.mu.Lock()
 	q.timeouts = append(q.timeouts, timeout)
 	if len(q.resps) > 0 {
 		resp := q.resps[0]
 		q.resps = q.resps[1:]
+		q.received++
+		id := fmt.Sprintf("%d-0", q.received)
 		q.mu.Unlock()
 		if resp.err != nil {
-			return false, resp.err
+			return nil, resp.err
+		}
+		if !resp.ok {
+			return nil, nil
 		}
-		if resp.ok {
-			job, ok := out.(*EmailJob)
-			if !ok {
-				return false, errors.New("unexpected output type")
+		payload := []byte(resp.raw)
+		if resp.raw == "" {
+			var err error
+			if payload, err = json.Marshal(resp.job); err != nil {
+				return nil, err
 			}
-			*job = resp.job
 		}
-		return resp.ok, nil
+		deliveries := resp.deliveries
+		if deliveries == 0 {
+			deliveries = 1
+		}
+		return &commonqueue.Message{ID: id, Payload: payload, Deliveries: deliveries}, nil
 	}
 	q.mu.Unlock()
 
 	<-ctx.Done()
-	return false, ctx.Err()
+	return nil, ctx.Err()
 }
 
-func (q *fakeQueue) EnqueueContext(_ context.Context, _ string, payload any) error {
+func (q *fakeQueue) AckContext(_ context.Context, _ string, msg *commonqueue.Message) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	job, ok := payload.(EmailJob)
-	if !ok {
-		return errors.New("unexpected payload type")
-	}
-	q.enqueued = append(q.enqueued, job)
+	q.acked = append(q.acked, msg.ID)
 	return nil
 }
 
@@ -95,7 +106,7 @@ func (s *fakeSender) Send(_ context.Context, req sender.Request) (string, error)
 
 type fakeStore struct {
 	mu      sync.Mutex
-	sent    []struct{ recordID, externalID string }
+	sent    []struct{ recordID, externalID, provider string }
 	failed  []struct{ recordID, reason string }
 	bounced []struct {
 		recordID, reason, bounceType string
@@ -109,9 +120,9 @@ type fakeStore struct {
 	onMarkFailed  func()
 }
 
-func (s *fakeStore) MarkSent(_ context.Context, recordID, externalID string) error {
+func (s *fakeStore) MarkSent(_ context.Context, recordID, externalID, provider string) error {
 	s.mu.Lock()
-	s.sent = append(s.sent, struct{ recordID, externalID string }{recordID: recordID, externalID: externalID})
+	s.sent = append(s.sent, struct{ recordID, externalID, provider string }{recordID: recordID, externalID: externalID, provider: provider})
 	cb := s.onMarkSent
 	err := s.markSentErr
 	s.mu.Unlock()
@@ -275,6 +286,41 @@ func TestRun_DefaultTimeoutAndSuccessPath(t *testing.T) {
 	}
 }
 
+func TestRun_RecordsProviderOfRoutedSender(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := &fakeQueue{
+		resps: []queueResp{{
+			ok:  true,
+			job: EmailJob{RecordID: "rec-routed", To: "user@example.com", Subject: "subject", TextBody: "hello"},
+		}},
+	}
+	router, err := sender.NewRouter([]sender.Route{{
+		Name:     "ses",
+		Provider: &fakeSender{resps: []senderResp{{err: &sender.APIError{Provider: "ses", StatusCode: 503}}}},
+	}, {
+		Name:     "sendgrid",
+		Provider: &fakeSender{resps: []senderResp{{externalID: "sg-1"}}},
+	}})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	st := &fakeStore{onMarkSent: cancel}
+
+	c := &Consumer{Queue: q, QueueName: "email:send", Sender: router, Store: st}
+	if err := c.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(st.sent) != 1 {
+		t.Fatalf("sent records=%d want=1", len(st.sent))
+	}
+	if st.sent[0].externalID != "sg-1" || st.sent[0].provider != "sendgrid" {
+		t.Fatalf("unexpected sent record: %+v", st.sent[0])
+	}
+}
+
 func TestRun_TracksVerificationEmailSent(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -748,7 +794,7 @@ func TestRun_DecodeErrorIsDroppedAndLoopContinues(t *testing.T) {
 
 	q := &fakeQueue{
 		resps: []queueResp{
-			{err: &json.SyntaxError{Offset: 1}},
+			{ok: true, raw: "not-json"},
 			{
 				ok: true,
 				job: EmailJob{
@@ -781,6 +827,9 @@ func TestRun_DecodeErrorIsDroppedAndLoopContinues(t *testing.T) {
 	if len(s.requests) != 1 {
 		t.Fatalf("send requests=%d want=1", len(s.requests))
 	}
+	if len(q.acked) != 2 {
+		t.Fatalf("acked=%v want both messages acknowledged", q.acked)
+	}
 }
 
 func containsAll(s string, subs ...string) bool {
@@ -909,15 +958,24 @@ func TestRun_WithRedisQueue_InvalidJSONDroppedThenProcessesNextJob(t *testing.T)
 }
 
 type fakeScheduler struct {
-	delays  []time.Duration
-	autoRun bool
+	queues    []string
+	delays    []time.Duration
+	scheduled []EmailJob
+	err       error
 }
 
-func (s *fakeScheduler) AfterFunc(d time.Duration, f func()) {
-	s.delays = append(s.delays, d)
-	if s.autoRun {
-		f()
+func (s *fakeScheduler) ScheduleContext(_ context.Context, queueName string, payload any, d time.Duration) error {
+	if s.err != nil {
+		return s.err
 	}
+	job, ok := payload.(EmailJob)
+	if !ok {
+		return errors.New("unexpected payload type")
+	}
+	s.queues = append(s.queues, queueName)
+	s.delays = append(s.delays, d)
+	s.scheduled = append(s.scheduled, job)
+	return nil
 }
 
 func TestRun_HardBounceBlacklistsAndNoRetry(t *testing.T) {
@@ -927,8 +985,9 @@ func TestRun_HardBounceBlacklistsAndNoRetry(t *testing.T) {
 	q := &fakeQueue{resps: []queueResp{{ok: true, job: EmailJob{RecordID: "rec-hard", To: "user@example.com", HTMLBody: "<p>h</p>", TextBody: "h"}}}}
 	s := &fakeSender{resps: []senderResp{{err: &sender.DeliveryError{Cause: errors.New("550 mailbox unavailable"), Classification: sender.BounceClassification{Type: sender.BounceTypeHard, SMTPCode: 550}}}}}
 	st := &fakeStore{}
+	sch := &fakeScheduler{}
 
-	c := &Consumer{Queue: q, QueueName: "email:send", Timeout: time.Second, Sender: s, Store: st, Scheduler: &fakeScheduler{autoRun: true}}
+	c := &Consumer{Queue: q, QueueName: "email:send", Timeout: time.Second, Sender: s, Store: st, Scheduler: sch}
 	go func() {
 		time.Sleep(20 * time.Millisecond)
 		cancel()
@@ -941,8 +1000,8 @@ func TestRun_HardBounceBlacklistsAndNoRetry(t *testing.T) {
 	if !st.blacklisted["user@example.com"] {
 		t.Fatalf("expected address blacklisted: %+v", st.blacklisted)
 	}
-	if len(q.enqueued) != 0 {
-		t.Fatalf("unexpected retries enqueued=%d", len(q.enqueued))
+	if len(sch.scheduled) != 0 {
+		t.Fatalf("unexpected retries scheduled=%d", len(sch.scheduled))
 	}
 }
 
@@ -953,7 +1012,7 @@ func TestRun_SoftBounceRetriesWithExpectedIntervals(t *testing.T) {
 	q := &fakeQueue{resps: []queueResp{{ok: true, job: EmailJob{RecordID: "rec-soft", To: "user@example.com", HTMLBody: "<p>h</p>", TextBody: "h"}}}}
 	s := &fakeSender{resps: []senderResp{{err: &sender.DeliveryError{Cause: errors.New("451 mailbox busy"), Classification: sender.BounceClassification{Type: sender.BounceTypeSoft, SMTPCode: 451}}}}}
 	st := &fakeStore{}
-	sch := &fakeScheduler{autoRun: true}
+	sch := &fakeScheduler{}
 
 	c := &Consumer{Queue: q, QueueName: "email:send", Timeout: time.Second, Sender: s, Store: st, Scheduler: sch}
 	go func() {
@@ -968,35 +1027,102 @@ func TestRun_SoftBounceRetriesWithExpectedIntervals(t *testing.T) {
 	if len(sch.delays) != 1 || sch.delays[0] != time.Hour {
 		t.Fatalf("delays=%v want=[1h]", sch.delays)
 	}
-	if len(q.enqueued) != 1 || q.enqueued[0].RetryCount != 1 {
-		t.Fatalf("enqueued=%+v want retry_count=1", q.enqueued)
+	if len(sch.scheduled) != 1 || sch.scheduled[0].RetryCount != 1 {
+		t.Fatalf("scheduled=%+v want retry_count=1", sch.scheduled)
+	}
+	if len(q.acked) != 1 {
+		t.Fatalf("acked=%v want the bounced message acknowledged", q.acked)
 	}
 }
 
 func TestHandleDeliveryError_SoftBounceScheduledReturnsNil(t *testing.T) {
-	q := &fakeQueue{}
-	c := &Consumer{Store: &fakeStore{}, Queue: q, QueueName: "email:send", Scheduler: &fakeScheduler{autoRun: true}}
+	sch := &fakeScheduler{}
+	c := &Consumer{Store: &fakeStore{}, Queue: &fakeQueue{}, QueueName: "email:send", Scheduler: sch}
 	err := c.handleDeliveryError(
 		context.Background(),
+		"email:send",
 		EmailJob{RecordID: "rec-soft-nil", To: "user@example.com", RetryCount: 0},
 		&sender.DeliveryError{Cause: errors.New("451 mailbox busy"), Classification: sender.BounceClassification{Type: sender.BounceTypeSoft, SMTPCode: 451}},
 	)
 	if err != nil {
 		t.Fatalf("err=%v want nil", err)
 	}
-	if len(q.enqueued) != 1 || q.enqueued[0].RetryCount != 1 {
-		t.Fatalf("enqueued=%+v want one retry with retry_count=1", q.enqueued)
+	if len(sch.scheduled) != 1 || sch.scheduled[0].RetryCount != 1 {
+		t.Fatalf("scheduled=%+v want one retry with retry_count=1", sch.scheduled)
+	}
+}
+
+func TestHandleDeliveryError_SoftBounceScheduleFailureIsRetryable(t *testing.T) {
+	c := &Consumer{Store: &fakeStore{}, Queue: &fakeQueue{}, QueueName: "email:send", Scheduler: &fakeScheduler{err: errors.New("redis down")}}
+	err := c.handleDeliveryError(context.Background(), "email:send", EmailJob{RecordID: "rec-soft", To: "user@example.com"}, &sender.DeliveryError{Cause: errors.New("451 mailbox busy"), Classification: sender.BounceClassification{Type: sender.BounceTypeSoft, SMTPCode: 451}})
+	var retryErr retryableError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("err=%v want retryable", err)
 	}
 }
 
 func TestHandleDeliveryError_SoftBounceRetryExhaustedAfterThreeRetries(t *testing.T) {
 	c := &Consumer{Store: &fakeStore{}, Queue: &fakeQueue{}, QueueName: "email:send", Scheduler: &fakeScheduler{}}
-	err := c.handleDeliveryError(context.Background(), EmailJob{RecordID: "rec-soft-exhausted", To: "user@example.com", RetryCount: 3}, &sender.DeliveryError{Cause: errors.New("451 mailbox busy"), Classification: sender.BounceClassification{Type: sender.BounceTypeSoft, SMTPCode: 451}})
+	err := c.handleDeliveryError(context.Background(), "email:send", EmailJob{RecordID: "rec-soft-exhausted", To: "user@example.com", RetryCount: 3}, &sender.DeliveryError{Cause: errors.New("451 mailbox busy"), Classification: sender.BounceClassification{Type: sender.BounceTypeSoft, SMTPCode: 451}})
 	if !errors.Is(err, ErrSoftBounceExceeded) {
 		t.Fatalf("err=%v want=%v", err, ErrSoftBounceExceeded)
 	}
 }
 
+func TestRun_ProviderOutageIsRetriedWithoutBounce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := &fakeQueue{resps: []queueResp{{ok: true, job: EmailJob{RecordID: "rec-outage", To: "user@example.com", HTMLBody: "<p>h</p>", TextBody: "h", RetryCount: 1}}}}
+	outage := &sender.UnavailableError{Cause: &sender.APIError{Provider: "ses", StatusCode: 503}}
+	s := &fakeSender{resps: []senderResp{{err: outage}}}
+	st := &fakeStore{}
+	sch := &fakeScheduler{}
+
+	c := &Consumer{Queue: q, QueueName: "email:send", Timeout: time.Second, Sender: s, Store: st, Scheduler: sch}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_ = c.Run(ctx)
+
+	if len(st.bounced) != 0 || len(st.failed) != 0 {
+		t.Fatalf("bounced=%+v failed=%+v want neither", st.bounced, st.failed)
+	}
+	if len(sch.delays) != 1 || sch.delays[0] != time.Minute {
+		t.Fatalf("delays=%v want=[1m]", sch.delays)
+	}
+	if len(sch.scheduled) != 1 || sch.scheduled[0].ProviderRetries != 1 || sch.scheduled[0].RetryCount != 1 {
+		t.Fatalf("scheduled=%+v want provider_retries=1 retry_count=1", sch.scheduled)
+	}
+	if len(q.acked) != 1 {
+		t.Fatalf("acked=%v want the rescheduled message acknowledged", q.acked)
+	}
+}
+
+func TestHandleDeliveryError_ProviderOutage(t *testing.T) {
+	outage := &sender.UnavailableError{Cause: errors.New("connection refused")}
+	job := EmailJob{RecordID: "rec-outage", To: "user@example.com"}
+
+	// Without a scheduler the message is left for the queue to deliver again.
+	c := &Consumer{Store: &fakeStore{}, Queue: &fakeQueue{}, QueueName: "email:send"}
+	var retryErr retryableError
+	if err := c.handleDeliveryError(context.Background(), "email:send", job, outage); !errors.As(err, &retryErr) {
+		t.Fatalf("err=%v want retryable", err)
+	}
+
+	st := &fakeStore{}
+	c = &Consumer{Store: st, Queue: &fakeQueue{}, QueueName: "email:send", Scheduler: &fakeScheduler{}}
+	job.ProviderRetries = len(providerRetryIntervals)
+	err := c.handleDeliveryError(context.Background(), "email:send", job, outage)
+	if !errors.Is(err, ErrProviderRetryExceeded) || !errors.Is(err, outage) {
+		t.Fatalf("err=%v want=%v", err, ErrProviderRetryExceeded)
+	}
+	if len(st.failed) != 1 || len(st.bounced) != 0 {
+		t.Fatalf("failed=%+v bounced=%+v want failed only", st.failed, st.bounced)
+	}
+}
+
 func TestRun_BlacklistedRecipientIsNotSent(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -1014,3 +1140,421 @@ func TestRun_BlacklistedRecipientIsNotSent(t *testing.T) {
 		t.Fatalf("failed=%+v", st.failed)
 	}
 }
+
+func TestRun_WithStreamQueue_AcknowledgesHandledJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	redisClient, redisMock := redismock.NewClientMock()
+	q, err := commonqueue.NewStream(redisClient, commonqueue.StreamOptions{Group: "email-worker", Consumer: "worker-1", VisibilityTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("new stream queue: %v", err)
+	}
+
+	raw := `{"record_id":"rec-stream-1","to":"user@example.com","html_body":"<p>hello</p>","text_body":"hello"}`
+	redisMock.ExpectXGroupCreateMkStream("email:send", "email-worker", "0").SetVal("OK")
+	redisMock.ExpectXAutoClaim(&goredis.XAutoClaimArgs{
+		Stream: "email:send", Group: "email-worker", Consumer: "worker-1",
+		MinIdle: time.Minute, Start: "0-0", Count: 1,
+	}).SetVal(nil, "0-0")
+	redisMock.ExpectXReadGroup(&goredis.XReadGroupArgs{
+		Group: "email-worker", Consumer: "worker-1",
+		Streams: []string{"email:send", ">"}, Count: 1, Block: 5 * time.Second,
+	}).SetVal([]goredis.XStream{{
+		Stream:   "email:send",
+		Messages: []goredis.XMessage{{ID: "1-0", Values: map[string]any{"payload": raw}}},
+	}})
+	redisMock.ExpectXAck("email:send", "email-worker", "1-0").SetVal(1)
+	redisMock.ExpectXDel("email:send", "1-0").SetVal(1)
+
+	s := &fakeSender{resps: []senderResp{{externalID: "esp-stream-1"}}}
+	st := &fakeStore{onMarkSent: cancel}
+	c := &Consumer{Queue: q, QueueName: "email:send", Timeout: 5 * time.Second, Sender: s, Store: st}
+
+	if err := c.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if err := redisMock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+	if len(st.sent) != 1 || st.sent[0].recordID != "rec-stream-1" {
+		t.Fatalf("sent=%+v", st.sent)
+	}
+}
+
+func TestHandleMessage_StoreFailureLeavesMessageUnacknowledged(t *testing.T) {
+	q := &fakeQueue{}
+	c := &Consumer{
+		Queue:         q,
+		QueueName:     "email:send",
+		Sender:        &fakeSender{resps: []senderResp{{externalID: "esp-1"}}},
+		Store:         &fakeStore{markSentErr: errors.New("db down")},
+		MaxDeliveries: defaultMaxDeliveries,
+	}
+	msg := &commonqueue.Message{ID: "1-0", Payload: []byte(`{"record_id":"rec-1","to":"user@example.com","html_body":"<p>h</p>","text_body":"h"}`), Deliveries: 1}
+
+	c.handleMessage(context.Background(), "email:send", msg)
+	if len(q.acked) != 0 {
+		t.Fatalf("acked=%v want none", q.acked)
+	}
+}
+
+func TestHandleMessage_PermanentFailureIsAcknowledged(t *testing.T) {
+	q := &fakeQueue{}
+	st := &fakeStore{}
+	c := &Consumer{
+		Queue:         q,
+		QueueName:     "email:send",
+		Sender:        &fakeSender{resps: []senderResp{{err: errors.New("provider rejected")}}},
+		Store:         st,
+		MaxDeliveries: defaultMaxDeliveries,
+	}
+	msg := &commonqueue.Message{ID: "1-0", Payload: []byte(`{"record_id":"rec-1","to":"user@example.com","html_body":"<p>h</p>","text_body":"h"}`), Deliveries: 1}
+
+	c.handleMessage(context.Background(), "email:send", msg)
+	if len(st.failed) != 1 {
+		t.Fatalf("failed=%+v", st.failed)
+	}
+	if len(q.acked) != 1 || q.acked[0] != "1-0" {
+		t.Fatalf("acked=%v want [1-0]", q.acked)
+	}
+}
+
+func TestRun_ExceededDeliveriesMarksFailedWithoutSending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := &fakeQueue{resps: []queueResp{{ok: true, deliveries: 4, job: EmailJob{RecordID: "rec-poison", To: "user@example.com", HTMLBody: "<p>h</p>", TextBody: "h"}}}}
+	s := &fakeSender{}
+	st := &fakeStore{onMarkFailed: cancel}
+	c := &Consumer{Queue: q, QueueName: "email:send", Timeout: time.Second, Sender: s, Store: st, MaxDeliveries: 3}
+	_ = c.Run(ctx)
+
+	if len(s.requests) != 0 {
+		t.Fatalf("send requests=%d want=0", len(s.requests))
+	}
+	if len(st.failed) != 1 || st.failed[0].recordID != "rec-poison" || st.failed[0].reason != ErrDeliveriesExceeded.Error() {
+		t.Fatalf("failed=%+v", st.failed)
+	}
+	if len(q.acked) != 1 {
+		t.Fatalf("acked=%v want=1", q.acked)
+	}
+}
+
+type deadLetterEntry struct {
+	payload    string
+	reason     string
+	deliveries int64
+}
+
+type fakeDeadLetters struct {
+	entries []deadLetterEntry
+	err     error
+}
+
+func (f *fakeDeadLetters) AddContext(_ context.Context, queueName string, payload []byte, reason string, deliveries int64) error {
+	if f.err != nil {
+		return f.err
+	}
+	if queueName != "email:send" {
+		return errors.New("unexpected queue")
+	}
+	f.entries = append(f.entries, deadLetterEntry{payload: string(payload), reason: reason, deliveries: deliveries})
+	return nil
+}
+
+func TestHandleMessage_DeadLettersInvalidPayload(t *testing.T) {
+	q := &fakeQueue{}
+	dlq := &fakeDeadLetters{}
+	c := &Consumer{Queue: q, QueueName: "email:send", Sender: &fakeSender{}, Store: &fakeStore{}, MaxDeliveries: defaultMaxDeliveries, DeadLetters: dlq}
+
+	c.handleMessage(context.Background(), "email:send", &commonqueue.Message{ID: "1-0", Payload: []byte("not-json"), Deliveries: 1})
+	if len(dlq.entries) != 1 || dlq.entries[0].payload != "not-json" || !strings.HasPrefix(dlq.entries[0].reason, "invalid_payload: ") {
+		t.Fatalf("dead letters=%+v", dlq.entries)
+	}
+	if len(q.acked) != 1 {
+		t.Fatalf("acked=%v want=1", q.acked)
+	}
+}
+
+func TestHandleMessage_DeadLettersExhaustedJobs(t *testing.T) {
+	q := &fakeQueue{}
+	dlq := &fakeDeadLetters{}
+	st := &fakeStore{}
+	c := &Consumer{
+		Queue:         q,
+		QueueName:     "email:send",
+		Sender:        &fakeSender{resps: []senderResp{{err: &sender.DeliveryError{Cause: errors.New("451 mailbox busy"), Classification: sender.BounceClassification{Type: sender.BounceTypeSoft, SMTPCode: 451}}}}},
+		Store:         st,
+		Scheduler:     &fakeScheduler{},
+		MaxDeliveries: 3,
+		DeadLetters:   dlq,
+	}
+
+	poison := `{"record_id":"rec-poison","to":"user@example.com","html_body":"<p>h</p>","text_body":"h"}`
+	c.handleMessage(context.Background(), "email:send", &commonqueue.Message{ID: "1-0", Payload: []byte(poison), Deliveries: 4})
+	bounced := `{"record_id":"rec-soft","to":"user@example.com","html_body":"<p>h</p>","text_body":"h","retry_count":3}`
+	c.handleMessage(context.Background(), "email:send", &commonqueue.Message{ID: "2-0", Payload: []byte(bounced), Deliveries: 1})
+
+	want := []deadLetterEntry{
+		{payload: poison, reason: ErrDeliveriesExceeded.Error(), deliveries: 4},
+		{payload: bounced, reason: ErrSoftBounceExceeded.Error(), deliveries: 1},
+	}
+	if len(dlq.entries) != 2 || dlq.entries[0] != want[0] || dlq.entries[1] != want[1] {
+		t.Fatalf("dead letters=%+v want=%+v", dlq.entries, want)
+	}
+	if len(q.acked) != 2 {
+		t.Fatalf("acked=%v want=2", q.acked)
+	}
+}
+
+func TestHandleMessage_DeadLetterFailureLeavesMessageUnacknowledged(t *testing.T) {
+	q := &fakeQueue{}
+	c := &Consumer{Queue: q, QueueName: "email:send", Sender: &fakeSender{}, Store: &fakeStore{}, MaxDeliveries: defaultMaxDeliveries, DeadLetters: &fakeDeadLetters{err: errors.New("redis down")}}
+
+	c.handleMessage(context.Background(), "email:send", &commonqueue.Message{ID: "1-0", Payload: []byte("not-json"), Deliveries: 1})
+	if len(q.acked) != 0 {
+		t.Fatalf("acked=%v want none", q.acked)
+	}
+}
+
+// concurrentSender holds the first sends until limit of them run at once, so
+// tests can observe the pool at full concurrency.
+type concurrentSender struct {
+	mu        sync.Mutex
+	limit     int
+	active    int
+	maxActive int
+	sendsByTo map[string]int
+	full      chan struct{}
+}
+
+func newConcurrentSender(limit int) *concurrentSender {
+	return &concurrentSender{limit: limit, sendsByTo: map[string]int{}, full: make(chan struct{})}
+}
+
+func (s *concurrentSender) Send(_ context.Context, req sender.Request) (string, error) {
+	s.mu.Lock()
+	s.active++
+	s.sendsByTo[req.To]++
+	if s.active > s.maxActive {
+		s.maxActive = s.active
+	}
+	if s.active == s.limit {
+		select {
+		case <-s.full:
+		default:
+			close(s.full)
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.full:
+	case <-time.After(time.Second):
+	}
+
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	return "esp-" + req.To, nil
+}
+
+func TestRun_ConcurrentWorkersHandleEachJobOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const jobs = 20
+	q := &fakeQueue{}
+	for i := 0; i < jobs; i++ {
+		q.resps = append(q.resps, queueResp{ok: true, job: EmailJob{RecordID: fmt.Sprintf("rec-%d", i), To: fmt.Sprintf("user%d@example.com", i), HTMLBody: "<p>h</p>", TextBody: "h"}})
+	}
+	s := newConcurrentSender(4)
+	st := &fakeStore{}
+	st.onMarkSent = func() {
+		st.mu.Lock()
+		done := len(st.sent) == jobs
+		st.mu.Unlock()
+		if done {
+			cancel()
+		}
+	}
+	metrics, err := monitoring.NewMetrics()
+	if err != nil {
+		t.Fatalf("new metrics: %v", err)
+	}
+	c := &Consumer{Queue: q, QueueName: "email:send", Sender: s, Store: st, Metrics: metrics, Concurrency: 4}
+
+	if err := c.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if s.maxActive != 4 {
+		t.Fatalf("max concurrent sends=%d want=4", s.maxActive)
+	}
+	for i := 0; i < jobs; i++ {
+		if n := s.sendsByTo[fmt.Sprintf("user%d@example.com", i)]; n != 1 {
+			t.Fatalf("job %d sent %d times", i, n)
+		}
+	}
+	acked := map[string]bool{}
+	for _, id := range q.acked {
+		if acked[id] {
+			t.Fatalf("message %s acknowledged twice", id)
+		}
+		acked[id] = true
+	}
+	if len(acked) != jobs || len(st.sent) != jobs {
+		t.Fatalf("acked=%d sent=%d want=%d", len(acked), len(st.sent), jobs)
+	}
+}
+
+// blockingSender blocks each send until release is closed or ctx is
+// cancelled.
+type blockingSender struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSender) Send(ctx context.Context, _ sender.Request) (string, error) {
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+		return "esp-1", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestRun_DrainsInFlightJobsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &fakeQueue{resps: []queueResp{
+		{ok: true, job: EmailJob{RecordID: "rec-1", To: "a@example.com", HTMLBody: "<p>h</p>", TextBody: "h"}},
+		{ok: true, job: EmailJob{RecordID: "rec-2", To: "b@example.com", HTMLBody: "<p>h</p>", TextBody: "h"}},
+	}}
+	s := &blockingSender{started: make(chan struct{}, 2), release: make(chan struct{})}
+	st := &fakeStore{}
+	c := &Consumer{Queue: q, QueueName: "email:send", Sender: s, Store: st, Concurrency: 2, DrainTimeout: 5 * time.Second}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+	<-s.started
+	<-s.started
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("run returned before in-flight jobs finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(s.release)
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(st.sent) != 2 || len(q.acked) != 2 {
+		t.Fatalf("sent=%v acked=%v want both jobs finished", st.sent, q.acked)
+	}
+}
+
+func TestRun_CancelsInFlightJobsAfterDrainTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &fakeQueue{resps: []queueResp{
+		{ok: true, job: EmailJob{RecordID: "rec-1", To: "a@example.com", HTMLBody: "<p>h</p>", TextBody: "h"}},
+	}}
+	s := &blockingSender{started: make(chan struct{}, 1), release: make(chan struct{})}
+	c := &Consumer{Queue: q, QueueName: "email:send", Sender: s, Store: &fakeStore{}, DrainTimeout: 20 * time.Millisecond}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+	<-s.started
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not stop after the drain timeout")
+	}
+	if len(q.acked) != 0 {
+		t.Fatalf("acked=%v want the cancelled job left for redelivery", q.acked)
+	}
+}
+
+type fakeThrottle struct {
+	decisions []throttle.Decision
+	err       error
+	acquired  []string
+	released  []throttle.Decision
+}
+
+func (f *fakeThrottle) Acquire(_ context.Context, to string) (throttle.Decision, error) {
+	f.acquired = append(f.acquired, to)
+	if f.err != nil {
+		return throttle.Decision{}, f.err
+	}
+	d := f.decisions[0]
+	f.decisions = f.decisions[1:]
+	return d, nil
+}
+
+func (f *fakeThrottle) Release(_ context.Context, d throttle.Decision) error {
+	f.released = append(f.released, d)
+	return nil
+}
+
+func TestHandleMessage_ThrottledJobIsDeferredNotFailed(t *testing.T) {
+	q := &fakeQueue{}
+	s := &fakeSender{}
+	st := &fakeStore{}
+	sched := &fakeScheduler{}
+	th := &fakeThrottle{decisions: []throttle.Decision{
+		{Reason: throttle.ReasonRate, RetryAfter: 1500 * time.Millisecond, Label: "gmail.com"},
+		{Allowed: true, Label: "gmail.com"},
+	}}
+	metrics, err := monitoring.NewMetrics()
+	if err != nil {
+		t.Fatalf("new metrics: %v", err)
+	}
+	c := &Consumer{Queue: q, QueueName: "email:send", Sender: s, Store: st, Scheduler: sched, Throttle: th, Metrics: metrics, MaxDeliveries: defaultMaxDeliveries}
+
+	payload := `{"record_id":"rec-1","to":"user@gmail.com","html_body":"<p>h</p>","text_body":"h","retry_count":1}`
+	c.handleMessage(context.Background(), "email:send", &commonqueue.Message{ID: "1-0", Payload: []byte(payload), Deliveries: 1})
+	if len(s.requests) != 0 || len(st.failed) != 0 {
+		t.Fatalf("throttled job was sent=%d or failed=%v", len(s.requests), st.failed)
+	}
+	if len(sched.delays) != 1 || sched.delays[0] != 1500*time.Millisecond || sched.scheduled[0].RetryCount != 1 {
+		t.Fatalf("deferred delays=%v jobs=%+v", sched.delays, sched.scheduled)
+	}
+	if len(th.released) != 0 {
+		t.Fatalf("released=%v want none for a denied send", th.released)
+	}
+
+	c.handleMessage(context.Background(), "email:send", &commonqueue.Message{ID: "2-0", Payload: []byte(payload), Deliveries: 1})
+	if len(s.requests) != 1 || len(st.sent) != 1 || len(th.released) != 1 {
+		t.Fatalf("sent=%d marked=%d released=%d", len(s.requests), len(st.sent), len(th.released))
+	}
+	if len(q.acked) != 2 {
+		t.Fatalf("acked=%v want=2", q.acked)
+	}
+}
+
+func TestHandleMessage_ThrottleFailureLeavesMessageUnacknowledged(t *testing.T) {
+	q := &fakeQueue{}
+	s := &fakeSender{}
+	c := &Consumer{Queue: q, QueueName: "email:send", Sender: s, Store: &fakeStore{}, Scheduler: &fakeScheduler{}, Throttle: &fakeThrottle{err: errors.New("redis down")}, MaxDeliveries: defaultMaxDeliveries}
+
+	payload := `{"record_id":"rec-1","to":"user@gmail.com","html_body":"<p>h</p>","text_body":"h"}`
+	c.handleMessage(context.Background(), "email:send", &commonqueue.Message{ID: "1-0", Payload: []byte(payload), Deliveries: 1})
+	if len(s.requests) != 0 || len(q.acked) != 0 {
+		t.Fatalf("sent=%d acked=%v want neither", len(s.requests), q.acked)
+	}
+}
+
+func TestRun_ThrottleRequiresScheduler(t *testing.T) {
+	c := &Consumer{Queue: &fakeQueue{}, QueueName: "email:send", Sender: &fakeSender{}, Store: &fakeStore{}, Throttle: &fakeThrottle{}}
+	if err := c.Run(context.Background()); !errors.Is(err, ErrNilScheduler) {
+		t.Fatalf("err=%v want=%v", err, ErrNilScheduler)
+	}
+}
@@ -0,0 +1,94 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+)
+
+// idleQueueWait bounds how long a worker blocks on one queue while every
+// queue is empty, and so how long a job arriving on another queue may wait.
+const idleQueueWait = time.Second
+
+// PriorityQueue is a queue consumed by priority. Weight is its share of jobs
+// with weighted consumption; it defaults to 1.
+type PriorityQueue struct {
+	Name   string
+	Weight int
+}
+
+// priorityQueues returns Queues with default weights, or QueueName alone.
+func (c *Consumer) priorityQueues() ([]PriorityQueue, error) {
+	if len(c.Queues) == 0 {
+		if strings.TrimSpace(c.QueueName) == "" {
+			return nil, ErrEmptyQueue
+		}
+		return []PriorityQueue{{Name: c.QueueName, Weight: 1}}, nil
+	}
+	queues := make([]PriorityQueue, 0, len(c.Queues))
+	for _, q := range c.Queues {
+		if strings.TrimSpace(q.Name) == "" {
+			return nil, ErrEmptyQueue
+		}
+		if q.Weight <= 0 {
+			q.Weight = 1
+		}
+		queues = append(queues, q)
+	}
+	return queues, nil
+}
+
+// next receives the next message and the queue it came from. With several
+// queues it polls them without blocking in priority (or weighted) order and,
+// when all are empty, blocks briefly on the first.
+func (c *Consumer) next(ctx context.Context) (string, *queue.Message, error) {
+	if len(c.receiveFrom) == 1 {
+		name := c.receiveFrom[0].Name
+		msg, err := c.Queue.ReceiveContext(ctx, name, c.Timeout)
+		return name, msg, err
+	}
+
+	order := c.receiveFrom
+	if c.Weighted {
+		order = weightedOrder(c.receiveFrom, rand.IntN)
+	}
+	for _, q := range order {
+		msg, err := c.Queue.ReceiveContext(ctx, q.Name, 0)
+		if err != nil {
+			return q.Name, nil, fmt.Errorf("queue %q: %w", q.Name, err)
+		}
+		if msg != nil {
+			return q.Name, msg, nil
+		}
+	}
+	name := order[0].Name
+	msg, err := c.Queue.ReceiveContext(ctx, name, min(c.Timeout, idleQueueWait))
+	return name, msg, err
+}
+
+// weightedOrder shuffles queues so that each comes first with probability
+// proportional to its weight, and likewise among those left.
+func weightedOrder(queues []PriorityQueue, intN func(int) int) []PriorityQueue {
+	rest := append([]PriorityQueue(nil), queues...)
+	total := 0
+	for _, q := range rest {
+		total += q.Weight
+	}
+	order := make([]PriorityQueue, 0, len(rest))
+	for len(rest) > 0 {
+		n := intN(total)
+		i := 0
+		for n >= rest[i].Weight {
+			n -= rest[i].Weight
+			i++
+		}
+		order = append(order, rest[i])
+		total -= rest[i].Weight
+		rest = append(rest[:i], rest[i+1:]...)
+	}
+	return order
+}
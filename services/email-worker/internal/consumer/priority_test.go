@@ -0,0 +1,165 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	commonqueue "anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/services/email-worker/internal/sender"
+)
+
+// multiQueue holds jobs per queue name. Like the real backends it returns
+// immediately for a zero timeout and otherwise waits for up to timeout.
+type multiQueue struct {
+	mu       sync.Mutex
+	jobs     map[string][]EmailJob
+	received []string
+	waits    []time.Duration
+}
+
+func (q *multiQueue) ReceiveContext(ctx context.Context, queueName string, timeout time.Duration) (*commonqueue.Message, error) {
+	q.mu.Lock()
+	if jobs := q.jobs[queueName]; len(jobs) > 0 {
+		q.jobs[queueName] = jobs[1:]
+		q.received = append(q.received, queueName)
+		q.mu.Unlock()
+		payload, err := json.Marshal(jobs[0])
+		if err != nil {
+			return nil, err
+		}
+		return &commonqueue.Message{Payload: payload, Deliveries: 1}, nil
+	}
+	if timeout > 0 {
+		q.waits = append(q.waits, timeout)
+	}
+	q.mu.Unlock()
+
+	if timeout <= 0 {
+		return nil, nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(timeout):
+		return nil, nil
+	}
+}
+
+func (q *multiQueue) AckContext(context.Context, string, *commonqueue.Message) error {
+	return nil
+}
+
+func TestRun_StrictPriorityDrainsHigherQueuesFirst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := &multiQueue{jobs: map[string][]EmailJob{
+		"email:send:bulk":         {{RecordID: "bulk-1", To: "a@example.com", HTMLBody: "x"}, {RecordID: "bulk-2", To: "b@example.com", HTMLBody: "x"}},
+		"email:send:notification": {{RecordID: "note-1", To: "c@example.com", HTMLBody: "x"}},
+		"email:send":              {{RecordID: "otp-1", To: "d@example.com", HTMLBody: "x"}, {RecordID: "otp-2", To: "e@example.com", HTMLBody: "x"}},
+	}}
+	sent := 0
+	st := &fakeStore{onMarkSent: func() {
+		if sent++; sent == 5 {
+			cancel()
+		}
+	}}
+	c := &Consumer{
+		Queue: q,
+		Queues: []PriorityQueue{
+			{Name: "email:send"},
+			{Name: "email:send:notification"},
+			{Name: "email:send:bulk"},
+		},
+		Timeout: 5 * time.Second,
+		Sender:  &fakeSender{},
+		Store:   st,
+	}
+
+	if err := c.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	want := []string{"email:send", "email:send", "email:send:notification", "email:send:bulk", "email:send:bulk"}
+	if !reflect.DeepEqual(q.received, want) {
+		t.Fatalf("received=%v want=%v", q.received, want)
+	}
+	var sentIDs []string
+	for _, rec := range st.sent {
+		sentIDs = append(sentIDs, rec.recordID)
+	}
+	if !reflect.DeepEqual(sentIDs, []string{"otp-1", "otp-2", "note-1", "bulk-1", "bulk-2"}) {
+		t.Fatalf("sent=%v", sentIDs)
+	}
+}
+
+func TestRun_IdleWorkerBlocksOnHighestPriorityBriefly(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	q := &multiQueue{jobs: map[string][]EmailJob{}}
+	c := &Consumer{
+		Queue:   q,
+		Queues:  []PriorityQueue{{Name: "email:send"}, {Name: "email:send:bulk"}},
+		Timeout: 5 * time.Second,
+		Sender:  &fakeSender{},
+		Store:   &fakeStore{},
+	}
+	if err := c.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(q.waits) == 0 || q.waits[0] != idleQueueWait {
+		t.Fatalf("waits=%v want first=%s", q.waits, idleQueueWait)
+	}
+}
+
+func TestRun_RejectsUnnamedPriorityQueue(t *testing.T) {
+	c := &Consumer{Queue: &multiQueue{}, Queues: []PriorityQueue{{Name: "email:send"}, {Name: " "}}, Sender: &fakeSender{}, Store: &fakeStore{}}
+	if err := c.Run(context.Background()); !errors.Is(err, ErrEmptyQueue) {
+		t.Fatalf("err=%v want=%v", err, ErrEmptyQueue)
+	}
+}
+
+func TestHandleMessage_SoftBounceRetriesOnSourceQueue(t *testing.T) {
+	sch := &fakeScheduler{}
+	s := &fakeSender{resps: []senderResp{{err: &sender.DeliveryError{Cause: errors.New("451 mailbox busy"), Classification: sender.BounceClassification{Type: sender.BounceTypeSoft, SMTPCode: 451}}}}}
+	c := &Consumer{Queue: &multiQueue{}, QueueName: "email:send", Sender: s, Store: &fakeStore{}, Scheduler: sch, MaxDeliveries: defaultMaxDeliveries}
+
+	payload, err := json.Marshal(EmailJob{RecordID: "digest-1", To: "user@example.com", HTMLBody: "x"})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	c.handleMessage(context.Background(), "email:send:bulk", &commonqueue.Message{Payload: payload, Deliveries: 1})
+
+	if !reflect.DeepEqual(sch.queues, []string{"email:send:bulk"}) {
+		t.Fatalf("scheduled on %v want [email:send:bulk]", sch.queues)
+	}
+}
+
+func TestWeightedOrder_FavoursHeavierQueues(t *testing.T) {
+	queues := []PriorityQueue{{Name: "high", Weight: 8}, {Name: "mid", Weight: 3}, {Name: "low", Weight: 1}}
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	const draws = 12000
+	first := map[string]int{}
+	for i := 0; i < draws; i++ {
+		order := weightedOrder(queues, rng.IntN)
+		if len(order) != len(queues) {
+			t.Fatalf("order=%v", order)
+		}
+		first[order[0].Name]++
+	}
+
+	for _, q := range queues {
+		want := draws * q.Weight / 12
+		if got := first[q.Name]; got < want*9/10 || got > want*11/10 {
+			t.Fatalf("queue %s first %d times want about %d", q.Name, got, want)
+		}
+	}
+}
@@ -10,9 +10,11 @@ type QueueLengthReader interface {
 	QueueLengthContext(ctx context.Context, queueName string) (int64, error)
 }
 
+// QueueBacklogCollector polls the backlog of QueueNames, such as the queue
+// of every job priority.
 type QueueBacklogCollector struct {
 	Queue        QueueLengthReader
-	QueueName    string
+	QueueNames   []string
 	PollInterval time.Duration
 	Metrics      *Metrics
 	Logger       *log.Logger
@@ -41,14 +43,116 @@ func (c *QueueBacklogCollector) Run(ctx context.Context) error {
 	}
 }
 
+// ScheduledCountReader reports how many delayed jobs a queue has.
+type ScheduledCountReader interface {
+	ScheduledCountContext(ctx context.Context, queueName string) (int64, error)
+}
+
+// ScheduledJobsCollector polls the number of delayed jobs of QueueNames.
+type ScheduledJobsCollector struct {
+	Delayed      ScheduledCountReader
+	QueueNames   []string
+	PollInterval time.Duration
+	Metrics      *Metrics
+	Logger       *log.Logger
+}
+
+func (c *ScheduledJobsCollector) Run(ctx context.Context) error {
+	if c == nil || c.Delayed == nil || c.Metrics == nil {
+		return nil
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = 15 * time.Second
+	}
+
+	c.poll(ctx)
+
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.poll(ctx)
+		}
+	}
+}
+
+func (c *ScheduledJobsCollector) poll(ctx context.Context) {
+	for _, name := range c.QueueNames {
+		count, err := c.Delayed.ScheduledCountContext(ctx, name)
+		if err != nil {
+			if c.Logger != nil {
+				c.Logger.Printf("email-worker metrics: failed to poll scheduled jobs for %q: %v", name, err)
+			}
+			continue
+		}
+		c.Metrics.SetScheduledJobs(name, count)
+	}
+}
+
+// DeadLetterCountReader reports how many dead letters a queue has.
+type DeadLetterCountReader interface {
+	LengthContext(ctx context.Context, queueName string) (int64, error)
+}
+
+// DeadLetterCollector polls the dead-letter queue size of QueueNames.
+type DeadLetterCollector struct {
+	DeadLetters  DeadLetterCountReader
+	QueueNames   []string
+	PollInterval time.Duration
+	Metrics      *Metrics
+	Logger       *log.Logger
+}
+
+func (c *DeadLetterCollector) Run(ctx context.Context) error {
+	if c == nil || c.DeadLetters == nil || c.Metrics == nil {
+		return nil
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = 15 * time.Second
+	}
+
+	c.poll(ctx)
+
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.poll(ctx)
+		}
+	}
+}
+
+func (c *DeadLetterCollector) poll(ctx context.Context) {
+	for _, name := range c.QueueNames {
+		count, err := c.DeadLetters.LengthContext(ctx, name)
+		if err != nil {
+			if c.Logger != nil {
+				c.Logger.Printf("email-worker metrics: failed to poll dead letters for %q: %v", name, err)
+			}
+			continue
+		}
+		c.Metrics.SetDeadLetters(name, count)
+	}
+}
+
 func (c *QueueBacklogCollector) poll(ctx context.Context) {
-	backlog, err := c.Queue.QueueLengthContext(ctx, c.QueueName)
-	if err != nil {
-		c.Metrics.IncQueueBacklogPollFailure(c.QueueName)
-		if c.Logger != nil {
-			c.Logger.Printf("email-worker metrics: failed to poll queue backlog for %q: %v", c.QueueName, err)
+	for _, name := range c.QueueNames {
+		backlog, err := c.Queue.QueueLengthContext(ctx, name)
+		if err != nil {
+			c.Metrics.IncQueueBacklogPollFailure(name)
+			if c.Logger != nil {
+				c.Logger.Printf("email-worker metrics: failed to poll queue backlog for %q: %v", name, err)
+			}
+			continue
 		}
-		return
+		c.Metrics.SetQueueBacklog(name, backlog)
 	}
-	c.Metrics.SetQueueBacklog(c.QueueName, backlog)
 }
@@ -2,6 +2,7 @@ package monitoring
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,6 +21,18 @@ type Metrics struct {
 	sendLatency   *prometheus.HistogramVec
 	queueBacklog  *prometheus.GaugeVec
 	queuePollFail *prometheus.CounterVec
+	webhookSends  *prometheus.CounterVec
+	webhookTime   *prometheus.HistogramVec
+	scheduledJobs *prometheus.GaugeVec
+	promotedJobs  *prometheus.CounterVec
+	deadLetters   *prometheus.GaugeVec
+	workers       prometheus.Gauge
+	busyWorkers   prometheus.Gauge
+	workerJobs    *prometheus.CounterVec
+	workerBusy    *prometheus.CounterVec
+	domainSends   *prometheus.CounterVec
+	providerSends *prometheus.CounterVec
+	providerOpen  *prometheus.GaugeVec
 }
 
 func NewMetrics() (*Metrics, error) {
@@ -55,6 +68,89 @@ func NewMetrics() (*Metrics, error) {
 			},
 			[]string{"queue"},
 		),
+		webhookSends: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "email_worker_webhook_deliveries_total",
+				Help: "Total number of tenant webhook delivery attempts partitioned by outcome (succeeded, retrying, failed).",
+			},
+			[]string{"outcome"},
+		),
+		webhookTime: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "email_worker_webhook_delivery_latency_seconds",
+				Help:    "Latency of tenant webhook delivery attempts in seconds.",
+				Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+			},
+			[]string{"result"},
+		),
+		scheduledJobs: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "email_worker_scheduled_jobs",
+				Help: "Current number of delayed jobs (soft-bounce and webhook retries) waiting to become due.",
+			},
+			[]string{"queue"},
+		),
+		promotedJobs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "email_worker_scheduled_jobs_promoted_total",
+				Help: "Total number of delayed jobs moved to their work queue once due.",
+			},
+			[]string{"queue"},
+		),
+		deadLetters: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "email_worker_dead_letters",
+				Help: "Current number of jobs in the dead-letter queue waiting to be inspected, replayed or purged.",
+			},
+			[]string{"queue"},
+		),
+		workers: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "email_worker_workers",
+				Help: "Number of email jobs this worker may handle concurrently.",
+			},
+		),
+		busyWorkers: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "email_worker_workers_busy",
+				Help: "Current number of email jobs being handled.",
+			},
+		),
+		workerJobs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "email_worker_worker_jobs_total",
+				Help: "Total number of email jobs handled, partitioned by pool worker.",
+			},
+			[]string{"worker"},
+		),
+		workerBusy: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "email_worker_worker_busy_seconds_total",
+				Help: "Total time each pool worker spent handling email jobs in seconds.",
+			},
+			[]string{"worker"},
+		),
+		domainSends: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "email_worker_domain_throttle_decisions_total",
+				Help: "Total number of throttle checks for rate-limited recipient domains, partitioned by domain and decision (allowed, rate_limited, concurrency_limited).",
+			},
+			[]string{"domain", "decision"},
+		),
+		providerSends: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "email_worker_provider_requests_total",
+				Help: "Total number of send requests to each email provider, partitioned by result (success, unavailable, rejected).",
+			},
+			[]string{"provider", "result"},
+		),
+		providerOpen: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "email_worker_provider_circuit_open",
+				Help: "Whether an email provider's circuit breaker is open (1) and the provider is being skipped.",
+			},
+			[]string{"provider"},
+		),
 	}
 
 	if err := registry.Register(collectors.NewGoCollector()); err != nil {
@@ -68,6 +164,18 @@ func NewMetrics() (*Metrics, error) {
 		metrics.sendLatency,
 		metrics.queueBacklog,
 		metrics.queuePollFail,
+		metrics.webhookSends,
+		metrics.webhookTime,
+		metrics.scheduledJobs,
+		metrics.promotedJobs,
+		metrics.deadLetters,
+		metrics.workers,
+		metrics.busyWorkers,
+		metrics.workerJobs,
+		metrics.workerBusy,
+		metrics.domainSends,
+		metrics.providerSends,
+		metrics.providerOpen,
 	} {
 		if err := registry.Register(collector); err != nil {
 			return nil, err
@@ -97,6 +205,68 @@ func (m *Metrics) IncQueueBacklogPollFailure(queueName string) {
 	m.queuePollFail.WithLabelValues(queueName).Inc()
 }
 
+func (m *Metrics) SetScheduledJobs(queueName string, count int64) {
+	m.scheduledJobs.WithLabelValues(queueName).Set(float64(count))
+}
+
+func (m *Metrics) AddPromotedJobs(queueName string, n int) {
+	m.promotedJobs.WithLabelValues(queueName).Add(float64(n))
+}
+
+func (m *Metrics) SetDeadLetters(queueName string, count int64) {
+	m.deadLetters.WithLabelValues(queueName).Set(float64(count))
+}
+
+func (m *Metrics) SetWorkers(n int) {
+	m.workers.Set(float64(n))
+}
+
+// StartWorkerJob marks a pool worker busy until FinishWorkerJob.
+func (m *Metrics) StartWorkerJob() {
+	m.busyWorkers.Inc()
+}
+
+// FinishWorkerJob records a job handled by pool worker in duration.
+func (m *Metrics) FinishWorkerJob(worker int, duration time.Duration) {
+	label := strconv.Itoa(worker)
+	m.busyWorkers.Dec()
+	m.workerJobs.WithLabelValues(label).Inc()
+	m.workerBusy.WithLabelValues(label).Add(duration.Seconds())
+}
+
+// ObserveDomainThrottle records a throttle check for domain; reason is empty
+// when the send was allowed.
+func (m *Metrics) ObserveDomainThrottle(domain, reason string) {
+	if reason == "" {
+		reason = "allowed"
+	}
+	m.domainSends.WithLabelValues(domain, reason).Inc()
+}
+
+// ObserveProviderResult records a send request to an email provider.
+func (m *Metrics) ObserveProviderResult(provider, result string) {
+	m.providerSends.WithLabelValues(provider, result).Inc()
+}
+
+func (m *Metrics) SetProviderCircuitOpen(provider string, open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	m.providerOpen.WithLabelValues(provider).Set(value)
+}
+
+// ObserveWebhookDelivery records a webhook delivery attempt. outcome is the
+// delivery's status afterwards: succeeded, retrying or failed.
+func (m *Metrics) ObserveWebhookDelivery(outcome string, duration time.Duration) {
+	result := resultFailure
+	if outcome == "succeeded" {
+		result = resultSuccess
+	}
+	m.webhookSends.WithLabelValues(outcome).Inc()
+	m.webhookTime.WithLabelValues(result).Observe(duration.Seconds())
+}
+
 func (m *Metrics) observeSend(result string, duration time.Duration) {
 	m.sendAttempts.WithLabelValues(result).Inc()
 	m.sendLatency.WithLabelValues(result).Observe(duration.Seconds())
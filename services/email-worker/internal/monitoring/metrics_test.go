@@ -39,6 +39,7 @@ func TestMetricsHandlerExportsRequiredEmailMetrics(t *testing.T) {
 	metrics.ObserveSendSuccess(120 * time.Millisecond)
 	metrics.ObserveSendFailure(450 * time.Millisecond)
 	metrics.SetQueueBacklog("email:send", 42)
+	metrics.ObserveWebhookDelivery("retrying", 80*time.Millisecond)
 
 	server := httptest.NewServer(metrics.Handler())
 	defer server.Close()
@@ -62,6 +63,8 @@ func TestMetricsHandlerExportsRequiredEmailMetrics(t *testing.T) {
 		"email_worker_send_attempts_total",
 		"email_worker_send_latency_seconds",
 		"email_worker_queue_backlog",
+		`email_worker_webhook_deliveries_total{outcome="retrying"} 1`,
+		"email_worker_webhook_delivery_latency_seconds",
 	} {
 		if !strings.Contains(text, metricName) {
 			t.Fatalf("metrics body missing %q\n%s", metricName, text)
@@ -76,9 +79,9 @@ func TestQueueBacklogCollectorPollsAndUpdatesGauge(t *testing.T) {
 	}
 
 	collector := &QueueBacklogCollector{
-		Queue:     fakeQueueLengthReader{backlog: 7},
-		QueueName: "email:send",
-		Metrics:   metrics,
+		Queue:      fakeQueueLengthReader{backlog: 7},
+		QueueNames: []string{"email:send"},
+		Metrics:    metrics,
 	}
 
 	collector.poll(context.Background())
@@ -101,6 +104,54 @@ func TestQueueBacklogCollectorPollsAndUpdatesGauge(t *testing.T) {
 	}
 }
 
+type fakeQueueLengths map[string]int64
+
+func (f fakeQueueLengths) QueueLengthContext(_ context.Context, queueName string) (int64, error) {
+	backlog, ok := f[queueName]
+	if !ok {
+		return 0, errors.New("redis unavailable")
+	}
+	return backlog, nil
+}
+
+func TestQueueBacklogCollectorPollsEveryQueue(t *testing.T) {
+	metrics, err := NewMetrics()
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	collector := &QueueBacklogCollector{
+		Queue:      fakeQueueLengths{"email:send": 2, "email:send:bulk": 900},
+		QueueNames: []string{"email:send", "email:send:notification", "email:send:bulk"},
+		Metrics:    metrics,
+	}
+
+	collector.poll(context.Background())
+
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer closeBody(t, resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	for _, want := range []string{
+		`email_worker_queue_backlog{queue="email:send"} 2`,
+		`email_worker_queue_backlog{queue="email:send:bulk"} 900`,
+		`email_worker_queue_backlog_poll_failures_total{queue="email:send:notification"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("metrics body missing %q\n%s", want, string(body))
+		}
+	}
+}
+
 func TestQueueBacklogCollectorRecordsPollFailure(t *testing.T) {
 	metrics, err := NewMetrics()
 	if err != nil {
@@ -108,9 +159,9 @@ func TestQueueBacklogCollectorRecordsPollFailure(t *testing.T) {
 	}
 
 	collector := &QueueBacklogCollector{
-		Queue:     fakeQueueLengthReader{err: errors.New("redis unavailable")},
-		QueueName: "email:send",
-		Metrics:   metrics,
+		Queue:      fakeQueueLengthReader{err: errors.New("redis unavailable")},
+		QueueNames: []string{"email:send"},
+		Metrics:    metrics,
 	}
 
 	collector.poll(context.Background())
@@ -132,3 +183,174 @@ func TestQueueBacklogCollectorRecordsPollFailure(t *testing.T) {
 		t.Fatalf("metrics body missing poll failure counter:\n%s", string(body))
 	}
 }
+
+type fakeScheduledCountReader map[string]int64
+
+func (f fakeScheduledCountReader) ScheduledCountContext(_ context.Context, queueName string) (int64, error) {
+	count, ok := f[queueName]
+	if !ok {
+		return 0, errors.New("redis unavailable")
+	}
+	return count, nil
+}
+
+func TestScheduledJobsCollectorPollsAndUpdatesGauge(t *testing.T) {
+	metrics, err := NewMetrics()
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	collector := &ScheduledJobsCollector{
+		Delayed:    fakeScheduledCountReader{"email:send": 3, "webhook:deliver": 1},
+		QueueNames: []string{"email:send", "webhook:deliver", "missing"},
+		Metrics:    metrics,
+	}
+	collector.poll(context.Background())
+	metrics.AddPromotedJobs("email:send", 2)
+
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer closeBody(t, resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	for _, want := range []string{
+		`email_worker_scheduled_jobs{queue="email:send"} 3`,
+		`email_worker_scheduled_jobs{queue="webhook:deliver"} 1`,
+		`email_worker_scheduled_jobs_promoted_total{queue="email:send"} 2`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("metrics body missing %q:\n%s", want, string(body))
+		}
+	}
+	if strings.Contains(string(body), `queue="missing"`) {
+		t.Fatalf("failed poll exported a value:\n%s", string(body))
+	}
+}
+
+type fakeDeadLetterCountReader map[string]int64
+
+func (f fakeDeadLetterCountReader) LengthContext(_ context.Context, queueName string) (int64, error) {
+	count, ok := f[queueName]
+	if !ok {
+		return 0, errors.New("redis unavailable")
+	}
+	return count, nil
+}
+
+func TestDeadLetterCollectorPollsAndUpdatesGauge(t *testing.T) {
+	metrics, err := NewMetrics()
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	collector := &DeadLetterCollector{
+		DeadLetters: fakeDeadLetterCountReader{"email:send": 4},
+		QueueNames:  []string{"email:send", "missing"},
+		Metrics:     metrics,
+	}
+	collector.poll(context.Background())
+
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer closeBody(t, resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !strings.Contains(string(body), `email_worker_dead_letters{queue="email:send"} 4`) {
+		t.Fatalf("metrics body missing dead letter gauge:\n%s", string(body))
+	}
+	if strings.Contains(string(body), `email_worker_dead_letters{queue="missing"}`) {
+		t.Fatalf("failed poll exported a value:\n%s", string(body))
+	}
+}
+
+func TestMetricsExportsWorkerPoolAndThrottleMetrics(t *testing.T) {
+	metrics, err := NewMetrics()
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	metrics.SetWorkers(4)
+	metrics.StartWorkerJob()
+	metrics.StartWorkerJob()
+	metrics.FinishWorkerJob(1, 1500*time.Millisecond)
+	metrics.ObserveDomainThrottle("gmail.com", "")
+	metrics.ObserveDomainThrottle("gmail.com", "rate_limited")
+
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer closeBody(t, resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	for _, want := range []string{
+		"email_worker_workers 4",
+		"email_worker_workers_busy 1",
+		`email_worker_worker_jobs_total{worker="1"} 1`,
+		`email_worker_worker_busy_seconds_total{worker="1"} 1.5`,
+		`email_worker_domain_throttle_decisions_total{decision="allowed",domain="gmail.com"} 1`,
+		`email_worker_domain_throttle_decisions_total{decision="rate_limited",domain="gmail.com"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("metrics body missing %q:\n%s", want, string(body))
+		}
+	}
+}
+
+func TestMetricsExportsProviderHealth(t *testing.T) {
+	metrics, err := NewMetrics()
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	metrics.ObserveProviderResult("ses", "unavailable")
+	metrics.ObserveProviderResult("sendgrid", "success")
+	metrics.SetProviderCircuitOpen("ses", true)
+	metrics.SetProviderCircuitOpen("sendgrid", false)
+
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer closeBody(t, resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	for _, want := range []string{
+		`email_worker_provider_requests_total{provider="ses",result="unavailable"} 1`,
+		`email_worker_provider_requests_total{provider="sendgrid",result="success"} 1`,
+		`email_worker_provider_circuit_open{provider="ses"} 1`,
+		`email_worker_provider_circuit_open{provider="sendgrid"} 0`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("metrics body missing %q:\n%s", want, string(body))
+		}
+	}
+}
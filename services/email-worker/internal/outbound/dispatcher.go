@@ -0,0 +1,301 @@
+// Package outbound delivers tenant webhooks queued by webhooks.Publisher.
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
+	"anvilkit-auth-template/services/email-worker/internal/monitoring"
+	workerstore "anvilkit-auth-template/services/email-worker/internal/store"
+)
+
+var (
+	ErrNilQueue         = errors.New("nil_queue")
+	ErrNilStore         = errors.New("nil_store")
+	ErrNilScheduler     = errors.New("nil_scheduler")
+	ErrEmptyQueue       = errors.New("empty_queue_name")
+	ErrBlockedAddress   = errors.New("webhook_address_not_allowed")
+	ErrEndpointDisabled = errors.New("endpoint_disabled")
+)
+
+const (
+	defaultMaxAttempts   = 8
+	defaultRetryBase     = 30 * time.Second
+	defaultMaxRetryDelay = 6 * time.Hour
+	outcomeRetrying      = "retrying"
+	maxErrorBodyBytes    = 512
+)
+
+type Queue interface {
+	ReceiveContext(ctx context.Context, queueName string, timeout time.Duration) (*queue.Message, error)
+	AckContext(ctx context.Context, queueName string, msg *queue.Message) error
+}
+
+type Store interface {
+	LoadWebhookDelivery(ctx context.Context, deliveryID string) (*workerstore.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, a workerstore.WebhookAttempt) (int, error)
+}
+
+// Scheduler persists jobs to be enqueued after a delay, such as
+// queue.DelayedQueue.
+type Scheduler interface {
+	ScheduleContext(ctx context.Context, queueName string, payload any, delay time.Duration) error
+}
+
+// DeadLetterWriter keeps undecodable jobs together with the reason, such as
+// queue.DeadLetterQueue.
+type DeadLetterWriter interface {
+	AddContext(ctx context.Context, queueName string, payload []byte, reason string, deliveries int64) error
+}
+
+// Dispatcher POSTs queued deliveries to tenant endpoints. A delivery succeeds
+// on any 2xx response; otherwise it is retried with exponential backoff
+// (RetryBase doubling per attempt, capped at MaxRetryDelay) until MaxAttempts
+// attempts have failed.
+type Dispatcher struct {
+	Queue         Queue
+	QueueName     string
+	Timeout       time.Duration
+	Store         Store
+	Client        *http.Client
+	MaxAttempts   int
+	RetryBase     time.Duration
+	MaxRetryDelay time.Duration
+	Scheduler     Scheduler
+	Metrics       *monitoring.Metrics
+	// DeadLetters receives undecodable payloads; they are dropped when it is
+	// nil. Failed deliveries stay in the store, where they can be redelivered.
+	DeadLetters DeadLetterWriter
+}
+
+func (d *Dispatcher) Run(ctx context.Context) error {
+	if d.Queue == nil {
+		return ErrNilQueue
+	}
+	if d.Store == nil {
+		return ErrNilStore
+	}
+	if d.Scheduler == nil {
+		return ErrNilScheduler
+	}
+	if strings.TrimSpace(d.QueueName) == "" {
+		return ErrEmptyQueue
+	}
+	if d.Timeout <= 0 {
+		d.Timeout = 5 * time.Second
+	}
+	if d.Client == nil {
+		d.Client = NewHTTPClient(10*time.Second, false)
+	}
+	if d.MaxAttempts <= 0 {
+		d.MaxAttempts = defaultMaxAttempts
+	}
+	if d.RetryBase <= 0 {
+		d.RetryBase = defaultRetryBase
+	}
+	if d.MaxRetryDelay <= 0 {
+		d.MaxRetryDelay = defaultMaxRetryDelay
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil
+		}
+		msg, err := d.Queue.ReceiveContext(ctx, d.QueueName, d.Timeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("receive webhook job: %w", err)
+		}
+		if msg == nil {
+			continue
+		}
+		d.handleMessage(ctx, msg)
+	}
+}
+
+// handleMessage delivers msg and acknowledges it unless the store failed or
+// the worker is shutting down; a redelivered job is skipped once its delivery
+// is settled.
+func (d *Dispatcher) handleMessage(ctx context.Context, msg *queue.Message) {
+	var job webhooks.Job
+	if err := json.Unmarshal(msg.Payload, &job); err != nil {
+		if !d.deadLetter(ctx, msg, fmt.Sprintf("invalid_payload: %v", err)) {
+			return
+		}
+	} else if err := d.deliver(ctx, job); err != nil {
+		log.Printf("email-worker webhooks: delivery_id=%q: %v", job.DeliveryID, err)
+		var retryErr retryableError
+		if errors.As(err, &retryErr) || ctx.Err() != nil {
+			return
+		}
+	}
+	if err := d.Queue.AckContext(context.WithoutCancel(ctx), d.QueueName, msg); err != nil {
+		log.Printf("email-worker webhooks: ack message id=%q failed: %v", msg.ID, err)
+	}
+}
+
+// deadLetter moves msg to the dead-letter queue and reports whether it may
+// be acknowledged; without a dead-letter queue it is dropped.
+func (d *Dispatcher) deadLetter(ctx context.Context, msg *queue.Message, reason string) bool {
+	if d.DeadLetters == nil {
+		log.Printf("email-worker webhooks: dropped message id=%q from queue=%q: %s", msg.ID, d.QueueName, reason)
+		return true
+	}
+	if err := d.DeadLetters.AddContext(context.WithoutCancel(ctx), d.QueueName, msg.Payload, reason, msg.Deliveries); err != nil {
+		log.Printf("email-worker webhooks: dead-letter message id=%q from queue=%q failed: %v", msg.ID, d.QueueName, err)
+		return false
+	}
+	log.Printf("email-worker webhooks: dead-lettered message id=%q from queue=%q: %s", msg.ID, d.QueueName, reason)
+	return true
+}
+
+// retryableError marks store and scheduling failures, after which the job is
+// left unacknowledged.
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string { return e.err.Error() }
+
+func (e retryableError) Unwrap() error { return e.err }
+
+func (d *Dispatcher) deliver(ctx context.Context, job webhooks.Job) error {
+	if strings.TrimSpace(job.DeliveryID) == "" {
+		return errors.New("empty delivery_id")
+	}
+	delivery, err := d.Store.LoadWebhookDelivery(ctx, job.DeliveryID)
+	if errors.Is(err, workerstore.ErrWebhookDeliveryNotFound) {
+		return nil
+	}
+	if err != nil {
+		return retryableError{err: err}
+	}
+	if delivery.Status != webhooks.StatusPending {
+		// Already settled by an earlier copy of this job.
+		return nil
+	}
+	if !delivery.EndpointEnabled {
+		if _, err = d.Store.RecordWebhookAttempt(ctx, workerstore.WebhookAttempt{DeliveryID: delivery.ID, Status: webhooks.StatusFailed, Error: ErrEndpointDisabled.Error()}); err != nil {
+			return retryableError{err: err}
+		}
+		return nil
+	}
+
+	startedAt := time.Now()
+	statusCode, sendErr := d.post(ctx, delivery)
+	attempt := workerstore.WebhookAttempt{DeliveryID: delivery.ID, StatusCode: statusCode, Duration: time.Since(startedAt), Status: webhooks.StatusSucceeded}
+	outcome := webhooks.StatusSucceeded
+	var retryIn time.Duration
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+		if delivery.Attempts+1 >= d.MaxAttempts || errors.Is(sendErr, ErrBlockedAddress) {
+			attempt.Status, outcome = webhooks.StatusFailed, webhooks.StatusFailed
+		} else {
+			retryIn = d.backoff(delivery.Attempts + 1)
+			next := time.Now().Add(retryIn).UTC()
+			attempt.Status, attempt.NextAttemptAt, outcome = webhooks.StatusPending, &next, outcomeRetrying
+		}
+	}
+	if d.Metrics != nil {
+		d.Metrics.ObserveWebhookDelivery(outcome, attempt.Duration)
+	}
+	if _, err = d.Store.RecordWebhookAttempt(ctx, attempt); err != nil {
+		return retryableError{err: err}
+	}
+	if outcome == outcomeRetrying {
+		if err := d.Scheduler.ScheduleContext(ctx, d.QueueName, job, retryIn); err != nil {
+			return retryableError{err: fmt.Errorf("schedule retry: %w", err)}
+		}
+	}
+	return sendErr
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *workerstore.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.EndpointURL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "anvilkit-webhooks/1")
+	req.Header.Set(webhooks.EventHeader, delivery.EventType)
+	req.Header.Set(webhooks.DeliveryHeader, delivery.ID)
+	req.Header.Set(webhooks.SignatureHeader, "sha256="+webhooks.Sign(delivery.EndpointSecret, delivery.Payload))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodyBytes))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint responded %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return res.StatusCode, nil
+}
+
+// backoff returns the wait after the given failed attempt (1-based).
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.RetryBase
+	for i := 1; i < attempt && delay < d.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxRetryDelay {
+		return d.MaxRetryDelay
+	}
+	return delay
+}
+
+// NewHTTPClient returns the client deliveries are sent with. Redirects are
+// not followed, and unless allowPrivate is set, connections to loopback,
+// private, link-local and other non-public addresses are refused so tenants
+// cannot point webhooks at internal services.
+func NewHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addr.Unmap()) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
@@ -0,0 +1,263 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"anvilkit-auth-template/modules/common-go/pkg/queue"
+	"anvilkit-auth-template/modules/common-go/pkg/webhooks"
+	workerstore "anvilkit-auth-template/services/email-worker/internal/store"
+)
+
+type fakeQueue struct {
+	mu    sync.Mutex
+	acked []string
+}
+
+func (q *fakeQueue) ReceiveContext(ctx context.Context, _ string, _ time.Duration) (*queue.Message, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (q *fakeQueue) AckContext(_ context.Context, _ string, msg *queue.Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.acked = append(q.acked, msg.ID)
+	return nil
+}
+
+type fakeStore struct {
+	delivery *workerstore.WebhookDelivery
+	attempts []workerstore.WebhookAttempt
+	loadErr  error
+}
+
+func (s *fakeStore) LoadWebhookDelivery(_ context.Context, id string) (*workerstore.WebhookDelivery, error) {
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	if s.delivery == nil || s.delivery.ID != id {
+		return nil, workerstore.ErrWebhookDeliveryNotFound
+	}
+	d := *s.delivery
+	return &d, nil
+}
+
+func (s *fakeStore) RecordWebhookAttempt(_ context.Context, a workerstore.WebhookAttempt) (int, error) {
+	s.attempts = append(s.attempts, a)
+	s.delivery.Attempts++
+	s.delivery.Status = a.Status
+	return s.delivery.Attempts, nil
+}
+
+type fakeScheduler struct {
+	delays    []time.Duration
+	scheduled []webhooks.Job
+}
+
+func (s *fakeScheduler) ScheduleContext(_ context.Context, queueName string, payload any, d time.Duration) error {
+	job, ok := payload.(webhooks.Job)
+	if !ok || queueName != webhooks.DefaultQueueName {
+		return errors.New("unexpected retry")
+	}
+	s.delays = append(s.delays, d)
+	s.scheduled = append(s.scheduled, job)
+	return nil
+}
+
+func newTestDispatcher(st *fakeStore, client *http.Client) (*Dispatcher, *fakeQueue, *fakeScheduler) {
+	q := &fakeQueue{}
+	sched := &fakeScheduler{}
+	return &Dispatcher{
+		Queue:         q,
+		QueueName:     webhooks.DefaultQueueName,
+		Store:         st,
+		Client:        client,
+		MaxAttempts:   3,
+		RetryBase:     30 * time.Second,
+		MaxRetryDelay: time.Hour,
+		Scheduler:     sched,
+	}, q, sched
+}
+
+func testDelivery(url string) *workerstore.WebhookDelivery {
+	return &workerstore.WebhookDelivery{
+		ID:              "dlv-1",
+		EventType:       webhooks.EventMemberAdded,
+		Status:          webhooks.StatusPending,
+		Payload:         []byte(`{"id": "evt-1", "type": "member.added"}`),
+		EndpointURL:     url,
+		EndpointSecret:  "whsec_test",
+		EndpointEnabled: true,
+	}
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	st := &fakeStore{delivery: testDelivery(srv.URL)}
+	d, _, sched := newTestDispatcher(st, srv.Client())
+	if err := d.deliver(context.Background(), webhooks.Job{DeliveryID: "dlv-1"}); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if string(gotBody) != string(st.delivery.Payload) {
+		t.Fatalf("body=%s", gotBody)
+	}
+	if sig := got.Header.Get(webhooks.SignatureHeader); sig != "sha256="+webhooks.Sign("whsec_test", gotBody) {
+		t.Fatalf("signature=%q", sig)
+	}
+	if got.Header.Get(webhooks.EventHeader) != webhooks.EventMemberAdded || got.Header.Get(webhooks.DeliveryHeader) != "dlv-1" {
+		t.Fatalf("headers=%v", got.Header)
+	}
+	if len(st.attempts) != 1 || st.attempts[0].Status != webhooks.StatusSucceeded || st.attempts[0].StatusCode != http.StatusAccepted {
+		t.Fatalf("attempts=%+v", st.attempts)
+	}
+	if len(sched.delays) != 0 {
+		t.Fatalf("scheduled a retry after success: %v", sched.delays)
+	}
+
+	// A copy of the job for a settled delivery is ignored.
+	if err := d.deliver(context.Background(), webhooks.Job{DeliveryID: "dlv-1"}); err != nil || len(st.attempts) != 1 {
+		t.Fatalf("redeliver settled: err=%v attempts=%d", err, len(st.attempts))
+	}
+}
+
+func TestDeliverRetriesWithBackoffUntilMaxAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	st := &fakeStore{delivery: testDelivery(srv.URL)}
+	d, _, sched := newTestDispatcher(st, srv.Client())
+	for i := 0; i < 3; i++ {
+		if err := d.deliver(context.Background(), webhooks.Job{DeliveryID: "dlv-1"}); err == nil {
+			t.Fatalf("attempt %d: deliver succeeded", i+1)
+		}
+	}
+
+	wantStatus := []string{webhooks.StatusPending, webhooks.StatusPending, webhooks.StatusFailed}
+	for i, a := range st.attempts {
+		if a.Status != wantStatus[i] || a.StatusCode != http.StatusServiceUnavailable || a.Error == "" {
+			t.Fatalf("attempt %d=%+v", i+1, a)
+		}
+		if (a.NextAttemptAt != nil) != (a.Status == webhooks.StatusPending) {
+			t.Fatalf("attempt %d next_attempt_at=%v", i+1, a.NextAttemptAt)
+		}
+	}
+	if len(sched.delays) != 2 || sched.delays[0] != 30*time.Second || sched.delays[1] != time.Minute {
+		t.Fatalf("retry delays=%v want [30s 1m]", sched.delays)
+	}
+	if sched.scheduled[0].DeliveryID != "dlv-1" {
+		t.Fatalf("scheduled=%v", sched.scheduled)
+	}
+}
+
+func TestDeliverRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("request reached a loopback endpoint")
+	}))
+	defer srv.Close()
+
+	st := &fakeStore{delivery: testDelivery(srv.URL)}
+	d, _, sched := newTestDispatcher(st, NewHTTPClient(time.Second, false))
+	if err := d.deliver(context.Background(), webhooks.Job{DeliveryID: "dlv-1"}); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("err=%v want ErrBlockedAddress", err)
+	}
+	if len(st.attempts) != 1 || st.attempts[0].Status != webhooks.StatusFailed || len(sched.delays) != 0 {
+		t.Fatalf("attempts=%+v delays=%v", st.attempts, sched.delays)
+	}
+}
+
+func TestDeliverFailsDisabledEndpoint(t *testing.T) {
+	st := &fakeStore{delivery: testDelivery("https://hooks.example.com")}
+	st.delivery.EndpointEnabled = false
+	d, _, _ := newTestDispatcher(st, nil)
+	if err := d.deliver(context.Background(), webhooks.Job{DeliveryID: "dlv-1"}); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if len(st.attempts) != 1 || st.attempts[0].Status != webhooks.StatusFailed || st.attempts[0].Error != ErrEndpointDisabled.Error() {
+		t.Fatalf("attempts=%+v", st.attempts)
+	}
+}
+
+func TestHandleMessageAcksUnlessStoreFails(t *testing.T) {
+	st := &fakeStore{delivery: testDelivery("https://hooks.example.com")}
+	st.delivery.Status = webhooks.StatusSucceeded
+	d, q, _ := newTestDispatcher(st, nil)
+
+	d.handleMessage(context.Background(), &queue.Message{ID: "1-0", Payload: []byte(`{"delivery_id":"dlv-1"}`)})
+	d.handleMessage(context.Background(), &queue.Message{ID: "2-0", Payload: []byte(`not-json`)})
+	st.loadErr = errors.New("db down")
+	d.handleMessage(context.Background(), &queue.Message{ID: "3-0", Payload: []byte(`{"delivery_id":"dlv-1"}`)})
+
+	if len(q.acked) != 2 || q.acked[0] != "1-0" || q.acked[1] != "2-0" {
+		t.Fatalf("acked=%v want [1-0 2-0]", q.acked)
+	}
+}
+
+type fakeDeadLetters struct {
+	payloads []string
+	err      error
+}
+
+func (f *fakeDeadLetters) AddContext(_ context.Context, _ string, payload []byte, _ string, _ int64) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.payloads = append(f.payloads, string(payload))
+	return nil
+}
+
+func TestHandleMessageDeadLettersInvalidPayload(t *testing.T) {
+	d, q, _ := newTestDispatcher(&fakeStore{}, nil)
+	dlq := &fakeDeadLetters{}
+	d.DeadLetters = dlq
+
+	d.handleMessage(context.Background(), &queue.Message{ID: "1-0", Payload: []byte(`not-json`)})
+	dlq.err = errors.New("redis down")
+	d.handleMessage(context.Background(), &queue.Message{ID: "2-0", Payload: []byte(`still-not-json`)})
+
+	if len(dlq.payloads) != 1 || dlq.payloads[0] != "not-json" {
+		t.Fatalf("dead letters=%v", dlq.payloads)
+	}
+	if len(q.acked) != 1 || q.acked[0] != "1-0" {
+		t.Fatalf("acked=%v want [1-0]", q.acked)
+	}
+}
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	d := &Dispatcher{RetryBase: 30 * time.Second, MaxRetryDelay: 5 * time.Minute}
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		if got := d.backoff(i + 1); got != w {
+			t.Fatalf("backoff(%d)=%s want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34": true, "2606:4700::1111": true,
+		"127.0.0.1": false, "10.1.2.3": false, "192.168.0.1": false, "169.254.169.254": false,
+		"100.64.0.1": false, "0.0.0.0": false, "::1": false, "fd00::1": false, "fe80::1": false,
+	} {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Fatalf("publicAddr(%s)=%v want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxResponseBytes caps how much of a provider response is read.
+const maxResponseBytes = 1 << 20
+
+// APIError is a response from an email provider API that did not accept the
+// message.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	// Code is the provider's own error code, if it sends one.
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	msg := strings.TrimSpace(e.Message)
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("%s api status=%d code=%s: %s", e.Provider, e.StatusCode, e.Code, msg)
+	}
+	return fmt.Sprintf("%s api status=%d: %s", e.Provider, e.StatusCode, msg)
+}
+
+// apiResponse is a 2xx response of a provider API.
+type apiResponse struct {
+	Header http.Header
+	Body   []byte
+}
+
+// doAPI sends req and returns the response when its status is 2xx. Other
+// statuses are passed with the body to parseErr.
+func doAPI(client *http.Client, req *http.Request, parseErr func(status int, body []byte) *APIError) (*apiResponse, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, parseErr(resp.StatusCode, body)
+	}
+	return &apiResponse{Header: resp.Header, Body: body}, nil
+}
+
+// apiDeliveryError classifies a failed API call. Rate limits, server errors
+// and network errors are an UnavailableError: the provider, not the
+// recipient, failed and the email is sent again shortly. hard marks errors
+// where the provider refused the recipient, a hard bounce. Any other request
+// error is returned as is and is permanent. An error caused by ctx ending is
+// returned as is, so the job is not failed during shutdown.
+func apiDeliveryError(ctx context.Context, err error, hard func(*APIError) bool) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	apiErr, ok := err.(*APIError)
+	switch {
+	case !ok:
+		return &UnavailableError{Cause: err}
+	case hard != nil && hard(apiErr):
+		return &DeliveryError{Cause: apiErr, Classification: BounceClassification{Type: BounceTypeHard}}
+	case apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500:
+		return &UnavailableError{Cause: apiErr}
+	}
+	return apiErr
+}
+
+// messageIDOrRandom returns id without surrounding angle brackets. The
+// message was accepted, so a missing id gets a random one rather than
+// failing the job; webhooks for it cannot be correlated.
+func messageIDOrRandom(id string) string {
+	id = strings.Trim(strings.TrimSpace(id), "<>")
+	if id == "" {
+		return uuid.NewString()
+	}
+	return id
+}
+
+func trimBaseURL(raw, def string) string {
+	base := strings.TrimSpace(raw)
+	if base == "" {
+		base = def
+	}
+	return strings.TrimRight(base, "/")
+}
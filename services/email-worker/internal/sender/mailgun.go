@@ -0,0 +1,91 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultMailgunBaseURL = "https://api.mailgun.net"
+
+// MailgunConfig configures the Mailgun Messages API.
+type MailgunConfig struct {
+	APIKey string
+	// Domain is the sending domain registered with Mailgun.
+	Domain string
+	// BaseURL overrides https://api.mailgun.net, e.g. with
+	// https://api.eu.mailgun.net for EU domains.
+	BaseURL string
+}
+
+// MailgunProvider sends through POST /v3/<domain>/messages. The message ID
+// is returned without angle brackets, as Mailgun webhooks report it.
+type MailgunProvider struct {
+	cfg    MailgunConfig
+	from   Address
+	client *http.Client
+}
+
+func NewMailgun(cfg MailgunConfig, from Address, client *http.Client) (*MailgunProvider, error) {
+	if strings.TrimSpace(cfg.APIKey) == "" || strings.TrimSpace(cfg.Domain) == "" {
+		return nil, errors.Join(ErrMissingCredentials, errors.New("mailgun api key and domain"))
+	}
+	cfg.Domain = strings.TrimSpace(cfg.Domain)
+	cfg.BaseURL = trimBaseURL(cfg.BaseURL, defaultMailgunBaseURL)
+	return &MailgunProvider{cfg: cfg, from: from, client: client}, nil
+}
+
+func (p *MailgunProvider) Send(ctx context.Context, req Request) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(req.To) == "" {
+		return "", ErrEmptyRecipient
+	}
+
+	form := url.Values{}
+	form.Set("from", p.from.String())
+	form.Set("to", strings.TrimSpace(req.To))
+	form.Set("subject", req.Subject)
+	if req.TextBody != "" {
+		form.Set("text", req.TextBody)
+	}
+	if req.HTMLBody != "" {
+		form.Set("html", req.HTMLBody)
+	}
+
+	endpoint := p.cfg.BaseURL + "/v3/" + url.PathEscape(p.cfg.Domain) + "/messages"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	httpReq.SetBasicAuth("api", p.cfg.APIKey)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := doAPI(p.client, httpReq, parseMailgunError)
+	if err != nil {
+		return "", apiDeliveryError(ctx, err, nil)
+	}
+	var out struct {
+		ID string `json:"id"`
+	}
+	// A body that does not parse still means the message was accepted.
+	_ = json.Unmarshal(resp.Body, &out)
+	return messageIDOrRandom(out.ID), nil
+}
+
+func parseMailgunError(status int, body []byte) *APIError {
+	apiErr := &APIError{Provider: ProviderMailgun, StatusCode: status}
+	var resp struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &resp) == nil {
+		apiErr.Message = resp.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
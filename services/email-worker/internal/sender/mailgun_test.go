@@ -0,0 +1,63 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMailgun_SendsFormAndReturnsMessageID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/mg.example.com/messages" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "api" || pass != "mg-key" {
+			t.Errorf("basic auth=%q %q %v", user, pass, ok)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		if r.PostForm.Get("from") != `"Anvilkit Auth" <noreply@example.com>` || r.PostForm.Get("to") != "user@example.com" ||
+			r.PostForm.Get("subject") != "Verify" || r.PostForm.Get("text") != "Hi" || r.PostForm.Get("html") != "<p>Hi</p>" {
+			t.Errorf("form=%v", r.PostForm)
+		}
+		_, _ = w.Write([]byte(`{"id":"<20260101120000.1.ABC@mg.example.com>","message":"Queued. Thank you."}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewMailgun(MailgunConfig{APIKey: "mg-key", Domain: "mg.example.com", BaseURL: srv.URL}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	id, err := p.Send(context.Background(), Request{To: "user@example.com", Subject: "Verify", HTMLBody: "<p>Hi</p>", TextBody: "Hi"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if id != "20260101120000.1.ABC@mg.example.com" {
+		t.Fatalf("id=%q", id)
+	}
+}
+
+func TestMailgun_ServerErrorIsUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"message":"service unavailable"}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewMailgun(MailgunConfig{APIKey: "mg-key", Domain: "mg.example.com", BaseURL: srv.URL}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = p.Send(context.Background(), Request{To: "user@example.com", Subject: "Verify", TextBody: "Hi"})
+	var unavailableErr *UnavailableError
+	if !errors.As(err, &unavailableErr) {
+		t.Fatalf("err=%v want provider unavailable", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "service unavailable" {
+		t.Fatalf("err=%v", err)
+	}
+}
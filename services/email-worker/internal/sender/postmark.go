@@ -0,0 +1,117 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPostmarkBaseURL       = "https://api.postmarkapp.com"
+	defaultPostmarkMessageStream = "outbound"
+
+	// Postmark API error codes for recipients it will not send to.
+	postmarkInvalidEmail      = 300
+	postmarkInactiveRecipient = 406
+)
+
+// PostmarkConfig configures the Postmark Email API.
+type PostmarkConfig struct {
+	ServerToken string
+	// MessageStream defaults to the transactional "outbound" stream.
+	MessageStream string
+	// BaseURL overrides https://api.postmarkapp.com.
+	BaseURL string
+}
+
+// PostmarkProvider sends through POST /email. The message ID is the
+// MessageID Postmark reports in its bounce and delivery webhooks.
+type PostmarkProvider struct {
+	cfg    PostmarkConfig
+	from   Address
+	client *http.Client
+}
+
+func NewPostmark(cfg PostmarkConfig, from Address, client *http.Client) (*PostmarkProvider, error) {
+	if strings.TrimSpace(cfg.ServerToken) == "" {
+		return nil, errors.Join(ErrMissingCredentials, errors.New("postmark server token"))
+	}
+	if strings.TrimSpace(cfg.MessageStream) == "" {
+		cfg.MessageStream = defaultPostmarkMessageStream
+	}
+	cfg.BaseURL = trimBaseURL(cfg.BaseURL, defaultPostmarkBaseURL)
+	return &PostmarkProvider{cfg: cfg, from: from, client: client}, nil
+}
+
+type postmarkEmail struct {
+	From          string `json:"From"`
+	To            string `json:"To"`
+	Subject       string `json:"Subject"`
+	HTMLBody      string `json:"HtmlBody,omitempty"`
+	TextBody      string `json:"TextBody,omitempty"`
+	MessageStream string `json:"MessageStream"`
+}
+
+type postmarkResponse struct {
+	MessageID string `json:"MessageID"`
+	ErrorCode int    `json:"ErrorCode"`
+	Message   string `json:"Message"`
+}
+
+func (p *PostmarkProvider) Send(ctx context.Context, req Request) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(req.To) == "" {
+		return "", ErrEmptyRecipient
+	}
+
+	body, err := json.Marshal(postmarkEmail{
+		From:          p.from.String(),
+		To:            strings.TrimSpace(req.To),
+		Subject:       req.Subject,
+		HTMLBody:      req.HTMLBody,
+		TextBody:      req.TextBody,
+		MessageStream: p.cfg.MessageStream,
+	})
+	if err != nil {
+		return "", err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.BaseURL+"/email", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Postmark-Server-Token", p.cfg.ServerToken)
+
+	resp, err := doAPI(p.client, httpReq, parsePostmarkError)
+	if err != nil {
+		return "", apiDeliveryError(ctx, err, postmarkRejectedRecipient)
+	}
+	var out postmarkResponse
+	// A body that does not parse still means the message was accepted.
+	_ = json.Unmarshal(resp.Body, &out)
+	return messageIDOrRandom(out.MessageID), nil
+}
+
+func parsePostmarkError(status int, body []byte) *APIError {
+	apiErr := &APIError{Provider: ProviderPostmark, StatusCode: status}
+	var resp postmarkResponse
+	if json.Unmarshal(body, &resp) == nil {
+		apiErr.Message = resp.Message
+		if resp.ErrorCode != 0 {
+			apiErr.Code = strconv.Itoa(resp.ErrorCode)
+		}
+	}
+	return apiErr
+}
+
+func postmarkRejectedRecipient(apiErr *APIError) bool {
+	code, err := strconv.Atoi(apiErr.Code)
+	return err == nil && (code == postmarkInvalidEmail || code == postmarkInactiveRecipient)
+}
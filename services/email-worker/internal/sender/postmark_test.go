@@ -0,0 +1,65 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostmark_SendsEmailAndReturnsMessageID(t *testing.T) {
+	var got postmarkEmail
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/email" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		if token := r.Header.Get("X-Postmark-Server-Token"); token != "pm-token" {
+			t.Errorf("token=%q", token)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"To":"user@example.com","MessageID":"b7bc2f4a-e38e-4336-af7d-e6c392c2f817","ErrorCode":0,"Message":"OK"}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewPostmark(PostmarkConfig{ServerToken: "pm-token", BaseURL: srv.URL}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	id, err := p.Send(context.Background(), Request{To: "user@example.com", Subject: "Verify", HTMLBody: "<p>Hi</p>", TextBody: "Hi"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if id != "b7bc2f4a-e38e-4336-af7d-e6c392c2f817" {
+		t.Fatalf("id=%q", id)
+	}
+	want := postmarkEmail{From: `"Anvilkit Auth" <noreply@example.com>`, To: "user@example.com", Subject: "Verify", HTMLBody: "<p>Hi</p>", TextBody: "Hi", MessageStream: "outbound"}
+	if got != want {
+		t.Fatalf("email=%+v want=%+v", got, want)
+	}
+}
+
+func TestPostmark_InactiveRecipientIsHardBounce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"ErrorCode":406,"Message":"You tried to send to a recipient that has been marked as inactive."}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewPostmark(PostmarkConfig{ServerToken: "pm-token", BaseURL: srv.URL}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = p.Send(context.Background(), Request{To: "user@example.com", Subject: "Verify", TextBody: "Hi"})
+	var deliveryErr *DeliveryError
+	if !errors.As(err, &deliveryErr) || deliveryErr.Classification.Type != BounceTypeHard {
+		t.Fatalf("err=%v want hard delivery error", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "406" {
+		t.Fatalf("err=%v want code 406", err)
+	}
+}
@@ -0,0 +1,107 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"anvilkit-auth-template/modules/common-go/pkg/email"
+)
+
+// Email providers selectable with EMAIL_PROVIDER.
+const (
+	ProviderSMTP     = "smtp"
+	ProviderSES      = "ses"
+	ProviderSendGrid = "sendgrid"
+	ProviderMailgun  = "mailgun"
+	ProviderPostmark = "postmark"
+)
+
+const defaultProviderTimeout = 10 * time.Second
+
+var (
+	ErrUnknownProvider    = errors.New("unknown_email_provider")
+	ErrMissingCredentials = errors.New("missing_provider_credentials")
+	ErrInvalidFromEmail   = errors.New("invalid_from_email")
+)
+
+// Provider delivers one email and returns the provider's message ID, which
+// its delivery webhooks report as external_id. Failures are *DeliveryError
+// when the provider reports why the message was not accepted.
+type Provider interface {
+	Send(ctx context.Context, req Request) (string, error)
+}
+
+var (
+	_ Provider = (*Sender)(nil)
+	_ Provider = (*SESProvider)(nil)
+	_ Provider = (*SendGridProvider)(nil)
+	_ Provider = (*MailgunProvider)(nil)
+	_ Provider = (*PostmarkProvider)(nil)
+)
+
+// Address is the sender of every email.
+type Address struct {
+	Email string
+	Name  string
+}
+
+func (a Address) String() string {
+	return (&mail.Address{Name: strings.TrimSpace(a.Name), Address: strings.TrimSpace(a.Email)}).String()
+}
+
+func (a Address) validate() error {
+	addr, err := mail.ParseAddress(strings.TrimSpace(a.Email))
+	if err != nil || addr.Address == "" {
+		return ErrInvalidFromEmail
+	}
+	return nil
+}
+
+// ProviderConfig selects and configures the email provider. Only the
+// settings of the provider named by Name are used.
+type ProviderConfig struct {
+	Name string
+	From Address
+	// Timeout bounds each API request of the HTTP providers.
+	Timeout time.Duration
+
+	SMTP     email.SMTPConfig
+	SES      SESConfig
+	SendGrid SendGridConfig
+	Mailgun  MailgunConfig
+	Postmark PostmarkConfig
+}
+
+// NewProvider returns the provider named by cfg.Name, SMTP when empty.
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	name := strings.ToLower(strings.TrimSpace(cfg.Name))
+	if name == "" || name == ProviderSMTP {
+		return New(cfg.SMTP), nil
+	}
+	if err := cfg.From.validate(); err != nil {
+		return nil, err
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultProviderTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+
+	switch name {
+	case ProviderSES:
+		return NewSES(cfg.SES, cfg.From, client)
+	case ProviderSendGrid:
+		return NewSendGrid(cfg.SendGrid, cfg.From, client)
+	case ProviderMailgun:
+		return NewMailgun(cfg.Mailgun, cfg.From, client)
+	case ProviderPostmark:
+		return NewPostmark(cfg.Postmark, cfg.From, client)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, cfg.Name)
+	}
+}
@@ -0,0 +1,117 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	commonemail "anvilkit-auth-template/modules/common-go/pkg/email"
+)
+
+var testFrom = Address{Email: "noreply@example.com", Name: "Anvilkit Auth"}
+
+func TestNewProvider_SelectsByName(t *testing.T) {
+	cases := []struct {
+		cfg  ProviderConfig
+		want any
+	}{
+		{ProviderConfig{SMTP: commonemail.SMTPConfig{Host: "localhost"}}, &Sender{}},
+		{ProviderConfig{Name: "SMTP"}, &Sender{}},
+		{ProviderConfig{Name: ProviderSES, From: testFrom, SES: SESConfig{Region: "eu-west-1", AccessKeyID: "AKID", SecretAccessKey: "secret"}}, &SESProvider{}},
+		{ProviderConfig{Name: ProviderSendGrid, From: testFrom, SendGrid: SendGridConfig{APIKey: "key"}}, &SendGridProvider{}},
+		{ProviderConfig{Name: ProviderMailgun, From: testFrom, Mailgun: MailgunConfig{APIKey: "key", Domain: "mg.example.com"}}, &MailgunProvider{}},
+		{ProviderConfig{Name: ProviderPostmark, From: testFrom, Postmark: PostmarkConfig{ServerToken: "token"}}, &PostmarkProvider{}},
+	}
+	for _, tc := range cases {
+		p, err := NewProvider(tc.cfg)
+		if err != nil {
+			t.Fatalf("NewProvider(%q): %v", tc.cfg.Name, err)
+		}
+		if got, want := typeName(p), typeName(tc.want); got != want {
+			t.Fatalf("NewProvider(%q) = %s want %s", tc.cfg.Name, got, want)
+		}
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case *Sender:
+		return "smtp"
+	case *SESProvider:
+		return "ses"
+	case *SendGridProvider:
+		return "sendgrid"
+	case *MailgunProvider:
+		return "mailgun"
+	case *PostmarkProvider:
+		return "postmark"
+	default:
+		return "unknown"
+	}
+}
+
+func TestNewProvider_ValidatesConfig(t *testing.T) {
+	if _, err := NewProvider(ProviderConfig{Name: "pigeon", From: testFrom}); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("err=%v want=%v", err, ErrUnknownProvider)
+	}
+	if _, err := NewProvider(ProviderConfig{Name: ProviderSendGrid, From: testFrom}); !errors.Is(err, ErrMissingCredentials) {
+		t.Fatalf("err=%v want=%v", err, ErrMissingCredentials)
+	}
+	if _, err := NewProvider(ProviderConfig{Name: ProviderPostmark, From: Address{Email: "not-an-address"}, Postmark: PostmarkConfig{ServerToken: "token"}}); !errors.Is(err, ErrInvalidFromEmail) {
+		t.Fatalf("err=%v want=%v", err, ErrInvalidFromEmail)
+	}
+}
+
+func TestAPIDeliveryError_Classification(t *testing.T) {
+	cases := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"network error", errors.New("connection refused"), true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &APIError{StatusCode: http.StatusUnauthorized}, false},
+	}
+	for _, tc := range cases {
+		err := apiDeliveryError(context.Background(), tc.err, nil)
+		// Only a refused recipient is a bounce.
+		var deliveryErr *DeliveryError
+		if errors.As(err, &deliveryErr) {
+			t.Fatalf("%s: err=%v is a bounce", tc.name, err)
+		}
+		var unavailableErr *UnavailableError
+		if got := errors.As(err, &unavailableErr); got != tc.unavailable {
+			t.Fatalf("%s: unavailable=%v want=%v", tc.name, got, tc.unavailable)
+		}
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%s: err should unwrap cause", tc.name)
+		}
+	}
+}
+
+func TestHTTPProvider_CancelledRequestIsNotABounce(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p, err := NewSendGrid(SendGridConfig{APIKey: "key", BaseURL: srv.URL}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = p.Send(ctx, Request{To: "user@example.com", Subject: "Hi", TextBody: "Hello"})
+	var deliveryErr *DeliveryError
+	if err == nil || errors.As(err, &deliveryErr) {
+		t.Fatalf("err=%v want a plain context error", err)
+	}
+}
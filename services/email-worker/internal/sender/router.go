@@ -0,0 +1,312 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Results reported to Router.OnResult for each provider attempt.
+const (
+	ResultSuccess = "success"
+	// ResultUnavailable is a rate limit, transport error or 5xx response;
+	// the router fails over to the next provider and counts it against the
+	// circuit.
+	ResultUnavailable = "unavailable"
+	// ResultRejected is any other error, such as a bounce, which another
+	// provider would not fix.
+	ResultRejected = "rejected"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultCooldown         = 30 * time.Second
+)
+
+var (
+	ErrNoProviders         = errors.New("no_email_providers")
+	ErrDuplicateProvider   = errors.New("duplicate_email_provider")
+	ErrInvalidProviderName = errors.New("invalid_email_provider_name")
+)
+
+// Route is a provider the router may send through. Weight is its share of
+// emails while every provider is healthy; it defaults to 1.
+type Route struct {
+	Name     string
+	Provider Provider
+	Weight   int
+}
+
+// Router spreads emails over several providers by weight and fails over to
+// the next one when a provider is unavailable. Each provider has a circuit
+// breaker: after FailureThreshold consecutive failures it is skipped for
+// Cooldown, then a single email probes it again.
+type Router struct {
+	// FailureThreshold defaults to 5 and Cooldown to 30s.
+	FailureThreshold int
+	Cooldown         time.Duration
+	// OnResult, if set, is called after every provider attempt.
+	OnResult func(provider, result string)
+	// OnCircuit, if set, is called when a provider's circuit opens or
+	// closes.
+	OnCircuit func(provider string, open bool)
+
+	routes []*route
+	intN   func(int) int
+	now    func() time.Time
+}
+
+type route struct {
+	Route
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func NewRouter(routes []Route) (*Router, error) {
+	if len(routes) == 0 {
+		return nil, ErrNoProviders
+	}
+	r := &Router{intN: rand.IntN, now: time.Now}
+	seen := make(map[string]bool, len(routes))
+	for _, rt := range routes {
+		if strings.TrimSpace(rt.Name) == "" || rt.Provider == nil {
+			return nil, ErrInvalidProviderName
+		}
+		if seen[rt.Name] {
+			return nil, ErrDuplicateProvider
+		}
+		seen[rt.Name] = true
+		if rt.Weight <= 0 {
+			rt.Weight = 1
+		}
+		r.routes = append(r.routes, &route{Route: rt})
+	}
+	return r, nil
+}
+
+// Providers returns the provider names in configuration order.
+func (r *Router) Providers() []string {
+	names := make([]string, 0, len(r.routes))
+	for _, rt := range r.routes {
+		names = append(names, rt.Name)
+	}
+	return names
+}
+
+// Close closes the providers that keep connections open, such as SMTP.
+func (r *Router) Close() error {
+	var errs []error
+	for _, rt := range r.routes {
+		if closer, ok := rt.Provider.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Router) Send(ctx context.Context, req Request) (string, error) {
+	id, _, err := r.SendVia(ctx, req)
+	return id, err
+}
+
+// SendVia sends req and also returns the name of the provider that accepted
+// it. Providers with an open circuit are skipped unless all are open, in
+// which case all are tried. The error of the last provider tried is
+// returned when none accepts the email.
+func (r *Router) SendVia(ctx context.Context, req Request) (string, string, error) {
+	if candidates := r.available(); len(candidates) > 0 {
+		id, name, tried, err := r.try(ctx, req, candidates, false)
+		if tried {
+			return id, name, err
+		}
+		// Every half-open candidate lost its probe to another email.
+	}
+	id, name, _, err := r.try(ctx, req, r.routes, true)
+	return id, name, err
+}
+
+// try sends req through routes in weighted order until one accepts it or
+// fails for a reason another provider would not fix. Unless force is set, a
+// half-open route is only tried when this email claims its probe; every
+// claimed probe is settled before try returns. tried reports whether any
+// provider was called.
+func (r *Router) try(ctx context.Context, req Request, routes []*route, force bool) (id, name string, tried bool, err error) {
+	for _, rt := range r.order(routes) {
+		probe := false
+		if !force {
+			var ok bool
+			if ok, probe = rt.acquire(r.now()); !ok {
+				continue
+			}
+		}
+		tried = true
+		id, err = rt.Provider.Send(ctx, req)
+		name = rt.Name
+		if err == nil {
+			r.succeeded(rt)
+			return id, name, true, nil
+		}
+		if ctx.Err() != nil {
+			rt.release(probe)
+			return "", name, true, err
+		}
+		if !unavailable(err) {
+			rt.release(probe)
+			r.report(rt.Name, ResultRejected)
+			return "", name, true, err
+		}
+		r.failed(rt)
+	}
+	return "", name, tried, err
+}
+
+// unavailable reports whether err means the provider, rather than the
+// email, failed: an UnavailableError, a transport error or a 5xx response.
+func unavailable(err error) bool {
+	if errors.As(err, new(*UnavailableError)) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// available returns the routes whose circuit admits an email. It does not
+// claim probes; try does that for the route it is about to call.
+func (r *Router) available() []*route {
+	now := r.now()
+	routes := make([]*route, 0, len(r.routes))
+	for _, rt := range r.routes {
+		if rt.admits(now) {
+			routes = append(routes, rt)
+		}
+	}
+	return routes
+}
+
+// order shuffles routes so that each comes first with probability
+// proportional to its weight, and likewise among those left.
+func (r *Router) order(routes []*route) []*route {
+	rest := append([]*route(nil), routes...)
+	total := 0
+	for _, rt := range rest {
+		total += rt.Weight
+	}
+	order := make([]*route, 0, len(rest))
+	for len(rest) > 0 {
+		n := r.intN(total)
+		i := 0
+		for n >= rest[i].Weight {
+			n -= rest[i].Weight
+			i++
+		}
+		order = append(order, rest[i])
+		total -= rest[i].Weight
+		rest = append(rest[:i], rest[i+1:]...)
+	}
+	return order
+}
+
+func (r *Router) succeeded(rt *route) {
+	if rt.success() {
+		r.circuit(rt.Name, false)
+	}
+	r.report(rt.Name, ResultSuccess)
+}
+
+func (r *Router) failed(rt *route) {
+	threshold := r.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	cooldown := r.Cooldown
+	if cooldown <= 0 {
+		cooldown = defaultCooldown
+	}
+	if rt.failure(r.now(), threshold, cooldown) {
+		r.circuit(rt.Name, true)
+	}
+	r.report(rt.Name, ResultUnavailable)
+}
+
+func (r *Router) report(provider, result string) {
+	if r.OnResult != nil {
+		r.OnResult(provider, result)
+	}
+}
+
+func (r *Router) circuit(provider string, open bool) {
+	if r.OnCircuit != nil {
+		r.OnCircuit(provider, open)
+	}
+}
+
+// admits reports whether the circuit is closed, or open past its cooldown
+// with no probe in flight.
+func (rt *route) admits(now time.Time) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.openUntil.IsZero() || (!now.Before(rt.openUntil) && !rt.probing)
+}
+
+// acquire reports whether the circuit admits an email now and whether that
+// email is the probe of an open circuit, which only one may be at a time.
+func (rt *route) acquire(now time.Time) (ok, probe bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.openUntil.IsZero() {
+		return true, false
+	}
+	if now.Before(rt.openUntil) || rt.probing {
+		return false, false
+	}
+	rt.probing = true
+	return true, true
+}
+
+// success closes the circuit and reports whether it was open.
+func (rt *route) success() bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	wasOpen := !rt.openUntil.IsZero()
+	rt.failures = 0
+	rt.openUntil = time.Time{}
+	rt.probing = false
+	return wasOpen
+}
+
+// failure counts a failure and reports whether it opened the circuit. A
+// failed probe keeps the circuit open for another cooldown.
+func (rt *route) failure(now time.Time, threshold int, cooldown time.Duration) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.failures++
+	rt.probing = false
+	wasOpen := !rt.openUntil.IsZero()
+	if wasOpen || rt.failures >= threshold {
+		rt.openUntil = now.Add(cooldown)
+	}
+	return !wasOpen && !rt.openUntil.IsZero()
+}
+
+// release ends a probe whose email was rejected for its own reasons, or
+// cut short by its context, which says nothing about the provider's health.
+func (rt *route) release(probe bool) {
+	if !probe {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.probing = false
+}
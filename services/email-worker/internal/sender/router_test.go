@@ -0,0 +1,310 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type stubProvider struct {
+	calls int
+	errs  []error
+}
+
+func (p *stubProvider) Send(_ context.Context, _ Request) (string, error) {
+	p.calls++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		if err != nil {
+			return "", err
+		}
+	}
+	return "msg-1", nil
+}
+
+// firstRoute makes Router.order pick the first remaining route every time.
+func firstRoute(int) int { return 0 }
+
+func TestNewRouter_ValidatesRoutes(t *testing.T) {
+	if _, err := NewRouter(nil); !errors.Is(err, ErrNoProviders) {
+		t.Fatalf("err=%v want=%v", err, ErrNoProviders)
+	}
+	if _, err := NewRouter([]Route{{Name: " ", Provider: &stubProvider{}}}); !errors.Is(err, ErrInvalidProviderName) {
+		t.Fatalf("err=%v want=%v", err, ErrInvalidProviderName)
+	}
+	dup := []Route{{Name: "ses", Provider: &stubProvider{}}, {Name: "ses", Provider: &stubProvider{}}}
+	if _, err := NewRouter(dup); !errors.Is(err, ErrDuplicateProvider) {
+		t.Fatalf("err=%v want=%v", err, ErrDuplicateProvider)
+	}
+}
+
+func TestRouterOrder_FollowsWeights(t *testing.T) {
+	r, err := NewRouter([]Route{
+		{Name: "ses", Provider: &stubProvider{}, Weight: 3},
+		{Name: "sendgrid", Provider: &stubProvider{}, Weight: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	// With a total weight of 4, draws 0-2 pick ses first and 3 picks sendgrid.
+	for n, want := range []string{"ses", "ses", "ses", "sendgrid"} {
+		draw := n
+		r.intN = func(total int) int {
+			if total != 4 {
+				return 0
+			}
+			return draw
+		}
+		if got := r.order(r.routes)[0].Name; got != want {
+			t.Fatalf("draw %d: first=%s want=%s", n, got, want)
+		}
+	}
+}
+
+func TestRouterSendVia_FailsOverWhenProviderUnavailable(t *testing.T) {
+	unavailableErrs := []error{
+		&DeliveryError{Cause: &APIError{Provider: "ses", StatusCode: 503}},
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+		io.ErrUnexpectedEOF,
+		&UnavailableError{Cause: &APIError{Provider: "ses", StatusCode: 429}},
+		&UnavailableError{Cause: errors.New("ses api: malformed response")},
+	}
+	for _, sendErr := range unavailableErrs {
+		primary := &stubProvider{errs: []error{sendErr}}
+		secondary := &stubProvider{}
+		r, err := NewRouter([]Route{{Name: "ses", Provider: primary}, {Name: "sendgrid", Provider: secondary}})
+		if err != nil {
+			t.Fatalf("NewRouter() error = %v", err)
+		}
+		r.intN = firstRoute
+		var results []string
+		r.OnResult = func(provider, result string) { results = append(results, provider+"="+result) }
+
+		id, provider, err := r.SendVia(context.Background(), Request{To: "user@example.com"})
+		if err != nil {
+			t.Fatalf("SendVia(%v) error = %v", sendErr, err)
+		}
+		if id != "msg-1" || provider != "sendgrid" {
+			t.Fatalf("SendVia(%v) = %q, %q want msg-1, sendgrid", sendErr, id, provider)
+		}
+		if len(results) != 2 || results[0] != "ses="+ResultUnavailable || results[1] != "sendgrid="+ResultSuccess {
+			t.Fatalf("results=%v", results)
+		}
+	}
+}
+
+func TestRouterSendVia_DoesNotFailOverRejectedEmail(t *testing.T) {
+	rejected := &DeliveryError{
+		Cause:          &APIError{Provider: "postmark", StatusCode: 422, Code: "406"},
+		Classification: BounceClassification{Type: BounceTypeHard},
+	}
+	invalid := &APIError{Provider: "postmark", StatusCode: 422, Code: "300"}
+	for _, sendErr := range []error{rejected, invalid} {
+		primary := &stubProvider{errs: []error{sendErr}}
+		secondary := &stubProvider{}
+		r, err := NewRouter([]Route{{Name: "postmark", Provider: primary}, {Name: "ses", Provider: secondary}})
+		if err != nil {
+			t.Fatalf("NewRouter() error = %v", err)
+		}
+		r.intN = firstRoute
+
+		_, provider, err := r.SendVia(context.Background(), Request{To: "user@example.com"})
+		if !errors.Is(err, sendErr) {
+			t.Fatalf("err=%v want=%v", err, sendErr)
+		}
+		if provider != "postmark" || secondary.calls != 0 {
+			t.Fatalf("provider=%q secondary calls=%d want postmark, 0", provider, secondary.calls)
+		}
+	}
+}
+
+func TestRouterCircuit_OpensOnRateLimits(t *testing.T) {
+	rateLimited := &UnavailableError{Cause: &APIError{Provider: "ses", StatusCode: 429}}
+	primary := &stubProvider{errs: []error{rateLimited, rateLimited}}
+	r, err := NewRouter([]Route{{Name: "ses", Provider: primary}, {Name: "sendgrid", Provider: &stubProvider{}}})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	r.intN = firstRoute
+	r.FailureThreshold = 2
+	var results []string
+	r.OnResult = func(provider, result string) { results = append(results, provider+"="+result) }
+	var circuits []string
+	r.OnCircuit = func(provider string, open bool) {
+		if open {
+			circuits = append(circuits, provider)
+		}
+	}
+
+	for range 3 {
+		if _, provider, err := r.SendVia(context.Background(), Request{To: "user@example.com"}); err != nil || provider != "sendgrid" {
+			t.Fatalf("SendVia() = %q, %v want sendgrid, nil", provider, err)
+		}
+	}
+	if results[0] != "ses="+ResultUnavailable {
+		t.Fatalf("results=%v want ses reported unavailable", results)
+	}
+	if len(circuits) != 1 || circuits[0] != "ses" || primary.calls != 2 {
+		t.Fatalf("circuits=%v ses calls=%d want ses open after 2 calls", circuits, primary.calls)
+	}
+}
+
+func TestRouterSendVia_StopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	primary := &stubProvider{errs: []error{context.Canceled}}
+	secondary := &stubProvider{}
+	r, err := NewRouter([]Route{{Name: "ses", Provider: primary}, {Name: "sendgrid", Provider: secondary}})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	r.intN = firstRoute
+
+	if _, _, err := r.SendVia(ctx, Request{To: "user@example.com"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want=%v", err, context.Canceled)
+	}
+	if secondary.calls != 0 {
+		t.Fatalf("secondary calls=%d want=0", secondary.calls)
+	}
+}
+
+func TestRouterCircuit_OpensAndProbesAfterCooldown(t *testing.T) {
+	outage := &APIError{Provider: "ses", StatusCode: 502}
+	primary := &stubProvider{errs: []error{outage, outage, outage}}
+	secondary := &stubProvider{}
+	r, err := NewRouter([]Route{{Name: "ses", Provider: primary}, {Name: "sendgrid", Provider: secondary}})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	r.intN = firstRoute
+	r.FailureThreshold = 2
+	r.Cooldown = time.Minute
+	now := time.Unix(1_700_000_000, 0)
+	r.now = func() time.Time { return now }
+	var circuits []string
+	r.OnCircuit = func(provider string, open bool) {
+		state := "closed"
+		if open {
+			state = "open"
+		}
+		circuits = append(circuits, provider+"="+state)
+	}
+
+	send := func() string {
+		t.Helper()
+		_, provider, err := r.SendVia(context.Background(), Request{To: "user@example.com"})
+		if err != nil {
+			t.Fatalf("SendVia() error = %v", err)
+		}
+		return provider
+	}
+
+	send()
+	send()
+	if len(circuits) != 1 || circuits[0] != "ses=open" {
+		t.Fatalf("circuits=%v want [ses=open]", circuits)
+	}
+
+	// While open, ses is skipped.
+	send()
+	if primary.calls != 2 {
+		t.Fatalf("ses calls=%d want=2", primary.calls)
+	}
+
+	// After the cooldown a probe fails and the circuit stays open.
+	now = now.Add(time.Minute)
+	send()
+	if primary.calls != 3 {
+		t.Fatalf("ses calls=%d want=3", primary.calls)
+	}
+	send()
+	if primary.calls != 3 {
+		t.Fatalf("ses calls=%d want=3 while open again", primary.calls)
+	}
+
+	// The next probe succeeds and closes the circuit.
+	now = now.Add(time.Minute)
+	if got := send(); got != "ses" {
+		t.Fatalf("provider=%s want=ses", got)
+	}
+	if len(circuits) != 2 || circuits[1] != "ses=closed" {
+		t.Fatalf("circuits=%v want [ses=open ses=closed]", circuits)
+	}
+}
+
+func TestRouterSendVia_TriesAllProvidersWhenEveryCircuitIsOpen(t *testing.T) {
+	outage := &APIError{Provider: "ses", StatusCode: 500}
+	only := &stubProvider{errs: []error{outage}}
+	r, err := NewRouter([]Route{{Name: "ses", Provider: only}})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	r.FailureThreshold = 1
+	r.Cooldown = time.Hour
+
+	if _, _, err := r.SendVia(context.Background(), Request{To: "user@example.com"}); !errors.Is(err, outage) {
+		t.Fatalf("err=%v want=%v", err, outage)
+	}
+	if _, provider, err := r.SendVia(context.Background(), Request{To: "user@example.com"}); err != nil || provider != "ses" {
+		t.Fatalf("SendVia() = %q, %v want ses, nil", provider, err)
+	}
+}
+
+func TestRouterCircuit_ProbeIsNotLostWhenAnotherProviderIsTried(t *testing.T) {
+	outage := &APIError{Provider: "ses", StatusCode: 503}
+	primary := &stubProvider{errs: []error{outage, context.Canceled}}
+	secondary := &stubProvider{}
+	r, err := NewRouter([]Route{{Name: "ses", Provider: primary}, {Name: "sendgrid", Provider: secondary}})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	r.FailureThreshold = 1
+	r.Cooldown = time.Minute
+	now := time.Unix(1_700_000_000, 0)
+	r.now = func() time.Time { return now }
+	var circuits []string
+	r.OnCircuit = func(provider string, open bool) {
+		state := "closed"
+		if open {
+			state = "open"
+		}
+		circuits = append(circuits, provider+"="+state)
+	}
+	lastRoute := func(total int) int { return total - 1 }
+
+	r.intN = firstRoute
+	if _, _, err := r.SendVia(context.Background(), Request{To: "user@example.com"}); err != nil {
+		t.Fatalf("SendVia() error = %v", err)
+	}
+	now = now.Add(time.Minute)
+
+	// sendgrid comes first and accepts the email, so ses is never probed and
+	// must stay available for the next one.
+	r.intN = lastRoute
+	if _, provider, err := r.SendVia(context.Background(), Request{To: "user@example.com"}); err != nil || provider != "sendgrid" {
+		t.Fatalf("SendVia() = %q, %v want sendgrid, nil", provider, err)
+	}
+
+	// A probe cut short by its context is released as well.
+	r.intN = firstRoute
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := r.SendVia(ctx, Request{To: "user@example.com"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want=%v", err, context.Canceled)
+	}
+
+	if _, provider, err := r.SendVia(context.Background(), Request{To: "user@example.com"}); err != nil || provider != "ses" {
+		t.Fatalf("SendVia() = %q, %v want ses, nil", provider, err)
+	}
+	if primary.calls != 3 {
+		t.Fatalf("ses calls=%d want=3", primary.calls)
+	}
+	if len(circuits) != 2 || circuits[1] != "ses=closed" {
+		t.Fatalf("circuits=%v want [ses=open ses=closed]", circuits)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/google/uuid"
@@ -21,7 +22,7 @@ type Request struct {
 }
 
 type smtpClient interface {
-	SendEmail(to, subject, htmlBody, textBody string) error
+	Send(ctx context.Context, to, subject, htmlBody, textBody string) error
 }
 
 type DeliveryError struct {
@@ -46,12 +47,35 @@ func (e *DeliveryError) Unwrap() error {
 	return e.Cause
 }
 
+// UnavailableError is a send that failed because of the provider rather than
+// the recipient: a rate limit, a server error or a transport error. The email
+// did not bounce and can be sent again shortly.
+type UnavailableError struct {
+	Cause error
+}
+
+func (e *UnavailableError) Error() string {
+	if e == nil || e.Cause == nil {
+		return "provider_unavailable"
+	}
+	return e.Cause.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.Cause
+}
+
+// Sender is the SMTP provider. SMTP returns no message ID, so Send returns
+// a random one. Connections are reused across emails until Close.
 type Sender struct {
 	smtp smtpClient
 }
 
 func New(cfg email.SMTPConfig) *Sender {
-	return &Sender{smtp: cfg}
+	return &Sender{smtp: email.NewClient(cfg)}
 }
 
 func (s *Sender) Send(ctx context.Context, req Request) (string, error) {
@@ -63,10 +87,26 @@ func (s *Sender) Send(ctx context.Context, req Request) (string, error) {
 	}
 	smtpClient := s.smtp
 	if smtpClient == nil {
-		smtpClient = email.SMTPConfig{}
+		smtpClient = email.NewClient(email.SMTPConfig{})
 	}
-	if err := smtpClient.SendEmail(req.To, req.Subject, req.HTMLBody, req.TextBody); err != nil {
-		return "", &DeliveryError{Cause: err, Classification: ClassifySMTPError(err)}
+	if err := smtpClient.Send(ctx, req.To, req.Subject, req.HTMLBody, req.TextBody); err != nil {
+		// An email cut off by ctx ending is not a bounce; it is retried.
+		if ctx.Err() != nil {
+			return "", err
+		}
+		classification := ClassifySMTPError(err)
+		if classification.Type == BounceTypeNone && unavailable(err) {
+			return "", &UnavailableError{Cause: err}
+		}
+		return "", &DeliveryError{Cause: err, Classification: classification}
 	}
 	return uuid.NewString(), nil
 }
+
+// Close closes the connections kept for later emails.
+func (s *Sender) Close() error {
+	if closer, ok := s.smtp.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package sender
 import (
 	"context"
 	"errors"
+	"net"
 	"testing"
 
 	commonemail "anvilkit-auth-template/modules/common-go/pkg/email"
@@ -22,7 +23,7 @@ type mockSMTP struct {
 	calls []smtpCall
 }
 
-func (m *mockSMTP) SendEmail(to, subject, htmlBody, textBody string) error {
+func (m *mockSMTP) Send(_ context.Context, to, subject, htmlBody, textBody string) error {
 	m.calls = append(m.calls, smtpCall{
 		to:       to,
 		subject:  subject,
@@ -110,6 +111,21 @@ func TestSend_SMTPError(t *testing.T) {
 	}
 }
 
+func TestSend_SMTPTransportErrorIsUnavailable(t *testing.T) {
+	smtp := &mockSMTP{err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	s := &Sender{smtp: smtp}
+
+	_, err := s.Send(context.Background(), Request{To: "user@example.com", Subject: "Subject"})
+	var unavailableErr *UnavailableError
+	if !errors.As(err, &unavailableErr) {
+		t.Fatalf("err=%v want provider unavailable", err)
+	}
+	var deliveryErr *DeliveryError
+	if errors.As(err, &deliveryErr) {
+		t.Fatalf("err=%v should not be a delivery error", err)
+	}
+}
+
 func TestSend_ZeroValueSenderReturnsSMTPValidationError(t *testing.T) {
 	s := &Sender{}
 
@@ -124,3 +140,30 @@ func TestSend_ZeroValueSenderReturnsSMTPValidationError(t *testing.T) {
 		t.Fatalf("id=%q want empty", id)
 	}
 }
+
+func TestSend_ContextEndedDuringSendIsNotABounce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	smtp := &mockSMTP{err: context.Canceled}
+	s := &Sender{smtp: cancelingSMTP{mockSMTP: smtp, cancel: cancel}}
+
+	_, err := s.Send(ctx, Request{To: "user@example.com", Subject: "Subject"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want=%v", err, context.Canceled)
+	}
+	var deliveryErr *DeliveryError
+	if errors.As(err, &deliveryErr) {
+		t.Fatalf("err=%v should not be a delivery error", err)
+	}
+}
+
+// cancelingSMTP cancels the send's context before failing, like a send
+// interrupted by shutdown.
+type cancelingSMTP struct {
+	*mockSMTP
+	cancel context.CancelFunc
+}
+
+func (c cancelingSMTP) Send(ctx context.Context, to, subject, htmlBody, textBody string) error {
+	c.cancel()
+	return c.mockSMTP.Send(ctx, to, subject, htmlBody, textBody)
+}
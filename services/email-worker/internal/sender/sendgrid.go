@@ -0,0 +1,119 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const defaultSendGridBaseURL = "https://api.sendgrid.com"
+
+// SendGridConfig configures the SendGrid v3 Mail Send API.
+type SendGridConfig struct {
+	APIKey string
+	// BaseURL overrides https://api.sendgrid.com, e.g. for EU regional
+	// subusers (https://api.eu.sendgrid.com).
+	BaseURL string
+}
+
+// SendGridProvider sends through POST /v3/mail/send. The message ID is the
+// X-Message-Id response header, which prefixes sg_message_id in SendGrid
+// event webhooks.
+type SendGridProvider struct {
+	cfg    SendGridConfig
+	from   Address
+	client *http.Client
+}
+
+func NewSendGrid(cfg SendGridConfig, from Address, client *http.Client) (*SendGridProvider, error) {
+	if strings.TrimSpace(cfg.APIKey) == "" {
+		return nil, errors.Join(ErrMissingCredentials, errors.New("sendgrid api key"))
+	}
+	cfg.BaseURL = trimBaseURL(cfg.BaseURL, defaultSendGridBaseURL)
+	return &SendGridProvider{cfg: cfg, from: from, client: client}, nil
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridMail struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+}
+
+func (p *SendGridProvider) Send(ctx context.Context, req Request) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(req.To) == "" {
+		return "", ErrEmptyRecipient
+	}
+
+	msg := sendGridMail{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: strings.TrimSpace(req.To)}}}},
+		From:             sendGridAddress{Email: p.from.Email, Name: p.from.Name},
+		Subject:          req.Subject,
+	}
+	// SendGrid requires text/plain before text/html.
+	if req.TextBody != "" {
+		msg.Content = append(msg.Content, sendGridContent{Type: "text/plain", Value: req.TextBody})
+	}
+	if req.HTMLBody != "" {
+		msg.Content = append(msg.Content, sendGridContent{Type: "text/html", Value: req.HTMLBody})
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.BaseURL+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := doAPI(p.client, httpReq, parseSendGridError)
+	if err != nil {
+		return "", apiDeliveryError(ctx, err, nil)
+	}
+	return messageIDOrRandom(resp.Header.Get("X-Message-Id")), nil
+}
+
+func parseSendGridError(status int, body []byte) *APIError {
+	apiErr := &APIError{Provider: ProviderSendGrid, StatusCode: status}
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+			Field   string `json:"field"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &resp) == nil && len(resp.Errors) > 0 {
+		msgs := make([]string, 0, len(resp.Errors))
+		for _, e := range resp.Errors {
+			if e.Field != "" {
+				msgs = append(msgs, e.Field+": "+e.Message)
+				continue
+			}
+			msgs = append(msgs, e.Message)
+		}
+		apiErr.Message = strings.Join(msgs, "; ")
+	}
+	return apiErr
+}
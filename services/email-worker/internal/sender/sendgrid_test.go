@@ -0,0 +1,75 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendGrid_SendsMailAndReturnsMessageID(t *testing.T) {
+	var got sendGridMail
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/mail/send" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sg-key" {
+			t.Errorf("Authorization=%q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.Header().Set("X-Message-Id", "14c5d75ce93.dfd.64b469")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	p, err := NewSendGrid(SendGridConfig{APIKey: "sg-key", BaseURL: srv.URL + "/"}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	id, err := p.Send(context.Background(), Request{To: "user@example.com", Subject: "Verify", HTMLBody: "<p>Hi</p>", TextBody: "Hi"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if id != "14c5d75ce93.dfd.64b469" {
+		t.Fatalf("id=%q", id)
+	}
+	if len(got.Personalizations) != 1 || got.Personalizations[0].To[0].Email != "user@example.com" {
+		t.Fatalf("personalizations=%+v", got.Personalizations)
+	}
+	if got.From.Email != "noreply@example.com" || got.From.Name != "Anvilkit Auth" || got.Subject != "Verify" {
+		t.Fatalf("mail=%+v", got)
+	}
+	if len(got.Content) != 2 || got.Content[0].Type != "text/plain" || got.Content[1].Type != "text/html" || got.Content[1].Value != "<p>Hi</p>" {
+		t.Fatalf("content=%+v", got.Content)
+	}
+}
+
+func TestSendGrid_ErrorResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors":[{"message":"Does not contain a valid address.","field":"personalizations.0.to.0.email"}]}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewSendGrid(SendGridConfig{APIKey: "sg-key", BaseURL: srv.URL}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = p.Send(context.Background(), Request{To: "user@example.com", Subject: "Verify", TextBody: "Hi"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err=%v want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "personalizations.0.to.0.email: Does not contain a valid address." {
+		t.Fatalf("apiErr=%+v", apiErr)
+	}
+	var deliveryErr *DeliveryError
+	var unavailableErr *UnavailableError
+	if errors.As(err, &deliveryErr) || errors.As(err, &unavailableErr) {
+		t.Fatalf("err=%v want a permanent error", err)
+	}
+}
@@ -0,0 +1,195 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sesService = "ses"
+
+// SESConfig configures the Amazon SES v2 SendEmail API.
+type SESConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+	// ConfigurationSet, if set, routes events to the SES configuration set
+	// that publishes them to the webhook.
+	ConfigurationSet string
+	// Endpoint overrides https://email.<region>.amazonaws.com.
+	Endpoint string
+}
+
+// SESProvider sends through POST /v2/email/outbound-emails, signing requests
+// with AWS Signature Version 4. The message ID is the MessageId SES reports
+// in its event notifications.
+type SESProvider struct {
+	cfg    SESConfig
+	from   Address
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewSES(cfg SESConfig, from Address, client *http.Client) (*SESProvider, error) {
+	if strings.TrimSpace(cfg.Region) == "" || strings.TrimSpace(cfg.AccessKeyID) == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.Join(ErrMissingCredentials, errors.New("ses region and access key"))
+	}
+	cfg.Region = strings.TrimSpace(cfg.Region)
+	cfg.Endpoint = trimBaseURL(cfg.Endpoint, "https://email."+cfg.Region+".amazonaws.com")
+	return &SESProvider{cfg: cfg, from: from, client: client, now: time.Now}, nil
+}
+
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+type sesBody struct {
+	Text *sesContent `json:"Text,omitempty"`
+	HTML *sesContent `json:"Html,omitempty"`
+}
+
+type sesSendEmail struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses []string `json:"ToAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Simple struct {
+			Subject sesContent `json:"Subject"`
+			Body    sesBody    `json:"Body"`
+		} `json:"Simple"`
+	} `json:"Content"`
+	ConfigurationSetName string `json:"ConfigurationSetName,omitempty"`
+}
+
+func (p *SESProvider) Send(ctx context.Context, req Request) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(req.To) == "" {
+		return "", ErrEmptyRecipient
+	}
+
+	var msg sesSendEmail
+	msg.FromEmailAddress = p.from.String()
+	msg.Destination.ToAddresses = []string{strings.TrimSpace(req.To)}
+	msg.Content.Simple.Subject = sesContent{Data: req.Subject, Charset: "UTF-8"}
+	if req.TextBody != "" {
+		msg.Content.Simple.Body.Text = &sesContent{Data: req.TextBody, Charset: "UTF-8"}
+	}
+	if req.HTMLBody != "" {
+		msg.Content.Simple.Body.HTML = &sesContent{Data: req.HTMLBody, Charset: "UTF-8"}
+	}
+	msg.ConfigurationSetName = p.cfg.ConfigurationSet
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.Endpoint+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	signV4(httpReq, body, p.cfg, sesService, p.now())
+
+	resp, err := doAPI(p.client, httpReq, parseSESError)
+	if err != nil {
+		return "", apiDeliveryError(ctx, err, nil)
+	}
+	var out struct {
+		MessageID string `json:"MessageId"`
+	}
+	// A body that does not parse still means the message was accepted.
+	_ = json.Unmarshal(resp.Body, &out)
+	return messageIDOrRandom(out.MessageID), nil
+}
+
+func parseSESError(status int, body []byte) *APIError {
+	apiErr := &APIError{Provider: ProviderSES, StatusCode: status}
+	var resp struct {
+		Message string `json:"message"`
+		Type    string `json:"__type"`
+	}
+	if json.Unmarshal(body, &resp) == nil {
+		apiErr.Message = resp.Message
+		// "__type" may carry a namespace prefix, e.g. "...#MessageRejected".
+		apiErr.Code = resp.Type[strings.LastIndex(resp.Type, "#")+1:]
+	}
+	return apiErr
+}
+
+// signV4 adds the AWS Signature Version 4 headers to req, signing its Host,
+// Content-Type and X-Amz-* headers and body.
+func signV4(req *http.Request, body []byte, cfg SESConfig, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + cfg.Region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, cfg.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignV4_MatchesAWSTestSuite checks the "get-vanilla" case of the AWS
+// Signature Version 4 test suite.
+func TestSignV4_MatchesAWSTestSuite(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	cfg := SESConfig{Region: "us-east-1", AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, cfg, "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("Authorization=%q\nwant=%q", got, want)
+	}
+}
+
+func TestSES_SendsSignedRequestAndReturnsMessageID(t *testing.T) {
+	var got sesSendEmail
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/email/outbound-emails" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260102/eu-west-1/ses/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token, Signature=") {
+			t.Errorf("Authorization=%q", auth)
+		}
+		if r.Header.Get("X-Amz-Date") != "20260102T030405Z" || r.Header.Get("X-Amz-Security-Token") != "session" {
+			t.Errorf("headers=%v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"MessageId":"0102018a-1b2c-3d4e-5f60-718293a4b5c6-000000"}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewSES(SESConfig{Region: "eu-west-1", AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session", ConfigurationSet: "events", Endpoint: srv.URL}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	p.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	id, err := p.Send(context.Background(), Request{To: "user@example.com", Subject: "Verify", HTMLBody: "<p>Hi</p>", TextBody: "Hi"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if id != "0102018a-1b2c-3d4e-5f60-718293a4b5c6-000000" {
+		t.Fatalf("id=%q", id)
+	}
+	if got.FromEmailAddress != `"Anvilkit Auth" <noreply@example.com>` || len(got.Destination.ToAddresses) != 1 || got.Destination.ToAddresses[0] != "user@example.com" {
+		t.Fatalf("email=%+v", got)
+	}
+	body := got.Content.Simple.Body
+	if got.Content.Simple.Subject.Data != "Verify" || body.Text == nil || body.Text.Data != "Hi" || body.HTML == nil || body.HTML.Data != "<p>Hi</p>" {
+		t.Fatalf("content=%+v", got.Content.Simple)
+	}
+	if got.ConfigurationSetName != "events" {
+		t.Fatalf("configuration set=%q", got.ConfigurationSetName)
+	}
+}
+
+func TestSES_ThrottlingIsUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-ErrorType", "TooManyRequestsException")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"message":"Maximum sending rate exceeded."}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewSES(SESConfig{Region: "eu-west-1", AccessKeyID: "AKID", SecretAccessKey: "secret", Endpoint: srv.URL}, testFrom, srv.Client())
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = p.Send(context.Background(), Request{To: "user@example.com", Subject: "Verify", TextBody: "Hi"})
+	var unavailableErr *UnavailableError
+	if !errors.As(err, &unavailableErr) {
+		t.Fatalf("err=%v want provider unavailable", err)
+	}
+	if !strings.Contains(err.Error(), "Maximum sending rate exceeded.") {
+		t.Fatalf("err=%q", err)
+	}
+}
@@ -33,7 +33,9 @@ type AnalyticsRecord struct {
 	SentAt   *time.Time
 }
 
-func (s *Store) MarkSent(ctx context.Context, recordID, externalID string) error {
+// MarkSent records that provider accepted the email as externalID. An empty
+// provider is stored as null.
+func (s *Store) MarkSent(ctx context.Context, recordID, externalID, provider string) error {
 	if s.DB == nil {
 		return ErrNilDB
 	}
@@ -50,7 +52,7 @@ func (s *Store) MarkSent(ctx context.Context, recordID, externalID string) error
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	ct, err := tx.Exec(ctx, `update email_records set external_id=$2, status='sent', updated_at=now() where id=$1`, recordID, externalID)
+	ct, err := tx.Exec(ctx, `update email_records set external_id=$2, provider=nullif($3,''), status='sent', updated_at=now() where id=$1`, recordID, externalID, strings.TrimSpace(provider))
 	if err != nil {
 		return err
 	}
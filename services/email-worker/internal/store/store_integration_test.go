@@ -27,12 +27,12 @@ values($1,$2,'queued',now(),now())`,
 	}
 
 	s := &Store{DB: db}
-	if err := s.MarkSent(context.Background(), recordID, "esp-123"); err != nil {
+	if err := s.MarkSent(context.Background(), recordID, "esp-123", "ses"); err != nil {
 		t.Fatalf("mark sent: %v", err)
 	}
 
-	var externalID, status string
-	if err := db.QueryRow(context.Background(), `select external_id,status from email_records where id=$1`, recordID).Scan(&externalID, &status); err != nil {
+	var externalID, status, provider string
+	if err := db.QueryRow(context.Background(), `select external_id,status,provider from email_records where id=$1`, recordID).Scan(&externalID, &status, &provider); err != nil {
 		t.Fatalf("query email_records: %v", err)
 	}
 	if externalID != "esp-123" {
@@ -41,6 +41,9 @@ values($1,$2,'queued',now(),now())`,
 	if status != "sent" {
 		t.Fatalf("status=%q want=sent", status)
 	}
+	if provider != "ses" {
+		t.Fatalf("provider=%q want=ses", provider)
+	}
 
 	var historyStatus, historyMessage string
 	if err := db.QueryRow(context.Background(), `
@@ -130,7 +133,7 @@ func mustTestDB(t *testing.T) *pgxpool.Pool {
 
 func applyMigrations(t *testing.T, db *pgxpool.Pool) {
 	t.Helper()
-	for _, name := range []string{"001_init.sql", "002_authn_core.sql", "003_multitenant.sql", "004_email_service.sql", "005_email_verifications_token_hash_scope.sql", "006_email_blacklist.sql", "007_email_blacklist_normalization.sql"} {
+	for _, name := range []string{"001_init.sql", "002_authn_core.sql", "003_multitenant.sql", "004_email_service.sql", "005_email_verifications_token_hash_scope.sql", "006_email_blacklist.sql", "007_email_blacklist_normalization.sql", "018_email_provider.sql"} {
 		sqlPath := filepath.Join(migrationsDir(t), name)
 		sqlBytes, err := os.ReadFile(sqlPath)
 		if err != nil {
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrWebhookDeliveryNotFound = errors.New("webhook_delivery_not_found")
+
+// WebhookDelivery is a queued tenant webhook delivery with its endpoint.
+type WebhookDelivery struct {
+	ID              string
+	EventType       string
+	Status          string
+	Attempts        int
+	Payload         []byte
+	EndpointURL     string
+	EndpointSecret  string
+	EndpointEnabled bool
+}
+
+// WebhookAttempt is the outcome of one delivery attempt. Status is the
+// delivery's status afterwards; NextAttemptAt is set while it is retried.
+type WebhookAttempt struct {
+	DeliveryID    string
+	Status        string
+	StatusCode    int
+	Error         string
+	Duration      time.Duration
+	NextAttemptAt *time.Time
+}
+
+func (s *Store) LoadWebhookDelivery(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	if s.DB == nil {
+		return nil, ErrNilDB
+	}
+	var d WebhookDelivery
+	var payload string
+	err := s.DB.QueryRow(ctx, `
+select d.id, d.event_type, d.status, d.attempts, d.payload::text, e.url, e.secret, e.enabled
+from webhook_deliveries d
+join webhook_endpoints e on e.id = d.endpoint_id
+where d.id = $1`, deliveryID).Scan(&d.ID, &d.EventType, &d.Status, &d.Attempts, &payload, &d.EndpointURL, &d.EndpointSecret, &d.EndpointEnabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	return &d, nil
+}
+
+// RecordWebhookAttempt logs an attempt on a pending delivery and moves it to
+// a.Status. It returns the delivery's attempt count.
+func (s *Store) RecordWebhookAttempt(ctx context.Context, a WebhookAttempt) (int, error) {
+	if s.DB == nil {
+		return 0, ErrNilDB
+	}
+	if strings.TrimSpace(a.DeliveryID) == "" {
+		return 0, ErrEmptyRecordID
+	}
+	if strings.TrimSpace(a.Status) == "" {
+		return 0, ErrEmptyStatus
+	}
+
+	tx, err := s.DB.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var statusCode *int
+	if a.StatusCode > 0 {
+		statusCode = &a.StatusCode
+	}
+	var lastError *string
+	if a.Error != "" {
+		lastError = &a.Error
+	}
+	var attempts int
+	err = tx.QueryRow(ctx, `
+update webhook_deliveries
+set attempts = attempts + 1,
+    status = $2,
+    last_status_code = $3,
+    last_error = $4,
+    next_attempt_at = $5,
+    delivered_at = case when $2 = 'succeeded' then now() else delivered_at end,
+    updated_at = now()
+where id = $1 and status = 'pending'
+returning attempts`, a.DeliveryID, a.Status, statusCode, lastError, a.NextAttemptAt).Scan(&attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec(ctx, `
+insert into webhook_delivery_attempts(delivery_id, attempt, status_code, error, duration_ms)
+values ($1, $2, $3, $4, $5)`, a.DeliveryID, attempts, statusCode, lastError, a.Duration.Milliseconds()); err != nil {
+		return 0, err
+	}
+	return attempts, tx.Commit(ctx)
+}
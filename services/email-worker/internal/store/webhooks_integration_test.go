@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordWebhookAttempt_LogsAttemptsAndSettlesDelivery(t *testing.T) {
+	db := mustTestDB(t)
+	sqlBytes, err := os.ReadFile(filepath.Join(migrationsDir(t), "016_webhooks.sql"))
+	if err != nil {
+		t.Fatalf("read webhooks migration: %v", err)
+	}
+	if _, err = db.Exec(context.Background(), string(sqlBytes)); err != nil {
+		t.Fatalf("apply webhooks migration: %v", err)
+	}
+	truncateEmailTables(t, db)
+
+	ctx := context.Background()
+	if _, err = db.Exec(ctx, `
+insert into tenants(id, name) values ('t-hooks', 'Hooks');
+insert into webhook_endpoints(id, tenant_id, url, secret, events) values ('ep-1', 't-hooks', 'https://hooks.example.com', 'whsec_test', '{member.added}');
+insert into webhook_deliveries(id, endpoint_id, tenant_id, event_id, event_type, payload) values ('dlv-1', 'ep-1', 't-hooks', 'evt-1', 'member.added', '{"id": "evt-1"}');`); err != nil {
+		t.Fatalf("seed webhook delivery: %v", err)
+	}
+
+	s := &Store{DB: db}
+	d, err := s.LoadWebhookDelivery(ctx, "dlv-1")
+	if err != nil {
+		t.Fatalf("LoadWebhookDelivery: %v", err)
+	}
+	if d.Status != "pending" || d.EndpointURL != "https://hooks.example.com" || d.EndpointSecret != "whsec_test" || string(d.Payload) != `{"id": "evt-1"}` {
+		t.Fatalf("delivery=%+v", d)
+	}
+
+	next := time.Now().Add(time.Minute)
+	if n, err := s.RecordWebhookAttempt(ctx, WebhookAttempt{DeliveryID: "dlv-1", Status: "pending", StatusCode: 503, Error: "unavailable", Duration: 40 * time.Millisecond, NextAttemptAt: &next}); err != nil || n != 1 {
+		t.Fatalf("RecordWebhookAttempt retry=%d,%v", n, err)
+	}
+	if n, err := s.RecordWebhookAttempt(ctx, WebhookAttempt{DeliveryID: "dlv-1", Status: "succeeded", StatusCode: 200, Duration: 20 * time.Millisecond}); err != nil || n != 2 {
+		t.Fatalf("RecordWebhookAttempt success=%d,%v", n, err)
+	}
+	if _, err := s.RecordWebhookAttempt(ctx, WebhookAttempt{DeliveryID: "dlv-1", Status: "failed"}); !errors.Is(err, ErrWebhookDeliveryNotFound) {
+		t.Fatalf("attempt on settled delivery err=%v", err)
+	}
+
+	var status string
+	var lastCode int
+	var deliveredAt *time.Time
+	if err = db.QueryRow(ctx, `select status, last_status_code, delivered_at from webhook_deliveries where id = 'dlv-1'`).Scan(&status, &lastCode, &deliveredAt); err != nil {
+		t.Fatalf("query delivery: %v", err)
+	}
+	if status != "succeeded" || lastCode != 200 || deliveredAt == nil {
+		t.Fatalf("delivery status=%q code=%d delivered_at=%v", status, lastCode, deliveredAt)
+	}
+	var attempts int
+	if err = db.QueryRow(ctx, `select count(*) from webhook_delivery_attempts where delivery_id = 'dlv-1'`).Scan(&attempts); err != nil || attempts != 2 {
+		t.Fatalf("attempt rows=%d,%v", attempts, err)
+	}
+}
@@ -0,0 +1,273 @@
+// Package throttle limits how fast and how many emails at a time are sent to
+// each recipient domain. Budgets are kept in Redis so every worker replica
+// draws from the same one.
+package throttle
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultDomain configures the limits of domains without their own.
+	DefaultDomain = "*"
+	// OtherDomainLabel stands for domains limited by DefaultDomain in
+	// Decision.Label, keeping metric labels bounded.
+	OtherDomainLabel = "other"
+
+	ReasonRate        = "rate_limited"
+	ReasonConcurrency = "concurrency_limited"
+
+	// DefaultLeaseTTL bounds how long a send holds a concurrency slot if
+	// its worker dies before releasing it.
+	DefaultLeaseTTL = 5 * time.Minute
+	// concurrencyRetry is how long a job waits for a free slot.
+	concurrencyRetry = time.Second
+
+	keyPrefix = "email:throttle:"
+)
+
+var (
+	ErrNilRedisClient = errors.New("nil_redis_client")
+	ErrInvalidLimits  = errors.New("invalid_domain_limits")
+)
+
+// acquireScript checks the concurrency cap (in-flight leases in the sorted
+// set KEYS[2], scored by expiry) and takes a token from the bucket in the
+// hash KEYS[1]; only if both allow it is the lease ARGV[5] added. ARGV is
+// now (ms), refill rate (tokens/ms, 0 for none), burst, max concurrent (0
+// for none), lease and lease TTL (ms). It returns {0, 0} when allowed,
+// {1, wait ms} when rate limited and {2, 0} at the concurrency cap.
+var acquireScript = goredis.NewScript(`
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local max = tonumber(ARGV[4])
+local ttl = tonumber(ARGV[6])
+if max > 0 then
+  redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+  if redis.call('ZCARD', KEYS[2]) >= max then
+    return {2, 0}
+  end
+end
+if rate > 0 then
+  local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+  local tokens = tonumber(state[1]) or burst
+  local ts = tonumber(state[2]) or now
+  tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+  if tokens < 1 then
+    return {1, math.ceil((1 - tokens) / rate)}
+  end
+  redis.call('HSET', KEYS[1], 'tokens', tostring(tokens - 1), 'ts', ARGV[1])
+  redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+end
+if max > 0 then
+  redis.call('ZADD', KEYS[2], now + ttl, ARGV[5])
+  redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return {0, 0}
+`)
+
+// Client captures the subset of Redis commands used by Limiter.
+type Client interface {
+	goredis.Scripter
+	ZRem(ctx context.Context, key string, members ...any) *goredis.IntCmd
+}
+
+// Limit is the send budget of one domain. Rate is in sends per second and
+// refills a bucket of Burst sends; MaxConcurrent caps sends in flight. Zero
+// disables either limit.
+type Limit struct {
+	Domain        string
+	Rate          float64
+	Burst         int
+	MaxConcurrent int
+}
+
+// Decision is the outcome of Limiter.Acquire. An allowed decision must be
+// passed to Release once the send is over.
+type Decision struct {
+	Allowed bool
+	// Reason is ReasonRate or ReasonConcurrency when not allowed.
+	Reason string
+	// RetryAfter is how long to wait before trying the domain again.
+	RetryAfter time.Duration
+	// Label names the domain in metrics: the configured domain,
+	// OtherDomainLabel, or empty for unlimited domains.
+	Label string
+
+	inflightKey string
+	lease       string
+}
+
+// Limiter enforces per-domain Limits across worker replicas.
+type Limiter struct {
+	client Client
+	limits map[string]Limit
+	// LeaseTTL is how long a concurrency slot is held at most; zero means
+	// DefaultLeaseTTL. Keep it above the SMTP timeout.
+	LeaseTTL time.Duration
+	now      func() time.Time
+}
+
+func New(client Client, limits []Limit) (*Limiter, error) {
+	if client == nil {
+		return nil, ErrNilRedisClient
+	}
+	byDomain := make(map[string]Limit, len(limits))
+	for _, l := range limits {
+		byDomain[l.Domain] = l
+	}
+	return &Limiter{client: client, limits: byDomain, now: time.Now}, nil
+}
+
+// Acquire reserves a send to the domain of the address to. Domains without
+// a limit are always allowed.
+func (l *Limiter) Acquire(ctx context.Context, to string) (Decision, error) {
+	domain := Domain(to)
+	limit, ok := l.limits[domain]
+	label := domain
+	if !ok {
+		if limit, ok = l.limits[DefaultDomain]; !ok {
+			return Decision{Allowed: true}, nil
+		}
+		label = OtherDomainLabel
+	}
+
+	leaseTTL := l.LeaseTTL
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultLeaseTTL
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return Decision{}, err
+	}
+	d := Decision{Label: label, inflightKey: inflightKey(domain), lease: hex.EncodeToString(nonce)}
+	res, err := acquireScript.Run(ctx, l.client, []string{rateKey(domain), d.inflightKey},
+		l.now().UnixMilli(),
+		strconv.FormatFloat(limit.Rate/1000, 'g', -1, 64),
+		max(limit.Burst, 1),
+		limit.MaxConcurrent,
+		d.lease,
+		leaseTTL.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(res) != 2 {
+		return Decision{}, fmt.Errorf("unexpected throttle reply %v", res)
+	}
+	switch res[0] {
+	case 0:
+		d.Allowed = true
+		if limit.MaxConcurrent <= 0 {
+			d.inflightKey = ""
+		}
+	case 1:
+		d.Reason = ReasonRate
+		d.RetryAfter = time.Duration(res[1]) * time.Millisecond
+	default:
+		d.Reason = ReasonConcurrency
+		d.RetryAfter = concurrencyRetry
+	}
+	return d, nil
+}
+
+// Release frees the concurrency slot held by an allowed decision.
+func (l *Limiter) Release(ctx context.Context, d Decision) error {
+	if !d.Allowed || d.inflightKey == "" {
+		return nil
+	}
+	return l.client.ZRem(ctx, d.inflightKey, d.lease).Err()
+}
+
+// Domain returns the lowercase domain of an email address.
+func Domain(addr string) string {
+	return strings.ToLower(strings.TrimSpace(addr[strings.LastIndex(addr, "@")+1:]))
+}
+
+// The braces keep both keys of a domain in one Redis Cluster slot.
+func rateKey(domain string) string {
+	return keyPrefix + "{" + domain + "}:rate"
+}
+
+func inflightKey(domain string) string {
+	return keyPrefix + "{" + domain + "}:inflight"
+}
+
+// ParseLimits parses comma-separated "domain=rate[:concurrency]" entries,
+// where rate is "<sends>/s", "/m" or "/h", or 0 for no rate limit, e.g.
+// "gmail.com=20/s:10,outlook.com=600/m:5,*=50/s". Bursts are one second of
+// sends, at least one.
+func ParseLimits(raw string) ([]Limit, error) {
+	var limits []Limit
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		domain, spec, ok := strings.Cut(entry, "=")
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if !ok || domain == "" || seen[domain] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidLimits, entry)
+		}
+		seen[domain] = true
+
+		rateSpec, concurrency, hasConcurrency := strings.Cut(strings.TrimSpace(spec), ":")
+		limit := Limit{Domain: domain}
+		rate, err := parseRate(rateSpec)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidLimits, entry)
+		}
+		limit.Rate = rate
+		limit.Burst = max(1, int(math.Ceil(rate)))
+		if hasConcurrency {
+			n, err := strconv.Atoi(strings.TrimSpace(concurrency))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidLimits, entry)
+			}
+			limit.MaxConcurrent = n
+		}
+		if limit.Rate == 0 && limit.MaxConcurrent == 0 {
+			return nil, fmt.Errorf("%w: %q sets no limit", ErrInvalidLimits, entry)
+		}
+		limits = append(limits, limit)
+	}
+	return limits, nil
+}
+
+// parseRate returns "<n>/<unit>" in sends per second.
+func parseRate(spec string) (float64, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "0" {
+		return 0, nil
+	}
+	count, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, ErrInvalidLimits
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil || n <= 0 || math.IsInf(n, 0) {
+		return 0, ErrInvalidLimits
+	}
+	switch strings.TrimSpace(unit) {
+	case "s":
+		return n, nil
+	case "m":
+		return n / 60, nil
+	case "h":
+		return n / 3600, nil
+	default:
+		return 0, ErrInvalidLimits
+	}
+}
@@ -0,0 +1,185 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	redismock "github.com/go-redis/redismock/v9"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var testNow = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestLimiter(t *testing.T, client Client, limits []Limit) *Limiter {
+	t.Helper()
+	l, err := New(client, limits)
+	if err != nil {
+		t.Fatalf("new limiter: %v", err)
+	}
+	l.now = func() time.Time { return testNow }
+	return l
+}
+
+// expectAcquire matches the acquire script run for domain with the given
+// rate (tokens/ms), burst and concurrency cap; the lease is random.
+func expectAcquire(mock redismock.ClientMock, domain, rate string, burst, maxConcurrent int, reply []any) {
+	mock.CustomMatch(func(_, actual []any) error {
+		want := []any{"evalsha", acquireScript.Hash(), int64(2), rateKey(domain), inflightKey(domain), testNow.UnixMilli(), rate, burst, maxConcurrent}
+		if len(actual) != len(want)+2 {
+			return fmt.Errorf("unexpected command %v", actual)
+		}
+		for i := range want {
+			if fmt.Sprint(actual[i]) != fmt.Sprint(want[i]) {
+				return fmt.Errorf("arg %d=%v want %v", i, actual[i], want[i])
+			}
+		}
+		if lease, _ := actual[len(want)].(string); len(lease) != 16 {
+			return fmt.Errorf("unexpected lease %v", actual[len(want)])
+		}
+		return nil
+	}).ExpectEvalSha(acquireScript.Hash(), []string{rateKey(domain), inflightKey(domain)}, testNow.UnixMilli(), rate, burst, maxConcurrent, "lease", DefaultLeaseTTL.Milliseconds()).SetVal(reply)
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits(" gmail.com=20/s:10, Outlook.com=600/m:5 ,example.org=0:2,*=36/h ")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []Limit{
+		{Domain: "gmail.com", Rate: 20, Burst: 20, MaxConcurrent: 10},
+		{Domain: "outlook.com", Rate: 10, Burst: 10, MaxConcurrent: 5},
+		{Domain: "example.org", Rate: 0, Burst: 1, MaxConcurrent: 2},
+		{Domain: "*", Rate: 0.01, Burst: 1},
+	}
+	if len(limits) != len(want) {
+		t.Fatalf("limits=%+v want=%+v", limits, want)
+	}
+	for i := range want {
+		if limits[i] != want[i] {
+			t.Fatalf("limits[%d]=%+v want=%+v", i, limits[i], want[i])
+		}
+	}
+
+	for _, raw := range []string{"gmail.com", "gmail.com=20", "gmail.com=20/d", "gmail.com=-1/s", "gmail.com=0", "gmail.com=1/s:x", "a.com=1/s,a.com=2/s", "=1/s"} {
+		if _, err := ParseLimits(raw); !errors.Is(err, ErrInvalidLimits) {
+			t.Fatalf("ParseLimits(%q) err=%v want=%v", raw, err, ErrInvalidLimits)
+		}
+	}
+	if limits, err := ParseLimits(""); err != nil || len(limits) != 0 {
+		t.Fatalf("empty limits=%v err=%v", limits, err)
+	}
+}
+
+func TestDomain(t *testing.T) {
+	for addr, want := range map[string]string{"User@GMail.com": "gmail.com", "a@b@example.org": "example.org", "nobody": "nobody"} {
+		if got := Domain(addr); got != want {
+			t.Fatalf("Domain(%q)=%q want=%q", addr, got, want)
+		}
+	}
+}
+
+func TestAcquire_UnlimitedDomainSkipsRedis(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	l := newTestLimiter(t, client, []Limit{{Domain: "gmail.com", Rate: 1, Burst: 1}})
+
+	d, err := l.Acquire(context.Background(), "user@example.com")
+	if err != nil || !d.Allowed || d.Label != "" {
+		t.Fatalf("decision=%+v err=%v", d, err)
+	}
+	if err := l.Release(context.Background(), d); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestAcquire_AllowedHoldsLeaseUntilRelease(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	l := newTestLimiter(t, client, []Limit{{Domain: "gmail.com", Rate: 20, Burst: 20, MaxConcurrent: 10}})
+	expectAcquire(mock, "gmail.com", "0.02", 20, 10, []any{int64(0), int64(0)})
+
+	d, err := l.Acquire(context.Background(), "User@Gmail.com")
+	if err != nil || !d.Allowed || d.Label != "gmail.com" {
+		t.Fatalf("decision=%+v err=%v", d, err)
+	}
+	mock.ExpectZRem(inflightKey("gmail.com"), d.lease).SetVal(1)
+	if err := l.Release(context.Background(), d); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+func TestAcquire_ReportsLimitAndRetryDelay(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	l := newTestLimiter(t, client, []Limit{{Domain: "*", Rate: 0.5, Burst: 1, MaxConcurrent: 2}})
+	expectAcquire(mock, "example.com", "0.0005", 1, 2, []any{int64(1), int64(1500)})
+	expectAcquire(mock, "example.com", "0.0005", 1, 2, []any{int64(2), int64(0)})
+
+	d, err := l.Acquire(context.Background(), "a@example.com")
+	if err != nil || d.Allowed || d.Reason != ReasonRate || d.RetryAfter != 1500*time.Millisecond || d.Label != OtherDomainLabel {
+		t.Fatalf("decision=%+v err=%v", d, err)
+	}
+	d, err = l.Acquire(context.Background(), "b@example.com")
+	if err != nil || d.Allowed || d.Reason != ReasonConcurrency || d.RetryAfter != concurrencyRetry {
+		t.Fatalf("decision=%+v err=%v", d, err)
+	}
+	// Denied decisions hold no slot.
+	if err := l.Release(context.Background(), d); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("redis expectations: %v", err)
+	}
+}
+
+// TestLimiter_SharesBudgetInRedis runs the Lua script against a real Redis.
+func TestLimiter_SharesBudgetInRedis(t *testing.T) {
+	addr := strings.TrimSpace(os.Getenv("TEST_REDIS_ADDR"))
+	if addr == "" {
+		t.Skip("skip integration test: TEST_REDIS_ADDR is not set")
+	}
+	rdb := goredis.NewClient(&goredis.Options{Addr: addr})
+	defer rdb.Close()
+	ctx := context.Background()
+	domain := "throttle-test.example"
+	if err := rdb.Del(ctx, rateKey(domain), inflightKey(domain)).Err(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	// Two limiters stand in for two worker replicas.
+	limits := []Limit{{Domain: domain, Rate: 1, Burst: 2, MaxConcurrent: 1}}
+	a := newTestLimiter(t, rdb, limits)
+	b := newTestLimiter(t, rdb, limits)
+
+	first, err := a.Acquire(ctx, "x@"+domain)
+	if err != nil || !first.Allowed {
+		t.Fatalf("first=%+v err=%v", first, err)
+	}
+	if d, err := b.Acquire(ctx, "y@"+domain); err != nil || d.Reason != ReasonConcurrency {
+		t.Fatalf("second=%+v err=%v", d, err)
+	}
+	if err := a.Release(ctx, first); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	second, err := b.Acquire(ctx, "y@"+domain)
+	if err != nil || !second.Allowed {
+		t.Fatalf("after release=%+v err=%v", second, err)
+	}
+	if err := b.Release(ctx, second); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if d, err := a.Acquire(ctx, "z@"+domain); err != nil || d.Reason != ReasonRate || d.RetryAfter != time.Second {
+		t.Fatalf("burst spent=%+v err=%v", d, err)
+	}
+	if err := rdb.Del(ctx, rateKey(domain), inflightKey(domain)).Err(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+}